@@ -0,0 +1,159 @@
+// Package main is the entry point for the pools reindex tool. It rebuilds the
+// ElasticSearch pools index into a new versioned index and swaps the
+// defi_pools alias over once the copy is verified, so mapping changes reach
+// production without the index going unsearchable.
+//
+// Usage:
+//
+//	reindex                  # copy pools from PostgreSQL
+//	reindex -from=index      # copy the documents of the current index
+//	reindex -status          # print the progress of the current or last run
+//	reindex -grace=0         # delete the previous index right after the swap
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+)
+
+// Build information - set via ldflags during build
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+
+	from := flag.String("from", models.ReindexSourcePostgres, "where to copy documents from: postgres, or index for the index behind the alias")
+	statusOnly := flag.Bool("status", false, "print the progress of the current or last reindex and exit")
+	grace := flag.Duration("grace", cfg.ElasticSearch.ReindexGracePeriod, "how long to keep the previous index after the alias swap")
+	flag.Parse()
+
+	if *from != models.ReindexSourcePostgres && *from != models.ReindexSourceIndex {
+		fmt.Fprintf(os.Stderr, "invalid -from %q: must be %s or %s\n", *from, models.ReindexSourcePostgres, models.ReindexSourceIndex)
+		os.Exit(2)
+	}
+	cfg.ElasticSearch.ReindexGracePeriod = *grace
+
+	// Setup structured logging
+	setupLogger(cfg)
+
+	// Stop on SIGINT/SIGTERM; an interrupted copy from PostgreSQL resumes
+	// from its checkpoint on the next run
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize Redis connection (checkpoints and the reindex lock)
+	redisRepo, err := redis.NewRepository(ctx, cfg.Redis)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to Redis")
+	}
+	defer redisRepo.Close()
+
+	if *statusOnly {
+		status, err := redisRepo.GetReindexStatus(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to read reindex status")
+		}
+		printStatus(status)
+		return
+	}
+
+	log.Info().
+		Str("version", Version).
+		Str("build_time", BuildTime).
+		Str("from", *from).
+		Dur("grace_period", *grace).
+		Msg("Starting pools reindex")
+
+	// Initialize PostgreSQL connection
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to PostgreSQL")
+	}
+	defer pgRepo.Close()
+
+	// Initialize ElasticSearch connection
+	esRepo, err := elasticsearch.NewRepository(cfg.ElasticSearch)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to ElasticSearch")
+	}
+
+	service := reindex.NewService(cfg.ElasticSearch, esRepo, pgRepo, redisRepo)
+
+	var status *models.ReindexStatus
+	if *from == models.ReindexSourceIndex {
+		status, err = service.RunFromIndex(ctx)
+	} else {
+		status, err = service.Run(ctx)
+	}
+	if status != nil {
+		printStatus(status)
+	}
+
+	switch {
+	case errors.Is(err, reindex.ErrRunning):
+		log.Error().Msg("Another reindex is running; check its progress with -status")
+		os.Exit(1)
+	case err != nil:
+		log.Error().Err(err).Msg("Pools reindex failed")
+		os.Exit(1)
+	}
+}
+
+// printStatus writes the reindex status to stdout as JSON
+func printStatus(status *models.ReindexStatus) {
+	if status == nil {
+		fmt.Println("No reindex has run")
+		return
+	}
+
+	out, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode reindex status")
+		return
+	}
+	fmt.Println(string(out))
+}
+
+// setupLogger configures the zerolog logger based on environment
+func setupLogger(cfg *config.Config) {
+	level, err := zerolog.ParseLevel(cfg.App.LogLevel)
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(level)
+
+	// Logs go to stderr so stdout carries only the status
+	if cfg.IsDevelopment() {
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out:        os.Stderr,
+			TimeFormat: time.RFC3339,
+		})
+	} else {
+		zerolog.TimeFieldFormat = time.RFC3339Nano
+	}
+}
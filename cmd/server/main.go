@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,10 +25,20 @@ import (
 	"github.com/maxjove/defi-yield-aggregator/internal/api/handlers"
 	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
 	ws "github.com/maxjove/defi-yield-aggregator/internal/api/websocket"
+	"github.com/maxjove/defi-yield-aggregator/internal/cache"
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/coingecko"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/rewards"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
+	"github.com/maxjove/defi-yield-aggregator/internal/worker"
 )
 
 // Build information - set via ldflags during build
@@ -73,6 +85,14 @@ func main() {
 	defer redisRepo.Close()
 	log.Info().Msg("Connected to Redis")
 
+	// API responses are cached in Redis unless CACHE_BACKEND picks an
+	// in-process cache or none; the rest of the server still uses Redis
+	responseCache, err := cache.New(cfg.Cache, redisRepo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize response cache")
+	}
+	log.Info().Str("backend", cfg.Cache.Backend).Msg("Response cache ready")
+
 	// Initialize ElasticSearch connection
 	esRepo, err := elasticsearch.NewRepository(cfg.ElasticSearch)
 	if err != nil {
@@ -80,50 +100,147 @@ func main() {
 	}
 	log.Info().Msg("Connected to ElasticSearch")
 
-	// Create HTTP handler with dependencies
-	h := handlers.NewHandler(cfg, pgRepo, redisRepo, esRepo)
+	// Initialize services
+	analyticsService := analytics.NewService(cfg.Scoring)
+	ingestionService := ingestion.NewService(cfg.Ingestion, pgRepo, redisRepo, esRepo, analyticsService, nil)
+
+	// Apply chain rating and gas cost overrides; SIGHUP reloads them along
+	// with the scoring weights
+	reloader := worker.NewReloader(analyticsService, nil, pgRepo)
+	reloader.LoadChainOverrides(ctx, cfg)
+	go reloader.Watch(ctx)
+
+	// Raw snapshots are written by the worker; the server only reads them
+	var snapshotService *snapshot.Service
+	if cfg.Snapshot.Enabled {
+		store, err := snapshot.NewStore(cfg.Snapshot, pgRepo)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize snapshot store")
+		}
+		snapshotService = snapshot.NewService(cfg.Snapshot, store)
+	}
+
+	// With SERVER_PREFORK this runs in the parent process and again in each
+	// child it forks. The children serve the REST API on SERVER_PORT. Hub
+	// state can't be split across processes, so only the parent has the
+	// WebSocket hub; it serves the realtime routes on SERVER_REALTIME_PORT
+	// and no REST requests.
+	preforkChild := cfg.Server.Prefork && fiber.IsChild()
 
 	// Create WebSocket hub and handler
-	wsHub := ws.NewHub(cfg.WebSocket)
-	wsHandler := ws.NewHandler(wsHub, redisRepo)
+	var wsHub *ws.Hub
+	var wsHandler *ws.Handler
+	var hubStats metrics.HubStats
+	if !preforkChild {
+		wsHub = ws.NewHub(cfg.WebSocket)
+		wsHandler = ws.NewHandler(wsHub, redisRepo)
+		hubStats = wsHub
+	}
 
-	// Start WebSocket hub
-	go wsHub.Run()
-	log.Info().Msg("WebSocket hub started")
+	// Pools index rebuilds triggered from the admin API
+	reindexService := reindex.NewService(cfg.ElasticSearch, esRepo, pgRepo, redisRepo)
 
-	// Start Redis subscriber for real-time updates
-	go wsHandler.StartRedisSubscriber(ctx)
+	// Detection dry runs from the admin API; the worker does the live detection
+	opportunityService := opportunity.NewService(cfg.Worker, pgRepo, redisRepo, analyticsService)
 
-	// Create Fiber app with configuration
-	app := fiber.New(fiber.Config{
-		AppName:               cfg.App.Name,
-		ReadTimeout:           cfg.Server.ReadTimeout,
-		WriteTimeout:          cfg.Server.WriteTimeout,
-		IdleTimeout:           cfg.Server.IdleTimeout,
-		DisableStartupMessage: cfg.IsProduction(),
-		ErrorHandler:          handlers.ErrorHandler,
-	})
+	// Reward token detail for pools; prices come from the worker's cache
+	rewardsService := rewards.NewService(coingecko.NewClient(cfg.CoinGecko), redisRepo)
+
+	// Gauges for GET /metrics
+	metricsCollector := metrics.NewCollector(cfg.Metrics, pgRepo, redisRepo, hubStats)
 
-	// Setup middleware
-	setupMiddleware(app, cfg)
+	// Create HTTP handler with dependencies. Children of a preforked server
+	// have no hub, and don't serve the routes reading it.
+	h := handlers.NewHandler(cfg, pgRepo, redisRepo, responseCache, esRepo, ingestionService, opportunityService, snapshotService, reindexService, rewardsService, metricsCollector, wsHub)
 
-	// Create GraphQL resolver
-	gqlResolver := graphql.NewResolver(pgRepo, redisRepo, esRepo)
+	// Counters kept in memory would cover only the process answering a
+	// scrape, so the processes of a preforked server publish theirs to Redis
+	// and scrapes report the sum
+	if cfg.Server.Prefork {
+		shareProcessMetrics(ctx, metricsCollector, redisRepo, preforkChild)
+	}
 
-	// Setup routes
-	setupRoutes(app, h, wsHandler, gqlResolver)
+	if wsHub != nil {
+		// Start WebSocket hub
+		go wsHub.Run()
+		log.Info().Msg("WebSocket hub started")
+
+		// Start Redis subscriber for real-time updates
+		go wsHandler.StartRedisSubscriber(ctx)
+	}
+
+	// Each process of a preforked server would otherwise allow the full
+	// rate limit, so they count requests in Redis, or in memory while
+	// Redis is unavailable
+	var limiterStorage fiber.Storage
+	if cfg.Server.Prefork {
+		limiterStorage = redisRepo.LimiterStorage()
+	}
 
-	// Start server in goroutine
 	serverAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
-	go func() {
-		if err := app.Listen(serverAddr); err != nil {
+
+	var app *fiber.App
+	var children *preforkChildren
+	if cfg.Server.Prefork && !preforkChild {
+		// The prefork parent forks a child per core to serve the REST API,
+		// and passes reloads on to them
+		children, err = startPreforkChildren(runtime.GOMAXPROCS(0))
+		if err != nil {
 			log.Fatal().Err(err).Msg("Server failed to start")
 		}
-	}()
+		go children.forward(ctx, syscall.SIGHUP)
 
-	log.Info().
-		Str("address", serverAddr).
-		Msg("Server started successfully")
+		log.Info().
+			Str("address", serverAddr).
+			Int("children", len(children.procs)).
+			Msg("Prefork children started")
+	} else {
+		// Create Fiber app with configuration
+		app = newApp(cfg, cfg.Server.Prefork)
+
+		// Setup middleware
+		setupMiddleware(app, cfg, limiterStorage)
+
+		// Create GraphQL resolver
+		gqlResolver := graphql.NewResolver(cfg.GraphQL, cfg.Distribution, cfg.Listing, cfg.Admin, pgRepo, redisRepo, esRepo, rewardsService)
+
+		// Setup routes; realtime routes go on their own listener if it is set
+		var appWSHandler *ws.Handler
+		if !cfg.Server.SplitRealtime() {
+			appWSHandler = wsHandler
+		}
+		setupRoutes(app, cfg, h, appWSHandler, gqlResolver)
+
+		// Start server in goroutine
+		go func() {
+			if err := app.Listen(serverAddr); err != nil {
+				log.Fatal().Err(err).Msg("Server failed to start")
+			}
+		}()
+
+		log.Info().
+			Str("address", serverAddr).
+			Msg("Server started successfully")
+	}
+
+	// Start the realtime listener, never preforked
+	var realtime *fiber.App
+	if cfg.Server.SplitRealtime() && wsHandler != nil {
+		realtime = newApp(cfg, false)
+		setupMiddleware(realtime, cfg, limiterStorage)
+		setupRealtimeRoutes(realtime, h, wsHandler)
+
+		realtimeAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.RealtimePort)
+		go func() {
+			if err := realtime.Listen(realtimeAddr); err != nil {
+				log.Fatal().Err(err).Msg("Realtime server failed to start")
+			}
+		}()
+
+		log.Info().
+			Str("address", realtimeAddr).
+			Msg("Realtime server started successfully")
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -135,14 +252,57 @@ func main() {
 	// Cancel context to stop background goroutines
 	cancel()
 
+	// Children finish their requests while the parent closes its clients
+	if children != nil {
+		children.stop()
+	}
+
+	// Send WebSocket clients a going-away close frame before connections drop
+	if wsHub != nil {
+		wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := wsHub.Shutdown(wsCtx); err != nil {
+			log.Warn().Err(err).Msg("Timed out closing WebSocket clients")
+		}
+		wsCancel()
+	}
+
 	// Give outstanding requests 10 seconds to complete
-	if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
-		log.Error().Err(err).Msg("Error during server shutdown")
+	if realtime != nil {
+		if err := realtime.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Error().Err(err).Msg("Error during realtime server shutdown")
+		}
+	}
+	if app != nil {
+		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Error().Err(err).Msg("Error during server shutdown")
+		}
+	}
+	if children != nil {
+		children.wait(10 * time.Second)
 	}
 
 	log.Info().Msg("Server stopped")
 }
 
+// newApp creates a Fiber app with the server configuration
+func newApp(cfg *config.Config, prefork bool) *fiber.App {
+	return fiber.New(fiber.Config{
+		AppName:               cfg.App.Name,
+		Prefork:               prefork,
+		ReadTimeout:           cfg.Server.ReadTimeout,
+		WriteTimeout:          cfg.Server.WriteTimeout,
+		IdleTimeout:           cfg.Server.IdleTimeout,
+		BodyLimit:             cfg.Server.BodyLimit,
+		DisableStartupMessage: cfg.IsProduction(),
+		ErrorHandler:          handlers.ErrorHandler,
+
+		// Bodies past BodyLimit are streamed, for middleware.BodyLimit to
+		// read up to the limit of the route: admin imports take more
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+}
+
 // setupLogger configures the zerolog logger based on environment
 func setupLogger(cfg *config.Config) {
 	// Set log level
@@ -165,8 +325,9 @@ func setupLogger(cfg *config.Config) {
 	}
 }
 
-// setupMiddleware configures all middleware for the Fiber app
-func setupMiddleware(app *fiber.App, cfg *config.Config) {
+// setupMiddleware configures all middleware for the Fiber app. Rate limiter
+// counters are kept in limiterStorage, or in memory if it is nil.
+func setupMiddleware(app *fiber.App, cfg *config.Config, limiterStorage fiber.Storage) {
 	// Recover from panics
 	app.Use(recover.New(recover.Config{
 		EnableStackTrace: cfg.IsDevelopment(),
@@ -182,31 +343,57 @@ func setupMiddleware(app *fiber.App, cfg *config.Config) {
 		TimeZone:   "UTC",
 	}))
 
+	// Request body limit, larger for admin routes; WebSocket upgrades carry
+	// no body. The server streams bodies past cfg.Server.BodyLimit, so they
+	// are read here, before anything else may answer and leave the rest of
+	// one unread on the connection.
+	bodyLimit := middleware.BodyLimit(cfg.Server.BodyLimit)
+	adminBodyLimit := middleware.BodyLimit(cfg.Server.AdminBodyLimit)
+	app.Use(func(c *fiber.Ctx) error {
+		switch {
+		case websocket.IsWebSocketUpgrade(c):
+			return c.Next()
+		case strings.HasPrefix(c.Path(), adminPrefix):
+			return adminBodyLimit(c)
+		}
+		return bodyLimit(c)
+	})
+
 	// CORS
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     stringSliceToString(cfg.CORS.AllowedOrigins),
 		AllowMethods:     stringSliceToString(cfg.CORS.AllowedMethods),
 		AllowHeaders:     stringSliceToString(cfg.CORS.AllowedHeaders),
+		ExposeHeaders:    handlers.HeaderCache + "," + handlers.HeaderCacheBackend,
 		AllowCredentials: true,
 		MaxAge:           cfg.CORS.MaxAge,
 	}))
 
 	// Rate limiting (skip for WebSocket upgrades)
+	rateLimiter := middleware.RateLimiter(cfg.RateLimit, limiterStorage)
 	app.Use(func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
 		}
-		return middleware.RateLimiter(cfg.RateLimit)(c)
+		return rateLimiter(c)
 	})
 }
 
-// setupRoutes configures all API routes
-func setupRoutes(app *fiber.App, h *handlers.Handler, wsHandler *ws.Handler, gqlResolver *graphql.Resolver) {
+// adminPrefix is the path of the admin API
+const adminPrefix = "/api/v1/admin"
+
+// setupRoutes configures all API routes. Without a WebSocket handler the
+// realtime routes are left out, to be served by setupRealtimeRoutes on
+// another listener.
+func setupRoutes(app *fiber.App, cfg *config.Config, h *handlers.Handler, wsHandler *ws.Handler, gqlResolver *graphql.Resolver) {
 	// Health check (no versioning)
 	app.Get("/health", h.HealthCheck)
 
-	// API v1 routes
-	v1 := app.Group("/api/v1")
+	// Prometheus metrics (no versioning)
+	app.Get("/metrics", h.GetPrometheusMetrics)
+
+	// API v1 routes, flagged while the data looks suspect
+	v1 := app.Group("/api/v1", h.MarkSuspectData)
 
 	// Health check (versioned)
 	v1.Get("/health", h.HealthCheck)
@@ -214,23 +401,71 @@ func setupRoutes(app *fiber.App, h *handlers.Handler, wsHandler *ws.Handler, gql
 	// Pool routes
 	pools := v1.Group("/pools")
 	pools.Get("/", h.ListPools)
+	pools.Get("/distribution", h.GetPoolDistribution) // Must be registered before /:id
+	if wsHandler != nil {
+		pools.Get("/updates", h.GetPoolUpdates) // Long-poll fallback for /ws/pools
+	}
 	pools.Get("/:id", h.GetPool)
 	pools.Get("/:id/history", h.GetPoolHistory)
+	pools.Get("/:id/risk-history", h.GetPoolRiskHistory)
+	pools.Get("/:id/opportunities", h.GetPoolOpportunities)
 
 	// Opportunity routes
 	opportunities := v1.Group("/opportunities")
 	opportunities.Get("/", h.ListOpportunities)
 	opportunities.Get("/trending", h.GetTrendingPools)
+	opportunities.Get("/accuracy", h.GetOpportunityAccuracy)
+	if wsHandler != nil {
+		opportunities.Get("/stream", h.StreamOpportunities) // Server-sent events alternative to /ws/opportunities
+	}
 
 	// Aggregated data routes
 	v1.Get("/chains", h.ListChains)
+	v1.Get("/chains/:chain/history", h.GetChainHistory)
 	v1.Get("/protocols", h.ListProtocols)
+	v1.Get("/protocols/:name/history", h.GetProtocolHistory)
+	v1.Get("/tags", h.ListTags)
 	v1.Get("/stats", h.GetStats)
+	v1.Get("/indices", h.ListIndices)
+	v1.Get("/indices/:name/history", h.GetIndexHistory)
+
+	// Admin routes (require X-Admin-Key)
+	admin := v1.Group("/admin", middleware.AdminAuth(cfg.Admin))
+	admin.Post("/pools/import", h.ImportPools)
+	admin.Put("/pools/:id/curation", h.SetPoolCuration)
+	admin.Delete("/pools/:id/curation", h.DeletePoolCuration)
+	admin.Get("/data-quality", h.GetDataQuality)
+	admin.Post("/opportunities/dry-run", h.DryRunOpportunities)
+	admin.Post("/reindex", h.StartReindex)
+	admin.Get("/reindex", h.GetReindexStatus)
+	admin.Get("/snapshots", h.ListSnapshots)
+	admin.Get("/snapshots/:ts", h.GetSnapshot)
+	admin.Post("/indices", h.CreateIndex)
+	admin.Put("/indices/:name", h.UpdateIndex)
+	admin.Delete("/indices/:name", h.DeleteIndex)
 
 	// GraphQL routes
 	app.Post("/graphql", gqlResolver.Handle)
-	app.Get("/graphql", graphql.Playground) // GraphQL Playground UI
+	app.Get("/graphql", gqlResolver.HandleGet) // Queries via query string, otherwise the Playground UI
+
+	if wsHandler != nil {
+		setupWebSocketRoutes(app, wsHandler)
+	}
+}
+
+// setupRealtimeRoutes configures the routes reading the WebSocket hub on a
+// listener of their own: WebSockets, the long poll of pool updates and the
+// opportunity event stream
+func setupRealtimeRoutes(app *fiber.App, h *handlers.Handler, wsHandler *ws.Handler) {
+	app.Get("/health", h.HealthCheck)
+	app.Get("/api/v1/pools/updates", h.GetPoolUpdates)
+	app.Get("/api/v1/opportunities/stream", h.StreamOpportunities)
+
+	setupWebSocketRoutes(app, wsHandler)
+}
 
+// setupWebSocketRoutes configures the WebSocket routes and their stats
+func setupWebSocketRoutes(app *fiber.App, wsHandler *ws.Handler) {
 	// WebSocket routes
 	wsGroup := app.Group("/ws")
 
@@ -250,7 +485,7 @@ func setupRoutes(app *fiber.App, h *handlers.Handler, wsHandler *ws.Handler, gql
 	}))
 
 	// WebSocket stats endpoint (for monitoring)
-	v1.Get("/ws/stats", func(c *fiber.Ctx) error {
+	app.Get("/api/v1/ws/stats", func(c *fiber.Ctx) error {
 		return c.JSON(wsHandler.GetHubStats())
 	})
 }
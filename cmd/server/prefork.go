@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
+)
+
+// processMetricsInterval is how often each process of a preforked server
+// publishes its in-memory metrics
+const processMetricsInterval = 10 * time.Second
+
+// shareProcessMetrics has the collector sum in-memory metrics across the
+// processes of this preforked server and starts publishing this process's.
+// The processes are grouped by host and parent pid, so replicas sharing
+// Redis each report their own.
+func shareProcessMetrics(ctx context.Context, collector *metrics.Collector, store metrics.ProcessStore, child bool) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	parent := os.Getpid()
+	if child {
+		parent = os.Getppid()
+	}
+
+	group := fmt.Sprintf("%s:%d", hostname, parent)
+	collector.ShareProcesses(store, group, strconv.Itoa(os.Getpid()), processMetricsInterval)
+	go collector.RunPublisher(ctx)
+}
+
+// preforkChildEnv marks a process as a prefork child, as Fiber does; a
+// child's app listens in Fiber's prefork child mode
+const preforkChildEnv = "FIBER_PREFORK_CHILD=1"
+
+// preforkChildren are the REST API processes of a prefork parent. Fiber's
+// own prefork parent kills every child as soon as the first one exits,
+// cutting the others' graceful shutdown short, so the parent forks and
+// stops them itself.
+type preforkChildren struct {
+	procs    []*os.Process
+	done     chan struct{} // Closed once every child exited
+	stopping atomic.Bool
+}
+
+// startPreforkChildren forks n copies of this process as prefork children.
+// A child exiting before the parent stops them is fatal, as a failing
+// listener is.
+func startPreforkChildren(n int) (*preforkChildren, error) {
+	p := &preforkChildren{done: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		cmd := exec.Command(os.Args[0], os.Args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), preforkChildEnv)
+		if err := cmd.Start(); err != nil {
+			p.signal(os.Kill)
+			return nil, fmt.Errorf("failed to start prefork child: %w", err)
+		}
+		p.procs = append(p.procs, cmd.Process)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cmd.Wait()
+			if !p.stopping.Load() {
+				log.Fatal().Err(err).Int("pid", cmd.Process.Pid).Msg("Prefork child exited")
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// signal sends sig to every child
+func (p *preforkChildren) signal(sig os.Signal) {
+	for _, proc := range p.procs {
+		if err := proc.Signal(sig); err != nil {
+			log.Debug().Err(err).Int("pid", proc.Pid).Msg("Failed to signal prefork child")
+		}
+	}
+}
+
+// forward passes sig on to the children whenever the parent receives it,
+// until ctx is done
+func (p *preforkChildren) forward(ctx context.Context, sig os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			p.signal(sig)
+		}
+	}
+}
+
+// stop asks the children to shut down gracefully
+func (p *preforkChildren) stop() {
+	p.stopping.Store(true)
+	p.signal(syscall.SIGTERM)
+}
+
+// wait waits up to timeout for the children to exit after stop, then
+// kills any left
+func (p *preforkChildren) wait(timeout time.Duration) {
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		log.Warn().Msg("Prefork children still running at shutdown, killing them")
+		p.signal(os.Kill)
+	}
+}
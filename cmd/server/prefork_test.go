@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// benchAddrEnv passes the listen address to the prefork children of
+// BenchmarkPoolsPrefork, which re-run the test binary
+const benchAddrEnv = "PREFORK_BENCH_ADDR"
+
+func TestMain(m *testing.M) {
+	if addr := os.Getenv(benchAddrEnv); addr != "" && fiber.IsChild() {
+		if err := benchApp(true).Listen(addr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// benchApp serves a page of 100 pools at /api/v1/pools, encoding it for
+// every request as a cache hit of the real endpoint does
+func benchApp(prefork bool) *fiber.App {
+	now := time.Now().UTC()
+	page := models.PoolListResponse{Total: 2500, Limit: 100, HasMore: true}
+	for i := 0; i < 100; i++ {
+		page.Data = append(page.Data, models.Pool{
+			ID:               fmt.Sprintf("pool-%d", i),
+			Chain:            "ethereum",
+			Protocol:         "aave-v3",
+			Symbol:           "USDC-WETH",
+			TVL:              decimal.NewFromFloat(12_345_678.9),
+			APY:              decimal.NewFromFloat(5.4321),
+			APYBase:          decimal.NewFromFloat(3.21),
+			APYReward:        decimal.NewFromFloat(2.2221),
+			RewardTokens:     []string{"0x7fc66500c84a76ad7e9c93437bfc5ac33e2ddae9"},
+			UnderlyingTokens: []string{"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"},
+			Score:            decimal.NewFromFloat(78.5),
+			Tags:             []string{models.TagLending},
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+	}
+
+	app := fiber.New(fiber.Config{Prefork: prefork, DisableStartupMessage: true})
+	app.Get("/api/v1/pools", func(c *fiber.Ctx) error {
+		return c.JSON(page)
+	})
+	return app
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(b *testing.B) string {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// waitListening waits for a server to accept connections at addr
+func waitListening(b *testing.B, addr string) {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if conn, err := net.Dial("tcp4", addr); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	b.Fatalf("Nothing listening on %s", addr)
+}
+
+// drive requests the pools page from addr from parallel clients
+func drive(b *testing.B, addr string) {
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 256}}
+	url := "http://" + addr + "/api/v1/pools"
+
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := client.Get(url)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+}
+
+// BenchmarkPoolsPrefork compares the throughput of a pools page served by
+// one process with that of a preforked server, a child per core. The load
+// comes from this process, so the single server shares its cores with the
+// clients. Run with:
+//
+//	go test ./cmd/server -run '^$' -bench PoolsPrefork
+func BenchmarkPoolsPrefork(b *testing.B) {
+	single := freeAddr(b)
+	app := benchApp(false)
+	go app.Listen(single)
+	defer app.Shutdown()
+
+	preforked := freeAddr(b)
+	b.Setenv(benchAddrEnv, preforked)
+	children, err := startPreforkChildren(runtime.GOMAXPROCS(0))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		children.stop()
+		children.wait(5 * time.Second)
+	}()
+
+	waitListening(b, single)
+	waitListening(b, preforked)
+
+	b.Run("single", func(b *testing.B) { drive(b, single) })
+	b.Run("prefork", func(b *testing.B) { drive(b, preforked) })
+}
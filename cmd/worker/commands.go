@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/defillama"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
+	"github.com/maxjove/defi-yield-aggregator/internal/worker"
+)
+
+// Worker commands
+const (
+	cmdRun      = "run"
+	cmdFetch    = "fetch"
+	cmdRescore  = "rescore"
+	cmdBackfill = "backfill"
+	cmdReindex  = "reindex"
+	cmdPrune    = "prune"
+)
+
+// minPruneAge guards against deleting recent history with a mistyped unit
+const minPruneAge = 24 * time.Hour
+
+// errUsage reports invalid arguments; the details were already printed
+var errUsage = errors.New("invalid usage")
+
+// command is a parsed worker invocation
+type command struct {
+	name      string
+	once      bool          // fetch: run once instead of on the fetch schedule
+	poolID    string        // backfill: pool to backfill
+	from      string        // reindex: where to copy documents from
+	olderThan time.Duration // prune: age of the history to delete
+}
+
+// parseCommand parses the worker's arguments. Without arguments the worker
+// runs the scheduler. Usage and errors are written to output.
+func parseCommand(args []string, output io.Writer) (command, error) {
+	if len(args) == 0 {
+		return command{name: cmdRun}, nil
+	}
+
+	cmd := command{name: args[0]}
+	fs := flag.NewFlagSet("worker "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	switch cmd.name {
+	case cmdRun, cmdRescore:
+	case cmdFetch:
+		fs.BoolVar(&cmd.once, "once", false, "fetch once and exit instead of fetching on the schedule")
+	case cmdBackfill:
+		fs.StringVar(&cmd.poolID, "pool", "", "ID of the pool whose history to backfill (required)")
+	case cmdReindex:
+		fs.StringVar(&cmd.from, "from", models.ReindexSourcePostgres, "where to copy documents from: postgres, or index for the index behind the alias")
+	case cmdPrune:
+		fs.Func("older-than", "delete history older than this, in days (30d) or as a duration (720h) (required)", func(s string) error {
+			age, err := parseAge(s)
+			if err != nil {
+				return err
+			}
+			cmd.olderThan = age
+			return nil
+		})
+	case "help", "-h", "-help", "--help":
+		printUsage(output)
+		return command{}, flag.ErrHelp
+	default:
+		fmt.Fprintf(output, "unknown command %q\n\n", cmd.name)
+		printUsage(output)
+		return command{}, errUsage
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return command{}, err
+	}
+	if fs.NArg() > 0 {
+		return command{}, usageError(fs, "unexpected argument %q", fs.Arg(0))
+	}
+
+	switch cmd.name {
+	case cmdBackfill:
+		if cmd.poolID == "" {
+			return command{}, usageError(fs, "-pool is required")
+		}
+	case cmdReindex:
+		if cmd.from != models.ReindexSourcePostgres && cmd.from != models.ReindexSourceIndex {
+			return command{}, usageError(fs, "invalid -from %q: must be %s or %s", cmd.from, models.ReindexSourcePostgres, models.ReindexSourceIndex)
+		}
+	case cmdPrune:
+		if cmd.olderThan == 0 {
+			return command{}, usageError(fs, "-older-than is required")
+		}
+	}
+
+	return cmd, nil
+}
+
+// usageError prints an argument error with the command's usage
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// parseAge parses a history age given in days ("30d") or as a Go duration
+func parseAge(s string) (time.Duration, error) {
+	var age time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+
+	if age < minPruneAge {
+		return 0, fmt.Errorf("must be at least %s", minPruneAge)
+	}
+	return age, nil
+}
+
+// printUsage lists the worker's commands
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage: worker [command] [flags]
+
+Commands:
+  run                        run the scheduler (default)
+  fetch [-once]              fetch pools from DeFiLlama
+  rescore                    recompute pool scores with the current weights
+  backfill -pool <id>        load a pool's full history from DeFiLlama
+  reindex [-from=index]      rebuild the ElasticSearch pools index
+  prune -older-than <age>    delete pool history older than age, e.g. 30d
+
+Run "worker <command> -h" for a command's flags. Commands other than run
+print a JSON summary to stdout and exit non-zero on failure.
+`)
+}
+
+// taskSummary is printed to stdout when a command finishes
+type taskSummary struct {
+	Command  string      `json:"command"`
+	OK       bool        `json:"ok"`
+	Error    string      `json:"error,omitempty"`
+	Duration string      `json:"duration"`
+	Result   interface{} `json:"result,omitempty"`
+}
+
+// writeSummary prints a command's outcome as a line of JSON
+func writeSummary(w io.Writer, name string, result interface{}, err error, duration time.Duration) {
+	summary := taskSummary{
+		Command:  name,
+		OK:       err == nil,
+		Duration: duration.Round(time.Millisecond).String(),
+		Result:   result,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		log.Error().Err(err).Msg("Failed to encode task summary")
+	}
+}
+
+// runTask runs a one-off command until it completes or SIGINT/SIGTERM is
+// received, prints its summary and returns the process exit code
+func runTask(cfg *config.Config, cmd command) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	startTime := time.Now()
+	log.Info().Str("command", cmd.name).Str("version", Version).Msg("Starting worker task")
+
+	var result interface{}
+	var err error
+	switch cmd.name {
+	case cmdFetch:
+		result, err = runFetch(ctx, cfg, cmd.once)
+	case cmdRescore:
+		result, err = runRescore(ctx, cfg)
+	case cmdBackfill:
+		result, err = runBackfill(ctx, cfg, cmd.poolID)
+	case cmdReindex:
+		result, err = runReindex(ctx, cfg, cmd.from)
+	case cmdPrune:
+		result, err = runPrune(ctx, cfg, cmd.olderThan)
+	}
+	if cmd.name == cmdFetch && !cmd.once && err == nil {
+		// Each scheduled fetch already printed its summary
+		return 0
+	}
+
+	writeSummary(os.Stdout, cmd.name, result, err, time.Since(startTime))
+	if err != nil {
+		log.Error().Err(err).Str("command", cmd.name).Msg("Worker task failed")
+		return 1
+	}
+	return 0
+}
+
+// runFetch fetches pools once, or on the fetch schedule until interrupted
+func runFetch(ctx context.Context, cfg *config.Config, once bool) (interface{}, error) {
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pgRepo.Close()
+
+	redisRepo, err := redis.NewRepository(ctx, cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer redisRepo.Close()
+
+	esRepo, err := elasticsearch.NewRepository(cfg.ElasticSearch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ElasticSearch: %w", err)
+	}
+
+	analyticsService := analytics.NewService(cfg.Scoring)
+	worker.NewReloader(analyticsService, nil, pgRepo).LoadChainOverrides(ctx, cfg)
+
+	var snapshotService *snapshot.Service
+	if cfg.Snapshot.Enabled {
+		store, err := snapshot.NewStore(cfg.Snapshot, pgRepo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize snapshot store: %w", err)
+		}
+		snapshotService = snapshot.NewService(cfg.Snapshot, store)
+	}
+
+	fetcher := worker.NewFetcher(
+		cfg.Worker,
+		defillama.NewClient(cfg.DeFiLlama),
+		ingestion.NewService(cfg.Ingestion, pgRepo, redisRepo, esRepo, analyticsService, nil),
+		snapshotService,
+		redisRepo,
+	)
+	monitor := newMonitor(cfg.Monitor, redisRepo)
+	if once {
+		summary, err := fetcher.Run(ctx)
+		checkFetch(ctx, monitor, summary, err)
+		return summary, err
+	}
+
+	scheduler := cron.New(cron.WithSeconds())
+	_, err = scheduler.AddFunc(cfg.Schedule.DeFiLlama, func() {
+		startTime := time.Now()
+		summary, err := fetcher.Run(ctx)
+		checkFetch(ctx, monitor, summary, err)
+		writeSummary(os.Stdout, cmdFetch, summary, err, time.Since(startTime))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule fetch: %w", err)
+	}
+	scheduler.Start()
+	log.Info().Str("schedule", cfg.Schedule.DeFiLlama).Msg("Fetching pools on schedule until interrupted")
+
+	<-ctx.Done()
+	<-scheduler.Stop().Done()
+	return nil, nil
+}
+
+// runRescore recomputes every pool's score
+func runRescore(ctx context.Context, cfg *config.Config) (interface{}, error) {
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pgRepo.Close()
+
+	redisRepo, err := redis.NewRepository(ctx, cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer redisRepo.Close()
+
+	esRepo, err := elasticsearch.NewRepository(cfg.ElasticSearch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ElasticSearch: %w", err)
+	}
+
+	// Scores depend on the chain overrides as much as on the weights
+	analyticsService := analytics.NewService(cfg.Scoring)
+	worker.NewReloader(analyticsService, nil, pgRepo).LoadChainOverrides(ctx, cfg)
+
+	return worker.NewRescorer(cfg.Worker, pgRepo, esRepo, redisRepo, analyticsService).Run(ctx)
+}
+
+// runBackfill loads the full history of a pool
+func runBackfill(ctx context.Context, cfg *config.Config, poolID string) (interface{}, error) {
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pgRepo.Close()
+
+	return worker.NewBackfiller(defillama.NewClient(cfg.DeFiLlama), pgRepo).Run(ctx, poolID)
+}
+
+// runReindex rebuilds the pools index like the reindex tool
+func runReindex(ctx context.Context, cfg *config.Config, from string) (interface{}, error) {
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pgRepo.Close()
+
+	redisRepo, err := redis.NewRepository(ctx, cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer redisRepo.Close()
+
+	esRepo, err := elasticsearch.NewRepository(cfg.ElasticSearch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ElasticSearch: %w", err)
+	}
+
+	service := reindex.NewService(cfg.ElasticSearch, esRepo, pgRepo, redisRepo)
+
+	var status *models.ReindexStatus
+	if from == models.ReindexSourceIndex {
+		status, err = service.RunFromIndex(ctx)
+	} else {
+		status, err = service.Run(ctx)
+	}
+	if errors.Is(err, reindex.ErrRunning) {
+		err = errors.New("another reindex is running")
+	}
+	return status, err
+}
+
+// runPrune deletes old pool history
+func runPrune(ctx context.Context, cfg *config.Config, olderThan time.Duration) (interface{}, error) {
+	pgRepo, err := postgres.NewRepository(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pgRepo.Close()
+
+	return worker.NewPruner(pgRepo).Run(ctx, olderThan)
+}
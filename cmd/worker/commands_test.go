@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    command
+		wantErr bool
+	}{
+		{name: "no arguments runs the scheduler", args: nil, want: command{name: cmdRun}},
+		{name: "run", args: []string{"run"}, want: command{name: cmdRun}},
+		{name: "fetch", args: []string{"fetch"}, want: command{name: cmdFetch}},
+		{name: "fetch once", args: []string{"fetch", "--once"}, want: command{name: cmdFetch, once: true}},
+		{name: "rescore", args: []string{"rescore"}, want: command{name: cmdRescore}},
+		{name: "backfill", args: []string{"backfill", "--pool", "abc-123"}, want: command{name: cmdBackfill, poolID: "abc-123"}},
+		{name: "backfill without pool", args: []string{"backfill"}, wantErr: true},
+		{name: "reindex", args: []string{"reindex"}, want: command{name: cmdReindex, from: models.ReindexSourcePostgres}},
+		{name: "reindex from index", args: []string{"reindex", "-from=index"}, want: command{name: cmdReindex, from: models.ReindexSourceIndex}},
+		{name: "reindex from unknown source", args: []string{"reindex", "-from=s3"}, wantErr: true},
+		{name: "prune in days", args: []string{"prune", "--older-than", "30d"}, want: command{name: cmdPrune, olderThan: 30 * 24 * time.Hour}},
+		{name: "prune as duration", args: []string{"prune", "-older-than=36h"}, want: command{name: cmdPrune, olderThan: 36 * time.Hour}},
+		{name: "prune under a day", args: []string{"prune", "-older-than=30m"}, wantErr: true},
+		{name: "prune with invalid age", args: []string{"prune", "-older-than=xd"}, wantErr: true},
+		{name: "prune without age", args: []string{"prune"}, wantErr: true},
+		{name: "unknown command", args: []string{"migrate"}, wantErr: true},
+		{name: "unknown flag", args: []string{"rescore", "-all"}, wantErr: true},
+		{name: "stray argument", args: []string{"fetch", "-once", "now"}, wantErr: true},
+		{name: "flag of another command", args: []string{"fetch", "-pool", "abc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommand(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCommand_Help(t *testing.T) {
+	for _, args := range [][]string{{"help"}, {"-h"}, {"prune", "-h"}} {
+		if _, err := parseCommand(args, io.Discard); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Expected flag.ErrHelp for %v, got %v", args, err)
+		}
+	}
+}
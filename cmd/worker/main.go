@@ -1,11 +1,26 @@
 // Package main is the entry point for the DeFi Yield Aggregator background worker.
-// It handles scheduled data fetching from external APIs and opportunity detection.
+// It handles scheduled data fetching from external APIs and opportunity detection,
+// and runs the same tasks once on demand for operators.
+//
+// Usage:
+//
+//	worker                            # run the scheduler (same as worker run)
+//	worker fetch -once                # fetch pools from DeFiLlama once
+//	worker rescore                    # recompute pool scores
+//	worker backfill -pool <id>        # load a pool's full history
+//	worker reindex [-from=index]      # rebuild the ElasticSearch pools index
+//	worker prune -older-than 30d      # delete old pool history
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io"
+	"math/rand/v2"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,14 +29,19 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
-	"github.com/maxjove/defi-yield-aggregator/internal/models"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
 	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
 	"github.com/maxjove/defi-yield-aggregator/internal/services/coingecko"
 	"github.com/maxjove/defi-yield-aggregator/internal/services/defillama"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/indices"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
 	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
+	"github.com/maxjove/defi-yield-aggregator/internal/worker"
+	"github.com/maxjove/defi-yield-aggregator/pkg/eventlog"
 )
 
 // Build information - set via ldflags during build
@@ -32,15 +52,33 @@ var (
 )
 
 func main() {
+	cmd, err := parseCommand(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
 
+	if cmd.name != cmdRun {
+		// Logs go to stderr so stdout carries only the summary
+		setupLogger(cfg, os.Stderr)
+		os.Exit(runTask(cfg, cmd))
+	}
+
 	// Setup structured logging
-	setupLogger(cfg)
+	setupLogger(cfg, os.Stdout)
+	runScheduler(cfg)
+}
 
+// runScheduler runs the worker's jobs on their schedules until SIGINT/SIGTERM
+func runScheduler(cfg *config.Config) {
 	log.Info().
 		Str("version", Version).
 		Str("build_time", BuildTime).
@@ -78,55 +116,116 @@ func main() {
 		log.Warn().Err(err).Msg("Failed to create ElasticSearch indices")
 	}
 
+	// Rebuild the pools index in the background if its mapping is out of
+	// date; searches keep using the current index until the alias swap
+	reindexService := reindex.NewService(cfg.ElasticSearch, esRepo, pgRepo, redisRepo)
+	go func() {
+		if err := reindexService.EnsureCurrent(ctx); err != nil && !errors.Is(err, reindex.ErrRunning) {
+			log.Error().Err(err).Msg("Failed to reindex pools")
+		}
+	}()
+
 	// Initialize API clients
 	defiLlamaClient := defillama.NewClient(cfg.DeFiLlama)
 	coinGeckoClient := coingecko.NewClient(cfg.CoinGecko)
+	priceTokens := coingecko.PriceTokens(cfg.Worker.ChainFilter())
+	if chains := cfg.Worker.ChainFilter(); chains.Active() {
+		log.Info().Str("chains", chains.Note()).Msg("Ingesting a subset of chains")
+	}
 
 	// Initialize services
 	analyticsService := analytics.NewService(cfg.Scoring)
+	// Published events are optionally also kept in the event log for offline
+	// analysis
+	eventLog := openEventLog(ctx, cfg.EventLog)
+
 	opportunityService := opportunity.NewService(cfg.Worker, pgRepo, redisRepo, analyticsService)
+	ingestionService := ingestion.NewService(cfg.Ingestion, pgRepo, redisRepo, esRepo, analyticsService, eventLog)
+	indexService := indices.NewService(cfg.Worker, pgRepo, pgRepo)
+
+	// Apply chain rating and gas cost overrides; SIGHUP reloads them along
+	// with the scoring weights and detection thresholds
+	reloader := worker.NewReloader(analyticsService, opportunityService, pgRepo)
+	reloader.LoadChainOverrides(ctx, cfg)
+	go reloader.Watch(ctx)
+
+	// Raw snapshot archiving is optional since it is storage-heavy
+	var snapshotService *snapshot.Service
+	if cfg.Snapshot.Enabled {
+		store, err := snapshot.NewStore(cfg.Snapshot, pgRepo)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize snapshot store")
+		}
+		snapshotService = snapshot.NewService(cfg.Snapshot, store)
+		log.Info().Str("backend", cfg.Snapshot.Backend).Msg("Raw snapshot archiving enabled")
+	}
+
+	// The jobs run the same tasks as the worker's subcommands
+	fetcher := worker.NewFetcher(cfg.Worker, defiLlamaClient, ingestionService, snapshotService, redisRepo)
+	priceFetcher := worker.NewPriceFetcher(coinGeckoClient, priceTokens, redisRepo)
+	detector := worker.NewDetector(opportunityService, pgRepo, redisRepo, eventLog)
+	monitor := newMonitor(cfg.Monitor, redisRepo)
+
+	fetchPrices := func() { runJob(ctx, "CoinGecko fetch", priceFetcher.Run) }
+	detectOpportunities := func() { runJob(ctx, "Opportunity detection", detector.Run) }
+
+	// Optionally detect on fresh data: each successful fetch (re)starts the
+	// debounce, and detection runs once fetches have settled
+	var detectAfterFetch *debouncer
+	if cfg.Schedule.DetectAfterFetch {
+		detectAfterFetch = newDebouncer(cfg.Schedule.DetectDebounce, detectOpportunities)
+		defer detectAfterFetch.Stop()
+		log.Info().Dur("debounce", cfg.Schedule.DetectDebounce).Msg("Detecting opportunities after each pool fetch")
+	}
+	fetchPools := func() {
+		var summary worker.FetchSummary
+		err := runJob(ctx, "DeFiLlama fetch", func(ctx context.Context) (worker.FetchSummary, error) {
+			var err error
+			summary, err = fetcher.Run(ctx)
+			return summary, err
+		})
+		checkFetch(ctx, monitor, summary, err)
+		if err == nil && detectAfterFetch != nil {
+			detectAfterFetch.Trigger()
+		}
+	}
 
 	// Create scheduler
 	scheduler := cron.New(cron.WithSeconds())
 
-	// Schedule DeFiLlama fetch job (every 3 minutes)
-	_, err = scheduler.AddFunc("0 */3 * * * *", func() {
-		runDeFiLlamaJob(ctx, cfg, defiLlamaClient, pgRepo, redisRepo, esRepo, analyticsService)
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to schedule DeFiLlama job")
-	}
-	log.Info().Str("interval", "3m").Msg("Scheduled DeFiLlama fetch job")
-
-	// Schedule CoinGecko fetch job (every 10 minutes)
-	_, err = scheduler.AddFunc("0 */10 * * * *", func() {
-		runCoinGeckoJob(ctx, coinGeckoClient, redisRepo)
+	// Schedules come from WORKER_*_SCHEDULE, validated when the
+	// configuration loads
+	scheduleJob(scheduler, "DeFiLlama fetch", cfg.Schedule.DeFiLlama, 0, fetchPools)
+	scheduleJob(scheduler, "CoinGecko fetch", cfg.Schedule.CoinGecko, 0, fetchPrices)
+	scheduleJob(scheduler, "opportunity detection", cfg.Schedule.Detection, cfg.Schedule.DetectionOffset, detectOpportunities)
+	scheduleJob(scheduler, "APY index", cfg.Schedule.APYIndex, 0, func() {
+		runJob(ctx, "APY index", func(ctx context.Context) (int, error) {
+			values, err := indexService.Run(ctx)
+			return len(values), err
+		})
 	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to schedule CoinGecko job")
-	}
-	log.Info().Str("interval", "10m").Msg("Scheduled CoinGecko fetch job")
-
-	// Schedule opportunity detection job (every 5 minutes)
-	_, err = scheduler.AddFunc("0 */5 * * * *", func() {
-		runOpportunityDetectionJob(ctx, opportunityService, pgRepo, redisRepo)
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to schedule opportunity detection job")
-	}
-	log.Info().Str("interval", "5m").Msg("Scheduled opportunity detection job")
 
 	// Start scheduler
 	scheduler.Start()
 	log.Info().Msg("Worker scheduler started")
 
-	// Run initial fetch immediately
-	go func() {
-		log.Info().Msg("Running initial data fetch...")
-		runDeFiLlamaJob(ctx, cfg, defiLlamaClient, pgRepo, redisRepo, esRepo, analyticsService)
-		runCoinGeckoJob(ctx, coinGeckoClient, redisRepo)
-		runOpportunityDetectionJob(ctx, opportunityService, pgRepo, redisRepo)
-	}()
+	// Run the initial fetch after the startup delay, so replicas started
+	// together don't all hit the APIs and the database at once
+	if cfg.Schedule.InitialFetch {
+		go func() {
+			wait := startupWait(cfg.Schedule)
+			log.Info().Dur("delay", wait).Msg("Running initial data fetch...")
+			time.Sleep(wait)
+
+			fetchPools()
+			fetchPrices()
+			if detectAfterFetch == nil {
+				detectOpportunities()
+			}
+		}()
+	} else {
+		log.Info().Msg("Initial data fetch disabled, waiting for the schedules")
+	}
 
 	// Wait for shutdown signal
 	quit := make(chan os.Signal, 1)
@@ -139,11 +238,67 @@ func main() {
 	stopCtx := scheduler.Stop()
 	<-stopCtx.Done()
 
+	// Write the events still buffered
+	if eventLog != nil {
+		if err := eventLog.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close event log")
+		}
+	}
+
 	log.Info().Msg("Worker stopped")
 }
 
+// openEventLog opens the event log and flushes it in the background, or
+// returns nil when EVENT_LOG_ENABLED is off
+func openEventLog(ctx context.Context, cfg config.EventLogConfig) *eventlog.Writer {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	w, err := eventlog.Open(eventlog.Config{
+		Dir:       cfg.Dir,
+		BatchSize: cfg.BatchSize,
+		Retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open event log")
+	}
+	go w.Run(ctx, cfg.FlushInterval, func(err error) {
+		log.Error().Err(err).Msg("Failed to write event log")
+	})
+
+	log.Info().Str("dir", cfg.Dir).Msg("Event log enabled")
+	return w
+}
+
+// newMonitor returns the platform monitor, or nil when MONITOR_ENABLED is
+// off
+func newMonitor(cfg config.MonitorConfig, redisRepo *redis.Repository) *worker.Monitor {
+	if !cfg.Enabled {
+		return nil
+	}
+	return worker.NewMonitor(cfg, redisRepo)
+}
+
+// checkFetch has the platform monitor check a finished pools fetch, if it
+// is enabled. Failures are logged and never affect the fetch.
+func checkFetch(ctx context.Context, monitor *worker.Monitor, summary worker.FetchSummary, fetchErr error) {
+	if monitor == nil {
+		return
+	}
+
+	result, err := monitor.Check(ctx, summary, fetchErr)
+	if err != nil {
+		log.Error().Err(err).Msg("Platform monitor check failed")
+		return
+	}
+	if result.Suspect {
+		log.Warn().Interface("summary", result).Msg("Platform monitor flagged the data as suspect")
+	}
+}
+
 // setupLogger configures the zerolog logger based on environment
-func setupLogger(cfg *config.Config) {
+func setupLogger(cfg *config.Config, out io.Writer) {
 	level, err := zerolog.ParseLevel(cfg.App.LogLevel)
 	if err != nil {
 		level = zerolog.InfoLevel
@@ -152,7 +307,7 @@ func setupLogger(cfg *config.Config) {
 
 	if cfg.IsDevelopment() {
 		log.Logger = log.Output(zerolog.ConsoleWriter{
-			Out:        os.Stdout,
+			Out:        out,
 			TimeFormat: time.RFC3339,
 		})
 	} else {
@@ -160,204 +315,95 @@ func setupLogger(cfg *config.Config) {
 	}
 }
 
-// runDeFiLlamaJob fetches pools from DeFiLlama and stores them
-func runDeFiLlamaJob(
-	ctx context.Context,
-	cfg *config.Config,
-	client *defillama.Client,
-	pgRepo *postgres.Repository,
-	redisRepo *redis.Repository,
-	esRepo *elasticsearch.Repository,
-	analyticsService *analytics.Service,
-) {
-	startTime := time.Now()
-	log.Info().Msg("Starting DeFiLlama fetch job")
-
-	// Fetch pools from API
-	pools, err := client.FetchPools(ctx)
+// scheduleJob adds a job to the scheduler and logs its effective schedule.
+// A positive offset delays every run past the schedule.
+func scheduleJob(scheduler *cron.Cron, name, spec string, offset time.Duration, job func()) {
+	schedule, err := config.ParseSchedule(spec)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to fetch pools from DeFiLlama")
-		return
+		log.Fatal().Err(err).Str("schedule", spec).Msgf("Failed to schedule %s job", name)
 	}
-
-	log.Info().Int("count", len(pools)).Msg("Fetched pools from DeFiLlama")
-
-	// Filter pools by minimum TVL
-	filteredPools := make([]defillama.Pool, 0)
-	for _, p := range pools {
-		if p.TVLUsd >= cfg.Worker.MinTVLThreshold {
-			filteredPools = append(filteredPools, p)
-		}
+	if offset > 0 {
+		schedule = offsetSchedule{Schedule: schedule, offset: offset}
 	}
+	scheduler.Schedule(schedule, cron.FuncJob(job))
 
 	log.Info().
-		Int("total", len(pools)).
-		Int("filtered", len(filteredPools)).
-		Float64("min_tvl", cfg.Worker.MinTVLThreshold).
-		Msg("Filtered pools by TVL")
-
-	// Convert to internal models and calculate scores
-	modelPools := make([]models.Pool, 0, len(filteredPools))
-	for _, p := range filteredPools {
-		pool := defillama.ToPoolModel(p)
-
-		// Calculate opportunity score
-		pool.Score = analyticsService.CalculateScore(&pool)
-
-		modelPools = append(modelPools, pool)
-	}
-
-	// Store in PostgreSQL (batch upsert)
-	for _, pool := range modelPools {
-		if err := pgRepo.UpsertPool(ctx, &pool); err != nil {
-			log.Warn().Err(err).Str("pool_id", pool.ID).Msg("Failed to upsert pool")
-		}
-
-		// Record historical data point
-		historical := &models.HistoricalAPY{
-			PoolID:    pool.ID,
-			Timestamp: time.Now().UTC(),
-			APY:       pool.APY,
-			TVL:       pool.TVL,
-			APYBase:   pool.APYBase,
-			APYReward: pool.APYReward,
-		}
-		if err := pgRepo.InsertHistoricalAPY(ctx, historical); err != nil {
-			log.Warn().Err(err).Str("pool_id", pool.ID).Msg("Failed to insert historical APY")
-		}
-	}
+		Str("schedule", spec).
+		Dur("offset", offset).
+		Time("next_run", schedule.Next(time.Now())).
+		Msgf("Scheduled %s job", name)
+}
 
-	// Index in ElasticSearch (bulk)
-	if err := esRepo.BulkIndexPools(ctx, modelPools); err != nil {
-		log.Warn().Err(err).Msg("Failed to bulk index pools in ElasticSearch")
-	}
+// offsetSchedule runs a job a fixed time after each activation of its
+// schedule
+type offsetSchedule struct {
+	cron.Schedule
+	offset time.Duration
+}
 
-	// Cache in Redis
-	if err := redisRepo.SetMultiplePools(ctx, modelPools, 300); err != nil {
-		log.Warn().Err(err).Msg("Failed to cache pools in Redis")
-	}
+// Next returns the next activation of the schedule after t, plus the offset
+func (s offsetSchedule) Next(t time.Time) time.Time {
+	return s.Schedule.Next(t.Add(-s.offset)).Add(s.offset)
+}
 
-	// Invalidate list caches
-	if err := redisRepo.InvalidateAllPoolsCache(ctx); err != nil {
-		log.Warn().Err(err).Msg("Failed to invalidate pools cache")
-	}
-	if err := redisRepo.InvalidateStatsCache(ctx); err != nil {
-		log.Warn().Err(err).Msg("Failed to invalidate stats cache")
+// startupWait returns how long to wait before the initial fetch: the startup
+// delay plus a random part of the jitter
+func startupWait(cfg config.ScheduleConfig) time.Duration {
+	wait := cfg.StartupDelay
+	if cfg.StartupJitter > 0 {
+		wait += rand.N(cfg.StartupJitter)
 	}
+	return wait
+}
 
-	// Publish updates for WebSocket clients
-	for _, pool := range modelPools {
-		if err := redisRepo.PublishPoolUpdate(ctx, &pool); err != nil {
-			log.Debug().Err(err).Str("pool_id", pool.ID).Msg("Failed to publish pool update")
-		}
-	}
+// debouncer runs a function once triggers have stopped for a delay
+type debouncer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	fn    func()
+	timer *time.Timer
+}
 
-	duration := time.Since(startTime)
-	log.Info().
-		Int("pools_processed", len(modelPools)).
-		Dur("duration", duration).
-		Msg("DeFiLlama fetch job completed")
+// newDebouncer creates a debouncer running fn delay after the last trigger
+func newDebouncer(delay time.Duration, fn func()) *debouncer {
+	return &debouncer{delay: delay, fn: fn}
 }
 
-// runCoinGeckoJob fetches token prices from CoinGecko
-func runCoinGeckoJob(
-	ctx context.Context,
-	client *coingecko.Client,
-	redisRepo *redis.Repository,
-) {
-	startTime := time.Now()
-	log.Info().Msg("Starting CoinGecko fetch job")
+// Trigger schedules a run, pushing back one that is still pending
+func (d *debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	// Fetch prices for common tokens
-	tokens := []string{
-		"ethereum", "bitcoin", "tether", "usd-coin", "binance-coin",
-		"matic-network", "avalanche-2", "fantom", "arbitrum", "optimism",
+	if d.timer != nil {
+		d.timer.Stop()
 	}
+	d.timer = time.AfterFunc(d.delay, d.fn)
+}
 
-	prices, err := client.FetchPrices(ctx, tokens)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to fetch prices from CoinGecko")
-		return
-	}
+// Stop cancels a pending run
+func (d *debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	// Cache prices in Redis (15 minute TTL)
-	if err := redisRepo.SetMultipleTokenPrices(ctx, prices, 900); err != nil {
-		log.Warn().Err(err).Msg("Failed to cache token prices")
+	if d.timer != nil {
+		d.timer.Stop()
 	}
-
-	duration := time.Since(startTime)
-	log.Info().
-		Int("tokens_fetched", len(prices)).
-		Dur("duration", duration).
-		Msg("CoinGecko fetch job completed")
 }
 
-// runOpportunityDetectionJob analyzes pools for opportunities
-func runOpportunityDetectionJob(
-	ctx context.Context,
-	service *opportunity.Service,
-	pgRepo *postgres.Repository,
-	redisRepo *redis.Repository,
-) {
+// runJob runs a scheduled task, logs its outcome and returns its error
+func runJob[T any](ctx context.Context, name string, task func(context.Context) (T, error)) error {
 	startTime := time.Now()
-	log.Info().Msg("Starting opportunity detection job")
+	log.Info().Msgf("Starting %s job", name)
 
-	// Deactivate expired opportunities first
-	if err := pgRepo.DeactivateExpiredOpportunities(ctx); err != nil {
-		log.Warn().Err(err).Msg("Failed to deactivate expired opportunities")
-	}
-
-	// Detect yield gap opportunities
-	yieldGaps, err := service.DetectYieldGaps(ctx)
+	summary, err := task(ctx)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to detect yield gaps")
-	} else {
-		log.Info().Int("count", len(yieldGaps)).Msg("Detected yield gap opportunities")
-
-		// Save and publish alerts for new opportunities
-		for _, opp := range yieldGaps {
-			if err := pgRepo.UpsertOpportunity(ctx, &opp); err != nil {
-				log.Warn().Err(err).Str("id", opp.ID).Msg("Failed to save opportunity")
-			}
-			if err := redisRepo.PublishOpportunityAlert(ctx, &opp); err != nil {
-				log.Debug().Err(err).Msg("Failed to publish opportunity alert")
-			}
-		}
+		log.Error().Err(err).Interface("summary", summary).Msgf("%s job failed", name)
+		return err
 	}
 
-	// Detect trending pools
-	trending, err := service.DetectTrendingPools(ctx)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to detect trending pools")
-	} else {
-		log.Info().Int("count", len(trending)).Msg("Detected trending pools")
-
-		// Save trending opportunities
-		for _, opp := range trending {
-			if err := pgRepo.UpsertOpportunity(ctx, &opp); err != nil {
-				log.Warn().Err(err).Str("id", opp.ID).Msg("Failed to save trending opportunity")
-			}
-		}
-	}
-
-	// Detect high-score opportunities
-	highScore, err := service.DetectHighScorePools(ctx)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to detect high-score pools")
-	} else {
-		log.Info().Int("count", len(highScore)).Msg("Detected high-score opportunities")
-
-		// Save high-score opportunities
-		for _, opp := range highScore {
-			if err := pgRepo.UpsertOpportunity(ctx, &opp); err != nil {
-				log.Warn().Err(err).Str("id", opp.ID).Msg("Failed to save high-score opportunity")
-			}
-		}
-	}
-
-	duration := time.Since(startTime)
 	log.Info().
-		Dur("duration", duration).
-		Msg("Opportunity detection job completed")
+		Interface("summary", summary).
+		Dur("duration", time.Since(startTime)).
+		Msgf("%s job completed", name)
+	return nil
 }
-
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+func TestOffsetSchedule(t *testing.T) {
+	schedule, err := config.ParseSchedule("0 */5 * * * *")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	offset := offsetSchedule{Schedule: schedule, offset: time.Minute}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		from time.Time
+		want time.Time
+	}{
+		{base, base.Add(time.Minute)},
+		{base.Add(30 * time.Second), base.Add(time.Minute)},
+		{base.Add(time.Minute), base.Add(6 * time.Minute)},
+		{base.Add(4 * time.Minute), base.Add(6 * time.Minute)},
+	}
+	for _, tt := range tests {
+		if got := offset.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Next(%s) = %s, want %s", tt.from.Format(time.TimeOnly), got.Format(time.TimeOnly), tt.want.Format(time.TimeOnly))
+		}
+	}
+}
+
+func TestStartupWait(t *testing.T) {
+	if wait := startupWait(config.ScheduleConfig{}); wait != 0 {
+		t.Errorf("Expected no wait by default, got %s", wait)
+	}
+	if wait := startupWait(config.ScheduleConfig{StartupDelay: 10 * time.Second}); wait != 10*time.Second {
+		t.Errorf("Expected the startup delay, got %s", wait)
+	}
+
+	cfg := config.ScheduleConfig{StartupDelay: 10 * time.Second, StartupJitter: 5 * time.Second}
+	for i := 0; i < 20; i++ {
+		if wait := startupWait(cfg); wait < 10*time.Second || wait >= 15*time.Second {
+			t.Fatalf("Expected a wait within the jitter, got %s", wait)
+		}
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	runs := make(chan time.Time, 3)
+	d := newDebouncer(50*time.Millisecond, func() { runs <- time.Now() })
+	defer d.Stop()
+
+	start := time.Now()
+	d.Trigger()
+	time.Sleep(20 * time.Millisecond)
+	d.Trigger()
+
+	select {
+	case ran := <-runs:
+		if ran.Sub(start) < 70*time.Millisecond {
+			t.Errorf("Expected the second trigger to push the run back, ran after %s", ran.Sub(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a run after the triggers settled")
+	}
+
+	select {
+	case <-runs:
+		t.Error("Expected a single run for triggers within the delay")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	d.Trigger()
+	d.Stop()
+	select {
+	case <-runs:
+		t.Error("Expected Stop to cancel the pending run")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
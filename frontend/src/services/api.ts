@@ -331,13 +331,14 @@ export const poolsApi = {
       };
     }
     const query = buildQueryString((filter || {}) as Record<string, unknown>);
-    const raw = await fetchApi<{ data: Record<string, unknown>[]; total: unknown; limit: unknown; offset: unknown; hasMore: unknown }>(`/pools${query}`);
+    const raw = await fetchApi<{ data: Record<string, unknown>[]; total: unknown; limit: unknown; offset: unknown; hasMore: unknown; sparklines?: Record<string, number[]> }>(`/pools${query}`);
     return {
       data: (raw.data || []).map(transformPool),
       total: toNumber(raw.total),
       limit: toNumber(raw.limit),
       offset: toNumber(raw.offset),
       hasMore: Boolean(raw.hasMore),
+      sparklines: raw.sparklines,
     };
   },
 
@@ -381,13 +382,15 @@ export const opportunitiesApi = {
       };
     }
     const query = buildQueryString((filter || {}) as Record<string, unknown>);
-    const raw = await fetchApi<{ data: Record<string, unknown>[]; total: unknown; limit: unknown; offset: unknown; hasMore: unknown }>(`/opportunities${query}`);
+    const raw = await fetchApi<{ data: Record<string, unknown>[]; total: unknown; limit: unknown; offset: unknown; hasMore: unknown; detectedAfter?: string; detectedBefore?: string }>(`/opportunities${query}`);
     return {
       data: (raw.data || []).map(transformOpportunity),
       total: toNumber(raw.total),
       limit: toNumber(raw.limit),
       offset: toNumber(raw.offset),
       hasMore: Boolean(raw.hasMore),
+      detectedAfter: raw.detectedAfter,
+      detectedBefore: raw.detectedBefore,
     };
   },
 
@@ -8,6 +8,7 @@ export interface Pool {
   apy: number;
   apyBase: number;
   apyReward: number;
+  baseRatio?: number;
   rewardTokens: string[];
   underlyingTokens: string[];
   poolMeta: string;
@@ -23,6 +24,7 @@ export interface Pool {
   exposure: string;
   createdAt: string;
   updatedAt: string;
+  updatedAgo?: string;
 }
 
 export interface PoolListResponse {
@@ -31,6 +33,7 @@ export interface PoolListResponse {
   limit: number;
   offset: number;
   hasMore: boolean;
+  sparklines?: Record<string, number[]>; // Hourly APY of the last 24h by pool ID, with sparkline=true
 }
 
 export interface PoolFilter {
@@ -48,6 +51,7 @@ export interface PoolFilter {
   sortOrder?: 'asc' | 'desc';
   limit?: number;
   offset?: number;
+  sparkline?: boolean; // Attach sparklines of the last 24h hourly APY
 }
 
 // Historical APY
@@ -89,6 +93,7 @@ export interface Opportunity {
   score: number;
   isActive: boolean;
   detectedAt: string;
+  detectedAgo?: string;
   lastSeenAt: string;
   expiresAt: string;
   createdAt: string;
@@ -101,6 +106,8 @@ export interface OpportunityListResponse {
   limit: number;
   offset: number;
   hasMore: boolean;
+  detectedAfter?: string;  // Earliest detection time covered (7 days back by default)
+  detectedBefore?: string;
 }
 
 export interface OpportunityFilter {
@@ -113,6 +120,8 @@ export interface OpportunityFilter {
   activeOnly?: boolean;
   sortBy?: 'score' | 'profit' | 'apy' | 'detectedAt';
   sortOrder?: 'asc' | 'desc';
+  detectedAfter?: string;  // RFC 3339, at most 90 days ago
+  detectedBefore?: string;
   limit?: number;
   offset?: number;
 }
@@ -0,0 +1,104 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// topLevelField is a root query field requested by a query
+type topLevelField struct {
+	name    string
+	resolve func(ctx context.Context) (interface{}, error)
+}
+
+// fieldResult is what a top-level resolver returned
+type fieldResult struct {
+	data     interface{}
+	err      error
+	resolved bool
+}
+
+// resolveFields runs the resolvers of independent top-level fields
+// concurrently, bounded by the configured timeout. As GraphQL allows
+// partial results, a field that fails, panics or doesn't finish in time is
+// reported as an error on its path while the others are returned as data.
+func (r *Resolver) resolveFields(ctx context.Context, fields []topLevelField) (map[string]interface{}, []GraphQLError) {
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		// Resolvers still running when we return see the cancellation
+		defer cancel()
+	}
+
+	var (
+		mu      sync.Mutex
+		results = make([]fieldResult, len(fields))
+		g       errgroup.Group
+	)
+	for i, field := range fields {
+		g.Go(func() error {
+			data, err := resolveIsolated(ctx, field)
+
+			mu.Lock()
+			results[i] = fieldResult{data: data, err: err, resolved: true}
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	// Don't wait past the deadline for a resolver that ignores ctx
+	finished := make(chan struct{})
+	go func() {
+		g.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	data := make(map[string]interface{}, len(fields))
+	var errs []GraphQLError
+	for i, field := range fields {
+		result := results[i]
+		switch {
+		case !result.resolved || errors.Is(result.err, context.DeadlineExceeded) && ctx.Err() != nil:
+			errs = append(errs, GraphQLError{
+				Message: fmt.Sprintf("Timed out resolving %s after %s", field.name, r.config.Timeout),
+				Path:    []interface{}{field.name},
+			})
+		case result.err != nil:
+			errs = append(errs, fieldError(field.name, result.err))
+		default:
+			data[field.name] = result.data
+		}
+	}
+
+	return data, errs
+}
+
+// resolveIsolated runs a field's resolver, turning a panic into an error on
+// the field so the rest of the query still resolves
+func resolveIsolated(ctx context.Context, field topLevelField) (data interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error().
+				Str("field", field.name).
+				Interface("panic", p).
+				Bytes("stack", debug.Stack()).
+				Msg("GraphQL resolver panicked")
+			data, err = nil, fmt.Errorf("Internal error resolving %s", field.name)
+		}
+	}()
+
+	return field.resolve(ctx)
+}
@@ -0,0 +1,120 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+func TestResolveFields(t *testing.T) {
+	r := NewResolver(config.GraphQLConfig{Timeout: 50 * time.Millisecond}, config.DistributionConfig{}, config.ListingConfig{}, config.AdminConfig{}, nil, nil, nil, nil)
+
+	// Released once the test is done so the stuck resolver can exit
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{}, 2)
+	fields := []topLevelField{
+		{"stats", func(context.Context) (interface{}, error) {
+			return map[string]interface{}{"totalPools": 10}, nil
+		}},
+		{"chains", func(context.Context) (interface{}, error) {
+			return nil, errors.New("database unavailable")
+		}},
+		{"pools", func(ctx context.Context) (interface{}, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+		{"opportunities", func(context.Context) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return []interface{}{}, nil
+		}},
+	}
+
+	begin := time.Now()
+	data, errs := r.resolveFields(context.Background(), fields)
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Expected resolution to stop at the timeout, took %s", elapsed)
+	}
+	if len(started) != 2 {
+		t.Errorf("Expected the slow resolvers to run concurrently, %d started", len(started))
+	}
+
+	if len(data) != 1 || data["stats"] == nil {
+		t.Errorf("Expected only stats resolved, got %v", data)
+	}
+
+	want := map[string]string{
+		"chains":        "database unavailable",
+		"pools":         "Timed out resolving pools after 50ms",
+		"opportunities": "Timed out resolving opportunities after 50ms",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d field errors, got %+v", len(want), errs)
+	}
+	for _, e := range errs {
+		if len(e.Path) != 1 {
+			t.Errorf("Expected a field path, got %+v", e)
+			continue
+		}
+		name, _ := e.Path[0].(string)
+		if e.Message != want[name] {
+			t.Errorf("Expected %q for %s, got %q", want[name], name, e.Message)
+		}
+	}
+}
+
+func TestResolveFields_NoTimeout(t *testing.T) {
+	r := NewResolver(config.GraphQLConfig{}, config.DistributionConfig{}, config.ListingConfig{}, config.AdminConfig{}, nil, nil, nil, nil)
+
+	data, errs := r.resolveFields(context.Background(), []topLevelField{
+		{"stats", func(ctx context.Context) (interface{}, error) {
+			if _, ok := ctx.Deadline(); ok {
+				t.Error("Expected no deadline without a timeout")
+			}
+			time.Sleep(10 * time.Millisecond)
+			return "ok", nil
+		}},
+	})
+	if len(errs) != 0 || data["stats"] != "ok" {
+		t.Errorf("Expected stats resolved, got %v %+v", data, errs)
+	}
+}
+
+func TestResolveFields_IsolatesFailures(t *testing.T) {
+	r := NewResolver(config.GraphQLConfig{Timeout: time.Second}, config.DistributionConfig{}, config.ListingConfig{}, config.AdminConfig{}, nil, nil, nil, nil)
+
+	data, errs := r.resolveFields(context.Background(), []topLevelField{
+		{"pools", func(context.Context) (interface{}, error) {
+			return map[string]interface{}{"totalCount": 3}, nil
+		}},
+		{"stats", func(context.Context) (interface{}, error) {
+			return nil, errors.New("stats unavailable")
+		}},
+		{"chains", func(context.Context) (interface{}, error) {
+			var chains []string
+			return chains[1], nil
+		}},
+		{"health", func(context.Context) (interface{}, error) {
+			return map[string]interface{}{"status": "UP"}, nil
+		}},
+	})
+
+	if len(data) != 2 || data["pools"] == nil || data["health"] == nil {
+		t.Errorf("Expected pools and health alongside the failures, got %v", data)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 field errors, got %+v", errs)
+	}
+	if errs[0].Message != "stats unavailable" || errs[0].Path[0] != "stats" {
+		t.Errorf("Expected the stats error on its path, got %+v", errs[0])
+	}
+	if errs[1].Message != "Internal error resolving chains" || errs[1].Path[0] != "chains" {
+		t.Errorf("Expected the panic reported on chains, got %+v", errs[1])
+	}
+}
@@ -0,0 +1,78 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
+)
+
+// Value formats of the format argument of decimal fields
+const (
+	formatRaw   = "RAW"   // Exact decimal string, the default
+	formatHuman = "HUMAN" // Rounded for display: $1.23B, 5.23%
+)
+
+// formattedFields are the Pool fields taking a format argument, with the
+// display format of each. Keep in sync with schema.graphql.
+var formattedFields = map[string]func(decimal.Decimal) string{
+	"tvl":       utils.FormatUSD,
+	"apy":       utils.FormatPercentage,
+	"apyBase":   utils.FormatPercentage,
+	"apyReward": utils.FormatPercentage,
+}
+
+// valueFormats holds the fields a query asks to be formatted for display.
+// The simplified executor resolves a field once per object, so a field
+// formatted anywhere in the query is formatted everywhere in it.
+type valueFormats map[string]bool
+
+// parseValueFormats finds the format arguments of the formatted fields in a
+// query, as literals or variables
+func parseValueFormats(query string, vars map[string]interface{}) (valueFormats, error) {
+	formats := make(valueFormats)
+	lex := lexer{src: query}
+
+	for {
+		tok, err := lex.next()
+		if err != nil || tok == "" {
+			// The query was already parsed by the limits check
+			return formats, nil
+		}
+		if formattedFields[tok] == nil {
+			continue
+		}
+		if next, _ := lex.peek(); next != "(" {
+			continue
+		}
+		lex.next()
+
+		if name, _ := lex.next(); name != "format" {
+			return nil, fmt.Errorf("unknown argument %q on %s", name, tok)
+		}
+		if colon, _ := lex.next(); colon != ":" {
+			return nil, fmt.Errorf("malformed format argument on %s", tok)
+		}
+		value, _ := lex.next()
+		if value == "$" {
+			name, _ := lex.next()
+			value, _ = vars[name].(string)
+		}
+		switch value {
+		case formatHuman:
+			formats[tok] = true
+		case formatRaw, "":
+		default:
+			return nil, fmt.Errorf("unknown format %q on %s, expected RAW or HUMAN", value, tok)
+		}
+	}
+}
+
+// decimal returns the value of a formatted field as the query asks for it
+func (f valueFormats) decimal(field string, d decimal.Decimal) string {
+	if f[field] {
+		return formattedFields[field](d)
+	}
+	return d.String()
+}
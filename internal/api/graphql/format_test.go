@@ -0,0 +1,123 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestValueFormats_HumanTVL(t *testing.T) {
+	formats := valueFormats{"tvl": true}
+
+	tests := []struct {
+		tvl  string
+		want string
+	}{
+		{"0", "$0.00"},
+		{"999.994", "$999.99"},
+		{"999.995", "$1.00K"},
+		{"1000", "$1.00K"},
+		{"999994.99", "$999.99K"},
+		{"999995", "$1.00M"},
+		{"1230000", "$1.23M"},
+		{"999999999.99", "$1.00B"},
+		{"1234567890", "$1.23B"},
+		{"1000000000000", "$1.00T"},
+		{"2500000000000000", "$2500.00T"},
+		{"-1500000", "-$1.50M"},
+	}
+
+	for _, tt := range tests {
+		if got := formats.decimal("tvl", decimal.RequireFromString(tt.tvl)); got != tt.want {
+			t.Errorf("TVL %s: Expected %s, got %s", tt.tvl, tt.want, got)
+		}
+	}
+}
+
+func TestValueFormats_HumanAPY(t *testing.T) {
+	formats := valueFormats{"apy": true}
+
+	tests := []struct {
+		apy  string
+		want string
+	}{
+		{"5.2345", "5.23%"},
+		{"5.235", "5.24%"},
+		{"0", "0.00%"},
+		{"0.004", "0.00%"},
+		{"-12.5", "-12.50%"},
+		{"100000", "100000.00%"},
+	}
+
+	for _, tt := range tests {
+		if got := formats.decimal("apy", decimal.RequireFromString(tt.apy)); got != tt.want {
+			t.Errorf("APY %s: Expected %s, got %s", tt.apy, tt.want, got)
+		}
+	}
+}
+
+func TestParseValueFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		vars    map[string]interface{}
+		want    []string // Formatted fields
+		wantErr bool
+	}{
+		{"raw by default", "{ pools { edges { node { tvl apy } } } }", nil, nil, false},
+		{"literal", "{ pools { edges { node { tvl(format: HUMAN) apy } } } }", nil, []string{"tvl"}, false},
+		{"explicit raw", "{ pool(id: $id) { tvl(format: RAW) apy(format: HUMAN) } }", nil, []string{"apy"}, false},
+		{"alias", "{ pool(id: $id) { display: apyBase(format: HUMAN) } }", nil, []string{"apyBase"}, false},
+		{
+			"variable",
+			"query ($f: ValueFormat) { pool(id: $id) { tvl(format: $f) } }",
+			map[string]interface{}{"f": "HUMAN"},
+			[]string{"tvl"},
+			false,
+		},
+		{"filter keys are not fields", `{ pools(filter: {minTvl: 5, sortBy: TVL}) { totalCount } }`, nil, nil, false},
+		{"unknown format", "{ pool(id: $id) { tvl(format: PRETTY) } }", nil, nil, true},
+		{"unknown argument", "{ pool(id: $id) { tvl(unit: USD) } }", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formats, err := parseValueFormats(tt.query, tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if len(formats) != len(tt.want) {
+				t.Fatalf("Expected formatted fields %v, got %v", tt.want, formats)
+			}
+			for _, field := range tt.want {
+				if !formats[field] {
+					t.Errorf("Expected %s to be formatted, got %v", field, formats)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolToGraphQL_Formats(t *testing.T) {
+	pool := models.Pool{
+		TVL:       decimal.RequireFromString("1234567890.123456"),
+		APY:       decimal.RequireFromString("5.234567"),
+		APYBase:   decimal.RequireFromString("3.1"),
+		APYReward: decimal.RequireFromString("2.134567"),
+	}
+
+	raw := poolToGraphQL(pool, nil)
+	if raw["tvl"] != "1234567890.123456" || raw["apy"] != "5.234567" {
+		t.Errorf("Expected raw decimal strings by default, got tvl %v, apy %v", raw["tvl"], raw["apy"])
+	}
+
+	human := poolToGraphQL(pool, valueFormats{"tvl": true, "apy": true})
+	if human["tvl"] != "$1.23B" || human["apy"] != "5.23%" {
+		t.Errorf("Expected $1.23B and 5.23%%, got tvl %v, apy %v", human["tvl"], human["apy"])
+	}
+	if human["apyReward"] != "2.134567" {
+		t.Errorf("Expected unformatted fields to stay raw, got apyReward %v", human["apyReward"])
+	}
+}
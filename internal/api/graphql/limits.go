@@ -0,0 +1,733 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query cost model: every field costs 1, and a field returning a list
+// multiplies the cost of its selection by listCostFactor, so nested lists
+// and connections grow the cost geometrically
+const listCostFactor = 10
+
+// listFields are the schema fields that return a list of objects. Keep in
+// sync with schema.graphql.
+var listFields = map[string]bool{
+	"trendingPools":             true,
+	"bestOpportunitiesPerChain": true,
+	"chains":                    true,
+	"indices":                   true,
+	"indexHistory":              true,
+	"history":                   true,
+	"edges":                     true,
+	"asSource":                  true,
+	"asTarget":                  true,
+	"direct":                    true,
+	"tvlByChain":                true,
+	"poolsByChain":              true,
+	"byScore":                   true,
+	"byTvl":                     true,
+	"byChain":                   true,
+}
+
+// queryCost is the measured size of a query document
+type queryCost struct {
+	Depth      int // Deepest field nesting; top-level fields are at depth 1
+	Complexity int
+}
+
+// checkQueryLimits rejects a query deeper or costlier than the configured
+// limits, or one that can't be parsed and so can't be measured. A zero limit
+// is not enforced.
+func (r *Resolver) checkQueryLimits(query string) *GraphQLError {
+	cost, err := measureQuery(query)
+	if err != nil {
+		return &GraphQLError{Message: "Syntax error: " + err.Error()}
+	}
+	if r.config.MaxDepth > 0 && cost.Depth > r.config.MaxDepth {
+		return &GraphQLError{Message: fmt.Sprintf("Query depth %d exceeds the maximum of %d", cost.Depth, r.config.MaxDepth)}
+	}
+	if r.config.MaxComplexity > 0 && cost.Complexity > r.config.MaxComplexity {
+		return &GraphQLError{Message: fmt.Sprintf("Query complexity %d exceeds the maximum of %d", cost.Complexity, r.config.MaxComplexity)}
+	}
+	return nil
+}
+
+// measureQuery parses a query document and returns the depth and cost of
+// its costliest operation. Fragment spreads count as the fields of the
+// fragment; a fragment that spreads itself is an error.
+func measureQuery(query string) (queryCost, error) {
+	p := &queryParser{lex: lexer{src: query}}
+	doc, err := p.document()
+	if err != nil {
+		return queryCost{}, err
+	}
+
+	m := measurer{fragments: doc.fragments, visiting: make(map[string]bool)}
+	var worst queryCost
+	for _, op := range doc.operations {
+		cost, err := m.selections(op.selections, 1)
+		if err != nil {
+			return queryCost{}, err
+		}
+		worst.Depth = max(worst.Depth, cost.Depth)
+		worst.Complexity = max(worst.Complexity, cost.Complexity)
+	}
+	return worst, nil
+}
+
+// measurer totals the cost of selection sets, expanding fragment spreads
+type measurer struct {
+	fragments map[string][]selection
+	visiting  map[string]bool
+}
+
+// selections measures a selection set whose fields are at depth
+func (m measurer) selections(set []selection, depth int) (queryCost, error) {
+	var total queryCost
+	for _, sel := range set {
+		var cost queryCost
+		switch {
+		case sel.spread != "":
+			fragment, ok := m.fragments[sel.spread]
+			if !ok {
+				return queryCost{}, fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if m.visiting[sel.spread] {
+				return queryCost{}, fmt.Errorf("fragment %q spreads itself", sel.spread)
+			}
+			m.visiting[sel.spread] = true
+			c, err := m.selections(fragment, depth)
+			delete(m.visiting, sel.spread)
+			if err != nil {
+				return queryCost{}, err
+			}
+			cost = c
+		case sel.inline:
+			c, err := m.selections(sel.children, depth)
+			if err != nil {
+				return queryCost{}, err
+			}
+			cost = c
+		default:
+			children, err := m.selections(sel.children, depth+1)
+			if err != nil {
+				return queryCost{}, err
+			}
+			factor := 1
+			if listFields[sel.name] {
+				factor = listCostFactor
+			}
+			cost = queryCost{
+				Depth:      max(depth, children.Depth),
+				Complexity: 1 + factor*children.Complexity,
+			}
+		}
+		total.Depth = max(total.Depth, cost.Depth)
+		total.Complexity += cost.Complexity
+	}
+	return total, nil
+}
+
+// =============================================================================
+// Parsing
+// =============================================================================
+
+// selection is a field, a fragment spread or an inline fragment
+type selection struct {
+	name      string     // Field name, not alias
+	alias     string     // Name the field is returned under, if aliased
+	arguments []argument // In the order written
+	spread    string     // Name of a spread fragment
+	inline    bool       // Inline fragment; its fields are in children
+	children  []selection
+}
+
+// responseKey is the name a field is returned under
+func (s selection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// argument is a field argument as written. Its value is a literal, with
+// variables in it left as variableRef.
+type argument struct {
+	name  string
+	value interface{}
+}
+
+// variableRef is a $variable in an argument value
+type variableRef string
+
+// operation is an operation definition of a document
+type operation struct {
+	kind       string                 // query, mutation or subscription
+	name       string                 // Empty if anonymous
+	defaults   map[string]interface{} // Default values of the variables
+	selections []selection
+}
+
+// document holds the operations and fragments of a query
+type document struct {
+	operations []operation
+	fragments  map[string][]selection
+}
+
+// parseOperation parses a query document and picks the operation to run:
+// the one named operationName, or the only one if no name is given
+func parseOperation(query, operationName string) (document, operation, error) {
+	p := &queryParser{lex: lexer{src: query}}
+	doc, err := p.document()
+	if err != nil {
+		return doc, operation{}, fmt.Errorf("Syntax error: %w", err)
+	}
+
+	if operationName == "" {
+		if len(doc.operations) > 1 {
+			return doc, operation{}, fmt.Errorf("operationName is required for a document with %d operations", len(doc.operations))
+		}
+		return doc, doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == operationName {
+			return doc, op, nil
+		}
+	}
+	return doc, operation{}, fmt.Errorf("Unknown operation %q", operationName)
+}
+
+// queryParser reads the structure of a query document and the arguments of
+// its fields. Directives are checked for balance but not interpreted.
+type queryParser struct {
+	lex lexer
+}
+
+func (p *queryParser) document() (document, error) {
+	doc := document{fragments: make(map[string][]selection)}
+
+	for {
+		tok, err := p.lex.peek()
+		if err != nil {
+			return doc, err
+		}
+		switch {
+		case tok == "":
+			if len(doc.operations) == 0 {
+				return doc, fmt.Errorf("query has no operation")
+			}
+			return doc, nil
+		case tok == "fragment":
+			p.lex.next()
+			name, _ := p.lex.next()
+			if on, _ := p.lex.next(); !isName(name) || on != "on" {
+				return doc, fmt.Errorf("malformed fragment definition")
+			}
+			if typ, _ := p.lex.next(); !isName(typ) {
+				return doc, fmt.Errorf("malformed fragment definition")
+			}
+			if err := p.skipDirectives(); err != nil {
+				return doc, err
+			}
+			set, err := p.selectionSet()
+			if err != nil {
+				return doc, err
+			}
+			doc.fragments[name] = set
+		case tok == "query" || tok == "mutation" || tok == "subscription":
+			p.lex.next()
+			op := operation{kind: tok}
+			if next, _ := p.lex.peek(); isName(next) {
+				p.lex.next()
+				op.name = next
+			}
+			if next, _ := p.lex.peek(); next == "(" {
+				defaults, err := p.variableDefinitions()
+				if err != nil {
+					return doc, err
+				}
+				op.defaults = defaults
+			}
+			if err := p.skipDirectives(); err != nil {
+				return doc, err
+			}
+			set, err := p.selectionSet()
+			if err != nil {
+				return doc, err
+			}
+			op.selections = set
+			doc.operations = append(doc.operations, op)
+		case tok == "{":
+			set, err := p.selectionSet()
+			if err != nil {
+				return doc, err
+			}
+			doc.operations = append(doc.operations, operation{kind: "query", selections: set})
+		default:
+			return doc, fmt.Errorf("unexpected %q", tok)
+		}
+	}
+}
+
+// selectionSet parses { selection... }
+func (p *queryParser) selectionSet() ([]selection, error) {
+	if tok, err := p.lex.next(); err != nil {
+		return nil, err
+	} else if tok != "{" {
+		return nil, fmt.Errorf("expected {, got %q", tok)
+	}
+
+	var set []selection
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok == "}":
+			if len(set) == 0 {
+				return nil, fmt.Errorf("empty selection set")
+			}
+			return set, nil
+		case tok == "...":
+			sel, err := p.fragmentSelection()
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, sel)
+		case isName(tok):
+			sel, err := p.field(tok)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, sel)
+		case tok == "":
+			return nil, fmt.Errorf("unexpected end of query")
+		default:
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+	}
+}
+
+// field parses the rest of a field whose first name was read
+func (p *queryParser) field(name string) (selection, error) {
+	sel := selection{name: name}
+	if next, _ := p.lex.peek(); next == ":" {
+		p.lex.next()
+		field, err := p.lex.next()
+		if err != nil {
+			return selection{}, err
+		}
+		if !isName(field) {
+			return selection{}, fmt.Errorf("expected field name after alias, got %q", field)
+		}
+		sel.alias, sel.name = name, field
+	}
+
+	if next, _ := p.lex.peek(); next == "(" {
+		args, err := p.arguments()
+		if err != nil {
+			return selection{}, err
+		}
+		sel.arguments = args
+	}
+	if err := p.skipDirectives(); err != nil {
+		return selection{}, err
+	}
+
+	if next, _ := p.lex.peek(); next == "{" {
+		children, err := p.selectionSet()
+		if err != nil {
+			return selection{}, err
+		}
+		sel.children = children
+	}
+	return sel, nil
+}
+
+// arguments parses (name: value ...)
+func (p *queryParser) arguments() ([]argument, error) {
+	p.lex.next()
+
+	var args []argument
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok == ")":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("empty argument list")
+			}
+			return args, nil
+		case isName(tok):
+			if colon, _ := p.lex.next(); colon != ":" {
+				return nil, fmt.Errorf("expected : after argument %s", tok)
+			}
+			value, err := p.value(false)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, argument{name: tok, value: value})
+		case tok == "":
+			return nil, fmt.Errorf("unexpected end of query, expected )")
+		default:
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+	}
+}
+
+// variableDefinitions parses ($name: Type = default ...) and returns the
+// default values given
+func (p *queryParser) variableDefinitions() (map[string]interface{}, error) {
+	p.lex.next()
+
+	defaults := make(map[string]interface{})
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case ")":
+			return defaults, nil
+		case "":
+			return nil, fmt.Errorf("unexpected end of query, expected )")
+		case "$":
+		default:
+			return nil, fmt.Errorf("expected variable, got %q", tok)
+		}
+
+		name, _ := p.lex.next()
+		if !isName(name) {
+			return nil, fmt.Errorf("expected variable name")
+		}
+		if colon, _ := p.lex.next(); colon != ":" {
+			return nil, fmt.Errorf("expected : after $%s", name)
+		}
+		if err := p.skipType(); err != nil {
+			return nil, err
+		}
+		if next, _ := p.lex.peek(); next == "=" {
+			p.lex.next()
+			value, err := p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			defaults[name] = value
+		}
+		if err := p.skipDirectives(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipType skips a type reference: a name or [type], either followed by !
+func (p *queryParser) skipType() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	switch {
+	case tok == "[":
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if close, _ := p.lex.next(); close != "]" {
+			return fmt.Errorf("expected ] closing list type")
+		}
+	case !isName(tok):
+		return fmt.Errorf("expected type, got %q", tok)
+	}
+
+	if next, _ := p.lex.peek(); next == "!" {
+		p.lex.next()
+	}
+	return nil
+}
+
+// value parses an argument or default value. Numbers are read as float64
+// and enum values as strings, as the same values sent in JSON variables
+// would be. Variables are returned as variableRef, and are not allowed in
+// a constant value.
+func (p *queryParser) value(constant bool) (interface{}, error) {
+	tok, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of query, expected a value")
+	case tok == "$":
+		if constant {
+			return nil, fmt.Errorf("unexpected variable in a default value")
+		}
+		name, _ := p.lex.next()
+		if !isName(name) {
+			return nil, fmt.Errorf("expected variable name")
+		}
+		return variableRef(name), nil
+	case tok == "[":
+		list := []interface{}{}
+		for {
+			if next, _ := p.lex.peek(); next == "]" {
+				p.lex.next()
+				return list, nil
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case tok == "{":
+		object := make(map[string]interface{})
+		for {
+			name, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if name == "}" {
+				return object, nil
+			}
+			if !isName(name) {
+				return nil, fmt.Errorf("expected field name in object value, got %q", name)
+			}
+			if colon, _ := p.lex.next(); colon != ":" {
+				return nil, fmt.Errorf("expected : after %s", name)
+			}
+			field, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			object[name] = field
+		}
+	case strings.HasPrefix(tok, `"""`):
+		return blockString(tok), nil
+	case strings.HasPrefix(tok, `"`):
+		// GraphQL string escapes are those of JSON
+		var s string
+		if err := json.Unmarshal([]byte(tok), &s); err != nil {
+			return nil, fmt.Errorf("invalid string %s", tok)
+		}
+		return s, nil
+	case tok == "true" || tok == "false":
+		return tok == "true", nil
+	case tok == "null":
+		return nil, nil
+	case isName(tok):
+		return tok, nil
+	}
+
+	n, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", tok)
+	}
+	return n, nil
+}
+
+// blockString returns the value of a """block string""", without its
+// common indentation and leading and trailing blank lines
+func blockString(tok string) string {
+	raw := strings.ReplaceAll(tok[3:len(tok)-3], `\"""`, `"""`)
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if n := len(line) - len(trimmed); trimmed != "" && (indent < 0 || n < indent) {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		lines[i] = lines[i][min(indent, len(lines[i])):]
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fragmentSelection parses a spread or inline fragment after ...
+func (p *queryParser) fragmentSelection() (selection, error) {
+	next, err := p.lex.peek()
+	if err != nil {
+		return selection{}, err
+	}
+
+	if isName(next) && next != "on" {
+		p.lex.next()
+		if err := p.skipDirectives(); err != nil {
+			return selection{}, err
+		}
+		return selection{spread: next}, nil
+	}
+
+	if next == "on" {
+		p.lex.next()
+		if typ, _ := p.lex.next(); !isName(typ) {
+			return selection{}, fmt.Errorf("expected type condition")
+		}
+	}
+	if err := p.skipDirectives(); err != nil {
+		return selection{}, err
+	}
+	children, err := p.selectionSet()
+	if err != nil {
+		return selection{}, err
+	}
+	return selection{inline: true, children: children}, nil
+}
+
+// skipDirectives skips @name(args) directives
+func (p *queryParser) skipDirectives() error {
+	for {
+		if next, _ := p.lex.peek(); next != "@" {
+			return nil
+		}
+		p.lex.next()
+		if name, _ := p.lex.next(); !isName(name) {
+			return fmt.Errorf("expected directive name")
+		}
+		if next, _ := p.lex.peek(); next == "(" {
+			if err := p.skipBalanced("(", ")"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// skipBalanced skips from an opening token to its matching close, allowing
+// nested brackets and braces inside argument values
+func (p *queryParser) skipBalanced(open, close string) error {
+	if tok, _ := p.lex.next(); tok != open {
+		return fmt.Errorf("expected %s", open)
+	}
+
+	depth := 1
+	for depth > 0 {
+		tok, err := p.lex.next()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "":
+			return fmt.Errorf("unexpected end of query, expected %s", close)
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+// isName reports whether tok is a GraphQL name
+func isName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	for i, c := range tok {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// lexer splits a query into names, punctuators and values, skipping
+// whitespace, commas and comments. Strings are returned whole. The empty
+// token marks the end of the query.
+type lexer struct {
+	src    string
+	pos    int
+	peeked *string
+}
+
+func (l *lexer) peek() (string, error) {
+	if l.peeked == nil {
+		tok, err := l.scan()
+		if err != nil {
+			return "", err
+		}
+		l.peeked = &tok
+	}
+	return *l.peeked, nil
+}
+
+func (l *lexer) next() (string, error) {
+	tok, err := l.peek()
+	l.peeked = nil
+	return tok, err
+}
+
+func (l *lexer) scan() (string, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return l.token()
+		}
+	}
+	return "", nil
+}
+
+func (l *lexer) token() (string, error) {
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+	case strings.ContainsRune("{}()[]:!$@=|&", rune(c)):
+		l.pos++
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated block string")
+		}
+		l.pos += 3 + end + 3
+	case c == '"':
+		for l.pos++; ; {
+			if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+				return "", fmt.Errorf("unterminated string")
+			}
+			ch := l.src[l.pos]
+			if ch == '\\' {
+				l.pos += 2
+				continue
+			}
+			l.pos++
+			if ch == '"' {
+				break
+			}
+		}
+	case c == '_' || c == '-' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c != '_' && c != '-' && c != '+' && c != '.' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+				break
+			}
+			l.pos++
+		}
+	default:
+		return "", fmt.Errorf("unexpected character %q", c)
+	}
+
+	return l.src[start:l.pos], nil
+}
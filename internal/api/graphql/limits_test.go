@@ -0,0 +1,139 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+func TestMeasureQuery(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantDepth      int
+		wantComplexity int
+	}{
+		{"single field", "{ stats { totalPools } }", 2, 2},
+		{
+			// pools 1 + edges (1 + 10 × node (1 + 2)) + totalCount
+			"connection",
+			`query Pools($filter: PoolFilter) {
+				pools(filter: $filter, pagination: {limit: 10}) {
+					edges { node { id apy } }
+					totalCount
+				}
+			}`,
+			4, 33,
+		},
+		{
+			// chains is a list: 1 + 10 × (name + pools (1 + edges (1 + 10 × node (1 + 1))))
+			"nested lists multiply",
+			"{ chains { name pools { edges { node { id } } } } }",
+			5, 231,
+		},
+		{
+			"aliases count the field",
+			"{ a: stats { totalPools } b: stats { totalPools } }",
+			2, 4,
+		},
+		{
+			"fragments expand",
+			`query { pools { edges { node { ...PoolFields } } } }
+			fragment PoolFields on Pool { id chain ... on Pool { apy } }`,
+			4, 42,
+		},
+		{
+			"braces in strings and arguments are ignored",
+			`{ pools(filter: {search: "} { {", sort: [{field: TVL}]}) { totalCount } } # { {`,
+			2, 2,
+		},
+		{
+			"costliest operation counts",
+			"query A { stats { totalPools } } query B { health { status } chains { name } }",
+			2, 13,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := measureQuery(tt.query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cost.Depth != tt.wantDepth || cost.Complexity != tt.wantComplexity {
+				t.Errorf("Expected depth %d and complexity %d, got %+v", tt.wantDepth, tt.wantComplexity, cost)
+			}
+		})
+	}
+}
+
+func TestMeasureQuery_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"empty", ""},
+		{"unbalanced", "{ pools { edges { node { id } }"},
+		{"empty selection", "{ pools { } }"},
+		{"unterminated string", `{ pool(id: "abc) { id } }`},
+		{"unknown fragment", "{ pools { ...Missing } }"},
+		{"fragment cycle", "{ pools { ...A } } fragment A on PoolConnection { totalCount ...A }"},
+		{"stray token", "pools { id }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := measureQuery(tt.query); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestHandle_RejectsOverLimitQueries(t *testing.T) {
+	r := NewResolver(config.GraphQLConfig{MaxDepth: 5, MaxComplexity: 200}, config.DistributionConfig{}, config.ListingConfig{}, config.AdminConfig{}, nil, nil, nil, nil)
+	app := fiber.New()
+	app.Post("/graphql", r.Handle)
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"too deep", "{ a { b { c { d { e { f } } } } } }", "Query depth 6 exceeds the maximum of 5"},
+		{"too complex", "{ chains { name pools { edges { node { id } } } } }", "Query complexity 231 exceeds the maximum of 200"},
+		{"unparseable", "{ pools {", "Syntax error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(GraphQLRequest{Query: tt.query})
+			req := httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			var got struct {
+				Data   json.RawMessage `json:"data"`
+				Errors []GraphQLError  `json:"errors"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(got.Errors) != 1 || !strings.Contains(got.Errors[0].Message, tt.wantErr) {
+				t.Fatalf("Expected error %q, got %v", tt.wantErr, got.Errors)
+			}
+			if got.Data != nil {
+				t.Errorf("Expected no data for a rejected query, got %s", got.Data)
+			}
+		})
+	}
+}
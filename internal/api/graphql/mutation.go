@@ -0,0 +1,189 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error codes set in the extensions of a GraphQL error, so clients can tell
+// failures apart without parsing messages. Authorization failures are
+// reported this way rather than as HTTP 401: the response is still 200.
+const (
+	CodeUnauthorized     = "UNAUTHORIZED"              // Missing or wrong admin key
+	CodeForbidden        = "FORBIDDEN"                 // The admin API is disabled
+	CodeValidationFailed = "GRAPHQL_VALIDATION_FAILED" // The document asks for what the schema lacks
+)
+
+// codedError is a resolver error with an extension code
+type codedError struct {
+	code    string
+	message string
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+// fieldError reports the error of a top-level field, with its extension
+// code if it has one
+func fieldError(field string, err error) GraphQLError {
+	gqlErr := GraphQLError{Message: err.Error(), Path: []interface{}{field}}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		gqlErr.Extensions = map[string]interface{}{"code": coded.code}
+	}
+	return gqlErr
+}
+
+// mutationField resolves a mutation field from its arguments, with
+// variables already substituted
+type mutationField func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// adminContextKey marks a request that carried a valid admin key
+type adminContextKey struct{}
+
+// withAdmin records in ctx whether the request carried a valid admin key
+func withAdmin(ctx context.Context, admin bool) context.Context {
+	return context.WithValue(ctx, adminContextKey{}, admin)
+}
+
+// requireAdmin fails unless the request carried a valid admin key, as the
+// admin REST API requires
+func (r *Resolver) requireAdmin(ctx context.Context) error {
+	if r.admin.APIKey == "" {
+		return &codedError{code: CodeForbidden, message: "Admin API is disabled"}
+	}
+	if admin, _ := ctx.Value(adminContextKey{}).(bool); !admin {
+		return &codedError{code: CodeUnauthorized, message: "Invalid or missing admin key"}
+	}
+	return nil
+}
+
+// executeMutation runs the fields of a mutation operation one after the
+// other, in the order they appear, as GraphQL requires of mutations. Each
+// field is authorized by the admin key. A field that fails is reported on
+// its path and doesn't stop the ones after it.
+func (r *Resolver) executeMutation(ctx context.Context, req GraphQLRequest, doc document, op operation) (interface{}, []GraphQLError) {
+	// Also rejects fragments that are unknown or spread themselves, which
+	// collectFields relies on
+	if err := r.checkQueryLimits(req.Query); err != nil {
+		return nil, []GraphQLError{*err}
+	}
+
+	fields := collectFields(op.selections, doc.fragments)
+	for _, field := range fields {
+		if _, ok := r.mutations[field.name]; !ok {
+			return nil, []GraphQLError{{
+				Message:    fmt.Sprintf("Cannot query field %q on type \"Mutation\"", field.name),
+				Extensions: map[string]interface{}{"code": CodeValidationFailed},
+			}}
+		}
+	}
+
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+
+	vars := op.variables(req.Variables)
+	data := make(map[string]interface{}, len(fields))
+	var errs []GraphQLError
+	for _, field := range fields {
+		resolve := r.mutations[field.name]
+		args := argumentValues(field.arguments, vars)
+
+		result, err := resolveIsolated(ctx, topLevelField{field.responseKey(), func(ctx context.Context) (interface{}, error) {
+			if err := r.requireAdmin(ctx); err != nil {
+				return nil, err
+			}
+			return resolve(ctx, args)
+		}})
+		if err != nil {
+			errs = append(errs, fieldError(field.responseKey(), err))
+		}
+		data[field.responseKey()] = result
+	}
+
+	return data, errs
+}
+
+// collectFields returns the fields of a selection set with its fragments
+// expanded, in document order. Fields with the same response key are one
+// field, as GraphQL merges them. Fragments must have been checked to exist
+// and not spread themselves.
+func collectFields(set []selection, fragments map[string][]selection) []selection {
+	var fields []selection
+	seen := make(map[string]bool)
+
+	var collect func(set []selection)
+	collect = func(set []selection) {
+		for _, sel := range set {
+			switch {
+			case sel.spread != "":
+				collect(fragments[sel.spread])
+			case sel.inline:
+				collect(sel.children)
+			case !seen[sel.responseKey()]:
+				seen[sel.responseKey()] = true
+				fields = append(fields, sel)
+			}
+		}
+	}
+	collect(set)
+
+	return fields
+}
+
+// variables returns the request's variables, with the operation's defaults
+// for those not given
+func (op operation) variables(given map[string]interface{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(op.defaults)+len(given))
+	for name, value := range op.defaults {
+		vars[name] = value
+	}
+	for name, value := range given {
+		vars[name] = value
+	}
+	return vars
+}
+
+// argumentValues returns the arguments of a field by name, with variables
+// replaced by their values. An argument set to a variable that has no value
+// is left out, as if it wasn't given.
+func argumentValues(args []argument, vars map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		if ref, ok := arg.value.(variableRef); ok {
+			if value, set := vars[string(ref)]; set {
+				values[arg.name] = value
+			}
+			continue
+		}
+		values[arg.name] = substituteVariables(arg.value, vars)
+	}
+	return values
+}
+
+// substituteVariables replaces the variables in a literal value
+func substituteVariables(value interface{}, vars map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case variableRef:
+		return vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = substituteVariables(item, vars)
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			object[name] = substituteVariables(field, vars)
+		}
+		return object
+	}
+	return value
+}
@@ -0,0 +1,243 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// fakeNotes is a mutation field that stores the arguments it gets, keyed
+// by their id, standing in for the mutations the schema will have
+type fakeNotes struct {
+	saved map[string]map[string]interface{}
+	calls []string
+}
+
+func (f *fakeNotes) addNote(_ context.Context, args map[string]interface{}) (interface{}, error) {
+	id, _ := args["id"].(string)
+	f.calls = append(f.calls, id)
+	if id == "" {
+		return nil, errors.New("id is required")
+	}
+	f.saved[id] = args
+	return map[string]interface{}{"id": id}, nil
+}
+
+func newMutationApp(admin config.AdminConfig) (*fiber.App, *fakeNotes) {
+	notes := &fakeNotes{saved: make(map[string]map[string]interface{})}
+
+	r := NewResolver(config.GraphQLConfig{}, config.DistributionConfig{}, config.ListingConfig{}, admin, nil, nil, nil, nil)
+	r.mutations = map[string]mutationField{"addNote": notes.addNote}
+
+	app := fiber.New()
+	app.Post("/graphql", r.Handle)
+	return app, notes
+}
+
+// postMutation sends a request, with the admin key if one is given
+func postMutation(t *testing.T, app *fiber.App, key string, gqlReq GraphQLRequest) GraphQLResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(gqlReq)
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(middleware.AdminKeyHeader, key)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	// Failures are GraphQL errors, never HTTP errors
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var out GraphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return out
+}
+
+// errorCode returns the extension code of the only error of a response
+func errorCode(t *testing.T, resp GraphQLResponse) string {
+	t.Helper()
+
+	if len(resp.Errors) != 1 {
+		t.Fatalf("Expected one error, got %+v", resp.Errors)
+	}
+	code, _ := resp.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+func TestMutation_Arguments(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		vars  map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{
+			name:  "literals",
+			query: `mutation { addNote(id: "n-1", text: "say \"hi\"", rating: 4.5, pinned: true, kind: WARNING, tags: ["a", "b"], meta: {source: null}) }`,
+			want: map[string]interface{}{
+				"id": "n-1", "text": `say "hi"`, "rating": 4.5, "pinned": true, "kind": "WARNING",
+				"tags": []interface{}{"a", "b"}, "meta": map[string]interface{}{"source": nil},
+			},
+		},
+		{
+			name:  "block string",
+			query: "mutation { addNote(id: \"n-1\", text: \"\"\"\n    First\n      indented\n    \"\"\") }",
+			want:  map[string]interface{}{"id": "n-1", "text": "First\n  indented"},
+		},
+		{
+			name:  "variables",
+			query: `mutation Add($id: ID!, $meta: NoteMeta) { addNote(id: $id, meta: $meta) }`,
+			vars:  map[string]interface{}{"id": "n-1", "meta": map[string]interface{}{"source": "api"}},
+			want:  map[string]interface{}{"id": "n-1", "meta": map[string]interface{}{"source": "api"}},
+		},
+		{
+			name:  "variables inside literals",
+			query: `mutation($tag: String) { addNote(id: "n-1", tags: ["fixed", $tag], meta: {source: $tag}) }`,
+			vars:  map[string]interface{}{"tag": "var"},
+			want:  map[string]interface{}{"id": "n-1", "tags": []interface{}{"fixed", "var"}, "meta": map[string]interface{}{"source": "var"}},
+		},
+		{
+			name:  "variable defaults",
+			query: `mutation($id: ID = "n-1", $rating: Float = 3) { addNote(id: $id, rating: $rating) }`,
+			vars:  map[string]interface{}{"rating": 5.0},
+			want:  map[string]interface{}{"id": "n-1", "rating": 5.0},
+		},
+		{
+			name:  "unset variable",
+			query: `mutation($text: String) { addNote(id: "n-1", text: $text) }`,
+			want:  map[string]interface{}{"id": "n-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, notes := newMutationApp(config.AdminConfig{APIKey: "secret"})
+
+			resp := postMutation(t, app, "secret", GraphQLRequest{Query: tt.query, Variables: tt.vars})
+			if len(resp.Errors) > 0 {
+				t.Fatalf("Unexpected errors: %+v", resp.Errors)
+			}
+			if got := notes.saved["n-1"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected arguments %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMutation_Authorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		admin    config.AdminConfig
+		key      string
+		wantCode string
+	}{
+		{"missing key", config.AdminConfig{APIKey: "secret"}, "", CodeUnauthorized},
+		{"wrong key", config.AdminConfig{APIKey: "secret"}, "guess", CodeUnauthorized},
+		{"admin API disabled", config.AdminConfig{}, "secret", CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, notes := newMutationApp(tt.admin)
+
+			resp := postMutation(t, app, tt.key, GraphQLRequest{Query: `mutation { added: addNote(id: "n-1") }`})
+			if code := errorCode(t, resp); code != tt.wantCode {
+				t.Errorf("Expected code %s, got %q", tt.wantCode, code)
+			}
+			if path := resp.Errors[0].Path; len(path) != 1 || path[0] != "added" {
+				t.Errorf("Expected the error on the aliased field, got path %v", path)
+			}
+			if len(notes.calls) > 0 {
+				t.Errorf("Expected nothing persisted, got %v", notes.calls)
+			}
+		})
+	}
+}
+
+func TestMutation_RunsFieldsInOrder(t *testing.T) {
+	app, notes := newMutationApp(config.AdminConfig{APIKey: "secret"})
+
+	query := `
+# addNote(id: "comment") is not a field
+mutation {
+  first: addNote(id: "1", text: "addNote(id: \"string\")")
+  ...More
+  missing: addNote(text: "no id")
+  addNote(id: "3")
+}
+
+fragment More on Mutation {
+  second: addNote(id: "2")
+  first: addNote(id: "1")
+}`
+	resp := postMutation(t, app, "secret", GraphQLRequest{Query: query})
+
+	if want := []string{"1", "2", "", "3"}; !reflect.DeepEqual(notes.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, notes.calls)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Path[0] != "missing" {
+		t.Errorf("Expected the error on missing only, got %+v", resp.Errors)
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	for _, key := range []string{"first", "second", "addNote"} {
+		if data[key] == nil {
+			t.Errorf("Expected %s in the data, got %v", key, data)
+		}
+	}
+	if value, ok := data["missing"]; !ok || value != nil {
+		t.Errorf("Expected missing to be null, got %v", data)
+	}
+}
+
+func TestMutation_OperationSelection(t *testing.T) {
+	const document = `query Status { health { status } } mutation Add { addNote(id: "n-1") }`
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		wantErr       string
+		wantCalls     int
+	}{
+		{"named mutation", document, "Add", "", 1},
+		{"several operations without a name", document, "", "operationName is required", 0},
+		{"unknown operation", document, "Remove", `Unknown operation "Remove"`, 0},
+		{"unknown field", `mutation { removeNote(id: "n-1") addNote(id: "n-1") }`, "", `Cannot query field "removeNote"`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, notes := newMutationApp(config.AdminConfig{APIKey: "secret"})
+
+			resp := postMutation(t, app, "secret", GraphQLRequest{Query: tt.query, OperationName: tt.operationName})
+			if tt.wantErr == "" && len(resp.Errors) > 0 {
+				t.Errorf("Unexpected errors: %+v", resp.Errors)
+			}
+			if tt.wantErr != "" && (len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, tt.wantErr)) {
+				t.Errorf("Expected error %q, got %+v", tt.wantErr, resp.Errors)
+			}
+			if len(notes.calls) != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %v", tt.wantCalls, notes.calls)
+			}
+		})
+	}
+}
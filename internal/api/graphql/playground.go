@@ -133,6 +133,27 @@ query ListOpportunities($filter: OpportunityFilter) {
               }
             }, null, 2)
           },
+          {
+            name: 'Best Per Chain',
+            endpoint: '/graphql',
+            query: ` + "`" + `# Get the top opportunity of each chain
+query BestOpportunitiesPerChain($limit: Int) {
+  bestOpportunitiesPerChain(limit: $limit) {
+    id
+    type
+    title
+    chain
+    asset
+    currentApy
+    potentialProfit
+    riskLevel
+    score
+  }
+}` + "`" + `,
+            variables: JSON.stringify({
+              limit: 10
+            }, null, 2)
+          },
           {
             name: 'Trending Pools',
             endpoint: '/graphql',
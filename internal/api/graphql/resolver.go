@@ -6,35 +6,55 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
+	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/rewards"
 )
 
 // Resolver handles GraphQL query resolution
 type Resolver struct {
-	pg        *postgres.Repository
-	redis     *redis.Repository
-	es        *elasticsearch.Repository
-	startTime time.Time
+	config       config.GraphQLConfig
+	distribution config.DistributionConfig
+	listing      config.ListingConfig
+	admin        config.AdminConfig
+	pg           *postgres.Repository
+	redis        *redis.Repository
+	es           *elasticsearch.Repository
+	rewards      *rewards.Service
+	mutations    map[string]mutationField // By field name
+	startTime    time.Time
 }
 
-// NewResolver creates a new GraphQL resolver
-func NewResolver(pg *postgres.Repository, redis *redis.Repository, es *elasticsearch.Repository) *Resolver {
+// NewResolver creates a new GraphQL resolver. Mutations are authorized by
+// the admin key. The schema has no mutation fields yet: the watchlist and
+// alert rule mutations follow their REST resources.
+func NewResolver(cfg config.GraphQLConfig, distribution config.DistributionConfig, listing config.ListingConfig, admin config.AdminConfig, pg *postgres.Repository, redis *redis.Repository, es *elasticsearch.Repository, rewardsService *rewards.Service) *Resolver {
 	return &Resolver{
-		pg:        pg,
-		redis:     redis,
-		es:        es,
-		startTime: time.Now(),
+		config:       cfg,
+		distribution: distribution,
+		listing:      listing,
+		admin:        admin,
+		pg:           pg,
+		redis:        redis,
+		es:           es,
+		rewards:      rewardsService,
+		mutations:    map[string]mutationField{},
+		startTime:    time.Now(),
 	}
 }
 
@@ -51,9 +71,10 @@ type GraphQLResponse struct {
 }
 
 type GraphQLError struct {
-	Message   string        `json:"message"`
-	Locations []Location    `json:"locations,omitempty"`
-	Path      []interface{} `json:"path,omitempty"`
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"` // code: UNAUTHORIZED, FORBIDDEN, ...
 }
 
 type Location struct {
@@ -72,8 +93,23 @@ func (r *Resolver) Handle(c *fiber.Ctx) error {
 		})
 	}
 
-	ctx := c.Context()
-	data, errors := r.executeQuery(ctx, req)
+	doc, op, err := parseOperation(req.Query, req.OperationName)
+	if err != nil {
+		return c.JSON(GraphQLResponse{
+			Errors: []GraphQLError{{Message: err.Error()}},
+		})
+	}
+
+	// Mutations are authorized by the admin key, as the admin REST API
+	ctx := withAdmin(c.Context(), middleware.IsAdminRequest(c, r.admin))
+
+	var data interface{}
+	var errors []GraphQLError
+	if op.kind == "mutation" {
+		data, errors = r.executeMutation(ctx, req, doc, op)
+	} else {
+		data, errors = r.executeQuery(ctx, req)
+	}
 
 	response := GraphQLResponse{
 		Data:   data,
@@ -83,97 +119,166 @@ func (r *Resolver) Handle(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+// HandleGet executes a read-only query passed in the query string
+// (?query=...&variables=...&operationName=...). Without a query parameter it
+// serves the Playground when enabled.
+func (r *Resolver) HandleGet(c *fiber.Ctx) error {
+	query := c.Query("query")
+	if query == "" {
+		if !r.config.Playground {
+			return c.Status(fiber.StatusNotFound).JSON(GraphQLResponse{
+				Errors: []GraphQLError{{Message: "Missing query parameter"}},
+			})
+		}
+		return Playground(c)
+	}
+
+	_, op, err := parseOperation(query, c.Query("operationName"))
+	if err != nil {
+		return c.JSON(GraphQLResponse{
+			Errors: []GraphQLError{{Message: err.Error()}},
+		})
+	}
+
+	// Mutations change state and must not be cacheable or prefetchable
+	if op.kind == "mutation" {
+		c.Set(fiber.HeaderAllow, fiber.MethodPost)
+		return c.Status(fiber.StatusMethodNotAllowed).JSON(GraphQLResponse{
+			Errors: []GraphQLError{{Message: "Mutations must be sent with POST"}},
+		})
+	}
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: c.Query("operationName"),
+	}
+	if variables := c.Query("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(GraphQLResponse{
+				Errors: []GraphQLError{{Message: "Invalid variables: must be a JSON object"}},
+			})
+		}
+	}
+
+	data, errors := r.executeQuery(c.Context(), req)
+
+	// Only let caches keep successful responses
+	if len(errors) == 0 && r.config.GetCacheControl != "" {
+		c.Set(fiber.HeaderCacheControl, r.config.GetCacheControl)
+	}
+
+	return c.JSON(GraphQLResponse{
+		Data:   data,
+		Errors: errors,
+	})
+}
+
 // executeQuery parses and executes GraphQL queries
 // This is a simplified query executor - supports common operations
 func (r *Resolver) executeQuery(ctx context.Context, req GraphQLRequest) (interface{}, []GraphQLError) {
 	// For a full implementation, use gqlgen or graphql-go library
 	// This simplified version handles common query patterns
 
-	data := make(map[string]interface{})
-	var errors []GraphQLError
+	// Reject queries too deep or costly before resolving anything
+	if err := r.checkQueryLimits(req.Query); err != nil {
+		return nil, []GraphQLError{*err}
+	}
+	formats, err := parseValueFormats(req.Query, req.Variables)
+	if err != nil {
+		return nil, []GraphQLError{{Message: err.Error()}}
+	}
+
+	var fields []topLevelField
 
 	// Parse the query to determine what's being requested
 	// This is a simplified parser - production should use proper GraphQL parsing
 
 	if containsQuery(req.Query, "pools") && !containsQuery(req.Query, "trendingPools") {
-		pools, err := r.resolvePools(ctx, req.Variables)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["pools"] = pools
-		}
+		fields = append(fields, topLevelField{"pools", func(ctx context.Context) (interface{}, error) {
+			return r.resolvePools(ctx, req.Variables, formats)
+		}})
 	}
 
 	if containsQuery(req.Query, "pool(") {
-		pool, err := r.resolvePool(ctx, req.Variables)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["pool"] = pool
-		}
+		withRewards := containsQuery(req.Query, "rewards")
+		fields = append(fields, topLevelField{"pool", func(ctx context.Context) (interface{}, error) {
+			return r.resolvePool(ctx, req.Variables, withRewards, formats)
+		}})
+	}
+
+	if containsQuery(req.Query, "poolOpportunities") {
+		fields = append(fields, topLevelField{"poolOpportunities", func(ctx context.Context) (interface{}, error) {
+			return r.resolvePoolOpportunities(ctx, req.Variables)
+		}})
 	}
 
 	if containsQuery(req.Query, "opportunities") && !containsQuery(req.Query, "activeOpportunities") {
-		opps, err := r.resolveOpportunities(ctx, req.Variables)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["opportunities"] = opps
-		}
+		fields = append(fields, topLevelField{"opportunities", func(ctx context.Context) (interface{}, error) {
+			return r.resolveOpportunities(ctx, req.Variables)
+		}})
+	}
+
+	if containsQuery(req.Query, "bestOpportunitiesPerChain") {
+		fields = append(fields, topLevelField{"bestOpportunitiesPerChain", func(ctx context.Context) (interface{}, error) {
+			return r.resolveBestOpportunitiesPerChain(ctx, req.Variables)
+		}})
 	}
 
 	if containsQuery(req.Query, "trendingPools") {
-		trending, err := r.resolveTrendingPools(ctx, req.Variables)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["trendingPools"] = trending
-		}
+		fields = append(fields, topLevelField{"trendingPools", func(ctx context.Context) (interface{}, error) {
+			return r.resolveTrendingPools(ctx, req.Variables, formats)
+		}})
 	}
 
 	if containsQuery(req.Query, "chains") {
-		chains, err := r.resolveChains(ctx)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["chains"] = chains
-		}
+		fields = append(fields, topLevelField{"chains", r.resolveChains})
 	}
 
 	if containsQuery(req.Query, "protocols") {
-		protocols, err := r.resolveProtocols(ctx, req.Variables)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["protocols"] = protocols
-		}
+		fields = append(fields, topLevelField{"protocols", func(ctx context.Context) (interface{}, error) {
+			return r.resolveProtocols(ctx, req.Variables)
+		}})
 	}
 
 	if containsQuery(req.Query, "stats") {
-		stats, err := r.resolveStats(ctx)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["stats"] = stats
-		}
+		fields = append(fields, topLevelField{"stats", func(ctx context.Context) (interface{}, error) {
+			return r.resolveStats(ctx, req.Variables)
+		}})
+	}
+
+	if containsQuery(req.Query, "indices") {
+		fields = append(fields, topLevelField{"indices", r.resolveIndices})
+	}
+
+	if containsQuery(req.Query, "indexHistory") {
+		fields = append(fields, topLevelField{"indexHistory", func(ctx context.Context) (interface{}, error) {
+			return r.resolveIndexHistory(ctx, req.Variables)
+		}})
+	}
+
+	if containsQuery(req.Query, "poolTags") {
+		fields = append(fields, topLevelField{"poolTags", r.resolvePoolTags})
+	}
+
+	if containsQuery(req.Query, "poolDistribution") {
+		fields = append(fields, topLevelField{"poolDistribution", r.resolvePoolDistribution})
 	}
 
 	if containsQuery(req.Query, "health") {
-		health, err := r.resolveHealth(ctx)
-		if err != nil {
-			errors = append(errors, GraphQLError{Message: err.Error()})
-		} else {
-			data["health"] = health
-		}
+		fields = append(fields, topLevelField{"health", r.resolveHealth})
 	}
 
-	return data, errors
+	return r.resolveFields(ctx, fields)
 }
 
 // Pool resolvers
 
-func (r *Resolver) resolvePools(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
-	filter := parsePoolFilterFromVars(vars)
+func (r *Resolver) resolvePools(ctx context.Context, vars map[string]interface{}, formats valueFormats) (interface{}, error) {
+	filter, err := parsePoolFilterFromVars(vars)
+	if err != nil {
+		return nil, err
+	}
+	filter.TVLFloor = r.listingFloor(filter.IncludeEmpty)
 
 	pools, total, err := r.pg.ListPools(ctx, filter)
 	if err != nil {
@@ -183,7 +288,7 @@ func (r *Resolver) resolvePools(ctx context.Context, vars map[string]interface{}
 	edges := make([]map[string]interface{}, len(pools))
 	for i, pool := range pools {
 		edges[i] = map[string]interface{}{
-			"node":   poolToGraphQL(pool),
+			"node":   poolToGraphQL(pool, formats),
 			"cursor": encodeCursor(filter.Offset + i),
 		}
 	}
@@ -200,7 +305,9 @@ func (r *Resolver) resolvePools(ctx context.Context, vars map[string]interface{}
 	}, nil
 }
 
-func (r *Resolver) resolvePool(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+// resolvePool resolves a single pool; the rewards field is only resolved
+// when requested since it may need CoinGecko lookups
+func (r *Resolver) resolvePool(ctx context.Context, vars map[string]interface{}, withRewards bool, formats valueFormats) (interface{}, error) {
 	id, ok := vars["id"].(string)
 	if !ok {
 		return nil, fmt.Errorf("pool id is required")
@@ -211,13 +318,29 @@ func (r *Resolver) resolvePool(ctx context.Context, vars map[string]interface{})
 		return nil, err
 	}
 
-	return poolToGraphQL(*pool), nil
+	result := poolToGraphQL(*pool, formats)
+	if withRewards && r.rewards != nil {
+		result["rewards"] = poolRewardsToGraphQL(r.rewards.PoolRewards(ctx, pool))
+	}
+	return result, nil
+}
+
+// listingFloor returns the TVL below which pools are left out of listings
+// and stats, as in the REST API
+func (r *Resolver) listingFloor(includeEmpty bool) decimal.Decimal {
+	if includeEmpty {
+		return decimal.Zero
+	}
+	return decimal.NewFromFloat(r.listing.MinTVL)
 }
 
 // Opportunity resolvers
 
 func (r *Resolver) resolveOpportunities(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
-	filter := parseOpportunityFilterFromVars(vars)
+	filter, err := parseOpportunityFilterFromVars(vars)
+	if err != nil {
+		return nil, err
+	}
 
 	opps, total, err := r.pg.ListOpportunities(ctx, filter)
 	if err != nil {
@@ -232,17 +355,94 @@ func (r *Resolver) resolveOpportunities(ctx context.Context, vars map[string]int
 		}
 	}
 
-	return map[string]interface{}{
+	connection := map[string]interface{}{
 		"edges": edges,
 		"pageInfo": map[string]interface{}{
 			"hasNextPage":     int64(filter.Offset+len(opps)) < total,
 			"hasPreviousPage": filter.Offset > 0,
 		},
-		"totalCount": total,
+		"totalCount":     total,
+		"detectedAfter":  filter.DetectedAfter.Format(time.RFC3339),
+		"detectedBefore": nil,
+	}
+	if !filter.DetectedBefore.IsZero() {
+		connection["detectedBefore"] = filter.DetectedBefore.Format(time.RFC3339)
+	}
+	return connection, nil
+}
+
+func (r *Resolver) resolvePoolOpportunities(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	id, ok := vars["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("pool id is required")
+	}
+
+	// Shares the REST endpoint's cache entry
+	response, err := r.redis.GetPoolOpportunitiesCache(ctx, id)
+	if err != nil || response == nil {
+		exists, err := r.pg.PoolExists(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("pool not found")
+		}
+
+		opps, err := r.pg.GetPoolOpportunities(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		grouped := models.NewPoolOpportunitiesResponse(id, opps)
+		response = &grouped
+
+		if err := r.redis.SetPoolOpportunitiesCache(ctx, response, 60); err != nil {
+			log.Debug().Err(err).Msg("Failed to cache pool opportunities")
+		}
+	}
+
+	return map[string]interface{}{
+		"poolId":   response.PoolID,
+		"asSource": opportunitiesToGraphQL(response.AsSource),
+		"asTarget": opportunitiesToGraphQL(response.AsTarget),
+		"direct":   opportunitiesToGraphQL(response.Direct),
 	}, nil
 }
 
-func (r *Resolver) resolveTrendingPools(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+// Chain limits of bestOpportunitiesPerChain
+const (
+	defaultBestPerChainLimit = 20
+	maxBestPerChainLimit     = 100
+)
+
+// resolveBestOpportunitiesPerChain returns the highest-scoring active
+// opportunity of each chain, best first
+func (r *Resolver) resolveBestOpportunitiesPerChain(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	limit := bestPerChainLimit(vars)
+
+	opps, err := r.redis.GetBestOpportunitiesCache(ctx, limit)
+	if err != nil || opps == nil {
+		opps, err = r.pg.GetBestOpportunitiesPerChain(ctx, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		// Cache for 30 seconds
+		if err := r.redis.SetBestOpportunitiesCache(ctx, limit, opps, 30); err != nil {
+			log.Debug().Err(err).Msg("Failed to cache best opportunities per chain")
+		}
+	}
+
+	return opportunitiesToGraphQL(opps), nil
+}
+
+// bestPerChainLimit reads the chain limit of bestOpportunitiesPerChain,
+// capped at maxBestPerChainLimit
+func bestPerChainLimit(vars map[string]interface{}) int {
+	l, _ := vars["limit"].(float64)
+	return models.ClampLimit(int(l), defaultBestPerChainLimit, maxBestPerChainLimit)
+}
+
+func (r *Resolver) resolveTrendingPools(ctx context.Context, vars map[string]interface{}, formats valueFormats) (interface{}, error) {
 	chain := ""
 	if c, ok := vars["chain"].(string); ok {
 		chain = c
@@ -253,9 +453,9 @@ func (r *Resolver) resolveTrendingPools(ctx context.Context, vars map[string]int
 		minGrowth = decimal.NewFromFloat(mg)
 	}
 
-	limit := 20
+	limit := models.DefaultTrendingLimit
 	if l, ok := vars["limit"].(float64); ok {
-		limit = int(l)
+		limit = models.ClampLimit(int(l), models.DefaultTrendingLimit, models.MaxTrendingLimit)
 	}
 
 	trending, err := r.pg.GetTrendingPools(ctx, chain, minGrowth, limit, 0)
@@ -266,7 +466,7 @@ func (r *Resolver) resolveTrendingPools(ctx context.Context, vars map[string]int
 	result := make([]map[string]interface{}, len(trending))
 	for i, tp := range trending {
 		result[i] = map[string]interface{}{
-			"pool":         poolToGraphQL(*tp.Pool),
+			"pool":         poolToGraphQL(*tp.Pool, formats),
 			"apyGrowth1h":  tp.APYGrowth1H.String(),
 			"apyGrowth24h": tp.APYGrowth24H.String(),
 			"apyGrowth7d":  tp.APYGrowth7D.String(),
@@ -280,31 +480,37 @@ func (r *Resolver) resolveTrendingPools(ctx context.Context, vars map[string]int
 // Stats resolvers
 
 func (r *Resolver) resolveChains(ctx context.Context) (interface{}, error) {
-	chains, err := r.pg.ListChains(ctx)
+	chains, _, err := r.pg.ListChains(ctx, models.ChainFilter{Limit: models.MaxPageLimit, TVLFloor: r.listingFloor(false)})
 	if err != nil {
 		return nil, err
 	}
 
 	result := make([]map[string]interface{}, len(chains))
 	for i, c := range chains {
-		result[i] = map[string]interface{}{
+		chain := map[string]interface{}{
 			"name":        c.Name,
 			"displayName": c.DisplayName,
 			"poolCount":   c.PoolCount,
 			"totalTvl":    c.TotalTVL.String(),
 			"averageApy":  c.AverageAPY.String(),
+			"weightedApy": c.WeightedAPY.String(),
 			"maxApy":      c.MaxAPY.String(),
 		}
+		if c.APYTrend != nil {
+			chain["apyTrend"] = map[string]interface{}{
+				"direction": c.APYTrend.Direction,
+				"change":    c.APYTrend.Change.String(),
+			}
+		}
+		result[i] = chain
 	}
 
 	return result, nil
 }
 
 func (r *Resolver) resolveProtocols(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
-	filter := models.ProtocolFilter{
-		Limit:  50,
-		Offset: 0,
-	}
+	filter := models.ProtocolFilter{TVLFloor: r.listingFloor(false)}
+	filter.Limit, filter.Offset = paginationFromVars(vars)
 
 	if chain, ok := vars["chain"].(string); ok {
 		filter.Chain = chain
@@ -327,7 +533,7 @@ func (r *Resolver) resolveProtocols(ctx context.Context, vars map[string]interfa
 				"averageApy":  p.AverageAPY.String(),
 				"maxApy":      p.MaxAPY.String(),
 			},
-			"cursor": encodeCursor(i),
+			"cursor": encodeCursor(filter.Offset + i),
 		}
 	}
 
@@ -337,8 +543,9 @@ func (r *Resolver) resolveProtocols(ctx context.Context, vars map[string]interfa
 	}, nil
 }
 
-func (r *Resolver) resolveStats(ctx context.Context) (interface{}, error) {
-	stats, err := r.pg.GetPlatformStats(ctx)
+func (r *Resolver) resolveStats(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	includeEmpty, _ := vars["includeEmpty"].(bool)
+	stats, err := r.pg.GetPlatformStats(ctx, r.listingFloor(includeEmpty))
 	if err != nil {
 		return nil, err
 	}
@@ -385,6 +592,171 @@ func (r *Resolver) resolveStats(ctx context.Context) (interface{}, error) {
 	}, nil
 }
 
+func (r *Resolver) resolveIndices(ctx context.Context) (interface{}, error) {
+	indices, err := r.pg.ListAPYIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, len(indices))
+	for i, idx := range indices {
+		result[i] = indexToGraphQL(idx)
+	}
+
+	return result, nil
+}
+
+// Day limits of indexHistory, as for the REST endpoint
+const (
+	defaultIndexHistoryDays = 30
+	maxIndexHistoryDays     = 365
+)
+
+func (r *Resolver) resolveIndexHistory(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	name, days, err := indexHistoryFromVars(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.pg.GetAPYIndex(ctx, name); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("index %s not found", name)
+		}
+		return nil, err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	history, err := r.pg.GetAPYIndexHistory(ctx, name, today.AddDate(0, 0, 1-days))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, len(history))
+	for i, v := range history {
+		result[i] = indexValueToGraphQL(v)
+	}
+
+	return result, nil
+}
+
+// indexHistoryFromVars reads the index name and the number of days of
+// indexHistory
+func indexHistoryFromVars(vars map[string]interface{}) (string, int, error) {
+	name, _ := vars["name"].(string)
+	if name == "" {
+		return "", 0, fmt.Errorf("name is required")
+	}
+
+	days := defaultIndexHistoryDays
+	if d, ok := vars["days"].(float64); ok {
+		days = int(d)
+		if d != float64(days) || days < 1 || days > maxIndexHistoryDays {
+			return "", 0, fmt.Errorf("days must be an integer between 1 and %d", maxIndexHistoryDays)
+		}
+	}
+
+	return name, days, nil
+}
+
+func indexToGraphQL(idx models.APYIndex) map[string]interface{} {
+	result := map[string]interface{}{
+		"name":        idx.Name,
+		"description": nilIfEmpty(idx.Description),
+		"chain":       nilIfEmpty(idx.Chain),
+		"protocol":    nilIfEmpty(idx.Protocol),
+		"stablecoin":  idx.StableCoin,
+		"asset":       nilIfEmpty(idx.Asset),
+		"latest":      nil,
+		"createdAt":   idx.CreatedAt,
+		"updatedAt":   idx.UpdatedAt,
+	}
+	if idx.Latest != nil {
+		result["latest"] = indexValueToGraphQL(*idx.Latest)
+	}
+	return result
+}
+
+func indexValueToGraphQL(v models.APYIndexValue) map[string]interface{} {
+	return map[string]interface{}{
+		"day":          v.Day,
+		"apy":          v.APY.String(),
+		"tvl":          v.TVL.String(),
+		"constituents": v.Constituents,
+	}
+}
+
+// nilIfEmpty maps an unset optional string to null
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// tagsOrEmpty maps an untagged pool's tags to an empty list, as the field
+// is non-null
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// tagsCacheTTL is how long the tag listing stays cached, as for the REST
+// endpoint (seconds)
+const tagsCacheTTL = 300
+
+func (r *Resolver) resolvePoolTags(ctx context.Context) (interface{}, error) {
+	// Shares the REST endpoint's cache entry
+	response, err := r.redis.GetTagsCache(ctx)
+	if err != nil || response == nil {
+		tags, err := r.pg.ListTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response = &models.TagListResponse{Data: tags, Total: len(tags)}
+		_ = r.redis.SetTagsCache(ctx, response, tagsCacheTTL)
+	}
+
+	result := make([]map[string]interface{}, len(response.Data))
+	for i, t := range response.Data {
+		result[i] = map[string]interface{}{
+			"tag":       t.Tag,
+			"poolCount": t.PoolCount,
+			"totalTvl":  t.TotalTVL.String(),
+		}
+	}
+	return result, nil
+}
+
+func (r *Resolver) resolvePoolDistribution(ctx context.Context) (interface{}, error) {
+	// Shares the REST endpoint's cache entry
+	dist, err := r.redis.GetDistributionCache(ctx, false)
+	if err != nil || dist == nil {
+		dist, err = r.pg.GetPoolDistribution(ctx, r.distribution.ScoreBuckets, r.distribution.TVLBuckets, r.listingFloor(false))
+		if err != nil {
+			return nil, err
+		}
+		_ = r.redis.SetDistributionCache(ctx, false, dist, int(r.distribution.CacheTTL.Seconds()))
+	}
+
+	byChain := make([]map[string]interface{}, 0, len(dist.ByChain))
+	for chain, count := range dist.ByChain {
+		byChain = append(byChain, map[string]interface{}{
+			"chain": chain,
+			"count": count,
+		})
+	}
+
+	return map[string]interface{}{
+		"totalPools":  dist.TotalPools,
+		"byScore":     distributionBuckets(dist.ByScore),
+		"byTvl":       distributionBuckets(dist.ByTVL),
+		"byChain":     byChain,
+		"lastUpdated": dist.LastUpdated,
+	}, nil
+}
+
 func (r *Resolver) resolveHealth(ctx context.Context) (interface{}, error) {
 	health := map[string]interface{}{
 		"status":    "HEALTHY",
@@ -435,6 +807,19 @@ func (r *Resolver) resolveHealth(ctx context.Context) (interface{}, error) {
 
 // Helper functions
 
+func distributionBuckets(buckets []models.DistributionBucket) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(buckets))
+	for i, b := range buckets {
+		result[i] = map[string]interface{}{
+			"label": b.Label,
+			"min":   b.Min,
+			"max":   b.Max,
+			"count": b.Count,
+		}
+	}
+	return result
+}
+
 func containsQuery(query, field string) bool {
 	return len(query) > 0 && (contains(query, field) || contains(query, "{"+field))
 }
@@ -452,12 +837,13 @@ func findSubstring(s, substr string) bool {
 	return false
 }
 
-func parsePoolFilterFromVars(vars map[string]interface{}) models.PoolFilter {
+// parsePoolFilterFromVars reads a PoolFilter input with the validation and
+// defaults of the REST API
+func parsePoolFilterFromVars(vars map[string]interface{}) (models.PoolFilter, error) {
 	filter := models.PoolFilter{
-		Limit:     50,
-		Offset:    0,
 		SortBy:    "tvl",
 		SortOrder: "desc",
+		RankMode:  models.RankModeStandard,
 	}
 
 	if filterVar, ok := vars["filter"].(map[string]interface{}); ok {
@@ -470,36 +856,166 @@ func parsePoolFilterFromVars(vars map[string]interface{}) models.PoolFilter {
 		if symbol, ok := filterVar["symbol"].(string); ok {
 			filter.Symbol = symbol
 		}
-		if minApy, ok := filterVar["minApy"].(float64); ok {
-			filter.MinAPY = decimal.NewFromFloat(minApy)
-		}
-		if maxApy, ok := filterVar["maxApy"].(float64); ok {
-			filter.MaxAPY = decimal.NewFromFloat(maxApy)
+		for field, dst := range map[string]*decimal.Decimal{
+			"minApy":            &filter.MinAPY,
+			"maxApy":            &filter.MaxAPY,
+			"minTvl":            &filter.MinTVL,
+			"maxTvl":            &filter.MaxTVL,
+			"minVolume1d":       &filter.MinVolume1D,
+			"minVolumeTvlRatio": &filter.MinVolumeTVLRatio,
+		} {
+			if v, ok := filterVar[field].(float64); ok {
+				if v < 0 {
+					return filter, fmt.Errorf("%s must be non-negative", field)
+				}
+				*dst = decimal.NewFromFloat(v)
+			}
 		}
-		if minTvl, ok := filterVar["minTvl"].(float64); ok {
-			filter.MinTVL = decimal.NewFromFloat(minTvl)
+		if minScore, ok := filterVar["minScore"].(float64); ok {
+			if minScore < 0 || minScore > 100 {
+				return filter, fmt.Errorf("minScore must be between 0 and 100")
+			}
+			filter.MinScore = decimal.NewFromFloat(minScore)
 		}
 		if stablecoin, ok := filterVar["stablecoin"].(bool); ok {
 			filter.StableCoin = &stablecoin
 		}
+		if search, ok := filterVar["search"].(string); ok {
+			filter.Search = search
+		}
+		if exact, ok := filterVar["exact"].(bool); ok {
+			filter.Exact = exact
+		}
+		if includeOutliers, ok := filterVar["includeOutliers"].(bool); ok {
+			filter.IncludeOutliers = includeOutliers
+		}
+		if includeEmpty, ok := filterVar["includeEmpty"].(bool); ok {
+			filter.IncludeEmpty = includeEmpty
+		}
+		if tags, ok := filterVar["tags"].([]interface{}); ok && len(tags) > 0 {
+			list := make([]string, len(tags))
+			for i, tag := range tags {
+				s, ok := tag.(string)
+				if !ok {
+					return filter, fmt.Errorf("tags must be strings")
+				}
+				list[i] = s
+			}
+			normalized, err := models.NormalizeTags(list)
+			if err != nil {
+				return filter, err
+			}
+			filter.Tags = normalized
+		}
+		if dataSource, ok := filterVar["dataSource"].(string); ok {
+			filter.DataSource = strings.ToLower(dataSource)
+			if filter.DataSource != models.DataSourceDeFiLlama && filter.DataSource != models.DataSourceManual {
+				return filter, fmt.Errorf("dataSource must be DEFILLAMA or MANUAL")
+			}
+		}
+		if rankMode, ok := filterVar["rankMode"].(string); ok {
+			filter.RankMode = strings.ToLower(rankMode)
+			if filter.RankMode != models.RankModeStandard && filter.RankMode != models.RankModeDecayed {
+				return filter, fmt.Errorf("rankMode must be STANDARD or DECAYED")
+			}
+		}
+
+		keys, err := parsePoolSortFromVars(filterVar)
+		if err != nil {
+			return filter, err
+		}
+		if len(keys) > 0 {
+			filter.Sort = keys
+			filter.SortBy = keys[0].Field
+			filter.SortOrder = keys[0].Order
+		}
+	}
+
+	// Symbol and text searches rank the best matches first unless a sort is
+	// given
+	if len(filter.Sort) == 0 && filter.MatchQuery() != "" {
+		filter.Sort = []models.SortKey{{Field: models.SortRelevance, Order: "desc"}, {Field: "tvl", Order: "desc"}}
+		filter.SortBy = models.SortRelevance
+	}
+
+	if filter.RankMode == models.RankModeDecayed && filter.SortBy != "score" {
+		return filter, fmt.Errorf("decayed ranking requires SCORE as the first sort key")
+	}
+
+	if !filter.MinAPY.IsZero() && !filter.MaxAPY.IsZero() && filter.MinAPY.GreaterThan(filter.MaxAPY) {
+		return filter, fmt.Errorf("minApy cannot be greater than maxApy")
+	}
+	if !filter.MinTVL.IsZero() && !filter.MaxTVL.IsZero() && filter.MinTVL.GreaterThan(filter.MaxTVL) {
+		return filter, fmt.Errorf("minTvl cannot be greater than maxTvl")
 	}
 
+	filter.Limit, filter.Offset = paginationFromVars(vars)
+	if filter.Offset > models.MaxPageOffset {
+		return filter, fmt.Errorf("offset exceeds maximum value %d", models.MaxPageOffset)
+	}
+
+	return filter, nil
+}
+
+// paginationFromVars reads limit and offset from a PaginationInput with
+// the REST defaults and caps
+func paginationFromVars(vars map[string]interface{}) (int, int) {
+	limit, offset := models.DefaultPageLimit, 0
 	if paginationVar, ok := vars["pagination"].(map[string]interface{}); ok {
-		if limit, ok := paginationVar["limit"].(float64); ok {
-			filter.Limit = int(limit)
+		if l, ok := paginationVar["limit"].(float64); ok {
+			limit = models.ClampLimit(int(l), models.DefaultPageLimit, models.MaxPageLimit)
+		}
+		if o, ok := paginationVar["offset"].(float64); ok && o > 0 {
+			offset = int(o)
+		}
+	}
+	return limit, offset
+}
+
+// parsePoolSortFromVars reads the sort keys from a PoolFilter input: the
+// sort list if given, otherwise sortBy and sortOrder. Returns nil when
+// neither is set.
+func parsePoolSortFromVars(filterVar map[string]interface{}) ([]models.SortKey, error) {
+	var spec []string
+
+	if sortVar, ok := filterVar["sort"].([]interface{}); ok && len(sortVar) > 0 {
+		for _, item := range sortVar {
+			key, _ := item.(map[string]interface{})
+			field, _ := key["field"].(string)
+			direction, _ := key["direction"].(string)
+			if direction == "" {
+				direction = "DESC"
+			}
+			spec = append(spec, field+":"+direction)
 		}
-		if offset, ok := paginationVar["offset"].(float64); ok {
-			filter.Offset = int(offset)
+	} else if sortBy, ok := filterVar["sortBy"].(string); ok {
+		direction, _ := filterVar["sortOrder"].(string)
+		if direction == "" {
+			direction = "DESC"
 		}
+		spec = append(spec, sortBy+":"+direction)
+	}
+
+	if len(spec) == 0 {
+		return nil, nil
 	}
+	return models.ParseSortSpec(strings.Join(spec, ","), "desc", models.PoolSortFields)
+}
 
-	return filter
+// opportunitySortFields are the OpportunitySortField values, as the REST
+// sortBy values they map to
+var opportunitySortFields = map[string]bool{
+	"score":       true,
+	"profit":      true,
+	"apy":         true,
+	"detected_at": true,
 }
 
-func parseOpportunityFilterFromVars(vars map[string]interface{}) models.OpportunityFilter {
+// parseOpportunityFilterFromVars reads an OpportunityFilter input with the
+// validation of the REST API. Enum values map to their REST spelling
+// (YIELD_GAP is yield-gap).
+func parseOpportunityFilterFromVars(vars map[string]interface{}) (models.OpportunityFilter, error) {
 	filter := models.OpportunityFilter{
-		Limit:      50,
-		Offset:     0,
 		ActiveOnly: true,
 		SortBy:     "score",
 		SortOrder:  "desc",
@@ -507,29 +1023,99 @@ func parseOpportunityFilterFromVars(vars map[string]interface{}) models.Opportun
 
 	if filterVar, ok := vars["filter"].(map[string]interface{}); ok {
 		if t, ok := filterVar["type"].(string); ok {
-			filter.Type = models.OpportunityType(t)
+			filter.Type = models.OpportunityType(strings.ReplaceAll(strings.ToLower(t), "_", "-"))
+			switch filter.Type {
+			case models.OpportunityTypeYieldGap, models.OpportunityTypeTrending, models.OpportunityTypeHighScore:
+			default:
+				return filter, fmt.Errorf("invalid opportunity type %q", t)
+			}
 		}
 		if risk, ok := filterVar["riskLevel"].(string); ok {
-			filter.RiskLevel = models.RiskLevel(risk)
+			filter.RiskLevel = models.RiskLevel(strings.ToLower(risk))
+			switch filter.RiskLevel {
+			case models.RiskLevelLow, models.RiskLevelMedium, models.RiskLevelHigh:
+			default:
+				return filter, fmt.Errorf("invalid risk level %q", risk)
+			}
 		}
 		if chain, ok := filterVar["chain"].(string); ok {
 			filter.Chain = chain
 		}
+		if asset, ok := filterVar["asset"].(string); ok {
+			filter.Asset = asset
+		}
+		if minProfit, ok := filterVar["minProfit"].(float64); ok {
+			if minProfit < 0 {
+				return filter, fmt.Errorf("minProfit must be non-negative")
+			}
+			filter.MinProfit = decimal.NewFromFloat(minProfit)
+		}
+		if minScore, ok := filterVar["minScore"].(float64); ok {
+			filter.MinScore = decimal.NewFromFloat(minScore)
+		}
+		if activeOnly, ok := filterVar["activeOnly"].(bool); ok {
+			filter.ActiveOnly = activeOnly
+		}
+		if sortBy, ok := filterVar["sortBy"].(string); ok {
+			filter.SortBy = strings.ToLower(sortBy)
+			if !opportunitySortFields[filter.SortBy] {
+				return filter, fmt.Errorf("invalid sort field %q", sortBy)
+			}
+		}
+		if sortOrder, ok := filterVar["sortOrder"].(string); ok {
+			filter.SortOrder = strings.ToLower(sortOrder)
+			if filter.SortOrder != "asc" && filter.SortOrder != "desc" {
+				return filter, fmt.Errorf("sortOrder must be ASC or DESC")
+			}
+		}
+		bounds := map[string]*time.Time{
+			"detectedAfter":  &filter.DetectedAfter,
+			"detectedBefore": &filter.DetectedBefore,
+		}
+		for _, field := range []string{"detectedAfter", "detectedBefore"} {
+			if value, ok := filterVar[field].(string); ok {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return filter, fmt.Errorf("%s must be an RFC 3339 time", field)
+				}
+				*bounds[field] = t.UTC()
+			}
+		}
+	}
+
+	filter.Limit, filter.Offset = paginationFromVars(vars)
+	if filter.Offset > models.MaxPageOffset {
+		return filter, fmt.Errorf("offset exceeds maximum value %d", models.MaxPageOffset)
+	}
+
+	// Without detectedAfter the bound follows from detectedBefore, so errors
+	// are reported on the bound given
+	afterGiven := !filter.DetectedAfter.IsZero()
+	if err := filter.BoundDetectedAt(time.Now()); err != nil {
+		field := "detectedBefore"
+		if err == models.ErrLookbackTooLong && afterGiven {
+			field = "detectedAfter"
+		}
+		return filter, fmt.Errorf("%s %v", field, err)
 	}
 
-	return filter
+	return filter, nil
 }
 
-func poolToGraphQL(pool models.Pool) map[string]interface{} {
+// poolToGraphQL converts a pool, formatting the fields the query asks to be
+// formatted for display
+func poolToGraphQL(pool models.Pool, formats valueFormats) map[string]interface{} {
+	pool.SetRelativeTimes()
 	return map[string]interface{}{
 		"id":               pool.ID,
 		"chain":            pool.Chain,
 		"protocol":         pool.Protocol,
 		"symbol":           pool.Symbol,
-		"tvl":              pool.TVL.String(),
-		"apy":              pool.APY.String(),
-		"apyBase":          pool.APYBase.String(),
-		"apyReward":        pool.APYReward.String(),
+		"tvl":              formats.decimal("tvl", pool.TVL),
+		"apy":              formats.decimal("apy", pool.APY),
+		"apyRaw":           pool.APYRaw.String(),
+		"apyBase":          formats.decimal("apyBase", pool.APYBase),
+		"apyReward":        formats.decimal("apyReward", pool.APYReward),
 		"rewardTokens":     pool.RewardTokens,
 		"underlyingTokens": pool.UnderlyingTokens,
 		"poolMeta":         pool.PoolMeta,
@@ -537,18 +1123,58 @@ func poolToGraphQL(pool models.Pool) map[string]interface{} {
 		"apyMean30d":       pool.APYMean30D.String(),
 		"volumeUsd1d":      pool.VolumeUSD1D.String(),
 		"volumeUsd7d":      pool.VolumeUSD7D.String(),
+		"volumeTvlRatio":   pool.VolumeTVLRatio.String(),
+		"baseRatio":        pool.BaseRatio.String(),
+		"dataCompleteness": pool.DataCompleteness.String(),
+		"isOutlier":        pool.IsOutlier,
 		"score":            pool.Score.String(),
 		"apyChange1h":      pool.APYChange1H.String(),
 		"apyChange24h":     pool.APYChange24H.String(),
 		"apyChange7d":      pool.APYChange7D.String(),
 		"stablecoin":       pool.StableCoin,
 		"exposure":         pool.Exposure,
+		"tags":             tagsOrEmpty(pool.Tags),
 		"createdAt":        pool.CreatedAt.Format(time.RFC3339),
 		"updatedAt":        pool.UpdatedAt.Format(time.RFC3339),
+		"updatedAgo":       pool.UpdatedAgo,
+	}
+}
+
+func poolRewardsToGraphQL(rewards *models.PoolRewards) map[string]interface{} {
+	tokens := make([]map[string]interface{}, len(rewards.Tokens))
+	for i, token := range rewards.Tokens {
+		t := map[string]interface{}{
+			"address":                     token.Address,
+			"symbol":                      nil,
+			"coingeckoId":                 nil,
+			"priceUsd":                    nil,
+			"estimatedDailyTokensPer1000": nil,
+		}
+		if token.Symbol != "" {
+			t["symbol"] = token.Symbol
+		}
+		if token.CoinGeckoID != "" {
+			t["coingeckoId"] = token.CoinGeckoID
+		}
+		if token.PriceUSD != nil {
+			t["priceUsd"] = token.PriceUSD.String()
+		}
+		if token.EstimatedDailyTokensPer1000 != nil {
+			t["estimatedDailyTokensPer1000"] = token.EstimatedDailyTokensPer1000.String()
+		}
+		tokens[i] = t
+	}
+
+	return map[string]interface{}{
+		"apyReward":                rewards.APYReward.String(),
+		"tokens":                   tokens,
+		"estimatedDailyUsdPer1000": rewards.EstimatedDailyUSDPer1000.String(),
+		"note":                     rewards.Note,
 	}
 }
 
 func opportunityToGraphQL(opp models.Opportunity) map[string]interface{} {
+	opp.SetRelativeTimes()
 	result := map[string]interface{}{
 		"id":              opp.ID,
 		"type":            string(opp.Type),
@@ -565,12 +1191,54 @@ func opportunityToGraphQL(opp models.Opportunity) map[string]interface{} {
 		"score":           opp.Score.String(),
 		"isActive":        opp.IsActive,
 		"detectedAt":      opp.DetectedAt.Format(time.RFC3339),
+		"detectedAgo":     opp.DetectedAgo,
 		"lastSeenAt":      opp.LastSeenAt.Format(time.RFC3339),
 		"expiresAt":       opp.ExpiresAt.Format(time.RFC3339),
 		"createdAt":       opp.CreatedAt.Format(time.RFC3339),
 		"updatedAt":       opp.UpdatedAt.Format(time.RFC3339),
 	}
 
+	if opp.Costs != nil {
+		result["costs"] = map[string]interface{}{
+			"positionSizeUsd": opp.Costs.PositionSizeUSD.String(),
+			"withdrawGasUsd":  opp.Costs.WithdrawGasUSD.String(),
+			"bridgeFeeUsd":    opp.Costs.BridgeFeeUSD.String(),
+			"depositGasUsd":   opp.Costs.DepositGasUSD.String(),
+			"slippageUsd":     opp.Costs.SlippageUSD.String(),
+			"totalUsd":        opp.Costs.TotalUSD.String(),
+			"crossChain":      opp.Costs.CrossChain,
+		}
+		if bridge := opp.Costs.BridgeCost; bridge != nil {
+			result["costs"].(map[string]interface{})["bridgeCost"] = map[string]interface{}{
+				"sourceChain":  bridge.SourceChain,
+				"targetChain":  bridge.TargetChain,
+				"flatFeeUsd":   bridge.FlatFeeUSD.String(),
+				"feePercent":   bridge.FeePercent.String(),
+				"delayHours":   bridge.DelayHours.String(),
+				"defaultRoute": bridge.DefaultRoute,
+			}
+		}
+	}
+
+	if len(opp.ProfitByHorizon) > 0 {
+		horizons := make([]map[string]interface{}, len(opp.ProfitByHorizon))
+		for i, h := range opp.ProfitByHorizon {
+			horizons[i] = map[string]interface{}{
+				"days":      h.Days,
+				"profitUsd": h.ProfitUSD.String(),
+			}
+		}
+		result["profitByHorizon"] = horizons
+	}
+
+	return result
+}
+
+func opportunitiesToGraphQL(opps []models.Opportunity) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(opps))
+	for i, opp := range opps {
+		result[i] = opportunityToGraphQL(opp)
+	}
 	return result
 }
 
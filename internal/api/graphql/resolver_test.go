@@ -0,0 +1,483 @@
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func newGetApp(cfg config.GraphQLConfig) *fiber.App {
+	r := NewResolver(cfg, config.DistributionConfig{}, config.ListingConfig{}, config.AdminConfig{}, nil, nil, nil, nil)
+
+	app := fiber.New()
+	app.Get("/graphql", r.HandleGet)
+	return app
+}
+
+func TestHandleGet_QueryParams(t *testing.T) {
+	app := newGetApp(config.GraphQLConfig{Playground: true, GetCacheControl: "public, max-age=30"})
+
+	params := url.Values{}
+	params.Set("query", "{ __typename }")
+	params.Set("variables", `{"filter":{"chain":"ethereum"}}`)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/graphql?"+params.Encode(), nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, fiber.MIMEApplicationJSON) {
+		t.Errorf("Expected JSON response, got %s", ct)
+	}
+	if cc := resp.Header.Get(fiber.HeaderCacheControl); cc != "public, max-age=30" {
+		t.Errorf("Expected configured Cache-Control, got %q", cc)
+	}
+
+	var body GraphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Errors) != 0 {
+		t.Errorf("Expected no errors, got %v", body.Errors)
+	}
+}
+
+func TestHandleGet_MalformedVariables(t *testing.T) {
+	app := newGetApp(config.GraphQLConfig{Playground: true, GetCacheControl: "public, max-age=30"})
+
+	params := url.Values{}
+	params.Set("query", "{ __typename }")
+	params.Set("variables", `{"filter":`)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/graphql?"+params.Encode(), nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+	if cc := resp.Header.Get(fiber.HeaderCacheControl); cc != "" {
+		t.Errorf("Expected no Cache-Control on errors, got %q", cc)
+	}
+}
+
+func TestHandleGet_MutationRejected(t *testing.T) {
+	const document = "query Status { __typename }\nmutation Create { createWatchlist(name: \"x\") { id } }"
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		rejected      bool
+	}{
+		{"mutation after a comment", "# create one\nmutation { createWatchlist(name: \"x\") { id } }", "", true},
+		{"mutation picked by name", document, "Create", true},
+		{"query picked by name", document, "Status", false},
+		{"mutation only in a comment", "# mutation { createWatchlist }\n{ __typename }", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newGetApp(config.GraphQLConfig{Playground: true})
+
+			params := url.Values{}
+			params.Set("query", tt.query)
+			if tt.operationName != "" {
+				params.Set("operationName", tt.operationName)
+			}
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/graphql?"+params.Encode(), nil))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if rejected := resp.StatusCode == fiber.StatusMethodNotAllowed; rejected != tt.rejected {
+				t.Fatalf("Expected rejected=%v, got status %d", tt.rejected, resp.StatusCode)
+			}
+			if allow := resp.Header.Get(fiber.HeaderAllow); tt.rejected && allow != fiber.MethodPost {
+				t.Errorf("Expected Allow: POST, got %q", allow)
+			}
+		})
+	}
+}
+
+func TestHandleGet_PlaygroundFallback(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		resp, err := newGetApp(config.GraphQLConfig{Playground: true}).Test(httptest.NewRequest("GET", "/graphql", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != fiber.StatusOK || !strings.Contains(string(body), "GraphQL Playground") {
+			t.Errorf("Expected Playground HTML, got status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		resp, err := newGetApp(config.GraphQLConfig{}).Test(httptest.NewRequest("GET", "/graphql", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+
+		if resp.StatusCode != fiber.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestParsePoolFilterFromVars_Sort(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    string
+		want    []models.SortKey
+		wantErr bool
+	}{
+		{"default", `{}`, nil, false},
+		{"sortBy and sortOrder", `{"filter":{"sortBy":"APY","sortOrder":"ASC"}}`, []models.SortKey{{Field: "apy", Order: "asc"}}, false},
+		{
+			"sort list",
+			`{"filter":{"sort":[{"field":"CHAIN","direction":"ASC"},{"field":"SCORE"}]}}`,
+			[]models.SortKey{{Field: "chain", Order: "asc"}, {Field: "score", Order: "desc"}},
+			false,
+		},
+		{
+			"sort list overrides sortBy",
+			`{"filter":{"sortBy":"TVL","sort":[{"field":"UPDATED_AT","direction":"DESC"}]}}`,
+			[]models.SortKey{{Field: "updated_at", Order: "desc"}},
+			false,
+		},
+		{"too many keys", `{"filter":{"sort":[{"field":"CHAIN"},{"field":"PROTOCOL"},{"field":"SCORE"},{"field":"APY"}]}}`, nil, true},
+		{"duplicate keys", `{"filter":{"sort":[{"field":"APY"},{"field":"APY","direction":"ASC"}]}}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vars map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.vars), &vars); err != nil {
+				t.Fatalf("Invalid test variables: %v", err)
+			}
+
+			filter, err := parsePoolFilterFromVars(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(filter.Sort, tt.want) {
+				t.Errorf("Expected sort %v, got %v", tt.want, filter.Sort)
+			}
+			if primary := filter.SortKeys()[0]; len(tt.want) > 0 && primary != tt.want[0] {
+				t.Errorf("Expected primary key %v, got %v", tt.want[0], primary)
+			}
+		})
+	}
+}
+
+func TestPaginationFromVars_ClampsLikeREST(t *testing.T) {
+	tests := []struct {
+		name       string
+		vars       string
+		wantLimit  int
+		wantOffset int
+		wantErr    bool
+	}{
+		{"defaults", `{}`, 50, 0, false},
+		{"given", `{"pagination":{"limit":20,"offset":40}}`, 20, 40, false},
+		{"oversized limit", `{"pagination":{"limit":100000}}`, 100, 0, false},
+		{"zero limit", `{"pagination":{"limit":0}}`, 50, 0, false},
+		{"negative limit", `{"pagination":{"limit":-5}}`, 50, 0, false},
+		{"negative offset", `{"pagination":{"offset":-10}}`, 50, 0, false},
+		{"offset at max", `{"pagination":{"limit":100,"offset":10000}}`, 100, 10000, false},
+		{"offset past max", `{"pagination":{"offset":10001}}`, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vars map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.vars), &vars); err != nil {
+				t.Fatalf("Invalid test variables: %v", err)
+			}
+
+			pools, err := parsePoolFilterFromVars(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pools: expected error=%v, got %v", tt.wantErr, err)
+			}
+			opps, err := parseOpportunityFilterFromVars(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("opportunities: expected error=%v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			for name, got := range map[string][2]int{
+				"pools":         {pools.Limit, pools.Offset},
+				"opportunities": {opps.Limit, opps.Offset},
+			} {
+				if got != [2]int{tt.wantLimit, tt.wantOffset} {
+					t.Errorf("%s: expected limit %d offset %d, got %v", name, tt.wantLimit, tt.wantOffset, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePoolFilterFromVars_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    string
+		wantErr bool
+	}{
+		{"valid ranges", `{"filter":{"minApy":1,"maxApy":10,"minTvl":1000,"maxTvl":5000,"minScore":50}}`, false},
+		{"negative minApy", `{"filter":{"minApy":-1}}`, true},
+		{"negative maxTvl", `{"filter":{"maxTvl":-1}}`, true},
+		{"negative minVolume1d", `{"filter":{"minVolume1d":-1}}`, true},
+		{"minScore above 100", `{"filter":{"minScore":101}}`, true},
+		{"minApy above maxApy", `{"filter":{"minApy":10,"maxApy":5}}`, true},
+		{"minTvl above maxTvl", `{"filter":{"minTvl":5000,"maxTvl":1000}}`, true},
+		{"unknown sort field", `{"filter":{"sortBy":"NAME"}}`, true},
+		{"invalid sort order", `{"filter":{"sortBy":"APY","sortOrder":"UP"}}`, true},
+		{"invalid tag", `{"filter":{"tags":["dex_lp"]}}`, true},
+		{"non-string tag", `{"filter":{"tags":[1]}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vars map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.vars), &vars); err != nil {
+				t.Fatalf("Invalid test variables: %v", err)
+			}
+
+			filter, err := parsePoolFilterFromVars(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && (!filter.MaxTVL.Equal(decimal.NewFromInt(5000)) || !filter.MinScore.Equal(decimal.NewFromInt(50))) {
+				t.Errorf("Expected maxTvl and minScore parsed, got %+v", filter)
+			}
+		})
+	}
+}
+
+func TestParsePoolFilterFromVars_Fields(t *testing.T) {
+	var vars map[string]interface{}
+	json.Unmarshal([]byte(`{"filter":{
+		"chain":"ethereum","protocol":"aave-v3","symbol":"USDC","search":"stable","exact":true,
+		"minApy":2,"maxApy":20,"minTvl":1000,"maxTvl":5000000,"minScore":60,"minVolume1d":100,"minVolumeTvlRatio":0.5,
+		"stablecoin":true,"tags":["rwa","Lending"],"dataSource":"MANUAL","rankMode":"DECAYED","sortBy":"SCORE","sortOrder":"ASC"
+	}}`), &vars)
+
+	filter, err := parsePoolFilterFromVars(vars)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for field, ok := range map[string]bool{
+		"chain":             filter.Chain == "ethereum",
+		"protocol":          filter.Protocol == "aave-v3",
+		"symbol":            filter.Symbol == "USDC",
+		"search":            filter.Search == "stable",
+		"exact":             filter.Exact,
+		"minApy":            filter.MinAPY.Equal(decimal.NewFromInt(2)),
+		"maxApy":            filter.MaxAPY.Equal(decimal.NewFromInt(20)),
+		"minTvl":            filter.MinTVL.Equal(decimal.NewFromInt(1000)),
+		"maxTvl":            filter.MaxTVL.Equal(decimal.NewFromInt(5000000)),
+		"minScore":          filter.MinScore.Equal(decimal.NewFromInt(60)),
+		"minVolume1d":       filter.MinVolume1D.Equal(decimal.NewFromInt(100)),
+		"minVolumeTvlRatio": filter.MinVolumeTVLRatio.Equal(decimal.RequireFromString("0.5")),
+		"stablecoin":        filter.StableCoin != nil && *filter.StableCoin,
+		"tags":              reflect.DeepEqual(filter.Tags, []string{"lending", "rwa"}),
+		"dataSource":        filter.DataSource == models.DataSourceManual,
+		"rankMode":          filter.RankMode == models.RankModeDecayed,
+		"sortBy":            filter.SortBy == "score",
+		"sortOrder":         filter.SortOrder == "asc",
+	} {
+		if !ok {
+			t.Errorf("%s: not parsed, got %+v", field, filter)
+		}
+	}
+}
+
+func TestParsePoolFilterFromVars_SearchDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    string
+		want    []models.SortKey
+		wantErr bool
+	}{
+		{"search sorts by relevance", `{"filter":{"search":"usdc"}}`, []models.SortKey{{Field: "relevance", Order: "desc"}, {Field: "tvl", Order: "desc"}}, false},
+		{"explicit sort wins", `{"filter":{"search":"usdc","sortBy":"APY"}}`, []models.SortKey{{Field: "apy", Order: "desc"}}, false},
+		{"no search", `{"filter":{"chain":"ethereum"}}`, nil, false},
+		{"unknown data source", `{"filter":{"dataSource":"CSV"}}`, nil, true},
+		{"unknown rank mode", `{"filter":{"rankMode":"RANDOM"}}`, nil, true},
+		{"decayed without score sort", `{"filter":{"rankMode":"DECAYED","sortBy":"APY"}}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vars map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.vars), &vars); err != nil {
+				t.Fatalf("Invalid test variables: %v", err)
+			}
+
+			filter, err := parsePoolFilterFromVars(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(filter.Sort, tt.want) {
+				t.Errorf("Expected sort %v, got %v", tt.want, filter.Sort)
+			}
+		})
+	}
+}
+
+func TestParseOpportunityFilterFromVars(t *testing.T) {
+	var vars map[string]interface{}
+	json.Unmarshal([]byte(`{"filter":{"type":"YIELD_GAP","riskLevel":"LOW","asset":"USDC","minProfit":2,"activeOnly":false,"sortBy":"DETECTED_AT","sortOrder":"ASC"}}`), &vars)
+
+	filter, err := parseOpportunityFilterFromVars(vars)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if filter.Type != models.OpportunityTypeYieldGap || filter.RiskLevel != models.RiskLevelLow || filter.Asset != "USDC" ||
+		!filter.MinProfit.Equal(decimal.NewFromInt(2)) || filter.ActiveOnly || filter.SortBy != "detected_at" || filter.SortOrder != "asc" {
+		t.Errorf("Expected the filter mapped to REST values, got %+v", filter)
+	}
+
+	for name, raw := range map[string]string{
+		"unknown type":       `{"filter":{"type":"ARBITRAGE"}}`,
+		"unknown risk level": `{"filter":{"riskLevel":"EXTREME"}}`,
+		"negative minProfit": `{"filter":{"minProfit":-1}}`,
+		"unknown sort field": `{"filter":{"sortBy":"TVL"}}`,
+		"invalid sort order": `{"filter":{"sortOrder":"UP"}}`,
+		"malformed time":     `{"filter":{"detectedAfter":"yesterday"}}`,
+		"look-back too long": `{"filter":{"detectedAfter":"2000-01-01T00:00:00Z"}}`,
+	} {
+		json.Unmarshal([]byte(raw), &vars)
+		if _, err := parseOpportunityFilterFromVars(vars); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseOpportunityFilterFromVars_DetectedAt(t *testing.T) {
+	now := time.Now().UTC()
+
+	// Without bounds the listing covers the default look-back
+	filter, err := parseOpportunityFilterFromVars(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if span := now.Sub(filter.DetectedAfter); span < models.DefaultOpportunityLookback || span > models.DefaultOpportunityLookback+time.Minute {
+		t.Errorf("Expected the default look-back, got detectedAfter %s before now", span)
+	}
+
+	after := now.Add(-60 * 24 * time.Hour).Truncate(time.Second)
+	before := now.Add(-30 * 24 * time.Hour).Truncate(time.Second)
+	filter, err = parseOpportunityFilterFromVars(map[string]interface{}{
+		"filter": map[string]interface{}{
+			"detectedAfter":  after.Format(time.RFC3339),
+			"detectedBefore": before.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !filter.DetectedAfter.Equal(after) || !filter.DetectedBefore.Equal(before) {
+		t.Errorf("Expected the given bounds, got %s to %s", filter.DetectedAfter, filter.DetectedBefore)
+	}
+}
+
+func TestBestPerChainLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]interface{}
+		want int
+	}{
+		{"default", nil, 20},
+		{"given", map[string]interface{}{"limit": float64(5)}, 5},
+		{"capped", map[string]interface{}{"limit": float64(1000)}, 100},
+		{"zero", map[string]interface{}{"limit": float64(0)}, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bestPerChainLimit(tt.vars); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestContainsQuery_BestOpportunitiesPerChain(t *testing.T) {
+	query := "query { bestOpportunitiesPerChain(limit: 10) { id chain score } }"
+
+	if !containsQuery(query, "bestOpportunitiesPerChain") {
+		t.Fatal("Expected bestOpportunitiesPerChain to be resolved")
+	}
+	// The field must not also trigger the other top-level resolvers
+	for _, field := range []string{"pools", "pool(", "opportunities", "poolOpportunities", "chains", "stats"} {
+		if containsQuery(query, field) {
+			t.Errorf("Expected %s not to match", field)
+		}
+	}
+}
+
+func TestIndexHistoryFromVars(t *testing.T) {
+	tests := []struct {
+		name     string
+		vars     map[string]interface{}
+		wantDays int
+		wantErr  bool
+	}{
+		{"default days", map[string]interface{}{"name": "aave-usdc"}, 30, false},
+		{"given days", map[string]interface{}{"name": "aave-usdc", "days": float64(90)}, 90, false},
+		{"missing name", map[string]interface{}{"days": float64(7)}, 0, true},
+		{"zero days", map[string]interface{}{"name": "aave-usdc", "days": float64(0)}, 0, true},
+		{"too many days", map[string]interface{}{"name": "aave-usdc", "days": float64(366)}, 0, true},
+		{"fractional days", map[string]interface{}{"name": "aave-usdc", "days": 1.5}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, days, err := indexHistoryFromVars(tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if days != tt.wantDays {
+				t.Errorf("Expected %d days, got %d", tt.wantDays, days)
+			}
+		})
+	}
+}
+
+func TestToGraphQL_RelativeTimes(t *testing.T) {
+	now := time.Now()
+	pool := models.Pool{UpdatedAt: now.Add(-5*time.Minute - time.Second)}
+	if got := poolToGraphQL(pool, nil); got["updatedAgo"] != "5 minutes ago" || got["updatedAt"] != pool.UpdatedAt.Format(time.RFC3339) {
+		t.Errorf("Expected updatedAgo next to updatedAt, got %v and %v", got["updatedAgo"], got["updatedAt"])
+	}
+
+	opp := models.Opportunity{DetectedAt: now.Add(-3*time.Hour - time.Minute)}
+	if got := opportunityToGraphQL(opp); got["detectedAgo"] != "3 hours ago" {
+		t.Errorf("Expected detectedAgo 3 hours ago, got %v", got["detectedAgo"])
+	}
+}
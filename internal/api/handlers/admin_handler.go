@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
+)
+
+// importTimeout bounds the time spent ingesting an import upload
+const importTimeout = 2 * time.Minute
+
+// dryRunTimeout bounds a detection dry run, which scans every pool
+const dryRunTimeout = time.Minute
+
+// ErrTooManyRows is returned when an import upload exceeds the configured row limit
+var ErrTooManyRows = NewAPIError(fiber.StatusRequestEntityTooLarge, "TOO_MANY_ROWS", "Import exceeds maximum row count")
+
+// importRow is a parsed upload row awaiting validation
+type importRow struct {
+	record   models.PoolImportRecord
+	parseErr error
+}
+
+// ImportPools imports pool records from a JSON array or CSV upload
+// @Summary Import pools
+// @Description Import self-hosted pool data. Rows are validated, scored and stored through the ingestion pipeline and marked with dataSource=manual. Pools from another data source are never overwritten.
+// @Tags admin
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param file formData file false "JSON or CSV file (multipart uploads)"
+// @Success 200 {object} models.PoolImportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Router /api/v1/admin/pools/import [post]
+func (h *Handler) ImportPools(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), importTimeout)
+	defer cancel()
+
+	body, isCSV, err := readImportUpload(c)
+	if err != nil {
+		return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+	}
+
+	rows, err := parsePoolImport(body, isCSV)
+	if err != nil {
+		return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+	}
+
+	if maxRows := h.config.Admin.ImportMaxRows; maxRows > 0 && len(rows) > maxRows {
+		return SendError(c, ErrTooManyRows.WithDetails(
+			fmt.Sprintf("upload has %d rows, maximum is %d", len(rows), maxRows),
+		))
+	}
+
+	pools, results := buildImportedPools(rows, time.Now().UTC())
+
+	// Reuse the ingestion pipeline: scoring, storage, history, index, cache and publish
+	if len(pools) > 0 {
+		result := h.ingestion.Ingest(ctx, pools)
+		for i := range results {
+			if err, failed := result.Failed[results[i].ID]; failed && results[i].Status == models.ImportStatusAccepted {
+				log.Warn().Err(err).Str("pool_id", results[i].ID).Msg("Failed to store imported pool")
+				results[i].Status = models.ImportStatusRejected
+				results[i].Reasons = append(results[i].Reasons, storeFailureReason(err))
+			}
+		}
+	}
+
+	response := models.PoolImportResponse{Results: results}
+	for _, r := range results {
+		if r.Status == models.ImportStatusAccepted {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+
+	log.Info().
+		Int("accepted", response.Accepted).
+		Int("rejected", response.Rejected).
+		Msg("Imported pools")
+
+	return c.JSON(response)
+}
+
+// storeFailureReason explains why an imported pool wasn't stored. An
+// import never takes over a pool another data source keeps up to date.
+func storeFailureReason(err error) string {
+	if errors.Is(err, postgres.ErrDataSourceConflict) {
+		return "pool id belongs to another data source"
+	}
+	return "failed to store pool"
+}
+
+// GetDataQuality reports data that needs operator attention
+// @Summary Get data quality report
+// @Description List chains seen in the feed without a reviewed security rating. Assign real values in chain_metadata or chain_overrides and clear needs_review.
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.DataQualityReport
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/data-quality [get]
+func (h *Handler) GetDataQuality(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	chains, err := h.pg.ListChainMetadata(ctx, true)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list chains awaiting review")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to build data quality report"))
+	}
+
+	return c.JSON(models.DataQualityReport{
+		ChainsNeedingReview: chains,
+		GeneratedAt:         time.Now().UTC(),
+	})
+}
+
+// DryRunOpportunities runs opportunity detection with override thresholds
+// @Summary Dry-run opportunity detection
+// @Description Run yield gap, trending and high-score detection against current pool data with the live thresholds plus any overrides in the body, and compare the result with the active opportunities. Nothing is stored, published or reconfigured. Opportunities are matched by type and pools.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param overrides body models.DetectionThresholdOverrides false "Thresholds to override; omitted fields keep their live values"
+// @Success 200 {object} models.DetectionDryRunReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/opportunities/dry-run [post]
+func (h *Handler) DryRunOpportunities(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), dryRunTimeout)
+	defer cancel()
+
+	var overrides models.DetectionThresholdOverrides
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &overrides); err != nil {
+			return SendError(c, ErrBadRequest.WithDetails("Request body must be a JSON object of threshold overrides"))
+		}
+	}
+
+	report, err := h.opportunities.DryRun(ctx, overrides)
+	if err != nil {
+		if errors.Is(err, opportunity.ErrInvalidThresholds) {
+			return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+		}
+		log.Error().Err(err).Msg("Opportunity detection dry run failed")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to run opportunity detection"))
+	}
+
+	return c.JSON(report)
+}
+
+// StartReindex starts a rebuild of the pools search index
+// @Summary Reindex pools
+// @Description Rebuild the ElasticSearch pools index from PostgreSQL into a new versioned index and swap the defi_pools alias to it once the document count is verified. Runs in the background; poll GET /api/v1/admin/reindex for progress. An interrupted run resumes from its checkpoint.
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 202 {object} models.ReindexStatus
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/reindex [post]
+func (h *Handler) StartReindex(c *fiber.Ctx) error {
+	// The run outlives the request
+	if err := h.reindex.Start(context.Background()); err != nil {
+		if errors.Is(err, reindex.ErrRunning) {
+			return SendError(c, ErrConflict.WithDetails("A pools reindex is already running"))
+		}
+		log.Error().Err(err).Msg("Failed to start pools reindex")
+		return SendError(c, ErrInternalServer)
+	}
+
+	log.Info().Msg("Pools reindex started from the admin API")
+
+	// The run writes its checkpoint asynchronously, so report the request
+	// rather than a status that may still belong to the previous run
+	return c.Status(fiber.StatusAccepted).JSON(models.ReindexStatus{
+		State:          models.ReindexStateRunning,
+		Source:         models.ReindexSourcePostgres,
+		MappingVersion: elasticsearch.PoolsMappingVersion,
+		StartedAt:      time.Now().UTC(),
+	})
+}
+
+// GetReindexStatus reports the progress of the current or last pools reindex
+// @Summary Get reindex status
+// @Description Progress of the current or last pools index rebuild.
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.ReindexStatus
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/reindex [get]
+func (h *Handler) GetReindexStatus(c *fiber.Ctx) error {
+	status, err := h.reindex.Status(c.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read reindex status")
+		return SendError(c, ErrInternalServer)
+	}
+	if status == nil {
+		return SendError(c, ErrNotFound.WithDetails("No reindex has run"))
+	}
+
+	return c.JSON(status)
+}
+
+// ListSnapshots lists the archived raw DeFiLlama snapshots
+// @Summary List raw snapshots
+// @Description List archived raw DeFiLlama pools responses, newest first. Requires SNAPSHOT_ENABLED.
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.SnapshotListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/snapshots [get]
+func (h *Handler) ListSnapshots(c *fiber.Ctx) error {
+	if h.snapshots == nil {
+		return SendError(c, ErrNotFound.WithDetails("Snapshot archiving is disabled"))
+	}
+
+	snapshots, err := h.snapshots.List(c.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list snapshots")
+		return SendError(c, ErrInternalServer)
+	}
+
+	return c.JSON(models.SnapshotListResponse{
+		Data:  snapshots,
+		Total: len(snapshots),
+	})
+}
+
+// GetSnapshot streams back a single archived raw DeFiLlama snapshot
+// @Summary Download raw snapshot
+// @Description Download the gzip-compressed raw DeFiLlama pools response captured at the given unix timestamp
+// @Tags admin
+// @Produce application/gzip
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param ts path string true "Snapshot ID (unix timestamp)"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/snapshots/{ts} [get]
+func (h *Handler) GetSnapshot(c *fiber.Ctx) error {
+	if h.snapshots == nil {
+		return SendError(c, ErrNotFound.WithDetails("Snapshot archiving is disabled"))
+	}
+
+	id := c.Params("ts")
+	reader, size, err := h.snapshots.Open(c.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, snapshot.ErrInvalidID):
+			return SendError(c, ErrBadRequest.WithDetails("Snapshot id must be a unix timestamp"))
+		case errors.Is(err, os.ErrNotExist):
+			return SendError(c, ErrNotFound.WithDetails(fmt.Sprintf("Snapshot '%s' not found", id)))
+		default:
+			log.Error().Err(err).Str("snapshot", id).Msg("Failed to open snapshot")
+			return SendError(c, ErrInternalServer)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="defillama-pools-%s.json.gz"`, id))
+
+	// The response body stream is closed once it has been sent
+	return c.SendStream(reader, int(size))
+}
+
+// readImportUpload returns the upload payload and whether it is CSV. It accepts
+// a raw JSON or CSV body, or a multipart form with a "file" field.
+func readImportUpload(c *fiber.Ctx) ([]byte, bool, error) {
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+
+	if strings.HasPrefix(contentType, fiber.MIMEMultipartForm) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, false, errors.New("multipart upload must include a 'file' field")
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to open upload: %w", err)
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read upload: %w", err)
+		}
+
+		isCSV := strings.EqualFold(filepath.Ext(fileHeader.Filename), ".csv") ||
+			strings.Contains(fileHeader.Header.Get(fiber.HeaderContentType), "csv")
+		return data, isCSV, nil
+	}
+
+	return c.Body(), strings.Contains(contentType, "csv"), nil
+}
+
+// parsePoolImport splits an upload into rows. Rows that can't be decoded carry
+// a parse error so they can be reported individually.
+func parsePoolImport(data []byte, isCSV bool) ([]importRow, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("upload is empty")
+	}
+
+	if isCSV {
+		return parsePoolImportCSV(data)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("body must be a JSON array of pool records")
+	}
+
+	rows := make([]importRow, len(raw))
+	for i, msg := range raw {
+		if err := json.Unmarshal(msg, &rows[i].record); err != nil {
+			rows[i].parseErr = errors.New("invalid JSON record")
+		}
+	}
+
+	return rows, nil
+}
+
+// parsePoolImportCSV parses a CSV upload whose header row uses the JSON field
+// names. List columns (rewardTokens, underlyingTokens) are separated by ';'.
+func parsePoolImportCSV(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV upload must start with a header row")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	rows := make([]importRow, 0)
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		var row importRow
+		row.parseErr = csvToImportRecord(header, fields, &row.record)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvToImportRecord fills a record from a CSV row
+func csvToImportRecord(header, fields []string, rec *models.PoolImportRecord) error {
+	if len(fields) != len(header) {
+		return fmt.Errorf("expected %d columns, got %d", len(header), len(fields))
+	}
+
+	for i, name := range header {
+		value := strings.TrimSpace(fields[i])
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch name {
+		case "id":
+			rec.ID = value
+		case "chain":
+			rec.Chain = value
+		case "protocol":
+			rec.Protocol = value
+		case "symbol":
+			rec.Symbol = value
+		case "poolMeta":
+			rec.PoolMeta = value
+		case "exposure":
+			rec.Exposure = value
+		case "rewardTokens":
+			rec.RewardTokens = strings.Split(value, ";")
+		case "underlyingTokens":
+			rec.UnderlyingTokens = strings.Split(value, ";")
+		case "stablecoin":
+			rec.StableCoin, err = strconv.ParseBool(value)
+		case "tvl":
+			var d decimal.Decimal
+			d, err = decimal.NewFromString(value)
+			rec.TVL = &d
+		case "apy":
+			var d decimal.Decimal
+			d, err = decimal.NewFromString(value)
+			rec.APY = &d
+		case "apyBase":
+			rec.APYBase, err = decimal.NewFromString(value)
+		case "apyReward":
+			rec.APYReward, err = decimal.NewFromString(value)
+		case "il7d":
+			rec.IL7D, err = decimal.NewFromString(value)
+		case "apyMean30d":
+			rec.APYMean30D, err = decimal.NewFromString(value)
+		case "volumeUsd1d":
+			rec.VolumeUSD1D, err = decimal.NewFromString(value)
+		case "volumeUsd7d":
+			rec.VolumeUSD7D, err = decimal.NewFromString(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s", name)
+		}
+	}
+
+	return nil
+}
+
+// buildImportedPools validates rows and converts accepted ones to pools marked
+// as manually sourced. It returns the pools to ingest and a result per row.
+func buildImportedPools(rows []importRow, now time.Time) ([]models.Pool, []models.PoolImportResult) {
+	pools := make([]models.Pool, 0, len(rows))
+	results := make([]models.PoolImportResult, len(rows))
+	seen := make(map[string]bool)
+
+	for i, row := range rows {
+		rec := row.record
+		results[i] = models.PoolImportResult{Row: i + 1, ID: rec.ID}
+
+		var reasons []string
+		if row.parseErr != nil {
+			reasons = append(reasons, row.parseErr.Error())
+		} else {
+			reasons = validateImportRecord(&rec)
+			if rec.ID != "" && seen[rec.ID] {
+				reasons = append(reasons, "duplicate id in upload")
+			}
+		}
+
+		if len(reasons) > 0 {
+			results[i].Status = models.ImportStatusRejected
+			results[i].Reasons = reasons
+			continue
+		}
+
+		seen[rec.ID] = true
+		results[i].Status = models.ImportStatusAccepted
+		pools = append(pools, models.Pool{
+			ID:               rec.ID,
+			Chain:            rec.Chain,
+			Protocol:         rec.Protocol,
+			Symbol:           rec.Symbol,
+			TVL:              *rec.TVL,
+			APY:              *rec.APY,
+			APYBase:          rec.APYBase,
+			APYReward:        rec.APYReward,
+			RewardTokens:     rec.RewardTokens,
+			UnderlyingTokens: rec.UnderlyingTokens,
+			PoolMeta:         rec.PoolMeta,
+			IL7D:             rec.IL7D,
+			APYMean30D:       rec.APYMean30D,
+			VolumeUSD1D:      rec.VolumeUSD1D,
+			VolumeUSD7D:      rec.VolumeUSD7D,
+			StableCoin:       rec.StableCoin,
+			Exposure:         rec.Exposure,
+			DataSource:       models.DataSourceManual,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+	}
+
+	return pools, results
+}
+
+// validateImportRecord normalizes and validates an import record, returning
+// the reasons it was rejected
+func validateImportRecord(rec *models.PoolImportRecord) []string {
+	var reasons []string
+
+	for _, e := range ValidatePoolID(rec.ID) {
+		reasons = append(reasons, e.Message)
+	}
+
+	rec.Chain = utils.NormalizeChainName(rec.Chain)
+	if rec.Chain == "" {
+		reasons = append(reasons, "chain is required")
+	} else if !chainRegex.MatchString(rec.Chain) {
+		reasons = append(reasons, "invalid chain name")
+	}
+
+	rec.Protocol = strings.ToLower(strings.TrimSpace(rec.Protocol))
+	if rec.Protocol == "" {
+		reasons = append(reasons, "protocol is required")
+	} else if !protocolRegex.MatchString(rec.Protocol) {
+		reasons = append(reasons, "invalid protocol name")
+	}
+
+	rec.Symbol = strings.TrimSpace(rec.Symbol)
+	if !utils.IsValidSymbol(rec.Symbol) {
+		reasons = append(reasons, "invalid symbol")
+	}
+
+	if rec.TVL == nil {
+		reasons = append(reasons, "tvl is required")
+	} else if rec.TVL.IsNegative() {
+		reasons = append(reasons, "tvl must be non-negative")
+	}
+
+	if rec.APY == nil {
+		reasons = append(reasons, "apy is required")
+	} else if rec.APY.IsNegative() {
+		reasons = append(reasons, "apy must be non-negative")
+	}
+
+	return reasons
+}
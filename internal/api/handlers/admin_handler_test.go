@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+)
+
+const mixedImportJSON = `[
+	{"id": "vault-1", "chain": "Ethereum", "protocol": "My-Vaults", "symbol": "USDC", "tvl": 2500000, "apy": 4.2},
+	{"id": "vault-2", "chain": "arbitrum", "protocol": "my-vaults", "symbol": "WETH", "tvl": "1000000", "apy": "3.1", "stablecoin": false},
+	{"id": "", "chain": "ethereum", "protocol": "my-vaults", "symbol": "DAI", "tvl": 100, "apy": 1},
+	{"id": "vault-4", "chain": "ethereum", "protocol": "my-vaults", "symbol": "BAD SYMBOL!", "tvl": 100, "apy": 1},
+	{"id": "vault-5", "chain": "ethereum", "protocol": "my-vaults", "symbol": "DAI", "apy": 1},
+	{"id": "vault-1", "chain": "ethereum", "protocol": "my-vaults", "symbol": "USDC", "tvl": 100, "apy": 1},
+	{"id": "vault-7", "chain": "ethereum", "protocol": "my-vaults", "symbol": "DAI", "tvl": "lots", "apy": 1}
+]`
+
+const mixedImportCSV = `id,chain,protocol,symbol,tvl,apy,rewardTokens,stablecoin
+vault-1,eth,my-vaults,USDC,2500000,4.2,,true
+vault-2,arbitrum,my-vaults,WETH,1000000,3.1,ARB;OP,false
+vault-3,ethereum,my-vaults,DAI,-5,1,,false
+vault-4,ethereum,my-vaults,DAI,100,abc,,false
+vault-5,ethereum,my-vaults
+`
+
+func TestImportPools_MixedJSON(t *testing.T) {
+	rows, err := parsePoolImport([]byte(mixedImportJSON), false)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	pools, results := buildImportedPools(rows, time.Now().UTC())
+
+	wantStatus := []string{
+		models.ImportStatusAccepted,
+		models.ImportStatusAccepted,
+		models.ImportStatusRejected, // missing id
+		models.ImportStatusRejected, // invalid symbol
+		models.ImportStatusRejected, // missing tvl
+		models.ImportStatusRejected, // duplicate id
+		models.ImportStatusRejected, // undecodable tvl
+	}
+
+	if len(results) != len(wantStatus) {
+		t.Fatalf("Expected %d results, got %d", len(wantStatus), len(results))
+	}
+	for i, want := range wantStatus {
+		if results[i].Status != want {
+			t.Errorf("Row %d: expected %s, got %s (%v)", i+1, want, results[i].Status, results[i].Reasons)
+		}
+		if results[i].Row != i+1 {
+			t.Errorf("Row %d: expected row number %d, got %d", i+1, i+1, results[i].Row)
+		}
+		if want == models.ImportStatusRejected && len(results[i].Reasons) == 0 {
+			t.Errorf("Row %d: expected rejection reasons", i+1)
+		}
+	}
+
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools to ingest, got %d", len(pools))
+	}
+	for _, pool := range pools {
+		if pool.DataSource != models.DataSourceManual {
+			t.Errorf("Expected data source %q, got %q", models.DataSourceManual, pool.DataSource)
+		}
+	}
+	if pools[0].Chain != "ethereum" || pools[0].Protocol != "my-vaults" {
+		t.Errorf("Expected chain and protocol to be normalized, got %s/%s", pools[0].Chain, pools[0].Protocol)
+	}
+}
+
+func TestImportPools_MixedCSV(t *testing.T) {
+	rows, err := parsePoolImport([]byte(mixedImportCSV), true)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	pools, results := buildImportedPools(rows, time.Now().UTC())
+
+	wantStatus := []string{
+		models.ImportStatusAccepted,
+		models.ImportStatusAccepted,
+		models.ImportStatusRejected, // negative tvl
+		models.ImportStatusRejected, // invalid apy
+		models.ImportStatusRejected, // short row
+	}
+	for i, want := range wantStatus {
+		if results[i].Status != want {
+			t.Errorf("Row %d: expected %s, got %s (%v)", i+1, want, results[i].Status, results[i].Reasons)
+		}
+	}
+
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools to ingest, got %d", len(pools))
+	}
+	if pools[0].Chain != "ethereum" || !pools[0].StableCoin {
+		t.Errorf("Expected normalized chain and stablecoin flag, got %+v", pools[0])
+	}
+	if !reflect.DeepEqual(pools[1].RewardTokens, []string{"ARB", "OP"}) {
+		t.Errorf("Expected reward tokens [ARB OP], got %v", pools[1].RewardTokens)
+	}
+}
+
+func TestImportPools_Reimport(t *testing.T) {
+	now := time.Now().UTC()
+
+	first, _ := parsePoolImport([]byte(mixedImportJSON), false)
+	second, _ := parsePoolImport([]byte(mixedImportJSON), false)
+
+	firstPools, firstResults := buildImportedPools(first, now)
+	secondPools, secondResults := buildImportedPools(second, now)
+
+	// Re-importing the same upload yields the same pools keyed by the same IDs,
+	// so the upsert updates rows in place rather than creating duplicates
+	if !reflect.DeepEqual(firstPools, secondPools) {
+		t.Error("Expected re-import to produce identical pools")
+	}
+	if !reflect.DeepEqual(firstResults, secondResults) {
+		t.Error("Expected re-import to produce identical row results")
+	}
+}
+
+func TestParsePoolImport_InvalidBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		isCSV bool
+	}{
+		{"empty", "  ", false},
+		{"json object", `{"id": "vault-1"}`, false},
+		{"malformed csv", "id,chain\n\"unterminated", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePoolImport([]byte(tt.body), tt.isCSV); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestImportPools_MaxRows(t *testing.T) {
+	h := &Handler{config: &config.Config{Admin: config.AdminConfig{ImportMaxRows: 2}}}
+
+	app := fiber.New()
+	app.Post("/import", h.ImportPools)
+
+	req := httptest.NewRequest("POST", "/import", strings.NewReader(mixedImportJSON))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", resp.StatusCode)
+	}
+}
+
+func TestStoreFailureReason(t *testing.T) {
+	conflict := fmt.Errorf("failed to upsert pool vault-1: %w", postgres.ErrDataSourceConflict)
+	if reason := storeFailureReason(conflict); reason != "pool id belongs to another data source" {
+		t.Errorf("Expected a data source conflict reason, got %q", reason)
+	}
+	if reason := storeFailureReason(errors.New("connection reset")); reason != "failed to store pool" {
+		t.Errorf("Expected a generic reason, got %q", reason)
+	}
+}
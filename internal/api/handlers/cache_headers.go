@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+)
+
+// Response headers reporting which path served the data, so latency
+// differences between identical requests can be explained
+const (
+	HeaderCache        = "X-Cache"
+	HeaderCacheBackend = "X-Cache-Backend"
+)
+
+// X-Cache values
+const (
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+// X-Cache-Backend values
+const (
+	backendRedis    = "redis"
+	backendES       = "es"
+	backendPostgres = "postgres"
+)
+
+// bypassCache reports whether the request skips Redis reads via
+// cacheBypass=true. Only admin requests may bypass, so the flag can't be used
+// to push load onto the databases. Fresh results are still written back.
+func (h *Handler) bypassCache(c *fiber.Ctx) bool {
+	return c.QueryBool("cacheBypass", false) && middleware.IsAdminRequest(c, h.config.Admin)
+}
+
+// setCacheHit marks a response served from Redis
+func setCacheHit(c *fiber.Ctx) {
+	c.Set(HeaderCache, cacheHit)
+	c.Set(HeaderCacheBackend, backendRedis)
+}
+
+// setCacheMiss marks a response loaded from backend, reporting BYPASS
+// instead of MISS when the cache was skipped on purpose
+func setCacheMiss(c *fiber.Ctx, bypassed bool, backend string) {
+	status := cacheMiss
+	if bypassed {
+		status = cacheBypass
+	}
+	c.Set(HeaderCache, status)
+	c.Set(HeaderCacheBackend, backend)
+}
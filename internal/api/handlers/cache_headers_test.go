@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// newCacheHeaderApp serves a route following the handlers' read-through
+// path: Redis unless bypassed, then ElasticSearch with a PostgreSQL fallback.
+// Whether the cache holds the entry and ElasticSearch succeeds is fixed per app.
+func newCacheHeaderApp(adminKey string, cached, esOK bool) *fiber.App {
+	h := &Handler{config: &config.Config{Admin: config.AdminConfig{APIKey: adminKey}}}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		bypass := h.bypassCache(c)
+		if !bypass && cached {
+			setCacheHit(c)
+			return c.SendStatus(fiber.StatusOK)
+		}
+
+		backend := backendES
+		if !esOK {
+			backend = backendPostgres
+		}
+		setCacheMiss(c, bypass, backend)
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestCacheHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		adminKey    string
+		cached      bool
+		esOK        bool
+		query       string
+		key         string
+		wantCache   string
+		wantBackend string
+	}{
+		{"hit", "secret", true, true, "", "", cacheHit, backendRedis},
+		{"miss served by es", "secret", false, true, "", "", cacheMiss, backendES},
+		{"miss with postgres fallback", "secret", false, false, "", "", cacheMiss, backendPostgres},
+		{"bypass with admin key", "secret", true, true, "?cacheBypass=true", "secret", cacheBypass, backendES},
+		{"bypass with fallback", "secret", true, false, "?cacheBypass=true", "secret", cacheBypass, backendPostgres},
+		{"bypass without key ignored", "secret", true, true, "?cacheBypass=true", "", cacheHit, backendRedis},
+		{"bypass with wrong key ignored", "secret", true, true, "?cacheBypass=true", "guess", cacheHit, backendRedis},
+		{"bypass ignored when admin disabled", "", true, true, "?cacheBypass=true", "", cacheHit, backendRedis},
+		{"miss reported when bypass is false", "secret", false, true, "?cacheBypass=false", "secret", cacheMiss, backendES},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newCacheHeaderApp(tt.adminKey, tt.cached, tt.esOK)
+
+			req := httptest.NewRequest("GET", "/"+tt.query, nil)
+			if tt.key != "" {
+				req.Header.Set(middleware.AdminKeyHeader, tt.key)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if got := resp.Header.Get(HeaderCache); got != tt.wantCache {
+				t.Errorf("Expected %s %s, got %q", HeaderCache, tt.wantCache, got)
+			}
+			if got := resp.Header.Get(HeaderCacheBackend); got != tt.wantBackend {
+				t.Errorf("Expected %s %s, got %q", HeaderCacheBackend, tt.wantBackend, got)
+			}
+		})
+	}
+}
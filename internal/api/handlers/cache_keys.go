@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// cacheKeyVersion is part of every list cache key. Bump it when the key
+// layout or the cached response shape changes so stale entries are ignored.
+const cacheKeyVersion = "v2"
+
+// maxCacheKeyLabelLength bounds the human-readable part of a cache key
+const maxCacheKeyLabelLength = 32
+
+// buildPoolsCacheKey creates a cache key from filter parameters
+func buildPoolsCacheKey(filter models.PoolFilter) string {
+	return hashedCacheKey("pools", filter.Chain, filter)
+}
+
+// buildOpportunitiesCacheKey creates a cache key for opportunities
+func buildOpportunitiesCacheKey(filter models.OpportunityFilter) string {
+	return hashedCacheKey("opportunities", filter.Chain, filter)
+}
+
+// buildChainsCacheKey creates a cache key for a page of chains
+func buildChainsCacheKey(filter models.ChainFilter) string {
+	return hashedCacheKey("chains", "", filter)
+}
+
+// buildProtocolsCacheKey creates a cache key for protocols
+func buildProtocolsCacheKey(filter models.ProtocolFilter) string {
+	return hashedCacheKey("protocols", filter.Chain, filter)
+}
+
+// buildProtocolHistoryCacheKey creates a cache key for a protocol's APY history
+func buildProtocolHistoryCacheKey(protocol, period string) string {
+	params := struct {
+		Protocol string `json:"protocol"`
+		Period   string `json:"period"`
+	}{strings.ToLower(protocol), period}
+
+	return hashedCacheKey("protocol-history", protocol, params)
+}
+
+// buildChainHistoryCacheKey creates a cache key for a chain's APY history
+func buildChainHistoryCacheKey(chain, period string) string {
+	params := struct {
+		Chain  string `json:"chain"`
+		Period string `json:"period"`
+	}{strings.ToLower(chain), period}
+
+	return hashedCacheKey("chain-history", chain, params)
+}
+
+// buildTrendingCacheKey creates a cache key for a page of trending pools.
+// The cached slice is exactly one page, so limit and offset are part of the key.
+func buildTrendingCacheKey(chain string, minGrowth float64, limit, offset int) string {
+	params := struct {
+		Chain     string  `json:"chain"`
+		MinGrowth float64 `json:"minGrowth"`
+		Limit     int     `json:"limit"`
+		Offset    int     `json:"offset"`
+	}{chain, minGrowth, limit, offset}
+
+	return hashedCacheKey("trending", chain, params)
+}
+
+// hashedCacheKey builds "<prefix>:<version>:<label>:<hash>", where hash is
+// the SHA-1 of the canonical JSON encoding of params (object keys sorted).
+// User input only reaches the key through the hash and the sanitized label,
+// so keys have a bounded length and can't collide through delimiters.
+func hashedCacheKey(prefix, label string, params interface{}) string {
+	canonical, err := canonicalJSON(params)
+	if err != nil {
+		// Filters are plain structs, so this shouldn't happen; fall back to
+		// Go's formatting, which is still deterministic for them
+		canonical = []byte(fmt.Sprintf("%+v", params))
+	}
+
+	sum := sha1.Sum(canonical)
+	key := prefix + ":" + cacheKeyVersion + ":" + cacheKeyLabel(label) + ":" + hex.EncodeToString(sum[:])
+
+	log.Trace().Str("cache_key", key).Bytes("params", canonical).Msg("Built cache key")
+
+	return key
+}
+
+// canonicalJSON encodes v as JSON with object keys sorted at every level
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through a generic value: maps are encoded with sorted keys,
+	// and UseNumber keeps numbers exactly as first encoded
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(generic)
+}
+
+// cacheKeyLabel reduces a label to lowercase ASCII letters, digits and '-',
+// truncated to maxCacheKeyLabelLength. An empty result becomes "all".
+func cacheKeyLabel(label string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(label) {
+		if sb.Len() >= maxCacheKeyLabelLength {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			sb.WriteRune(r)
+		case r == ' ' || r == '_':
+			sb.WriteByte('-')
+		}
+	}
+
+	if sb.Len() == 0 {
+		return "all"
+	}
+	return sb.String()
+}
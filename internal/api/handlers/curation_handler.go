@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// errCurationNotIndexed sends pool queries filtering by curation, which
+// ElasticSearch doesn't index, to PostgreSQL
+var errCurationNotIndexed = errors.New("curation is not indexed")
+
+// SetPoolCuration creates or replaces the curated attributes of a pool
+// @Summary Set pool curation
+// @Description Set attributes of a pool that no data source reports: whether its reward emissions follow a locked schedule or can be changed at will, whether it was audited, and notes. They are stored apart from the pool and survive its re-ingestion. Adjustable emissions behind a reward APY above 20% count as a risk indicator; an audit takes one more indicator to rate a pool high risk.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param id path string true "Pool ID"
+// @Param curation body models.PoolCuration true "Curated attributes; rewardSchedule defaults to unknown"
+// @Success 200 {object} models.PoolCuration
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/pools/{id}/curation [put]
+func (h *Handler) SetPoolCuration(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	poolID := c.Params("id")
+
+	if errors := ValidatePoolID(poolID); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+	curation, err := parsePoolCuration(c.Body())
+	if err != nil {
+		return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+	}
+	if errors := ValidatePoolCuration(curation); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	if err := h.pg.SetPoolCuration(ctx, poolID, &curation); err != nil {
+		return sendCurationError(c, poolID, err)
+	}
+	h.invalidateCuratedPool(ctx, poolID)
+
+	return c.JSON(curation)
+}
+
+// DeletePoolCuration removes the curated attributes of a pool
+// @Summary Delete pool curation
+// @Description Remove the curated attributes of a pool, leaving it uncurated.
+// @Tags admin
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param id path string true "Pool ID"
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/pools/{id}/curation [delete]
+func (h *Handler) DeletePoolCuration(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	poolID := c.Params("id")
+
+	if err := h.pg.DeletePoolCuration(ctx, poolID); err != nil {
+		return sendCurationError(c, poolID, err)
+	}
+	h.invalidateCuratedPool(ctx, poolID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// parsePoolCuration decodes curated attributes from a request body. The
+// timestamp is not accepted from clients.
+func parsePoolCuration(body []byte) (models.PoolCuration, error) {
+	var curation models.PoolCuration
+	if err := json.Unmarshal(body, &curation); err != nil {
+		return curation, errors.New("request body must be a JSON pool curation")
+	}
+
+	curation.RewardSchedule = strings.ToLower(strings.TrimSpace(curation.RewardSchedule))
+	if curation.RewardSchedule == "" {
+		curation.RewardSchedule = models.RewardScheduleUnknown
+	}
+	curation.CuratedAt = time.Time{}
+	return curation, nil
+}
+
+// sendCurationError reports a failed curation change as 404 if the pool or
+// its curation doesn't exist, 500 otherwise
+func sendCurationError(c *fiber.Ctx, poolID string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return SendError(c, ErrNotFound.WithDetails(fmt.Sprintf("Pool '%s' or its curation not found", poolID)))
+	}
+	log.Error().Err(err).Str("pool_id", poolID).Msg("Pool curation operation failed")
+	return SendError(c, ErrInternalServer)
+}
+
+// invalidateCuratedPool drops the cached detail of a pool whose curation
+// changed and retires the cached lists, which carry its curation flags
+func (h *Handler) invalidateCuratedPool(ctx context.Context, poolID string) {
+	if err := h.cache.InvalidatePoolCache(ctx, poolID); err != nil {
+		log.Warn().Err(err).Str("pool_id", poolID).Msg("Failed to invalidate cached pool")
+	}
+	if err := h.cache.InvalidateAllPoolsCache(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to invalidate cached pool lists")
+	}
+}
+
+// listCuration reduces the curation of listed pools to the compact flags.
+// PostgreSQL joins the curation in; pools found by ElasticSearch, which
+// doesn't index it, are looked up first. If that fails they are listed
+// without flags.
+func (h *Handler) listCuration(ctx context.Context, pools []models.Pool, backend string) {
+	if backend == backendES && len(pools) > 0 {
+		ids := make([]string, len(pools))
+		for i, pool := range pools {
+			ids[i] = pool.ID
+		}
+		curations, err := h.pg.GetPoolCurations(ctx, ids)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read curation of listed pools")
+			return
+		}
+		models.ApplyCuration(pools, curations)
+	}
+	models.CompactCuration(pools)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// HeaderDataSuspect is set on API responses while the worker's platform
+// monitor flags the latest data as suspect, listing the anomalies seen
+const HeaderDataSuspect = "X-Data-Suspect"
+
+// dataStatusTTL is how long a process reuses the data status it read, so
+// flagging responses costs one Redis read per process every few seconds
+const dataStatusTTL = 15 * time.Second
+
+// dataStatusSource reads whether the latest data looks suspect.
+// Implemented by the Redis repository.
+type dataStatusSource interface {
+	GetDataStatus(ctx context.Context) (*models.DataStatus, error)
+}
+
+// dataStatusCache holds the data status last read by this process
+type dataStatusCache struct {
+	mu     sync.Mutex
+	status *models.DataStatus
+	readAt time.Time
+}
+
+// MarkSuspectData is middleware setting X-Data-Suspect on responses while
+// the data is flagged suspect
+func (h *Handler) MarkSuspectData(c *fiber.Ctx) error {
+	if status := h.currentDataStatus(c.Context()); status != nil && status.Suspect {
+		c.Set(HeaderDataSuspect, strings.Join(status.Reasons, ","))
+	}
+	return c.Next()
+}
+
+// currentDataStatus returns the data status, read again once the cached
+// copy is older than dataStatusTTL. If it can't be read the last known
+// status is kept.
+func (h *Handler) currentDataStatus(ctx context.Context) *models.DataStatus {
+	if h.statusSource == nil {
+		return nil
+	}
+
+	h.status.mu.Lock()
+	defer h.status.mu.Unlock()
+
+	if !h.status.readAt.IsZero() && time.Since(h.status.readAt) < dataStatusTTL {
+		return h.status.status
+	}
+
+	status, err := h.statusSource.GetDataStatus(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to read data status")
+	} else {
+		h.status.status = status
+	}
+	h.status.readAt = time.Now()
+	return h.status.status
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+type fakeDataStatus struct {
+	status *models.DataStatus
+	err    error
+	reads  int
+}
+
+func (f *fakeDataStatus) GetDataStatus(context.Context) (*models.DataStatus, error) {
+	f.reads++
+	return f.status, f.err
+}
+
+func TestMarkSuspectData(t *testing.T) {
+	source := &fakeDataStatus{status: &models.DataStatus{Suspect: true, Reasons: []string{models.AnomalyTVLDrop, models.AnomalyPoolCountDrop}}}
+	h := &Handler{statusSource: source}
+
+	app := fiber.New()
+	app.Get("/", h.MarkSuspectData, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	get := func() string {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get(HeaderDataSuspect)
+	}
+
+	if got := get(); got != "tvl_drop,pool_count_drop" {
+		t.Errorf("Expected the anomalies listed, got %q", got)
+	}
+
+	// The status is cached, and kept when Redis can't be read
+	source.status, source.err = nil, errors.New("connection refused")
+	if got := get(); got == "" || source.reads != 1 {
+		t.Errorf("Expected the cached status reused, got %q after %d reads", got, source.reads)
+	}
+	h.status.readAt = h.status.readAt.Add(-dataStatusTTL)
+	if got := get(); got == "" || source.reads != 2 {
+		t.Errorf("Expected the last known status kept on errors, got %q after %d reads", got, source.reads)
+	}
+
+	source.status, source.err = &models.DataStatus{}, nil
+	h.status.readAt = h.status.readAt.Add(-dataStatusTTL)
+	if got := get(); got != "" {
+		t.Errorf("Expected no header for healthy data, got %q", got)
+	}
+}
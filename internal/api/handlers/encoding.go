@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// MessagePack media types. application/x-msgpack is still sent by older clients.
+const (
+	MIMEApplicationMsgpack  = "application/msgpack"
+	MIMEApplicationXMsgpack = "application/x-msgpack"
+)
+
+func init() {
+	// Encode decimals as strings, the same as their JSON form, so values
+	// round-trip exactly and non-Go clients don't need a custom extension
+	msgpack.Register(decimal.Decimal{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeString(v.Interface().(decimal.Decimal).String())
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			parsed, err := decimal.NewFromString(s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(parsed))
+			return nil
+		},
+	)
+}
+
+// sendNegotiated writes v as MessagePack when the Accept header prefers it,
+// and as JSON otherwise.
+//
+// Redis keeps caching the JSON encoding only and the negotiated format is
+// applied here, on every response. That costs a decode and re-encode on
+// MessagePack cache hits, but keeps a single cached copy per filter, so
+// invalidation and memory use are unchanged and the two formats can never
+// disagree. Caching both encodings would save the re-encode at the price of
+// twice the keys for the busiest endpoints.
+func sendNegotiated(c *fiber.Ctx, v interface{}) error {
+	c.Vary(fiber.HeaderAccept)
+
+	format := c.Accepts(fiber.MIMEApplicationJSON, MIMEApplicationMsgpack, MIMEApplicationXMsgpack)
+	if format != MIMEApplicationMsgpack && format != MIMEApplicationXMsgpack {
+		return c.JSON(v)
+	}
+
+	data, err := marshalMsgpack(v)
+	if err != nil {
+		return SendError(c, ErrInternalServer.WithDetails("Failed to encode response"))
+	}
+
+	c.Set(fiber.HeaderContentType, format)
+	return c.Send(data)
+}
+
+// marshalMsgpack encodes v using the JSON field names, so both formats
+// share one schema
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMsgpack decodes data produced by marshalMsgpack into v
+func unmarshalMsgpack(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// servePools fills the relative times of pools about to be served
+func servePools(pools []models.Pool) {
+	for i := range pools {
+		pools[i].SetRelativeTimes()
+	}
+}
+
+// serveOpportunities fills the relative times of opportunities about to be
+// served
+func serveOpportunities(opportunities []models.Opportunity) {
+	for i := range opportunities {
+		opportunities[i].SetRelativeTimes()
+	}
+}
+
+// serveTrending fills the relative times of trending pools about to be
+// served
+func serveTrending(trending []models.TrendingPool) {
+	for _, t := range trending {
+		if t.Pool != nil {
+			t.Pool.SetRelativeTimes()
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func samplePoolList(n int) models.PoolListResponse {
+	pools := make([]models.Pool, n)
+	for i := range pools {
+		pools[i] = models.Pool{
+			ID:               fmt.Sprintf("pool-%04d", i),
+			Chain:            "ethereum",
+			Protocol:         "aave-v3",
+			Symbol:           "USDC-WETH",
+			TVL:              decimal.RequireFromString("1234567890.123456789"),
+			APY:              decimal.RequireFromString("12.3456789012345678"),
+			APYBase:          decimal.RequireFromString("4.5"),
+			APYReward:        decimal.RequireFromString("7.8456789012345678"),
+			Score:            decimal.NewFromFloat(71.25),
+			DataCompleteness: decimal.RequireFromString("0.8333"),
+			RewardTokens:     []string{"0xabc", "0xdef"},
+			UpdatedAt:        time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC),
+		}
+	}
+
+	return models.PoolListResponse{Data: pools, Total: int64(n), Limit: n, HasMore: true}
+}
+
+func newNegotiationApp(v interface{}) *fiber.App {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return sendNegotiated(c, v) })
+	return app
+}
+
+func TestSendNegotiated_ContentType(t *testing.T) {
+	app := newNegotiationApp(samplePoolList(2))
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", fiber.MIMEApplicationJSON},
+		{"*/*", fiber.MIMEApplicationJSON},
+		{"application/json", fiber.MIMEApplicationJSON},
+		{"application/msgpack", MIMEApplicationMsgpack},
+		{"application/x-msgpack", MIMEApplicationXMsgpack},
+		{"application/json;q=0.5, application/msgpack", MIMEApplicationMsgpack},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set(fiber.HeaderAccept, tt.accept)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if ct := resp.Header.Get(fiber.HeaderContentType); ct != tt.want {
+				t.Errorf("Expected Content-Type %s, got %s", tt.want, ct)
+			}
+			if vary := resp.Header.Get(fiber.HeaderVary); vary != fiber.HeaderAccept {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+		})
+	}
+}
+
+func TestSendNegotiated_MsgpackRoundTrip(t *testing.T) {
+	original := samplePoolList(3)
+	app := newNegotiationApp(original)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderAccept, MIMEApplicationMsgpack)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+
+	var decoded models.PoolListResponse
+	if err := unmarshalMsgpack(body, &decoded); err != nil {
+		t.Fatalf("Failed to decode msgpack: %v", err)
+	}
+
+	if decoded.Total != original.Total || decoded.HasMore != original.HasMore || len(decoded.Data) != len(original.Data) {
+		t.Fatalf("Expected %d pools (total %d), got %d (total %d)", len(original.Data), original.Total, len(decoded.Data), decoded.Total)
+	}
+
+	got, want := decoded.Data[0], original.Data[0]
+	decimals := []struct {
+		name      string
+		got, want decimal.Decimal
+	}{
+		{"tvl", got.TVL, want.TVL},
+		{"apy", got.APY, want.APY},
+		{"apyReward", got.APYReward, want.APYReward},
+		{"score", got.Score, want.Score},
+		{"dataCompleteness", got.DataCompleteness, want.DataCompleteness},
+	}
+	for _, d := range decimals {
+		if !d.got.Equal(d.want) {
+			t.Errorf("%s: expected %s, got %s", d.name, d.want, d.got)
+		}
+	}
+
+	if got.ID != want.ID || !got.UpdatedAt.Equal(want.UpdatedAt) || len(got.RewardTokens) != 2 {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestMarshalMsgpack_UsesJSONFieldNames(t *testing.T) {
+	data, err := marshalMsgpack(models.PoolListResponse{HasMore: true})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var generic map[string]interface{}
+	if err := unmarshalMsgpack(data, &generic); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if generic["hasMore"] != true {
+		t.Errorf("Expected hasMore key, got %v", generic)
+	}
+}
+
+func BenchmarkEncodePoolList(b *testing.B) {
+	response := samplePoolList(100)
+
+	b.Run("json", func(b *testing.B) {
+		var size int
+		for i := 0; i < b.N; i++ {
+			data, err := json.Marshal(response)
+			if err != nil {
+				b.Fatal(err)
+			}
+			size = len(data)
+		}
+		b.ReportMetric(float64(size), "bytes/payload")
+	})
+
+	b.Run("msgpack", func(b *testing.B) {
+		var size int
+		for i := 0; i < b.N; i++ {
+			data, err := marshalMsgpack(response)
+			if err != nil {
+				b.Fatal(err)
+			}
+			size = len(data)
+		}
+		b.ReportMetric(float64(size), "bytes/payload")
+	})
+}
+
+func BenchmarkDecodePoolList(b *testing.B) {
+	response := samplePoolList(100)
+	jsonData, _ := json.Marshal(response)
+	msgpackData, _ := marshalMsgpack(response)
+
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var decoded models.PoolListResponse
+			if err := json.Unmarshal(jsonData, &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("msgpack", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var decoded models.PoolListResponse
+			if err := unmarshalMsgpack(msgpackData, &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -12,6 +12,7 @@ var (
 	ErrTooManyRequests     = NewAPIError(fiber.StatusTooManyRequests, "RATE_LIMITED", "Too many requests")
 	ErrValidationFailed    = NewAPIError(fiber.StatusUnprocessableEntity, "VALIDATION_FAILED", "Validation failed")
 	ErrServiceUnavailable  = NewAPIError(fiber.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Service temporarily unavailable")
+	ErrConflict            = NewAPIError(fiber.StatusConflict, "CONFLICT", "Request conflicts with an operation in progress")
 )
 
 // APIError represents a structured API error
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// poolFields are the fields a pool list can be trimmed to with ?fields=
+var poolFields = newFieldSet(reflect.TypeOf(models.Pool{}))
+
+// fieldSet maps the JSON names of a struct's fields to the fields, so
+// responses can be projected onto a requested subset without the
+// repositories knowing about it
+type fieldSet struct {
+	index     map[string]int  // JSON name to struct field index
+	omitEmpty map[string]bool // Fields tagged omitempty
+	names     []string        // Sorted JSON names, for error messages
+}
+
+// newFieldSet reads the JSON names of the exported fields of a struct type
+func newFieldSet(t reflect.Type) fieldSet {
+	set := fieldSet{index: make(map[string]int), omitEmpty: make(map[string]bool)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		set.index[name] = i
+		set.omitEmpty[name] = strings.Contains(opts, "omitempty")
+		set.names = append(set.names, name)
+	}
+	sort.Strings(set.names)
+
+	return set
+}
+
+// parse splits a comma-separated fields parameter. An empty parameter
+// selects every field and returns nil.
+func (s fieldSet) parse(raw string) ([]string, []ValidationError) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var fields, unknown []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if _, ok := s.index[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields = append(fields, name)
+	}
+
+	if len(unknown) > 0 {
+		return nil, []ValidationError{{
+			Field:   "fields",
+			Message: fmt.Sprintf("unknown fields %s; valid fields are %s", strings.Join(unknown, ", "), strings.Join(s.names, ", ")),
+		}}
+	}
+	if len(fields) == 0 {
+		return nil, []ValidationError{{Field: "fields", Message: "must name at least one field"}}
+	}
+
+	return fields, nil
+}
+
+// project copies the selected fields of a struct value into a map keyed by
+// JSON name. Values keep their types, so decimals and times encode the same
+// way as in the full struct, in JSON and MessagePack alike.
+func (s fieldSet) project(v reflect.Value, fields []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		value := v.Field(s.index[name])
+		if s.omitEmpty[name] && value.IsZero() {
+			continue
+		}
+		out[name] = value.Interface()
+	}
+	return out
+}
+
+// projectedPoolList is a PoolListResponse whose pools are trimmed to the
+// requested fields
+type projectedPoolList struct {
+	Data       []map[string]interface{} `json:"data"`
+	Total      int64                    `json:"total"`
+	Limit      int                      `json:"limit"`
+	Offset     int                      `json:"offset"`
+	HasMore    bool                     `json:"hasMore"`
+	Sparklines map[string][]float64     `json:"sparklines,omitempty"`
+}
+
+// projectPoolList prepares a list response to be served: relative times
+// are filled in and pools trimmed to the given fields. Nil fields keep
+// every field.
+func projectPoolList(response *models.PoolListResponse, fields []string) interface{} {
+	servePools(response.Data)
+	if fields == nil {
+		return response
+	}
+
+	data := make([]map[string]interface{}, len(response.Data))
+	for i := range response.Data {
+		data[i] = poolFields.project(reflect.ValueOf(response.Data[i]), fields)
+	}
+
+	return projectedPoolList{
+		Data:       data,
+		Total:      response.Total,
+		Limit:      response.Limit,
+		Offset:     response.Offset,
+		HasMore:    response.HasMore,
+		Sparklines: response.Sparklines,
+	}
+}
+
+// projectPoolSearch prepares a search response as projectPoolList does,
+// keeping the highlights of trimmed pools
+func projectPoolSearch(response *models.PoolSearchResponse, fields []string) interface{} {
+	for i := range response.Data {
+		response.Data[i].Pool.SetRelativeTimes()
+	}
+	if fields == nil {
+		return response
+	}
+
+	data := make([]map[string]interface{}, len(response.Data))
+	for i, hit := range response.Data {
+		data[i] = poolFields.project(reflect.ValueOf(hit.Pool), fields)
+		if len(hit.Highlights) > 0 {
+			data[i]["highlights"] = hit.Highlights
+		}
+	}
+
+	return projectedPoolList{
+		Data:       data,
+		Total:      response.Total,
+		Limit:      response.Limit,
+		Offset:     response.Offset,
+		HasMore:    response.HasMore,
+		Sparklines: response.Sparklines,
+	}
+}
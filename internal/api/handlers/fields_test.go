@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestPoolFields_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty selects all", raw: ""},
+		{name: "valid", raw: "id,chain,apy,tvl", want: []string{"id", "chain", "apy", "tvl"}},
+		{name: "spaces and duplicates", raw: " id , apy,id,", want: []string{"id", "apy"}},
+		{name: "unknown field", raw: "id,apr,foo", wantErr: "unknown fields apr, foo"},
+		{name: "untagged name", raw: "APY", wantErr: "unknown fields APY"},
+		{name: "only commas", raw: ",,", wantErr: "at least one field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := poolFields.parse(tt.raw)
+			if tt.wantErr != "" {
+				if len(errs) != 1 || errs[0].Field != "fields" || !strings.Contains(errs[0].Message, tt.wantErr) {
+					t.Errorf("Expected a fields error containing %q, got %+v", tt.wantErr, errs)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("Unexpected errors: %+v", errs)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProjectPoolList(t *testing.T) {
+	pool := models.Pool{
+		ID:        "pool-1",
+		Chain:     "ethereum",
+		Protocol:  "aave-v3",
+		Symbol:    "USDC",
+		TVL:       decimal.RequireFromString("1500000.25"),
+		APY:       decimal.RequireFromString("4.100"),
+		Score:     decimal.RequireFromString("72.5"),
+		UpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	response := &models.PoolListResponse{Data: []models.Pool{pool}, Total: 1, Limit: 50, HasMore: false}
+
+	decode := func(v interface{}) map[string]json.RawMessage {
+		t.Helper()
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		var list struct {
+			Data  []map[string]json.RawMessage `json:"data"`
+			Total int64                        `json:"total"`
+			Limit int                          `json:"limit"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		if len(list.Data) != 1 || list.Total != 1 || list.Limit != 50 {
+			t.Fatalf("Expected the list envelope kept, got %s", data)
+		}
+		return list.Data[0]
+	}
+
+	full := decode(projectPoolList(response, nil))
+	if len(full) < 20 {
+		t.Fatalf("Expected every pool field without a field set, got %d", len(full))
+	}
+	// Relative times are filled as the list is served; past a week they
+	// are dates
+	if string(full["updatedAgo"]) != `"May 1, 2024"` {
+		t.Errorf("Expected updatedAgo alongside updatedAt, got %s", full["updatedAgo"])
+	}
+
+	fields := []string{"id", "apy", "tvl", "updatedAt", "matchQuality"}
+	trimmed := decode(projectPoolList(response, fields))
+
+	keys := make([]string, 0, len(trimmed))
+	for key := range trimmed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// matchQuality is omitempty and unset, as in the full response
+	if strings.Join(keys, ",") != "apy,id,tvl,updatedAt" {
+		t.Errorf("Expected only the requested fields, got %v", keys)
+	}
+	for _, key := range []string{"chain", "score", "apyBase", "createdAt"} {
+		if _, ok := trimmed[key]; ok {
+			t.Errorf("Expected %s to be left out", key)
+		}
+	}
+
+	// Values serialize exactly as in the full response
+	for _, key := range keys {
+		if string(trimmed[key]) != string(full[key]) {
+			t.Errorf("%s: expected %s, got %s", key, full[key], trimmed[key])
+		}
+	}
+	if string(trimmed["apy"]) != `"4.1"` || string(trimmed["tvl"]) != `"1500000.25"` {
+		t.Errorf("Expected decimals as strings, got apy %s and tvl %s", trimmed["apy"], trimmed["tvl"])
+	}
+}
+
+func TestProjectPoolList_Msgpack(t *testing.T) {
+	response := &models.PoolListResponse{Data: []models.Pool{{ID: "pool-1", APY: decimal.RequireFromString("12.345")}}, Total: 1}
+
+	data, err := marshalMsgpack(projectPoolList(response, []string{"id", "apy"}))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	var decoded struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := unmarshalMsgpack(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(decoded.Data) != 1 || len(decoded.Data[0]) != 2 || decoded.Data[0]["apy"] != "12.345" || decoded.Data[0]["id"] != "pool-1" {
+		t.Errorf("Expected id and apy as a string, got %v", decoded.Data)
+	}
+}
+
+func TestProjectPoolSearch(t *testing.T) {
+	response := &models.PoolSearchResponse{
+		Data: []models.PoolSearchHit{
+			{Pool: models.Pool{ID: "pool-1", Protocol: "aave-v3"}, Highlights: map[string][]string{"protocol": {"<em>aave</em>-v3"}}},
+			{Pool: models.Pool{ID: "pool-2", Protocol: "compound"}},
+		},
+		Total: 2,
+	}
+
+	data, err := json.Marshal(projectPoolSearch(response, []string{"id"}))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	want := `{"data":[{"highlights":{"protocol":["\u003cem\u003eaave\u003c/em\u003e-v3"]},"id":"pool-1"},{"id":"pool-2"}],"total":2,"limit":0,"offset":0,"hasMore":false}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	// Without a field set the hits keep every pool field inline
+	data, err = json.Marshal(projectPoolSearch(response, nil))
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var full struct {
+		Data []map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &full); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if _, ok := full.Data[0]["apy"]; !ok || full.Data[0]["highlights"] == nil || full.Data[1]["highlights"] != nil {
+		t.Errorf("Expected inline pool fields with highlights only where set, got %s", data)
+	}
+}
@@ -2,24 +2,77 @@
 package handlers
 
 import (
+	"context"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+	"github.com/maxjove/defi-yield-aggregator/internal/cache"
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
 	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/reindex"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/rewards"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
 )
 
 // Handler holds all dependencies for HTTP handlers
 type Handler struct {
-	config *config.Config
-	pg     *postgres.Repository
-	redis  *redis.Repository
-	es     *elasticsearch.Repository
-	startTime time.Time
+	config        *config.Config
+	pg            *postgres.Repository
+	redis         *redis.Repository // Health and data status; responses are cached in cache
+	cache         cache.Cache
+	es            *elasticsearch.Repository
+	ingestion     *ingestion.Service
+	opportunities *opportunity.Service
+	snapshots     *snapshot.Service // nil when snapshot archiving is disabled
+	reindex       *reindex.Service
+	rewards       *rewards.Service
+	metrics       *metrics.Collector
+	updates       updateFeed
+	history       historyStreamer
+	sparklines    sparklineSource
+	trending      trendingSource
+	pools         *poolLoader
+	loads         singleflight.Group // Shares cache-miss loads between concurrent requests of this process
+	counters      *loadCounters
+	statusSource  dataStatusSource
+	status        dataStatusCache
+	startTime     time.Time
+}
+
+// updateFeed serves long polls for pool updates and server-sent event
+// streams of opportunity alerts.
+// Implemented by the WebSocket hub.
+type updateFeed interface {
+	PollPoolUpdates(ctx context.Context, cursor uint64, timeout time.Duration, match func(*models.Pool) bool) models.PoolUpdateBatch
+	StreamOpportunities(lastSeq uint64, filter models.OpportunityStreamFilter) (events <-chan models.OpportunityEvent, stop func(), ok bool)
+}
+
+// historyStreamer reads a pool's bucketed history a bucket at a time.
+// Implemented by the PostgreSQL repository.
+type historyStreamer interface {
+	StreamPoolHistory(ctx context.Context, poolID string, since time.Time, bucket string, loc *time.Location, limit int, fn func(models.HistoricalAPY) error) error
+}
+
+// sparklineSource reads the hourly APY of a page of pools in one query.
+// Implemented by the PostgreSQL repository.
+type sparklineSource interface {
+	GetPoolSparklines(ctx context.Context, ids []string, since time.Time) (map[string][]float64, error)
+}
+
+// trendingSource reads a page of pools with growing APY.
+// Implemented by the PostgreSQL repository.
+type trendingSource interface {
+	GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error)
 }
 
 // NewHandler creates a new Handler with all dependencies
@@ -27,14 +80,62 @@ func NewHandler(
 	cfg *config.Config,
 	pg *postgres.Repository,
 	redis *redis.Repository,
+	responseCache cache.Cache,
 	es *elasticsearch.Repository,
+	ingestion *ingestion.Service,
+	opportunities *opportunity.Service,
+	snapshots *snapshot.Service,
+	reindexService *reindex.Service,
+	rewardsService *rewards.Service,
+	metricsCollector *metrics.Collector,
+	updates updateFeed,
 ) *Handler {
-	return &Handler{
-		config: cfg,
-		pg:     pg,
-		redis:  redis,
-		es:     es,
-		startTime: time.Now(),
+	counters := &loadCounters{}
+	if metricsCollector != nil {
+		metricsCollector.AddProcessSource(counters.families)
+		if redis != nil {
+			metricsCollector.AddProcessSource(redisFamilies(redis))
+		}
+		if tiered, ok := responseCache.(*cache.Tiered); ok {
+			metricsCollector.AddProcessSource(tiered.Families)
+		}
+	}
+	h := &Handler{
+		config:        cfg,
+		pg:            pg,
+		redis:         redis,
+		cache:         responseCache,
+		es:            es,
+		ingestion:     ingestion,
+		opportunities: opportunities,
+		snapshots:     snapshots,
+		reindex:       reindexService,
+		rewards:       rewardsService,
+		metrics:       metricsCollector,
+		updates:       updates,
+		history:       pg,
+		sparklines:    pg,
+		trending:      pg,
+		pools:         &poolLoader{cache: responseCache, store: pg, counters: counters},
+		counters:      counters,
+		startTime:     time.Now(),
+	}
+	if redis != nil {
+		h.statusSource = redis
+	}
+	return h
+}
+
+// redisFamilies returns the metric families of the circuit breaker
+// guarding this process's Redis calls
+func redisFamilies(r *redis.Repository) func() []metrics.Family {
+	return func() []metrics.Family {
+		return []metrics.Family{{
+			Name:    "defi_cache_unavailable_total",
+			Help:    "Redis calls skipped while Redis was unavailable, cache reads served as misses",
+			Type:    "counter",
+			Samples: []metrics.Sample{{Value: float64(r.UnavailableCount())}},
+		}}
 	}
 }
 
@@ -67,15 +168,18 @@ func (h *Handler) HealthCheck(c *fiber.Ctx) error {
 		Status:  boolToStatus(redisErr == nil),
 		Latency: time.Since(redisStart).String(),
 		Message: errToMessage(redisErr),
+		Breaker: string(h.redis.BreakerState()),
 	}
 
 	// Check ElasticSearch
 	esStart := time.Now()
 	esErr := h.es.Ping(ctx)
+	esBreaker := h.es.BreakerState()
 	health.Services["elasticsearch"] = models.ServiceHealth{
 		Status:  boolToStatus(esErr == nil),
 		Latency: time.Since(esStart).String(),
 		Message: errToMessage(esErr),
+		Breaker: string(esBreaker),
 	}
 
 	// Determine overall health
@@ -83,7 +187,13 @@ func (h *Handler) HealthCheck(c *fiber.Ctx) error {
 		health.Status = "unhealthy"
 		return c.Status(fiber.StatusServiceUnavailable).JSON(health)
 	}
-	if esErr != nil {
+	// Searches are served from PostgreSQL while the breaker is open
+	if esErr != nil || esBreaker == breaker.StateOpen {
+		health.Status = "degraded"
+	}
+
+	// The platform monitor flagged the latest data
+	if health.Data = h.currentDataStatus(ctx); health.Data != nil && health.Data.Suspect {
 		health.Status = "degraded"
 	}
 
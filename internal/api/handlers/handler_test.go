@@ -1,8 +1,17 @@
 package handlers
 
 import (
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
 
@@ -22,10 +31,17 @@ func TestBuildPoolsCacheKey(t *testing.T) {
 	}
 
 	key := buildPoolsCacheKey(filter)
-	expected := "pools:ethereum:aave-v3:tvl:desc:50:0"
+	if !regexp.MustCompile(`^pools:v2:ethereum:[0-9a-f]{40}$`).MatchString(key) {
+		t.Errorf("Unexpected cache key format %s", key)
+	}
 
-	if key != expected {
-		t.Errorf("Expected cache key %s, got %s", expected, key)
+	// Keys are stable for equal filters and differ otherwise
+	if again := buildPoolsCacheKey(filter); again != key {
+		t.Errorf("Expected stable cache key, got %s then %s", key, again)
+	}
+	filter.Offset = 50
+	if buildPoolsCacheKey(filter) == key {
+		t.Error("Expected a different offset to produce a different cache key")
 	}
 }
 
@@ -40,10 +56,77 @@ func TestBuildOpportunitiesCacheKey(t *testing.T) {
 	}
 
 	key := buildOpportunitiesCacheKey(filter)
-	expected := "opportunities:yield-gap:low:ethereum:score:desc:true"
+	if !regexp.MustCompile(`^opportunities:v2:ethereum:[0-9a-f]{40}$`).MatchString(key) {
+		t.Errorf("Unexpected cache key format %s", key)
+	}
+
+	// MinScore was missing from the old key
+	filter.MinScore = decimal.NewFromFloat(70)
+	if buildOpportunitiesCacheKey(filter) == key {
+		t.Error("Expected minScore to change the cache key")
+	}
+}
+
+func TestCacheKeys_DelimiterCollisions(t *testing.T) {
+	// Each pair joined to the same string under the old ':'-delimited keys
+	poolPairs := [][2]models.PoolFilter{
+		{{Symbol: "usdc:curve"}, {Symbol: "usdc", Search: "curve"}},
+		{{Chain: "ethereum:aave-v3"}, {Chain: "ethereum", Protocol: "aave-v3"}},
+		{{Symbol: "a:"}, {Symbol: "a", Search: ":"}},
+	}
+	for _, pair := range poolPairs {
+		if buildPoolsCacheKey(pair[0]) == buildPoolsCacheKey(pair[1]) {
+			t.Errorf("Expected different keys for %+v and %+v", pair[0], pair[1])
+		}
+	}
+
+	protocolA := models.ProtocolFilter{Chain: "a:b"}
+	protocolB := models.ProtocolFilter{Chain: "a", Category: "b"}
+	if buildProtocolsCacheKey(protocolA) == buildProtocolsCacheKey(protocolB) {
+		t.Error("Expected different protocol keys for delimiter-containing input")
+	}
+}
+
+func TestBuildTrendingCacheKey_Pagination(t *testing.T) {
+	// Each page is cached separately; otherwise offset=20 would be served
+	// the cached first page and a new limit would return the old page size
+	pages := []struct {
+		limit, offset int
+	}{
+		{20, 0},
+		{20, 20},
+		{20, 40},
+		{10, 0},
+		{50, 0},
+	}
+
+	seen := make(map[string]int)
+	for i, page := range pages {
+		key := buildTrendingCacheKey("ethereum", 10, page.limit, page.offset)
+		if j, ok := seen[key]; ok {
+			t.Errorf("Pages %+v and %+v share cache key %s", pages[j], page, key)
+		}
+		seen[key] = i
+	}
 
-	if key != expected {
-		t.Errorf("Expected cache key %s, got %s", expected, key)
+	if a, b := buildTrendingCacheKey("ethereum", 10, 20, 20), buildTrendingCacheKey("ethereum", 10, 20, 20); a != b {
+		t.Errorf("Expected stable key for the same page, got %s then %s", a, b)
+	}
+}
+
+func TestCacheKeys_LabelSanitized(t *testing.T) {
+	key := buildPoolsCacheKey(models.PoolFilter{Chain: "Éther:eum " + strings.Repeat("x", 500)})
+
+	parts := strings.Split(key, ":")
+	if len(parts) != 4 {
+		t.Fatalf("Expected 4 key segments, got %d in %s", len(parts), key)
+	}
+	if len(parts[2]) > maxCacheKeyLabelLength || !regexp.MustCompile(`^[a-z0-9-]+$`).MatchString(parts[2]) {
+		t.Errorf("Expected a short ASCII label, got %q", parts[2])
+	}
+
+	if key := buildTrendingCacheKey("", 5, 20, 0); !strings.HasPrefix(key, "trending:v2:all:") {
+		t.Errorf("Expected empty chain to use the 'all' label, got %s", key)
 	}
 }
 
@@ -68,6 +151,71 @@ func TestValidatePoolID(t *testing.T) {
 	}
 }
 
+func TestValidateProtocolName(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		hasError bool
+	}{
+		{"valid name", "aave-v3", false},
+		{"empty name", "", true},
+		{"long name", strings.Repeat("x", 101), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateProtocolName(tt.protocol)
+			if (len(errors) > 0) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+		})
+	}
+}
+
+func TestBuildProtocolHistoryCacheKey(t *testing.T) {
+	key := buildProtocolHistoryCacheKey("aave-v3", "7d")
+	if !strings.HasPrefix(key, "protocol-history:v2:aave-v3:") {
+		t.Errorf("Expected the protocol as the key label, got %s", key)
+	}
+	if key == buildProtocolHistoryCacheKey("aave-v3", "30d") {
+		t.Error("Expected periods to be cached separately")
+	}
+}
+
+func TestValidateChainName(t *testing.T) {
+	tests := []struct {
+		name     string
+		chain    string
+		hasError bool
+	}{
+		{"valid name", "ethereum", false},
+		{"empty name", "", true},
+		{"long name", strings.Repeat("x", 51), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateChainName(tt.chain)
+			if (len(errors) > 0) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+		})
+	}
+}
+
+func TestBuildChainHistoryCacheKey(t *testing.T) {
+	// Chains match case-insensitively, so they share an entry
+	if a, b := buildChainHistoryCacheKey("Ethereum", "7d"), buildChainHistoryCacheKey("ethereum", "7d"); a != b {
+		t.Errorf("Expected one entry per chain regardless of case, got %s and %s", a, b)
+	}
+	if buildChainHistoryCacheKey("ethereum", "7d") == buildChainHistoryCacheKey("ethereum", "30d") {
+		t.Error("Expected periods to be cached separately")
+	}
+	if buildChainHistoryCacheKey("ethereum", "7d") == buildProtocolHistoryCacheKey("ethereum", "7d") {
+		t.Error("Expected chain and protocol histories not to share keys")
+	}
+}
+
 func TestValidatePeriod(t *testing.T) {
 	tests := []struct {
 		period   string
@@ -92,6 +240,35 @@ func TestValidatePeriod(t *testing.T) {
 	}
 }
 
+func TestValidateHistoryBucketing(t *testing.T) {
+	tests := []struct {
+		name     string
+		bucket   string
+		tz       string
+		wantZone string
+		hasError bool
+	}{
+		{"defaults", "", "", "UTC", false},
+		{"daily in tokyo", "1d", "Asia/Tokyo", "Asia/Tokyo", false},
+		{"unknown bucket", "2h", "", "", true},
+		{"unknown zone", "1h", "Mars/Olympus", "", true},
+		{"server zone", "1h", "Local", "", true},
+		{"abbreviation", "1h", "JST", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, errors := ValidateHistoryBucketing(tt.bucket, tt.tz)
+			if (len(errors) > 0) != tt.hasError {
+				t.Fatalf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+			if !tt.hasError && loc.String() != tt.wantZone {
+				t.Errorf("Expected zone %s, got %s", tt.wantZone, loc)
+			}
+		})
+	}
+}
+
 func TestAPIError(t *testing.T) {
 	err := NewAPIError(400, "BAD_REQUEST", "Invalid input")
 
@@ -112,3 +289,501 @@ func TestAPIError(t *testing.T) {
 		t.Errorf("Expected details 'Field is missing', got %s", withDetails.Details)
 	}
 }
+
+func TestParsePoolFilter_RankMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		hasError bool
+		wantMode string
+	}{
+		{"default", "", false, models.RankModeStandard},
+		{"decayed with score sort", "?sortBy=score&rankMode=decayed", false, models.RankModeDecayed},
+		{"decayed with tvl sort", "?sortBy=tvl&rankMode=decayed", true, models.RankModeDecayed},
+		{"unknown mode", "?sortBy=score&rankMode=random", true, "random"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter models.PoolFilter
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/pools", func(c *fiber.Ctx) error {
+				filter, errors = ParsePoolFilter(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/pools"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if (len(errors) > 0) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+			if filter.RankMode != tt.wantMode {
+				t.Errorf("Expected rank mode %s, got %s", tt.wantMode, filter.RankMode)
+			}
+		})
+	}
+}
+
+func TestParsePoolFilter_IncludeEmpty(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", false},
+		{"?includeEmpty=true", true},
+		{"?includeEmpty=1", true},
+		{"?includeEmpty=false", false},
+	}
+
+	for _, tt := range tests {
+		var filter models.PoolFilter
+		app := fiber.New()
+		app.Get("/pools", func(c *fiber.Ctx) error {
+			filter, _ = ParsePoolFilter(c)
+			return nil
+		})
+
+		if _, err := app.Test(httptest.NewRequest("GET", "/pools"+tt.query, nil)); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if filter.IncludeEmpty != tt.want {
+			t.Errorf("%q: Expected includeEmpty=%v, got %v", tt.query, tt.want, filter.IncludeEmpty)
+		}
+	}
+}
+
+func TestListingFloor(t *testing.T) {
+	h := &Handler{config: &config.Config{Listing: config.ListingConfig{MinTVL: 1}}}
+
+	if floor := h.listingFloor(false); !floor.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Expected a floor of 1, got %s", floor)
+	}
+	if floor := h.listingFloor(true); !floor.IsZero() {
+		t.Errorf("Expected no floor with includeEmpty, got %s", floor)
+	}
+}
+
+func TestOpportunityScoreFloor(t *testing.T) {
+	tests := []struct {
+		name      string
+		floor     float64
+		query     string
+		wantScore decimal.Decimal
+	}{
+		{"configured floor by default", 40, "", decimal.NewFromInt(40)},
+		{"minScore=0 lists everything", 40, "?minScore=0", decimal.Zero},
+		{"explicit minScore", 40, "?minScore=25", decimal.NewFromInt(25)},
+		{"no floor configured", 0, "", decimal.Zero},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{config: &config.Config{Listing: config.ListingConfig{MinOpportunityScore: tt.floor}}}
+
+			var filter models.OpportunityFilter
+			app := fiber.New()
+			app.Get("/opportunities", func(c *fiber.Ctx) error {
+				filter, _ = ParseOpportunityFilter(c)
+				filter.MinScore = h.opportunityScoreFloor(c, filter.MinScore)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/opportunities"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if !filter.MinScore.Equal(tt.wantScore) {
+				t.Errorf("Expected minScore %s, got %s", tt.wantScore, filter.MinScore)
+			}
+		})
+	}
+}
+
+func TestParseOpportunityFilter_DetectedAt(t *testing.T) {
+	now := time.Now().UTC()
+	stamp := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	tests := []struct {
+		name      string
+		query     string
+		wantField string        // Field of the expected validation error, if any
+		wantSpan  time.Duration // Expected distance of detectedAfter from now
+	}{
+		{"default look-back", "", "", models.DefaultOpportunityLookback},
+		{"explicit detectedAfter", "?detectedAfter=" + stamp(-30*24*time.Hour), "", 30 * 24 * time.Hour},
+		{"only detectedBefore", "?detectedBefore=" + stamp(-24*time.Hour), "", 8 * 24 * time.Hour},
+		{"beyond the maximum", "?detectedAfter=" + stamp(-91*24*time.Hour), "detectedAfter", 0},
+		{"default beyond the maximum", "?detectedBefore=" + stamp(-85*24*time.Hour), "detectedBefore", 0},
+		{"empty range", "?detectedAfter=" + stamp(-time.Hour) + "&detectedBefore=" + stamp(-2*time.Hour), "detectedBefore", 0},
+		{"malformed", "?detectedAfter=yesterday", "detectedAfter", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter models.OpportunityFilter
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/opportunities", func(c *fiber.Ctx) error {
+				filter, errors = ParseOpportunityFilter(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/opportunities"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if tt.wantField != "" {
+				if len(errors) != 1 || errors[0].Field != tt.wantField {
+					t.Fatalf("Expected one error on %s, got %v", tt.wantField, errors)
+				}
+				return
+			}
+			if len(errors) > 0 {
+				t.Fatalf("Unexpected errors: %v", errors)
+			}
+			// The default bound is truncated to the minute
+			if span := now.Sub(filter.DetectedAfter); span < tt.wantSpan-time.Minute || span > tt.wantSpan+time.Minute {
+				t.Errorf("Expected detectedAfter %s before now, got %s", tt.wantSpan, span)
+			}
+		})
+	}
+}
+
+func TestBuildPoolsCacheKey_RankMode(t *testing.T) {
+	standard := models.PoolFilter{SortBy: "score", SortOrder: "desc", RankMode: models.RankModeStandard, Limit: 50}
+	decayed := standard
+	decayed.RankMode = models.RankModeDecayed
+
+	if buildPoolsCacheKey(standard) == buildPoolsCacheKey(decayed) {
+		t.Error("Expected rank modes to produce different cache keys")
+	}
+}
+
+func TestParsePoolFilter_VolumeFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		hasError  bool
+		wantVol   string
+		wantRatio string
+	}{
+		{"unset", "", false, "0", "0"},
+		{"both set", "?minVolume1d=100000&minVolumeTvlRatio=0.05", false, "100000", "0.05"},
+		{"negative volume", "?minVolume1d=-1", true, "0", "0"},
+		{"invalid ratio", "?minVolumeTvlRatio=abc", true, "0", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter models.PoolFilter
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/pools", func(c *fiber.Ctx) error {
+				filter, errors = ParsePoolFilter(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/pools"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if (len(errors) > 0) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+			if filter.MinVolume1D.String() != tt.wantVol {
+				t.Errorf("Expected minVolume1d %s, got %s", tt.wantVol, filter.MinVolume1D)
+			}
+			if filter.MinVolumeTVLRatio.String() != tt.wantRatio {
+				t.Errorf("Expected minVolumeTvlRatio %s, got %s", tt.wantRatio, filter.MinVolumeTVLRatio)
+			}
+		})
+	}
+}
+
+func TestParsePoolFilter_Tags(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		hasError bool
+		want     []string
+	}{
+		{"unset", "", false, nil},
+		{"single", "?tag=lending", false, []string{"lending"}},
+		{"several sorted and deduplicated", "?tag=Liquid-Staking,dex-lp,liquid-staking", false, []string{"dex-lp", "liquid-staking"}},
+		{"invalid", "?tag=dex_lp", true, nil},
+		{"empty entry", "?tag=lending,", true, nil},
+		{"too many", "?tag=a,b,c,d,e,f", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter models.PoolFilter
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/pools", func(c *fiber.Ctx) error {
+				filter, errors = ParsePoolFilter(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/pools"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if (len(errors) > 0) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+			if !reflect.DeepEqual(filter.Tags, tt.want) {
+				t.Errorf("Expected tags %v, got %v", tt.want, filter.Tags)
+			}
+		})
+	}
+}
+
+func TestBuildPoolsCacheKey_Tags(t *testing.T) {
+	lending := models.PoolFilter{SortBy: "tvl", SortOrder: "desc", Tags: []string{"lending"}, Limit: 50}
+	rwa := lending
+	rwa.Tags = []string{"rwa"}
+
+	if buildPoolsCacheKey(lending) == buildPoolsCacheKey(rwa) {
+		t.Error("Expected tags to produce different cache keys")
+	}
+}
+
+func TestParsePoolFilter_MultiKeySort(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		hasError bool
+		want     []models.SortKey
+	}{
+		{"default", "", false, []models.SortKey{{Field: "tvl", Order: "desc"}}},
+		{"single field with sortOrder", "?sortBy=apy&sortOrder=asc", false, []models.SortKey{{Field: "apy", Order: "asc"}}},
+		{"multiple keys", "?sortBy=chain:asc,score:desc", false, []models.SortKey{{Field: "chain", Order: "asc"}, {Field: "score", Order: "desc"}}},
+		{"sortOrder applies to bare keys", "?sortBy=stablecoin:desc,apy&sortOrder=asc", false, []models.SortKey{{Field: "stablecoin", Order: "desc"}, {Field: "apy", Order: "asc"}}},
+		{"too many keys", "?sortBy=chain,protocol,score,apy", true, nil},
+		{"unknown field", "?sortBy=chain:asc,symbol:asc", true, nil},
+		{"decayed needs score first", "?sortBy=chain:asc,score:desc&rankMode=decayed", true, nil},
+		{"decayed with score first", "?sortBy=score:desc,chain:asc&rankMode=decayed", false, []models.SortKey{{Field: "score", Order: "desc"}, {Field: "chain", Order: "asc"}}},
+		{"symbol defaults to relevance", "?symbol=USDC", false, []models.SortKey{{Field: "relevance", Order: "desc"}, {Field: "tvl", Order: "desc"}}},
+		{"search defaults to relevance", "?search=usdc", false, []models.SortKey{{Field: "relevance", Order: "desc"}, {Field: "tvl", Order: "desc"}}},
+		{"explicit sort overrides relevance", "?symbol=USDC&sortBy=apy", false, []models.SortKey{{Field: "apy", Order: "desc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter models.PoolFilter
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/pools", func(c *fiber.Ctx) error {
+				filter, errors = ParsePoolFilter(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/pools"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if (len(errors) > 0) != tt.hasError {
+				t.Fatalf("Expected hasError=%v, got errors=%v", tt.hasError, errors)
+			}
+			if tt.hasError {
+				return
+			}
+			if !reflect.DeepEqual(filter.Sort, tt.want) {
+				t.Errorf("Expected sort %v, got %v", tt.want, filter.Sort)
+			}
+			if filter.SortBy != tt.want[0].Field || filter.SortOrder != tt.want[0].Order {
+				t.Errorf("Expected primary key %v, got %s %s", tt.want[0], filter.SortBy, filter.SortOrder)
+			}
+		})
+	}
+}
+
+func TestBuildPoolsCacheKey_SortSpec(t *testing.T) {
+	base := models.PoolFilter{SortBy: "chain", SortOrder: "asc", Limit: 50}
+
+	byChainThenScore := base
+	byChainThenScore.Sort = []models.SortKey{{Field: "chain", Order: "asc"}, {Field: "score", Order: "desc"}}
+	byChainThenAPY := base
+	byChainThenAPY.Sort = []models.SortKey{{Field: "chain", Order: "asc"}, {Field: "apy", Order: "desc"}}
+
+	if buildPoolsCacheKey(byChainThenScore) == buildPoolsCacheKey(byChainThenAPY) {
+		t.Error("Expected secondary sort keys to produce different cache keys")
+	}
+	if buildPoolsCacheKey(byChainThenScore) == buildPoolsCacheKey(base) {
+		t.Error("Expected a multi-key sort to differ from the single-key sort")
+	}
+}
+
+func TestParsePoolUpdatesQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantFields  []string
+		wantSince   uint64
+		wantTimeout time.Duration
+	}{
+		{name: "defaults", wantTimeout: 30 * time.Second},
+		{name: "cursor and timeout", query: "?since=1735689600000123&timeout=5", wantSince: 1735689600000123, wantTimeout: 5 * time.Second},
+		{name: "no wait", query: "?timeout=0", wantTimeout: 0},
+		{name: "invalid cursor", query: "?since=abc", wantFields: []string{"since"}, wantTimeout: 30 * time.Second},
+		{name: "timeout too long", query: "?timeout=61&minTvl=-1", wantFields: []string{"timeout", "minTvl"}, wantTimeout: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query PoolUpdatesQuery
+			var errors []ValidationError
+
+			app := fiber.New()
+			app.Get("/updates", func(c *fiber.Ctx) error {
+				query, errors = ParsePoolUpdatesQuery(c)
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest("GET", "/updates"+tt.query, nil)); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			var fields []string
+			for _, e := range errors {
+				fields = append(fields, e.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("Expected errors on %v, got %v", tt.wantFields, errors)
+			}
+			if query.Since != tt.wantSince || query.Timeout != tt.wantTimeout {
+				t.Errorf("Expected since %d and timeout %v, got %d and %v", tt.wantSince, tt.wantTimeout, query.Since, query.Timeout)
+			}
+		})
+	}
+}
+
+func TestPoolUpdatesQuery_Match(t *testing.T) {
+	query := PoolUpdatesQuery{Chain: "arbitrum", MinTVL: decimal.NewFromInt(1000)}
+
+	tests := []struct {
+		pool models.Pool
+		want bool
+	}{
+		{models.Pool{Chain: "Arbitrum", TVL: decimal.NewFromInt(1000)}, true},
+		{models.Pool{Chain: "arbitrum", TVL: decimal.NewFromInt(999)}, false},
+		{models.Pool{Chain: "Ethereum", TVL: decimal.NewFromInt(5000)}, false},
+	}
+	for _, tt := range tests {
+		if got := query.Match(&tt.pool); got != tt.want {
+			t.Errorf("Match(%s, %s) = %v, want %v", tt.pool.Chain, tt.pool.TVL, got, tt.want)
+		}
+	}
+
+	if !(PoolUpdatesQuery{}).Match(&models.Pool{Chain: "Ethereum"}) {
+		t.Error("Expected every pool to match without filters")
+	}
+}
+
+func TestValidateAPYIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		index  models.APYIndex
+		fields []string
+	}{
+		{"valid", models.APYIndex{Name: "aave-usdc", Protocol: "aave-v3", Asset: "USDC"}, nil},
+		{"missing name", models.APYIndex{Chain: "ethereum"}, []string{"name"}},
+		{"uppercase name", models.APYIndex{Name: "Aave-USDC"}, []string{"name"}},
+		{"name with spaces", models.APYIndex{Name: "aave usdc"}, []string{"name"}},
+		{"long name", models.APYIndex{Name: strings.Repeat("x", 65)}, []string{"name"}},
+		{"long filters", models.APYIndex{
+			Name:     "x",
+			Chain:    strings.Repeat("c", 51),
+			Protocol: strings.Repeat("p", 101),
+			Asset:    strings.Repeat("a", 51),
+		}, []string{"chain", "protocol", "asset"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateAPYIndex(tt.index)
+			if len(errors) != len(tt.fields) {
+				t.Fatalf("Expected errors for %v, got %v", tt.fields, errors)
+			}
+			for i, field := range tt.fields {
+				if errors[i].Field != field {
+					t.Errorf("Expected error %d on %s, got %s", i, field, errors[i].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePoolCuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		hasError bool
+		fields   []string
+		want     string
+	}{
+		{"adjustable", `{"rewardSchedule":"Adjustable","audited":true}`, false, nil, models.RewardScheduleAdjustable},
+		{"schedule defaults to unknown", `{"notes":"team-controlled emissions"}`, false, nil, models.RewardScheduleUnknown},
+		{"not json", `rewardSchedule=locked`, true, nil, ""},
+		{"invalid schedule", `{"rewardSchedule":"vested"}`, false, []string{"rewardSchedule"}, "vested"},
+		{"long notes", `{"notes":"` + strings.Repeat("n", models.MaxCurationNotesLength+1) + `"}`, false, []string{"notes"}, models.RewardScheduleUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			curation, err := parsePoolCuration([]byte(tt.body))
+			if (err != nil) != tt.hasError {
+				t.Fatalf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+			if err != nil {
+				return
+			}
+			if curation.RewardSchedule != tt.want {
+				t.Errorf("Expected reward schedule %q, got %q", tt.want, curation.RewardSchedule)
+			}
+
+			errors := ValidatePoolCuration(curation)
+			if len(errors) != len(tt.fields) {
+				t.Fatalf("Expected errors for %v, got %v", tt.fields, errors)
+			}
+			for i, field := range tt.fields {
+				if errors[i].Field != field {
+					t.Errorf("Expected error %d on %s, got %s", i, field, errors[i].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePoolFilter_Curation(t *testing.T) {
+	var filter models.PoolFilter
+	app := fiber.New()
+	app.Get("/pools", func(c *fiber.Ctx) error {
+		filter, _ = ParsePoolFilter(c)
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/pools?curated=true&audited=false", nil)); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if filter.Curated == nil || !*filter.Curated || filter.Audited == nil || *filter.Audited {
+		t.Errorf("Expected curated=true and audited=false, got %v and %v", filter.Curated, filter.Audited)
+	}
+	if !filter.FiltersCuration() {
+		t.Error("Expected the filter to need PostgreSQL")
+	}
+
+	uncurated := filter
+	uncurated.Curated, uncurated.Audited = nil, nil
+	if buildPoolsCacheKey(filter) == buildPoolsCacheKey(uncurated) {
+		t.Error("Expected curation filters to produce different cache keys")
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// ListIndices returns the APY index definitions with their latest values
+// @Summary List APY indices
+// @Description List the benchmark APY indices, each the TVL-weighted average APY of the pools matching its chain, protocol, stablecoin and asset filters, with the most recent daily value. Values are computed by the worker once a day (UTC).
+// @Tags indices
+// @Produce json
+// @Success 200 {object} models.APYIndexListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/indices [get]
+func (h *Handler) ListIndices(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	indices, err := h.pg.ListAPYIndices(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list indices")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch indices"))
+	}
+
+	return c.JSON(models.APYIndexListResponse{
+		Data:  indices,
+		Total: len(indices),
+	})
+}
+
+// GetIndexHistory returns the daily values of an APY index
+// @Summary Get APY index history
+// @Description Get the daily values of an index, oldest first. Days on which no pool with TVL matched the index have no value.
+// @Tags indices
+// @Produce json
+// @Param name path string true "Index name"
+// @Param days query integer false "Number of days" default(30) maximum(365)
+// @Success 200 {object} models.APYIndexHistoryResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/indices/{name}/history [get]
+func (h *Handler) GetIndexHistory(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	name := c.Params("name")
+
+	if errors := ValidateIndexName(name); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+	days, validationErrors := ValidateIndexHistoryDays(c)
+	if len(validationErrors) > 0 {
+		return SendValidationError(c, validationErrors)
+	}
+
+	if _, err := h.pg.GetAPYIndex(ctx, name); err != nil {
+		return sendIndexError(c, name, err)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	history, err := h.pg.GetAPYIndexHistory(ctx, name, today.AddDate(0, 0, 1-days))
+	if err != nil {
+		log.Error().Err(err).Str("index", name).Msg("Failed to fetch index history")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch index history"))
+	}
+
+	return c.JSON(models.APYIndexHistoryResponse{
+		Index:      name,
+		Days:       days,
+		DataPoints: history,
+	})
+}
+
+// CreateIndex adds an APY index definition
+// @Summary Create APY index
+// @Description Define a new benchmark index. Empty filters match every pool; asset must be a whole token of the pool symbol. The first value is recorded by the next daily run.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param index body models.APYIndex true "Index definition"
+// @Success 201 {object} models.APYIndex
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/indices [post]
+func (h *Handler) CreateIndex(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	idx, err := parseIndexDefinition(c.Body())
+	if err != nil {
+		return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+	}
+	if errors := ValidateAPYIndex(idx); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	if err := h.pg.CreateAPYIndex(ctx, &idx); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return SendError(c, ErrConflict.WithDetails(fmt.Sprintf("Index '%s' already exists", idx.Name)))
+		}
+		log.Error().Err(err).Str("index", idx.Name).Msg("Failed to create index")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to create index"))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(idx)
+}
+
+// UpdateIndex replaces the description and filters of an APY index
+// @Summary Update APY index
+// @Description Replace an index's description and filters. Values already recorded are kept; the next daily run uses the new filters.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param name path string true "Index name"
+// @Param index body models.APYIndex true "Index definition; the name is taken from the path"
+// @Success 200 {object} models.APYIndex
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/indices/{name} [put]
+func (h *Handler) UpdateIndex(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	idx, err := parseIndexDefinition(c.Body())
+	if err != nil {
+		return SendError(c, ErrBadRequest.WithDetails(err.Error()))
+	}
+	idx.Name = c.Params("name")
+	if errors := ValidateAPYIndex(idx); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	if err := h.pg.UpdateAPYIndex(ctx, &idx); err != nil {
+		return sendIndexError(c, idx.Name, err)
+	}
+
+	return c.JSON(idx)
+}
+
+// DeleteIndex removes an APY index and its recorded values
+// @Summary Delete APY index
+// @Description Remove an index definition together with its history.
+// @Tags admin
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param name path string true "Index name"
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/indices/{name} [delete]
+func (h *Handler) DeleteIndex(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	name := c.Params("name")
+
+	if err := h.pg.DeleteAPYIndex(ctx, name); err != nil {
+		return sendIndexError(c, name, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// parseIndexDefinition decodes an index definition from a request body.
+// Timestamps and the latest value are not accepted from clients.
+func parseIndexDefinition(body []byte) (models.APYIndex, error) {
+	var idx models.APYIndex
+	if err := json.Unmarshal(body, &idx); err != nil {
+		return idx, errors.New("request body must be a JSON index definition")
+	}
+
+	idx.CreatedAt, idx.UpdatedAt, idx.Latest = time.Time{}, time.Time{}, nil
+	return idx, nil
+}
+
+// sendIndexError reports a failed index lookup or change as 404 if the
+// index doesn't exist, 500 otherwise
+func sendIndexError(c *fiber.Ctx, name string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return SendError(c, ErrNotFound.WithDetails(fmt.Sprintf("Index '%s' not found", name)))
+	}
+	log.Error().Err(err).Str("index", name).Msg("Index operation failed")
+	return SendError(c, ErrInternalServer)
+}
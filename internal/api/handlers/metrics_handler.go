@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"runtime"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
 )
 
 // MetricsResponse contains application metrics
@@ -141,8 +143,26 @@ defi_uptime_seconds %.0f
 		time.Since(h.startTime).Seconds(),
 	)
 
+	// Append data, WebSocket and cache gauges. The runtime figures above
+	// describe the process answering the scrape; the collector sums the
+	// in-memory counters across processes when the server is preforked.
+	var buf bytes.Buffer
+	buf.WriteString(output)
+	var families []metrics.Family
+	if h.metrics != nil {
+		families = h.metrics.Gather(c.Context())
+	} else if h.counters != nil {
+		families = h.counters.families()
+	}
+	if len(families) > 0 {
+		buf.WriteString("\n")
+		if err := metrics.WriteText(&buf, families); err != nil {
+			return SendError(c, ErrInternalServer.WithDetails(err.Error()))
+		}
+	}
+
 	c.Set("Content-Type", "text/plain; charset=utf-8")
-	return c.SendString(output)
+	return c.Send(buf.Bytes())
 }
 
 // formatBytes converts bytes to human-readable format
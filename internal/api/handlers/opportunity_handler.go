@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,15 +21,19 @@ import (
 // @Tags opportunities
 // @Accept json
 // @Produce json
+// @Produce application/msgpack
 // @Param type query string false "Opportunity type (yield-gap, trending, high-score)"
 // @Param riskLevel query string false "Risk level (low, medium, high)"
 // @Param chain query string false "Filter by blockchain"
 // @Param asset query string false "Filter by asset (e.g., USDC, ETH)"
 // @Param minProfit query number false "Minimum potential profit percentage"
-// @Param minScore query number false "Minimum opportunity score"
+// @Param minScore query number false "Minimum opportunity score (default: LISTING_MIN_OPPORTUNITY_SCORE; 0 lists all)"
 // @Param activeOnly query boolean false "Show only active opportunities" default(true)
 // @Param sortBy query string false "Sort field (score, profit, apy, detected_at)" default(score)
 // @Param sortOrder query string false "Sort order (asc, desc)" default(desc)
+// @Param detectedAfter query string false "Only opportunities detected at or after this RFC 3339 time, at most 90 days ago (default: 7 days before detectedBefore or now)"
+// @Param detectedBefore query string false "Only opportunities detected before this RFC 3339 time"
+// @Param sustainableOnly query boolean false "Only opportunities on pools whose APY is mostly base yield rather than reward emissions" default(false)
 // @Param limit query integer false "Number of results per page" default(50) maximum(100)
 // @Param offset query integer false "Offset for pagination" default(0)
 // @Success 200 {object} models.OpportunityListResponse
@@ -43,15 +50,24 @@ func (h *Handler) ListOpportunities(c *fiber.Ctx) error {
 	if len(validationErrors) > 0 {
 		return SendValidationError(c, validationErrors)
 	}
+	if filter.SustainableOnly {
+		filter.Sustainability = h.sustainability()
+	}
+	filter.MinScore = h.opportunityScoreFloor(c, filter.MinScore)
 
 	// Build cache key
 	cacheKey := buildOpportunitiesCacheKey(filter)
 
 	// Try cache first
-	cached, err := h.redis.GetOpportunitiesCache(ctx, cacheKey)
-	if err == nil && cached != nil {
-		log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for opportunities")
-		return c.JSON(cached)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetOpportunitiesCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for opportunities")
+			setCacheHit(c)
+			serveOpportunities(cached.Data)
+			return sendNegotiated(c, cached)
+		}
 	}
 
 	// Fetch from database
@@ -67,14 +83,50 @@ func (h *Handler) ListOpportunities(c *fiber.Ctx) error {
 		Limit:   filter.Limit,
 		Offset:  filter.Offset,
 		HasMore: int64(filter.Offset+len(opportunities)) < total,
+
+		DetectedAfter: filter.DetectedAfter,
+	}
+	if !filter.DetectedBefore.IsZero() {
+		response.DetectedBefore = &filter.DetectedBefore
 	}
 
 	// Cache for 1 minute
-	if err := h.redis.SetOpportunitiesCache(ctx, cacheKey, &response, 60); err != nil {
+	if err := h.cache.SetOpportunitiesCache(ctx, cacheKey, &response, 60); err != nil {
 		log.Debug().Err(err).Msg("Failed to cache opportunities response")
 	}
 
-	return c.JSON(response)
+	setCacheMiss(c, bypass, backendPostgres)
+	serveOpportunities(response.Data)
+	return sendNegotiated(c, response)
+}
+
+// accuracyWindow is how far back the accuracy report looks
+const accuracyWindow = 30 * 24 * time.Hour
+
+// GetOpportunityAccuracy reports how detected opportunities turned out
+// @Summary Get detector accuracy
+// @Description Count the realized outcomes of yield-gap and trending opportunities that expired in the last 30 days, per type. confirmedRate is the share of classified outcomes that were confirmed; outcomes with too little history (unknown) are left out of it.
+// @Tags opportunities
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.OpportunityAccuracyResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/opportunities/accuracy [get]
+func (h *Handler) GetOpportunityAccuracy(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	since := time.Now().Add(-accuracyWindow).UTC()
+	accuracy, err := h.pg.GetOpportunityAccuracy(ctx, since)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to fetch opportunity accuracy")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch opportunity accuracy"))
+	}
+
+	return c.JSON(models.OpportunityAccuracyResponse{
+		Data:  accuracy,
+		Since: since,
+	})
 }
 
 // GetTrendingPools returns pools with significantly increasing APY
@@ -97,7 +149,7 @@ func (h *Handler) GetTrendingPools(c *fiber.Ctx) error {
 
 	chain := c.Query("chain")
 	minGrowthStr := c.Query("minGrowth", "10")
-	limit := c.QueryInt("limit", 20)
+	limit := c.QueryInt("limit", models.DefaultTrendingLimit)
 	offset := c.QueryInt("offset", 0)
 
 	// Validate parameters
@@ -111,12 +163,7 @@ func (h *Handler) GetTrendingPools(c *fiber.Ctx) error {
 		})
 	}
 
-	if limit > 50 {
-		limit = 50
-	}
-	if limit < 1 {
-		limit = 20
-	}
+	limit = models.ClampLimit(limit, models.DefaultTrendingLimit, models.MaxTrendingLimit)
 
 	if offset < 0 {
 		offset = 0
@@ -127,29 +174,36 @@ func (h *Handler) GetTrendingPools(c *fiber.Ctx) error {
 	}
 
 	// Try cache first
-	cacheKey := fmt.Sprintf("trending:%s:%.1f", chain, minGrowth.InexactFloat64())
-	cached, err := h.redis.GetTrendingCache(ctx, cacheKey)
-	if err == nil && cached != nil {
-		log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for trending pools")
-		return c.JSON(TrendingResponse{
-			Data:   cached,
-			Limit:  limit,
-			Offset: offset,
-		})
+	cacheKey := buildTrendingCacheKey(chain, minGrowth.InexactFloat64(), limit, offset)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetTrendingCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for trending pools")
+			setCacheHit(c)
+			serveTrending(cached)
+			return c.JSON(TrendingResponse{
+				Data:   cached,
+				Limit:  limit,
+				Offset: offset,
+			})
+		}
 	}
 
 	// Fetch trending pools
-	trending, err := h.pg.GetTrendingPools(ctx, chain, minGrowth, limit, offset)
+	trending, err := h.trending.GetTrendingPools(ctx, chain, minGrowth, limit, offset)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to fetch trending pools")
 		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch trending pools"))
 	}
 
 	// Cache for 2 minutes
-	if err := h.redis.SetTrendingCache(ctx, cacheKey, trending, 120); err != nil {
+	if err := h.cache.SetTrendingCache(ctx, cacheKey, trending, 120); err != nil {
 		log.Debug().Err(err).Msg("Failed to cache trending pools")
 	}
 
+	setCacheMiss(c, bypass, backendPostgres)
+	serveTrending(trending)
 	return c.JSON(TrendingResponse{
 		Data:   trending,
 		Limit:  limit,
@@ -164,18 +218,97 @@ type TrendingResponse struct {
 	Offset int                   `json:"offset"`
 }
 
-// buildOpportunitiesCacheKey creates a cache key for opportunities
-func buildOpportunitiesCacheKey(filter models.OpportunityFilter) string {
-	return fmt.Sprintf("opportunities:%s:%s:%s:%s:%s:%s:%s:%t:%d:%d",
-		filter.Type,
-		filter.RiskLevel,
-		filter.Chain,
-		filter.Asset,
-		filter.MinProfit.String(),
-		filter.SortBy,
-		filter.SortOrder,
-		filter.ActiveOnly,
-		filter.Limit,
-		filter.Offset,
-	)
+// sseHeartbeat is how often an event stream sends a comment, so idle
+// connections stay open through proxies and gone clients are noticed
+const sseHeartbeat = 15 * time.Second
+
+// StreamOpportunities streams opportunity alerts and retractions as
+// server-sent events
+// @Summary Stream opportunity alerts
+// @Description Server-sent events carrying the alerts and retractions sent to /ws/opportunities. Each event has the stream sequence number as its id, opportunity or retraction as its type, and the opportunity or retraction as JSON data. A reconnecting client sending Last-Event-ID first gets a gap event, followed by the missed events while they are still buffered. Retractions are filtered by type only. Idle streams get a comment every 15 seconds.
+// @Tags opportunities
+// @Produce text/event-stream
+// @Param chain query string false "Only alerts on this chain"
+// @Param type query string false "Only this opportunity type (yield-gap, trending, high-score)"
+// @Param minScore query number false "Only alerts with at least this score"
+// @Param Last-Event-ID header integer false "ID of the last event received"
+// @Success 200 {string} string "Event stream"
+// @Failure 422 {object} ValidationErrors
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/opportunities/stream [get]
+func (h *Handler) StreamOpportunities(c *fiber.Ctx) error {
+	filter, validationErrors := ParseOpportunityStreamFilter(c)
+	if len(validationErrors) > 0 {
+		return SendValidationError(c, validationErrors)
+	}
+
+	// Missing or invalid IDs start a fresh stream
+	lastSeq, _ := strconv.ParseUint(c.Get("Last-Event-ID"), 10, 64)
+
+	events, stop, ok := h.updates.StreamOpportunities(lastSeq, filter)
+	if !ok {
+		return SendError(c, ErrServiceUnavailable.WithDetails("server is shutting down"))
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+
+	// The writer runs after the handler returns, so it must not use c.
+	// Each flush gets the WebSocket write timeout instead of the server's
+	// write timeout, which would cut the stream off.
+	conn := c.Context().Conn()
+	writeTimeout := h.config.WebSocket.WriteTimeout
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer stop()
+
+		flush := func() error {
+			var deadline time.Time
+			if writeTimeout > 0 {
+				deadline = time.Now().Add(writeTimeout)
+			}
+			if err := conn.SetWriteDeadline(deadline); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		// Send the headers straight away
+		w.WriteString(": connected\n\n")
+		if err := flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// Dropped for falling behind, or the server is shutting
+					// down; the client reconnects with Last-Event-ID
+					return
+				}
+				writeEvent(w, event)
+			case <-heartbeat.C:
+				w.WriteString(": heartbeat\n\n")
+			}
+			if err := flush(); err != nil {
+				log.Debug().Err(err).Msg("Opportunity stream client gone")
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// writeEvent writes an opportunity event in server-sent event framing. The
+// data is compact JSON, so it fits on one data line.
+func writeEvent(w io.Writer, event models.OpportunityEvent) {
+	if event.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
 }
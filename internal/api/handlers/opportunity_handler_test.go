@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/websocket"
+	"github.com/maxjove/defi-yield-aggregator/internal/cache"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// sseEvent is one parsed server-sent event
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent reads the next event from a stream, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.event != "" {
+				return e
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("Unexpected line %q", line)
+		}
+	}
+}
+
+func TestStreamOpportunities(t *testing.T) {
+	hub := websocket.NewHub(config.WebSocketConfig{ReplayBuffer: 10})
+	go hub.Run()
+
+	h := &Handler{config: &config.Config{}, updates: hub}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/stream", h.StreamOpportunities)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go app.Listener(ln)
+
+	// As on server shutdown, the hub ends the streams before the server
+	// waits for connections to close
+	defer app.Shutdown()
+	defer hub.Shutdown(context.Background())
+
+	open := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/stream?chain=Ethereum&minScore=50", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %q", resp.StatusCode, ct)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	alert := func(id, chain string, score int64) {
+		hub.BroadcastOpportunityAlert(&models.Opportunity{ID: id, Type: models.OpportunityTypeHighScore, PoolID: id, Chain: chain, Score: decimal.NewFromInt(score)})
+	}
+
+	resp, events := open("")
+	// The stream is subscribed once the handler ran, which the headers show
+	alert("skipped-chain", "arbitrum", 90)
+	alert("skipped-score", "ethereum", 10)
+	alert("first", "ethereum", 80)
+
+	first := readEvent(t, events)
+	if first.event != models.OpportunityEventAlert || first.id == "" || !strings.Contains(first.data, `"id":"first"`) {
+		t.Fatalf("Expected the matching alert with an ID, got %+v", first)
+	}
+	resp.Body.Close()
+
+	// Missed while disconnected
+	alert("second", "ethereum", 70)
+	hub.BroadcastOpportunityRetraction(&models.OpportunityRetraction{OpportunityID: "first", Type: models.OpportunityTypeHighScore})
+
+	resp, events = open(first.id)
+	defer resp.Body.Close()
+
+	gap := readEvent(t, events)
+	if gap.event != models.OpportunityEventGap || gap.id != "" || !strings.Contains(gap.data, `"replayed":true`) {
+		t.Fatalf("Expected a gap notice announcing the replay, got %+v", gap)
+	}
+	second := readEvent(t, events)
+	if second.event != models.OpportunityEventAlert || !strings.Contains(second.data, `"id":"second"`) || second.id <= first.id {
+		t.Errorf("Expected the missed alert replayed, got %+v", second)
+	}
+	retraction := readEvent(t, events)
+	if retraction.event != models.OpportunityEventRetraction || !strings.Contains(retraction.data, `"opportunityId":"first"`) {
+		t.Errorf("Expected the missed retraction replayed, got %+v", retraction)
+	}
+
+	// Live events follow the replay
+	alert("third", "ethereum", 60)
+	if third := readEvent(t, events); !strings.Contains(third.data, `"id":"third"`) {
+		t.Errorf("Expected the live alert after the replay, got %+v", third)
+	}
+}
+
+// fakeTrending serves pages of trending pools numbered by position,
+// counting the queries
+type fakeTrending struct {
+	queries int
+}
+
+func (f *fakeTrending) GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error) {
+	f.queries++
+	page := make([]models.TrendingPool, limit)
+	for i := range page {
+		page[i] = models.TrendingPool{Pool: &models.Pool{ID: "pool-" + strconv.Itoa(offset+i)}}
+	}
+	return page, nil
+}
+
+func TestGetTrendingPools_CachesEachPage(t *testing.T) {
+	source := &fakeTrending{}
+	h := &Handler{config: &config.Config{}, cache: cache.NewMemory(100), trending: source}
+	app := fiber.New()
+	app.Get("/trending", h.GetTrendingPools)
+
+	get := func(query string) (string, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/trending?"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get(HeaderCache)
+	}
+
+	pages := []string{"limit=2&offset=0", "limit=2&offset=2", "limit=3&offset=0"}
+	bodies := make(map[string]string)
+	for _, query := range pages {
+		body, cached := get(query)
+		if cached != cacheMiss {
+			t.Errorf("Expected the first request for %s to miss, got %s %q", query, HeaderCache, cached)
+		}
+		bodies[query] = body
+	}
+	if source.queries != len(pages) {
+		t.Errorf("Expected a query for each page, got %d", source.queries)
+	}
+
+	// Each page is served from its own cache entry
+	for _, query := range pages {
+		body, cached := get(query)
+		if cached != cacheHit {
+			t.Errorf("Expected the second request for %s to hit, got %s %q", query, HeaderCache, cached)
+		}
+		if body != bodies[query] {
+			t.Errorf("Expected the cached page for %s, got %s", query, body)
+		}
+	}
+	if source.queries != len(pages) {
+		t.Errorf("Expected cached pages to make no queries, got %d", source.queries)
+	}
+
+	if bodies["limit=2&offset=0"] == bodies["limit=2&offset=2"] {
+		t.Errorf("Expected different pages for different offsets, got %s twice", bodies["limit=2&offset=0"])
+	}
+	if !strings.Contains(bodies["limit=2&offset=2"], `"id":"pool-2"`) || strings.Contains(bodies["limit=2&offset=2"], `"id":"pool-0"`) {
+		t.Errorf("Expected the page at offset 2 to start at pool-2, got %s", bodies["limit=2&offset=2"])
+	}
+	if bodies["limit=2&offset=0"] == bodies["limit=3&offset=0"] {
+		t.Errorf("Expected different pages for different limits, got %s twice", bodies["limit=2&offset=0"])
+	}
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,30 +12,58 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
 )
 
 // Request timeout for database operations
 const requestTimeout = 30 * time.Second
 
+// maxRiskTransitions caps the transitions returned by GetPoolRiskHistory
+const maxRiskTransitions = 500
+
+// maxStreamedHistoryPoints caps the data points of a streamed pool history
+const maxStreamedHistoryPoints = 100_000
+
+// historyStreamFlushEvery is how many streamed history points are buffered
+// before they are flushed to the client
+const historyStreamFlushEvery = 500
+
+// errHistoryTruncated stops a streamed pool history at the row cap
+var errHistoryTruncated = errors.New("pool history truncated")
+
 // ListPools returns a paginated list of pools with optional filters
 // @Summary List all pools
 // @Description Get a paginated list of DeFi yield pools with optional filtering and sorting
 // @Tags pools
 // @Accept json
 // @Produce json
+// @Produce application/msgpack
 // @Param chain query string false "Filter by blockchain (e.g., ethereum, bsc, polygon)"
 // @Param protocol query string false "Filter by protocol (e.g., aave-v3, compound)"
 // @Param symbol query string false "Filter by symbol (partial match)"
+// @Param search query string false "Search symbol, protocol, chain and pool metadata; pools are returned with highlights (models.PoolSearchResponse)"
+// @Param exact query boolean false "Match symbol and search without fuzziness: the symbol must equal the term or contain it as a whole token" default(false)
 // @Param minApy query number false "Minimum APY percentage"
 // @Param maxApy query number false "Maximum APY percentage"
 // @Param minTvl query number false "Minimum TVL in USD"
 // @Param maxTvl query number false "Maximum TVL in USD"
 // @Param minScore query number false "Minimum risk-adjusted score (0-100)"
+// @Param minVolume1d query number false "Minimum 24h trading volume in USD"
+// @Param minVolumeTvlRatio query number false "Minimum 24h volume / TVL ratio"
 // @Param stablecoin query boolean false "Filter stablecoin pools only"
-// @Param sortBy query string false "Sort field (apy, tvl, score)" default(tvl)
-// @Param sortOrder query string false "Sort order (asc, desc)" default(desc)
+// @Param dataSource query string false "Filter by data source (defillama, manual)"
+// @Param includeOutliers query boolean false "Include pools whose APY was clamped to the plausible range" default(false)
+// @Param includeEmpty query boolean false "Include dead pools with TVL below LISTING_MIN_TVL" default(false)
+// @Param curated query boolean false "Filter pools with (true) or without (false) curated attributes; served from PostgreSQL"
+// @Param audited query boolean false "Filter pools curated as audited (true) or not (false); served from PostgreSQL"
+// @Param sortBy query string false "Sort field (relevance, apy, tvl, score, updated_at, chain, protocol, stablecoin), or up to 3 comma-separated keys with direction suffixes (chain:asc,score:desc). Defaults to relevance,tvl with symbol or search, tvl otherwise" default(tvl)
+// @Param sortOrder query string false "Sort order for keys without a suffix (asc, desc)" default(desc)
+// @Param rankMode query string false "Ranking mode when score is the first sort key (standard, decayed)" default(standard)
 // @Param limit query integer false "Number of results per page" default(50) maximum(100)
 // @Param offset query integer false "Offset for pagination" default(0)
+// @Param fields query string false "Comma-separated pool fields to return (id,chain,apy,tvl); all fields when omitted"
+// @Param sparkline query boolean false "Attach the hourly APY of the last 24h of each listed pool in sparklines, by pool ID" default(false)
+// @Param sustainableOnly query boolean false "Only pools whose APY is mostly base yield rather than reward emissions (SUSTAINABLE_MIN_BASE_RATIO)" default(false)
 // @Success 200 {object} models.PoolListResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 422 {object} ValidationErrors
@@ -44,29 +75,48 @@ func (h *Handler) ListPools(c *fiber.Ctx) error {
 
 	// Parse and validate filter parameters
 	filter, validationErrors := ParsePoolFilter(c)
+	fields, fieldErrors := poolFields.parse(c.Query("fields"))
+	validationErrors = append(validationErrors, fieldErrors...)
 	if len(validationErrors) > 0 {
 		return SendValidationError(c, validationErrors)
 	}
+	filter.DecayScale = h.config.Scoring.FreshnessDecayScale
+	filter.TVLFloor = h.listingFloor(filter.IncludeEmpty)
+	if filter.SustainableOnly {
+		filter.Sustainability = h.sustainability()
+	}
 
-	// Build cache key
+	// Build cache key. The full response is cached and trimmed to the
+	// requested fields on the way out, so field sets share one entry.
 	cacheKey := buildPoolsCacheKey(filter)
 
+	bypass := h.bypassCache(c)
+	if filter.Search != "" {
+		return h.searchPools(c, ctx, filter, fields, cacheKey, bypass)
+	}
+
 	// Try cache first
-	cached, err := h.redis.GetPoolsCache(ctx, cacheKey)
-	if err == nil && cached != nil {
-		log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for pools")
-		return c.JSON(cached)
+	if !bypass {
+		cached, err := h.cache.GetPoolsCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for pools")
+			setCacheHit(c)
+			return sendNegotiated(c, projectPoolList(cached, fields))
+		}
 	}
 
 	// Fetch from ElasticSearch for fast filtering
-	pools, total, err := h.es.SearchPools(ctx, filter)
+	backend := backendES
+	var pools []models.Pool
+	var total int64
+	err := errCurationNotIndexed
+	if !filter.FiltersCuration() {
+		pools, total, err = h.es.SearchPools(ctx, filter)
+	}
 	if err != nil || total == 0 {
-		if err != nil {
-			log.Warn().Err(err).Msg("ElasticSearch query failed, falling back to PostgreSQL")
-		} else {
-			log.Debug().Msg("ElasticSearch returned no results, falling back to PostgreSQL")
-		}
+		logSearchFallback(err)
 		// Fallback to PostgreSQL
+		backend = backendPostgres
 		pools, total, err = h.pg.ListPools(ctx, filter)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to fetch pools from database")
@@ -74,6 +124,9 @@ func (h *Handler) ListPools(c *fiber.Ctx) error {
 		}
 	}
 
+	models.SetMatchQuality(pools, filter.MatchQuery())
+	h.listCuration(ctx, pools, backend)
+
 	response := models.PoolListResponse{
 		Data:    pools,
 		Total:   total,
@@ -81,13 +134,148 @@ func (h *Handler) ListPools(c *fiber.Ctx) error {
 		Offset:  filter.Offset,
 		HasMore: int64(filter.Offset+len(pools)) < total,
 	}
+	if filter.Sparkline {
+		response.Sparklines = h.listSparklines(ctx, pools)
+	}
 
 	// Cache for 30 seconds
-	if err := h.redis.SetPoolsCache(ctx, cacheKey, &response, 30); err != nil {
+	if err := h.cache.SetPoolsCache(ctx, cacheKey, &response, 30); err != nil {
 		log.Debug().Err(err).Msg("Failed to cache pools response")
 	}
 
-	return c.JSON(response)
+	setCacheMiss(c, bypass, backend)
+	return sendNegotiated(c, projectPoolList(&response, fields))
+}
+
+// listSparklines reads the sparklines of a page of listed pools in one
+// query. They are cached with the page, so they are as fresh as it is. On
+// failure the page is served without them.
+func (h *Handler) listSparklines(ctx context.Context, pools []models.Pool) map[string][]float64 {
+	ids := make([]string, len(pools))
+	for i, pool := range pools {
+		ids[i] = pool.ID
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	points, err := h.sparklines.GetPoolSparklines(ctx, ids, models.SparklineSince(time.Now()))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read sparklines of listed pools")
+		return nil
+	}
+	return models.AlignSparklines(ids, points)
+}
+
+// logSearchFallback logs why a pool search is served from PostgreSQL
+// rather than ElasticSearch
+func logSearchFallback(err error) {
+	switch {
+	case errors.Is(err, elasticsearch.ErrUnavailable):
+		log.Debug().Err(err).Msg("ElasticSearch circuit breaker is open, serving from PostgreSQL")
+	case errors.Is(err, elasticsearch.ErrSearchTimeout):
+		log.Warn().Err(err).Msg("ElasticSearch search timed out, serving degraded from PostgreSQL")
+	case errors.Is(err, errCurationNotIndexed):
+		log.Debug().Msg("Curation filters are served from PostgreSQL")
+	case errors.Is(err, elasticsearch.ErrResultWindowExceeded):
+		log.Debug().Err(err).Msg("Page is past the ElasticSearch result window, serving from PostgreSQL")
+	case err != nil:
+		log.Warn().Err(err).Msg("ElasticSearch query failed, falling back to PostgreSQL")
+	default:
+		log.Debug().Msg("ElasticSearch returned no results, falling back to PostgreSQL")
+	}
+}
+
+// searchPools serves ListPools for a general search. Pools found by
+// ElasticSearch come with highlights of the fields that matched; the
+// PostgreSQL fallback has none.
+func (h *Handler) searchPools(c *fiber.Ctx, ctx context.Context, filter models.PoolFilter, fields []string, cacheKey string, bypass bool) error {
+	// Try cache first
+	if !bypass {
+		cached, err := h.cache.GetPoolSearchCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for pool search")
+			setCacheHit(c)
+			return sendNegotiated(c, projectPoolSearch(cached, fields))
+		}
+	}
+
+	backend := backendES
+	var hits []models.PoolSearchHit
+	var total int64
+	err := errCurationNotIndexed
+	if !filter.FiltersCuration() {
+		hits, total, err = h.es.SearchPoolsWithHighlights(ctx, filter)
+	}
+	if err != nil || total == 0 {
+		logSearchFallback(err)
+		// Fallback to PostgreSQL
+		backend = backendPostgres
+		var pools []models.Pool
+		pools, total, err = h.pg.ListPools(ctx, filter)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to fetch pools from database")
+			return SendError(c, ErrInternalServer.WithDetails("Failed to fetch pools"))
+		}
+		hits = make([]models.PoolSearchHit, len(pools))
+		for i, pool := range pools {
+			hits[i] = models.PoolSearchHit{Pool: pool}
+		}
+	}
+
+	models.SetHitMatchQuality(hits, filter.MatchQuery())
+	pools := make([]models.Pool, len(hits))
+	for i := range hits {
+		pools[i] = hits[i].Pool
+	}
+	h.listCuration(ctx, pools, backend)
+	for i := range hits {
+		hits[i].Pool = pools[i]
+	}
+
+	response := models.PoolSearchResponse{
+		Data:    hits,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+		HasMore: int64(filter.Offset+len(hits)) < total,
+	}
+	if filter.Sparkline {
+		response.Sparklines = h.listSparklines(ctx, pools)
+	}
+
+	// Cache for 30 seconds
+	if err := h.cache.SetPoolSearchCache(ctx, cacheKey, &response, 30); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache pool search response")
+	}
+
+	setCacheMiss(c, bypass, backend)
+	return sendNegotiated(c, projectPoolSearch(&response, fields))
+}
+
+// GetPoolUpdates long-polls for pool updates, for clients that can't use
+// /ws/pools
+// @Summary Long-poll pool updates
+// @Description Wait for pool updates after a cursor. Buffered updates are returned at once; otherwise the request waits up to timeout seconds. gap is true when the cursor is no longer buffered and the client should refetch pools.
+// @Tags pools
+// @Produce json
+// @Param since query integer false "Cursor from the previous poll; omit to wait for the next update"
+// @Param timeout query integer false "Seconds to wait for an update" default(30) maximum(60)
+// @Param chain query string false "Only updates for this chain"
+// @Param minTvl query number false "Only updates for pools with at least this TVL in USD"
+// @Success 200 {object} models.PoolUpdateBatch
+// @Failure 422 {object} ValidationErrors
+// @Router /api/v1/pools/updates [get]
+func (h *Handler) GetPoolUpdates(c *fiber.Ctx) error {
+	query, validationErrors := ParsePoolUpdatesQuery(c)
+	if len(validationErrors) > 0 {
+		return SendValidationError(c, validationErrors)
+	}
+
+	batch := h.updates.PollPoolUpdates(c.Context(), query.Since, query.Timeout, query.Match)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(batch)
 }
 
 // GetPool returns a specific pool by ID
@@ -97,7 +285,8 @@ func (h *Handler) ListPools(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param id path string true "Pool ID"
-// @Success 200 {object} models.Pool
+// @Param rewardsDetail query bool false "Include reward token detail with estimated emission value" default(false)
+// @Success 200 {object} models.PoolDetail
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -112,39 +301,55 @@ func (h *Handler) GetPool(c *fiber.Ctx) error {
 		return SendValidationError(c, errors)
 	}
 
-	// Try cache first
-	cached, err := h.redis.GetPool(ctx, poolID)
-	if err == nil && cached != nil {
-		log.Debug().Str("pool_id", poolID).Msg("Cache hit for pool")
-		return c.JSON(cached)
+	// Cache and not-found tombstones first, then the database
+	bypass := h.bypassCache(c)
+	pool, cached, err := h.pools.get(ctx, poolID, bypass)
+	if cached {
+		setCacheHit(c)
+	} else {
+		setCacheMiss(c, bypass, backendPostgres)
 	}
-
-	// Fetch from database
-	pool, err := h.pg.GetPool(ctx, poolID)
-	if err != nil {
-		log.Debug().Err(err).Str("pool_id", poolID).Msg("Pool not found")
+	if errors.Is(err, errPoolNotFound) {
+		log.Debug().Str("pool_id", poolID).Bool("cached", cached).Msg("Pool not found")
 		return SendError(c, ErrNotFound.WithDetails(fmt.Sprintf("Pool '%s' not found", poolID)))
 	}
-
-	// Cache for 1 minute
-	if err := h.redis.SetPool(ctx, pool, 60); err != nil {
-		log.Debug().Err(err).Msg("Failed to cache pool")
+	if err != nil {
+		log.Error().Err(err).Str("pool_id", poolID).Msg("Failed to get pool")
+		return SendError(c, ErrInternalServer)
 	}
 
-	return c.JSON(pool)
+	// Concurrent requests may share the loaded pool, so the relative times
+	// go on a copy
+	served := *pool
+	served.SetRelativeTimes()
+
+	// Reward token detail is opt-in, it may need CoinGecko lookups
+	if !c.QueryBool("rewardsDetail", false) {
+		return c.JSON(served)
+	}
+	return c.JSON(models.PoolDetail{
+		Pool:    served,
+		Rewards: h.rewards.PoolRewards(ctx, pool),
+	})
 }
 
 // GetPoolHistory returns historical APY data for a pool
 // @Summary Get pool APY history
-// @Description Get historical APY and TVL data for charting
+// @Description Get historical APY and TVL data for charting. With stream=true the data points are written as NDJSON as they are read, one per line, followed by a {"meta": {...}} line with the count and whether the row cap truncated them.
 // @Tags pools
 // @Accept json
 // @Produce json
+// @Produce application/x-ndjson
 // @Param id path string true "Pool ID"
 // @Param period query string false "Time period (1h, 24h, 7d, 30d)" default(24h)
+// @Param bucket query string false "Bucket width (1m, 5m, 1h, 6h, 1d); defaults to 1m, 5m, 1h or 6h by period"
+// @Param tz query string false "IANA time zone buckets are aligned in, e.g. Asia/Tokyo" default(UTC)
+// @Param fill query string false "Fill buckets without data points: none, or previous to repeat the bucket before them" default(none)
+// @Param stream query bool false "Stream the data points as NDJSON"
 // @Success 200 {object} models.PoolHistoryResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrors
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/pools/{id}/history [get]
 func (h *Handler) GetPoolHistory(c *fiber.Ctx) error {
@@ -152,6 +357,8 @@ func (h *Handler) GetPoolHistory(c *fiber.Ctx) error {
 	defer cancel()
 	poolID := c.Params("id")
 	period := c.Query("period", "24h")
+	bucket := c.Query("bucket", models.DefaultHistoryBucket(period))
+	fill := c.Query("fill", models.HistoryFillNone)
 
 	// Validate pool ID
 	if errors := ValidatePoolID(poolID); len(errors) > 0 {
@@ -163,8 +370,26 @@ func (h *Handler) GetPoolHistory(c *fiber.Ctx) error {
 		return SendValidationError(c, errors)
 	}
 
+	loc, validationErrors := ValidateHistoryBucketing(bucket, c.Query("tz"))
+	validationErrors = append(validationErrors, ValidateHistoryFill(fill)...)
+	if len(validationErrors) > 0 {
+		return SendValidationError(c, validationErrors)
+	}
+
 	// Fetch historical data from TimescaleDB
-	history, err := h.pg.GetPoolHistory(ctx, poolID, period)
+	since := models.HistoryWindowStart(time.Now(), period, bucket, loc)
+	if stream := c.Query("stream"); stream == "true" || stream == "1" {
+		h.streamPoolHistory(c, models.PoolHistoryStreamMeta{
+			PoolID:   poolID,
+			Period:   period,
+			Bucket:   bucket,
+			Timezone: loc.String(),
+			Fill:     fill,
+		}, since, loc)
+		return nil
+	}
+
+	history, err := h.pg.GetPoolHistory(ctx, poolID, since, bucket, loc)
 	if err != nil {
 		log.Error().Err(err).
 			Str("pool_id", poolID).
@@ -176,36 +401,220 @@ func (h *Handler) GetPoolHistory(c *fiber.Ctx) error {
 	response := models.PoolHistoryResponse{
 		PoolID:     poolID,
 		Period:     period,
+		Bucket:     bucket,
+		Timezone:   loc.String(),
+		Fill:       fill,
 		DataPoints: history,
 	}
+	if fill == models.HistoryFillPrevious {
+		response.DataPoints = make([]models.HistoricalAPY, 0, len(history))
+		add := models.ForwardFillHistory(bucket, loc, func(point models.HistoricalAPY) error {
+			response.DataPoints = append(response.DataPoints, point)
+			return nil
+		})
+		for _, point := range history {
+			add(point)
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// streamPoolHistory writes a pool's history as NDJSON while it is read, so
+// long series are never held in memory. The last line carries meta, with
+// the count, whether the row cap cut the series short, and any error,
+// since the status was sent with the first line. A client that disconnects
+// cancels the query.
+func (h *Handler) streamPoolHistory(c *fiber.Ctx, meta models.PoolHistoryStreamMeta, since time.Time, loc *time.Location) {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+
+	// The writer runs after the handler returns, so it must not use c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		h.writePoolHistory(ctx, w, meta, since, loc)
+	})
+}
+
+// writePoolHistory streams a pool's history to w as NDJSON. A failed write
+// means the client is gone: the query is cancelled and nothing more is
+// written.
+func (h *Handler) writePoolHistory(ctx context.Context, w *bufio.Writer, meta models.PoolHistoryStreamMeta, since time.Time, loc *time.Location) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	enc := json.NewEncoder(w)
+	var writeErr error
+	write := func(point models.HistoricalAPY) error {
+		if meta.Count == maxStreamedHistoryPoints {
+			meta.Truncated = true
+			return errHistoryTruncated
+		}
+
+		writeErr = enc.Encode(point)
+		if writeErr == nil && (meta.Count+1)%historyStreamFlushEvery == 0 {
+			writeErr = w.Flush()
+		}
+		if writeErr != nil {
+			cancel()
+			return writeErr
+		}
+		meta.Count++
+		return nil
+	}
+	if meta.Fill == models.HistoryFillPrevious {
+		write = models.ForwardFillHistory(meta.Bucket, loc, write)
+	}
+	err := h.history.StreamPoolHistory(ctx, meta.PoolID, since, meta.Bucket, loc, maxStreamedHistoryPoints+1, write)
+
+	switch {
+	case writeErr != nil:
+		log.Debug().Err(writeErr).Str("pool_id", meta.PoolID).Msg("Pool history stream client gone")
+		return
+	case err != nil && !errors.Is(err, errHistoryTruncated):
+		log.Error().Err(err).
+			Str("pool_id", meta.PoolID).
+			Str("period", meta.Period).
+			Msg("Failed to stream pool history")
+		meta.Error = "Failed to fetch pool history"
+	}
+
+	if err := enc.Encode(fiber.Map{"meta": meta}); err == nil {
+		w.Flush()
+	}
+}
+
+// GetPoolRiskHistory returns the changes in a pool's risk level
+// @Summary Get pool risk level transitions
+// @Description List when a pool's computed risk level changed, newest first, with the APY, TVL, score and chain rating that produced each new level. Only changes are recorded, not every ingestion cycle.
+// @Tags pools
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ID"
+// @Success 200 {object} models.PoolRiskHistoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/pools/{id}/risk-history [get]
+func (h *Handler) GetPoolRiskHistory(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	poolID := c.Params("id")
+
+	// Validate pool ID
+	if errors := ValidatePoolID(poolID); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	transitions, err := h.pg.GetPoolRiskTransitions(ctx, poolID, maxRiskTransitions)
+	if err != nil {
+		log.Error().Err(err).Str("pool_id", poolID).Msg("Failed to fetch pool risk history")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch pool risk history"))
+	}
+
+	return c.JSON(models.PoolRiskHistoryResponse{
+		PoolID:      poolID,
+		Transitions: transitions,
+	})
+}
+
+// GetPoolOpportunities returns the active opportunities involving a pool
+// @Summary Get a pool's opportunities
+// @Description List the active opportunities that involve a pool, grouped by its role: the source of a yield gap (asSource), the target of one (asTarget), or the subject of a trending or high-score opportunity (direct). Groups are empty when the pool has none.
+// @Tags pools
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ID"
+// @Success 200 {object} models.PoolOpportunitiesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/pools/{id}/opportunities [get]
+func (h *Handler) GetPoolOpportunities(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	poolID := c.Params("id")
+
+	// Validate pool ID
+	if errors := ValidatePoolID(poolID); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	// Try cache first
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetPoolOpportunitiesCache(ctx, poolID)
+		if err == nil && cached != nil {
+			log.Debug().Str("pool_id", poolID).Msg("Cache hit for pool opportunities")
+			setCacheHit(c)
+			cached.SetRelativeTimes()
+			return c.JSON(cached)
+		}
+	}
+
+	exists, err := h.pg.PoolExists(ctx, poolID)
+	if err != nil {
+		log.Error().Err(err).Str("pool_id", poolID).Msg("Failed to check pool")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch pool opportunities"))
+	}
+	if !exists {
+		return SendError(c, ErrNotFound.WithDetails(fmt.Sprintf("Pool '%s' not found", poolID)))
+	}
+
+	opportunities, err := h.pg.GetPoolOpportunities(ctx, poolID)
+	if err != nil {
+		log.Error().Err(err).Str("pool_id", poolID).Msg("Failed to fetch pool opportunities")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch pool opportunities"))
+	}
+
+	response := models.NewPoolOpportunitiesResponse(poolID, opportunities)
+
+	// Cache for 1 minute
+	if err := h.cache.SetPoolOpportunitiesCache(ctx, &response, 60); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache pool opportunities")
+	}
 
+	setCacheMiss(c, bypass, backendPostgres)
+	response.SetRelativeTimes()
 	return c.JSON(response)
 }
 
-// buildPoolsCacheKey creates a cache key from filter parameters
-func buildPoolsCacheKey(filter models.PoolFilter) string {
-	stablecoin := ""
-	if filter.StableCoin != nil {
-		if *filter.StableCoin {
-			stablecoin = "true"
-		} else {
-			stablecoin = "false"
+// GetPoolDistribution returns pool counts bucketed by score, TVL and chain
+// @Summary Get pool distribution
+// @Description Count pools per score range, TVL range and chain in one response. Bucket boundaries are configured with POOL_DISTRIBUTION_SCORE_BUCKETS and POOL_DISTRIBUTION_TVL_BUCKETS. Pools below LISTING_MIN_TVL are left out unless includeEmpty is set.
+// @Tags pools
+// @Accept json
+// @Produce json
+// @Param includeEmpty query bool false "Count dead pools with less TVL than LISTING_MIN_TVL"
+// @Success 200 {object} models.PoolDistribution
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/pools/distribution [get]
+func (h *Handler) GetPoolDistribution(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	includeEmpty := queryFlag(c, "includeEmpty")
+
+	// Try cache first
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetDistributionCache(ctx, includeEmpty)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
 		}
 	}
-	return fmt.Sprintf("pools:%s:%s:%s:%s:%s:%s:%s:%s:%s:%s:%s:%s:%d:%d",
-		filter.Chain,
-		filter.Protocol,
-		filter.Symbol,
-		filter.Search,
-		filter.MinAPY.String(),
-		filter.MaxAPY.String(),
-		filter.MinTVL.String(),
-		filter.MaxTVL.String(),
-		filter.MinScore.String(),
-		stablecoin,
-		filter.SortBy,
-		filter.SortOrder,
-		filter.Limit,
-		filter.Offset,
-	)
+
+	dist, err := h.pg.GetPoolDistribution(ctx, h.config.Distribution.ScoreBuckets, h.config.Distribution.TVLBuckets, h.listingFloor(includeEmpty))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to fetch pool distribution")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch pool distribution"))
+	}
+
+	if err := h.cache.SetDistributionCache(ctx, includeEmpty, dist, int(h.config.Distribution.CacheTTL.Seconds())); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache pool distribution")
+	}
+
+	setCacheMiss(c, bypass, backendPostgres)
+	return c.JSON(dist)
 }
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// fakeHistory serves a series of points a row at a time, like pgx rows
+type fakeHistory struct {
+	points    int // Points in the series; negative for an endless one
+	err       error
+	cancelled atomic.Bool // The context was cancelled when the stream stopped
+}
+
+func (f *fakeHistory) StreamPoolHistory(ctx context.Context, poolID string, since time.Time, _ string, loc *time.Location, limit int, fn func(models.HistoricalAPY) error) error {
+	defer func() { f.cancelled.Store(ctx.Err() != nil) }()
+
+	for i := 0; f.points < 0 || i < f.points; i++ {
+		if limit > 0 && i == limit {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(models.HistoricalAPY{
+			PoolID:    poolID,
+			Timestamp: since.Add(time.Duration(i) * time.Minute).In(loc),
+			APY:       decimal.NewFromFloat(4.25),
+			TVL:       decimal.NewFromInt(1_500_000),
+			APYBase:   decimal.NewFromFloat(3.1),
+			APYReward: decimal.NewFromFloat(1.15),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// failingWriter fails once more than limit bytes were written, as a
+// connection does once the client is gone
+type failingWriter struct {
+	limit, written int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, errors.New("broken pipe")
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestGetPoolHistory_Stream(t *testing.T) {
+	h := &Handler{config: &config.Config{}, history: &fakeHistory{points: 3}}
+	app := fiber.New()
+	app.Get("/pools/:id/history", h.GetPoolHistory)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/pools/pool-1/history?period=24h&stream=true", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON, got %q", ct)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 3 points and a meta line, got %q", body)
+	}
+
+	var point models.HistoricalAPY
+	if err := json.Unmarshal([]byte(lines[0]), &point); err != nil || point.PoolID != "pool-1" || !point.APY.Equal(decimal.NewFromFloat(4.25)) {
+		t.Errorf("Expected a data point on the first line, got %q (%v)", lines[0], err)
+	}
+
+	var trailer struct {
+		Meta models.PoolHistoryStreamMeta `json:"meta"`
+	}
+	if err := json.Unmarshal([]byte(lines[3]), &trailer); err != nil {
+		t.Fatalf("Failed to decode meta line %q: %v", lines[3], err)
+	}
+	want := models.PoolHistoryStreamMeta{PoolID: "pool-1", Period: "24h", Bucket: "5m", Timezone: "UTC", Fill: "none", Count: 3}
+	if trailer.Meta != want {
+		t.Errorf("Expected meta %+v, got %+v", want, trailer.Meta)
+	}
+}
+
+func TestWritePoolHistory_Truncated(t *testing.T) {
+	h := &Handler{history: &fakeHistory{points: maxStreamedHistoryPoints + 10}}
+
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	h.writePoolHistory(context.Background(), w, models.PoolHistoryStreamMeta{PoolID: "pool-1"}, time.Now(), time.UTC)
+
+	body := out.String()
+	if n := strings.Count(body, "\n"); n != maxStreamedHistoryPoints+1 {
+		t.Errorf("Expected %d points and a meta line, got %d lines", maxStreamedHistoryPoints, n)
+	}
+	last := body[strings.LastIndex(strings.TrimSuffix(body, "\n"), "\n")+1:]
+	if !strings.Contains(last, `"truncated":true`) || !strings.Contains(last, `"count":100000`) {
+		t.Errorf("Expected a truncated meta line, got %q", last)
+	}
+}
+
+func TestWritePoolHistory_Error(t *testing.T) {
+	h := &Handler{history: &fakeHistory{points: 2, err: errors.New("connection reset")}}
+
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	h.writePoolHistory(context.Background(), w, models.PoolHistoryStreamMeta{PoolID: "pool-1"}, time.Now(), time.UTC)
+
+	if !strings.HasSuffix(out.String(), `"count":2,"truncated":false,"error":"Failed to fetch pool history"}}`+"\n") {
+		t.Errorf("Expected the error in the meta line, got %q", out.String())
+	}
+}
+
+func TestWritePoolHistory_ClientGone(t *testing.T) {
+	history := &fakeHistory{points: -1}
+	h := &Handler{history: history}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := bufio.NewWriterSize(&failingWriter{limit: 64 << 10}, 4096)
+		h.writePoolHistory(context.Background(), w, models.PoolHistoryStreamMeta{PoolID: "pool-1"}, time.Now(), time.UTC)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to stop once writes fail")
+	}
+	if !history.cancelled.Load() {
+		t.Error("Expected the query context cancelled when the client went away")
+	}
+}
+
+// peakHeap runs fn and returns the most heap it had in use above what was
+// in use before, sampled while it ran
+func peakHeap(fn func()) uint64 {
+	sample := []rtmetrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	runtime.GC()
+	rtmetrics.Read(sample)
+	base := sample[0].Value.Uint64()
+
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		s := []rtmetrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+		for {
+			rtmetrics.Read(s)
+			if v := s[0].Value.Uint64(); v > base && v-base > peak {
+				peak = v - base
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Microsecond):
+			}
+		}
+	}()
+
+	fn()
+	close(done)
+	<-sampled
+	return peak
+}
+
+// BenchmarkPoolHistory compares the peak heap of building a 50k-point
+// history and encoding it at once with streaming it
+func BenchmarkPoolHistory(b *testing.B) {
+	const points = 50_000
+	history := &fakeHistory{points: points}
+	h := &Handler{history: history}
+	since := time.Now().Add(-points * time.Minute)
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			peak = max(peak, peakHeap(func() {
+				data := make([]models.HistoricalAPY, 0)
+				history.StreamPoolHistory(context.Background(), "pool-1", since, "1m", time.UTC, 0, func(p models.HistoricalAPY) error {
+					data = append(data, p)
+					return nil
+				})
+				body, err := json.Marshal(models.PoolHistoryResponse{PoolID: "pool-1", DataPoints: data})
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Discard.Write(body)
+			}))
+		}
+		b.ReportMetric(float64(peak), "peak-heap-B")
+	})
+
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			peak = max(peak, peakHeap(func() {
+				w := bufio.NewWriter(io.Discard)
+				h.writePoolHistory(context.Background(), w, models.PoolHistoryStreamMeta{PoolID: "pool-1", Bucket: "1m"}, since, time.UTC)
+			}))
+		}
+		b.ReportMetric(float64(peak), "peak-heap-B")
+	})
+}
+
+// fakeSparklines counts the sparkline queries and returns the points of
+// the pools it has, in no particular order
+type fakeSparklines struct {
+	points  map[string][]float64
+	queries int
+	asked   []string
+	err     error
+}
+
+func (f *fakeSparklines) GetPoolSparklines(ctx context.Context, ids []string, since time.Time) (map[string][]float64, error) {
+	f.queries++
+	f.asked = ids
+	if f.err != nil {
+		return nil, f.err
+	}
+	points := make(map[string][]float64)
+	for _, id := range ids {
+		if line, ok := f.points[id]; ok {
+			points[id] = line
+		}
+	}
+	return points, nil
+}
+
+func TestListSparklines_OneQueryPerPage(t *testing.T) {
+	source := &fakeSparklines{points: make(map[string][]float64)}
+	pools := make([]models.Pool, 50)
+	for i := range pools {
+		id := "pool-" + strconv.Itoa(i)
+		pools[i] = models.Pool{ID: id}
+		source.points[id] = []float64{float64(i), float64(i) + 0.5}
+	}
+	// Short and missing histories
+	source.points["pool-1"] = []float64{3.2}
+	delete(source.points, "pool-2")
+
+	h := &Handler{sparklines: source}
+	sparklines := h.listSparklines(context.Background(), pools)
+
+	if source.queries != 1 {
+		t.Fatalf("Expected 1 query for a page of 50 pools, got %d", source.queries)
+	}
+	if len(source.asked) != 50 {
+		t.Errorf("Expected the query to ask for the 50 listed pools, got %d", len(source.asked))
+	}
+	if len(sparklines) != 50 {
+		t.Fatalf("Expected a sparkline for each of the 50 pools, got %d", len(sparklines))
+	}
+	for i, pool := range pools[3:] {
+		want := []float64{float64(i + 3), float64(i+3) + 0.5}
+		if got := sparklines[pool.ID]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("Expected %s to get %v, got %v", pool.ID, want, got)
+		}
+	}
+
+	// Pools with too little history get an empty array, not null
+	data, _ := json.Marshal(models.PoolListResponse{Sparklines: sparklines})
+	for _, id := range []string{"pool-1", "pool-2"} {
+		if !strings.Contains(string(data), `"`+id+`":[]`) {
+			t.Errorf("Expected an empty sparkline for %s, got %s", id, data)
+		}
+	}
+}
+
+func TestListSparklines_ServedWithoutOnFailure(t *testing.T) {
+	source := &fakeSparklines{err: errors.New("connection refused")}
+	h := &Handler{sparklines: source}
+
+	if sparklines := h.listSparklines(context.Background(), []models.Pool{{ID: "a"}}); sparklines != nil {
+		t.Errorf("Expected no sparklines when the query fails, got %v", sparklines)
+	}
+	if sparklines := h.listSparklines(context.Background(), nil); sparklines != nil || source.queries != 1 {
+		t.Errorf("Expected no query for an empty page, got %v after %d queries", sparklines, source.queries)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Pool detail cache TTLs in seconds. A pool ID that wasn't found is
+// remembered briefly so probes for bogus IDs don't reach PostgreSQL; the
+// tombstone is cleared when ingestion caches the pool.
+const (
+	poolCacheTTL     = 60
+	poolTombstoneTTL = 30
+)
+
+// errPoolNotFound is returned for a pool that doesn't exist or was
+// recently looked up and not found
+var errPoolNotFound = errors.New("pool not found")
+
+// poolCache caches pools and tombstones for pool IDs that weren't found.
+// Implemented by every cache.Cache.
+type poolCache interface {
+	GetPool(ctx context.Context, id string) (*models.Pool, error)
+	SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error
+	HasPoolTombstone(ctx context.Context, id string) (bool, error)
+	SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error
+}
+
+// poolStore loads a pool. The error wraps os.ErrNotExist if there is no such
+// pool. Implemented by the PostgreSQL repository.
+type poolStore interface {
+	GetPool(ctx context.Context, id string) (*models.Pool, error)
+}
+
+// loadCounters counts cache lookups that never reached the database
+type loadCounters struct {
+	tombstoneHits atomic.Int64 // Pool lookups answered by a tombstone
+	sharedPool    atomic.Int64 // Pool loads shared with a concurrent request
+	sharedStats   atomic.Int64 // Stats loads shared with a concurrent request
+}
+
+// families returns the counters as metric families
+func (c *loadCounters) families() []metrics.Family {
+	return []metrics.Family{
+		{
+			Name:    "defi_cache_negative_hits_total",
+			Help:    "Pool lookups answered 404 from a not-found tombstone",
+			Type:    "counter",
+			Samples: []metrics.Sample{{Value: float64(c.tombstoneHits.Load())}},
+		},
+		{
+			Name: "defi_cache_shared_loads_total",
+			Help: "Cache misses served by a concurrent request's database load",
+			Type: "counter",
+			Samples: []metrics.Sample{
+				{Labels: map[string]string{"lookup": "pool"}, Value: float64(c.sharedPool.Load())},
+				{Labels: map[string]string{"lookup": "stats"}, Value: float64(c.sharedStats.Load())},
+			},
+		},
+	}
+}
+
+// poolLoader serves pool detail lookups. Concurrent misses for the same ID
+// share one database query.
+type poolLoader struct {
+	cache    poolCache
+	store    poolStore
+	group    singleflight.Group
+	counters *loadCounters
+}
+
+// get returns a pool and whether it came from the cache. Unless bypass is
+// set, the cache and tombstones are consulted first. Returns
+// errPoolNotFound if there is no such pool.
+func (l *poolLoader) get(ctx context.Context, id string, bypass bool) (*models.Pool, bool, error) {
+	if !bypass {
+		if cached, err := l.cache.GetPool(ctx, id); err == nil && cached != nil {
+			return cached, true, nil
+		}
+		if missing, err := l.cache.HasPoolTombstone(ctx, id); err == nil && missing {
+			l.counters.tombstoneHits.Add(1)
+			return nil, true, errPoolNotFound
+		}
+	}
+
+	v, err, shared := l.group.Do(id, func() (interface{}, error) {
+		return l.load(ctx, id)
+	})
+	if shared {
+		l.counters.sharedPool.Add(1)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v.(*models.Pool), false, nil
+}
+
+// load fetches a pool from the database and caches it, or tombstones its
+// ID if it doesn't exist
+func (l *poolLoader) load(ctx context.Context, id string) (*models.Pool, error) {
+	pool, err := l.store.GetPool(ctx, id)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := l.cache.SetPoolTombstone(ctx, id, poolTombstoneTTL); err != nil {
+			log.Debug().Err(err).Str("pool_id", id).Msg("Failed to cache pool tombstone")
+		}
+		return nil, errPoolNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool: %w", err)
+	}
+
+	if err := l.cache.SetPool(ctx, pool, poolCacheTTL); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache pool")
+	}
+	return pool, nil
+}
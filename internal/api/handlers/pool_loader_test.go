@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// fakePoolCache is an in-memory poolCache. Tombstones don't expire; the
+// Redis repository tests cover expiry.
+type fakePoolCache struct {
+	mu         sync.Mutex
+	pools      map[string]*models.Pool
+	tombstones map[string]int // TTL by pool ID
+}
+
+func newFakePoolCache() *fakePoolCache {
+	return &fakePoolCache{pools: make(map[string]*models.Pool), tombstones: make(map[string]int)}
+}
+
+func (f *fakePoolCache) GetPool(ctx context.Context, id string) (*models.Pool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pools[id], nil
+}
+
+func (f *fakePoolCache) SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pools[pool.ID] = pool
+	return nil
+}
+
+func (f *fakePoolCache) HasPoolTombstone(ctx context.Context, id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.tombstones[id]
+	return ok, nil
+}
+
+func (f *fakePoolCache) SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tombstones[id] = ttlSeconds
+	return nil
+}
+
+// fakePoolStore serves pools from a map, counting queries. A non-nil
+// release channel holds every query until it is closed.
+type fakePoolStore struct {
+	pools   map[string]models.Pool
+	err     error
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (f *fakePoolStore) GetPool(ctx context.Context, id string) (*models.Pool, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	pool, ok := f.pools[id]
+	if !ok {
+		return nil, fmt.Errorf("pool not found: %w", os.ErrNotExist)
+	}
+	return &pool, nil
+}
+
+func TestPoolLoader_TombstonesMissingPools(t *testing.T) {
+	cache := newFakePoolCache()
+	store := &fakePoolStore{pools: map[string]models.Pool{"pool-1": {ID: "pool-1"}}}
+	loader := &poolLoader{cache: cache, store: store, counters: &loadCounters{}}
+	ctx := context.Background()
+
+	if _, cached, err := loader.get(ctx, "bogus", false); !errors.Is(err, errPoolNotFound) || cached {
+		t.Fatalf("Expected a not-found miss, got cached=%v err=%v", cached, err)
+	}
+	if ttl := cache.tombstones["bogus"]; ttl != poolTombstoneTTL {
+		t.Fatalf("Expected a tombstone with TTL %d, got %d", poolTombstoneTTL, ttl)
+	}
+
+	// Repeated lookups are answered by the tombstone
+	for i := 0; i < 3; i++ {
+		if _, cached, err := loader.get(ctx, "bogus", false); !errors.Is(err, errPoolNotFound) || !cached {
+			t.Fatalf("Expected a not-found cache hit, got cached=%v err=%v", cached, err)
+		}
+	}
+	if n := store.calls.Load(); n != 1 {
+		t.Errorf("Expected one database query, got %d", n)
+	}
+	if n := loader.counters.tombstoneHits.Load(); n != 3 {
+		t.Errorf("Expected 3 tombstone hits, got %d", n)
+	}
+
+	// Bypassing the cache ignores the tombstone
+	loader.get(ctx, "bogus", true)
+	if n := store.calls.Load(); n != 2 {
+		t.Errorf("Expected a cache bypass to query the database, got %d queries", n)
+	}
+
+	// Found pools are cached, not tombstoned
+	if pool, cached, err := loader.get(ctx, "pool-1", false); err != nil || cached || pool.ID != "pool-1" {
+		t.Fatalf("Expected pool-1 from the database, got %+v cached=%v err=%v", pool, cached, err)
+	}
+	if _, tombstoned := cache.tombstones["pool-1"]; tombstoned || cache.pools["pool-1"] == nil {
+		t.Errorf("Expected pool-1 cached without a tombstone")
+	}
+}
+
+func TestPoolLoader_StoreErrorNotTombstoned(t *testing.T) {
+	cache := newFakePoolCache()
+	store := &fakePoolStore{err: errors.New("connection refused")}
+	loader := &poolLoader{cache: cache, store: store, counters: &loadCounters{}}
+
+	_, _, err := loader.get(context.Background(), "pool-1", false)
+	if err == nil || errors.Is(err, errPoolNotFound) {
+		t.Fatalf("Expected the database error, got %v", err)
+	}
+	if len(cache.tombstones) != 0 {
+		t.Errorf("Expected no tombstone for a failed query, got %v", cache.tombstones)
+	}
+}
+
+func TestPoolLoader_SharesConcurrentLoads(t *testing.T) {
+	store := &fakePoolStore{pools: map[string]models.Pool{"pool-1": {ID: "pool-1"}}, release: make(chan struct{})}
+	loader := &poolLoader{cache: newFakePoolCache(), store: store, counters: &loadCounters{}}
+
+	const requests = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool, _, err := loader.get(context.Background(), "pool-1", true)
+			if err == nil && pool.ID != "pool-1" {
+				err = fmt.Errorf("got pool %s", pool.ID)
+			}
+			errs <- err
+		}()
+	}
+
+	// Let every request reach the shared load before it completes
+	deadline := time.Now().Add(2 * time.Second)
+	for store.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if n := store.calls.Load(); n != 1 {
+		t.Errorf("Expected concurrent misses to share one query, got %d", n)
+	}
+	if n := loader.counters.sharedPool.Load(); n != requests {
+		t.Errorf("Expected %d requests to share the load, got %d", requests, n)
+	}
+}
@@ -1,42 +1,74 @@
 package handlers
 
 import (
+	"context"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
 
-// ListChains returns all supported blockchain networks with statistics
+// ListChains returns the supported blockchain networks with statistics
 // GET /api/v1/chains
+// Query params: sortBy, sortOrder, limit, offset, includeEmpty
+//
+// Pools below LISTING_MIN_TVL are left out unless includeEmpty is set.
 func (h *Handler) ListChains(c *fiber.Ctx) error {
 	ctx := c.Context()
 
+	// There are few chains, so a page holds all of them unless asked otherwise
+	filter := models.ChainFilter{
+		SortBy:    c.Query("sortBy", "tvl"),
+		SortOrder: c.Query("sortOrder", "desc"),
+		Limit:     c.QueryInt("limit", models.MaxPageLimit),
+		Offset:    c.QueryInt("offset", 0),
+	}
+
+	filter.Limit = models.ClampLimit(filter.Limit, models.MaxPageLimit, models.MaxPageLimit)
+	filter.Offset = models.ClampOffset(filter.Offset)
+	filter.IncludeEmpty = queryFlag(c, "includeEmpty")
+	filter.TVLFloor = h.listingFloor(filter.IncludeEmpty)
+
 	// Try cache first
-	cached, err := h.redis.GetChainsCache(ctx)
-	if err == nil && cached != nil {
-		return c.JSON(cached)
+	cacheKey := buildChainsCacheKey(filter)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetChainsCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
 	}
 
 	// Fetch from database
-	chains, err := h.pg.ListChains(ctx)
+	chains, total, err := h.pg.ListChains(ctx, filter)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch chains")
 	}
 
 	response := models.ChainListResponse{
-		Data:  chains,
-		Total: len(chains),
+		Data:    chains,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+		HasMore: int64(filter.Offset+len(chains)) < total,
 	}
 
 	// Cache for 5 minutes (chain data doesn't change often)
-	_ = h.redis.SetChainsCache(ctx, &response, 300)
+	_ = h.cache.SetChainsCache(ctx, cacheKey, &response, 300)
 
+	setCacheMiss(c, bypass, backendPostgres)
 	return c.JSON(response)
 }
 
 // ListProtocols returns all DeFi protocols with statistics
 // GET /api/v1/protocols
-// Query params: chain, category, sortBy, sortOrder, limit, offset
+// Query params: chain, category, sortBy, sortOrder, limit, offset, includeEmpty
+//
+// Pools below LISTING_MIN_TVL are left out unless includeEmpty is set.
 func (h *Handler) ListProtocols(c *fiber.Ctx) error {
 	ctx := c.Context()
 
@@ -45,19 +77,24 @@ func (h *Handler) ListProtocols(c *fiber.Ctx) error {
 		Category:  c.Query("category"),
 		SortBy:    c.Query("sortBy", "tvl"),
 		SortOrder: c.Query("sortOrder", "desc"),
-		Limit:     c.QueryInt("limit", 50),
+		Limit:     c.QueryInt("limit", models.DefaultPageLimit),
 		Offset:    c.QueryInt("offset", 0),
 	}
 
-	if filter.Limit > 100 {
-		filter.Limit = 100
-	}
+	filter.Limit = models.ClampLimit(filter.Limit, models.DefaultPageLimit, models.MaxPageLimit)
+	filter.Offset = models.ClampOffset(filter.Offset)
+	filter.IncludeEmpty = queryFlag(c, "includeEmpty")
+	filter.TVLFloor = h.listingFloor(filter.IncludeEmpty)
 
 	// Try cache first
-	cacheKey := "protocols:" + filter.Chain + ":" + filter.Category
-	cached, err := h.redis.GetProtocolsCache(ctx, cacheKey)
-	if err == nil && cached != nil {
-		return c.JSON(cached)
+	cacheKey := buildProtocolsCacheKey(filter)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetProtocolsCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
 	}
 
 	// Fetch from database
@@ -75,30 +112,326 @@ func (h *Handler) ListProtocols(c *fiber.Ctx) error {
 	}
 
 	// Cache for 5 minutes
-	_ = h.redis.SetProtocolsCache(ctx, cacheKey, &response, 300)
+	_ = h.cache.SetProtocolsCache(ctx, cacheKey, &response, 300)
+
+	setCacheMiss(c, bypass, backendPostgres)
+	return c.JSON(response)
+}
+
+// tagsCacheTTL is how long the tag listing stays cached (seconds);
+// ingestion clears it sooner
+const tagsCacheTTL = 300
+
+// ListTags returns the pool categories with their pool counts and TVL
+// @Summary List pool tags
+// @Description List every tag carried by a pool (lending, dex-lp, liquid-staking, rwa, ...) with the number of pools and their combined TVL, largest TVL first. Outlier pools are not counted. Filter pools by tag with the tag parameter of /api/v1/pools.
+// @Tags stats
+// @Produce json
+// @Success 200 {object} models.TagListResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/tags [get]
+func (h *Handler) ListTags(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+
+	// Try cache first
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetTagsCache(ctx)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
+	}
+
+	tags, err := h.pg.ListTags(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list tags")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch tags"))
+	}
+
+	response := models.TagListResponse{
+		Data:  tags,
+		Total: len(tags),
+	}
+
+	if err := h.cache.SetTagsCache(ctx, &response, tagsCacheTTL); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache tags")
+	}
+
+	setCacheMiss(c, bypass, backendPostgres)
+	return c.JSON(response)
+}
+
+// GetProtocolHistory returns a protocol's APY history
+// @Summary Get protocol APY history
+// @Description Get the TVL-weighted average APY and combined TVL of a protocol's pools per time bucket, for charting how the protocol as a whole trended. Buckets are as for pool history.
+// @Tags protocols
+// @Accept json
+// @Produce json
+// @Param name path string true "Protocol name (e.g., aave-v3)"
+// @Param period query string false "Time period (1h, 24h, 7d, 30d)" default(24h)
+// @Success 200 {object} models.ProtocolHistoryResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/protocols/{name}/history [get]
+func (h *Handler) GetProtocolHistory(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	protocol := c.Params("name")
+	period := c.Query("period", "24h")
+
+	// Validate protocol name
+	if errors := ValidateProtocolName(protocol); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	// Validate period
+	if errors := ValidatePeriod(period); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	// Try cache first
+	cacheKey := buildProtocolHistoryCacheKey(protocol, period)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetProtocolHistoryCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
+	}
+
+	history, err := h.pg.GetProtocolHistory(ctx, protocol, period)
+	if err != nil {
+		log.Error().Err(err).
+			Str("protocol", protocol).
+			Str("period", period).
+			Msg("Failed to fetch protocol history")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch protocol history"))
+	}
+
+	response := models.ProtocolHistoryResponse{
+		Protocol:   protocol,
+		Period:     period,
+		DataPoints: history,
+	}
+
+	// Cache for 1 minute; the finest buckets are a minute wide
+	if err := h.cache.SetProtocolHistoryCache(ctx, cacheKey, &response, 60); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache protocol history")
+	}
+
+	setCacheMiss(c, bypass, backendPostgres)
+	return c.JSON(response)
+}
+
+// chainHistoryCacheTTL returns how long a chain history stays cached
+// (seconds). The query scans every pool on the chain, so entries live for
+// about one bucket width: the series can't gain a new bucket sooner.
+func chainHistoryCacheTTL(period string) int {
+	switch period {
+	case "1h":
+		return 60
+	case "7d":
+		return 1800
+	case "30d":
+		return 3600
+	default:
+		return 300
+	}
+}
+
+// GetChainHistory returns a chain's APY history
+// @Summary Get chain APY history
+// @Description Get the TVL-weighted average APY and total TVL of every pool on a chain per time bucket, for charting whether the chain's yield is rising or falling overall. Buckets are as for pool history.
+// @Tags chains
+// @Accept json
+// @Produce json
+// @Param chain path string true "Chain name (e.g., ethereum)"
+// @Param period query string false "Time period (1h, 24h, 7d, 30d)" default(24h)
+// @Success 200 {object} models.ChainHistoryResponse
+// @Failure 422 {object} ValidationErrors
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/chains/{chain}/history [get]
+func (h *Handler) GetChainHistory(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), requestTimeout)
+	defer cancel()
+	chain := c.Params("chain")
+	period := c.Query("period", "24h")
+
+	// Validate chain name
+	if errors := ValidateChainName(chain); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	// Validate period
+	if errors := ValidatePeriod(period); len(errors) > 0 {
+		return SendValidationError(c, errors)
+	}
+
+	// Try cache first
+	cacheKey := buildChainHistoryCacheKey(chain, period)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetChainHistoryCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
+	}
+
+	history, err := h.pg.GetChainHistory(ctx, chain, period)
+	if err != nil {
+		log.Error().Err(err).
+			Str("chain", chain).
+			Str("period", period).
+			Msg("Failed to fetch chain history")
+		return SendError(c, ErrInternalServer.WithDetails("Failed to fetch chain history"))
+	}
+
+	response := models.ChainHistoryResponse{
+		Chain:      chain,
+		Period:     period,
+		DataPoints: history,
+	}
 
+	if err := h.cache.SetChainHistoryCache(ctx, cacheKey, &response, chainHistoryCacheTTL(period)); err != nil {
+		log.Debug().Err(err).Msg("Failed to cache chain history")
+	}
+
+	setCacheMiss(c, bypass, backendPostgres)
 	return c.JSON(response)
 }
 
+// listingFloor returns the TVL below which pools are left out of listings
+// and stats: LISTING_MIN_TVL, or none with includeEmpty. Dead pools are only
+// hidden, never deleted.
+func (h *Handler) listingFloor(includeEmpty bool) decimal.Decimal {
+	if includeEmpty {
+		return decimal.Zero
+	}
+	return decimal.NewFromFloat(h.config.Listing.MinTVL)
+}
+
+// opportunityScoreFloor returns the score the opportunity listing starts
+// at: the client's minScore, or LISTING_MIN_OPPORTUNITY_SCORE when it
+// doesn't pass one. Passing minScore=0 lists every opportunity.
+func (h *Handler) opportunityScoreFloor(c *fiber.Ctx, minScore decimal.Decimal) decimal.Decimal {
+	if c.Query("minScore") != "" {
+		return minScore
+	}
+	return decimal.NewFromFloat(h.config.Listing.MinOpportunityScore)
+}
+
+// sustainability returns the configured thresholds of the sustainableOnly
+// filters, shared with sustainable detection
+func (h *Handler) sustainability() models.SustainableYield {
+	return models.SustainableYield{
+		MinBaseRatio: decimal.NewFromFloat(h.config.Worker.SustainableMinBaseRatio),
+		MinBaseAPY:   decimal.NewFromFloat(h.config.Worker.SustainableMinBaseAPY),
+	}
+}
+
 // GetStats returns overall platform statistics
-// GET /api/v1/stats
+// GET /api/v1/stats?source=postgres|es&includeEmpty=true
+//
+// source=es aggregates the pool figures in ElasticSearch instead of
+// PostgreSQL, falling back to PostgreSQL if ElasticSearch fails. Pools below
+// LISTING_MIN_TVL are left out unless includeEmpty is set.
 func (h *Handler) GetStats(c *fiber.Ctx) error {
 	ctx := c.Context()
 
+	source := strings.ToLower(c.Query("source", models.StatsSourcePostgres))
+	if source != models.StatsSourcePostgres && source != models.StatsSourceES {
+		return SendValidationError(c, []ValidationError{{Field: "source", Message: "must be 'postgres' or 'es'"}})
+	}
+	includeEmpty := queryFlag(c, "includeEmpty")
+	cacheKey := source
+	if includeEmpty {
+		cacheKey += models.StatsVariantAll
+	}
+
 	// Try cache first
-	cached, err := h.redis.GetStatsCache(ctx)
-	if err == nil && cached != nil {
-		return c.JSON(cached)
+	bypass := h.bypassCache(c)
+	if !bypass {
+		cached, err := h.cache.GetStatsCache(ctx, cacheKey)
+		if err == nil && cached != nil {
+			setCacheHit(c)
+			return c.JSON(cached)
+		}
 	}
 
-	// Fetch fresh stats from database
-	stats, err := h.pg.GetPlatformStats(ctx)
+	// Concurrent misses share one load
+	v, err, shared := h.loads.Do("stats:"+cacheKey, func() (interface{}, error) {
+		return h.loadStats(ctx, source, cacheKey, h.listingFloor(includeEmpty))
+	})
+	if shared {
+		h.counters.sharedStats.Add(1)
+	}
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch statistics")
 	}
+	loaded := v.(statsLoad)
+
+	setCacheMiss(c, bypass, loaded.backend)
+	return c.JSON(loaded.stats)
+}
+
+// statsLoad is platform stats loaded on a cache miss, with the backend that
+// served them
+type statsLoad struct {
+	stats   *models.PlatformStats
+	backend string
+}
+
+// loadStats aggregates the platform stats over the pools with at least
+// minTVL of TVL from the given source and caches them under cacheKey
+func (h *Handler) loadStats(ctx context.Context, source, cacheKey string, minTVL decimal.Decimal) (statsLoad, error) {
+	var stats *models.PlatformStats
+	backend := backendPostgres
+	if source == models.StatsSourceES {
+		var err error
+		if stats, err = h.esPlatformStats(ctx, minTVL); err != nil {
+			log.Warn().Err(err).Msg("Failed to aggregate stats in ElasticSearch, falling back to PostgreSQL")
+		} else {
+			backend = backendES
+		}
+	}
+
+	// Fetch fresh stats from database
+	if stats == nil {
+		var err error
+		if stats, err = h.pg.GetPlatformStats(ctx, minTVL); err != nil {
+			return statsLoad{}, err
+		}
+		stats.Source = models.StatsSourcePostgres
+	}
+
+	// Explain "missing" chains when the worker only ingests some of them
+	stats.Note = h.config.Worker.ChainFilter().Note()
 
 	// Cache for 2 minutes (stats should be relatively fresh)
-	_ = h.redis.SetStatsCache(ctx, stats, 120)
+	_ = h.cache.SetStatsCache(ctx, cacheKey, stats, 120)
+
+	return statsLoad{stats: stats, backend: backend}, nil
+}
+
+// esPlatformStats builds the platform stats from the ElasticSearch pool
+// aggregations. Only the cheap active opportunity count comes from
+// PostgreSQL.
+func (h *Handler) esPlatformStats(ctx context.Context, minTVL decimal.Decimal) (*models.PlatformStats, error) {
+	stats, err := h.es.GetPlatformStats(ctx, minTVL)
+	if err != nil {
+		return nil, err
+	}
+	stats.Source = models.StatsSourceES
+
+	if count, err := h.pg.CountActiveOpportunities(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to count active opportunities")
+	} else {
+		stats.ActiveOpportunities = count
+	}
 
-	return c.JSON(stats)
+	return stats, nil
 }
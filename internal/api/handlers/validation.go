@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/shopspring/decimal"
@@ -12,19 +15,30 @@ import (
 
 // Validation constants
 const (
-	MaxLimit     = 100
-	DefaultLimit = 50
-	MaxOffset    = 10000
+	MaxLimit     = models.MaxPageLimit
+	DefaultLimit = models.DefaultPageLimit
+	MaxOffset    = models.MaxPageOffset
+
+	DefaultPollTimeout = 30 // Seconds a pool updates long poll waits by default
+	MaxPollTimeout     = 60
+
+	DefaultIndexHistoryDays = 30 // Days of index values returned by default
+	MaxIndexHistoryDays     = 365
 )
 
-// Valid sort fields for pools
-var validPoolSortFields = map[string]bool{
-	"apy":        true,
-	"tvl":        true,
-	"score":      true,
-	"updated_at": true,
-	"chain":      true,
-	"protocol":   true,
+// indexNamePattern is the shape of an index name: a lowercase slug
+var indexNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Valid rank modes for pools
+var validRankModes = map[string]bool{
+	models.RankModeStandard: true,
+	models.RankModeDecayed:  true,
+}
+
+// Valid pool data sources
+var validDataSources = map[string]bool{
+	models.DataSourceDeFiLlama: true,
+	models.DataSourceManual:    true,
 }
 
 // Valid sort fields for opportunities
@@ -72,12 +86,22 @@ func ParsePoolFilter(c *fiber.Ctx) (models.PoolFilter, []ValidationError) {
 		Protocol:  c.Query("protocol"),
 		Symbol:    c.Query("symbol"),
 		Search:    c.Query("search"),
-		SortBy:    c.Query("sortBy", "tvl"),
+		SortBy:    c.Query("sortBy"),
 		SortOrder: strings.ToLower(c.Query("sortOrder", "desc")),
+		RankMode:  strings.ToLower(c.Query("rankMode", models.RankModeStandard)),
 		Limit:     c.QueryInt("limit", DefaultLimit),
 		Offset:    c.QueryInt("offset", 0),
 	}
 
+	// Symbol and text searches rank the best matches first unless a sort is
+	// given; plain listings sort by TVL
+	if filter.SortBy == "" {
+		filter.SortBy = "tvl"
+		if filter.MatchQuery() != "" {
+			filter.SortBy = models.SortRelevance + ",tvl"
+		}
+	}
+
 	// Parse decimal values
 	if minApy := c.Query("minApy"); minApy != "" {
 		if d, err := decimal.NewFromString(minApy); err != nil {
@@ -129,32 +153,104 @@ func ParsePoolFilter(c *fiber.Ctx) (models.PoolFilter, []ValidationError) {
 		}
 	}
 
+	if minVolume := c.Query("minVolume1d"); minVolume != "" {
+		if d, err := decimal.NewFromString(minVolume); err != nil {
+			errors = append(errors, ValidationError{Field: "minVolume1d", Message: "must be a valid number"})
+		} else if d.IsNegative() {
+			errors = append(errors, ValidationError{Field: "minVolume1d", Message: "must be non-negative"})
+		} else {
+			filter.MinVolume1D = d
+		}
+	}
+
+	if minRatio := c.Query("minVolumeTvlRatio"); minRatio != "" {
+		if d, err := decimal.NewFromString(minRatio); err != nil {
+			errors = append(errors, ValidationError{Field: "minVolumeTvlRatio", Message: "must be a valid number"})
+		} else if d.IsNegative() {
+			errors = append(errors, ValidationError{Field: "minVolumeTvlRatio", Message: "must be non-negative"})
+		} else {
+			filter.MinVolumeTVLRatio = d
+		}
+	}
+
 	// Parse stablecoin filter
 	if stablecoin := c.Query("stablecoin"); stablecoin != "" {
 		val := stablecoin == "true" || stablecoin == "1"
 		filter.StableCoin = &val
 	}
 
-	// Chain and protocol validation - allow alphanumeric with dashes, underscores, and spaces
-	// No strict validation needed as we use case-insensitive matching in the database
+	// Curation filters: curated=true keeps pools with curated attributes,
+	// audited=true those curated as audited
+	if curated := c.Query("curated"); curated != "" {
+		val := curated == "true" || curated == "1"
+		filter.Curated = &val
+	}
+	if audited := c.Query("audited"); audited != "" {
+		val := audited == "true" || audited == "1"
+		filter.Audited = &val
+	}
 
-	// Validate sort field
-	if !validPoolSortFields[filter.SortBy] {
-		errors = append(errors, ValidationError{Field: "sortBy", Message: "invalid sort field"})
+	// Precise symbol and search lookups without fuzzy matches
+	if exact := c.Query("exact"); exact != "" {
+		filter.Exact = exact == "true" || exact == "1"
 	}
 
-	// Validate sort order
+	// Pools with APYs outside POOL_APY_MIN / POOL_APY_MAX are hidden by default
+	if includeOutliers := c.Query("includeOutliers"); includeOutliers != "" {
+		filter.IncludeOutliers = includeOutliers == "true" || includeOutliers == "1"
+	}
+
+	// Pools below LISTING_MIN_TVL are hidden by default; the handler sets
+	// the floor
+	filter.IncludeEmpty = queryFlag(c, "includeEmpty")
+	filter.Sparkline = queryFlag(c, "sparkline")
+	filter.SustainableOnly = queryFlag(c, "sustainableOnly")
+
+	// Parse data source filter
+	if dataSource := strings.ToLower(c.Query("dataSource")); dataSource != "" {
+		if !validDataSources[dataSource] {
+			errors = append(errors, ValidationError{Field: "dataSource", Message: "must be 'defillama' or 'manual'"})
+		} else {
+			filter.DataSource = dataSource
+		}
+	}
+
+	// Parse tag filter: tag=dex-lp,liquid-staking matches pools carrying both.
+	// Tags are sorted so equivalent filters share a cache key.
+	if tag := c.Query("tag"); tag != "" {
+		tags, err := models.NormalizeTags(strings.Split(tag, ","))
+		if err != nil {
+			errors = append(errors, ValidationError{Field: "tag", Message: err.Error()})
+		} else {
+			filter.Tags = tags
+		}
+	}
+
+	// Chain and protocol validation - allow alphanumeric with dashes, underscores, and spaces
+	// No strict validation needed as we use case-insensitive matching in the database
+
+	// Validate sort order; it is the direction of sort keys without a suffix
 	if filter.SortOrder != "asc" && filter.SortOrder != "desc" {
 		errors = append(errors, ValidationError{Field: "sortOrder", Message: "must be 'asc' or 'desc'"})
+	} else if keys, err := models.ParseSortSpec(filter.SortBy, filter.SortOrder, models.PoolSortFields); err != nil {
+		// Validate sort fields: sortBy=chain:asc,score:desc sorts by up to MaxSortKeys fields
+		errors = append(errors, ValidationError{Field: "sortBy", Message: err.Error()})
+	} else {
+		filter.Sort = keys
+		filter.SortBy = keys[0].Field
+		filter.SortOrder = keys[0].Order
 	}
 
-	// Validate limit
-	if filter.Limit < 1 {
-		filter.Limit = DefaultLimit
-	} else if filter.Limit > MaxLimit {
-		filter.Limit = MaxLimit
+	// Validate rank mode (decayed ranking only applies to score sorts)
+	if !validRankModes[filter.RankMode] {
+		errors = append(errors, ValidationError{Field: "rankMode", Message: "must be 'standard' or 'decayed'"})
+	} else if filter.RankMode == models.RankModeDecayed && filter.SortBy != "score" {
+		errors = append(errors, ValidationError{Field: "rankMode", Message: "decayed ranking requires score as the first sort key"})
 	}
 
+	// Validate limit
+	filter.Limit = models.ClampLimit(filter.Limit, DefaultLimit, MaxLimit)
+
 	// Validate offset
 	if filter.Offset < 0 {
 		filter.Offset = 0
@@ -190,6 +286,7 @@ func ParseOpportunityFilter(c *fiber.Ctx) (models.OpportunityFilter, []Validatio
 		Limit:      c.QueryInt("limit", DefaultLimit),
 		Offset:     c.QueryInt("offset", 0),
 	}
+	filter.SustainableOnly = queryFlag(c, "sustainableOnly")
 
 	// Parse minProfit
 	if minProfit := c.Query("minProfit"); minProfit != "" {
@@ -232,20 +329,130 @@ func ParseOpportunityFilter(c *fiber.Ctx) (models.OpportunityFilter, []Validatio
 	}
 
 	// Validate limit
-	if filter.Limit < 1 {
-		filter.Limit = DefaultLimit
-	} else if filter.Limit > MaxLimit {
-		filter.Limit = MaxLimit
-	}
+	filter.Limit = models.ClampLimit(filter.Limit, DefaultLimit, MaxLimit)
 
 	// Validate offset
 	if filter.Offset < 0 {
 		filter.Offset = 0
 	}
 
+	// Parse and bound the detection time range. Without detectedAfter it
+	// follows from detectedBefore, so errors are reported on the bound given.
+	timeErrors := len(errors)
+	filter.DetectedAfter, errors = parseTimeQuery(c, "detectedAfter", errors)
+	filter.DetectedBefore, errors = parseTimeQuery(c, "detectedBefore", errors)
+	if len(errors) == timeErrors {
+		if err := filter.BoundDetectedAt(time.Now()); err != nil {
+			field := "detectedBefore"
+			if err == models.ErrLookbackTooLong && c.Query("detectedAfter") != "" {
+				field = "detectedAfter"
+			}
+			errors = append(errors, ValidationError{Field: field, Message: err.Error()})
+		}
+	}
+
 	return filter, errors
 }
 
+// queryFlag reports whether a boolean query parameter is set to true or 1
+func queryFlag(c *fiber.Ctx, name string) bool {
+	value := c.Query(name)
+	return value == "true" || value == "1"
+}
+
+// parseTimeQuery parses an optional RFC 3339 query parameter, appending a
+// validation error if it is malformed
+func parseTimeQuery(c *fiber.Ctx, field string, errors []ValidationError) (time.Time, []ValidationError) {
+	value := c.Query(field)
+	if value == "" {
+		return time.Time{}, errors
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, append(errors, ValidationError{Field: field, Message: "must be an RFC 3339 time"})
+	}
+	return t.UTC(), errors
+}
+
+// ParseOpportunityStreamFilter parses and validates the filters of an
+// opportunity event stream
+func ParseOpportunityStreamFilter(c *fiber.Ctx) (models.OpportunityStreamFilter, []ValidationError) {
+	var errors []ValidationError
+
+	filter := models.OpportunityStreamFilter{
+		Chain: strings.ToLower(c.Query("chain")),
+		Type:  models.OpportunityType(c.Query("type")),
+	}
+
+	if filter.Type != "" && !validOpportunityTypes[string(filter.Type)] {
+		errors = append(errors, ValidationError{Field: "type", Message: "invalid opportunity type"})
+	}
+
+	if minScore := c.Query("minScore"); minScore != "" {
+		if d, err := decimal.NewFromString(minScore); err != nil {
+			errors = append(errors, ValidationError{Field: "minScore", Message: "must be a valid number"})
+		} else {
+			filter.MinScore = d
+		}
+	}
+
+	return filter, errors
+}
+
+// PoolUpdatesQuery holds the parameters of a pool updates long poll
+type PoolUpdatesQuery struct {
+	Since   uint64 // Cursor from the previous poll; 0 waits for the next update
+	Timeout time.Duration
+	Chain   string          // Only updates for this chain (case-insensitive)
+	MinTVL  decimal.Decimal // Only updates for pools with at least this TVL
+}
+
+// Match reports whether an updated pool passes the poll's filters
+func (q PoolUpdatesQuery) Match(pool *models.Pool) bool {
+	if q.Chain != "" && !strings.EqualFold(pool.Chain, q.Chain) {
+		return false
+	}
+	return q.MinTVL.IsZero() || pool.TVL.GreaterThanOrEqual(q.MinTVL)
+}
+
+// ParsePoolUpdatesQuery parses and validates pool updates long-poll
+// parameters
+func ParsePoolUpdatesQuery(c *fiber.Ctx) (PoolUpdatesQuery, []ValidationError) {
+	var errors []ValidationError
+	query := PoolUpdatesQuery{
+		Timeout: DefaultPollTimeout * time.Second,
+		Chain:   c.Query("chain"),
+	}
+
+	if since := c.Query("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err != nil {
+			errors = append(errors, ValidationError{Field: "since", Message: "must be a cursor returned by a previous poll"})
+		} else {
+			query.Since = seq
+		}
+	}
+
+	if timeout := c.Query("timeout"); timeout != "" {
+		if seconds, err := strconv.Atoi(timeout); err != nil || seconds < 0 || seconds > MaxPollTimeout {
+			errors = append(errors, ValidationError{Field: "timeout", Message: fmt.Sprintf("must be between 0 and %d seconds", MaxPollTimeout)})
+		} else {
+			query.Timeout = time.Duration(seconds) * time.Second
+		}
+	}
+
+	if minTvl := c.Query("minTvl"); minTvl != "" {
+		if d, err := decimal.NewFromString(minTvl); err != nil {
+			errors = append(errors, ValidationError{Field: "minTvl", Message: "must be a valid number"})
+		} else if d.IsNegative() {
+			errors = append(errors, ValidationError{Field: "minTvl", Message: "must be non-negative"})
+		} else {
+			query.MinTVL = d
+		}
+	}
+
+	return query, errors
+}
+
 // ValidatePoolID validates a pool ID
 func ValidatePoolID(id string) []ValidationError {
 	var errors []ValidationError
@@ -259,6 +466,32 @@ func ValidatePoolID(id string) []ValidationError {
 	return errors
 }
 
+// ValidateProtocolName validates a protocol name path parameter
+func ValidateProtocolName(name string) []ValidationError {
+	var errors []ValidationError
+
+	if name == "" {
+		errors = append(errors, ValidationError{Field: "name", Message: "protocol name is required"})
+	} else if len(name) > 100 {
+		errors = append(errors, ValidationError{Field: "name", Message: "protocol name too long"})
+	}
+
+	return errors
+}
+
+// ValidateChainName validates a chain name path parameter
+func ValidateChainName(name string) []ValidationError {
+	var errors []ValidationError
+
+	if name == "" {
+		errors = append(errors, ValidationError{Field: "chain", Message: "chain name is required"})
+	} else if len(name) > 50 {
+		errors = append(errors, ValidationError{Field: "chain", Message: "chain name too long"})
+	}
+
+	return errors
+}
+
 // ValidatePeriod validates a time period parameter
 func ValidatePeriod(period string) []ValidationError {
 	var errors []ValidationError
@@ -269,3 +502,99 @@ func ValidatePeriod(period string) []ValidationError {
 
 	return errors
 }
+
+// ValidateHistoryBucketing validates the bucket and tz parameters of pool
+// history and returns the time zone, UTC when tz is empty
+func ValidateHistoryBucketing(bucket, tz string) (*time.Location, []ValidationError) {
+	var errors []ValidationError
+
+	if bucket != "" {
+		if _, ok := models.HistoryBuckets[bucket]; !ok {
+			errors = append(errors, ValidationError{Field: "bucket", Message: "must be one of: 1m, 5m, 1h, 6h, 1d"})
+		}
+	}
+
+	loc := time.UTC
+	if tz != "" {
+		// "Local" would be the server's own zone, not an IANA name
+		named, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" || len(tz) > 64 {
+			errors = append(errors, ValidationError{Field: "tz", Message: "must be an IANA time zone name such as Asia/Tokyo"})
+		} else {
+			loc = named
+		}
+	}
+
+	return loc, errors
+}
+
+// ValidateHistoryFill validates how pool history fills empty buckets
+func ValidateHistoryFill(fill string) []ValidationError {
+	switch fill {
+	case models.HistoryFillNone, models.HistoryFillPrevious:
+		return nil
+	}
+	return []ValidationError{{Field: "fill", Message: "must be one of: none, previous"}}
+}
+
+// ValidateIndexName validates an index name
+func ValidateIndexName(name string) []ValidationError {
+	var errors []ValidationError
+
+	if name == "" {
+		errors = append(errors, ValidationError{Field: "name", Message: "index name is required"})
+	} else if !indexNamePattern.MatchString(name) {
+		errors = append(errors, ValidationError{Field: "name", Message: "must be up to 64 lowercase letters, digits, dashes and underscores"})
+	}
+
+	return errors
+}
+
+// ValidateAPYIndex validates an index definition from the admin API
+func ValidateAPYIndex(idx models.APYIndex) []ValidationError {
+	errors := ValidateIndexName(idx.Name)
+
+	if len(idx.Description) > 500 {
+		errors = append(errors, ValidationError{Field: "description", Message: "must be at most 500 characters"})
+	}
+	if len(idx.Chain) > 50 {
+		errors = append(errors, ValidationError{Field: "chain", Message: "chain name too long"})
+	}
+	if len(idx.Protocol) > 100 {
+		errors = append(errors, ValidationError{Field: "protocol", Message: "protocol name too long"})
+	}
+	if len(idx.Asset) > 50 {
+		errors = append(errors, ValidationError{Field: "asset", Message: "asset too long"})
+	}
+
+	return errors
+}
+
+// ValidatePoolCuration validates the curated attributes of a pool from the
+// admin API
+func ValidatePoolCuration(curation models.PoolCuration) []ValidationError {
+	var errors []ValidationError
+
+	if !models.RewardSchedules[curation.RewardSchedule] {
+		errors = append(errors, ValidationError{Field: "rewardSchedule", Message: "must be 'locked', 'adjustable' or 'unknown'"})
+	}
+	if len(curation.Notes) > models.MaxCurationNotesLength {
+		errors = append(errors, ValidationError{Field: "notes", Message: fmt.Sprintf("must be at most %d characters", models.MaxCurationNotesLength)})
+	}
+
+	return errors
+}
+
+// ValidateIndexHistoryDays parses the days parameter of index history
+func ValidateIndexHistoryDays(c *fiber.Ctx) (int, []ValidationError) {
+	raw := c.Query("days")
+	if raw == "" {
+		return DefaultIndexHistoryDays, nil
+	}
+
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 1 || days > MaxIndexHistoryDays {
+		return 0, []ValidationError{{Field: "days", Message: fmt.Sprintf("must be an integer between 1 and %d", MaxIndexHistoryDays)}}
+	}
+	return days, nil
+}
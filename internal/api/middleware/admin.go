@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// AdminKeyHeader is the request header carrying the admin API key
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminAuth creates a middleware that restricts a route group to requests
+// carrying the configured admin API key. When no key is configured the admin
+// API is disabled and every request is rejected.
+func AdminAuth(cfg config.AdminConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if cfg.APIKey == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    403,
+					"message": "Admin API is disabled",
+				},
+			})
+		}
+
+		if !IsAdminRequest(c, cfg) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    401,
+					"message": "Invalid or missing admin key",
+				},
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// IsAdminRequest reports whether the request carries a valid admin API key
+func IsAdminRequest(c *fiber.Ctx, cfg config.AdminConfig) bool {
+	if cfg.APIKey == "" {
+		return false
+	}
+	key := c.Get(AdminKeyHeader)
+	return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.APIKey)) == 1
+}
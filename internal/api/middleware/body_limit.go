@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit creates a middleware that rejects requests with a body larger
+// than limit bytes with 413, before a handler parses it. The declared
+// Content-Length is checked first, then the body read. With
+// fiber.Config.StreamRequestBody the server reads at most its own BodyLimit
+// up front and leaves the rest on the connection; the body is then read here,
+// up to limit, so routes may accept more or less than the server default.
+func BodyLimit(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := c.Request()
+		if req.Header.ContentLength() > limit {
+			return bodyTooLarge(c)
+		}
+
+		if req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
+			}
+			if len(body) > limit {
+				return bodyTooLarge(c)
+			}
+			req.SetBody(body)
+		} else if len(c.Body()) > limit {
+			return bodyTooLarge(c)
+		}
+
+		return c.Next()
+	}
+}
+
+// bodyTooLarge responds with 413. The connection is closed, since the rest
+// of a streamed body is still unread on it.
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    413,
+			"message": "Request body too large",
+		},
+	})
+}
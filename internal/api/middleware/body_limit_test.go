@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimit(t *testing.T) {
+	app := fiber.New()
+	app.Post("/", BodyLimit(10), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", "", fiber.StatusOK},
+		{"at the limit", strings.Repeat("a", 10), fiber.StatusOK},
+		{"over the limit", strings.Repeat("a", 11), fiber.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("POST", "/", strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBodyLimit_StreamedBody(t *testing.T) {
+	// The server reads 10 bytes up front; routes read the rest up to their
+	// own limit
+	app := fiber.New(fiber.Config{BodyLimit: 10, StreamRequestBody: true})
+	echo := func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	}
+	app.Post("/small", BodyLimit(10), echo)
+	app.Post("/large", BodyLimit(100), echo)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"within the server limit", "/small", strings.Repeat("a", 10), false, fiber.StatusOK},
+		{"over the server limit", "/small", strings.Repeat("a", 11), false, fiber.StatusRequestEntityTooLarge},
+		{"chunked over the server limit", "/small", strings.Repeat("a", 11), true, fiber.StatusRequestEntityTooLarge},
+		{"within a larger route limit", "/large", strings.Repeat("a", 100), false, fiber.StatusOK},
+		{"chunked within a larger route limit", "/large", strings.Repeat("a", 100), true, fiber.StatusOK},
+		{"chunked over a larger route limit", "/large", strings.Repeat("a", 101), true, fiber.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = 0
+				req.TransferEncoding = []string{"chunked"}
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+			if tt.want != fiber.StatusOK {
+				return
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.body {
+				t.Errorf("Expected the handler to read the whole body, got %d bytes", len(body))
+			}
+		})
+	}
+}
@@ -12,7 +12,10 @@ import (
 
 // RateLimiter creates a rate limiting middleware using a sliding window algorithm.
 // It limits requests per IP address based on the configured thresholds.
-func RateLimiter(cfg config.RateLimitConfig) fiber.Handler {
+// Counters are kept in storage, or in memory if it is nil; a preforked
+// server needs shared storage, since each process would otherwise allow
+// the full limit.
+func RateLimiter(cfg config.RateLimitConfig, storage fiber.Storage) fiber.Handler {
 	return limiter.New(limiter.Config{
 		// Maximum number of requests in the time window
 		Max: cfg.Requests,
@@ -20,6 +23,8 @@ func RateLimiter(cfg config.RateLimitConfig) fiber.Handler {
 		// Time window for rate limiting
 		Expiration: cfg.Window,
 
+		Storage: storage,
+
 		// Use IP address as the key for rate limiting
 		KeyGenerator: func(c *fiber.Ctx) string {
 			// Try to get real IP from X-Forwarded-For header (for proxied requests)
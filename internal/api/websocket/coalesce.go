@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// MergedAlert combines the opportunity alerts for one pool that arrived
+// within a client's coalescing window after the first, which was sent as it
+// came.
+type MergedAlert struct {
+	PoolID        string                   `json:"poolId"`
+	Types         []models.OpportunityType `json:"types"`         // Every type alerted in the window, the first alert's included
+	Opportunities []json.RawMessage        `json:"opportunities"` // The alerts held back, in arrival order
+}
+
+// alertPoolID returns the pool an alert is coalesced by: the pool itself
+// for trending and high-score opportunities, the target for yield gaps
+func alertPoolID(opp *models.Opportunity) string {
+	if opp.PoolID != "" {
+		return opp.PoolID
+	}
+	return opp.TargetPoolID
+}
+
+// alertCoalescer holds back repeat opportunity alerts for a pool within a
+// window of the first and hands them to flush, merged, when it ends. Pools
+// alerted once in a window aren't held or flushed at all.
+type alertCoalescer struct {
+	window time.Duration
+	flush  func(MergedAlert)
+
+	mu      sync.Mutex
+	pending map[string]*pendingAlerts // By pool ID
+	stopped bool
+}
+
+// pendingAlerts is the open window of one pool
+type pendingAlerts struct {
+	types []models.OpportunityType
+	held  []json.RawMessage
+	timer *time.Timer
+}
+
+func newAlertCoalescer(window time.Duration, flush func(MergedAlert)) *alertCoalescer {
+	return &alertCoalescer{
+		window:  window,
+		flush:   flush,
+		pending: make(map[string]*pendingAlerts),
+	}
+}
+
+// offer reports whether an alert should be sent now. An alert for a pool
+// without an open window opens one and is sent; otherwise it is held for
+// the merged message.
+func (a *alertCoalescer) offer(poolID string, typ models.OpportunityType, data json.RawMessage) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped || poolID == "" {
+		return true
+	}
+
+	p, ok := a.pending[poolID]
+	if !ok {
+		p = &pendingAlerts{types: []models.OpportunityType{typ}}
+		p.timer = time.AfterFunc(a.window, func() { a.expire(poolID, p) })
+		a.pending[poolID] = p
+		return true
+	}
+
+	if !containsType(p.types, typ) {
+		p.types = append(p.types, typ)
+	}
+	p.held = append(p.held, data)
+	return false
+}
+
+// expire closes a pool's window and flushes what was held in it
+func (a *alertCoalescer) expire(poolID string, p *pendingAlerts) {
+	a.mu.Lock()
+	if a.stopped || a.pending[poolID] != p {
+		a.mu.Unlock()
+		return
+	}
+	delete(a.pending, poolID)
+	a.mu.Unlock()
+
+	if len(p.held) > 0 {
+		a.flush(MergedAlert{PoolID: poolID, Types: p.types, Opportunities: p.held})
+	}
+}
+
+// reset drops every open window without flushing, as when the client
+// unsubscribes
+func (a *alertCoalescer) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.clear()
+}
+
+// stop drops every open window for good once the client is released.
+// Alerts offered afterwards are passed straight through.
+func (a *alertCoalescer) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.clear()
+	a.stopped = true
+}
+
+// clear stops the timers of the open windows. Called with mu held.
+func (a *alertCoalescer) clear() {
+	for _, p := range a.pending {
+		p.timer.Stop()
+	}
+	a.pending = make(map[string]*pendingAlerts)
+}
+
+// open returns the number of pools with an open window
+func (a *alertCoalescer) open() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.pending)
+}
+
+func containsType(types []models.OpportunityType, typ models.OpportunityType) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
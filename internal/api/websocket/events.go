@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// eventStreamBuffer is the number of events a server-sent event stream may
+// fall behind before it is dropped; the client then reconnects and resumes
+const eventStreamBuffer = 256
+
+// eventStream is a server-sent event subscription to opportunity alerts and
+// retractions. Its events channel is closed when the stream is dropped for
+// falling behind, stopped, or the hub shuts down.
+type eventStream struct {
+	filter models.OpportunityStreamFilter
+	events chan models.OpportunityEvent
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newEventStream(filter models.OpportunityStreamFilter, buffer int) *eventStream {
+	return &eventStream{
+		filter: filter,
+		events: make(chan models.OpportunityEvent, buffer),
+	}
+}
+
+// match reports whether a broadcast passes the stream's filter
+func (s *eventStream) match(m streamMessage) bool {
+	switch {
+	case m.opportunity != nil:
+		return s.filter.MatchAlert(m.opportunity)
+	case m.retraction != nil:
+		return s.filter.MatchRetraction(m.retraction)
+	}
+	return false
+}
+
+// deliver queues a matching broadcast. A stream that can't take it is
+// closed, so its client reconnects and resumes from the last event it got.
+func (s *eventStream) deliver(m streamMessage) bool {
+	if !s.match(m) {
+		return true
+	}
+	return s.send(opportunityEvent(m))
+}
+
+// resume sends the stream a gap notice, followed by the missed events
+// matching its filter when they were all kept and fit in its buffer
+func (s *eventStream) resume(notice GapNotice, missed []streamMessage, ok bool) {
+	var matched []streamMessage
+	for _, m := range missed {
+		if s.match(m) {
+			matched = append(matched, m)
+		}
+	}
+	// Leave room for the notice itself
+	notice.Replayed = ok && len(matched) < cap(s.events)-len(s.events)
+
+	data, err := json.Marshal(notice)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal gap notice")
+		return
+	}
+	if !s.send(models.OpportunityEvent{Type: models.OpportunityEventGap, Data: data}) || !notice.Replayed {
+		return
+	}
+	for _, m := range matched {
+		if !s.send(opportunityEvent(m)) {
+			return
+		}
+	}
+}
+
+// send queues an event without blocking, closing the stream if it is full.
+// It returns false if the event wasn't queued.
+func (s *eventStream) send(event models.OpportunityEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	select {
+	case s.events <- event:
+		return true
+	default:
+		s.closed = true
+		close(s.events)
+		return false
+	}
+}
+
+// close closes the events channel once
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// opportunityEvent converts an opportunity broadcast to its event
+func opportunityEvent(m streamMessage) models.OpportunityEvent {
+	typ := models.OpportunityEventAlert
+	if m.typ == MessageTypeOpportunityRetracted {
+		typ = models.OpportunityEventRetraction
+	}
+	return models.OpportunityEvent{ID: m.seq, Type: typ, Data: m.data}
+}
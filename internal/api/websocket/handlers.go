@@ -3,6 +3,7 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
@@ -36,18 +37,30 @@ func UpgradeCheck(c *fiber.Ctx) error {
 	return fiber.ErrUpgradeRequired
 }
 
+// lastSeq reads the lastSeq query parameter a reconnecting client sends.
+// Missing or invalid values start a fresh subscription.
+func lastSeq(c *websocket.Conn) uint64 {
+	seq, err := strconv.ParseUint(c.Query("lastSeq"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
 // HandlePoolUpdates handles WebSocket connections for pool updates
-// WS /ws/pools
+// WS /ws/pools?lastSeq=
 func (h *Handler) HandlePoolUpdates(c *websocket.Conn) {
 	clientID := uuid.New().String()
 
 	client := NewClient(clientID, c, h.hub)
 
-	// Register client
-	h.hub.register <- client
+	// Register client; the hub turns clients away while shutting down
+	if !h.hub.Register(client) {
+		return
+	}
 
-	// Subscribe to pool updates
-	h.hub.SubscribeToPool(client)
+	// Subscribe to pool updates, resuming from lastSeq if given
+	h.hub.SubscribeToPool(client, lastSeq(c))
 
 	log.Info().
 		Str("client_id", clientID).
@@ -58,23 +71,29 @@ func (h *Handler) HandlePoolUpdates(c *websocket.Conn) {
 	go client.WritePump()
 	client.ReadPump() // Blocking
 
+	// ReadPump has unregistered the client, so WritePump is on its way out.
+	// Wait for it: the conn is released to the pool once this returns.
+	<-client.done
+
 	log.Info().
 		Str("client_id", clientID).
 		Msg("WebSocket client disconnected from pool updates")
 }
 
 // HandleOpportunityAlerts handles WebSocket connections for opportunity alerts
-// WS /ws/opportunities
+// WS /ws/opportunities?lastSeq=
 func (h *Handler) HandleOpportunityAlerts(c *websocket.Conn) {
 	clientID := uuid.New().String()
 
 	client := NewClient(clientID, c, h.hub)
 
-	// Register client
-	h.hub.register <- client
+	// Register client; the hub turns clients away while shutting down
+	if !h.hub.Register(client) {
+		return
+	}
 
-	// Subscribe to opportunity alerts
-	h.hub.SubscribeToOpportunities(client)
+	// Subscribe to opportunity alerts, resuming from lastSeq if given
+	h.hub.SubscribeToOpportunities(client, lastSeq(c))
 
 	log.Info().
 		Str("client_id", clientID).
@@ -85,6 +104,10 @@ func (h *Handler) HandleOpportunityAlerts(c *websocket.Conn) {
 	go client.WritePump()
 	client.ReadPump() // Blocking
 
+	// ReadPump has unregistered the client, so WritePump is on its way out.
+	// Wait for it: the conn is released to the pool once this returns.
+	<-client.done
+
 	log.Info().
 		Str("client_id", clientID).
 		Msg("WebSocket client disconnected from opportunity alerts")
@@ -98,6 +121,9 @@ func (h *Handler) StartRedisSubscriber(ctx context.Context) {
 
 	// Subscribe to opportunity alerts
 	go h.subscribeToOpportunityAlerts(ctx)
+
+	// Subscribe to opportunity retractions
+	go h.subscribeToOpportunityRetractions(ctx)
 }
 
 // subscribeToPoolUpdates listens to Redis pool update channel
@@ -119,15 +145,15 @@ func (h *Handler) subscribeToPoolUpdates(ctx context.Context) {
 				continue
 			}
 
-			// Parse pool from message
-			var pool models.Pool
-			if err := json.Unmarshal([]byte(msg.Payload), &pool); err != nil {
+			// Parse pool and its change summary from message
+			var update models.PoolUpdate
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
 				log.Debug().Err(err).Msg("Failed to unmarshal pool update")
 				continue
 			}
 
 			// Broadcast to WebSocket clients
-			h.hub.BroadcastPoolUpdate(&pool)
+			h.hub.BroadcastPoolUpdate(&update.Pool, update.Changes)
 		}
 	}
 }
@@ -164,6 +190,38 @@ func (h *Handler) subscribeToOpportunityAlerts(ctx context.Context) {
 	}
 }
 
+// subscribeToOpportunityRetractions listens to Redis opportunity retraction channel
+func (h *Handler) subscribeToOpportunityRetractions(ctx context.Context) {
+	pubsub := h.redisRepo.SubscribeOpportunityRetractions(ctx)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+
+	log.Info().Msg("Started Redis subscriber for opportunity retractions")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopping opportunity retractions subscriber")
+			return
+		case msg := <-ch:
+			if msg == nil {
+				continue
+			}
+
+			// Parse retraction from message
+			var retraction models.OpportunityRetraction
+			if err := json.Unmarshal([]byte(msg.Payload), &retraction); err != nil {
+				log.Debug().Err(err).Msg("Failed to unmarshal opportunity retraction")
+				continue
+			}
+
+			// Broadcast to WebSocket clients
+			h.hub.BroadcastOpportunityRetraction(&retraction)
+		}
+	}
+}
+
 // GetHubStats returns current WebSocket hub statistics
 func (h *Handler) GetHubStats() map[string]int {
 	return h.hub.GetStats()
@@ -1,10 +1,15 @@
 // Package websocket provides WebSocket handlers for real-time updates.
-// It manages client connections and broadcasts pool/opportunity updates.
+// It manages client connections and broadcasts pool/opportunity updates,
+// and feeds opportunity alerts to server-sent event streams as well.
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
@@ -18,29 +23,78 @@ import (
 type MessageType string
 
 const (
-	MessageTypePoolUpdate       MessageType = "pool_update"
-	MessageTypePoolsSnapshot    MessageType = "pools_snapshot"
-	MessageTypeOpportunityAlert MessageType = "opportunity_alert"
-	MessageTypePing             MessageType = "ping"
-	MessageTypePong             MessageType = "pong"
-	MessageTypeError            MessageType = "error"
+	MessageTypePoolUpdate           MessageType = "pool_update"
+	MessageTypePoolsSnapshot        MessageType = "pools_snapshot"
+	MessageTypeOpportunityAlert     MessageType = "opportunity_alert"
+	MessageTypeOpportunityRetracted MessageType = "opportunity_retracted"
+	MessageTypeOpportunityMerged    MessageType = "opportunity_alert_merged"
+	MessageTypePing                 MessageType = "ping"
+	MessageTypePong                 MessageType = "pong"
+	MessageTypeError                MessageType = "error"
+	MessageTypeGap                  MessageType = "gap"
 )
 
-// Message represents a WebSocket message
+// maxPollBatch caps the pool updates returned by one long poll
+const maxPollBatch = 500
+
+// Message represents a WebSocket message. Broadcasts carry the sequence
+// number of their stream; pings, pongs, gap notices and merged alerts don't.
 type Message struct {
 	Type      MessageType     `json:"type"`
+	Seq       uint64          `json:"seq,omitempty"`
 	Timestamp string          `json:"timestamp"`
 	Data      json.RawMessage `json:"data,omitempty"`
+	Changes   json.RawMessage `json:"changes,omitempty"` // Pool updates: fields changed since the previous cycle
+}
+
+// GapNotice is sent to a client that resumes with a lastSeq older than the
+// stream's latest message. When Replayed is true the missed messages follow
+// in order; otherwise they are gone and the client should refetch current
+// state over REST.
+type GapNotice struct {
+	LastSeq  uint64 `json:"lastSeq"`  // Sequence number the client resumed from
+	Seq      uint64 `json:"seq"`      // Latest sequence number on the stream
+	Missed   uint64 `json:"missed"`   // Messages broadcast after LastSeq; 0 if unknown because the server restarted
+	Replayed bool   `json:"replayed"` // The missed messages are resent after this notice
+}
+
+// conn is the part of a WebSocket connection the pumps use.
+// Implemented by *websocket.Conn.
+type conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// subscriber is a connection a channel's broadcasts are fanned out to.
+// Implemented by WebSocket clients and server-sent event streams.
+type subscriber interface {
+	// deliver queues a broadcast without blocking. It returns false when the
+	// subscriber can't take it, which drops it from the channel.
+	deliver(m streamMessage) bool
+
+	// resume catches up a subscriber resuming from an older sequence number
+	// with a gap notice and, if ok, the missed messages. Called with the
+	// stream locked, so no broadcast comes in between.
+	resume(notice GapNotice, missed []streamMessage, ok bool)
 }
 
 // Client represents a WebSocket client connection
 type Client struct {
 	ID         string
-	Conn       *websocket.Conn
+	Conn       conn
 	Send       chan []byte
 	Hub        *Hub
 	Subscribed map[string]bool // Subscribed channels
 	mu         sync.RWMutex
+
+	closed bool            // Send has been closed; guarded by mu
+	done   chan struct{}   // Closed when WritePump returns
+	alerts *alertCoalescer // Nil when alert coalescing is disabled
 }
 
 // Hub manages WebSocket client connections and message broadcasting
@@ -48,9 +102,17 @@ type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
-	// Channel-specific clients
-	poolClients        map[*Client]bool
-	opportunityClients map[*Client]bool
+	// Channel-specific subscribers: WebSocket clients, and server-sent
+	// event streams for opportunities
+	poolClients        map[subscriber]bool
+	opportunityClients map[subscriber]bool
+
+	// Server-sent event streams, closed when the hub shuts down
+	streams map[*eventStream]bool
+
+	// Sequence numbers and replay buffers per channel
+	poolStream        *stream
+	opportunityStream *stream
 
 	// Inbound messages from clients
 	broadcast chan []byte
@@ -64,6 +126,15 @@ type Hub struct {
 	// Configuration
 	config config.WebSocketConfig
 
+	// quit is closed by Shutdown; done is closed once Run has released
+	// every client
+	quit     chan struct{}
+	done     chan struct{}
+	quitOnce sync.Once
+	released []*Client // Clients connected when Run stopped
+
+	mergedAlerts atomic.Uint64 // Alerts held back and sent in merged messages
+
 	mu sync.RWMutex
 }
 
@@ -71,19 +142,44 @@ type Hub struct {
 func NewHub(cfg config.WebSocketConfig) *Hub {
 	return &Hub{
 		clients:            make(map[*Client]bool),
-		poolClients:        make(map[*Client]bool),
-		opportunityClients: make(map[*Client]bool),
+		poolClients:        make(map[subscriber]bool),
+		opportunityClients: make(map[subscriber]bool),
+		streams:            make(map[*eventStream]bool),
+		poolStream:         newStream(cfg.ReplayBuffer, cfg.PollBuffer),
+		opportunityStream:  newStream(cfg.ReplayBuffer, 0),
 		broadcast:          make(chan []byte, 256),
 		register:           make(chan *Client),
 		unregister:         make(chan *Client),
 		config:             cfg,
+		quit:               make(chan struct{}),
+		done:               make(chan struct{}),
 	}
 }
 
-// Run starts the hub's main loop
+// Run starts the hub's main loop. It returns after Shutdown, once every
+// client's Send channel has been closed.
 func (h *Hub) Run() {
+	defer close(h.done)
+
 	for {
 		select {
+		case <-h.quit:
+			h.mu.Lock()
+			for client := range h.clients {
+				client.closeSend()
+				h.released = append(h.released, client)
+			}
+			for s := range h.streams {
+				s.close()
+			}
+			h.clients = make(map[*Client]bool)
+			h.poolClients = make(map[subscriber]bool)
+			h.opportunityClients = make(map[subscriber]bool)
+			h.streams = make(map[*eventStream]bool)
+			h.mu.Unlock()
+			log.Info().Msg("WebSocket hub stopped")
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
@@ -96,7 +192,7 @@ func (h *Hub) Run() {
 				delete(h.clients, client)
 				delete(h.poolClients, client)
 				delete(h.opportunityClients, client)
-				close(client.Send)
+				client.closeSend()
 			}
 			h.mu.Unlock()
 			log.Debug().Str("client_id", client.ID).Msg("Client disconnected")
@@ -123,7 +219,7 @@ func (h *Hub) Run() {
 						delete(h.clients, client)
 						delete(h.poolClients, client)
 						delete(h.opportunityClients, client)
-						close(client.Send)
+						client.closeSend()
 					}
 				}
 				h.mu.Unlock()
@@ -132,49 +228,86 @@ func (h *Hub) Run() {
 	}
 }
 
-// BroadcastPoolUpdate sends a pool update to all pool subscribers
-func (h *Hub) BroadcastPoolUpdate(pool *models.Pool) {
-	data, err := json.Marshal(pool)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal pool for broadcast")
-		return
+// Shutdown stops Run and waits until every connected client has been sent
+// a going-away close frame, or until ctx is done. Clients connecting after
+// Shutdown are turned away.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.quitOnce.Do(func() { close(h.quit) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
-	msg := Message{
-		Type:      MessageTypePoolUpdate,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Data:      data,
+	h.mu.RLock()
+	released := h.released
+	h.mu.RUnlock()
+
+	for _, client := range released {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
-	msgBytes, err := json.Marshal(msg)
+	return nil
+}
+
+// stopping reports whether Shutdown has been called
+func (h *Hub) stopping() bool {
+	select {
+	case <-h.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Register adds a client to the hub. It returns false once the hub is
+// shutting down.
+func (h *Hub) Register(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.quit:
+		return false
+	}
+}
+
+// Unregister removes a client from the hub and closes its Send channel
+func (h *Hub) Unregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.quit:
+		// Run releases every client on its way out
+	}
+}
+
+// BroadcastPoolUpdate sends a pool update to all pool subscribers. changes
+// is passed through as computed by the worker; nil omits it.
+func (h *Hub) BroadcastPoolUpdate(pool *models.Pool, changes *models.PoolChanges) {
+	data, err := json.Marshal(pool)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal message")
+		log.Error().Err(err).Msg("Failed to marshal pool for broadcast")
 		return
 	}
 
-	h.mu.RLock()
-	var deadClients []*Client
-	for client := range h.poolClients {
-		select {
-		case client.Send <- msgBytes:
-		default:
-			// Client buffer full, mark for removal
-			deadClients = append(deadClients, client)
+	msg := Message{Type: MessageTypePoolUpdate, Data: data}
+	if changes != nil {
+		if msg.Changes, err = json.Marshal(changes); err != nil {
+			log.Error().Err(err).Msg("Failed to marshal pool changes for broadcast")
+			return
 		}
 	}
-	h.mu.RUnlock()
 
-	// Clean up dead clients
-	if len(deadClients) > 0 {
-		h.mu.Lock()
-		for _, client := range deadClients {
-			delete(h.poolClients, client)
-		}
-		h.mu.Unlock()
-	}
+	h.publish(h.poolStream, msg, streamMessage{pool: pool}, func() map[subscriber]bool { return h.poolClients })
 }
 
-// BroadcastOpportunityAlert sends an opportunity alert to subscribers
+// BroadcastOpportunityAlert sends an opportunity alert to subscribers. A
+// WebSocket client already alerted on the same pool within its coalescing
+// window gets the alert later, merged with any others for the pool.
 func (h *Hub) BroadcastOpportunityAlert(opp *models.Opportunity) {
 	data, err := json.Marshal(opp)
 	if err != nil {
@@ -182,25 +315,45 @@ func (h *Hub) BroadcastOpportunityAlert(opp *models.Opportunity) {
 		return
 	}
 
-	msg := Message{
-		Type:      MessageTypeOpportunityAlert,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Data:      data,
+	h.publish(h.opportunityStream, Message{Type: MessageTypeOpportunityAlert, Data: data}, streamMessage{opportunity: opp}, func() map[subscriber]bool { return h.opportunityClients })
+}
+
+// BroadcastOpportunityRetraction tells opportunity subscribers that an
+// opportunity was withdrawn
+func (h *Hub) BroadcastOpportunityRetraction(retraction *models.OpportunityRetraction) {
+	data, err := json.Marshal(retraction)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal retraction for broadcast")
+		return
 	}
 
+	h.publish(h.opportunityStream, Message{Type: MessageTypeOpportunityRetracted, Data: data}, streamMessage{retraction: retraction}, func() map[subscriber]bool { return h.opportunityClients })
+}
+
+// publish numbers and timestamps msg on st, keeps it for replay and long
+// polls and fans it out to the channel's subscribers. item holds the
+// broadcast pool, opportunity or retraction. subscribers is called under
+// h.mu, since Run replaces the maps on shutdown.
+func (h *Hub) publish(st *stream, msg Message, item streamMessage, subscribers func() map[subscriber]bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	msg.Seq = st.next()
+	msg.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to marshal message")
 		return
 	}
+	item.seq, item.typ, item.message, item.data = msg.Seq, msg.Type, msgBytes, msg.Data
+	st.keep(item)
 
 	h.mu.RLock()
-	var deadClients []*Client
-	for client := range h.opportunityClients {
-		select {
-		case client.Send <- msgBytes:
-		default:
-			// Client buffer full, mark for removal
+	var deadClients []subscriber
+	for client := range subscribers() {
+		if !client.deliver(item) {
+			// Subscriber buffer full, mark for removal
 			deadClients = append(deadClients, client)
 		}
 	}
@@ -210,24 +363,106 @@ func (h *Hub) BroadcastOpportunityAlert(opp *models.Opportunity) {
 	if len(deadClients) > 0 {
 		h.mu.Lock()
 		for _, client := range deadClients {
-			delete(h.opportunityClients, client)
+			delete(subscribers(), client)
 		}
 		h.mu.Unlock()
 	}
 }
 
-// SubscribeToPool adds a client to pool updates
-func (h *Hub) SubscribeToPool(client *Client) {
+// SubscribeToPool adds a client to pool updates. A client resuming after a
+// disconnect passes the last sequence number it received; 0 starts fresh.
+func (h *Hub) SubscribeToPool(client *Client, lastSeq uint64) {
+	h.subscribe(h.poolStream, client, lastSeq, func() map[subscriber]bool { return h.poolClients })
+}
+
+// SubscribeToOpportunities adds a client to opportunity alerts. lastSeq is
+// handled as for SubscribeToPool.
+func (h *Hub) SubscribeToOpportunities(client *Client, lastSeq uint64) {
+	h.subscribe(h.opportunityStream, client, lastSeq, func() map[subscriber]bool { return h.opportunityClients })
+}
+
+// StreamOpportunities subscribes a server-sent event stream to the
+// opportunity alerts and retractions matching filter. lastSeq is handled as
+// for SubscribeToOpportunities. Events arrive on the returned channel, which
+// is closed when the stream falls too far behind, the hub shuts down or stop
+// is called. It returns false once the hub is shutting down.
+func (h *Hub) StreamOpportunities(lastSeq uint64, filter models.OpportunityStreamFilter) (events <-chan models.OpportunityEvent, stop func(), ok bool) {
+	s := newEventStream(filter, eventStreamBuffer)
+
+	// Checked under h.mu so Run either closes the stream or it isn't added
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.poolClients[client] = true
+	if h.stopping() {
+		h.mu.Unlock()
+		return nil, nil, false
+	}
+	h.streams[s] = true
+	h.mu.Unlock()
+
+	h.subscribe(h.opportunityStream, s, lastSeq, func() map[subscriber]bool { return h.opportunityClients })
+
+	stop = func() {
+		h.mu.Lock()
+		delete(h.streams, s)
+		delete(h.opportunityClients, s)
+		h.mu.Unlock()
+		s.close()
+	}
+	return s.events, stop, true
 }
 
-// SubscribeToOpportunities adds a client to opportunity alerts
-func (h *Hub) SubscribeToOpportunities(client *Client) {
+// subscribe adds a subscriber to a channel and, if it resumes from an older
+// lastSeq, hands it a gap notice along with the missed messages if they are
+// all still buffered. Holding st.mu keeps broadcasts out until the replay is
+// queued, so none is missed or delivered twice.
+func (h *Hub) subscribe(st *stream, sub subscriber, lastSeq uint64, subscribers func() map[subscriber]bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.opportunityClients[client] = true
+	subscribers()[sub] = true
+	h.mu.Unlock()
+
+	if lastSeq == 0 || lastSeq == st.seq {
+		return
+	}
+
+	notice := GapNotice{LastSeq: lastSeq, Seq: st.seq}
+	missed, ok := st.since(lastSeq)
+	if lastSeq >= st.first && lastSeq < st.seq {
+		notice.Missed = st.seq - lastSeq
+	}
+	sub.resume(notice, missed, ok)
+}
+
+// PollPoolUpdates waits up to timeout for pool updates after cursor that
+// match and returns them, at most maxPollBatch at a time. Buffered updates
+// are returned straight away; a cursor that has fallen out of the buffer
+// returns a gap at once. Polls end early when ctx is done or the hub shuts
+// down.
+func (h *Hub) PollPoolUpdates(ctx context.Context, cursor uint64, timeout time.Duration, match func(*models.Pool) bool) models.PoolUpdateBatch {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		h.poolStream.mu.Lock()
+		batch, published := h.poolStream.poll(cursor, match, maxPollBatch)
+		h.poolStream.mu.Unlock()
+
+		if len(batch.Updates) > 0 || batch.Gap {
+			return batch
+		}
+		cursor = batch.Cursor
+
+		select {
+		case <-published:
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		case <-h.quit:
+			return batch
+		}
+	}
 }
 
 // UnsubscribeFromPool removes a client from pool updates
@@ -242,6 +477,10 @@ func (h *Hub) UnsubscribeFromOpportunities(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	delete(h.opportunityClients, client)
+
+	if client.alerts != nil {
+		client.alerts.reset()
+	}
 }
 
 // GetStats returns hub statistics
@@ -253,55 +492,225 @@ func (h *Hub) GetStats() map[string]int {
 		"total_clients":       len(h.clients),
 		"pool_subscribers":    len(h.poolClients),
 		"opp_subscribers":     len(h.opportunityClients),
+		"event_streams":       len(h.streams),
+		"merged_alerts":       int(h.mergedAlerts.Load()),
+	}
+}
+
+// MergedAlerts returns the number of opportunity alerts held back and sent
+// in merged messages since the hub started
+func (h *Hub) MergedAlerts() uint64 {
+	return h.mergedAlerts.Load()
+}
+
+// ClientsByChannel returns the number of subscribed clients per channel
+func (h *Hub) ClientsByChannel() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return map[string]int{
+		"pools":         len(h.poolClients),
+		"opportunities": len(h.opportunityClients),
 	}
 }
 
 // NewClient creates a new WebSocket client
 func NewClient(id string, conn *websocket.Conn, hub *Hub) *Client {
-	return &Client{
+	return newClient(id, conn, hub)
+}
+
+// newClient creates a client over any conn
+func newClient(id string, conn conn, hub *Hub) *Client {
+	c := &Client{
 		ID:         id,
 		Conn:       conn,
 		Hub:        hub,
 		Send:       make(chan []byte, 256),
 		Subscribed: make(map[string]bool),
+		done:       make(chan struct{}),
+	}
+	if window := hub.config.AlertCoalesceWindow; window > 0 {
+		c.alerts = newAlertCoalescer(window, c.sendMerged)
+	}
+	return c
+}
+
+// closeSend closes Send once. Called by the hub, which owns the channel.
+// Alerts held for the client are dropped.
+func (c *Client) closeSend() {
+	if c.alerts != nil {
+		c.alerts.stop()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// trySend queues a message without blocking. It returns false if the client
+// has been released by the hub or its buffer is full.
+func (c *Client) trySend(message []byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver queues a broadcast for the client. Opportunity alerts held back
+// by the coalescing window count as delivered.
+func (c *Client) deliver(m streamMessage) bool {
+	if m.opportunity != nil && c.alerts != nil && !c.alerts.offer(alertPoolID(m.opportunity), m.opportunity.Type, m.data) {
+		return true
+	}
+
+	select {
+	case c.Send <- m.message:
+		return true
+	default:
+		return false
 	}
 }
 
-// WritePump pumps messages from the hub to the WebSocket connection
+// resume sends the client a gap notice, followed by the missed messages
+// when they were all kept and fit in its send buffer
+func (c *Client) resume(notice GapNotice, missed []streamMessage, ok bool) {
+	// Leave room for the notice itself
+	notice.Replayed = ok && len(missed) < cap(c.Send)-len(c.Send)
+
+	data, err := json.Marshal(notice)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal gap notice")
+		return
+	}
+	msgBytes, err := json.Marshal(Message{
+		Type:      MessageTypeGap,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal message")
+		return
+	}
+
+	if !c.trySend(msgBytes) || !notice.Replayed {
+		return
+	}
+	for _, m := range missed {
+		if !c.trySend(m.message) {
+			return
+		}
+	}
+
+	log.Debug().
+		Str("client_id", c.ID).
+		Uint64("last_seq", notice.LastSeq).
+		Int("replayed", len(missed)).
+		Msg("Replayed missed messages")
+}
+
+// sendMerged queues the alerts held back in a pool's coalescing window as
+// one message
+func (c *Client) sendMerged(merged MergedAlert) {
+	data, err := json.Marshal(merged)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal merged alert")
+		return
+	}
+	msgBytes, err := json.Marshal(Message{
+		Type:      MessageTypeOpportunityMerged,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal message")
+		return
+	}
+
+	if !c.trySend(msgBytes) {
+		log.Debug().Str("client_id", c.ID).Str("pool_id", merged.PoolID).Msg("Dropped merged alert for released or slow client")
+		return
+	}
+	c.Hub.mergedAlerts.Add(uint64(len(merged.Opportunities)))
+}
+
+// WritePump pumps messages from the hub to the WebSocket connection.
+// A failed or timed-out write drops the client, so a hung connection
+// can't hold this goroutine.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(c.Hub.config.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		close(c.done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
 			if !ok {
-				// Channel closed
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// Channel closed; tell the client why if the server is stopping
+				closeMessage := []byte{}
+				if c.Hub.stopping() {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				c.write(websocket.CloseMessage, closeMessage)
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Debug().Err(err).Str("client_id", c.ID).Msg("Write error")
+			if err := c.write(websocket.TextMessage, message); err != nil {
+				c.dropAfterWriteError(err)
 				return
 			}
 
 		case <-ticker.C:
 			// Send ping
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				c.dropAfterWriteError(err)
 				return
 			}
 		}
 	}
 }
 
+// write sends one frame, bounded by the configured write timeout
+func (c *Client) write(messageType int, data []byte) error {
+	if timeout := c.Hub.config.WriteTimeout; timeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// dropAfterWriteError unregisters a client whose connection can no longer
+// be written to. ReadPump would only notice once its read deadline passes.
+func (c *Client) dropAfterWriteError(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		log.Debug().Err(err).Str("client_id", c.ID).Msg("Write timed out, dropping client")
+	} else {
+		log.Debug().Err(err).Str("client_id", c.ID).Msg("Write error")
+	}
+
+	c.Hub.Unregister(c)
+}
+
 // ReadPump pumps messages from the WebSocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.unregister <- c
+		c.Hub.Unregister(c)
 		c.Conn.Close()
 	}()
 
@@ -342,7 +751,7 @@ func (c *Client) handleMessage(message []byte) {
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
 		}
 		responseBytes, _ := json.Marshal(response)
-		c.Send <- responseBytes
+		c.trySend(responseBytes)
 
 	default:
 		log.Debug().Str("type", string(msg.Type)).Msg("Received unknown message type")
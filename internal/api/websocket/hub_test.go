@@ -0,0 +1,676 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// blockingConn is a connection whose peer never reads: writes block until
+// the write deadline passes, as they would on a full TCP send buffer
+type blockingConn struct {
+	mu            sync.Mutex
+	writeDeadline time.Time
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{closed: make(chan struct{})}
+}
+
+func (c *blockingConn) ReadMessage() (int, []byte, error) {
+	<-c.closed
+	return 0, nil, os.ErrClosed
+}
+
+func (c *blockingConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	if deadline.IsZero() {
+		// No deadline: the write hangs until the connection is torn down
+		<-c.closed
+		return os.ErrClosed
+	}
+
+	select {
+	case <-time.After(time.Until(deadline)):
+		return os.ErrDeadlineExceeded
+	case <-c.closed:
+		return os.ErrClosed
+	}
+}
+
+func (c *blockingConn) SetReadLimit(limit int64)                    {}
+func (c *blockingConn) SetReadDeadline(t time.Time) error           { return nil }
+func (c *blockingConn) SetPongHandler(h func(appData string) error) {}
+
+func (c *blockingConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *blockingConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func TestWritePump_DropsClientOnWriteTimeout(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{
+		PingInterval: time.Hour,
+		PongTimeout:  time.Hour,
+		WriteTimeout: 50 * time.Millisecond,
+	})
+	go hub.Run()
+
+	conn := newBlockingConn()
+	client := newClient("stuck", conn, hub)
+	if !hub.Register(client) {
+		t.Fatal("Expected the running hub to accept the client")
+	}
+	hub.SubscribeToPool(client, 0)
+
+	done := make(chan struct{})
+	go func() {
+		client.WritePump()
+		close(done)
+	}()
+
+	client.Send <- []byte(`{"type":"pool_update"}`)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected WritePump to return after the write deadline")
+	}
+
+	select {
+	case <-conn.closed:
+	default:
+		t.Error("Expected the connection to be closed")
+	}
+
+	// Unregistration is processed by the hub loop
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := hub.GetStats()
+		if stats["total_clients"] == 0 && stats["pool_subscribers"] == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the client to be unregistered, got %v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// recordingConn accepts every write and records close frames
+type recordingConn struct {
+	mu     sync.Mutex
+	frames [][]byte // payloads of close frames written
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) {
+	<-c.closed
+	return 0, nil, os.ErrClosed
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		c.mu.Lock()
+		c.frames = append(c.frames, data)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *recordingConn) SetReadLimit(limit int64)                    {}
+func (c *recordingConn) SetReadDeadline(t time.Time) error           { return nil }
+func (c *recordingConn) SetWriteDeadline(t time.Time) error          { return nil }
+func (c *recordingConn) SetPongHandler(h func(appData string) error) {}
+
+func (c *recordingConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func TestShutdown_SendsGoingAway(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{
+		PingInterval: time.Hour,
+		PongTimeout:  time.Hour,
+		WriteTimeout: time.Second,
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run()
+		close(stopped)
+	}()
+
+	conns := []*recordingConn{{closed: make(chan struct{})}, {closed: make(chan struct{})}}
+	for i, conn := range conns {
+		client := newClient(fmt.Sprintf("client-%d", i), conn, hub)
+		if !hub.Register(client) {
+			t.Fatal("Expected the running hub to accept the client")
+		}
+		go client.WritePump()
+		go client.ReadPump()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected Run to return")
+	}
+
+	want := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for i, conn := range conns {
+		conn.mu.Lock()
+		frames := conn.frames
+		conn.mu.Unlock()
+
+		if len(frames) != 1 || string(frames[0]) != string(want) {
+			t.Errorf("Client %d: expected one going-away close frame, got %q", i, frames)
+		}
+	}
+
+	if hub.Register(newClient("late", &recordingConn{closed: make(chan struct{})}, hub)) {
+		t.Error("Expected clients to be turned away after Shutdown")
+	}
+	if stats := hub.GetStats(); stats["total_clients"] != 0 {
+		t.Errorf("Expected no clients after Shutdown, got %v", stats)
+	}
+}
+
+// drain decodes every message queued for a client
+func drain(t *testing.T, client *Client) []Message {
+	t.Helper()
+
+	var messages []Message
+	for {
+		select {
+		case raw := <-client.Send:
+			var msg Message
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				t.Fatalf("Invalid message %s: %v", raw, err)
+			}
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestSubscribe_ResumesFromLastSeq(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{ReplayBuffer: 3})
+	newTestClient := func(id string) *Client {
+		return newClient(id, &recordingConn{closed: make(chan struct{})}, hub)
+	}
+
+	live := newTestClient("live")
+	hub.SubscribeToPool(live, 0)
+	for i := 0; i < 5; i++ {
+		hub.BroadcastPoolUpdate(&models.Pool{ID: fmt.Sprintf("pool-%d", i)}, nil)
+	}
+
+	sent := drain(t, live)
+	if len(sent) != 5 {
+		t.Fatalf("Expected 5 updates, got %d", len(sent))
+	}
+	for i := 1; i < len(sent); i++ {
+		if sent[i].Seq != sent[i-1].Seq+1 {
+			t.Fatalf("Expected consecutive sequence numbers, got %d after %d", sent[i].Seq, sent[i-1].Seq)
+		}
+	}
+
+	gapNotice := func(msg Message) GapNotice {
+		t.Helper()
+		if msg.Type != MessageTypeGap || msg.Seq != 0 {
+			t.Fatalf("Expected an unsequenced gap notice, got %+v", msg)
+		}
+		var notice GapNotice
+		if err := json.Unmarshal(msg.Data, &notice); err != nil {
+			t.Fatalf("Invalid gap notice: %v", err)
+		}
+		return notice
+	}
+
+	// Two missed updates are still buffered and are replayed after the notice
+	resumed := newTestClient("resumed")
+	hub.SubscribeToPool(resumed, sent[2].Seq)
+	got := drain(t, resumed)
+	if len(got) != 3 {
+		t.Fatalf("Expected a gap notice and 2 replayed updates, got %d messages", len(got))
+	}
+	notice := gapNotice(got[0])
+	if notice.Missed != 2 || !notice.Replayed || notice.Seq != sent[4].Seq {
+		t.Errorf("Unexpected gap notice %+v", notice)
+	}
+	if got[1].Seq != sent[3].Seq || got[2].Seq != sent[4].Seq {
+		t.Errorf("Expected updates %d and %d replayed, got %d and %d", sent[3].Seq, sent[4].Seq, got[1].Seq, got[2].Seq)
+	}
+
+	// Four missed updates exceed the buffer, so the client is told to resync
+	behind := newTestClient("behind")
+	hub.SubscribeToPool(behind, sent[0].Seq)
+	got = drain(t, behind)
+	if len(got) != 1 {
+		t.Fatalf("Expected only a gap notice, got %d messages", len(got))
+	}
+	if notice := gapNotice(got[0]); notice.Missed != 4 || notice.Replayed {
+		t.Errorf("Unexpected gap notice %+v", notice)
+	}
+
+	// An up-to-date client gets nothing until the next update
+	current := newTestClient("current")
+	hub.SubscribeToPool(current, sent[4].Seq)
+	if got := drain(t, current); len(got) != 0 {
+		t.Errorf("Expected no messages for an up-to-date client, got %+v", got)
+	}
+
+	// Opportunities are numbered on their own stream
+	hub.BroadcastOpportunityAlert(&models.Opportunity{ID: "opp"})
+	hub.BroadcastPoolUpdate(&models.Pool{ID: "pool-5"}, nil)
+	if got := drain(t, live); len(got) != 1 || got[0].Seq != sent[4].Seq+1 {
+		t.Errorf("Expected the next pool update numbered %d, got %+v", sent[4].Seq+1, got)
+	}
+}
+
+func TestBroadcastPoolUpdate_PassesChangesThrough(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{})
+	client := newClient("client", &recordingConn{closed: make(chan struct{})}, hub)
+	hub.SubscribeToPool(client, 0)
+
+	changes := &models.PoolChanges{APY: &models.FieldChange{Delta: decimal.RequireFromString("0.25")}}
+	hub.BroadcastPoolUpdate(&models.Pool{ID: "pool"}, changes)
+	hub.BroadcastPoolUpdate(&models.Pool{ID: "pool"}, nil)
+
+	got := drain(t, client)
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(got))
+	}
+
+	var decoded models.PoolChanges
+	if err := json.Unmarshal(got[0].Changes, &decoded); err != nil || decoded.APY == nil || decoded.APY.Delta.String() != "0.25" {
+		t.Errorf("Expected the APY delta in changes, got %s (%v)", got[0].Changes, err)
+	}
+	if got[1].Changes != nil {
+		t.Errorf("Expected changes omitted without a summary, got %s", got[1].Changes)
+	}
+}
+
+// publishPools broadcasts an update for each chain and returns their
+// sequence numbers
+func publishPools(hub *Hub, chains ...string) []uint64 {
+	seqs := make([]uint64, len(chains))
+	for i, chain := range chains {
+		hub.BroadcastPoolUpdate(&models.Pool{ID: fmt.Sprintf("pool-%d", i), Chain: chain, TVL: decimal.NewFromInt(int64(1000 * (i + 1)))}, nil)
+		hub.poolStream.mu.Lock()
+		seqs[i] = hub.poolStream.seq
+		hub.poolStream.mu.Unlock()
+	}
+	return seqs
+}
+
+// updateIDs decodes the pool IDs of a long-poll batch
+func updateIDs(t *testing.T, batch models.PoolUpdateBatch) []string {
+	t.Helper()
+
+	ids := make([]string, len(batch.Updates))
+	for i, raw := range batch.Updates {
+		var msg Message
+		var pool models.Pool
+		if err := json.Unmarshal(raw, &msg); err != nil || msg.Type != MessageTypePoolUpdate {
+			t.Fatalf("Expected a pool_update message, got %s", raw)
+		}
+		if err := json.Unmarshal(msg.Data, &pool); err != nil {
+			t.Fatalf("Invalid pool in %s: %v", raw, err)
+		}
+		ids[i] = pool.ID
+	}
+	return ids
+}
+
+func matchAll(*models.Pool) bool { return true }
+
+func TestPollPoolUpdates_Buffered(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{PollBuffer: 10})
+	seqs := publishPools(hub, "ethereum", "arbitrum", "ethereum")
+
+	// Buffered updates come back without waiting
+	start := time.Now()
+	batch := hub.PollPoolUpdates(context.Background(), seqs[0], time.Minute, matchAll)
+	if time.Since(start) > time.Second {
+		t.Error("Expected buffered updates to return immediately")
+	}
+	if ids := updateIDs(t, batch); len(ids) != 2 || ids[0] != "pool-1" || ids[1] != "pool-2" || batch.Cursor != seqs[2] || batch.Gap {
+		t.Errorf("Expected pool-1 and pool-2 up to seq %d, got %v up to %d (gap %v)", seqs[2], ids, batch.Cursor, batch.Gap)
+	}
+
+	// Filters apply server-side; filtered-out updates still move the cursor
+	arbitrum := func(pool *models.Pool) bool { return pool.Chain == "arbitrum" }
+	batch = hub.PollPoolUpdates(context.Background(), seqs[0], time.Minute, arbitrum)
+	if ids := updateIDs(t, batch); len(ids) != 1 || ids[0] != "pool-1" || batch.Cursor != seqs[2] {
+		t.Errorf("Expected only pool-1 with the cursor at seq %d, got %v up to %d", seqs[2], ids, batch.Cursor)
+	}
+	batch = hub.PollPoolUpdates(context.Background(), batch.Cursor, 20*time.Millisecond, arbitrum)
+	if len(batch.Updates) != 0 || batch.Cursor != seqs[2] || batch.Gap {
+		t.Errorf("Expected nothing new after the cursor, got %d up to %d", len(batch.Updates), batch.Cursor)
+	}
+}
+
+func TestPollPoolUpdates_Waits(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{PollBuffer: 10})
+	seqs := publishPools(hub, "ethereum")
+
+	// Nothing new: the poll times out with the cursor unchanged
+	batch := hub.PollPoolUpdates(context.Background(), seqs[0], 20*time.Millisecond, matchAll)
+	if len(batch.Updates) != 0 || batch.Cursor != seqs[0] || batch.Gap {
+		t.Errorf("Expected an empty batch at seq %d, got %+v", seqs[0], batch)
+	}
+
+	// A waiting poll returns as soon as a matching update is published,
+	// skipping the ones it filters out
+	done := make(chan models.PoolUpdateBatch)
+	go func() {
+		done <- hub.PollPoolUpdates(context.Background(), 0, 5*time.Second, func(pool *models.Pool) bool {
+			return pool.TVL.GreaterThanOrEqual(decimal.NewFromInt(2000))
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	publishPools(hub, "arbitrum", "optimism")
+
+	select {
+	case batch := <-done:
+		if ids := updateIDs(t, batch); len(ids) != 1 || ids[0] != "pool-1" {
+			t.Errorf("Expected the second update only, got %v", ids)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the poll to return when an update was published")
+	}
+
+	// Shutdown ends waiting polls
+	go func() {
+		done <- hub.PollPoolUpdates(context.Background(), 0, time.Minute, matchAll)
+	}()
+	go hub.Run()
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the poll to return on shutdown")
+	}
+}
+
+func TestPollPoolUpdates_Gap(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{ReplayBuffer: 1, PollBuffer: 3})
+	seqs := publishPools(hub, "a", "b", "c", "d", "e")
+
+	// A slow consumer whose cursor was overwritten by wraparound gets a gap
+	batch := hub.PollPoolUpdates(context.Background(), seqs[0], time.Minute, matchAll)
+	if !batch.Gap || len(batch.Updates) != 0 || batch.Cursor != seqs[4] {
+		t.Errorf("Expected a gap with the cursor at seq %d, got %+v", seqs[4], batch)
+	}
+
+	// The oldest update still buffered is readable
+	if ids := updateIDs(t, hub.PollPoolUpdates(context.Background(), seqs[1], time.Minute, matchAll)); len(ids) != 3 || ids[0] != "pool-2" {
+		t.Errorf("Expected the last 3 updates after wraparound, got %v", ids)
+	}
+
+	// Cursors from a previous process, or ahead of the stream, are gaps too
+	for _, cursor := range []uint64{1, seqs[4] + 1} {
+		if batch := hub.PollPoolUpdates(context.Background(), cursor, time.Minute, matchAll); !batch.Gap {
+			t.Errorf("Expected a gap for cursor %d, got %+v", cursor, batch)
+		}
+	}
+
+	// The larger poll buffer doesn't extend WebSocket replay
+	client := newClient("ws", &recordingConn{closed: make(chan struct{})}, hub)
+	hub.SubscribeToPool(client, seqs[2])
+	if got := drain(t, client); len(got) != 1 || got[0].Type != MessageTypeGap {
+		t.Errorf("Expected only a gap notice beyond WS_REPLAY_BUFFER, got %+v", got)
+	}
+}
+
+func TestPollPoolUpdates_BatchLimit(t *testing.T) {
+	hub := NewHub(config.WebSocketConfig{PollBuffer: maxPollBatch + 10})
+	chains := make([]string, maxPollBatch+10)
+	for i := range chains {
+		chains[i] = "ethereum"
+	}
+	publishPools(hub, chains...)
+
+	hub.poolStream.mu.Lock()
+	first := hub.poolStream.first
+	hub.poolStream.mu.Unlock()
+
+	batch := hub.PollPoolUpdates(context.Background(), first, time.Minute, matchAll)
+	if len(batch.Updates) != maxPollBatch || batch.Cursor != first+maxPollBatch {
+		t.Fatalf("Expected %d updates up to seq %d, got %d up to %d", maxPollBatch, first+maxPollBatch, len(batch.Updates), batch.Cursor)
+	}
+	if batch = hub.PollPoolUpdates(context.Background(), batch.Cursor, time.Minute, matchAll); len(batch.Updates) != 10 {
+		t.Errorf("Expected the remaining 10 updates, got %d", len(batch.Updates))
+	}
+}
+
+// receive waits up to timeout for the next message queued for a client
+func receive(t *testing.T, client *Client, timeout time.Duration) (Message, bool) {
+	t.Helper()
+
+	select {
+	case raw := <-client.Send:
+		var msg Message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatalf("Invalid message %s: %v", raw, err)
+		}
+		return msg, true
+	case <-time.After(timeout):
+		return Message{}, false
+	}
+}
+
+func TestBroadcastOpportunityAlert_Coalesces(t *testing.T) {
+	const window = 50 * time.Millisecond
+
+	trending := func(poolID string) *models.Opportunity {
+		return &models.Opportunity{ID: "trending-" + poolID, Type: models.OpportunityTypeTrending, PoolID: poolID}
+	}
+	highScore := func(poolID string) *models.Opportunity {
+		return &models.Opportunity{ID: "high-score-" + poolID, Type: models.OpportunityTypeHighScore, PoolID: poolID}
+	}
+
+	setup := func(t *testing.T) (*Hub, *Client) {
+		hub := NewHub(config.WebSocketConfig{AlertCoalesceWindow: window})
+		client := newClient("client", &recordingConn{closed: make(chan struct{})}, hub)
+		hub.SubscribeToOpportunities(client, 0)
+		return hub, client
+	}
+
+	t.Run("single type", func(t *testing.T) {
+		hub, client := setup(t)
+		hub.BroadcastOpportunityAlert(trending("pool-a"))
+
+		if got := drain(t, client); len(got) != 1 || got[0].Type != MessageTypeOpportunityAlert {
+			t.Fatalf("Expected the alert sent at once, got %+v", got)
+		}
+		if msg, ok := receive(t, client, 3*window); ok {
+			t.Errorf("Expected nothing after the window, got %+v", msg)
+		}
+		if hub.MergedAlerts() != 0 {
+			t.Errorf("Expected no merged alerts, got %d", hub.MergedAlerts())
+		}
+	})
+
+	t.Run("multiple types within the window", func(t *testing.T) {
+		hub, client := setup(t)
+		hub.BroadcastOpportunityAlert(trending("pool-a"))
+		hub.BroadcastOpportunityAlert(highScore("pool-a"))
+		hub.BroadcastOpportunityAlert(trending("pool-b"))
+		hub.BroadcastOpportunityAlert(highScore("pool-a"))
+
+		got := drain(t, client)
+		if len(got) != 2 || got[0].Type != MessageTypeOpportunityAlert || got[1].Type != MessageTypeOpportunityAlert {
+			t.Fatalf("Expected the first alert of each pool at once, got %+v", got)
+		}
+
+		msg, ok := receive(t, client, 5*window)
+		if !ok || msg.Type != MessageTypeOpportunityMerged || msg.Seq != 0 {
+			t.Fatalf("Expected an unsequenced merged alert, got %+v", msg)
+		}
+		var merged MergedAlert
+		if err := json.Unmarshal(msg.Data, &merged); err != nil {
+			t.Fatalf("Invalid merged alert: %v", err)
+		}
+		wantTypes := []models.OpportunityType{models.OpportunityTypeTrending, models.OpportunityTypeHighScore}
+		if merged.PoolID != "pool-a" || fmt.Sprint(merged.Types) != fmt.Sprint(wantTypes) || len(merged.Opportunities) != 2 {
+			t.Errorf("Expected both high-score alerts merged under both types, got %+v", merged)
+		}
+
+		if msg, ok := receive(t, client, 3*window); ok {
+			t.Errorf("Expected nothing for a pool alerted once, got %+v", msg)
+		}
+		if hub.MergedAlerts() != 2 {
+			t.Errorf("Expected 2 merged alerts, got %d", hub.MergedAlerts())
+		}
+	})
+
+	t.Run("multiple types across windows", func(t *testing.T) {
+		hub, client := setup(t)
+		hub.BroadcastOpportunityAlert(trending("pool-a"))
+		if got := drain(t, client); len(got) != 1 {
+			t.Fatalf("Expected the first alert at once, got %+v", got)
+		}
+
+		time.Sleep(3 * window)
+		hub.BroadcastOpportunityAlert(highScore("pool-a"))
+		got := drain(t, client)
+		if len(got) != 1 || got[0].Type != MessageTypeOpportunityAlert {
+			t.Fatalf("Expected an alert after the window sent at once, got %+v", got)
+		}
+		if msg, ok := receive(t, client, 3*window); ok {
+			t.Errorf("Expected nothing merged, got %+v", msg)
+		}
+	})
+
+	t.Run("disconnect drops held alerts", func(t *testing.T) {
+		hub, client := setup(t)
+		hub.BroadcastOpportunityAlert(trending("pool-a"))
+		hub.BroadcastOpportunityAlert(highScore("pool-a"))
+		drain(t, client)
+
+		hub.UnsubscribeFromOpportunities(client)
+		client.closeSend()
+		if n := client.alerts.open(); n != 0 {
+			t.Errorf("Expected no open windows after disconnect, got %d", n)
+		}
+
+		time.Sleep(3 * window)
+		if msg, ok := <-client.Send; ok {
+			t.Errorf("Expected nothing sent after disconnect, got %s", msg)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		hub := NewHub(config.WebSocketConfig{})
+		client := newClient("client", &recordingConn{closed: make(chan struct{})}, hub)
+		hub.SubscribeToOpportunities(client, 0)
+
+		hub.BroadcastOpportunityAlert(trending("pool-a"))
+		hub.BroadcastOpportunityAlert(highScore("pool-a"))
+		if got := drain(t, client); len(got) != 2 {
+			t.Errorf("Expected every alert sent at once, got %d", len(got))
+		}
+	})
+}
+
+func TestStreamOpportunities(t *testing.T) {
+	alert := func(id string, typ models.OpportunityType) *models.Opportunity {
+		return &models.Opportunity{ID: id, Type: typ, PoolID: id, Chain: "ethereum", Score: decimal.NewFromInt(80)}
+	}
+
+	t.Run("filters by type", func(t *testing.T) {
+		hub := NewHub(config.WebSocketConfig{ReplayBuffer: 10})
+		events, stop, ok := hub.StreamOpportunities(0, models.OpportunityStreamFilter{Type: models.OpportunityTypeTrending})
+		if !ok {
+			t.Fatal("Expected the stream subscribed")
+		}
+		defer stop()
+
+		hub.BroadcastOpportunityAlert(alert("a", models.OpportunityTypeHighScore))
+		hub.BroadcastOpportunityAlert(alert("b", models.OpportunityTypeTrending))
+		hub.BroadcastOpportunityRetraction(&models.OpportunityRetraction{OpportunityID: "a", Type: models.OpportunityTypeHighScore})
+
+		if len(events) != 1 {
+			t.Fatalf("Expected only the trending alert, got %d events", len(events))
+		}
+		if event := <-events; event.Type != models.OpportunityEventAlert || event.ID == 0 {
+			t.Errorf("Expected a numbered alert event, got %+v", event)
+		}
+	})
+
+	t.Run("dropped when behind", func(t *testing.T) {
+		hub := NewHub(config.WebSocketConfig{})
+		events, stop, _ := hub.StreamOpportunities(0, models.OpportunityStreamFilter{})
+		defer stop()
+
+		for i := 0; i <= eventStreamBuffer; i++ {
+			hub.BroadcastOpportunityAlert(alert(fmt.Sprint(i), models.OpportunityTypeHighScore))
+		}
+
+		received := 0
+		for range events {
+			received++
+		}
+		if received != eventStreamBuffer {
+			t.Errorf("Expected the buffered events, then the stream closed; got %d", received)
+		}
+		if stats := hub.GetStats(); stats["opp_subscribers"] != 0 {
+			t.Errorf("Expected the stream unsubscribed, got %v", stats)
+		}
+	})
+
+	t.Run("closed on shutdown", func(t *testing.T) {
+		hub := NewHub(config.WebSocketConfig{})
+		go hub.Run()
+
+		events, _, _ := hub.StreamOpportunities(0, models.OpportunityStreamFilter{})
+		if err := hub.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		if _, open := <-events; open {
+			t.Error("Expected the stream closed on shutdown")
+		}
+		if _, _, ok := hub.StreamOpportunities(0, models.OpportunityStreamFilter{}); ok {
+			t.Error("Expected streams turned away after shutdown")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// stream numbers the messages broadcast on one channel and keeps the most
+// recent ones so a reconnecting client can catch up and long-poll clients
+// can read them.
+//
+// Sequence numbers increase by one per message. They start from the hub's
+// start time in microseconds, so they keep increasing across server restarts
+// and a lastSeq from a previous process is always older than anything still
+// buffered.
+type stream struct {
+	// mu is held while a message is numbered and handed to subscribers, so
+	// clients receive messages in sequence order and a resuming client can't
+	// miss or repeat one
+	mu sync.Mutex
+
+	first  uint64          // Sequence number before this process's first message
+	seq    uint64          // Sequence number of the last message
+	buffer []streamMessage // Ring of the most recent messages, oldest at start
+	start  int
+	count  int
+
+	replaySize int           // Messages a resuming WebSocket client may be replayed
+	published  chan struct{} // Closed and replaced when a message is kept
+}
+
+// streamMessage is a broadcast as fanned out and buffered. The broadcast
+// item is kept decoded so subscriber and long-poll filters don't have to
+// decode the message.
+type streamMessage struct {
+	seq     uint64
+	typ     MessageType
+	message []byte          // The encoded Message, as sent over WebSocket
+	data    json.RawMessage // The Message's data
+
+	pool        *models.Pool                  // Pool updates
+	opportunity *models.Opportunity           // Opportunity alerts
+	retraction  *models.OpportunityRetraction // Opportunity retractions
+}
+
+// newStream creates a stream that replays up to replaySize messages to
+// resuming WebSocket clients and buffers up to pollSize for long polling
+func newStream(replaySize, pollSize int) *stream {
+	replaySize = max(replaySize, 0)
+	seq := uint64(time.Now().UnixMicro())
+	return &stream{
+		first:      seq,
+		seq:        seq,
+		buffer:     make([]streamMessage, max(replaySize, pollSize)),
+		replaySize: replaySize,
+		published:  make(chan struct{}),
+	}
+}
+
+// next returns the sequence number for the next message. Callers hold mu.
+func (s *stream) next() uint64 {
+	s.seq++
+	return s.seq
+}
+
+// keep buffers a numbered message, evicting the oldest if the buffer is
+// full, and wakes up waiting long polls. Callers hold mu.
+func (s *stream) keep(entry streamMessage) {
+	close(s.published)
+	s.published = make(chan struct{})
+
+	if len(s.buffer) == 0 {
+		return
+	}
+
+	if s.count < len(s.buffer) {
+		s.buffer[(s.start+s.count)%len(s.buffer)] = entry
+		s.count++
+		return
+	}
+	s.buffer[s.start] = entry
+	s.start = (s.start + 1) % len(s.buffer)
+}
+
+// buffered returns the buffered messages after lastSeq, or false if some of
+// them are no longer buffered or lastSeq is ahead of the stream. Callers
+// hold mu.
+func (s *stream) buffered(lastSeq uint64) ([]streamMessage, bool) {
+	if lastSeq > s.seq {
+		return nil, false
+	}
+
+	missed := s.seq - lastSeq
+	if missed > uint64(s.count) {
+		return nil, false
+	}
+
+	messages := make([]streamMessage, 0, missed)
+	for i := s.count - int(missed); i < s.count; i++ {
+		messages = append(messages, s.buffer[(s.start+i)%len(s.buffer)])
+	}
+	return messages, true
+}
+
+// since returns the messages after lastSeq for a resuming subscriber, or
+// false if some of them are no longer buffered, there are more than the
+// replay size, or lastSeq is ahead of the stream. Callers hold mu.
+func (s *stream) since(lastSeq uint64) ([]streamMessage, bool) {
+	missed, ok := s.buffered(lastSeq)
+	if !ok || len(missed) > s.replaySize {
+		return nil, false
+	}
+	return missed, true
+}
+
+// poll returns up to limit pool updates after cursor that match, and a
+// channel closed when the next message is kept. A zero cursor starts from
+// the latest message. The batch's cursor is the last message looked at,
+// matching or not, so filtered-out updates aren't read again. Callers hold
+// mu.
+func (s *stream) poll(cursor uint64, match func(*models.Pool) bool, limit int) (models.PoolUpdateBatch, <-chan struct{}) {
+	if cursor == 0 {
+		cursor = s.seq
+	}
+
+	missed, ok := s.buffered(cursor)
+	if !ok {
+		return models.PoolUpdateBatch{Updates: []json.RawMessage{}, Cursor: s.seq, Gap: true}, s.published
+	}
+
+	batch := models.PoolUpdateBatch{Updates: []json.RawMessage{}, Cursor: cursor}
+	for _, m := range missed {
+		if len(batch.Updates) == limit {
+			break
+		}
+		batch.Cursor = m.seq
+		if m.pool != nil && match(m.pool) {
+			batch.Updates = append(batch.Updates, m.message)
+		}
+	}
+	return batch, s.published
+}
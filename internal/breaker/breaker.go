@@ -0,0 +1,115 @@
+// Package breaker provides a circuit breaker for calls to a backing
+// service. After repeated failures the breaker opens and calls fail fast
+// for a cooldown, so callers fall back immediately instead of waiting on a
+// service that is down.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker
+type State string
+
+// Breaker states
+const (
+	StateClosed   State = "closed"    // Calls go through
+	StateOpen     State = "open"      // Calls fail fast until the cooldown ends
+	StateHalfOpen State = "half-open" // One probe call decides whether to close
+)
+
+// ErrOpen is returned by Allow while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Breaker opens after threshold consecutive failures and stays open for
+// cooldown. The first call after the cooldown is let through as a probe: a
+// success closes the breaker, a failure opens it again. A breaker with a
+// threshold of 0 never opens. Safe for concurrent use.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New creates a closed breaker
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     StateClosed,
+	}
+}
+
+// Allow reports whether a call may go ahead. It returns ErrOpen while the
+// breaker is open, or half-open with a probe already in flight. Every
+// allowed call must be followed by Success or Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Success records a successful call and closes the breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a failed call. It opens the breaker once the threshold is
+// reached, or straight away when the call was the half-open probe.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// State returns the current state. An open breaker whose cooldown has ended
+// reports half-open, since the next call will probe.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,101 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the breaker
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *clock) {
+	c := &clock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	b := New(threshold, cooldown)
+	b.now = c.now
+	return b, c
+}
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Expected call %d allowed, got %v", i+1, err)
+		}
+		b.Failure()
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed below the threshold, got %s", b.State())
+	}
+
+	b.Allow()
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("Expected open at the threshold, got %s", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Expected ErrOpen while open, got %v", err)
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+
+	b.Allow()
+	b.Failure()
+	b.Allow()
+	b.Success()
+	b.Allow()
+	b.Failure()
+
+	if b.State() != StateClosed {
+		t.Errorf("Expected failures counted only while consecutive, got %s", b.State())
+	}
+}
+
+func TestBreaker_HalfOpenProbe(t *testing.T) {
+	b, c := newTestBreaker(1, time.Minute)
+	b.Allow()
+	b.Failure()
+
+	c.t = c.t.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open after the cooldown, got %s", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Expected the probe allowed, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Expected a single probe at a time, got %v", err)
+	}
+
+	// A failed probe opens the breaker for another cooldown
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Expected open after a failed probe, got %v", err)
+	}
+
+	c.t = c.t.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed after a successful probe, got %s", b.State())
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b, _ := newTestBreaker(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Expected a disabled breaker to allow every call, got %v", err)
+		}
+		b.Failure()
+	}
+	if b.State() != StateClosed {
+		t.Errorf("Expected a disabled breaker to stay closed, got %s", b.State())
+	}
+}
@@ -0,0 +1,71 @@
+// Package cache defines the cache the HTTP handlers serve responses from and
+// the backends it can be kept in: Redis, shared by every server process, an
+// in-process LRU for single-node deployments and tests, or none at all.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Cache holds the responses and pools the handlers cache. A miss returns a
+// nil value and no error. TTLs are in seconds; 0 keeps an entry until it is
+// invalidated. Implemented by the Redis repository, Memory and Noop.
+type Cache interface {
+	GetPool(ctx context.Context, id string) (*models.Pool, error)
+	SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error
+	HasPoolTombstone(ctx context.Context, id string) (bool, error)
+	SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error
+	InvalidatePoolCache(ctx context.Context, id string) error
+
+	GetPoolsCache(ctx context.Context, cacheKey string) (*models.PoolListResponse, error)
+	SetPoolsCache(ctx context.Context, cacheKey string, response *models.PoolListResponse, ttlSeconds int) error
+	GetPoolSearchCache(ctx context.Context, cacheKey string) (*models.PoolSearchResponse, error)
+	SetPoolSearchCache(ctx context.Context, cacheKey string, response *models.PoolSearchResponse, ttlSeconds int) error
+	InvalidateAllPoolsCache(ctx context.Context) error
+
+	GetOpportunitiesCache(ctx context.Context, cacheKey string) (*models.OpportunityListResponse, error)
+	SetOpportunitiesCache(ctx context.Context, cacheKey string, response *models.OpportunityListResponse, ttlSeconds int) error
+	GetPoolOpportunitiesCache(ctx context.Context, poolID string) (*models.PoolOpportunitiesResponse, error)
+	SetPoolOpportunitiesCache(ctx context.Context, response *models.PoolOpportunitiesResponse, ttlSeconds int) error
+	GetTrendingCache(ctx context.Context, cacheKey string) ([]models.TrendingPool, error)
+	SetTrendingCache(ctx context.Context, cacheKey string, trending []models.TrendingPool, ttlSeconds int) error
+
+	GetChainsCache(ctx context.Context, cacheKey string) (*models.ChainListResponse, error)
+	SetChainsCache(ctx context.Context, cacheKey string, response *models.ChainListResponse, ttlSeconds int) error
+	GetProtocolsCache(ctx context.Context, cacheKey string) (*models.ProtocolListResponse, error)
+	SetProtocolsCache(ctx context.Context, cacheKey string, response *models.ProtocolListResponse, ttlSeconds int) error
+	GetProtocolHistoryCache(ctx context.Context, cacheKey string) (*models.ProtocolHistoryResponse, error)
+	SetProtocolHistoryCache(ctx context.Context, cacheKey string, response *models.ProtocolHistoryResponse, ttlSeconds int) error
+	GetChainHistoryCache(ctx context.Context, cacheKey string) (*models.ChainHistoryResponse, error)
+	SetChainHistoryCache(ctx context.Context, cacheKey string, response *models.ChainHistoryResponse, ttlSeconds int) error
+	GetStatsCache(ctx context.Context, source string) (*models.PlatformStats, error)
+	SetStatsCache(ctx context.Context, source string, stats *models.PlatformStats, ttlSeconds int) error
+	GetDistributionCache(ctx context.Context, includeEmpty bool) (*models.PoolDistribution, error)
+	SetDistributionCache(ctx context.Context, includeEmpty bool, dist *models.PoolDistribution, ttlSeconds int) error
+	GetTagsCache(ctx context.Context) (*models.TagListResponse, error)
+	SetTagsCache(ctx context.Context, response *models.TagListResponse, ttlSeconds int) error
+}
+
+// New returns the cache selected by cfg. The Redis backend is redis, the
+// repository the rest of the server already uses, with a local tier in front
+// unless cfg disables it.
+func New(cfg config.CacheConfig, redis Cache) (Cache, error) {
+	switch cfg.Backend {
+	case config.CacheBackendRedis:
+		if cfg.LocalEntries > 0 {
+			return NewTiered(redis, cfg.LocalEntries, int(cfg.LocalTTL/time.Second)), nil
+		}
+		return redis, nil
+	case config.CacheBackendMemory:
+		return NewMemory(cfg.MemoryEntries), nil
+	case config.CacheBackendNone:
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", cfg.Backend)
+	}
+}
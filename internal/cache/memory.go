@@ -0,0 +1,341 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Key prefixes of the memory cache
+const (
+	memPool              = "pool:"
+	memPoolTombstone     = "pool-missing:"
+	memPoolLists         = "pools:" // Pool lists and search pages, retired together
+	memOpportunities     = "opportunities:"
+	memPoolOpportunities = "pool-opportunities:"
+	memTrending          = "trending:"
+	memChains            = "chains:"
+	memProtocols         = "protocols:"
+	memProtocolHistory   = "protocol-history:"
+	memChainHistory      = "chain-history:"
+	memStats             = "stats:"
+	memDistribution      = "distribution"
+	memTags              = "tags"
+)
+
+// Memory is an in-process cache holding up to a fixed number of entries,
+// evicting the least recently used one to make room. Entries are stored
+// encoded, as in Redis, so callers never share a cached value.
+//
+// Each process has its own entries, and invalidations by other processes,
+// such as the worker's after ingestion, don't reach them; they are served
+// until they expire.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recency    *list.List // Of *memoryEntry, most recently used first
+	now        func() time.Time
+}
+
+// memoryEntry is an encoded value and when it expires (zero = never)
+type memoryEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// NewMemory creates a memory cache holding up to maxEntries entries
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recency:    list.New(),
+		now:        time.Now,
+	}
+}
+
+// Len returns the number of entries held, including expired ones not yet
+// dropped
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recency.Len()
+}
+
+// get returns the value stored under key, if it hasn't expired
+func (m *Memory) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !m.now().Before(entry.expires) {
+		m.remove(el)
+		return nil, false
+	}
+	m.recency.MoveToFront(el)
+	return entry.data, true
+}
+
+// lookup returns the value stored under key and whether it is still fresh.
+// Unlike get it keeps expired entries, which are only evicted to make room.
+func (m *Memory) lookup(key string) (data []byte, fresh, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+	entry := el.Value.(*memoryEntry)
+	m.recency.MoveToFront(el)
+	return entry.data, entry.expires.IsZero() || m.now().Before(entry.expires), true
+}
+
+// set stores data under key for ttlSeconds, evicting the least recently
+// used entries beyond the limit
+func (m *Memory) set(key string, data []byte, ttlSeconds int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &memoryEntry{key: key, data: data}
+	if ttlSeconds > 0 {
+		entry.expires = m.now().Add(time.Duration(ttlSeconds) * time.Second)
+	}
+	if el, ok := m.entries[key]; ok {
+		el.Value = entry
+		m.recency.MoveToFront(el)
+		return
+	}
+
+	m.entries[key] = m.recency.PushFront(entry)
+	for m.recency.Len() > m.maxEntries {
+		m.remove(m.recency.Back())
+	}
+}
+
+// delete removes the entry under key
+func (m *Memory) delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+}
+
+// deletePrefix removes every entry whose key starts with prefix
+func (m *Memory) deletePrefix(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, el := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(el)
+		}
+	}
+}
+
+// remove drops an entry; the lock must be held
+func (m *Memory) remove(el *list.Element) {
+	m.recency.Remove(el)
+	delete(m.entries, el.Value.(*memoryEntry).key)
+}
+
+// getJSON decodes the value under key into a new T, or returns nil on a miss
+func getJSON[T any](m *Memory, key string) (*T, error) {
+	data, ok := m.get(key)
+	if !ok {
+		return nil, nil
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// setJSON encodes v and stores it under key
+func (m *Memory) setJSON(key string, v interface{}, ttlSeconds int) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.set(key, data, ttlSeconds)
+	return nil
+}
+
+// GetPool retrieves a cached pool by ID
+func (m *Memory) GetPool(ctx context.Context, id string) (*models.Pool, error) {
+	return getJSON[models.Pool](m, memPool+id)
+}
+
+// SetPool caches a pool
+func (m *Memory) SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error {
+	return m.setJSON(memPool+pool.ID, pool, ttlSeconds)
+}
+
+// HasPoolTombstone reports whether a pool ID was recently looked up and not
+// found
+func (m *Memory) HasPoolTombstone(ctx context.Context, id string) (bool, error) {
+	_, ok := m.get(memPoolTombstone + id)
+	return ok, nil
+}
+
+// SetPoolTombstone remembers that a pool ID wasn't found
+func (m *Memory) SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error {
+	m.set(memPoolTombstone+id, nil, ttlSeconds)
+	return nil
+}
+
+// InvalidatePoolCache removes a pool from the cache
+func (m *Memory) InvalidatePoolCache(ctx context.Context, id string) error {
+	m.delete(memPool + id)
+	return nil
+}
+
+// GetPoolsCache retrieves a cached pool list response
+func (m *Memory) GetPoolsCache(ctx context.Context, cacheKey string) (*models.PoolListResponse, error) {
+	return getJSON[models.PoolListResponse](m, memPoolLists+cacheKey)
+}
+
+// SetPoolsCache caches a pool list response
+func (m *Memory) SetPoolsCache(ctx context.Context, cacheKey string, response *models.PoolListResponse, ttlSeconds int) error {
+	return m.setJSON(memPoolLists+cacheKey, response, ttlSeconds)
+}
+
+// GetPoolSearchCache retrieves a cached pool search response
+func (m *Memory) GetPoolSearchCache(ctx context.Context, cacheKey string) (*models.PoolSearchResponse, error) {
+	return getJSON[models.PoolSearchResponse](m, memPoolLists+cacheKey)
+}
+
+// SetPoolSearchCache caches a pool search response
+func (m *Memory) SetPoolSearchCache(ctx context.Context, cacheKey string, response *models.PoolSearchResponse, ttlSeconds int) error {
+	return m.setJSON(memPoolLists+cacheKey, response, ttlSeconds)
+}
+
+// InvalidateAllPoolsCache removes every cached pool list and search page
+func (m *Memory) InvalidateAllPoolsCache(ctx context.Context) error {
+	m.deletePrefix(memPoolLists)
+	return nil
+}
+
+// GetOpportunitiesCache retrieves a cached opportunity list response
+func (m *Memory) GetOpportunitiesCache(ctx context.Context, cacheKey string) (*models.OpportunityListResponse, error) {
+	return getJSON[models.OpportunityListResponse](m, memOpportunities+cacheKey)
+}
+
+// SetOpportunitiesCache caches an opportunity list response
+func (m *Memory) SetOpportunitiesCache(ctx context.Context, cacheKey string, response *models.OpportunityListResponse, ttlSeconds int) error {
+	return m.setJSON(memOpportunities+cacheKey, response, ttlSeconds)
+}
+
+// GetPoolOpportunitiesCache retrieves the cached opportunities of a pool
+func (m *Memory) GetPoolOpportunitiesCache(ctx context.Context, poolID string) (*models.PoolOpportunitiesResponse, error) {
+	return getJSON[models.PoolOpportunitiesResponse](m, memPoolOpportunities+poolID)
+}
+
+// SetPoolOpportunitiesCache caches the opportunities of a pool
+func (m *Memory) SetPoolOpportunitiesCache(ctx context.Context, response *models.PoolOpportunitiesResponse, ttlSeconds int) error {
+	return m.setJSON(memPoolOpportunities+response.PoolID, response, ttlSeconds)
+}
+
+// GetTrendingCache retrieves cached trending pools
+func (m *Memory) GetTrendingCache(ctx context.Context, cacheKey string) ([]models.TrendingPool, error) {
+	trending, err := getJSON[[]models.TrendingPool](m, memTrending+cacheKey)
+	if trending == nil || err != nil {
+		return nil, err
+	}
+	return *trending, nil
+}
+
+// SetTrendingCache caches trending pools
+func (m *Memory) SetTrendingCache(ctx context.Context, cacheKey string, trending []models.TrendingPool, ttlSeconds int) error {
+	return m.setJSON(memTrending+cacheKey, trending, ttlSeconds)
+}
+
+// GetChainsCache retrieves a cached chain list response
+func (m *Memory) GetChainsCache(ctx context.Context, cacheKey string) (*models.ChainListResponse, error) {
+	return getJSON[models.ChainListResponse](m, memChains+cacheKey)
+}
+
+// SetChainsCache caches a chain list response
+func (m *Memory) SetChainsCache(ctx context.Context, cacheKey string, response *models.ChainListResponse, ttlSeconds int) error {
+	return m.setJSON(memChains+cacheKey, response, ttlSeconds)
+}
+
+// GetProtocolsCache retrieves a cached protocol list response
+func (m *Memory) GetProtocolsCache(ctx context.Context, cacheKey string) (*models.ProtocolListResponse, error) {
+	return getJSON[models.ProtocolListResponse](m, memProtocols+cacheKey)
+}
+
+// SetProtocolsCache caches a protocol list response
+func (m *Memory) SetProtocolsCache(ctx context.Context, cacheKey string, response *models.ProtocolListResponse, ttlSeconds int) error {
+	return m.setJSON(memProtocols+cacheKey, response, ttlSeconds)
+}
+
+// GetProtocolHistoryCache retrieves a cached protocol history response
+func (m *Memory) GetProtocolHistoryCache(ctx context.Context, cacheKey string) (*models.ProtocolHistoryResponse, error) {
+	return getJSON[models.ProtocolHistoryResponse](m, memProtocolHistory+cacheKey)
+}
+
+// SetProtocolHistoryCache caches a protocol history response
+func (m *Memory) SetProtocolHistoryCache(ctx context.Context, cacheKey string, response *models.ProtocolHistoryResponse, ttlSeconds int) error {
+	return m.setJSON(memProtocolHistory+cacheKey, response, ttlSeconds)
+}
+
+// GetChainHistoryCache retrieves a cached chain history response
+func (m *Memory) GetChainHistoryCache(ctx context.Context, cacheKey string) (*models.ChainHistoryResponse, error) {
+	return getJSON[models.ChainHistoryResponse](m, memChainHistory+cacheKey)
+}
+
+// SetChainHistoryCache caches a chain history response
+func (m *Memory) SetChainHistoryCache(ctx context.Context, cacheKey string, response *models.ChainHistoryResponse, ttlSeconds int) error {
+	return m.setJSON(memChainHistory+cacheKey, response, ttlSeconds)
+}
+
+// GetStatsCache retrieves cached platform stats computed from source
+func (m *Memory) GetStatsCache(ctx context.Context, source string) (*models.PlatformStats, error) {
+	return getJSON[models.PlatformStats](m, memStats+source)
+}
+
+// SetStatsCache caches platform stats computed from source
+func (m *Memory) SetStatsCache(ctx context.Context, source string, stats *models.PlatformStats, ttlSeconds int) error {
+	return m.setJSON(memStats+source, stats, ttlSeconds)
+}
+
+// distributionKey returns the key of the pool distribution, with or without
+// the pools below the listing TVL floor
+func distributionKey(includeEmpty bool) string {
+	if includeEmpty {
+		return memDistribution + models.StatsVariantAll
+	}
+	return memDistribution
+}
+
+// GetDistributionCache retrieves the cached pool distribution
+func (m *Memory) GetDistributionCache(ctx context.Context, includeEmpty bool) (*models.PoolDistribution, error) {
+	return getJSON[models.PoolDistribution](m, distributionKey(includeEmpty))
+}
+
+// SetDistributionCache caches the pool distribution
+func (m *Memory) SetDistributionCache(ctx context.Context, includeEmpty bool, dist *models.PoolDistribution, ttlSeconds int) error {
+	return m.setJSON(distributionKey(includeEmpty), dist, ttlSeconds)
+}
+
+// GetTagsCache retrieves the cached tag listing
+func (m *Memory) GetTagsCache(ctx context.Context) (*models.TagListResponse, error) {
+	return getJSON[models.TagListResponse](m, memTags)
+}
+
+// SetTagsCache caches the tag listing
+func (m *Memory) SetTagsCache(ctx context.Context, response *models.TagListResponse, ttlSeconds int) error {
+	return m.setJSON(memTags, response, ttlSeconds)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2)
+
+	for _, id := range []string{"a", "b"} {
+		if err := m.SetPool(ctx, &models.Pool{ID: id}, 60); err != nil {
+			t.Fatalf("SetPool(%s) failed: %v", id, err)
+		}
+	}
+	// Reading a makes b the least recently used
+	if pool, _ := m.GetPool(ctx, "a"); pool == nil {
+		t.Fatal("Expected pool a to be cached")
+	}
+	_ = m.SetPool(ctx, &models.Pool{ID: "c"}, 60)
+
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", m.Len())
+	}
+	if pool, _ := m.GetPool(ctx, "b"); pool != nil {
+		t.Error("Expected pool b to be evicted")
+	}
+	for _, id := range []string{"a", "c"} {
+		if pool, _ := m.GetPool(ctx, id); pool == nil || pool.ID != id {
+			t.Errorf("Expected pool %s to be cached, got %v", id, pool)
+		}
+	}
+}
+
+func TestMemory_Expires(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	_ = m.SetPoolTombstone(ctx, "gone", 30)
+	_ = m.SetTagsCache(ctx, &models.TagListResponse{}, 0)
+
+	now = now.Add(29 * time.Second)
+	if missing, _ := m.HasPoolTombstone(ctx, "gone"); !missing {
+		t.Error("Expected the tombstone before its TTL")
+	}
+
+	now = now.Add(time.Second)
+	if missing, _ := m.HasPoolTombstone(ctx, "gone"); missing {
+		t.Error("Expected the tombstone to expire")
+	}
+	if tags, _ := m.GetTagsCache(ctx); tags == nil {
+		t.Error("Expected an entry without TTL to be kept")
+	}
+	if m.Len() != 1 {
+		t.Errorf("Expected the expired entry to be dropped, got %d entries", m.Len())
+	}
+}
+
+func TestMemory_InvalidatesPoolLists(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10)
+
+	_ = m.SetPoolsCache(ctx, "list", &models.PoolListResponse{Data: []models.Pool{{ID: "a"}}}, 60)
+	_ = m.SetPoolSearchCache(ctx, "search", &models.PoolSearchResponse{}, 60)
+	_ = m.SetPool(ctx, &models.Pool{ID: "a"}, 60)
+
+	if err := m.InvalidateAllPoolsCache(ctx); err != nil {
+		t.Fatalf("InvalidateAllPoolsCache failed: %v", err)
+	}
+	if list, _ := m.GetPoolsCache(ctx, "list"); list != nil {
+		t.Error("Expected the pool list to be retired")
+	}
+	if search, _ := m.GetPoolSearchCache(ctx, "search"); search != nil {
+		t.Error("Expected the search page to be retired")
+	}
+	if pool, _ := m.GetPool(ctx, "a"); pool == nil {
+		t.Error("Expected the pool detail to be kept")
+	}
+
+	_ = m.InvalidatePoolCache(ctx, "a")
+	if pool, _ := m.GetPool(ctx, "a"); pool != nil {
+		t.Error("Expected the pool detail to be removed")
+	}
+}
+
+func TestMemory_ReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10)
+
+	trending := []models.TrendingPool{{Pool: &models.Pool{ID: "a"}}}
+	_ = m.SetTrendingCache(ctx, "24h", trending, 60)
+	trending[0].Pool.ID = "changed"
+
+	got, err := m.GetTrendingCache(ctx, "24h")
+	if err != nil || len(got) != 1 || got[0].Pool.ID != "a" {
+		t.Fatalf("Expected the trending pools as cached, got %v, %v", got, err)
+	}
+	got[0].Pool.ID = "changed"
+	if again, _ := m.GetTrendingCache(ctx, "24h"); again[0].Pool.ID != "a" {
+		t.Error("Expected callers not to share a cached value")
+	}
+
+	if missing, err := m.GetTrendingCache(ctx, "7d"); missing != nil || err != nil {
+		t.Errorf("Expected a miss, got %v, %v", missing, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	redis := NewMemory(1) // Stands in for the Redis repository
+
+	tests := []struct {
+		backend string
+		check   func(Cache) bool
+	}{
+		{config.CacheBackendRedis, func(c Cache) bool { return c == redis }},
+		{config.CacheBackendMemory, func(c Cache) bool { m, ok := c.(*Memory); return ok && m != redis && m.maxEntries == 5 }},
+		{config.CacheBackendNone, func(c Cache) bool { _, ok := c.(Noop); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			c, err := New(config.CacheConfig{Backend: tt.backend, MemoryEntries: 5}, redis)
+			if err != nil || !tt.check(c) {
+				t.Errorf("Expected the %s backend, got %T, %v", tt.backend, c, err)
+			}
+		})
+	}
+
+	if _, err := New(config.CacheConfig{Backend: "memcached"}, redis); err == nil {
+		t.Error("Expected an unknown backend to fail")
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Noop is a cache that holds nothing: every read misses and writes and
+// invalidations are dropped
+type Noop struct{}
+
+func (Noop) GetPool(ctx context.Context, id string) (*models.Pool, error) { return nil, nil }
+
+func (Noop) SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error { return nil }
+
+func (Noop) HasPoolTombstone(ctx context.Context, id string) (bool, error) { return false, nil }
+
+func (Noop) SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error { return nil }
+
+func (Noop) InvalidatePoolCache(ctx context.Context, id string) error { return nil }
+
+func (Noop) GetPoolsCache(ctx context.Context, cacheKey string) (*models.PoolListResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetPoolsCache(ctx context.Context, cacheKey string, response *models.PoolListResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetPoolSearchCache(ctx context.Context, cacheKey string) (*models.PoolSearchResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetPoolSearchCache(ctx context.Context, cacheKey string, response *models.PoolSearchResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) InvalidateAllPoolsCache(ctx context.Context) error { return nil }
+
+func (Noop) GetOpportunitiesCache(ctx context.Context, cacheKey string) (*models.OpportunityListResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetOpportunitiesCache(ctx context.Context, cacheKey string, response *models.OpportunityListResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetPoolOpportunitiesCache(ctx context.Context, poolID string) (*models.PoolOpportunitiesResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetPoolOpportunitiesCache(ctx context.Context, response *models.PoolOpportunitiesResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetTrendingCache(ctx context.Context, cacheKey string) ([]models.TrendingPool, error) {
+	return nil, nil
+}
+
+func (Noop) SetTrendingCache(ctx context.Context, cacheKey string, trending []models.TrendingPool, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetChainsCache(ctx context.Context, cacheKey string) (*models.ChainListResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetChainsCache(ctx context.Context, cacheKey string, response *models.ChainListResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetProtocolsCache(ctx context.Context, cacheKey string) (*models.ProtocolListResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetProtocolsCache(ctx context.Context, cacheKey string, response *models.ProtocolListResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetProtocolHistoryCache(ctx context.Context, cacheKey string) (*models.ProtocolHistoryResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetProtocolHistoryCache(ctx context.Context, cacheKey string, response *models.ProtocolHistoryResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetChainHistoryCache(ctx context.Context, cacheKey string) (*models.ChainHistoryResponse, error) {
+	return nil, nil
+}
+
+func (Noop) SetChainHistoryCache(ctx context.Context, cacheKey string, response *models.ChainHistoryResponse, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetStatsCache(ctx context.Context, source string) (*models.PlatformStats, error) {
+	return nil, nil
+}
+
+func (Noop) SetStatsCache(ctx context.Context, source string, stats *models.PlatformStats, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetDistributionCache(ctx context.Context, includeEmpty bool) (*models.PoolDistribution, error) {
+	return nil, nil
+}
+
+func (Noop) SetDistributionCache(ctx context.Context, includeEmpty bool, dist *models.PoolDistribution, ttlSeconds int) error {
+	return nil
+}
+
+func (Noop) GetTagsCache(ctx context.Context) (*models.TagListResponse, error) { return nil, nil }
+
+func (Noop) SetTagsCache(ctx context.Context, response *models.TagListResponse, ttlSeconds int) error {
+	return nil
+}
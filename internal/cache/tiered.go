@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/metrics"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Tiered keeps the hottest keys, pools by ID and platform stats, in a small
+// in-process LRU in front of another cache, normally Redis, to absorb
+// bursts of lookups for the same keys. Local entries are fresh for at most
+// the local TTL, which bounds how long a process serves a value another
+// process has changed or invalidated. When the remote cache fails, a local
+// entry is served even past its TTL, so a brief Redis outage doesn't send
+// every lookup to the database. Every other key goes straight to the remote
+// cache.
+type Tiered struct {
+	Cache // Remote tier
+
+	local      *Memory
+	ttlSeconds int
+
+	localHits     atomic.Int64
+	localMisses   atomic.Int64
+	remoteHits    atomic.Int64
+	remoteMisses  atomic.Int64
+	remoteErrors  atomic.Int64
+	staleFallback atomic.Int64 // Stale local entries served on remote errors
+}
+
+// NewTiered creates a cache keeping up to entries hot keys in process for
+// ttlSeconds in front of remote
+func NewTiered(remote Cache, entries, ttlSeconds int) *Tiered {
+	return &Tiered{
+		Cache:      remote,
+		local:      NewMemory(entries),
+		ttlSeconds: ttlSeconds,
+	}
+}
+
+// localTTL returns the TTL of a local copy of an entry cached remotely for
+// ttlSeconds
+func (t *Tiered) localTTL(ttlSeconds int) int {
+	if ttlSeconds > 0 && ttlSeconds < t.ttlSeconds {
+		return ttlSeconds
+	}
+	return t.ttlSeconds
+}
+
+// tieredGet returns the value under key from the local tier if it is fresh,
+// or else from the remote tier, keeping a local copy
+func tieredGet[T any](t *Tiered, key string, remote func() (*T, error)) (*T, error) {
+	data, fresh, held := t.local.lookup(key)
+	if held && fresh {
+		var v T
+		if json.Unmarshal(data, &v) == nil {
+			t.localHits.Add(1)
+			return &v, nil
+		}
+	}
+	t.localMisses.Add(1)
+
+	v, err := remote()
+	switch {
+	case err != nil:
+		t.remoteErrors.Add(1)
+		if held {
+			var stale T
+			if json.Unmarshal(data, &stale) == nil {
+				t.staleFallback.Add(1)
+				return &stale, nil
+			}
+		}
+		return nil, err
+	case v == nil:
+		// The remote tier is authoritative: the key was invalidated or
+		// expired there
+		t.remoteMisses.Add(1)
+		t.local.delete(key)
+		return nil, nil
+	default:
+		t.remoteHits.Add(1)
+		_ = t.local.setJSON(key, v, t.ttlSeconds)
+		return v, nil
+	}
+}
+
+// GetPool retrieves a cached pool by ID
+func (t *Tiered) GetPool(ctx context.Context, id string) (*models.Pool, error) {
+	return tieredGet(t, memPool+id, func() (*models.Pool, error) {
+		return t.Cache.GetPool(ctx, id)
+	})
+}
+
+// SetPool caches a pool in both tiers. The local copy is kept even if the
+// remote tier fails.
+func (t *Tiered) SetPool(ctx context.Context, pool *models.Pool, ttlSeconds int) error {
+	_ = t.local.setJSON(memPool+pool.ID, pool, t.localTTL(ttlSeconds))
+	return t.Cache.SetPool(ctx, pool, ttlSeconds)
+}
+
+// InvalidatePoolCache removes a pool from both tiers
+func (t *Tiered) InvalidatePoolCache(ctx context.Context, id string) error {
+	t.local.delete(memPool + id)
+	return t.Cache.InvalidatePoolCache(ctx, id)
+}
+
+// GetStatsCache retrieves cached platform stats computed from source
+func (t *Tiered) GetStatsCache(ctx context.Context, source string) (*models.PlatformStats, error) {
+	return tieredGet(t, memStats+source, func() (*models.PlatformStats, error) {
+		return t.Cache.GetStatsCache(ctx, source)
+	})
+}
+
+// SetStatsCache caches platform stats in both tiers
+func (t *Tiered) SetStatsCache(ctx context.Context, source string, stats *models.PlatformStats, ttlSeconds int) error {
+	_ = t.local.setJSON(memStats+source, stats, t.localTTL(ttlSeconds))
+	return t.Cache.SetStatsCache(ctx, source, stats, ttlSeconds)
+}
+
+// Families returns the lookups of each tier as metric families
+func (t *Tiered) Families() []metrics.Family {
+	lookup := func(tier, result string, n *atomic.Int64) metrics.Sample {
+		return metrics.Sample{
+			Labels: map[string]string{"tier": tier, "result": result},
+			Value:  float64(n.Load()),
+		}
+	}
+	return []metrics.Family{
+		{
+			Name: "defi_cache_tier_lookups_total",
+			Help: "Lookups of hot keys by cache tier and result",
+			Type: "counter",
+			Samples: []metrics.Sample{
+				lookup("local", "hit", &t.localHits),
+				lookup("local", "miss", &t.localMisses),
+				lookup("redis", "hit", &t.remoteHits),
+				lookup("redis", "miss", &t.remoteMisses),
+				lookup("redis", "error", &t.remoteErrors),
+			},
+		},
+		{
+			Name:    "defi_cache_stale_hits_total",
+			Help:    "Hot keys served from an expired local entry because Redis failed",
+			Type:    "counter",
+			Samples: []metrics.Sample{{Value: float64(t.staleFallback.Load())}},
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// remoteCache is a remote tier counting pool lookups, which fail while err
+// is set
+type remoteCache struct {
+	*Memory
+	lookups int
+	err     error
+}
+
+func (r *remoteCache) GetPool(ctx context.Context, id string) (*models.Pool, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Memory.GetPool(ctx, id)
+}
+
+// newTestTiered returns a tiered cache with a 5 second local TTL over a
+// remote tier, sharing a settable clock
+func newTestTiered() (*Tiered, *remoteCache, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	remote := &remoteCache{Memory: NewMemory(10)}
+	remote.now = clock
+	tiered := NewTiered(remote, 10, 5)
+	tiered.local.now = clock
+	return tiered, remote, &now
+}
+
+// lookups returns the tier lookup counts as tier/result -> count
+func lookups(tiered *Tiered) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, sample := range tiered.Families()[0].Samples {
+		counts[sample.Labels["tier"]+"/"+sample.Labels["result"]] = sample.Value
+	}
+	return counts
+}
+
+func TestTiered_ServesHotKeysLocally(t *testing.T) {
+	ctx := context.Background()
+	tiered, remote, now := newTestTiered()
+	_ = remote.Memory.SetPool(ctx, &models.Pool{ID: "a"}, 60)
+
+	for i := 0; i < 3; i++ {
+		if pool, err := tiered.GetPool(ctx, "a"); err != nil || pool == nil || pool.ID != "a" {
+			t.Fatalf("Expected pool a, got %v, %v", pool, err)
+		}
+	}
+	if remote.lookups != 1 {
+		t.Errorf("Expected 1 Redis lookup for 3 reads, got %d", remote.lookups)
+	}
+
+	// Past the local TTL the remote tier is asked again
+	*now = now.Add(5 * time.Second)
+	_, _ = tiered.GetPool(ctx, "a")
+	if remote.lookups != 2 {
+		t.Errorf("Expected the expired local entry to be refreshed, got %d lookups", remote.lookups)
+	}
+
+	want := map[string]float64{"local/hit": 2, "local/miss": 2, "redis/hit": 2, "redis/miss": 0, "redis/error": 0}
+	got := lookups(tiered)
+	for key, n := range want {
+		if got[key] != n {
+			t.Errorf("Expected %s %v, got %v", key, n, got[key])
+		}
+	}
+}
+
+func TestTiered_FallsBackToStaleEntriesWhenRedisFails(t *testing.T) {
+	ctx := context.Background()
+	tiered, remote, now := newTestTiered()
+	_ = tiered.SetPool(ctx, &models.Pool{ID: "a"}, 60)
+
+	*now = now.Add(time.Minute)
+	remote.err = errors.New("connection refused")
+
+	pool, err := tiered.GetPool(ctx, "a")
+	if err != nil || pool == nil || pool.ID != "a" {
+		t.Fatalf("Expected the stale pool during the outage, got %v, %v", pool, err)
+	}
+	if _, err := tiered.GetPool(ctx, "b"); err == nil {
+		t.Error("Expected the Redis error for a key not held locally")
+	}
+	if stale := tiered.Families()[1].Samples[0].Value; stale != 1 {
+		t.Errorf("Expected 1 stale hit, got %v", stale)
+	}
+	if got := lookups(tiered)["redis/error"]; got != 2 {
+		t.Errorf("Expected 2 Redis errors, got %v", got)
+	}
+}
+
+func TestTiered_FollowsRemoteInvalidation(t *testing.T) {
+	ctx := context.Background()
+	tiered, remote, now := newTestTiered()
+	_ = tiered.SetPool(ctx, &models.Pool{ID: "a"}, 60)
+
+	// Another process, such as the worker, invalidates the pool in Redis
+	_ = remote.Memory.InvalidatePoolCache(ctx, "a")
+	if pool, _ := tiered.GetPool(ctx, "a"); pool == nil {
+		t.Error("Expected the local copy within its TTL")
+	}
+
+	*now = now.Add(5 * time.Second)
+	if pool, _ := tiered.GetPool(ctx, "a"); pool != nil {
+		t.Error("Expected the invalidation to be seen once the local copy expired")
+	}
+	remote.err = errors.New("connection refused")
+	if pool, _ := tiered.GetPool(ctx, "a"); pool != nil {
+		t.Error("Expected the local copy to be dropped after the Redis miss")
+	}
+
+	// Invalidating through the tiered cache clears both tiers at once
+	remote.err = nil
+	_ = tiered.SetPool(ctx, &models.Pool{ID: "b"}, 60)
+	_ = tiered.InvalidatePoolCache(ctx, "b")
+	if pool, _ := tiered.GetPool(ctx, "b"); pool != nil {
+		t.Error("Expected pool b to be invalidated in both tiers")
+	}
+}
+
+func TestTiered_LocalTTLCappedByEntryTTL(t *testing.T) {
+	ctx := context.Background()
+	tiered, _, now := newTestTiered()
+	_ = tiered.SetStatsCache(ctx, "postgres", &models.PlatformStats{TotalPools: 3}, 2)
+
+	*now = now.Add(2 * time.Second)
+	if stats, _ := tiered.GetStatsCache(ctx, "postgres"); stats != nil {
+		t.Errorf("Expected the stats to expire with their 2s TTL, got %v", stats)
+	}
+}
+
+func TestNew_AddsLocalTier(t *testing.T) {
+	remote := NewMemory(10)
+
+	c, _ := New(config.CacheConfig{Backend: config.CacheBackendRedis, LocalEntries: 100, LocalTTL: 5 * time.Second}, remote)
+	if _, ok := c.(*Tiered); !ok {
+		t.Errorf("Expected a tiered cache, got %T", c)
+	}
+	c, _ = New(config.CacheConfig{Backend: config.CacheBackendRedis}, remote)
+	if c != Cache(remote) {
+		t.Errorf("Expected the Redis cache without a local tier, got %T", c)
+	}
+}
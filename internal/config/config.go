@@ -3,13 +3,20 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
 )
 
 // Config holds all application configuration
@@ -18,6 +25,7 @@ type Config struct {
 	Server        ServerConfig
 	Postgres      PostgresConfig
 	Redis         RedisConfig
+	Cache         CacheConfig
 	ElasticSearch ElasticSearchConfig
 	RateLimit     RateLimitConfig
 	DeFiLlama     DeFiLlamaConfig
@@ -26,6 +34,16 @@ type Config struct {
 	Scoring       ScoringConfig
 	CORS          CORSConfig
 	WebSocket     WebSocketConfig
+	Admin         AdminConfig
+	Snapshot      SnapshotConfig
+	EventLog      EventLogConfig
+	GraphQL       GraphQLConfig
+	Metrics       MetricsConfig
+	Distribution  DistributionConfig
+	Listing       ListingConfig
+	Ingestion     IngestionConfig
+	Schedule      ScheduleConfig
+	Monitor       MonitorConfig
 }
 
 // AppConfig holds application-level settings
@@ -42,6 +60,44 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+
+	// BodyLimit is the largest request body accepted, in bytes; larger
+	// requests get 413. Admin endpoints, which take pool imports, accept up
+	// to AdminBodyLimit instead.
+	BodyLimit      int
+	AdminBodyLimit int
+
+	// Prefork runs a child process per core, all accepting on Port, so the
+	// JSON-heavy REST endpoints use every core. The WebSocket hub holds its
+	// clients, replay buffers and long-poll cursors in one process's memory,
+	// so it can't be preforked: the realtime routes (WebSocket, long polls of
+	// pool updates and the opportunity event stream) are then served by the
+	// parent process on RealtimePort. RealtimePort may also be set without
+	// Prefork to serve them on their own listener.
+	Prefork      bool
+	RealtimePort string
+}
+
+// Validate checks the request body limits and the listener settings
+func (c ServerConfig) Validate() error {
+	if c.BodyLimit < 1 {
+		return fmt.Errorf("SERVER_BODY_LIMIT must be at least 1, got %d", c.BodyLimit)
+	}
+	if c.AdminBodyLimit < 1 {
+		return fmt.Errorf("SERVER_ADMIN_BODY_LIMIT must be at least 1, got %d", c.AdminBodyLimit)
+	}
+	if c.Prefork && c.RealtimePort == "" {
+		return fmt.Errorf("SERVER_PREFORK requires SERVER_REALTIME_PORT: WebSocket clients, long polls and event streams share state in one process and need a listener that isn't preforked")
+	}
+	if c.RealtimePort != "" && c.RealtimePort == c.Port {
+		return fmt.Errorf("SERVER_REALTIME_PORT must differ from SERVER_PORT, both are %s", c.Port)
+	}
+	return nil
+}
+
+// SplitRealtime reports whether the realtime routes have their own listener
+func (c ServerConfig) SplitRealtime() bool {
+	return c.RealtimePort != ""
 }
 
 // PostgresConfig holds PostgreSQL connection settings
@@ -74,6 +130,24 @@ type RedisConfig struct {
 	Password string
 	DB       int
 	PoolSize int
+
+	// BreakerThreshold is the number of consecutive failed Redis calls that
+	// opens the circuit breaker (0 = no breaker). While it is open calls
+	// fail fast and cache reads are misses; after BreakerCooldown, or as
+	// soon as a health check pings Redis successfully, calls resume.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Validate checks the circuit breaker settings
+func (c RedisConfig) Validate() error {
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("REDIS_BREAKER_THRESHOLD must not be negative, got %d", c.BreakerThreshold)
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		return fmt.Errorf("REDIS_BREAKER_COOLDOWN must be positive, got %s", c.BreakerCooldown)
+	}
+	return nil
 }
 
 // Addr returns the Redis address in host:port format
@@ -81,11 +155,130 @@ func (c RedisConfig) Addr() string {
 	return c.Host + ":" + c.Port
 }
 
+// Response cache backends
+const (
+	CacheBackendRedis  = "redis"  // Shared by every server process; invalidated by the worker
+	CacheBackendMemory = "memory" // Per process; entries live until they expire or are evicted
+	CacheBackendNone   = "none"   // Every request reads the databases
+)
+
+// CacheConfig holds settings for the cache API responses are served from
+type CacheConfig struct {
+	Backend       string // redis, memory or none
+	MemoryEntries int    // Most responses the memory backend holds before evicting the least recently used
+
+	// Hot pools and stats are also kept in process in front of the redis
+	// backend, for LocalTTL at most; 0 LocalEntries disables the local tier
+	LocalEntries int
+	LocalTTL     time.Duration
+}
+
+// Validate checks that the backend is known, the memory backend has room and
+// the local tier's TTL is at least a second
+func (c CacheConfig) Validate() error {
+	switch c.Backend {
+	case CacheBackendRedis:
+		if c.LocalEntries < 0 {
+			return fmt.Errorf("CACHE_LOCAL_ENTRIES must not be negative, got %d", c.LocalEntries)
+		}
+		if c.LocalEntries > 0 && c.LocalTTL < time.Second {
+			return fmt.Errorf("CACHE_LOCAL_TTL must be at least 1s, got %s", c.LocalTTL)
+		}
+	case CacheBackendNone:
+	case CacheBackendMemory:
+		if c.MemoryEntries <= 0 {
+			return fmt.Errorf("CACHE_MEMORY_ENTRIES must be positive, got %d", c.MemoryEntries)
+		}
+	default:
+		return fmt.Errorf("CACHE_BACKEND must be %q, %q or %q, got %q", CacheBackendRedis, CacheBackendMemory, CacheBackendNone, c.Backend)
+	}
+	return nil
+}
+
 // ElasticSearchConfig holds ElasticSearch connection settings
 type ElasticSearchConfig struct {
 	URL      string
 	Username string
 	Password string
+
+	// ReindexBatchSize is the number of pools copied per batch when the
+	// pools index is rebuilt
+	ReindexBatchSize int
+	// ReindexGracePeriod is how long the previous pools index is kept after
+	// the alias moves, so in-flight searches against it can finish
+	ReindexGracePeriod time.Duration
+
+	// IndexShards and IndexReplicas are applied to new indices. The shard
+	// count of an existing index can't change and takes effect at the next
+	// reindex; replicas are updated in place on startup.
+	IndexShards   int
+	IndexReplicas int
+	// IndexRefreshInterval is how often new documents become searchable
+	// (0 = ElasticSearch default). Updated in place on startup.
+	IndexRefreshInterval time.Duration
+
+	// SearchTimeout bounds pool searches; a search that takes longer is
+	// served from PostgreSQL instead (0 = no timeout)
+	SearchTimeout time.Duration
+	// MaxResultWindow must match the index.max_result_window of the pools
+	// index (0 = the ElasticSearch default, 10000). Pages that end past it
+	// are read with search_after.
+	MaxResultWindow int
+
+	// RequestTimeout bounds connecting to ElasticSearch and each stats and
+	// health request, retries included (0 = no timeout)
+	RequestTimeout time.Duration
+	// MaxRetries is how often a request is retried on 429, 502, 503 and 504
+	// responses and connection errors, with exponential backoff. 0 or
+	// DisableRetry turns retries off.
+	MaxRetries   int
+	DisableRetry bool
+	// CompressRequests gzips request bodies, mostly bulk indexing
+	CompressRequests bool
+	// MaxIdleConns is the number of idle connections kept to ElasticSearch
+	MaxIdleConns int
+
+	// BreakerThreshold is the number of consecutive failed searches that
+	// opens the circuit breaker (0 = no breaker). While it is open searches
+	// fail fast and are served from PostgreSQL; after BreakerCooldown one
+	// search probes ElasticSearch again.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Validate checks the index and search settings
+func (c ElasticSearchConfig) Validate() error {
+	if c.IndexShards < 1 {
+		return fmt.Errorf("ELASTICSEARCH_INDEX_SHARDS must be at least 1, got %d", c.IndexShards)
+	}
+	if c.IndexReplicas < 0 {
+		return fmt.Errorf("ELASTICSEARCH_INDEX_REPLICAS must not be negative, got %d", c.IndexReplicas)
+	}
+	if c.IndexRefreshInterval < 0 {
+		return fmt.Errorf("ELASTICSEARCH_INDEX_REFRESH_INTERVAL must not be negative, got %s", c.IndexRefreshInterval)
+	}
+	if c.SearchTimeout < 0 {
+		return fmt.Errorf("ELASTICSEARCH_SEARCH_TIMEOUT must not be negative, got %s", c.SearchTimeout)
+	}
+	if c.MaxResultWindow < 0 {
+		return fmt.Errorf("ELASTICSEARCH_MAX_RESULT_WINDOW must not be negative, got %d", c.MaxResultWindow)
+	}
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("ELASTICSEARCH_REQUEST_TIMEOUT must not be negative, got %s", c.RequestTimeout)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("ELASTICSEARCH_MAX_RETRIES must not be negative, got %d", c.MaxRetries)
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("ELASTICSEARCH_MAX_IDLE_CONNS must not be negative, got %d", c.MaxIdleConns)
+	}
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("ELASTICSEARCH_BREAKER_THRESHOLD must not be negative, got %d", c.BreakerThreshold)
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		return fmt.Errorf("ELASTICSEARCH_BREAKER_COOLDOWN must be positive, got %s", c.BreakerCooldown)
+	}
+	return nil
 }
 
 // RateLimitConfig holds API rate limiting settings
@@ -99,6 +292,7 @@ type DeFiLlamaConfig struct {
 	BaseURL       string
 	RateLimit     int           // Requests per minute
 	FetchInterval time.Duration // How often to fetch data
+	HTTP          HTTPClientConfig
 }
 
 // CoinGeckoConfig holds CoinGecko API settings
@@ -107,6 +301,46 @@ type CoinGeckoConfig struct {
 	APIKey        string
 	RateLimit     int           // Requests per minute
 	FetchInterval time.Duration // How often to fetch data
+	HTTP          HTTPClientConfig
+}
+
+// HTTPClientConfig holds the timeouts and connection pool of an upstream
+// API client. Each phase of a request has its own limit, so a stalled TLS
+// handshake fails fast while a large response body still has time to
+// download. A zero timeout means no limit.
+type HTTPClientConfig struct {
+	Timeout               time.Duration // Whole request, including reading the body
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration // From sending the request to the response headers
+	IdleConnTimeout       time.Duration // How long an idle connection is kept for reuse
+	KeepAlive             time.Duration // TCP keep-alive probe interval (negative disables them)
+	MaxIdleConns          int           // Idle connections kept for reuse
+}
+
+// Validate checks that the timeouts and pool size are non-negative. prefix
+// is the environment variable prefix the settings were read with.
+func (c HTTPClientConfig) Validate(prefix string) error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"TIMEOUT", c.Timeout},
+		{"DIAL_TIMEOUT", c.DialTimeout},
+		{"TLS_HANDSHAKE_TIMEOUT", c.TLSHandshakeTimeout},
+		{"RESPONSE_HEADER_TIMEOUT", c.ResponseHeaderTimeout},
+		{"IDLE_CONN_TIMEOUT", c.IdleConnTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 {
+			return fmt.Errorf("%s_HTTP_%s must not be negative, got %s", prefix, t.name, t.value)
+		}
+	}
+
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("%s_HTTP_MAX_IDLE_CONNS must not be negative, got %d", prefix, c.MaxIdleConns)
+	}
+	return nil
 }
 
 // WorkerConfig holds background worker settings
@@ -117,6 +351,216 @@ type WorkerConfig struct {
 	MinAPYThreshold           float64
 	YieldGapMinProfit         float64
 	APYJumpThreshold          float64
+	// MinVolumeTVLRatio is the 24h volume / TVL floor for yield-gap and
+	// high-score detection. Pools without reported volume (e.g. lending
+	// markets) have a ratio of zero, so 0 disables the check.
+	MinVolumeTVLRatio float64
+	// FetchChunkSize is how many fetched pools are ingested, logged and
+	// checkpointed at a time (0 = 500)
+	FetchChunkSize int
+	// YieldGapBatchSize is how many pools yield-gap detection reads per
+	// query; YieldGapMaxPools caps the total scanned (0 = no cap)
+	YieldGapBatchSize int
+	YieldGapMaxPools  int
+	// YieldGapProfitHorizons are the holding periods, in days, yield-gap
+	// opportunities estimate their profit at
+	YieldGapProfitHorizons []int
+	// TrendingFetchLimit is how many of the fastest-growing pools trending
+	// detection considers per run
+	TrendingFetchLimit int
+	// TrendingConfirmPoints is how many of a pool's latest APY readings
+	// must hold its jump before it is flagged as trending, so a one-off
+	// spike in the upstream data is suppressed (0 or 1 = off)
+	TrendingConfirmPoints int
+	// PoolStaleAfter is how long a pool may go without updates before the
+	// active opportunities referencing it are retracted (0 = never)
+	PoolStaleAfter time.Duration
+	// OpportunityMaxPerType caps the opportunities of each type saved per
+	// detection run, and OpportunityMaxPerRun those of all types together.
+	// The highest-scoring are kept, ranked across detectors (0 = no cap).
+	OpportunityMaxPerType int
+	OpportunityMaxPerRun  int
+	// YieldGapTTL, TrendingTTL and HighScoreTTL are how long an opportunity
+	// of each type stays active after it was last detected (0 = the
+	// built-in 1h, 6h and 24h)
+	YieldGapTTL  time.Duration
+	TrendingTTL  time.Duration
+	HighScoreTTL time.Duration
+	// HighScoreMaxRewardRatio excludes pools whose reward APY is more than
+	// this share of total APY from high-score detection (0 = include all)
+	HighScoreMaxRewardRatio float64
+	// HighScoreMinScore is the pool score (0-100) high-score detection
+	// starts at
+	HighScoreMinScore float64
+	// SustainableMinBaseRatio is the least share (0-1) of a pool's APY that
+	// must be base yield, fees and interest rather than reward emissions,
+	// for its yield to count as sustainable. A pool whose base APY alone
+	// reaches SustainableMinBaseAPY counts too (0 = off). Used by the
+	// sustainableOnly filters and, with DetectSustainableOnly, by yield-gap
+	// and high-score detection.
+	SustainableMinBaseRatio float64
+	SustainableMinBaseAPY   float64
+	DetectSustainableOnly   bool
+	// IngestMinAPY, when set, drops fetched pools with a lower APY before
+	// ingestion, unlike MinAPYThreshold which only applies to detection.
+	// StoreBelowMinAPY still stores them, counting them only, for complete
+	// histories.
+	IngestMinAPY     *float64
+	StoreBelowMinAPY bool
+	// Chains, when set, are the only chains whose pools are ingested and
+	// considered by detection; pools on ExcludeChains never are. Set at
+	// startup, not reloaded.
+	Chains        []string
+	ExcludeChains []string
+}
+
+// ChainFilter returns the chain allowlist and exclusions
+func (c WorkerConfig) ChainFilter() ChainFilter {
+	return ChainFilter{allowed: chainSet(c.Chains), excluded: chainSet(c.ExcludeChains)}
+}
+
+// ValidateChains checks that no chain is both allowed and excluded
+func (c WorkerConfig) ValidateChains() error {
+	filter := c.ChainFilter()
+	for _, chain := range sortedChains(filter.excluded) {
+		if filter.allowed[chain] {
+			return fmt.Errorf("chain %q is in both WORKER_CHAINS and WORKER_EXCLUDE_CHAINS", chain)
+		}
+	}
+	return nil
+}
+
+// ChainFilter decides which chains' pools are ingested. Chain names are
+// compared after utils.NormalizeChainName, so "Ethereum", "eth" and
+// "mainnet" are the same chain. The zero value allows every chain.
+type ChainFilter struct {
+	allowed  map[string]bool // Empty allows all chains
+	excluded map[string]bool
+}
+
+// chainSet normalizes chain names into a set, skipping blank entries
+func chainSet(chains []string) map[string]bool {
+	set := make(map[string]bool, len(chains))
+	for _, chain := range chains {
+		if chain = utils.NormalizeChainName(chain); chain != "" {
+			set[chain] = true
+		}
+	}
+	return set
+}
+
+// sortedChains returns the chains in a set in name order
+func sortedChains(set map[string]bool) []string {
+	chains := make([]string, 0, len(set))
+	for chain := range set {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+// Active reports whether the filter limits the chains ingested
+func (f ChainFilter) Active() bool {
+	return len(f.allowed) > 0 || len(f.excluded) > 0
+}
+
+// Allows reports whether pools on chain are ingested
+func (f ChainFilter) Allows(chain string) bool {
+	chain = utils.NormalizeChainName(chain)
+	if len(f.allowed) > 0 && !f.allowed[chain] {
+		return false
+	}
+	return !f.excluded[chain]
+}
+
+// Note describes the active filter for API consumers, or is empty when every
+// chain is ingested
+func (f ChainFilter) Note() string {
+	notes := make([]string, 0, 2)
+	if len(f.allowed) > 0 {
+		notes = append(notes, fmt.Sprintf("Only pools on %s are ingested", strings.Join(sortedChains(f.allowed), ", ")))
+	}
+	if len(f.excluded) > 0 {
+		notes = append(notes, fmt.Sprintf("Pools on %s are not ingested", strings.Join(sortedChains(f.excluded), ", ")))
+	}
+	return strings.Join(notes, "; ")
+}
+
+// ValidateIngestMinAPY checks that the ingestion APY floor is a number
+func (c WorkerConfig) ValidateIngestMinAPY() error {
+	if c.IngestMinAPY != nil && (math.IsNaN(*c.IngestMinAPY) || math.IsInf(*c.IngestMinAPY, 0)) {
+		return fmt.Errorf("WORKER_MIN_APY must be a finite number, got %v", *c.IngestMinAPY)
+	}
+	return nil
+}
+
+// ValidateThresholds checks that the opportunity detection thresholds are usable
+func (c WorkerConfig) ValidateThresholds() error {
+	thresholds := []struct {
+		name  string
+		value float64
+	}{
+		{"MIN_TVL_THRESHOLD", c.MinTVLThreshold},
+		{"MIN_APY_THRESHOLD", c.MinAPYThreshold},
+		{"YIELD_GAP_MIN_PROFIT", c.YieldGapMinProfit},
+		{"APY_JUMP_THRESHOLD", c.APYJumpThreshold},
+		{"MIN_VOLUME_TVL_RATIO", c.MinVolumeTVLRatio},
+		{"HIGH_SCORE_MAX_REWARD_RATIO", c.HighScoreMaxRewardRatio},
+		{"HIGH_SCORE_MIN_SCORE", c.HighScoreMinScore},
+		{"SUSTAINABLE_MIN_BASE_RATIO", c.SustainableMinBaseRatio},
+		{"SUSTAINABLE_MIN_BASE_APY", c.SustainableMinBaseAPY},
+	}
+
+	for _, t := range thresholds {
+		if math.IsNaN(t.value) || math.IsInf(t.value, 0) || t.value < 0 {
+			return fmt.Errorf("%s must be a non-negative number, got %v", t.name, t.value)
+		}
+	}
+
+	if c.HighScoreMaxRewardRatio > 1 {
+		return fmt.Errorf("HIGH_SCORE_MAX_REWARD_RATIO must be between 0 and 1, got %v", c.HighScoreMaxRewardRatio)
+	}
+
+	if c.SustainableMinBaseRatio > 1 {
+		return fmt.Errorf("SUSTAINABLE_MIN_BASE_RATIO must be between 0 and 1, got %v", c.SustainableMinBaseRatio)
+	}
+
+	if c.HighScoreMinScore > 100 {
+		return fmt.Errorf("HIGH_SCORE_MIN_SCORE must be between 0 and 100, got %v", c.HighScoreMinScore)
+	}
+
+	for _, days := range c.YieldGapProfitHorizons {
+		if days <= 0 {
+			return fmt.Errorf("YIELD_GAP_PROFIT_HORIZONS must be positive numbers of days, got %v", c.YieldGapProfitHorizons)
+		}
+	}
+
+	if c.TrendingConfirmPoints < 0 {
+		return fmt.Errorf("TRENDING_CONFIRM_POINTS must not be negative, got %d", c.TrendingConfirmPoints)
+	}
+
+	if c.OpportunityMaxPerType < 0 {
+		return fmt.Errorf("OPPORTUNITY_MAX_PER_TYPE must not be negative, got %d", c.OpportunityMaxPerType)
+	}
+	if c.OpportunityMaxPerRun < 0 {
+		return fmt.Errorf("OPPORTUNITY_MAX_PER_RUN must not be negative, got %d", c.OpportunityMaxPerRun)
+	}
+
+	ttls := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"YIELD_GAP_TTL", c.YieldGapTTL},
+		{"TRENDING_TTL", c.TrendingTTL},
+		{"HIGH_SCORE_TTL", c.HighScoreTTL},
+	}
+	for _, t := range ttls {
+		if t.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", t.name, t.value)
+		}
+	}
+
+	return nil
 }
 
 // ScoringConfig holds opportunity scoring weights
@@ -125,6 +569,120 @@ type ScoringConfig struct {
 	TVLWeight       float64
 	StabilityWeight float64
 	TrendWeight     float64
+	// VolumeWeight adds a 24h volume / TVL term to the score. It defaults to 0
+	// so existing scores are unchanged until opted in.
+	VolumeWeight float64
+
+	// TVLNormMin and TVLNormMax are the USD bounds of the logarithmic TVL
+	// normalization curve: TVL at or below the minimum scores 0, at or above
+	// the maximum scores 1. APYNormMax is the APY percentage that scores 1.
+	TVLNormMin float64
+	TVLNormMax float64
+	APYNormMax float64
+
+	// CompletenessPenalty is the fraction of the score removed from a pool
+	// with no optional data; pools with partial data lose proportionally less
+	CompletenessPenalty float64
+
+	// FreshnessDecayScale controls how quickly a pool's score decays with the
+	// age of its last update when results are ranked with rankMode=decayed
+	FreshnessDecayScale time.Duration
+
+	// AutoNormalizeWeights rescales weights that don't sum to 1.0 instead of
+	// failing to load the configuration
+	AutoNormalizeWeights bool
+
+	// ChainOverridesFile is an optional JSON or YAML file with per-chain
+	// security ratings and gas costs merged over the built-in defaults
+	ChainOverridesFile string
+	// ChainOverridesFromDB also loads overrides from the chain_overrides table,
+	// taking precedence over the file
+	ChainOverridesFromDB bool
+}
+
+// Default normalization bounds for scoring
+const (
+	DefaultTVLNormMin = 1_000          // $1K
+	DefaultTVLNormMax = 10_000_000_000 // $10B
+	DefaultAPYNormMax = 10_000         // 10000%
+)
+
+// weightSumTolerance is how far the scoring weights may sum from 1.0
+const weightSumTolerance = 0.01
+
+// weightList returns the scoring weights with their env var names
+func (c ScoringConfig) weightList() []struct {
+	name  string
+	value float64
+} {
+	return []struct {
+		name  string
+		value float64
+	}{
+		{"SCORE_WEIGHT_APY", c.APYWeight},
+		{"SCORE_WEIGHT_TVL", c.TVLWeight},
+		{"SCORE_WEIGHT_STABILITY", c.StabilityWeight},
+		{"SCORE_WEIGHT_TREND", c.TrendWeight},
+		{"SCORE_WEIGHT_VOLUME", c.VolumeWeight},
+	}
+}
+
+// weightSum returns the sum of the scoring weights, or an error if any
+// weight is negative or not a number
+func (c ScoringConfig) weightSum() (float64, error) {
+	var sum float64
+	for _, w := range c.weightList() {
+		if math.IsNaN(w.value) || math.IsInf(w.value, 0) || w.value < 0 {
+			return 0, fmt.Errorf("%s must be a non-negative number, got %v", w.name, w.value)
+		}
+		sum += w.value
+	}
+	return sum, nil
+}
+
+// Validate checks that the scoring weights are non-negative and sum to 1.0
+// (within weightSumTolerance), and that any normalization bounds are usable.
+// Zero bounds mean the defaults are used.
+func (c ScoringConfig) Validate() error {
+	sum, err := c.weightSum()
+	if err != nil {
+		return err
+	}
+	if math.Abs(sum-1) > weightSumTolerance {
+		return fmt.Errorf("scoring weights must sum to 1.0, got %.4f", sum)
+	}
+
+	if c.TVLNormMin < 0 || c.TVLNormMax < 0 || c.APYNormMax < 0 {
+		return errors.New("scoring normalization bounds must be non-negative")
+	}
+	if c.TVLNormMin > 0 && c.TVLNormMax > 0 && c.TVLNormMin >= c.TVLNormMax {
+		return fmt.Errorf("SCORE_TVL_NORM_MIN (%v) must be less than SCORE_TVL_NORM_MAX (%v)", c.TVLNormMin, c.TVLNormMax)
+	}
+	if c.CompletenessPenalty < 0 || c.CompletenessPenalty > 1 {
+		return fmt.Errorf("SCORE_COMPLETENESS_PENALTY must be between 0 and 1, got %v", c.CompletenessPenalty)
+	}
+
+	return nil
+}
+
+// Normalized returns a copy with the weights scaled to sum to 1.0. It fails
+// if any weight is invalid or all weights are zero.
+func (c ScoringConfig) Normalized() (ScoringConfig, error) {
+	sum, err := c.weightSum()
+	if err != nil {
+		return c, err
+	}
+	if sum == 0 {
+		return c, errors.New("at least one scoring weight must be greater than zero")
+	}
+
+	c.APYWeight /= sum
+	c.TVLWeight /= sum
+	c.StabilityWeight /= sum
+	c.TrendWeight /= sum
+	c.VolumeWeight /= sum
+
+	return c, nil
 }
 
 // CORSConfig holds CORS settings
@@ -139,7 +697,386 @@ type CORSConfig struct {
 type WebSocketConfig struct {
 	PingInterval   time.Duration
 	PongTimeout    time.Duration
+	WriteTimeout   time.Duration // Deadline for each write; a client that can't keep up is dropped
 	MaxMessageSize int64
+	ReplayBuffer   int // Broadcasts kept per channel for clients resuming with lastSeq; 0 disables replay
+	PollBuffer     int // Pool updates kept for long-poll clients of /api/v1/pools/updates
+
+	// AlertCoalesceWindow holds further opportunity alerts for a pool sent
+	// to a client within this long of the first and merges them into one
+	// message when it ends; 0 sends every alert as it comes
+	AlertCoalesceWindow time.Duration
+}
+
+// AdminConfig holds settings for the admin API
+type AdminConfig struct {
+	APIKey        string // Required in the X-Admin-Key header; admin API is disabled when empty
+	ImportMaxRows int    // Maximum rows accepted per pool import request
+}
+
+// GraphQLConfig holds GraphQL endpoint settings
+type GraphQLConfig struct {
+	Playground      bool   // Serve the Playground UI on GET /graphql without a query
+	GetCacheControl string // Cache-Control header for successful GET queries; none when empty
+	MaxDepth        int    // Deepest field nesting a query may have
+	MaxComplexity   int    // Cost budget of a query, see the graphql package
+
+	// Timeout bounds resolving a query, below the server's write timeout;
+	// fields not resolved in time are returned as errors. 0 means no limit.
+	Timeout time.Duration
+}
+
+// Validate checks the query limits
+func (c GraphQLConfig) Validate() error {
+	if c.MaxDepth < 1 {
+		return fmt.Errorf("GRAPHQL_MAX_DEPTH must be at least 1, got %d", c.MaxDepth)
+	}
+	if c.MaxComplexity < 1 {
+		return fmt.Errorf("GRAPHQL_MAX_COMPLEXITY must be at least 1, got %d", c.MaxComplexity)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("GRAPHQL_TIMEOUT must not be negative, got %s", c.Timeout)
+	}
+	return nil
+}
+
+// MetricsConfig holds settings for the Prometheus gauges
+type MetricsConfig struct {
+	CacheTTL   time.Duration // How long repository counts are reused between scrapes
+	StaleAfter time.Duration // Pools not updated within this window count as stale
+}
+
+// DistributionConfig holds the bucket boundaries for the pool distribution
+// endpoint. Each slice lists ascending lower bounds; a bucket runs up to the
+// next bound and the last one is open-ended.
+type DistributionConfig struct {
+	ScoreBuckets []float64
+	TVLBuckets   []float64
+	CacheTTL     time.Duration
+}
+
+// Validate checks that the bucket boundaries are non-empty and strictly ascending
+func (c DistributionConfig) Validate() error {
+	buckets := []struct {
+		name  string
+		edges []float64
+	}{
+		{"POOL_DISTRIBUTION_SCORE_BUCKETS", c.ScoreBuckets},
+		{"POOL_DISTRIBUTION_TVL_BUCKETS", c.TVLBuckets},
+	}
+
+	for _, b := range buckets {
+		if len(b.edges) == 0 {
+			return fmt.Errorf("%s must list at least one boundary", b.name)
+		}
+		for i, edge := range b.edges {
+			if math.IsNaN(edge) || math.IsInf(edge, 0) {
+				return fmt.Errorf("%s must contain finite numbers, got %v", b.name, edge)
+			}
+			if i > 0 && edge <= b.edges[i-1] {
+				return fmt.Errorf("%s must be strictly ascending, got %v after %v", b.name, edge, b.edges[i-1])
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListingConfig holds display defaults for pool listings and platform stats
+type ListingConfig struct {
+	// MinTVL is the TVL floor in USD below which pools count as dead and are
+	// left out of listings and stats unless includeEmpty is set. They are
+	// still stored and served by ID. 0 shows every pool.
+	MinTVL float64
+	// MinOpportunityScore is the opportunity score (0-100) the opportunity
+	// listing starts at unless the client passes minScore. 0 lists all.
+	MinOpportunityScore float64
+}
+
+// Validate checks that the TVL floor is a non-negative number and the
+// score floor is within 0-100
+func (c ListingConfig) Validate() error {
+	if math.IsNaN(c.MinTVL) || math.IsInf(c.MinTVL, 0) || c.MinTVL < 0 {
+		return fmt.Errorf("LISTING_MIN_TVL must be a non-negative number, got %v", c.MinTVL)
+	}
+	if math.IsNaN(c.MinOpportunityScore) || c.MinOpportunityScore < 0 || c.MinOpportunityScore > 100 {
+		return fmt.Errorf("LISTING_MIN_OPPORTUNITY_SCORE must be between 0 and 100, got %v", c.MinOpportunityScore)
+	}
+	return nil
+}
+
+// Pool update publish modes
+const (
+	PublishModeAll     = "all"     // Publish every ingested pool
+	PublishModeChanged = "changed" // Publish only pools whose APY, TVL or score moved beyond the epsilons
+)
+
+// IngestionConfig holds settings for the pool ingestion pipeline
+type IngestionConfig struct {
+	// PublishMode selects which ingested pools are published to WebSocket
+	// subscribers: PublishModeAll or PublishModeChanged
+	PublishMode string
+
+	// In PublishModeChanged a pool is published when it moved by more than
+	// one of these since the cached copy: APY and score in absolute points,
+	// TVL as a fraction of the previous TVL. 0 publishes any change.
+	PublishAPYEpsilon   float64
+	PublishTVLEpsilon   float64
+	PublishScoreEpsilon float64
+
+	// Plausible APY range in percent. APYs outside it are clamped to it for
+	// scoring and sorting, and the pool is flagged as an outlier.
+	APYMin float64
+	APYMax float64
+
+	// A pool's historical data point is skipped when APY, base and reward
+	// APY (in absolute points) and TVL (as a fraction) all moved by no more
+	// than these since the last recorded point, but one is recorded at
+	// least every HistoryHeartbeat so bucketed charts keep their points.
+	// A heartbeat of 0 records every cycle.
+	HistoryAPYEpsilon float64
+	HistoryTVLEpsilon float64
+	HistoryHeartbeat  time.Duration
+}
+
+// MaxStorableAPY is the largest APY magnitude the pools table can hold
+const MaxStorableAPY = 999999
+
+// Validate checks that the publish mode is known and the epsilons are
+// non-negative
+func (c IngestionConfig) Validate() error {
+	switch c.PublishMode {
+	case PublishModeAll, PublishModeChanged:
+	default:
+		return fmt.Errorf("POOL_PUBLISH_MODE must be %q or %q, got %q", PublishModeAll, PublishModeChanged, c.PublishMode)
+	}
+
+	epsilons := []struct {
+		name  string
+		value float64
+	}{
+		{"POOL_PUBLISH_APY_EPSILON", c.PublishAPYEpsilon},
+		{"POOL_PUBLISH_TVL_EPSILON", c.PublishTVLEpsilon},
+		{"POOL_PUBLISH_SCORE_EPSILON", c.PublishScoreEpsilon},
+		{"HISTORY_APY_EPSILON", c.HistoryAPYEpsilon},
+		{"HISTORY_TVL_EPSILON", c.HistoryTVLEpsilon},
+	}
+	for _, e := range epsilons {
+		if math.IsNaN(e.value) || math.IsInf(e.value, 0) || e.value < 0 {
+			return fmt.Errorf("%s must be a non-negative number, got %v", e.name, e.value)
+		}
+	}
+
+	if math.IsNaN(c.APYMin) || math.IsNaN(c.APYMax) || c.APYMin >= c.APYMax {
+		return fmt.Errorf("POOL_APY_MIN must be below POOL_APY_MAX, got %v and %v", c.APYMin, c.APYMax)
+	}
+	if c.APYMin < -MaxStorableAPY || c.APYMax > MaxStorableAPY {
+		return fmt.Errorf("POOL_APY_MIN and POOL_APY_MAX must be within +/-%d", MaxStorableAPY)
+	}
+	if c.HistoryHeartbeat < 0 {
+		return fmt.Errorf("HISTORY_HEARTBEAT must not be negative, got %s", c.HistoryHeartbeat)
+	}
+
+	return nil
+}
+
+// ScheduleConfig holds the cron expressions of the worker's jobs. They have
+// a seconds field and may start with CRON_TZ=<zone>; descriptors such as
+// @hourly or @every 2m are accepted too. The fetch and detection schedules
+// default to their configured intervals, see IntervalSchedule.
+type ScheduleConfig struct {
+	DeFiLlama string // Pool fetch
+	CoinGecko string // Token price fetch
+	Detection string // Opportunity detection
+	APYIndex  string // APY index values
+
+	// DetectionOffset delays every detection run past its schedule, so it
+	// doesn't start together with a pool fetch on shared clock boundaries
+	DetectionOffset time.Duration
+	InitialFetch    bool          // Fetch and detect once on startup
+	StartupDelay    time.Duration // Wait before the initial fetch
+	StartupJitter   time.Duration // Random extra wait before the initial fetch, up to this
+
+	// DetectAfterFetch runs detection once a pool fetch succeeds, after
+	// DetectDebounce without another fetch. The detection schedule keeps
+	// running as a fallback.
+	DetectAfterFetch bool
+	DetectDebounce   time.Duration
+}
+
+// MinJobInterval is the shortest interval a fetch or detection job may be
+// configured to run at
+const MinJobInterval = 30 * time.Second
+
+// IntervalSchedule returns the cron expression running a job every d.
+// Intervals that evenly divide an hour or a day stay aligned to the clock,
+// so every 3 minutes runs at :00, :03, ...; other intervals count from
+// when the scheduler starts.
+func IntervalSchedule(d time.Duration) string {
+	switch {
+	case d == time.Minute:
+		return "0 * * * * *"
+	case d%time.Minute == 0 && d < time.Hour && time.Hour%d == 0:
+		return fmt.Sprintf("0 */%d * * * *", d/time.Minute)
+	case d == time.Hour:
+		return "0 0 * * * *"
+	case d%time.Hour == 0 && d < 24*time.Hour && (24*time.Hour)%d == 0:
+		return fmt.Sprintf("0 0 */%d * * *", d/time.Hour)
+	}
+	return "@every " + d.String()
+}
+
+// validateJobIntervals checks that the fetch and detection intervals aren't
+// below MinJobInterval
+func validateJobIntervals(cfg *Config) error {
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"DEFILLAMA_FETCH_INTERVAL", cfg.DeFiLlama.FetchInterval},
+		{"COINGECKO_FETCH_INTERVAL", cfg.CoinGecko.FetchInterval},
+		{"OPPORTUNITY_DETECT_INTERVAL", cfg.Worker.OpportunityDetectInterval},
+	}
+	for _, i := range intervals {
+		if i.value < MinJobInterval {
+			return fmt.Errorf("%s must be at least %s, got %s", i.name, MinJobInterval, i.value)
+		}
+	}
+	return nil
+}
+
+// cronParser parses schedules the way the worker's scheduler does
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parses a schedule the way Validate does
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	return cronParser.Parse(spec)
+}
+
+// Validate checks that every schedule parses and no delay is negative
+func (c ScheduleConfig) Validate() error {
+	schedules := []struct {
+		name string
+		expr string
+	}{
+		{"WORKER_DEFILLAMA_SCHEDULE", c.DeFiLlama},
+		{"WORKER_COINGECKO_SCHEDULE", c.CoinGecko},
+		{"WORKER_DETECTION_SCHEDULE", c.Detection},
+		{"WORKER_APY_INDEX_SCHEDULE", c.APYIndex},
+	}
+	for _, s := range schedules {
+		if _, err := cronParser.Parse(s.expr); err != nil {
+			return fmt.Errorf("%s %q is not a valid cron expression: %w", s.name, s.expr, err)
+		}
+	}
+
+	delays := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"WORKER_DETECTION_OFFSET", c.DetectionOffset},
+		{"WORKER_STARTUP_DELAY", c.StartupDelay},
+		{"WORKER_STARTUP_JITTER", c.StartupJitter},
+		{"WORKER_DETECT_DEBOUNCE", c.DetectDebounce},
+	}
+	for _, d := range delays {
+		if d.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", d.name, d.value)
+		}
+	}
+	return nil
+}
+
+// SnapshotConfig holds settings for archiving raw DeFiLlama responses
+type SnapshotConfig struct {
+	Enabled       bool   // Archiving is storage-heavy, so it is off by default
+	Backend       string // "fs" or "postgres"
+	Dir           string // Directory for the fs backend
+	MaxBytes      int    // Maximum compressed snapshot size; larger snapshots are skipped
+	RetentionDays int    // Snapshots older than this are deleted
+}
+
+// EventLogConfig holds settings for the worker's event log, an NDJSON copy
+// of every pool update and opportunity alert it publishes, kept for offline
+// analysis
+type EventLogConfig struct {
+	Enabled       bool          // Off by default
+	Dir           string        // Directory of the hourly files
+	BatchSize     int           // Events buffered before they are written
+	FlushInterval time.Duration // Buffered events are written at least this often
+	RetentionDays int           // Files older than this are deleted (0 = kept forever)
+}
+
+// Validate checks the event log settings when it is enabled
+func (c EventLogConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("EVENT_LOG_DIR must be set")
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("EVENT_LOG_BATCH_SIZE must be at least 1, got %d", c.BatchSize)
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("EVENT_LOG_FLUSH_INTERVAL must be positive, got %s", c.FlushInterval)
+	}
+	if c.RetentionDays < 0 {
+		return fmt.Errorf("EVENT_LOG_RETENTION_DAYS must not be negative, got %d", c.RetentionDays)
+	}
+	return nil
+}
+
+// MonitorConfig holds the thresholds of the worker's platform monitor,
+// which checks the totals of each pools fetch for upstream glitches
+type MonitorConfig struct {
+	Enabled bool
+
+	// TVLDropPercent and PoolDropPercent are how far total TVL and the pool
+	// count may fall from the last healthy fetch before it is an anomaly
+	TVLDropPercent  float64
+	PoolDropPercent float64
+
+	// IngestionGap is how long without a successful fetch is an anomaly
+	// (0 = not checked)
+	IngestionGap time.Duration
+
+	// ConfirmCycles is how many fetches in a row must show an anomaly
+	// before it is alerted; the data is flagged suspect from the first
+	ConfirmCycles int
+
+	// WebhookURL, when set, also receives alerts as JSON POSTs
+	WebhookURL     string
+	WebhookTimeout time.Duration
+}
+
+// Validate checks that the drop thresholds are percentages and at least
+// one cycle confirms an alert
+func (c MonitorConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	drops := []struct {
+		name  string
+		value float64
+	}{
+		{"MONITOR_TVL_DROP_PERCENT", c.TVLDropPercent},
+		{"MONITOR_POOL_DROP_PERCENT", c.PoolDropPercent},
+	}
+	for _, d := range drops {
+		if math.IsNaN(d.value) || d.value <= 0 || d.value > 100 {
+			return fmt.Errorf("%s must be above 0 and at most 100, got %v", d.name, d.value)
+		}
+	}
+
+	if c.IngestionGap < 0 {
+		return fmt.Errorf("MONITOR_INGESTION_GAP must not be negative, got %s", c.IngestionGap)
+	}
+	if c.ConfirmCycles < 1 {
+		return fmt.Errorf("MONITOR_CONFIRM_CYCLES must be at least 1, got %d", c.ConfirmCycles)
+	}
+	return nil
 }
 
 // Load reads configuration from environment variables
@@ -149,6 +1086,122 @@ func Load() (*Config, error) {
 		log.Debug().Msg("No .env file found, using environment variables")
 	}
 
+	return validated(fromEnv())
+}
+
+// Reload re-reads configuration for a running process. Unlike Load, values in
+// the .env file replace variables already set in the environment, so edits to
+// the file take effect without a restart.
+func Reload() (*Config, error) {
+	if err := godotenv.Overload(); err != nil {
+		log.Debug().Msg("No .env file found, using environment variables")
+	}
+
+	return validated(fromEnv())
+}
+
+// validated checks the configuration, normalizing the scoring weights first
+// when auto-normalization is enabled
+func validated(cfg *Config) (*Config, error) {
+	if cfg.Scoring.AutoNormalizeWeights && cfg.Scoring.Validate() != nil {
+		normalized, err := cfg.Scoring.Normalized()
+		if err != nil {
+			return nil, fmt.Errorf("invalid scoring config: %w", err)
+		}
+		log.Warn().
+			Float64("apy", normalized.APYWeight).
+			Float64("tvl", normalized.TVLWeight).
+			Float64("stability", normalized.StabilityWeight).
+			Float64("trend", normalized.TrendWeight).
+			Float64("volume", normalized.VolumeWeight).
+			Msg("Scoring weights don't sum to 1.0, normalized them")
+		cfg.Scoring = normalized
+	}
+
+	if err := cfg.Scoring.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scoring config: %w", err)
+	}
+
+	if err := cfg.Server.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+
+	if err := cfg.GraphQL.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid graphql config: %w", err)
+	}
+
+	if err := cfg.Distribution.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid distribution config: %w", err)
+	}
+
+	if err := cfg.Listing.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid listing config: %w", err)
+	}
+
+	if err := cfg.Ingestion.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid ingestion config: %w", err)
+	}
+
+	if err := cfg.Redis.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid redis config: %w", err)
+	}
+
+	if err := cfg.Cache.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cache config: %w", err)
+	}
+
+	if err := cfg.EventLog.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid event log config: %w", err)
+	}
+
+	if err := cfg.ElasticSearch.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid elasticsearch config: %w", err)
+	}
+
+	if err := cfg.DeFiLlama.HTTP.Validate("DEFILLAMA"); err != nil {
+		return nil, fmt.Errorf("invalid defillama config: %w", err)
+	}
+
+	if err := cfg.CoinGecko.HTTP.Validate("COINGECKO"); err != nil {
+		return nil, fmt.Errorf("invalid coingecko config: %w", err)
+	}
+
+	if err := cfg.Monitor.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid monitor config: %w", err)
+	}
+
+	if err := cfg.Worker.ValidateChains(); err != nil {
+		return nil, fmt.Errorf("invalid worker config: %w", err)
+	}
+
+	if err := cfg.Worker.ValidateIngestMinAPY(); err != nil {
+		return nil, fmt.Errorf("invalid worker config: %w", err)
+	}
+
+	if err := validateJobIntervals(cfg); err != nil {
+		return nil, fmt.Errorf("invalid worker config: %w", err)
+	}
+
+	// Schedules not set explicitly follow the intervals
+	if cfg.Schedule.DeFiLlama == "" {
+		cfg.Schedule.DeFiLlama = IntervalSchedule(cfg.DeFiLlama.FetchInterval)
+	}
+	if cfg.Schedule.CoinGecko == "" {
+		cfg.Schedule.CoinGecko = IntervalSchedule(cfg.CoinGecko.FetchInterval)
+	}
+	if cfg.Schedule.Detection == "" {
+		cfg.Schedule.Detection = IntervalSchedule(cfg.Worker.OpportunityDetectInterval)
+	}
+
+	if err := cfg.Schedule.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid schedule config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// fromEnv builds the configuration from the current environment
+func fromEnv() *Config {
 	cfg := &Config{
 		App: AppConfig{
 			Env:      getEnv("APP_ENV", "development"),
@@ -161,6 +1214,12 @@ func Load() (*Config, error) {
 			ReadTimeout:  getDuration("SERVER_READ_TIMEOUT", 30*time.Second),
 			WriteTimeout: getDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
 			IdleTimeout:  getDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+
+			BodyLimit:      getInt("SERVER_BODY_LIMIT", 1<<20),
+			AdminBodyLimit: getInt("SERVER_ADMIN_BODY_LIMIT", 8<<20),
+
+			Prefork:      getBool("SERVER_PREFORK", false),
+			RealtimePort: getEnv("SERVER_REALTIME_PORT", ""),
 		},
 		Postgres: PostgresConfig{
 			Host:                  getEnv("POSTGRES_HOST", "localhost"),
@@ -179,11 +1238,39 @@ func Load() (*Config, error) {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getInt("REDIS_DB", 0),
 			PoolSize: getInt("REDIS_POOL_SIZE", 10),
+
+			BreakerThreshold: getInt("REDIS_BREAKER_THRESHOLD", 3),
+			BreakerCooldown:  getDuration("REDIS_BREAKER_COOLDOWN", 10*time.Second),
+		},
+		Cache: CacheConfig{
+			Backend:       strings.ToLower(getEnv("CACHE_BACKEND", CacheBackendRedis)),
+			MemoryEntries: getInt("CACHE_MEMORY_ENTRIES", 10000),
+			LocalEntries:  getInt("CACHE_LOCAL_ENTRIES", 1000),
+			LocalTTL:      getDuration("CACHE_LOCAL_TTL", 5*time.Second),
 		},
 		ElasticSearch: ElasticSearchConfig{
 			URL:      getEnv("ELASTICSEARCH_URL", "http://localhost:9200"),
 			Username: getEnv("ELASTICSEARCH_USERNAME", ""),
 			Password: getEnv("ELASTICSEARCH_PASSWORD", ""),
+
+			ReindexBatchSize:   getInt("ELASTICSEARCH_REINDEX_BATCH_SIZE", 1000),
+			ReindexGracePeriod: getDuration("ELASTICSEARCH_REINDEX_GRACE_PERIOD", 10*time.Minute),
+
+			IndexShards:          getInt("ELASTICSEARCH_INDEX_SHARDS", 1),
+			IndexReplicas:        getInt("ELASTICSEARCH_INDEX_REPLICAS", 0),
+			IndexRefreshInterval: getDuration("ELASTICSEARCH_INDEX_REFRESH_INTERVAL", 0),
+
+			SearchTimeout:   getDuration("ELASTICSEARCH_SEARCH_TIMEOUT", 2*time.Second),
+			MaxResultWindow: getInt("ELASTICSEARCH_MAX_RESULT_WINDOW", 10000),
+
+			RequestTimeout:   getDuration("ELASTICSEARCH_REQUEST_TIMEOUT", 10*time.Second),
+			MaxRetries:       getInt("ELASTICSEARCH_MAX_RETRIES", 3),
+			DisableRetry:     getBool("ELASTICSEARCH_DISABLE_RETRY", false),
+			CompressRequests: getBool("ELASTICSEARCH_COMPRESS_REQUESTS", false),
+			MaxIdleConns:     getInt("ELASTICSEARCH_MAX_IDLE_CONNS", 20),
+
+			BreakerThreshold: getInt("ELASTICSEARCH_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getDuration("ELASTICSEARCH_BREAKER_COOLDOWN", 30*time.Second),
 		},
 		RateLimit: RateLimitConfig{
 			Requests: getInt("RATE_LIMIT_REQUESTS", 100),
@@ -193,12 +1280,16 @@ func Load() (*Config, error) {
 			BaseURL:       getEnv("DEFILLAMA_BASE_URL", "https://yields.llama.fi"),
 			RateLimit:     getInt("DEFILLAMA_RATE_LIMIT", 500),
 			FetchInterval: getDuration("DEFILLAMA_FETCH_INTERVAL", 3*time.Minute),
+			// The pools response is tens of megabytes, so it gets longer to
+			// download than CoinGecko's
+			HTTP: httpClientFromEnv("DEFILLAMA", 60*time.Second),
 		},
 		CoinGecko: CoinGeckoConfig{
 			BaseURL:       getEnv("COINGECKO_BASE_URL", "https://api.coingecko.com/api/v3"),
 			APIKey:        getEnv("COINGECKO_API_KEY", ""),
 			RateLimit:     getInt("COINGECKO_RATE_LIMIT", 30),
 			FetchInterval: getDuration("COINGECKO_FETCH_INTERVAL", 10*time.Minute),
+			HTTP:          httpClientFromEnv("COINGECKO", 30*time.Second),
 		},
 		Worker: WorkerConfig{
 			OpportunityDetectInterval: getDuration("OPPORTUNITY_DETECT_INTERVAL", 5*time.Minute),
@@ -207,12 +1298,48 @@ func Load() (*Config, error) {
 			MinAPYThreshold:           getFloat("MIN_APY_THRESHOLD", 0.1),
 			YieldGapMinProfit:         getFloat("YIELD_GAP_MIN_PROFIT", 0.5),
 			APYJumpThreshold:          getFloat("APY_JUMP_THRESHOLD", 50),
+			MinVolumeTVLRatio:         getFloat("MIN_VOLUME_TVL_RATIO", 0),
+			FetchChunkSize:            getInt("WORKER_FETCH_CHUNK_SIZE", 500),
+			YieldGapBatchSize:         getInt("YIELD_GAP_BATCH_SIZE", 1000),
+			YieldGapMaxPools:          getInt("YIELD_GAP_MAX_POOLS", 0),
+			YieldGapProfitHorizons:    getIntSlice("YIELD_GAP_PROFIT_HORIZONS", []int{7, 30, 90, 365}),
+			TrendingFetchLimit:        getInt("TRENDING_FETCH_LIMIT", 100),
+			TrendingConfirmPoints:     getInt("TRENDING_CONFIRM_POINTS", 3),
+			OpportunityMaxPerType:     getInt("OPPORTUNITY_MAX_PER_TYPE", 50),
+			OpportunityMaxPerRun:      getInt("OPPORTUNITY_MAX_PER_RUN", 0),
+			HighScoreMaxRewardRatio:   getFloat("HIGH_SCORE_MAX_REWARD_RATIO", 0),
+			HighScoreMinScore:         getFloat("HIGH_SCORE_MIN_SCORE", 70),
+			SustainableMinBaseRatio:   getFloat("SUSTAINABLE_MIN_BASE_RATIO", 0.5),
+			SustainableMinBaseAPY:     getFloat("SUSTAINABLE_MIN_BASE_APY", 0),
+			DetectSustainableOnly:     getBool("DETECT_SUSTAINABLE_ONLY", false),
+			PoolStaleAfter:            getDuration("POOL_STALE_AFTER", time.Hour),
+			YieldGapTTL:               getDuration("YIELD_GAP_TTL", time.Hour),
+			TrendingTTL:               getDuration("TRENDING_TTL", 6*time.Hour),
+			HighScoreTTL:              getDuration("HIGH_SCORE_TTL", 24*time.Hour),
+			IngestMinAPY:              getOptionalFloat("WORKER_MIN_APY"),
+			StoreBelowMinAPY:          getBool("WORKER_STORE_BELOW_MIN_APY", false),
+			Chains:                    getStringSlice("WORKER_CHAINS", nil),
+			ExcludeChains:             getStringSlice("WORKER_EXCLUDE_CHAINS", nil),
 		},
 		Scoring: ScoringConfig{
 			APYWeight:       getFloat("SCORE_WEIGHT_APY", 0.35),
 			TVLWeight:       getFloat("SCORE_WEIGHT_TVL", 0.25),
 			StabilityWeight: getFloat("SCORE_WEIGHT_STABILITY", 0.25),
 			TrendWeight:     getFloat("SCORE_WEIGHT_TREND", 0.15),
+			VolumeWeight:    getFloat("SCORE_WEIGHT_VOLUME", 0),
+
+			AutoNormalizeWeights: getBool("SCORE_WEIGHTS_AUTO_NORMALIZE", false),
+
+			TVLNormMin: getFloat("SCORE_TVL_NORM_MIN", DefaultTVLNormMin),
+			TVLNormMax: getFloat("SCORE_TVL_NORM_MAX", DefaultTVLNormMax),
+			APYNormMax: getFloat("SCORE_APY_NORM_MAX", DefaultAPYNormMax),
+
+			CompletenessPenalty: getFloat("SCORE_COMPLETENESS_PENALTY", 0.2),
+
+			FreshnessDecayScale: getDuration("SCORE_FRESHNESS_DECAY_SCALE", 6*time.Hour),
+
+			ChainOverridesFile:   getEnv("CHAIN_OVERRIDES_FILE", ""),
+			ChainOverridesFromDB: getBool("CHAIN_OVERRIDES_FROM_DB", false),
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: getStringSlice("CORS_ALLOWED_ORIGINS", []string{"*"}),
@@ -223,11 +1350,90 @@ func Load() (*Config, error) {
 		WebSocket: WebSocketConfig{
 			PingInterval:   getDuration("WS_PING_INTERVAL", 30*time.Second),
 			PongTimeout:    getDuration("WS_PONG_TIMEOUT", 60*time.Second),
+			WriteTimeout:   getDuration("WS_WRITE_TIMEOUT", 10*time.Second),
 			MaxMessageSize: int64(getInt("WS_MAX_MESSAGE_SIZE", 65536)), // 64KB for pool updates
+			ReplayBuffer:   getInt("WS_REPLAY_BUFFER", 200),
+			PollBuffer:     getInt("WS_POLL_BUFFER", 5000),
+
+			AlertCoalesceWindow: getDuration("WS_ALERT_COALESCE_WINDOW", 10*time.Second),
+		},
+		Admin: AdminConfig{
+			APIKey:        getEnv("ADMIN_API_KEY", ""),
+			ImportMaxRows: getInt("ADMIN_IMPORT_MAX_ROWS", 1000),
+		},
+		Snapshot: SnapshotConfig{
+			Enabled:       getBool("SNAPSHOT_ENABLED", false),
+			Backend:       getEnv("SNAPSHOT_BACKEND", "fs"),
+			Dir:           getEnv("SNAPSHOT_DIR", "./data/snapshots"),
+			MaxBytes:      getInt("SNAPSHOT_MAX_BYTES", 50*1024*1024), // 50MB compressed
+			RetentionDays: getInt("SNAPSHOT_RETENTION_DAYS", 7),
+		},
+		EventLog: EventLogConfig{
+			Enabled:       getBool("EVENT_LOG_ENABLED", false),
+			Dir:           getEnv("EVENT_LOG_DIR", "./data/events"),
+			BatchSize:     getInt("EVENT_LOG_BATCH_SIZE", 500),
+			FlushInterval: getDuration("EVENT_LOG_FLUSH_INTERVAL", 10*time.Second),
+			RetentionDays: getInt("EVENT_LOG_RETENTION_DAYS", 30),
+		},
+		Metrics: MetricsConfig{
+			CacheTTL:   getDuration("METRICS_CACHE_TTL", 30*time.Second),
+			StaleAfter: getDuration("METRICS_STALE_AFTER", time.Hour),
+		},
+		Distribution: DistributionConfig{
+			ScoreBuckets: getFloatSlice("POOL_DISTRIBUTION_SCORE_BUCKETS", []float64{0, 20, 40, 60, 80}),
+			TVLBuckets:   getFloatSlice("POOL_DISTRIBUTION_TVL_BUCKETS", []float64{0, 100_000, 1_000_000, 10_000_000, 100_000_000, 1_000_000_000}),
+			CacheTTL:     getDuration("POOL_DISTRIBUTION_CACHE_TTL", 2*time.Minute),
+		},
+		Listing: ListingConfig{
+			MinTVL:              getFloat("LISTING_MIN_TVL", 1),
+			MinOpportunityScore: getFloat("LISTING_MIN_OPPORTUNITY_SCORE", 0),
+		},
+		Ingestion: IngestionConfig{
+			PublishMode:         getEnv("POOL_PUBLISH_MODE", PublishModeChanged),
+			PublishAPYEpsilon:   getFloat("POOL_PUBLISH_APY_EPSILON", 0.01),
+			PublishTVLEpsilon:   getFloat("POOL_PUBLISH_TVL_EPSILON", 0.001),
+			PublishScoreEpsilon: getFloat("POOL_PUBLISH_SCORE_EPSILON", 0.1),
+			APYMin:              getFloat("POOL_APY_MIN", -100),
+			APYMax:              getFloat("POOL_APY_MAX", 100000),
+			HistoryAPYEpsilon:   getFloat("HISTORY_APY_EPSILON", 0),
+			HistoryTVLEpsilon:   getFloat("HISTORY_TVL_EPSILON", 0),
+			HistoryHeartbeat:    getDuration("HISTORY_HEARTBEAT", time.Hour),
+		},
+		GraphQL: GraphQLConfig{
+			GetCacheControl: getEnv("GRAPHQL_GET_CACHE_CONTROL", ""),
+			MaxDepth:        getInt("GRAPHQL_MAX_DEPTH", 10),
+			MaxComplexity:   getInt("GRAPHQL_MAX_COMPLEXITY", 1000),
+			Timeout:         getDuration("GRAPHQL_TIMEOUT", 25*time.Second),
+		},
+		Schedule: ScheduleConfig{
+			DeFiLlama: getEnv("WORKER_DEFILLAMA_SCHEDULE", ""),
+			CoinGecko: getEnv("WORKER_COINGECKO_SCHEDULE", ""),
+			Detection: getEnv("WORKER_DETECTION_SCHEDULE", ""),
+			APYIndex:  getEnv("WORKER_APY_INDEX_SCHEDULE", "CRON_TZ=UTC 0 10 0 * * *"),
+
+			DetectionOffset: getDuration("WORKER_DETECTION_OFFSET", time.Minute),
+			InitialFetch:    getBool("WORKER_INITIAL_FETCH", true),
+			StartupDelay:    getDuration("WORKER_STARTUP_DELAY", 0),
+			StartupJitter:   getDuration("WORKER_STARTUP_JITTER", 0),
+
+			DetectAfterFetch: getBool("WORKER_DETECT_AFTER_FETCH", false),
+			DetectDebounce:   getDuration("WORKER_DETECT_DEBOUNCE", 10*time.Second),
+		},
+		Monitor: MonitorConfig{
+			Enabled:         getBool("MONITOR_ENABLED", true),
+			TVLDropPercent:  getFloat("MONITOR_TVL_DROP_PERCENT", 10),
+			PoolDropPercent: getFloat("MONITOR_POOL_DROP_PERCENT", 20),
+			IngestionGap:    getDuration("MONITOR_INGESTION_GAP", 15*time.Minute),
+			ConfirmCycles:   getInt("MONITOR_CONFIRM_CYCLES", 2),
+			WebhookURL:      getEnv("MONITOR_WEBHOOK_URL", ""),
+			WebhookTimeout:  getDuration("MONITOR_WEBHOOK_TIMEOUT", 5*time.Second),
 		},
 	}
 
-	return cfg, nil
+	// The Playground is off in production unless explicitly enabled
+	cfg.GraphQL.Playground = getBool("GRAPHQL_PLAYGROUND", !cfg.IsProduction())
+
+	return cfg
 }
 
 // IsDevelopment returns true if running in development mode
@@ -242,6 +1448,20 @@ func (c *Config) IsProduction() bool {
 
 // Helper functions for reading environment variables with defaults
 
+// httpClientFromEnv reads an upstream client's HTTP settings from the
+// <prefix>_HTTP_* variables, with timeout as the default overall timeout
+func httpClientFromEnv(prefix string, timeout time.Duration) HTTPClientConfig {
+	return HTTPClientConfig{
+		Timeout:               getDuration(prefix+"_HTTP_TIMEOUT", timeout),
+		DialTimeout:           getDuration(prefix+"_HTTP_DIAL_TIMEOUT", 5*time.Second),
+		TLSHandshakeTimeout:   getDuration(prefix+"_HTTP_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+		ResponseHeaderTimeout: getDuration(prefix+"_HTTP_RESPONSE_HEADER_TIMEOUT", 20*time.Second),
+		IdleConnTimeout:       getDuration(prefix+"_HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+		KeepAlive:             getDuration(prefix+"_HTTP_KEEP_ALIVE", 30*time.Second),
+		MaxIdleConns:          getInt(prefix+"_HTTP_MAX_IDLE_CONNS", 10),
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -267,6 +1487,26 @@ func getFloat(key string, defaultValue float64) float64 {
 	return defaultValue
 }
 
+// getOptionalFloat returns nil when the variable is unset, empty or not a
+// number
+func getOptionalFloat(key string) *float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return &floatVal
+		}
+	}
+	return nil
+}
+
+func getBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
 func getDuration(key string, defaultValue time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(key); exists {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -282,3 +1522,43 @@ func getStringSlice(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// getIntSlice parses a comma-separated list of integers. The default is
+// used if any entry fails to parse.
+func getIntSlice(key string, defaultValue []int) []int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	parts := strings.Split(value, ",")
+	values := make([]int, 0, len(parts))
+	for _, part := range parts {
+		intVal, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, intVal)
+	}
+	return values
+}
+
+// getFloatSlice parses a comma-separated list of numbers. The default is
+// used if any entry fails to parse.
+func getFloatSlice(key string, defaultValue []float64) []float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	parts := strings.Split(value, ",")
+	values := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		floatVal, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, floatVal)
+	}
+	return values
+}
@@ -0,0 +1,623 @@
+package config
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScoringConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ScoringConfig
+		hasError bool
+	}{
+		{"defaults", ScoringConfig{APYWeight: 0.35, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.15}, false},
+		{"with volume weight", ScoringConfig{APYWeight: 0.3, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.1, VolumeWeight: 0.1}, false},
+		{"within tolerance", ScoringConfig{APYWeight: 0.335, TVLWeight: 0.335, StabilityWeight: 0.335}, false},
+		{"all set to 0.5", ScoringConfig{APYWeight: 0.5, TVLWeight: 0.5, StabilityWeight: 0.5, TrendWeight: 0.5}, true},
+		{"sum too low", ScoringConfig{APYWeight: 0.2, TVLWeight: 0.2}, true},
+		{"all zero", ScoringConfig{}, true},
+		{"negative weight", ScoringConfig{APYWeight: 1.2, TVLWeight: -0.2}, true},
+		{"NaN weight", ScoringConfig{APYWeight: math.NaN(), TVLWeight: 1}, true},
+		{"custom norm bounds", ScoringConfig{APYWeight: 1, TVLNormMin: 10000, TVLNormMax: 1e9, APYNormMax: 1000}, false},
+		{"inverted tvl bounds", ScoringConfig{APYWeight: 1, TVLNormMin: 1e9, TVLNormMax: 10000}, true},
+		{"negative apy cap", ScoringConfig{APYWeight: 1, APYNormMax: -1}, true},
+		{"completeness penalty", ScoringConfig{APYWeight: 1, CompletenessPenalty: 0.2}, false},
+		{"completeness penalty above 1", ScoringConfig{APYWeight: 1, CompletenessPenalty: 1.5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestScoringConfigNormalized(t *testing.T) {
+	cfg := ScoringConfig{APYWeight: 0.5, TVLWeight: 0.5, StabilityWeight: 0.5, TrendWeight: 0.5}
+
+	normalized, err := cfg.Normalized()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if normalized.APYWeight != 0.25 || normalized.TrendWeight != 0.25 {
+		t.Errorf("Expected weights of 0.25, got %+v", normalized)
+	}
+	if err := normalized.Validate(); err != nil {
+		t.Errorf("Expected normalized weights to be valid, got %v", err)
+	}
+
+	if _, err := (ScoringConfig{}).Normalized(); err == nil {
+		t.Error("Expected error normalizing all-zero weights")
+	}
+}
+
+func TestLoad_ScoringWeights(t *testing.T) {
+	t.Run("invalid weights fail", func(t *testing.T) {
+		t.Setenv("SCORE_WEIGHT_APY", "0.5")
+		t.Setenv("SCORE_WEIGHT_TVL", "0.5")
+		t.Setenv("SCORE_WEIGHT_STABILITY", "0.5")
+		t.Setenv("SCORE_WEIGHT_TREND", "0.5")
+
+		if _, err := Load(); err == nil {
+			t.Error("Expected error for weights summing to 2.0")
+		}
+	})
+
+	t.Run("invalid weights auto-normalized", func(t *testing.T) {
+		t.Setenv("SCORE_WEIGHT_APY", "0.5")
+		t.Setenv("SCORE_WEIGHT_TVL", "0.5")
+		t.Setenv("SCORE_WEIGHT_STABILITY", "0.5")
+		t.Setenv("SCORE_WEIGHT_TREND", "0.5")
+		t.Setenv("SCORE_WEIGHTS_AUTO_NORMALIZE", "true")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Scoring.APYWeight != 0.25 {
+			t.Errorf("Expected normalized APY weight 0.25, got %v", cfg.Scoring.APYWeight)
+		}
+	})
+
+	t.Run("defaults are valid", func(t *testing.T) {
+		if _, err := Load(); err != nil {
+			t.Errorf("Expected default weights to load, got %v", err)
+		}
+	})
+}
+
+func TestWorkerConfigValidateThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      WorkerConfig
+		hasError bool
+	}{
+		{"defaults", WorkerConfig{MinTVLThreshold: 100000, MinAPYThreshold: 0.1}, false},
+		{"reward ratio", WorkerConfig{HighScoreMaxRewardRatio: 0.5}, false},
+		{"reward ratio above 1", WorkerConfig{HighScoreMaxRewardRatio: 1.5}, true},
+		{"sustainable yield", WorkerConfig{SustainableMinBaseRatio: 0.5, SustainableMinBaseAPY: 3, DetectSustainableOnly: true}, false},
+		{"base ratio above 1", WorkerConfig{SustainableMinBaseRatio: 1.2}, true},
+		{"opportunity caps", WorkerConfig{OpportunityMaxPerType: 50, OpportunityMaxPerRun: 120}, false},
+		{"negative per-type cap", WorkerConfig{OpportunityMaxPerType: -1}, true},
+		{"negative per-run cap", WorkerConfig{OpportunityMaxPerRun: -1}, true},
+		{"negative base apy floor", WorkerConfig{SustainableMinBaseAPY: -1}, true},
+		{"min score above 100", WorkerConfig{HighScoreMinScore: 101}, true},
+		{"negative threshold", WorkerConfig{MinTVLThreshold: -1}, true},
+		{"ttls", WorkerConfig{YieldGapTTL: 30 * time.Minute, TrendingTTL: 12 * time.Hour}, false},
+		{"negative ttl", WorkerConfig{HighScoreTTL: -time.Hour}, true},
+		{"negative confirm points", WorkerConfig{TrendingConfirmPoints: -1}, true},
+		{"zero profit horizon", WorkerConfig{YieldGapProfitHorizons: []int{7, 0}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.ValidateThresholds()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestElasticSearchConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ElasticSearchConfig
+		hasError bool
+	}{
+		{"defaults", ElasticSearchConfig{IndexShards: 1}, false},
+		{"production", ElasticSearchConfig{IndexShards: 3, IndexReplicas: 1, IndexRefreshInterval: 5 * time.Second}, false},
+		{"no shards", ElasticSearchConfig{IndexShards: 0}, true},
+		{"negative replicas", ElasticSearchConfig{IndexShards: 1, IndexReplicas: -1}, true},
+		{"search limits", ElasticSearchConfig{IndexShards: 1, SearchTimeout: time.Second, MaxResultWindow: 50000}, false},
+		{"negative search timeout", ElasticSearchConfig{IndexShards: 1, SearchTimeout: -time.Second}, true},
+		{"negative result window", ElasticSearchConfig{IndexShards: 1, MaxResultWindow: -1}, true},
+		{"client settings", ElasticSearchConfig{IndexShards: 1, RequestTimeout: 5 * time.Second, MaxRetries: 2, MaxIdleConns: 10}, false},
+		{"negative request timeout", ElasticSearchConfig{IndexShards: 1, RequestTimeout: -time.Second}, true},
+		{"negative retries", ElasticSearchConfig{IndexShards: 1, MaxRetries: -1}, true},
+		{"breaker", ElasticSearchConfig{IndexShards: 1, BreakerThreshold: 5, BreakerCooldown: 30 * time.Second}, false},
+		{"breaker without cooldown", ElasticSearchConfig{IndexShards: 1, BreakerThreshold: 5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestRedisConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      RedisConfig
+		hasError bool
+	}{
+		{"no breaker", RedisConfig{}, false},
+		{"breaker", RedisConfig{BreakerThreshold: 3, BreakerCooldown: 10 * time.Second}, false},
+		{"negative threshold", RedisConfig{BreakerThreshold: -1}, true},
+		{"breaker without cooldown", RedisConfig{BreakerThreshold: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      CacheConfig
+		hasError bool
+	}{
+		{"redis", CacheConfig{Backend: CacheBackendRedis}, false},
+		{"none", CacheConfig{Backend: CacheBackendNone}, false},
+		{"memory", CacheConfig{Backend: CacheBackendMemory, MemoryEntries: 100}, false},
+		{"memory without room", CacheConfig{Backend: CacheBackendMemory}, true},
+		{"unknown backend", CacheConfig{Backend: "memcached"}, true},
+		{"redis with a local tier", CacheConfig{Backend: CacheBackendRedis, LocalEntries: 1000, LocalTTL: 5 * time.Second}, false},
+		{"local tier with a short TTL", CacheConfig{Backend: CacheBackendRedis, LocalEntries: 1000, LocalTTL: 500 * time.Millisecond}, true},
+		{"negative local entries", CacheConfig{Backend: CacheBackendRedis, LocalEntries: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestEventLogConfigValidate(t *testing.T) {
+	valid := EventLogConfig{Enabled: true, Dir: "./data/events", BatchSize: 500, FlushInterval: 10 * time.Second, RetentionDays: 30}
+
+	tests := []struct {
+		name     string
+		mutate   func(*EventLogConfig)
+		hasError bool
+	}{
+		{"valid", func(c *EventLogConfig) {}, false},
+		{"disabled ignores settings", func(c *EventLogConfig) { *c = EventLogConfig{} }, false},
+		{"kept forever", func(c *EventLogConfig) { c.RetentionDays = 0 }, false},
+		{"no directory", func(c *EventLogConfig) { c.Dir = "" }, true},
+		{"no batch", func(c *EventLogConfig) { c.BatchSize = 0 }, true},
+		{"no flush interval", func(c *EventLogConfig) { c.FlushInterval = 0 }, true},
+		{"negative retention", func(c *EventLogConfig) { c.RetentionDays = -1 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.mutate(&cfg)
+			err := cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestHTTPClientConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      HTTPClientConfig
+		hasError bool
+	}{
+		{"zero", HTTPClientConfig{}, false},
+		{"tuned", HTTPClientConfig{Timeout: time.Minute, DialTimeout: 5 * time.Second, ResponseHeaderTimeout: 20 * time.Second, MaxIdleConns: 10}, false},
+		{"keep-alives disabled", HTTPClientConfig{KeepAlive: -1}, false},
+		{"negative timeout", HTTPClientConfig{Timeout: -time.Second}, true},
+		{"negative handshake timeout", HTTPClientConfig{TLSHandshakeTimeout: -time.Second}, true},
+		{"negative idle connections", HTTPClientConfig{MaxIdleConns: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate("DEFILLAMA")
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ServerConfig
+		hasError bool
+	}{
+		{"defaults", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: 8 << 20}, false},
+		{"no body limit", ServerConfig{BodyLimit: 0, AdminBodyLimit: 8 << 20}, true},
+		{"negative admin body limit", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: -1}, true},
+		{"prefork", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: 8 << 20, Port: "3000", Prefork: true, RealtimePort: "3001"}, false},
+		{"prefork without realtime port", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: 8 << 20, Port: "3000", Prefork: true}, true},
+		{"realtime port without prefork", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: 8 << 20, Port: "3000", RealtimePort: "3001"}, false},
+		{"realtime port same as port", ServerConfig{BodyLimit: 1 << 20, AdminBodyLimit: 8 << 20, Port: "3000", Prefork: true, RealtimePort: "3000"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestGraphQLConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      GraphQLConfig
+		hasError bool
+	}{
+		{"defaults", GraphQLConfig{MaxDepth: 10, MaxComplexity: 1000}, false},
+		{"no depth", GraphQLConfig{MaxDepth: 0, MaxComplexity: 1000}, true},
+		{"negative complexity", GraphQLConfig{MaxDepth: 10, MaxComplexity: -1}, true},
+		{"no timeout", GraphQLConfig{MaxDepth: 10, MaxComplexity: 1000, Timeout: 0}, false},
+		{"negative timeout", GraphQLConfig{MaxDepth: 10, MaxComplexity: 1000, Timeout: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestListingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ListingConfig
+		hasError bool
+	}{
+		{"default floor", ListingConfig{MinTVL: 1}, false},
+		{"no floor", ListingConfig{MinTVL: 0}, false},
+		{"negative floor", ListingConfig{MinTVL: -1}, true},
+		{"infinite floor", ListingConfig{MinTVL: math.Inf(1)}, true},
+		{"opportunity score floor", ListingConfig{MinTVL: 1, MinOpportunityScore: 40}, false},
+		{"opportunity score above 100", ListingConfig{MinOpportunityScore: 101}, true},
+		{"negative opportunity score", ListingConfig{MinOpportunityScore: -5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestIngestionConfigValidate(t *testing.T) {
+	defaults := IngestionConfig{PublishMode: PublishModeChanged, APYMin: -100, APYMax: 100000}
+
+	tests := []struct {
+		name     string
+		modify   func(c *IngestionConfig)
+		hasError bool
+	}{
+		{"defaults", func(c *IngestionConfig) {}, false},
+		{"all publish mode", func(c *IngestionConfig) { c.PublishMode = PublishModeAll }, false},
+		{"unknown publish mode", func(c *IngestionConfig) { c.PublishMode = "some" }, true},
+		{"negative epsilon", func(c *IngestionConfig) { c.PublishTVLEpsilon = -0.1 }, true},
+		{"narrow APY range", func(c *IngestionConfig) { c.APYMin, c.APYMax = 0, 500 }, false},
+		{"inverted APY range", func(c *IngestionConfig) { c.APYMin, c.APYMax = 100, 0 }, true},
+		{"empty APY range", func(c *IngestionConfig) { c.APYMin, c.APYMax = 0, 0 }, true},
+		{"APY max not storable", func(c *IngestionConfig) { c.APYMax = 1e9 }, true},
+		{"NaN APY min", func(c *IngestionConfig) { c.APYMin = math.NaN() }, true},
+		{"negative history epsilon", func(c *IngestionConfig) { c.HistoryAPYEpsilon = -0.01 }, true},
+		{"negative history heartbeat", func(c *IngestionConfig) { c.HistoryHeartbeat = -time.Minute }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestMonitorConfigValidate(t *testing.T) {
+	defaults := MonitorConfig{Enabled: true, TVLDropPercent: 10, PoolDropPercent: 20, IngestionGap: 15 * time.Minute, ConfirmCycles: 2}
+
+	tests := []struct {
+		name     string
+		modify   func(c *MonitorConfig)
+		hasError bool
+	}{
+		{"defaults", func(c *MonitorConfig) {}, false},
+		{"zero TVL drop", func(c *MonitorConfig) { c.TVLDropPercent = 0 }, true},
+		{"pool drop above 100", func(c *MonitorConfig) { c.PoolDropPercent = 150 }, true},
+		{"NaN TVL drop", func(c *MonitorConfig) { c.TVLDropPercent = math.NaN() }, true},
+		{"gap check off", func(c *MonitorConfig) { c.IngestionGap = 0 }, false},
+		{"negative gap", func(c *MonitorConfig) { c.IngestionGap = -time.Minute }, true},
+		{"no confirming cycle", func(c *MonitorConfig) { c.ConfirmCycles = 0 }, true},
+		{"disabled skips checks", func(c *MonitorConfig) { c.Enabled, c.ConfirmCycles = false, 0 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+	defaults := ScheduleConfig{
+		DeFiLlama: "0 */3 * * * *",
+		CoinGecko: "0 */10 * * * *",
+		Detection: "0 */5 * * * *",
+		APYIndex:  "CRON_TZ=UTC 0 10 0 * * *",
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(c *ScheduleConfig)
+		hasError bool
+	}{
+		{"defaults", func(c *ScheduleConfig) {}, false},
+		{"descriptor", func(c *ScheduleConfig) { c.DeFiLlama = "@every 2m" }, false},
+		{"time zone", func(c *ScheduleConfig) { c.APYIndex = "CRON_TZ=Europe/Berlin 0 0 6 * * *" }, false},
+		{"without seconds", func(c *ScheduleConfig) { c.CoinGecko = "*/10 * * * *" }, true},
+		{"out of range", func(c *ScheduleConfig) { c.Detection = "0 */5 25 * * *" }, true},
+		{"unknown time zone", func(c *ScheduleConfig) { c.APYIndex = "CRON_TZ=Mars/Olympus 0 10 0 * * *" }, true},
+		{"empty", func(c *ScheduleConfig) { c.DeFiLlama = "" }, true},
+		{"startup delays", func(c *ScheduleConfig) {
+			c.DetectionOffset = time.Minute
+			c.StartupDelay = 10 * time.Second
+			c.StartupJitter = 30 * time.Second
+		}, false},
+		{"negative offset", func(c *ScheduleConfig) { c.DetectionOffset = -time.Minute }, true},
+		{"negative jitter", func(c *ScheduleConfig) { c.StartupJitter = -time.Second }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if (err != nil) != tt.hasError {
+				t.Errorf("Expected hasError=%v, got %v", tt.hasError, err)
+			}
+		})
+	}
+}
+
+func TestIntervalSchedule(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{time.Minute, "0 * * * * *"},
+		{3 * time.Minute, "0 */3 * * * *"},
+		{10 * time.Minute, "0 */10 * * * *"},
+		{time.Hour, "0 0 * * * *"},
+		{6 * time.Hour, "0 0 */6 * * *"},
+		{7 * time.Minute, "@every 7m0s"},
+		{90 * time.Second, "@every 1m30s"},
+		{5 * time.Hour, "@every 5h0m0s"},
+		{48 * time.Hour, "@every 48h0m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval.String(), func(t *testing.T) {
+			if got := IntervalSchedule(tt.interval); got != tt.want {
+				t.Errorf("IntervalSchedule(%s) = %q, want %q", tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Schedules(t *testing.T) {
+	t.Run("defaults follow the intervals", func(t *testing.T) {
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		want := ScheduleConfig{
+			DeFiLlama: "0 */3 * * * *",
+			CoinGecko: "0 */10 * * * *",
+			Detection: "0 */5 * * * *",
+			APYIndex:  "CRON_TZ=UTC 0 10 0 * * *",
+
+			DetectionOffset: time.Minute,
+			InitialFetch:    true,
+			DetectDebounce:  10 * time.Second,
+		}
+		if cfg.Schedule != want {
+			t.Errorf("Expected %+v, got %+v", want, cfg.Schedule)
+		}
+	})
+
+	t.Run("interval changes the cadence", func(t *testing.T) {
+		t.Setenv("DEFILLAMA_FETCH_INTERVAL", "1m")
+		t.Setenv("OPPORTUNITY_DETECT_INTERVAL", "7m")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Schedule.DeFiLlama != "0 * * * * *" || cfg.Schedule.Detection != "@every 7m0s" {
+			t.Errorf("Expected schedules from the intervals, got %+v", cfg.Schedule)
+		}
+	})
+
+	t.Run("explicit schedule wins", func(t *testing.T) {
+		t.Setenv("DEFILLAMA_FETCH_INTERVAL", "1m")
+		t.Setenv("WORKER_DEFILLAMA_SCHEDULE", "0 15 * * * *")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Schedule.DeFiLlama != "0 15 * * * *" {
+			t.Errorf("Expected the explicit schedule, got %q", cfg.Schedule.DeFiLlama)
+		}
+	})
+
+	t.Run("startup without initial fetch", func(t *testing.T) {
+		t.Setenv("WORKER_INITIAL_FETCH", "false")
+		t.Setenv("WORKER_STARTUP_JITTER", "45s")
+		t.Setenv("WORKER_DETECTION_OFFSET", "0s")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Schedule.InitialFetch || cfg.Schedule.StartupJitter != 45*time.Second || cfg.Schedule.DetectionOffset != 0 {
+			t.Errorf("Expected the startup settings from the environment, got %+v", cfg.Schedule)
+		}
+	})
+
+	t.Run("detection after fetch", func(t *testing.T) {
+		t.Setenv("WORKER_DETECT_AFTER_FETCH", "true")
+		t.Setenv("WORKER_DETECT_DEBOUNCE", "30s")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !cfg.Schedule.DetectAfterFetch || cfg.Schedule.DetectDebounce != 30*time.Second {
+			t.Errorf("Expected detection after fetch with a 30s debounce, got %+v", cfg.Schedule)
+		}
+	})
+
+	t.Run("negative debounce", func(t *testing.T) {
+		t.Setenv("WORKER_DETECT_DEBOUNCE", "-1s")
+
+		if _, err := Load(); err == nil {
+			t.Error("Expected error for a negative debounce")
+		}
+	})
+
+	t.Run("interval too small", func(t *testing.T) {
+		t.Setenv("COINGECKO_FETCH_INTERVAL", "5s")
+
+		if _, err := Load(); err == nil {
+			t.Error("Expected error for a 5s interval")
+		}
+	})
+}
+
+func TestChainFilter(t *testing.T) {
+	allow := WorkerConfig{Chains: []string{"eth", " Arbitrum", ""}}.ChainFilter()
+	exclude := WorkerConfig{ExcludeChains: []string{"bnb"}}.ChainFilter()
+
+	tests := []struct {
+		name   string
+		filter ChainFilter
+		chain  string
+		want   bool
+	}{
+		{"no filter allows all", ChainFilter{}, "Fantom", true},
+		{"allowed by alias", allow, "Ethereum", true},
+		{"allowed by name", allow, "arbitrum", true},
+		{"not in allowlist", allow, "BSC", false},
+		{"excluded by alias", exclude, "BSC", false},
+		{"not excluded", exclude, "Ethereum", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.chain); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.chain, got, tt.want)
+			}
+		})
+	}
+
+	if (ChainFilter{}).Active() || (WorkerConfig{Chains: []string{""}}).ChainFilter().Active() {
+		t.Error("Expected no filter without chains")
+	}
+	if got, want := allow.Note(), "Only pools on arbitrum, ethereum are ingested"; got != want {
+		t.Errorf("Note() = %q, want %q", got, want)
+	}
+
+	overlap := WorkerConfig{Chains: []string{"mainnet", "arbitrum"}, ExcludeChains: []string{"ethereum"}}
+	if err := overlap.ValidateChains(); err == nil {
+		t.Error("Expected an error for a chain both allowed and excluded")
+	}
+}
+
+func TestLoad_DistributionBuckets(t *testing.T) {
+	t.Run("parsed from env", func(t *testing.T) {
+		t.Setenv("POOL_DISTRIBUTION_SCORE_BUCKETS", "0, 50, 90")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if want := []float64{0, 50, 90}; !reflect.DeepEqual(cfg.Distribution.ScoreBuckets, want) {
+			t.Errorf("Expected score buckets %v, got %v", want, cfg.Distribution.ScoreBuckets)
+		}
+	})
+
+	t.Run("unparseable list falls back to default", func(t *testing.T) {
+		t.Setenv("POOL_DISTRIBUTION_TVL_BUCKETS", "0,1e6,lots")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(cfg.Distribution.TVLBuckets) != 6 {
+			t.Errorf("Expected default TVL buckets, got %v", cfg.Distribution.TVLBuckets)
+		}
+	})
+
+	t.Run("descending buckets rejected", func(t *testing.T) {
+		t.Setenv("POOL_DISTRIBUTION_SCORE_BUCKETS", "0,60,40")
+
+		if _, err := Load(); err == nil {
+			t.Error("Expected error for descending score buckets")
+		}
+	})
+}
@@ -0,0 +1,37 @@
+// Package httputil builds the HTTP clients used to call upstream APIs.
+package httputil
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// NewClient returns an HTTP client with its own transport tuned by cfg.
+// Proxy settings come from the environment as with the default transport.
+func NewClient(cfg config.HTTPClientConfig) *http.Client {
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: NewTransport(cfg),
+	}
+}
+
+// NewTransport returns a transport with cfg's dial, TLS handshake and
+// response header timeouts and idle connection pool. All idle connections
+// may go to one host, since each client calls a single API.
+func NewTransport(cfg config.HTTPClientConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	return transport
+}
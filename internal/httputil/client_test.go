@@ -0,0 +1,33 @@
+package httputil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+func TestNewClient(t *testing.T) {
+	client := NewClient(config.HTTPClientConfig{
+		Timeout:               time.Minute,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          4,
+	})
+
+	if client.Timeout != time.Minute {
+		t.Errorf("Expected a 1m overall timeout, got %s", client.Timeout)
+	}
+
+	transport := NewTransport(config.HTTPClientConfig{ResponseHeaderTimeout: 20 * time.Second, MaxIdleConns: 4})
+	if transport.ResponseHeaderTimeout != 20*time.Second {
+		t.Errorf("Expected a 20s response header timeout, got %s", transport.ResponseHeaderTimeout)
+	}
+	if transport.MaxIdleConns != 4 || transport.MaxIdleConnsPerHost != 4 {
+		t.Errorf("Expected 4 idle connections, all to one host, got %d and %d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.Proxy == nil {
+		t.Error("Expected proxy settings from the environment")
+	}
+}
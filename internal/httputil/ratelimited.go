@@ -0,0 +1,224 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// Defaults of a RateLimitedClient
+const (
+	DefaultMaxAttempts      = 3
+	DefaultBackoff          = time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Minute
+
+	// maxRetryWait caps the wait before a retry, including a Retry-After
+	// given by the API
+	maxRetryWait = time.Minute
+)
+
+// RateLimitedConfig configures a RateLimitedClient. Zero fields take the
+// defaults.
+type RateLimitedConfig struct {
+	Name              string // API name, in errors and logs
+	HTTP              config.HTTPClientConfig
+	RequestsPerMinute int
+	Burst             int           // Requests allowed at once before the rate applies
+	MaxAttempts       int           // Attempts per request, including the first
+	Backoff           time.Duration // Attempt n waits Backoff * n² before the next
+	BreakerThreshold  int           // Consecutive failed requests that open the breaker
+	BreakerCooldown   time.Duration // How long an open breaker fails requests fast
+}
+
+// StatusError is returned when an API kept answering with a retryable
+// status until the attempts ran out
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// RateLimitedClient sends requests to one upstream API. Requests wait for
+// the rate limiter; connection errors, 429 and 5xx responses are retried
+// with backoff, honouring Retry-After; and once requests keep failing a
+// circuit breaker fails them fast for a cooldown. Safe for concurrent use.
+type RateLimitedClient struct {
+	name        string
+	client      *http.Client
+	limiter     *rate.Limiter
+	breaker     *breaker.Breaker
+	maxAttempts int
+	backoff     time.Duration
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateLimitedClient creates a client with its own transport tuned by
+// cfg.HTTP
+func NewRateLimitedClient(cfg RateLimitedConfig) *RateLimitedClient {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+
+	return &RateLimitedClient{
+		name:        cfg.Name,
+		client:      NewClient(cfg.HTTP),
+		limiter:     rate.NewLimiter(rate.Limit(float64(cfg.RequestsPerMinute)/60.0), cfg.Burst),
+		breaker:     breaker.New(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+		sleep:       sleepContext,
+	}
+}
+
+// Do sends req, retrying as needed, and returns the first response that
+// isn't retryable; the caller checks its status and closes its body. It
+// fails fast with breaker.ErrOpen while the breaker is open. A request
+// abandoned by its caller doesn't count against the breaker.
+func (c *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.name, err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil && req.Context().Err() == nil {
+		c.breaker.Failure()
+	} else {
+		c.breaker.Success()
+	}
+	return resp, err
+}
+
+// BreakerState returns the state of the circuit breaker
+func (c *RateLimitedClient) BreakerState() breaker.State {
+	return c.breaker.State()
+}
+
+// do runs the attempts of a request
+func (c *RateLimitedClient) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter error: %w", err)
+		}
+
+		// A body was consumed by the previous attempt
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := c.client.Do(req)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			wait = c.backoffFor(attempt)
+		case retryableStatus(resp.StatusCode):
+			// Rate limited responses without Retry-After wait longer than
+			// errors, since the limit takes a while to reset
+			fallback := c.backoffFor(attempt)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				fallback = 10 * c.backoff * time.Duration(attempt)
+			}
+			wait = retryAfter(resp, fallback)
+			resp.Body.Close()
+			err = &StatusError{StatusCode: resp.StatusCode}
+		default:
+			return resp, nil
+		}
+
+		if attempt >= c.maxAttempts || req.Body != nil && req.GetBody == nil {
+			return nil, fmt.Errorf("%s: failed after %d attempts: %w", c.name, attempt, err)
+		}
+
+		log.Warn().
+			Err(err).
+			Str("api", c.name).
+			Int("attempt", attempt).
+			Dur("retry_in", wait).
+			Msg("Upstream request failed, retrying")
+
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoffFor returns the wait after a failed attempt, growing with the
+// square of the attempt number
+func (c *RateLimitedClient) backoffFor(attempt int) time.Duration {
+	return min(c.backoff*time.Duration(attempt*attempt), maxRetryWait)
+}
+
+// retryableStatus reports whether a response status is worth retrying:
+// rate limiting and server errors
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait the response asks for in Retry-After, in
+// seconds or as a date, capped at maxRetryWait. Without a usable header it
+// returns fallback.
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return fallback
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = max(time.Until(at), 0)
+	} else {
+		return fallback
+	}
+	return min(wait, maxRetryWait)
+}
+
+// sleepContext waits for d unless ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,187 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+)
+
+// newTestClient returns a client without rate limiting whose retry waits
+// are recorded instead of slept
+func newTestClient(cfg RateLimitedConfig) (*RateLimitedClient, *[]time.Duration) {
+	cfg.Name = "test"
+	cfg.RequestsPerMinute = 60_000
+	cfg.Burst = 100
+	c := NewRateLimitedClient(cfg)
+
+	var waits []time.Duration
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return c, &waits
+}
+
+// get sends a GET to url through c, closing the response
+func get(t *testing.T, c *RateLimitedClient, url string) (int, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRateLimitedClient_RetriesThenSucceeds(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, waits := newTestClient(RateLimitedConfig{})
+	status, err := get(t, c, srv.URL)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected 200 on the third attempt, got %d (%v)", status, err)
+	}
+	if want := []time.Duration{time.Second, 4 * time.Second}; len(*waits) != 2 || (*waits)[0] != want[0] || (*waits)[1] != want[1] {
+		t.Errorf("Expected backoff %v, got %v", want, *waits)
+	}
+}
+
+func TestRateLimitedClient_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		expected   time.Duration
+	}{
+		{"seconds", "7", 7 * time.Second},
+		{"capped", "3600", maxRetryWait},
+		{"missing falls back to rate limit backoff", "", 10 * time.Second},
+		{"unparseable falls back", "soon", 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c, waits := newTestClient(RateLimitedConfig{})
+			if status, err := get(t, c, srv.URL); err != nil || status != http.StatusOK {
+				t.Fatalf("Expected 200 after the retry, got %d (%v)", status, err)
+			}
+			if len(*waits) != 1 || (*waits)[0] != tt.expected {
+				t.Errorf("Expected a wait of %s, got %v", tt.expected, *waits)
+			}
+		})
+	}
+}
+
+func TestRateLimitedClient_GivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c, _ := newTestClient(RateLimitedConfig{MaxAttempts: 2})
+	_, err := get(t, c, srv.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected a 502 status error, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRateLimitedClient_ClientErrorsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c, _ := newTestClient(RateLimitedConfig{BreakerThreshold: 1})
+	for i := 0; i < 3; i++ {
+		if status, err := get(t, c, srv.URL); err != nil || status != http.StatusNotFound {
+			t.Fatalf("Expected the 404 returned, got %d (%v)", status, err)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected one attempt per request, got %d", calls.Load())
+	}
+	if c.BreakerState() != breaker.StateClosed {
+		t.Errorf("Expected client errors not to open the breaker, got %s", c.BreakerState())
+	}
+}
+
+func TestRateLimitedClient_BreakerOpens(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c, _ := newTestClient(RateLimitedConfig{MaxAttempts: 1, BreakerThreshold: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := get(t, c, srv.URL); err == nil {
+			t.Fatal("Expected the 500 to fail the request")
+		}
+	}
+
+	if _, err := get(t, c, srv.URL); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("Expected the open breaker to fail fast, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected no request while the breaker is open, got %d", calls.Load())
+	}
+}
+
+func TestRateLimitedClient_CancelledNotFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, _ := newTestClient(RateLimitedConfig{BreakerThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancellation returned, got %v", err)
+	}
+	if c.BreakerState() != breaker.StateClosed {
+		t.Errorf("Expected an abandoned request not to open the breaker, got %s", c.BreakerState())
+	}
+}
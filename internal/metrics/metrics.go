@@ -0,0 +1,346 @@
+// Package metrics collects application gauges and renders them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// CountSource provides the aggregate counts behind the data gauges.
+// Implemented by the PostgreSQL repository.
+type CountSource interface {
+	GetMetricsCounts(ctx context.Context, staleAfter time.Duration) (*models.MetricsCounts, error)
+}
+
+// WorkerSource provides what the worker reports for export: the summary of
+// the last yield gap detection run, the counts of historical data points
+// written and skipped, and of detected opportunities discarded by the caps.
+// Implemented by the Redis repository.
+type WorkerSource interface {
+	GetYieldGapScan(ctx context.Context) (*models.YieldGapScan, error)
+	GetHistoryWrites(ctx context.Context) (*models.HistoryWrites, error)
+	GetDiscardedOpportunities(ctx context.Context) (map[string]int64, error)
+}
+
+// HubStats provides connected WebSocket clients per channel and the
+// opportunity alerts merged per client. Implemented by the WebSocket hub.
+type HubStats interface {
+	ClientsByChannel() map[string]int
+	MergedAlerts() uint64
+}
+
+// Sample is a single gauge value with its labels
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Family is a named metric with its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // "gauge" or "counter"
+	Samples []Sample
+}
+
+// Collector gathers gauges from the repository, the last yield gap scan and
+// the WebSocket hub. Repository counts are cached for the configured TTL so
+// frequent scrapes don't hit the database; the rest is read live.
+type Collector struct {
+	source     CountSource
+	worker     WorkerSource
+	hub        HubStats
+	cacheTTL   time.Duration
+	staleAfter time.Duration
+	now        func() time.Time
+
+	mu             sync.Mutex
+	counts         *models.MetricsCounts
+	fetchedAt      time.Time
+	processSources []func() []Family
+	sharing        *processSharing // nil unless families are shared across processes
+}
+
+// NewCollector creates a new metrics collector. Any source may be nil.
+func NewCollector(cfg config.MetricsConfig, source CountSource, worker WorkerSource, hub HubStats) *Collector {
+	return &Collector{
+		source:     source,
+		worker:     worker,
+		hub:        hub,
+		cacheTTL:   cfg.CacheTTL,
+		staleAfter: cfg.StaleAfter,
+		now:        time.Now,
+	}
+}
+
+// Gather returns the current gauge families. If the counts can't be
+// refreshed the last cached values are reported; if there are none yet the
+// data gauges are omitted.
+func (c *Collector) Gather(ctx context.Context) []Family {
+	var families []Family
+
+	if counts := c.cachedCounts(ctx); counts != nil {
+		families = append(families, countFamilies(counts, c.now())...)
+	}
+
+	if c.worker != nil {
+		scan, err := c.worker.GetYieldGapScan(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read yield gap scan summary")
+		} else if scan != nil {
+			families = append(families, scanFamilies(scan)...)
+		}
+
+		writes, err := c.worker.GetHistoryWrites(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read historical data point counts")
+		} else if writes != nil {
+			families = append(families, historyWriteFamilies(writes)...)
+		}
+
+		discarded, err := c.worker.GetDiscardedOpportunities(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read discarded opportunity counts")
+		} else if discarded != nil {
+			families = append(families, discardedFamilies(discarded)...)
+		}
+	}
+
+	c.mu.Lock()
+	sharing := c.sharing
+	c.mu.Unlock()
+	if sharing != nil {
+		families = append(families, c.sharedProcessFamilies(ctx, sharing)...)
+	} else {
+		families = append(families, c.processFamilies()...)
+	}
+
+	return families
+}
+
+// hubFamilies returns the WebSocket hub's gauges
+func hubFamilies(hub HubStats) []Family {
+	clients := Family{
+		Name: "defi_ws_clients",
+		Help: "Connected WebSocket clients by channel",
+		Type: "gauge",
+	}
+	for channel, n := range hub.ClientsByChannel() {
+		clients.Samples = append(clients.Samples, Sample{
+			Labels: map[string]string{"channel": channel},
+			Value:  float64(n),
+		})
+	}
+	return []Family{clients, {
+		Name:    "defi_ws_alerts_merged_total",
+		Help:    "Opportunity alerts held back and merged with an earlier alert for the same pool",
+		Type:    "counter",
+		Samples: []Sample{{Value: float64(hub.MergedAlerts())}},
+	}}
+}
+
+// cachedCounts returns the repository counts, refreshing them when the cache
+// has expired
+func (c *Collector) cachedCounts(ctx context.Context) *models.MetricsCounts {
+	if c.source == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts != nil && c.now().Sub(c.fetchedAt) < c.cacheTTL {
+		return c.counts
+	}
+
+	counts, err := c.source.GetMetricsCounts(ctx, c.staleAfter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh metrics counts")
+		return c.counts
+	}
+
+	c.counts = counts
+	c.fetchedAt = c.now()
+	return c.counts
+}
+
+// countFamilies converts repository counts into gauge families
+func countFamilies(counts *models.MetricsCounts, now time.Time) []Family {
+	opportunities := Family{
+		Name: "defi_opportunities_active",
+		Help: "Active opportunities by type",
+		Type: "gauge",
+	}
+	for oppType, n := range counts.ActiveOpportunitiesByType {
+		opportunities.Samples = append(opportunities.Samples, Sample{
+			Labels: map[string]string{"type": oppType},
+			Value:  float64(n),
+		})
+	}
+
+	reviewChains := Family{
+		Name: "defi_chain_review_pools",
+		Help: "Pools ingested from chains awaiting security review, by chain",
+		Type: "gauge",
+	}
+	for chain, n := range counts.ReviewChainPools {
+		reviewChains.Samples = append(reviewChains.Samples, Sample{
+			Labels: map[string]string{"chain": chain},
+			Value:  float64(n),
+		})
+	}
+
+	families := []Family{
+		opportunities,
+		reviewChains,
+		{
+			Name:    "defi_pools_total",
+			Help:    "Total number of tracked pools",
+			Type:    "gauge",
+			Samples: []Sample{{Value: float64(counts.TotalPools)}},
+		},
+		{
+			Name:    "defi_pools_stale",
+			Help:    "Pools not updated within the stale threshold",
+			Type:    "gauge",
+			Samples: []Sample{{Value: float64(counts.StalePools)}},
+		},
+		{
+			Name:    "defi_pools_apy_outliers",
+			Help:    "Pools whose reported APY is outside the plausible range",
+			Type:    "gauge",
+			Samples: []Sample{{Value: float64(counts.OutlierPools)}},
+		},
+	}
+
+	// Without any pools there is no meaningful fetch age
+	if !counts.LastFetch.IsZero() {
+		families = append(families, Family{
+			Name:    "defi_last_fetch_age_seconds",
+			Help:    "Seconds since the most recent pool update",
+			Type:    "gauge",
+			Samples: []Sample{{Value: now.Sub(counts.LastFetch).Seconds()}},
+		})
+	}
+
+	return families
+}
+
+// scanFamilies converts a yield gap scan summary into gauge families
+func scanFamilies(scan *models.YieldGapScan) []Family {
+	truncated := 0.0
+	if scan.Truncated {
+		truncated = 1
+	}
+
+	return []Family{
+		{
+			Name:    "defi_yield_gap_pools_considered",
+			Help:    "Pools scanned by the last yield gap detection run",
+			Type:    "gauge",
+			Samples: []Sample{{Value: float64(scan.PoolsConsidered)}},
+		},
+		{
+			Name:    "defi_yield_gap_assets_considered",
+			Help:    "Distinct assets compared by the last yield gap detection run",
+			Type:    "gauge",
+			Samples: []Sample{{Value: float64(scan.AssetsConsidered)}},
+		},
+		{
+			Name:    "defi_yield_gap_truncated",
+			Help:    "1 if the last yield gap scan stopped at YIELD_GAP_MAX_POOLS",
+			Type:    "gauge",
+			Samples: []Sample{{Value: truncated}},
+		},
+	}
+}
+
+// historyWriteFamilies converts the historical data point counts into
+// counter families
+func historyWriteFamilies(writes *models.HistoryWrites) []Family {
+	return []Family{{
+		Name: "defi_history_points_total",
+		Help: "Historical data points recorded by ingestion, or skipped as unchanged since the last recorded one",
+		Type: "counter",
+		Samples: []Sample{
+			{Labels: map[string]string{"result": "written"}, Value: float64(writes.Written)},
+			{Labels: map[string]string{"result": "skipped"}, Value: float64(writes.Skipped)},
+		},
+	}}
+}
+
+// discardedFamilies converts the discarded opportunity counts into a
+// counter family by type
+func discardedFamilies(discarded map[string]int64) []Family {
+	family := Family{
+		Name: "defi_opportunities_discarded_total",
+		Help: "Detected opportunities discarded by OPPORTUNITY_MAX_PER_TYPE and OPPORTUNITY_MAX_PER_RUN, by type",
+		Type: "counter",
+	}
+	for oppType, n := range discarded {
+		family.Samples = append(family.Samples, Sample{Labels: map[string]string{"type": oppType}, Value: float64(n)})
+	}
+	return []Family{family}
+}
+
+// WriteText writes the families in the Prometheus text exposition format.
+// Samples are ordered by label values so output is stable between scrapes.
+func WriteText(w io.Writer, families []Family) error {
+	for _, f := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type); err != nil {
+			return err
+		}
+
+		samples := make([]Sample, len(f.Samples))
+		copy(samples, f.Samples)
+		sort.Slice(samples, func(i, j int) bool {
+			return formatLabels(samples[i].Labels) < formatLabels(samples[j].Labels)
+		})
+
+		for _, s := range samples {
+			if _, err := fmt.Fprintf(w, "%s%s %g\n", f.Name, formatLabels(s.Labels), s.Value); err != nil {
+				return err
+			}
+		}
+
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// labelEscaper escapes label values per the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders labels as {name="value",...}, sorted by name
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(labels[name]))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
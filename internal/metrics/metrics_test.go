@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+type fakeSource struct {
+	counts *models.MetricsCounts
+	err    error
+	calls  int
+}
+
+func (f *fakeSource) GetMetricsCounts(ctx context.Context, staleAfter time.Duration) (*models.MetricsCounts, error) {
+	f.calls++
+	return f.counts, f.err
+}
+
+type fakeWorker struct {
+	scan      *models.YieldGapScan
+	writes    *models.HistoryWrites
+	discarded map[string]int64
+}
+
+func (f fakeWorker) GetYieldGapScan(ctx context.Context) (*models.YieldGapScan, error) {
+	return f.scan, nil
+}
+
+func (f fakeWorker) GetHistoryWrites(ctx context.Context) (*models.HistoryWrites, error) {
+	return f.writes, nil
+}
+
+func (f fakeWorker) GetDiscardedOpportunities(ctx context.Context) (map[string]int64, error) {
+	return f.discarded, nil
+}
+
+type fakeHub struct {
+	clients map[string]int
+	merged  uint64
+}
+
+func (f fakeHub) ClientsByChannel() map[string]int { return f.clients }
+func (f fakeHub) MergedAlerts() uint64             { return f.merged }
+
+func scrape(t *testing.T, c *Collector) string {
+	t.Helper()
+
+	var sb strings.Builder
+	if err := WriteText(&sb, c.Gather(context.Background())); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	return sb.String()
+}
+
+func TestCollector_Scrape(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	source := &fakeSource{counts: &models.MetricsCounts{
+		ActiveOpportunitiesByType: map[string]int{"yield-gap": 12, "trending": 3},
+		TotalPools:                2500,
+		StalePools:                40,
+		OutlierPools:              3,
+		LastFetch:                 now.Add(-90 * time.Second),
+		ReviewChainPools:          map[string]int{"monad": 14},
+	}}
+
+	worker := fakeWorker{
+		scan:      &models.YieldGapScan{PoolsConsidered: 7200, AssetsConsidered: 310, Truncated: true},
+		writes:    &models.HistoryWrites{Written: 1200, Skipped: 48000},
+		discarded: map[string]int64{"high-score": 60},
+	}
+
+	c := NewCollector(config.MetricsConfig{CacheTTL: 30 * time.Second, StaleAfter: time.Hour}, source, worker, fakeHub{clients: map[string]int{"pools": 5, "opportunities": 2}, merged: 4})
+	c.now = func() time.Time { return now }
+
+	output := scrape(t, c)
+
+	patterns := []string{
+		`(?m)^# TYPE defi_opportunities_active gauge$`,
+		`(?m)^defi_opportunities_active\{type="trending"\} 3$`,
+		`(?m)^defi_opportunities_active\{type="yield-gap"\} 12$`,
+		`(?m)^# TYPE defi_pools_total gauge$`,
+		`(?m)^defi_pools_total 2500$`,
+		`(?m)^# TYPE defi_pools_stale gauge$`,
+		`(?m)^defi_pools_stale 40$`,
+		`(?m)^defi_pools_apy_outliers 3$`,
+		`(?m)^# TYPE defi_chain_review_pools gauge$`,
+		`(?m)^defi_chain_review_pools\{chain="monad"\} 14$`,
+		`(?m)^# TYPE defi_ws_clients gauge$`,
+		`(?m)^defi_ws_clients\{channel="opportunities"\} 2$`,
+		`(?m)^defi_ws_clients\{channel="pools"\} 5$`,
+		`(?m)^# TYPE defi_ws_alerts_merged_total counter$`,
+		`(?m)^defi_ws_alerts_merged_total 4$`,
+		`(?m)^# TYPE defi_last_fetch_age_seconds gauge$`,
+		`(?m)^defi_last_fetch_age_seconds 90$`,
+		`(?m)^defi_yield_gap_pools_considered 7200$`,
+		`(?m)^defi_yield_gap_assets_considered 310$`,
+		`(?m)^defi_yield_gap_truncated 1$`,
+		`(?m)^# TYPE defi_history_points_total counter$`,
+		`(?m)^defi_history_points_total\{result="skipped"\} 48000$`,
+		`(?m)^defi_history_points_total\{result="written"\} 1200$`,
+		`(?m)^# TYPE defi_opportunities_discarded_total counter$`,
+		`(?m)^defi_opportunities_discarded_total\{type="high-score"\} 60$`,
+	}
+	for _, pattern := range patterns {
+		if !regexp.MustCompile(pattern).MatchString(output) {
+			t.Errorf("Expected output to match %s, got:\n%s", pattern, output)
+		}
+	}
+}
+
+func TestCollector_CachesCounts(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	source := &fakeSource{counts: &models.MetricsCounts{TotalPools: 10}}
+
+	c := NewCollector(config.MetricsConfig{CacheTTL: 30 * time.Second}, source, nil, nil)
+	c.now = func() time.Time { return now }
+
+	scrape(t, c)
+	scrape(t, c)
+	if source.calls != 1 {
+		t.Errorf("Expected counts to be cached, got %d queries", source.calls)
+	}
+
+	// A failed refresh keeps serving the last known values
+	now = now.Add(time.Minute)
+	source.err = errors.New("connection refused")
+	if output := scrape(t, c); !strings.Contains(output, "defi_pools_total 10\n") {
+		t.Errorf("Expected cached counts after failed refresh, got:\n%s", output)
+	}
+	if source.calls != 2 {
+		t.Errorf("Expected a refresh after the TTL, got %d queries", source.calls)
+	}
+}
+
+func TestWriteText_EscapesLabels(t *testing.T) {
+	var sb strings.Builder
+	err := WriteText(&sb, []Family{{
+		Name:    "defi_test",
+		Help:    "Test gauge",
+		Type:    "gauge",
+		Samples: []Sample{{Labels: map[string]string{"type": "a\"b\\c"}, Value: 1}},
+	}})
+	if err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	if want := `defi_test{type="a\"b\\c"} 1`; !strings.Contains(sb.String(), want) {
+		t.Errorf("Expected %s, got:\n%s", want, sb.String())
+	}
+}
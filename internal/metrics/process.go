@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProcessStore shares the process-local families of the processes of one
+// preforked server, keyed by a group naming the server and the process
+// within it. Implemented by the Redis repository.
+type ProcessStore interface {
+	SetProcessMetrics(ctx context.Context, group, process string, data []byte, ttl time.Duration) error
+	GetProcessMetrics(ctx context.Context, group string) ([][]byte, error)
+}
+
+// processSharing is how a collector shares its process-local families
+type processSharing struct {
+	store    ProcessStore
+	group    string
+	process  string
+	interval time.Duration
+}
+
+// AddProcessSource registers families counted in this process's memory.
+// They are reported along with the WebSocket hub's, and summed across
+// processes once sharing is on.
+func (c *Collector) AddProcessSource(fn func() []Family) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processSources = append(c.processSources, fn)
+}
+
+// ShareProcesses makes Gather report the process-local families summed
+// over every process of the group, as each publishes them through store
+// every interval with RunPublisher. Counters kept in memory would otherwise
+// cover only the child that answered the scrape. A process that stops
+// publishing drops out after three intervals.
+func (c *Collector) ShareProcesses(store ProcessStore, group, process string, interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sharing = &processSharing{store: store, group: group, process: process, interval: interval}
+}
+
+// RunPublisher publishes this process's families every interval until ctx
+// is done. It does nothing unless sharing is on.
+func (c *Collector) RunPublisher(ctx context.Context) {
+	c.mu.Lock()
+	sharing := c.sharing
+	c.mu.Unlock()
+	if sharing == nil {
+		return
+	}
+
+	ticker := time.NewTicker(sharing.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.publish(ctx, sharing); err != nil {
+			log.Warn().Err(err).Msg("Failed to publish process metrics")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish writes this process's families to the store
+func (c *Collector) publish(ctx context.Context, sharing *processSharing) error {
+	data, err := json.Marshal(c.processFamilies())
+	if err != nil {
+		return err
+	}
+	return sharing.store.SetProcessMetrics(ctx, sharing.group, sharing.process, data, 3*sharing.interval)
+}
+
+// sharedProcessFamilies returns the process-local families of every process
+// of the group, summed. If they can't be read this process's own are
+// returned.
+func (c *Collector) sharedProcessFamilies(ctx context.Context, sharing *processSharing) []Family {
+	published, err := sharing.store.GetProcessMetrics(ctx, sharing.group)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read process metrics, reporting this process only")
+		return c.processFamilies()
+	}
+
+	snapshots := make([][]Family, 0, len(published))
+	for _, data := range published {
+		var families []Family
+		if err := json.Unmarshal(data, &families); err != nil {
+			log.Warn().Err(err).Msg("Skipping undecodable process metrics")
+			continue
+		}
+		snapshots = append(snapshots, families)
+	}
+	return Sum(snapshots)
+}
+
+// processFamilies returns the families counted in this process's memory:
+// the WebSocket hub's and those of the registered sources
+func (c *Collector) processFamilies() []Family {
+	var families []Family
+	if c.hub != nil {
+		families = append(families, hubFamilies(c.hub)...)
+	}
+
+	c.mu.Lock()
+	sources := c.processSources
+	c.mu.Unlock()
+	for _, fn := range sources {
+		families = append(families, fn()...)
+	}
+	return families
+}
+
+// Sum merges snapshots of the same families from several processes, adding
+// up the values of samples with the same labels. Families are ordered by
+// name.
+func Sum(snapshots [][]Family) []Family {
+	byName := make(map[string]*Family)
+	values := make(map[string]map[string]*Sample)
+
+	for _, families := range snapshots {
+		for _, f := range families {
+			merged, ok := byName[f.Name]
+			if !ok {
+				merged = &Family{Name: f.Name, Help: f.Help, Type: f.Type}
+				byName[f.Name] = merged
+				values[f.Name] = make(map[string]*Sample)
+			}
+			for _, s := range f.Samples {
+				key := formatLabels(s.Labels)
+				if sum, ok := values[f.Name][key]; ok {
+					sum.Value += s.Value
+					continue
+				}
+				values[f.Name][key] = &Sample{Labels: s.Labels, Value: s.Value}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make([]Family, 0, len(names))
+	for _, name := range names {
+		f := byName[name]
+		for _, s := range values[name] {
+			f.Samples = append(f.Samples, *s)
+		}
+		families = append(families, *f)
+	}
+	return families
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// fakeProcessStore keeps published process metrics in memory
+type fakeProcessStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (f *fakeProcessStore) SetProcessMetrics(ctx context.Context, group, process string, data []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[group+":"+process] = data
+	return nil
+}
+
+func (f *fakeProcessStore) GetProcessMetrics(ctx context.Context, group string) ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var published [][]byte
+	for key, data := range f.data {
+		if strings.HasPrefix(key, group+":") {
+			published = append(published, data)
+		}
+	}
+	return published, nil
+}
+
+// counterSource reports a fixed cache counter, as a process's handler does
+func counterSource(value float64) func() []Family {
+	return func() []Family {
+		return []Family{{
+			Name:    "defi_cache_negative_hits_total",
+			Help:    "Pool lookups answered 404 from a not-found tombstone",
+			Type:    "counter",
+			Samples: []Sample{{Value: value}},
+		}}
+	}
+}
+
+func TestCollector_SharesProcesses(t *testing.T) {
+	store := &fakeProcessStore{data: make(map[string][]byte)}
+
+	// The parent holds the hub; the children count cache hits
+	parent := NewCollector(config.MetricsConfig{}, nil, nil, fakeHub{clients: map[string]int{"pools": 3}, merged: 2})
+	children := []*Collector{
+		NewCollector(config.MetricsConfig{}, nil, nil, nil),
+		NewCollector(config.MetricsConfig{}, nil, nil, nil),
+	}
+	children[0].AddProcessSource(counterSource(5))
+	children[1].AddProcessSource(counterSource(7))
+
+	for i, c := range append([]*Collector{parent}, children...) {
+		c.ShareProcesses(store, "host:100", string(rune('a'+i)), time.Minute)
+		if err := c.publish(context.Background(), c.sharing); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+	// Another server sharing Redis is left out
+	store.data["host:200:x"] = store.data["host:100:b"]
+
+	output := scrape(t, children[0])
+	for _, want := range []string{
+		"defi_cache_negative_hits_total 12\n",
+		`defi_ws_clients{channel="pools"} 3` + "\n",
+		"defi_ws_alerts_merged_total 2\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q summed across processes, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	families := Sum([][]Family{
+		{{Name: "b", Type: "counter", Samples: []Sample{{Labels: map[string]string{"lookup": "pool"}, Value: 1}}}},
+		{{Name: "b", Type: "counter", Samples: []Sample{
+			{Labels: map[string]string{"lookup": "pool"}, Value: 2},
+			{Labels: map[string]string{"lookup": "stats"}, Value: 4},
+		}}, {Name: "a", Type: "gauge", Samples: []Sample{{Value: 1}}}},
+	})
+
+	var sb strings.Builder
+	if err := WriteText(&sb, families); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := "# HELP a \n# TYPE a gauge\na 1\n\n# HELP b \n# TYPE b counter\nb{lookup=\"pool\"} 3\nb{lookup=\"stats\"} 4\n\n"
+	if sb.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, sb.String())
+	}
+}
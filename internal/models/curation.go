@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// Reward schedules of a curated pool
+const (
+	RewardScheduleLocked     = "locked"     // Emissions follow a schedule nobody can change
+	RewardScheduleAdjustable = "adjustable" // Emissions can be changed or switched off at will, e.g. by a multisig
+	RewardScheduleUnknown    = "unknown"    // Not known how emissions are controlled
+)
+
+// RewardSchedules are the valid reward schedules of a curated pool
+var RewardSchedules = map[string]bool{
+	RewardScheduleLocked:     true,
+	RewardScheduleAdjustable: true,
+	RewardScheduleUnknown:    true,
+}
+
+// MaxCurationNotesLength is the longest curation note accepted
+const MaxCurationNotesLength = 1000
+
+// PoolCuration holds attributes of a pool that no data source reports, set
+// through the admin API. They are stored apart from the pool, so
+// re-ingesting it never overwrites them.
+type PoolCuration struct {
+	RewardSchedule string    `json:"rewardSchedule" db:"reward_schedule"` // locked, adjustable or unknown
+	Audited        bool      `json:"audited" db:"audited"`
+	Notes          string    `json:"notes,omitempty" db:"notes"`
+	CuratedAt      time.Time `json:"curatedAt" db:"curated_at"` // Last time the attributes were set
+}
+
+// Curation flags, the compact form of a pool's curation in pool lists
+const (
+	CurationFlagCurated           = "curated"            // The pool has curated attributes
+	CurationFlagAudited           = "audited"            // The pool was audited
+	CurationFlagRewardsLocked     = "rewards-locked"     // Reward emissions follow a locked schedule
+	CurationFlagRewardsAdjustable = "rewards-adjustable" // Reward emissions can be changed at will
+)
+
+// Flags returns the compact form of the curation
+func (c *PoolCuration) Flags() []string {
+	flags := []string{CurationFlagCurated}
+	if c.Audited {
+		flags = append(flags, CurationFlagAudited)
+	}
+	switch c.RewardSchedule {
+	case RewardScheduleLocked:
+		flags = append(flags, CurationFlagRewardsLocked)
+	case RewardScheduleAdjustable:
+		flags = append(flags, CurationFlagRewardsAdjustable)
+	}
+	return flags
+}
+
+// CompactCuration replaces the curation of each pool with its flags, the
+// form pool lists carry. Notes are left to the pool detail.
+func CompactCuration(pools []Pool) {
+	for i := range pools {
+		if pools[i].Curation == nil {
+			continue
+		}
+		pools[i].CurationFlags = pools[i].Curation.Flags()
+		pools[i].Curation = nil
+	}
+}
+
+// ApplyCuration sets the curation of each pool from curations, keyed by
+// pool ID. Pools without one are left uncurated.
+func ApplyCuration(pools []Pool, curations map[string]PoolCuration) {
+	for i := range pools {
+		if curation, ok := curations[pools[i].ID]; ok {
+			pools[i].Curation = &curation
+		} else {
+			pools[i].Curation = nil
+		}
+	}
+}
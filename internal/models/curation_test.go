@@ -0,0 +1,30 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompactCuration(t *testing.T) {
+	pools := []Pool{
+		{ID: "plain"},
+		{ID: "adjustable", Curation: &PoolCuration{RewardSchedule: RewardScheduleAdjustable, Audited: true, Notes: "multisig"}},
+		{ID: "unknown", Curation: &PoolCuration{RewardSchedule: RewardScheduleUnknown}},
+	}
+
+	CompactCuration(pools)
+
+	want := [][]string{
+		nil,
+		{CurationFlagCurated, CurationFlagAudited, CurationFlagRewardsAdjustable},
+		{CurationFlagCurated},
+	}
+	for i, pool := range pools {
+		if pool.Curation != nil {
+			t.Errorf("%s: expected the curation replaced by flags, got %+v", pool.ID, pool.Curation)
+		}
+		if !reflect.DeepEqual(pool.CurationFlags, want[i]) {
+			t.Errorf("%s: expected flags %v, got %v", pool.ID, want[i], pool.CurationFlags)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// APYIndex is a benchmark index, e.g. an Ethereum stablecoin yield index: the
+// TVL-weighted average APY of the pools matching its filters, computed once
+// a day. Empty filters match every pool.
+type APYIndex struct {
+	Name        string         `json:"name" db:"name"`
+	Description string         `json:"description,omitempty" db:"description"`
+	Chain       string         `json:"chain,omitempty" db:"chain"`
+	Protocol    string         `json:"protocol,omitempty" db:"protocol"`
+	StableCoin  *bool          `json:"stablecoin,omitempty" db:"stablecoin"`
+	Asset       string         `json:"asset,omitempty" db:"asset"` // A whole token of the pool symbol, e.g. USDC
+	CreatedAt   time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+	Latest      *APYIndexValue `json:"latest,omitempty"` // Most recent daily value, if any
+}
+
+// APYIndexValue is an index's value for one UTC day. Pools with no TVL carry
+// no weight and are not counted as constituents.
+type APYIndexValue struct {
+	Day          time.Time       `json:"day" db:"day"`
+	APY          decimal.Decimal `json:"apy" db:"apy"`
+	TVL          decimal.Decimal `json:"tvl" db:"tvl"`
+	Constituents int             `json:"constituents" db:"constituents"`
+}
+
+// APYIndexListResponse is the API response for listing indices
+type APYIndexListResponse struct {
+	Data  []APYIndex `json:"data"`
+	Total int        `json:"total"`
+}
+
+// APYIndexHistoryResponse is the API response for an index's daily values,
+// oldest first
+type APYIndexHistoryResponse struct {
+	Index      string          `json:"index"`
+	Days       int             `json:"days"`
+	DataPoints []APYIndexValue `json:"dataPoints"`
+}
+
+// APYIndexMatcher tests pools against an index's filters
+type APYIndexMatcher struct {
+	index APYIndex
+	asset *regexp.Regexp
+}
+
+// NewAPYIndexMatcher prepares the filters of index for matching
+func NewAPYIndexMatcher(index APYIndex) APYIndexMatcher {
+	m := APYIndexMatcher{index: index}
+	if index.Asset != "" {
+		m.asset = regexp.MustCompile(SymbolTokenPattern(index.Asset))
+	}
+	return m
+}
+
+// Matches reports whether pool belongs to the index. Chain and protocol
+// compare case-insensitively; the asset must be a whole token of the symbol.
+func (m APYIndexMatcher) Matches(pool Pool) bool {
+	switch {
+	case m.index.Chain != "" && !strings.EqualFold(pool.Chain, m.index.Chain):
+		return false
+	case m.index.Protocol != "" && !strings.EqualFold(pool.Protocol, m.index.Protocol):
+		return false
+	case m.index.StableCoin != nil && pool.StableCoin != *m.index.StableCoin:
+		return false
+	case m.asset != nil && !m.asset.MatchString(strings.ToLower(pool.Symbol)):
+		return false
+	}
+	return true
+}
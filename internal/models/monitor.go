@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Platform anomaly kinds, as alerted and listed in DataStatus.Reasons
+const (
+	AnomalyTVLDrop       = "tvl_drop"        // Total tracked TVL fell sharply in one fetch
+	AnomalyPoolCountDrop = "pool_count_drop" // The number of pools fell sharply in one fetch
+	AnomalyIngestionGap  = "ingestion_gap"   // No fetch succeeded for too long
+)
+
+// PlatformTotals are the platform-wide totals of one pools fetch, over the
+// pools it ingested
+type PlatformTotals struct {
+	TotalTVL  float64   `json:"totalTvl"`
+	PoolCount int       `json:"poolCount"`
+	At        time.Time `json:"at"`
+}
+
+// MonitorState is what the platform monitor keeps between fetches
+type MonitorState struct {
+	// Baseline is the last fetch without an anomaly, which later fetches
+	// are compared with. An alerted drop becomes the new baseline.
+	Baseline *PlatformTotals `json:"baseline,omitempty"`
+
+	LastSuccess time.Time      `json:"lastSuccess"`        // Last fetch that ingested pools
+	Breaches    map[string]int `json:"breaches,omitempty"` // Fetches in a row showing each anomaly
+}
+
+// DataStatus tells API clients whether the latest data looks wrong
+type DataStatus struct {
+	Suspect   bool       `json:"suspect"`
+	Reasons   []string   `json:"reasons,omitempty"` // Anomaly kinds seen in the latest fetch
+	Since     *time.Time `json:"since,omitempty"`   // When the data turned suspect
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// PlatformAlert is an operator alert on a platform-wide anomaly, raised
+// once it was seen in enough fetches in a row
+type PlatformAlert struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+
+	// Drops compare the baseline with the current fetch, in dollars or
+	// pools, and give the percent change
+	Previous float64 `json:"previous,omitempty"`
+	Current  float64 `json:"current,omitempty"`
+	Change   float64 `json:"change,omitempty"`
+
+	LastSuccess time.Time `json:"lastSuccess"` // Last fetch that ingested pools
+	Cycles      int       `json:"cycles"`      // Fetches in a row that showed the anomaly
+	DetectedAt  time.Time `json:"detectedAt"`
+}
@@ -1,9 +1,12 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
 )
 
 // OpportunityType defines the type of yield opportunity
@@ -27,6 +30,22 @@ const (
 	RiskLevelHigh   RiskLevel = "high"
 )
 
+// Reasons an opportunity was deactivated before it expired
+const (
+	StatusReasonPoolStale   = "pool_stale"   // A referenced pool stopped receiving updates
+	StatusReasonPoolDeleted = "pool_deleted" // A referenced pool no longer exists
+)
+
+// OutcomeClass says how an expired opportunity turned out
+type OutcomeClass string
+
+const (
+	OutcomeConfirmed OutcomeClass = "confirmed" // The edge held up
+	OutcomeFaded     OutcomeClass = "faded"     // Part of the edge held up
+	OutcomeReversed  OutcomeClass = "reversed"  // The edge vanished or flipped
+	OutcomeUnknown   OutcomeClass = "unknown"   // Too little history to tell
+)
+
 // Opportunity represents a detected yield farming opportunity
 type Opportunity struct {
 	ID               string           `json:"id" db:"id"`
@@ -52,6 +71,8 @@ type Opportunity struct {
 	CurrentAPY       decimal.Decimal  `json:"currentApy" db:"current_apy"`
 	PotentialProfit  decimal.Decimal  `json:"potentialProfit" db:"potential_profit"` // Estimated profit in %
 	TVL              decimal.Decimal  `json:"tvl" db:"tvl"`                         // Combined or single pool TVL
+	Costs            *OpportunityCosts `json:"costs,omitempty" db:"costs"`          // Cost breakdown (yield-gap only)
+	ProfitByHorizon  []HorizonProfit  `json:"profitByHorizon,omitempty" db:"profit_by_horizon"` // Profit per holding period (yield-gap only)
 
 	// Risk assessment
 	RiskLevel        RiskLevel        `json:"riskLevel" db:"risk_level"`
@@ -59,15 +80,122 @@ type Opportunity struct {
 
 	// Status
 	IsActive         bool             `json:"isActive" db:"is_active"`
+	StatusReason     string           `json:"statusReason,omitempty" db:"status_reason"` // Why it was deactivated early
 	DetectedAt       time.Time        `json:"detectedAt" db:"detected_at"`
+	DetectedAgo      string           `json:"detectedAgo,omitempty" db:"-"`         // DetectedAt relative to when the response was served ("5 minutes ago")
 	LastSeenAt       time.Time        `json:"lastSeenAt" db:"last_seen_at"`
 	ExpiresAt        time.Time        `json:"expiresAt" db:"expires_at"`
 
+	// Realized outcome, recorded after the opportunity expires (yield-gap
+	// and trending only)
+	RealizedAPYDiff  *decimal.Decimal `json:"realizedApyDiff,omitempty" db:"realized_apy_diff"`
+	OutcomeClass     OutcomeClass     `json:"outcomeClass,omitempty" db:"outcome_class"`
+
 	// Metadata
 	CreatedAt        time.Time        `json:"createdAt" db:"created_at"`
 	UpdatedAt        time.Time        `json:"updatedAt" db:"updated_at"`
 }
 
+// SetRelativeTimes fills DetectedAgo, and UpdatedAgo of the pools attached,
+// as of now. Handlers call it as a response is served, so a cached
+// opportunity never shows a stale value.
+func (o *Opportunity) SetRelativeTimes() {
+	if !o.DetectedAt.IsZero() {
+		o.DetectedAgo = utils.TimeAgo(o.DetectedAt)
+	}
+	for _, pool := range []*Pool{o.SourcePool, o.TargetPool, o.Pool} {
+		if pool != nil {
+			pool.SetRelativeTimes()
+		}
+	}
+}
+
+// SetRelativeTimes fills the relative times of every opportunity in the
+// response
+func (r *PoolOpportunitiesResponse) SetRelativeTimes() {
+	for _, group := range [][]Opportunity{r.AsSource, r.AsTarget, r.Direct} {
+		for i := range group {
+			group[i].SetRelativeTimes()
+		}
+	}
+}
+
+// OpportunityCosts breaks down the estimated cost of moving a position between
+// the source and target pools of a yield-gap opportunity. All values are in USD
+// for a position of PositionSizeUSD.
+type OpportunityCosts struct {
+	PositionSizeUSD decimal.Decimal `json:"positionSizeUsd"`      // Position size the estimate assumes
+	WithdrawGasUSD  decimal.Decimal `json:"withdrawGasUsd"`       // Gas to withdraw from the source pool
+	BridgeFeeUSD    decimal.Decimal `json:"bridgeFeeUsd"`         // Bridge fee (cross-chain moves only)
+	DepositGasUSD   decimal.Decimal `json:"depositGasUsd"`        // Gas to deposit into the target pool
+	SlippageUSD     decimal.Decimal `json:"slippageUsd"`          // Estimated slippage entering the target pool
+	TotalUSD        decimal.Decimal `json:"totalUsd"`             // Sum of all cost components
+	CrossChain      bool            `json:"crossChain"`           // Source and target are on different chains
+	BridgeCost      *BridgeCost     `json:"bridgeCost,omitempty"` // Route assumed for the bridge fee (cross-chain moves only)
+}
+
+// HorizonProfit is the estimated profit of a yield-gap opportunity if the
+// position is held for Days: the APY difference earned over the days not
+// spent bridging, less the costs of moving. Short horizons can be negative.
+type HorizonProfit struct {
+	Days      int             `json:"days"`
+	ProfitUSD decimal.Decimal `json:"profitUsd"` // For a position of Costs.PositionSizeUSD
+}
+
+// BridgeCost is the bridge route a cross-chain cost estimate assumes. The
+// delay is time the position earns nothing, so it shortens the earning
+// window of the profit estimate.
+type BridgeCost struct {
+	SourceChain  string          `json:"sourceChain"`
+	TargetChain  string          `json:"targetChain"`
+	FlatFeeUSD   decimal.Decimal `json:"flatFeeUsd"`
+	FeePercent   decimal.Decimal `json:"feePercent"` // Percent of the position
+	DelayHours   decimal.Decimal `json:"delayHours"`
+	DefaultRoute bool            `json:"defaultRoute"` // Route not configured; the conservative default was assumed
+}
+
+// OpportunityOutcome is the realized outcome of an expired opportunity.
+// For yield gaps RealizedAPYDiff is the average APY difference between the
+// target and source pools over the opportunity's lifetime; for trending
+// pools it is the APY change in the 24h after detection.
+type OpportunityOutcome struct {
+	OpportunityID   string
+	RealizedAPYDiff *decimal.Decimal // Nil without enough history
+	Class           OutcomeClass
+}
+
+// APYWindow selects a pool's APY history between two times
+type APYWindow struct {
+	PoolID string
+	From   time.Time
+	To     time.Time
+}
+
+// APYPoint is one historical APY reading
+type APYPoint struct {
+	Timestamp time.Time
+	APY       decimal.Decimal
+}
+
+// OpportunityAccuracy counts the outcomes of one opportunity type.
+// ConfirmedRate is the share of classified outcomes that were confirmed,
+// leaving out those with too little history.
+type OpportunityAccuracy struct {
+	Type          OpportunityType `json:"type"`
+	Confirmed     int             `json:"confirmed"`
+	Faded         int             `json:"faded"`
+	Reversed      int             `json:"reversed"`
+	Unknown       int             `json:"unknown"`
+	ConfirmedRate decimal.Decimal `json:"confirmedRate"` // 0-1
+}
+
+// OpportunityAccuracyResponse is the API response for the detector
+// accuracy report
+type OpportunityAccuracyResponse struct {
+	Data  []OpportunityAccuracy `json:"data"`
+	Since time.Time             `json:"since"`
+}
+
 // OpportunityFilter defines filtering options for opportunity queries
 type OpportunityFilter struct {
 	Type        OpportunityType `query:"type"`
@@ -81,6 +209,52 @@ type OpportunityFilter struct {
 	SortOrder   string          `query:"sortOrder"`   // asc, desc
 	Limit       int             `query:"limit"`
 	Offset      int             `query:"offset"`
+
+	// Only opportunities whose pool, the target of a yield gap, currently
+	// has sustainable yield by the configured thresholds
+	SustainableOnly bool             `query:"sustainableOnly"`
+	Sustainability  SustainableYield `query:"-"`
+
+	// Opportunities detected in [DetectedAfter, DetectedBefore); a zero
+	// bound is open
+	DetectedAfter  time.Time `query:"detectedAfter"`
+	DetectedBefore time.Time `query:"detectedBefore"`
+}
+
+// Opportunity listings are bounded in time so sorting never covers the whole
+// history: without detectedAfter a listing covers DefaultOpportunityLookback,
+// and detectedAfter can't reach back further than MaxOpportunityLookback
+const (
+	DefaultOpportunityLookback = 7 * 24 * time.Hour
+	MaxOpportunityLookback     = 90 * 24 * time.Hour
+)
+
+// Errors of OpportunityFilter.BoundDetectedAt
+var (
+	ErrLookbackTooLong    = errors.New("must be within the last 90 days")
+	ErrEmptyDetectedRange = errors.New("must be after detectedAfter")
+)
+
+// BoundDetectedAt applies the look-back limits at now. Without DetectedAfter,
+// it is set DefaultOpportunityLookback before DetectedBefore, or before now
+// truncated to the minute so listings share cache entries. It returns
+// ErrLookbackTooLong if DetectedAfter is older than MaxOpportunityLookback
+// and ErrEmptyDetectedRange if DetectedBefore isn't after it.
+func (f *OpportunityFilter) BoundDetectedAt(now time.Time) error {
+	if f.DetectedAfter.IsZero() {
+		end := now.UTC().Truncate(time.Minute)
+		if !f.DetectedBefore.IsZero() && f.DetectedBefore.Before(end) {
+			end = f.DetectedBefore
+		}
+		f.DetectedAfter = end.Add(-DefaultOpportunityLookback)
+	}
+	if f.DetectedAfter.Before(now.Add(-MaxOpportunityLookback)) {
+		return ErrLookbackTooLong
+	}
+	if !f.DetectedBefore.IsZero() && !f.DetectedBefore.After(f.DetectedAfter) {
+		return ErrEmptyDetectedRange
+	}
+	return nil
 }
 
 // OpportunityListResponse is the API response for listing opportunities
@@ -90,6 +264,76 @@ type OpportunityListResponse struct {
 	Limit   int           `json:"limit"`
 	Offset  int           `json:"offset"`
 	HasMore bool          `json:"hasMore"`
+
+	// Time bounds the listing covers, defaults included
+	DetectedAfter  time.Time  `json:"detectedAfter"`
+	DetectedBefore *time.Time `json:"detectedBefore,omitempty"`
+}
+
+// PoolOpportunitiesResponse lists the active opportunities involving one
+// pool, grouped by the role the pool plays in each
+type PoolOpportunitiesResponse struct {
+	PoolID   string        `json:"poolId"`
+	AsSource []Opportunity `json:"asSource"` // Yield gaps moving funds out of the pool
+	AsTarget []Opportunity `json:"asTarget"` // Yield gaps moving funds into the pool
+	Direct   []Opportunity `json:"direct"`   // Trending and high-score opportunities on the pool itself
+}
+
+// NewPoolOpportunitiesResponse groups opportunities by the role poolID plays
+// in them. Order within each group is preserved.
+func NewPoolOpportunitiesResponse(poolID string, opportunities []Opportunity) PoolOpportunitiesResponse {
+	response := PoolOpportunitiesResponse{
+		PoolID:   poolID,
+		AsSource: make([]Opportunity, 0),
+		AsTarget: make([]Opportunity, 0),
+		Direct:   make([]Opportunity, 0),
+	}
+
+	for _, opp := range opportunities {
+		switch poolID {
+		case opp.SourcePoolID:
+			response.AsSource = append(response.AsSource, opp)
+		case opp.TargetPoolID:
+			response.AsTarget = append(response.AsTarget, opp)
+		case opp.PoolID:
+			response.Direct = append(response.Direct, opp)
+		}
+	}
+
+	return response
+}
+
+// DetectionThresholdOverrides replaces some of the live detection
+// thresholds for a dry run. Omitted fields keep their live values.
+type DetectionThresholdOverrides struct {
+	MinTVL            *float64 `json:"minTvl,omitempty"`            // USD; yield-gap and high-score
+	YieldGapMinProfit *float64 `json:"yieldGapMinProfit,omitempty"` // APY percentage points
+	APYJumpThreshold  *float64 `json:"apyJumpThreshold,omitempty"`  // 24h APY growth %; trending
+	MinScore          *float64 `json:"minScore,omitempty"`          // 0-100; high-score
+}
+
+// DetectionThresholds are the thresholds a dry run detected with
+type DetectionThresholds struct {
+	MinTVL            float64 `json:"minTvl"`
+	YieldGapMinProfit float64 `json:"yieldGapMinProfit"`
+	APYJumpThreshold  float64 `json:"apyJumpThreshold"`
+	MinScore          float64 `json:"minScore"`
+}
+
+// DetectionDryRunReport compares what detection would find with the given
+// thresholds against the opportunities currently active. Opportunities are
+// matched by type and pool, since every detection run assigns new IDs.
+type DetectionDryRunReport struct {
+	Thresholds   DetectionThresholds `json:"thresholds"`
+	Detected     int                 `json:"detected"`  // Opportunities the dry run found
+	Active       int                 `json:"active"`    // Opportunities currently active
+	Added        int                 `json:"added"`     // Found but not active
+	Removed      int                 `json:"removed"`   // Active but no longer found
+	Changed      int                 `json:"changed"`   // Found and active with a different APY, profit, score or risk level
+	Unchanged    int                 `json:"unchanged"` // Found and active as-is
+	TopNew       []Opportunity       `json:"topNew"`    // Up to 20 added opportunities, highest score first
+	YieldGapScan YieldGapScan        `json:"yieldGapScan"`
+	GeneratedAt  time.Time           `json:"generatedAt"`
 }
 
 // TrendingPool represents a pool with significant APY growth
@@ -110,3 +354,15 @@ type YieldGap struct {
 	PotentialProfit decimal.Decimal `json:"potentialProfit"`
 	Chains          []string        `json:"chains"`
 }
+
+// OpportunityRetraction announces that an active opportunity was withdrawn
+// before it expired, so subscribers can drop it
+type OpportunityRetraction struct {
+	OpportunityID string          `json:"opportunityId"`
+	Type          OpportunityType `json:"type"`
+	SourcePoolID  string          `json:"sourcePoolId,omitempty"`
+	TargetPoolID  string          `json:"targetPoolId,omitempty"`
+	PoolID        string          `json:"poolId,omitempty"`
+	Reason        string          `json:"reason"`
+	RetractedAt   time.Time       `json:"retractedAt"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewPoolOpportunitiesResponse(t *testing.T) {
+	opps := []Opportunity{
+		{ID: "gap-out", SourcePoolID: "pool-a", TargetPoolID: "pool-b"},
+		{ID: "trending", PoolID: "pool-a"},
+		{ID: "gap-in", SourcePoolID: "pool-c", TargetPoolID: "pool-a"},
+		{ID: "gap-out-2", SourcePoolID: "pool-a", TargetPoolID: "pool-d"},
+	}
+
+	got := NewPoolOpportunitiesResponse("pool-a", opps)
+
+	ids := func(opps []Opportunity) []string {
+		out := make([]string, len(opps))
+		for i, opp := range opps {
+			out[i] = opp.ID
+		}
+		return out
+	}
+	if s := ids(got.AsSource); len(s) != 2 || s[0] != "gap-out" || s[1] != "gap-out-2" {
+		t.Errorf("Expected [gap-out gap-out-2] as source, got %v", s)
+	}
+	if s := ids(got.AsTarget); len(s) != 1 || s[0] != "gap-in" {
+		t.Errorf("Expected [gap-in] as target, got %v", s)
+	}
+	if s := ids(got.Direct); len(s) != 1 || s[0] != "trending" {
+		t.Errorf("Expected [trending] direct, got %v", s)
+	}
+
+	// A pool without opportunities gets empty groups, not nulls
+	empty := NewPoolOpportunitiesResponse("pool-z", nil)
+	if empty.AsSource == nil || empty.AsTarget == nil || empty.Direct == nil {
+		t.Errorf("Expected empty groups, got %+v", empty)
+	}
+}
+
+func TestOpportunityFilter_BoundDetectedAt(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 30, 45, 0, time.UTC)
+	minute := now.Truncate(time.Minute)
+
+	tests := []struct {
+		name          string
+		after, before time.Time
+		wantAfter     time.Time
+		wantErr       error
+	}{
+		{"default look-back", time.Time{}, time.Time{}, minute.Add(-DefaultOpportunityLookback), nil},
+		{"look-back from detectedBefore", time.Time{}, now.Add(-30 * 24 * time.Hour), now.Add(-37 * 24 * time.Hour), nil},
+		{"detectedBefore in the future", time.Time{}, now.Add(time.Hour), minute.Add(-DefaultOpportunityLookback), nil},
+		{"explicit detectedAfter", now.Add(-60 * 24 * time.Hour), time.Time{}, now.Add(-60 * 24 * time.Hour), nil},
+		{"at the maximum look-back", now.Add(-MaxOpportunityLookback), time.Time{}, now.Add(-MaxOpportunityLookback), nil},
+		{"past the maximum look-back", now.Add(-MaxOpportunityLookback - time.Second), time.Time{}, time.Time{}, ErrLookbackTooLong},
+		{"default past the maximum", time.Time{}, now.Add(-85 * 24 * time.Hour), time.Time{}, ErrLookbackTooLong},
+		{"empty range", now.Add(-time.Hour), now.Add(-time.Hour), time.Time{}, ErrEmptyDetectedRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := OpportunityFilter{DetectedAfter: tt.after, DetectedBefore: tt.before}
+			err := filter.BoundDetectedAt(now)
+			if err != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !filter.DetectedAfter.Equal(tt.wantAfter) {
+				t.Errorf("Expected detectedAfter %s, got %s", tt.wantAfter, filter.DetectedAfter)
+			}
+			if !filter.DetectedBefore.Equal(tt.before) {
+				t.Errorf("Expected detectedBefore to be kept, got %s", filter.DetectedBefore)
+			}
+		})
+	}
+}
+
+func TestOpportunitySetRelativeTimes(t *testing.T) {
+	now := time.Now()
+	opp := Opportunity{
+		DetectedAt: now.Add(-5*time.Minute - 10*time.Second),
+		SourcePool: &Pool{UpdatedAt: now.Add(-3*time.Hour - time.Minute)},
+		TargetPool: &Pool{UpdatedAt: now.Add(-2*24*time.Hour - time.Hour)},
+	}
+	opp.SetRelativeTimes()
+
+	if opp.DetectedAgo != "5 minutes ago" {
+		t.Errorf("Expected detectedAgo 5 minutes ago, got %q", opp.DetectedAgo)
+	}
+	if opp.SourcePool.UpdatedAgo != "3 hours ago" || opp.TargetPool.UpdatedAgo != "2 days ago" {
+		t.Errorf("Expected the attached pools' updatedAgo, got %q and %q", opp.SourcePool.UpdatedAgo, opp.TargetPool.UpdatedAgo)
+	}
+
+	// Without a timestamp there is nothing to be relative to
+	var empty Opportunity
+	empty.SetRelativeTimes()
+	if empty.DetectedAgo != "" {
+		t.Errorf("Expected no detectedAgo without detectedAt, got %q", empty.DetectedAgo)
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+// Page size limits shared by the REST and GraphQL APIs
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+	MaxPageOffset    = 10000
+
+	// Trending detection reads a larger window (TRENDING_FETCH_LIMIT) in one
+	// query; API clients page through it
+	DefaultTrendingLimit = 20
+	MaxTrendingLimit     = 50
+)
+
+// ClampLimit returns limit capped at max, or def when limit is below 1
+func ClampLimit(limit, def, max int) int {
+	if limit < 1 {
+		return def
+	}
+	return min(limit, max)
+}
+
+// ClampOffset returns offset limited to [0, MaxPageOffset]
+func ClampOffset(offset int) int {
+	return max(0, min(offset, MaxPageOffset))
+}
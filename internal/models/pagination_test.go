@@ -0,0 +1,25 @@
+package models
+
+import "testing"
+
+func TestClampLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"unset", 0, DefaultPageLimit},
+		{"negative", -5, DefaultPageLimit},
+		{"within", 20, 20},
+		{"at max", MaxPageLimit, MaxPageLimit},
+		{"oversized", 100000, MaxPageLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClampLimit(tt.limit, DefaultPageLimit, MaxPageLimit); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,9 +2,15 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
 )
 
 // Pool represents a DeFi yield farming pool
@@ -14,7 +20,8 @@ type Pool struct {
 	Protocol        string          `json:"protocol" db:"protocol"`                 // Protocol name (aave-v3, compound, curve, etc.)
 	Symbol          string          `json:"symbol" db:"symbol"`                     // Pool symbol/name (USDC, ETH-USDC, etc.)
 	TVL             decimal.Decimal `json:"tvl" db:"tvl"`                           // Total Value Locked in USD
-	APY             decimal.Decimal `json:"apy" db:"apy"`                           // Current Annual Percentage Yield
+	APY             decimal.Decimal `json:"apy" db:"apy"`                           // Current Annual Percentage Yield, clamped to the plausible range
+	APYRaw          decimal.Decimal `json:"apyRaw" db:"apy_raw"`                    // APY as reported by the source, before clamping
 	APYBase         decimal.Decimal `json:"apyBase" db:"apy_base"`                  // Base APY (from lending/trading fees)
 	APYReward       decimal.Decimal `json:"apyReward" db:"apy_reward"`              // Reward APY (from token incentives)
 	RewardTokens    []string        `json:"rewardTokens" db:"reward_tokens"`        // Tokens given as rewards
@@ -30,34 +37,305 @@ type Pool struct {
 	APYChange1H     decimal.Decimal `json:"apyChange1h" db:"apy_change_1h"`         // APY change in last hour
 	APYChange24H    decimal.Decimal `json:"apyChange24h" db:"apy_change_24h"`       // APY change in last 24 hours
 	APYChange7D     decimal.Decimal `json:"apyChange7d" db:"apy_change_7d"`         // APY change in last 7 days
+	VolumeTVLRatio  decimal.Decimal `json:"volumeTvlRatio" db:"-"`                  // 24h volume divided by TVL
+	BaseRatio       decimal.Decimal `json:"baseRatio" db:"-"`                       // Share (0-1) of APY from base yield rather than reward emissions
+	DataCompleteness decimal.Decimal `json:"dataCompleteness" db:"data_completeness"` // Fraction (0-1) of expected data fields present
+	IsOutlier       bool            `json:"isOutlier" db:"is_outlier"`              // Reported APY outside the plausible range; left out of rankings
 
 	// Metadata
 	StableCoin      bool            `json:"stablecoin" db:"stablecoin"`             // Is this a stablecoin pool?
 	Exposure        string          `json:"exposure" db:"exposure"`                 // Exposure type (single, multi, etc.)
+	DataSource      string          `json:"dataSource" db:"data_source"`            // Origin of the pool data (defillama, manual)
+	Tags            []string        `json:"tags" db:"tags"`                         // Categories (lending, dex-lp, liquid-staking, rwa, ...)
+	MatchQuality    string          `json:"matchQuality,omitempty" db:"-"`          // How the symbol matched a symbol or search query (exact, partial, fuzzy)
+	Curation        *PoolCuration   `json:"curation,omitempty" db:"-"`              // Attributes set through the admin API, in pool detail
+	CurationFlags   []string        `json:"curationFlags,omitempty" db:"-"`         // Compact form of Curation, in pool lists
 
 	// Timestamps
 	CreatedAt       time.Time       `json:"createdAt" db:"created_at"`
 	UpdatedAt       time.Time       `json:"updatedAt" db:"updated_at"`
+	UpdatedAgo      string          `json:"updatedAgo,omitempty" db:"-"`            // UpdatedAt relative to when the response was served ("5 minutes ago")
+}
+
+// SetRelativeTimes fills UpdatedAgo from UpdatedAt as of now. Handlers call
+// it as a response is served, so a cached pool never shows a stale value.
+func (p *Pool) SetRelativeTimes() {
+	if !p.UpdatedAt.IsZero() {
+		p.UpdatedAgo = utils.TimeAgo(p.UpdatedAt)
+	}
+}
+
+// IsStale reports whether the pool went without updates since staleBefore.
+// Manual pools are only updated when imported again, so they never go stale.
+func (p *Pool) IsStale(staleBefore time.Time) bool {
+	return p.DataSource != DataSourceManual && p.UpdatedAt.Before(staleBefore)
+}
+
+// CalculateVolumeTVLRatio returns 24h volume divided by TVL. Pools without
+// TVL or volume have a ratio of zero.
+func CalculateVolumeTVLRatio(volume1D, tvl decimal.Decimal) decimal.Decimal {
+	if !tvl.IsPositive() || !volume1D.IsPositive() {
+		return decimal.Zero
+	}
+	return volume1D.DivRound(tvl, 6)
+}
+
+// CalculateRewardRatio returns the share (0-1) of APY that comes from token
+// rewards. Pools without a positive APY have a ratio of zero.
+func CalculateRewardRatio(apyReward, apy decimal.Decimal) decimal.Decimal {
+	if !apy.IsPositive() || !apyReward.IsPositive() {
+		return decimal.Zero
+	}
+	return decimal.Min(apyReward.DivRound(apy, 6), decimal.NewFromInt(1))
+}
+
+// CalculateBaseRatio returns the share (0-1) of APY that comes from base
+// yield, fees and interest, rather than token rewards. Pools without a
+// positive APY or base APY have a ratio of zero.
+func CalculateBaseRatio(apyBase, apy decimal.Decimal) decimal.Decimal {
+	if !apy.IsPositive() || !apyBase.IsPositive() {
+		return decimal.Zero
+	}
+	return decimal.Min(apyBase.DivRound(apy, 6), decimal.NewFromInt(1))
+}
+
+// SustainableYield decides which pools' yield is durable: mostly base yield
+// rather than reward emissions, which end or lose value
+type SustainableYield struct {
+	MinBaseRatio decimal.Decimal // Least share of APY from base yield
+	MinBaseAPY   decimal.Decimal // Base APY that is sustainable on its own, whatever the share (0 = off)
+}
+
+// Allows reports whether a pool's yield is sustainable
+func (s SustainableYield) Allows(pool *Pool) bool {
+	if pool.APY.IsPositive() && CalculateBaseRatio(pool.APYBase, pool.APY).GreaterThanOrEqual(s.MinBaseRatio) {
+		return true
+	}
+	return s.MinBaseAPY.IsPositive() && pool.APYBase.GreaterThanOrEqual(s.MinBaseAPY)
 }
 
+// CalculateDataCompleteness returns the fraction (0-1) of the fields used in
+// scoring that the pool actually has. Missing values arrive as zero, so zero
+// counts as absent. TVL, APY and the 30-day mean are expected of every pool;
+// impermanent loss and trading volume only of multi-asset (LP) pools.
+func CalculateDataCompleteness(p *Pool) decimal.Decimal {
+	expected := []decimal.Decimal{p.TVL, p.APY, p.APYMean30D}
+	if p.Exposure == "multi" {
+		expected = append(expected, p.IL7D, p.VolumeUSD1D, p.VolumeUSD7D)
+	}
+
+	present := 0
+	for _, v := range expected {
+		if !v.IsZero() {
+			present++
+		}
+	}
+
+	return decimal.NewFromInt(int64(present)).DivRound(decimal.NewFromInt(int64(len(expected))), 4)
+}
+
+// Pool data sources
+const (
+	DataSourceDeFiLlama = "defillama" // Fetched by the worker from DeFiLlama
+	DataSourceManual    = "manual"    // Imported through the admin API
+)
+
 // PoolFilter defines filtering options for pool queries
 type PoolFilter struct {
 	Chain       string          `query:"chain"`       // Filter by blockchain
 	Protocol    string          `query:"protocol"`    // Filter by protocol
 	Symbol      string          `query:"symbol"`      // Filter by symbol (partial match)
 	Search      string          `query:"search"`      // Search across symbol, protocol, chain
+	Exact       bool            `query:"exact"`       // Match symbol and search terms without fuzziness
 	MinAPY      decimal.Decimal `query:"minApy"`      // Minimum APY threshold
 	MaxAPY      decimal.Decimal `query:"maxApy"`      // Maximum APY threshold
 	MinTVL      decimal.Decimal `query:"minTvl"`      // Minimum TVL threshold
 	MaxTVL      decimal.Decimal `query:"maxTvl"`      // Maximum TVL threshold
 	MinScore    decimal.Decimal `query:"minScore"`    // Minimum score threshold
+	MinVolume1D decimal.Decimal `query:"minVolume1d"` // Minimum 24h trading volume in USD
+	MinVolumeTVLRatio decimal.Decimal `query:"minVolumeTvlRatio"` // Minimum 24h volume / TVL ratio
+	MaxRewardRatio decimal.Decimal `query:"-"`                    // Maximum share of APY from rewards (PostgreSQL only)
 	StableCoin  *bool           `query:"stablecoin"`  // Filter stablecoin pools
-	SortBy      string          `query:"sortBy"`      // Sort field (apy, tvl, score)
-	SortOrder   string          `query:"sortOrder"`   // Sort direction (asc, desc)
+	DataSource  string          `query:"dataSource"`  // Filter by data source (defillama, manual)
+	IncludeOutliers bool        `query:"includeOutliers"` // Include pools with implausible APYs, left out by default
+	IncludeEmpty    bool        `query:"includeEmpty"`    // Include pools below the listing TVL floor, left out by default
+	TVLFloor        decimal.Decimal `query:"-"`           // Listing TVL floor applied unless IncludeEmpty (0 = none)
+	SustainableOnly bool        `query:"sustainableOnly"` // Only pools whose yield is mostly base yield
+	Sustainability  SustainableYield `query:"-"`          // Thresholds of SustainableOnly, from the configuration
+	Sparkline       bool        `query:"sparkline"`       // Attach the hourly APY of the last 24h of each listed pool
+	Tags        []string        `query:"-"`           // Pools carrying every one of these tags
+	Curated     *bool           `query:"curated"`     // Filter pools with curated attributes (PostgreSQL only)
+	Audited     *bool           `query:"audited"`     // Filter pools curated as audited (PostgreSQL only)
+	SortBy      string          `query:"sortBy"`      // Primary sort field (apy, tvl, score, ...)
+	SortOrder   string          `query:"sortOrder"`   // Primary sort direction (asc, desc)
+	Sort        []SortKey       `query:"-"`           // Every sort key in order; SortBy/SortOrder when empty
+	RankMode    string          `query:"rankMode"`    // Ranking mode for score sorts (standard, decayed)
+	DecayScale  time.Duration   `query:"-"`           // Freshness decay scale used by decayed ranking
 	Limit       int             `query:"limit"`       // Pagination limit
 	Offset      int             `query:"offset"`      // Pagination offset
 }
 
+// Rank modes for score-sorted pool queries
+const (
+	RankModeStandard = "standard" // Order by stored score
+	RankModeDecayed  = "decayed"  // Order by score decayed by time since last update
+)
+
+// MaxSortKeys is the most keys a sort spec may have
+const MaxSortKeys = 3
+
+// SortRelevance sorts pools by how well their symbol matches the symbol or
+// search query: exact matches first, then partial, then fuzzy
+const SortRelevance = "relevance"
+
+// PoolSortFields are the fields pools can be sorted by
+var PoolSortFields = map[string]bool{
+	"relevance":  true,
+	"apy":        true,
+	"tvl":        true,
+	"score":      true,
+	"updated_at": true,
+	"chain":      true,
+	"protocol":   true,
+	"stablecoin": true,
+}
+
+// SortKey is one key of a multi-key sort
+type SortKey struct {
+	Field string `json:"field"`
+	Order string `json:"order"` // asc or desc
+}
+
+// SortKeys returns the filter's sort keys, falling back to the single key
+// given by SortBy and SortOrder
+func (f PoolFilter) SortKeys() []SortKey {
+	if len(f.Sort) > 0 {
+		return f.Sort
+	}
+	return []SortKey{{Field: f.SortBy, Order: f.SortOrder}}
+}
+
+// MatchQuery returns the text pool symbols are matched against for
+// relevance: the symbol filter, or the search query without one
+func (f PoolFilter) MatchQuery() string {
+	if f.Symbol != "" {
+		return f.Symbol
+	}
+	return f.Search
+}
+
+// FiltersCuration reports whether the filter selects pools by their
+// curation, which only PostgreSQL can answer
+func (f PoolFilter) FiltersCuration() bool {
+	return f.Curated != nil || f.Audited != nil
+}
+
+// SortsByRelevance reports whether any sort key is relevance
+func (f PoolFilter) SortsByRelevance() bool {
+	for _, key := range f.SortKeys() {
+		if key.Field == SortRelevance {
+			return true
+		}
+	}
+	return false
+}
+
+// Symbol match qualities, best first
+const (
+	MatchQualityExact   = "exact"   // The symbol is the query, ignoring case
+	MatchQualityPartial = "partial" // The query is a whole token of the symbol, e.g. USDC in USDC-ETH
+	MatchQualityFuzzy   = "fuzzy"   // Anything else the backend matched: near spellings, substrings, other fields
+)
+
+// SymbolTokenPattern returns a regular expression matching symbols that
+// contain query, lowercased, as a whole token. Tokens are separated by
+// anything but letters, digits and dots, so USDC.e is a token of its own.
+// The pattern is valid for both Go and PostgreSQL.
+func SymbolTokenPattern(query string) string {
+	return `(^|[^a-z0-9.])` + regexp.QuoteMeta(strings.ToLower(query)) + `($|[^a-z0-9.])`
+}
+
+// SymbolMatchQuality rates how well a pool symbol matches a query
+func SymbolMatchQuality(symbol, query string) string {
+	return matchQuality(symbol, strings.ToLower(query), regexp.MustCompile(SymbolTokenPattern(query)))
+}
+
+// matchQuality rates symbol against a lowercased query and its token pattern
+func matchQuality(symbol, query string, token *regexp.Regexp) string {
+	symbol = strings.ToLower(symbol)
+	switch {
+	case symbol == query:
+		return MatchQualityExact
+	case token.MatchString(symbol):
+		return MatchQualityPartial
+	default:
+		return MatchQualityFuzzy
+	}
+}
+
+// SetMatchQuality rates each pool's symbol against query. Nothing is set
+// without a query.
+func SetMatchQuality(pools []Pool, query string) {
+	if query == "" {
+		return
+	}
+
+	lower := strings.ToLower(query)
+	token := regexp.MustCompile(SymbolTokenPattern(query))
+	for i := range pools {
+		pools[i].MatchQuality = matchQuality(pools[i].Symbol, lower, token)
+	}
+}
+
+// SetHitMatchQuality is SetMatchQuality for the pools of search hits
+func SetHitMatchQuality(hits []PoolSearchHit, query string) {
+	if query == "" {
+		return
+	}
+
+	lower := strings.ToLower(query)
+	token := regexp.MustCompile(SymbolTokenPattern(query))
+	for i := range hits {
+		hits[i].MatchQuality = matchQuality(hits[i].Symbol, lower, token)
+	}
+}
+
+// ParseSortSpec parses a comma-separated sort spec such as
+// "chain:asc,score:desc". Keys without a direction use defaultOrder. Fields
+// must be in allowed, may not repeat, and at most MaxSortKeys are accepted.
+func ParseSortSpec(spec, defaultOrder string, allowed map[string]bool) ([]SortKey, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) > MaxSortKeys {
+		return nil, fmt.Errorf("at most %d sort keys are allowed", MaxSortKeys)
+	}
+
+	keys := make([]SortKey, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		field, order, hasOrder := strings.Cut(strings.TrimSpace(part), ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		order = strings.ToLower(strings.TrimSpace(order))
+		if !hasOrder {
+			order = defaultOrder
+		}
+
+		if !allowed[field] {
+			return nil, fmt.Errorf("invalid sort field %q", field)
+		}
+		if order != "asc" && order != "desc" {
+			return nil, fmt.Errorf("sort direction for %s must be 'asc' or 'desc'", field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("duplicate sort field %q", field)
+		}
+		seen[field] = true
+
+		keys = append(keys, SortKey{Field: field, Order: order})
+	}
+
+	return keys, nil
+}
+
 // PoolListResponse is the API response for listing pools
 type PoolListResponse struct {
 	Data       []Pool `json:"data"`
@@ -65,6 +343,54 @@ type PoolListResponse struct {
 	Limit      int    `json:"limit"`
 	Offset     int    `json:"offset"`
 	HasMore    bool   `json:"hasMore"`
+	Sparklines map[string][]float64 `json:"sparklines,omitempty"` // Hourly APY of each listed pool by ID, oldest first, with sparkline=true
+}
+
+// PoolSearchHit is a pool found by a general search, with the fragments of
+// the fields that matched it
+type PoolSearchHit struct {
+	Pool
+	Highlights map[string][]string `json:"highlights,omitempty"` // Matched fragments by field (symbol, protocol, poolMeta)
+}
+
+// PoolSearchResponse is the API response for listing pools with a general
+// search
+type PoolSearchResponse struct {
+	Data    []PoolSearchHit `json:"data"`
+	Total   int64           `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	HasMore bool            `json:"hasMore"`
+	Sparklines map[string][]float64 `json:"sparklines,omitempty"` // As in PoolListResponse
+}
+
+// SparklinePoints is the number of hourly APY points in a pool sparkline,
+// the last of them for the hour in progress
+const SparklinePoints = 24
+
+// MinSparklinePoints is the fewest points a sparkline is drawn from. Pools
+// with less history get an empty sparkline.
+const MinSparklinePoints = 2
+
+// SparklineSince returns the start of the first hour of the sparklines
+// drawn at now
+func SparklineSince(now time.Time) time.Time {
+	return now.Truncate(time.Hour).Add(-(SparklinePoints - 1) * time.Hour)
+}
+
+// AlignSparklines returns the sparkline of each pool by ID from the hourly
+// points read for them. Pools with fewer than MinSparklinePoints points get
+// an empty one, so every listed pool has an entry.
+func AlignSparklines(ids []string, points map[string][]float64) map[string][]float64 {
+	sparklines := make(map[string][]float64, len(ids))
+	for _, id := range ids {
+		line := points[id]
+		if len(line) < MinSparklinePoints {
+			line = []float64{}
+		}
+		sparklines[id] = line
+	}
+	return sparklines
 }
 
 // HistoricalAPY represents a historical APY data point
@@ -75,16 +401,278 @@ type HistoricalAPY struct {
 	TVL       decimal.Decimal `json:"tvl" db:"tvl"`
 	APYBase   decimal.Decimal `json:"apyBase" db:"apy_base"`
 	APYReward decimal.Decimal `json:"apyReward" db:"apy_reward"`
+	Filled    bool            `json:"filled,omitempty"` // Carried forward into a bucket without data points
 }
 
 // PoolHistoryRequest defines the time range for historical data
 type PoolHistoryRequest struct {
-	Period string `query:"period"` // 1h, 24h, 7d, 30d
+	Period   string `query:"period"` // 1h, 24h, 7d, 30d
+	Bucket   string `query:"bucket"` // 1m, 5m, 1h, 6h, 1d; defaults by period
+	Timezone string `query:"tz"`     // IANA name buckets are aligned in; UTC by default
+}
+
+// historyPeriods are the durations of the pool history periods
+var historyPeriods = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// HistoryBuckets are the bucket widths pool history can be aggregated by
+var HistoryBuckets = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"6h": 6 * time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// DefaultHistoryBucket returns the bucket width used for a history period
+// when none is asked for, defaulting to that of 24h
+func DefaultHistoryBucket(period string) string {
+	switch period {
+	case "1h":
+		return "1m"
+	case "7d":
+		return "1h"
+	case "30d":
+		return "6h"
+	default:
+		return "5m"
+	}
+}
+
+// HistoryBucketStart returns the start of the bucket containing t. Buckets
+// follow the wall clock in loc from local midnight, so daily buckets start
+// at midnight and 6h buckets at 00:00, 06:00, 12:00 and 18:00 local time
+// even on days that are 23 or 25 hours long.
+func HistoryBucketStart(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	width := HistoryBuckets[bucket]
+	if width <= 0 || width >= 24*time.Hour {
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	step := int(width / time.Minute)
+	return time.Date(year, month, day, 0, minutes/step*step, 0, 0, loc)
+}
+
+// Pool history fill modes, for buckets without data points. Ingestion skips
+// points that didn't change, so quiet pools have empty buckets between
+// HISTORY_HEARTBEAT points.
+const (
+	HistoryFillNone     = "none"     // Empty buckets are left out
+	HistoryFillPrevious = "previous" // Empty buckets repeat the last bucket before them
+)
+
+// ForwardFillHistory returns fn wrapped to carry each bucket forward into
+// the empty buckets before the next one, marked Filled. Buckets must be
+// passed oldest first; gaps before the first and after the last bucket are
+// left empty.
+func ForwardFillHistory(bucket string, loc *time.Location, fn func(HistoricalAPY) error) func(HistoricalAPY) error {
+	var last *HistoricalAPY
+	return func(h HistoricalAPY) error {
+		if last != nil {
+			for t := nextHistoryBucket(last.Timestamp, bucket, loc); t.Before(h.Timestamp); t = nextHistoryBucket(t, bucket, loc) {
+				filled := *last
+				filled.Timestamp = t
+				filled.Filled = true
+				if err := fn(filled); err != nil {
+					return err
+				}
+			}
+		}
+		last = &h
+		return fn(h)
+	}
+}
+
+// nextHistoryBucket returns the start of the bucket after the one starting
+// at t, stepping the wall clock in loc like HistoryBucketStart
+func nextHistoryBucket(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	width := HistoryBuckets[bucket]
+	var next time.Time
+	if width >= 24*time.Hour {
+		next = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	} else {
+		next = time.Date(year, month, day, 0, t.Hour()*60+t.Minute()+int(width/time.Minute), 0, 0, loc)
+	}
+
+	// A repeated wall clock hour mustn't step back
+	if !next.After(t) {
+		next = t.Add(max(width, time.Minute))
+	}
+	return next
+}
+
+// HistoryWindowStart returns when the history of period ending at now
+// starts: the start of the bucket the period reaches back into, so the
+// first bucket is complete. Unknown periods cover 24h.
+func HistoryWindowStart(now time.Time, period, bucket string, loc *time.Location) time.Time {
+	length, ok := historyPeriods[period]
+	if !ok {
+		length = historyPeriods["24h"]
+	}
+	return HistoryBucketStart(now.Add(-length), bucket, loc)
+}
+
+// FieldChange is a numeric field's value in the previous and current
+// ingestion cycles
+type FieldChange struct {
+	Previous decimal.Decimal `json:"previous"`
+	Current  decimal.Decimal `json:"current"`
+	Delta    decimal.Decimal `json:"delta"` // Current - Previous, exact
+}
+
+// PoolChanges lists the fields of a pool that differ from the previous
+// ingestion cycle. Unchanged fields are omitted.
+type PoolChanges struct {
+	APY   *FieldChange `json:"apy,omitempty"`
+	TVL   *FieldChange `json:"tvl,omitempty"`
+	Score *FieldChange `json:"score,omitempty"`
+}
+
+// PoolUpdate is a pool as published to WebSocket subscribers. It encodes as
+// the pool's own fields plus changes, so a consumer decoding a Pool simply
+// ignores the summary.
+type PoolUpdate struct {
+	Pool
+	Changes *PoolChanges `json:"changes,omitempty"` // Nil when there is no previous cycle to compare with
+}
+
+// PoolUpdateBatch is the response to a long poll for pool updates. Updates
+// are pool_update messages as sent over WebSocket. Gap is set when updates
+// after the cursor are no longer buffered (or the server restarted): the
+// client should refetch pools over REST and poll on from Cursor.
+type PoolUpdateBatch struct {
+	Updates []json.RawMessage `json:"updates"`
+	Cursor  uint64            `json:"cursor"` // Pass as since in the next poll
+	Gap     bool              `json:"gap"`
+}
+
+// DiffPool returns the changes in APY, TVL and score from prev to cur
+func DiffPool(prev, cur Pool) PoolChanges {
+	return PoolChanges{
+		APY:   diffField(prev.APY, cur.APY),
+		TVL:   diffField(prev.TVL, cur.TVL),
+		Score: diffField(prev.Score, cur.Score),
+	}
+}
+
+// diffField returns the change from prev to cur, or nil if they are equal
+func diffField(prev, cur decimal.Decimal) *FieldChange {
+	if prev.Equal(cur) {
+		return nil
+	}
+	return &FieldChange{Previous: prev, Current: cur, Delta: cur.Sub(prev)}
 }
 
 // PoolHistoryResponse is the API response for pool history
 type PoolHistoryResponse struct {
 	PoolID    string          `json:"poolId"`
 	Period    string          `json:"period"`
+	Bucket    string          `json:"bucket"`   // Bucket width the data points are averaged over
+	Timezone  string          `json:"timezone"` // Time zone buckets are aligned in
+	Fill      string          `json:"fill"`     // How buckets without data points are filled
 	DataPoints []HistoricalAPY `json:"dataPoints"`
 }
+
+// PoolHistoryStreamMeta is the last line of a pool history streamed as
+// NDJSON, after one line per data point. It is sent as {"meta": {...}}.
+type PoolHistoryStreamMeta struct {
+	PoolID    string `json:"poolId"`
+	Period    string `json:"period"`
+	Bucket    string `json:"bucket"`
+	Timezone  string `json:"timezone"`
+	Fill      string `json:"fill"`
+	Count     int    `json:"count"`           // Data points streamed
+	Truncated bool   `json:"truncated"`       // More data points exist past the row cap
+	Error     string `json:"error,omitempty"` // Set when the stream ended early on a failure
+}
+
+// Risk indicators that raise a pool's risk level
+const (
+	RiskFactorAPYAbove100      = "apy_above_100"
+	RiskFactorAPYAbove500      = "apy_above_500"
+	RiskFactorTVLBelow100K     = "tvl_below_100k"
+	RiskFactorTVLBelow10K      = "tvl_below_10k"
+	RiskFactorScoreBelow30     = "score_below_30"
+	RiskFactorLowChainRating   = "chain_rating_below_60"
+	RiskFactorChainNeedsReview = "chain_needs_review"
+	RiskFactorAdjustableReward = "adjustable_reward_above_20" // Reward APY above 20% on emissions that can be switched off
+)
+
+// RiskFactors is the breakdown behind a computed risk level
+type RiskFactors struct {
+	APY         float64  `json:"apy"`
+	TVL         float64  `json:"tvl"`
+	Score       float64  `json:"score"`
+	ChainRating float64  `json:"chainRating"`
+	Triggered   []string `json:"triggered"` // Risk indicators that applied, see RiskFactor*
+	Audited     bool     `json:"audited,omitempty"` // Curated as audited, which takes one more indicator to rate high
+}
+
+// RiskTransition records a change in a pool's risk level
+type RiskTransition struct {
+	ID             int64       `json:"id" db:"id"`
+	PoolID         string      `json:"poolId" db:"pool_id"`
+	FromLevel      RiskLevel   `json:"fromLevel" db:"from_level"`
+	ToLevel        RiskLevel   `json:"toLevel" db:"to_level"`
+	Factors        RiskFactors `json:"factors" db:"factors"` // Factors that produced ToLevel
+	TransitionedAt time.Time   `json:"transitionedAt" db:"transitioned_at"`
+}
+
+// PoolRiskHistoryResponse is the API response for a pool's risk transitions
+type PoolRiskHistoryResponse struct {
+	PoolID      string           `json:"poolId"`
+	Transitions []RiskTransition `json:"transitions"` // Newest first
+}
+
+// PoolImportRecord is a single pool row in a manual import upload
+type PoolImportRecord struct {
+	ID               string           `json:"id"`
+	Chain            string           `json:"chain"`
+	Protocol         string           `json:"protocol"`
+	Symbol           string           `json:"symbol"`
+	TVL              *decimal.Decimal `json:"tvl"`
+	APY              *decimal.Decimal `json:"apy"`
+	APYBase          decimal.Decimal  `json:"apyBase"`
+	APYReward        decimal.Decimal  `json:"apyReward"`
+	RewardTokens     []string         `json:"rewardTokens"`
+	UnderlyingTokens []string         `json:"underlyingTokens"`
+	PoolMeta         string           `json:"poolMeta"`
+	IL7D             decimal.Decimal  `json:"il7d"`
+	APYMean30D       decimal.Decimal  `json:"apyMean30d"`
+	VolumeUSD1D      decimal.Decimal  `json:"volumeUsd1d"`
+	VolumeUSD7D      decimal.Decimal  `json:"volumeUsd7d"`
+	StableCoin       bool             `json:"stablecoin"`
+	Exposure         string           `json:"exposure"`
+}
+
+// Pool import row statuses
+const (
+	ImportStatusAccepted = "accepted"
+	ImportStatusRejected = "rejected"
+)
+
+// PoolImportResult reports the outcome of importing a single row
+type PoolImportResult struct {
+	Row     int      `json:"row"`               // 1-based row number in the upload
+	ID      string   `json:"id,omitempty"`      // Pool ID, if present
+	Status  string   `json:"status"`            // accepted or rejected
+	Reasons []string `json:"reasons,omitempty"` // Why the row was rejected
+}
+
+// PoolImportResponse is the API response for a pool import
+type PoolImportResponse struct {
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+	Results  []PoolImportResult `json:"results"`
+}
@@ -0,0 +1,442 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCalculateVolumeTVLRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		volume   float64
+		tvl      float64
+		expected string
+	}{
+		{"normal pool", 250000, 1000000, "0.25"},
+		{"volume above tvl", 3000000, 1000000, "3"},
+		{"zero tvl", 50000, 0, "0"},
+		{"negative tvl", 50000, -10, "0"},
+		{"zero volume", 0, 1000000, "0"},
+		{"zero volume and tvl", 0, 0, "0"},
+		{"rounded to 6 places", 1, 3, "0.333333"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio := CalculateVolumeTVLRatio(decimal.NewFromFloat(tt.volume), decimal.NewFromFloat(tt.tvl))
+			if !ratio.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected ratio %s, got %s", tt.expected, ratio)
+			}
+		})
+	}
+}
+
+func TestCalculateDataCompleteness(t *testing.T) {
+	full := Pool{
+		TVL:         decimal.NewFromFloat(1000000),
+		APY:         decimal.NewFromFloat(12),
+		APYMean30D:  decimal.NewFromFloat(11),
+		IL7D:        decimal.NewFromFloat(0.3),
+		VolumeUSD1D: decimal.NewFromFloat(200000),
+		VolumeUSD7D: decimal.NewFromFloat(1400000),
+	}
+
+	lending := full
+	lending.IL7D, lending.VolumeUSD1D, lending.VolumeUSD7D = decimal.Zero, decimal.Zero, decimal.Zero
+
+	lendingNoMean := lending
+	lendingNoMean.APYMean30D = decimal.Zero
+
+	lp := full
+	lp.Exposure = "multi"
+
+	lpNoIL := lp
+	lpNoIL.IL7D = decimal.Zero
+
+	lpSparse := lpNoIL
+	lpSparse.VolumeUSD1D, lpSparse.VolumeUSD7D, lpSparse.APYMean30D = decimal.Zero, decimal.Zero, decimal.Zero
+
+	tests := []struct {
+		name     string
+		pool     Pool
+		expected string
+	}{
+		{"single asset with all fields", lending, "1"},
+		{"single asset without 30d mean", lendingNoMean, "0.6667"},
+		{"lp with all fields", lp, "1"},
+		{"lp without il", lpNoIL, "0.8333"},
+		{"lp with only tvl and apy", lpSparse, "0.3333"},
+		{"empty pool", Pool{}, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completeness := CalculateDataCompleteness(&tt.pool)
+			if !completeness.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected completeness %s, got %s", tt.expected, completeness)
+			}
+		})
+	}
+}
+
+func TestCalculateRewardRatio(t *testing.T) {
+	tests := []struct {
+		name      string
+		apyReward float64
+		apy       float64
+		expected  string
+	}{
+		{"no rewards", 0, 5, "0"},
+		{"mostly rewards", 45, 50, "0.9"},
+		{"all rewards", 12, 12, "1"},
+		{"reward above total is capped", 15, 12, "1"},
+		{"zero apy", 3, 0, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio := CalculateRewardRatio(decimal.NewFromFloat(tt.apyReward), decimal.NewFromFloat(tt.apy))
+			if !ratio.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected ratio %s, got %s", tt.expected, ratio)
+			}
+		})
+	}
+}
+
+func TestCalculateBaseRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		apyBase  float64
+		apy      float64
+		expected string
+	}{
+		{"all base", 5, 5, "1"},
+		{"mixed", 3, 12, "0.25"},
+		{"zero base", 0, 40, "0"},
+		{"zero total", 3, 0, "0"},
+		{"base above total is capped", 15, 12, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio := CalculateBaseRatio(decimal.NewFromFloat(tt.apyBase), decimal.NewFromFloat(tt.apy))
+			if !ratio.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected ratio %s, got %s", tt.expected, ratio)
+			}
+		})
+	}
+}
+
+func TestSustainableYieldAllows(t *testing.T) {
+	tests := []struct {
+		name       string
+		minRatio   float64
+		minBaseAPY float64
+		apyBase    float64
+		apy        float64
+		expected   bool
+	}{
+		{"all base", 0.5, 0, 5, 5, true},
+		{"mixed at the ratio", 0.5, 0, 6, 12, true},
+		{"mixed below the ratio", 0.5, 0, 3, 12, false},
+		{"zero base", 0.5, 0, 0, 40, false},
+		{"zero total", 0, 0, 0, 0, false},
+		{"base apy floor", 0.5, 4, 5, 20, true},
+		{"base apy floor off", 0.5, 0, 5, 20, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SustainableYield{MinBaseRatio: decimal.NewFromFloat(tt.minRatio), MinBaseAPY: decimal.NewFromFloat(tt.minBaseAPY)}
+			pool := &Pool{APYBase: decimal.NewFromFloat(tt.apyBase), APY: decimal.NewFromFloat(tt.apy)}
+			if got := s.Allows(pool); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSortSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []SortKey
+		wantErr bool
+	}{
+		{"single field uses default order", "tvl", []SortKey{{"tvl", "desc"}}, false},
+		{"single field with order", "score:asc", []SortKey{{"score", "asc"}}, false},
+		{"multiple keys", "chain:asc,score:desc", []SortKey{{"chain", "asc"}, {"score", "desc"}}, false},
+		{"mixed suffixes", "stablecoin:desc, apy", []SortKey{{"stablecoin", "desc"}, {"apy", "desc"}}, false},
+		{"case insensitive", "Chain:ASC", []SortKey{{"chain", "asc"}}, false},
+		{"three keys", "chain:asc,protocol:asc,tvl:desc", []SortKey{{"chain", "asc"}, {"protocol", "asc"}, {"tvl", "desc"}}, false},
+		{"too many keys", "chain,protocol,tvl,apy", nil, true},
+		{"unknown field", "symbol:asc", nil, true},
+		{"bad direction", "tvl:up", nil, true},
+		{"duplicate field", "tvl:asc,tvl:desc", nil, true},
+		{"empty key", "tvl,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSortSpec(tt.spec, "desc", PoolSortFields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolIsStale(t *testing.T) {
+	now := time.Now()
+	staleBefore := now.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		dataSource  string
+		updatedAt   time.Time
+		staleBefore time.Time
+		want        bool
+	}{
+		{"fresh", DataSourceDeFiLlama, now, staleBefore, false},
+		{"not updated", DataSourceDeFiLlama, now.Add(-2 * time.Hour), staleBefore, true},
+		{"manual, just imported", DataSourceManual, now, staleBefore, false},
+		{"manual, imported long ago", DataSourceManual, now.AddDate(-1, 0, 0), staleBefore, false},
+		{"no threshold", DataSourceDeFiLlama, now.AddDate(-1, 0, 0), time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := Pool{DataSource: tt.dataSource, UpdatedAt: tt.updatedAt}
+			if got := pool.IsStale(tt.staleBefore); got != tt.want {
+				t.Errorf("Expected stale=%v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffPool(t *testing.T) {
+	d := decimal.RequireFromString
+	prev := Pool{APY: d("4.1"), TVL: d("1000000.000001"), Score: d("50")}
+	cur := Pool{APY: d("4.35"), TVL: d("1000000.000003"), Score: d("50.00")}
+
+	changes := DiffPool(prev, cur)
+
+	// Deltas are exact: no float rounding such as 0.25000000000000044
+	if changes.APY == nil || changes.APY.Delta.String() != "0.25" {
+		t.Errorf("Expected APY delta 0.25, got %+v", changes.APY)
+	}
+	if changes.TVL == nil || changes.TVL.Delta.String() != "0.000002" {
+		t.Errorf("Expected TVL delta 0.000002, got %+v", changes.TVL)
+	}
+	if changes.APY != nil && (!changes.APY.Previous.Equal(prev.APY) || !changes.APY.Current.Equal(cur.APY)) {
+		t.Errorf("Expected APY 4.1 -> 4.35, got %+v", changes.APY)
+	}
+
+	// 50 and 50.00 are the same value
+	if changes.Score != nil {
+		t.Errorf("Expected unchanged score to be omitted, got %+v", changes.Score)
+	}
+
+	decreased := DiffPool(cur, prev)
+	if decreased.APY == nil || decreased.APY.Delta.String() != "-0.25" {
+		t.Errorf("Expected APY delta -0.25, got %+v", decreased.APY)
+	}
+}
+
+func TestSymbolMatchQuality(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"USDC", MatchQualityExact},
+		{"usdc", MatchQualityExact},
+		{"USDC-ETH", MatchQualityPartial},
+		{"WETH-USDC", MatchQualityPartial},
+		{"USDC.e", MatchQualityFuzzy},
+		{"USDD", MatchQualityFuzzy},
+		{"SUSD", MatchQualityFuzzy},
+		{"XUSDC2", MatchQualityFuzzy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			if got := SymbolMatchQuality(tt.symbol, "USDC"); got != tt.want {
+				t.Errorf("SymbolMatchQuality(%q, USDC) = %s, want %s", tt.symbol, got, tt.want)
+			}
+		})
+	}
+
+	// Dots in the query are literal and part of the token
+	if got := SymbolMatchQuality("USDC.e-WETH", "usdc.e"); got != MatchQualityPartial {
+		t.Errorf("Expected USDC.e to be a token of USDC.e-WETH, got %s", got)
+	}
+	if got := SymbolMatchQuality("USDCXe", "USDC.e"); got != MatchQualityFuzzy {
+		t.Errorf("Expected the dot matched literally, got %s", got)
+	}
+}
+
+func TestSetMatchQuality(t *testing.T) {
+	pools := []Pool{{Symbol: "USDC"}, {Symbol: "USDD"}}
+
+	SetMatchQuality(pools, "")
+	if pools[0].MatchQuality != "" {
+		t.Errorf("Expected no match quality without a query, got %q", pools[0].MatchQuality)
+	}
+
+	SetMatchQuality(pools, "usdc")
+	if pools[0].MatchQuality != MatchQualityExact || pools[1].MatchQuality != MatchQualityFuzzy {
+		t.Errorf("Expected exact and fuzzy, got %q and %q", pools[0].MatchQuality, pools[1].MatchQuality)
+	}
+}
+
+func TestHistoryBucketStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	utc := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("Invalid time %s: %v", value, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name   string
+		at     string
+		bucket string
+		loc    *time.Location
+		want   string
+	}{
+		{"utc 5m", "2024-06-03T12:07:30Z", "5m", time.UTC, "2024-06-03T12:05:00Z"},
+		{"tokyo day", "2024-06-03T23:59:00Z", "1d", tokyo, "2024-06-03T15:00:00Z"},
+		{"tokyo day before local midnight", "2024-06-03T14:59:00Z", "1d", tokyo, "2024-06-02T15:00:00Z"},
+
+		// Clocks go forward at 02:00 CET on 31 March: the day is 23 hours
+		{"day before spring forward", "2024-03-30T12:00:00Z", "1d", berlin, "2024-03-29T23:00:00Z"},
+		{"spring forward day", "2024-03-31T12:00:00Z", "1d", berlin, "2024-03-30T23:00:00Z"},
+		{"day after spring forward", "2024-03-31T22:30:00Z", "1d", berlin, "2024-03-31T22:00:00Z"},
+		{"6h before spring forward", "2024-03-30T05:00:00Z", "6h", berlin, "2024-03-30T05:00:00Z"},
+		{"6h after spring forward", "2024-03-31T05:00:00Z", "6h", berlin, "2024-03-31T04:00:00Z"},
+		{"hour after the skipped one", "2024-03-31T01:10:00Z", "1h", berlin, "2024-03-31T01:00:00Z"},
+
+		// Clocks go back at 03:00 CEST on 27 October: the day is 25 hours
+		{"fall back day", "2024-10-27T12:00:00Z", "1d", berlin, "2024-10-26T22:00:00Z"},
+		{"day after fall back", "2024-10-27T23:30:00Z", "1d", berlin, "2024-10-27T23:00:00Z"},
+		{"6h after fall back", "2024-10-27T11:00:00Z", "6h", berlin, "2024-10-27T11:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HistoryBucketStart(utc(tt.at), tt.bucket, tt.loc)
+			if !got.Equal(utc(tt.want)) {
+				t.Errorf("HistoryBucketStart(%s, %s, %s) = %s, want %s", tt.at, tt.bucket, tt.loc, got.UTC().Format(time.RFC3339), tt.want)
+			}
+			if got.Location() != tt.loc {
+				t.Errorf("Expected the start in %s, got %s", tt.loc, got.Location())
+			}
+		})
+	}
+
+	// Consecutive daily buckets around the changes are 23 and 25 hours apart
+	for _, day := range []struct {
+		at   string
+		want time.Duration
+	}{
+		{"2024-03-31T12:00:00Z", 23 * time.Hour},
+		{"2024-10-27T12:00:00Z", 25 * time.Hour},
+	} {
+		start := HistoryBucketStart(utc(day.at), "1d", berlin)
+		next := HistoryBucketStart(start.Add(26*time.Hour), "1d", berlin)
+		if length := next.Sub(start); length != day.want {
+			t.Errorf("Expected the day of %s to last %s, got %s", day.at, day.want, length)
+		}
+	}
+}
+
+func TestForwardFillHistory(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+
+	point := func(at time.Time, apy int64) HistoricalAPY {
+		return HistoricalAPY{PoolID: "pool-1", Timestamp: at, APY: decimal.NewFromInt(apy)}
+	}
+	collect := func(bucket string, loc *time.Location, points ...HistoricalAPY) []HistoricalAPY {
+		var got []HistoricalAPY
+		fill := ForwardFillHistory(bucket, loc, func(h HistoricalAPY) error {
+			got = append(got, h)
+			return nil
+		})
+		for _, p := range points {
+			if err := fill(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return got
+	}
+
+	// Hourly heartbeat points in 5m buckets: the gap is carried forward
+	start := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	got := collect("5m", time.UTC, point(start, 4), point(start.Add(20*time.Minute), 6), point(start.Add(25*time.Minute), 7))
+	if len(got) != 6 {
+		t.Fatalf("Expected 6 buckets, got %+v", got)
+	}
+	for i, want := range []struct {
+		apy    int64
+		filled bool
+	}{{4, false}, {4, true}, {4, true}, {4, true}, {6, false}, {7, false}} {
+		if at := start.Add(time.Duration(i) * 5 * time.Minute); !got[i].Timestamp.Equal(at) || got[i].APY.IntPart() != want.apy || got[i].Filled != want.filled {
+			t.Errorf("Bucket %d: expected %s apy %d filled %v, got %+v", i, at, want.apy, want.filled, got[i])
+		}
+	}
+
+	// Daily buckets step by the local day across the 25-hour fall back day
+	day := time.Date(2024, 10, 26, 0, 0, 0, 0, berlin)
+	got = collect("1d", berlin, point(day, 1), point(time.Date(2024, 10, 29, 0, 0, 0, 0, berlin), 2))
+	if len(got) != 4 || !got[2].Timestamp.Equal(time.Date(2024, 10, 28, 0, 0, 0, 0, berlin)) {
+		t.Errorf("Expected 4 daily buckets at local midnight, got %+v", got)
+	}
+}
+
+func TestHistoryWindowStart(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, tokyo)
+	if got, want := HistoryWindowStart(now, "30d", "1d", tokyo), time.Date(2024, 5, 31, 0, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("Expected 30 daily buckets from %s, got %s", want, got)
+	}
+	if got, want := HistoryWindowStart(now, "unknown", "1h", time.UTC), time.Date(2024, 6, 29, 3, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected an unknown period to cover 24h from %s, got %s", want, got)
+	}
+	if got := DefaultHistoryBucket("30d"); got != "6h" {
+		t.Errorf("Expected 6h buckets for 30d, got %s", got)
+	}
+}
+
+func TestSparklineSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 40, 0, 0, time.UTC)
+	want := time.Date(2026, 2, 28, 13, 0, 0, 0, time.UTC)
+
+	if got := SparklineSince(now); !got.Equal(want) {
+		t.Errorf("Expected sparklines to start at %v, got %v", want, got)
+	}
+	if hours := int(now.Sub(SparklineSince(now))/time.Hour) + 1; hours != SparklinePoints {
+		t.Errorf("Expected %d hourly buckets, got %d", SparklinePoints, hours)
+	}
+}
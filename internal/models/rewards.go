@@ -0,0 +1,54 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// RewardsEstimateNote labels the emission values of PoolRewards
+const RewardsEstimateNote = "Estimate: the current reward APY spread evenly over a year. Actual emissions change with token prices and pool TVL."
+
+// PoolDetail is a pool with optional detail sections, returned by the pool
+// detail endpoint
+type PoolDetail struct {
+	Pool
+	Rewards *PoolRewards `json:"rewards,omitempty"` // Only with rewardsDetail=true
+}
+
+// PoolRewards describes what a pool's reward tokens are worth
+type PoolRewards struct {
+	APYReward decimal.Decimal `json:"apyReward"`
+	Tokens    []RewardToken   `json:"tokens"`
+	// EstimatedDailyUSDPer1000 is the USD value of rewards earned per day on
+	// $1,000 deposited: apyReward / 100 / 365 * 1000
+	EstimatedDailyUSDPer1000 decimal.Decimal `json:"estimatedDailyUsdPer1000"`
+	Note                     string          `json:"note"`
+}
+
+// RewardToken is a reward token of a pool. Symbol, CoinGeckoID and PriceUSD
+// are left out when the token can't be resolved or has no cached price.
+type RewardToken struct {
+	Address     string           `json:"address"` // As listed by DeFiLlama
+	Symbol      string           `json:"symbol,omitempty"`
+	CoinGeckoID string           `json:"coingeckoId,omitempty"`
+	PriceUSD    *decimal.Decimal `json:"priceUsd,omitempty"`
+	// EstimatedDailyTokensPer1000 is the number of tokens earned per day on
+	// $1,000 deposited. Only set when the pool has a single priced reward
+	// token, since DeFiLlama doesn't split the reward APY between tokens.
+	EstimatedDailyTokensPer1000 *decimal.Decimal `json:"estimatedDailyTokensPer1000,omitempty"`
+}
+
+// ResolvedToken caches the resolution of a token contract. An empty
+// CoinGeckoID records that CoinGecko doesn't know the token.
+type ResolvedToken struct {
+	Chain       string `json:"chain"`
+	Address     string `json:"address"`
+	Symbol      string `json:"symbol,omitempty"`
+	CoinGeckoID string `json:"coingeckoId,omitempty"`
+}
+
+// EstimateDailyRewardPer1000 returns the USD value of rewards earned per day
+// on $1,000 deposited at a reward APY
+func EstimateDailyRewardPer1000(apyReward decimal.Decimal) decimal.Decimal {
+	if apyReward.IsNegative() {
+		return decimal.Zero
+	}
+	return apyReward.Div(decimal.NewFromInt(100)).Div(decimal.NewFromInt(365)).Mul(decimal.NewFromInt(1000)).Round(6)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestEstimateDailyRewardPer1000(t *testing.T) {
+	tests := []struct {
+		apy  string
+		want string
+	}{
+		{"0", "0"},
+		{"36.5", "1"},
+		{"3.65", "0.1"},
+		{"-1", "0"},
+	}
+	for _, tt := range tests {
+		got := EstimateDailyRewardPer1000(decimal.RequireFromString(tt.apy))
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("EstimateDailyRewardPer1000(%s) = %s, want %s", tt.apy, got, tt.want)
+		}
+	}
+}
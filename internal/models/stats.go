@@ -1,6 +1,9 @@
 package models
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -10,15 +13,98 @@ type Chain struct {
 	DisplayName  string          `json:"displayName"`
 	PoolCount    int             `json:"poolCount"`
 	TotalTVL     decimal.Decimal `json:"totalTvl"`
-	AverageAPY   decimal.Decimal `json:"averageApy"`
+	AverageAPY   decimal.Decimal `json:"averageApy"`  // Plain average over the chain's pools
+	WeightedAPY  decimal.Decimal `json:"weightedApy"` // TVL-weighted average, the average when the TVL sums to zero
 	MaxAPY       decimal.Decimal `json:"maxApy"`
+	APYTrend     *APYTrend       `json:"apyTrend,omitempty"` // Nil without history from 24h ago
 	TopProtocols []string        `json:"topProtocols"`
 }
 
+// APY trend directions
+const (
+	TrendUp   = "up"
+	TrendDown = "down"
+	TrendFlat = "flat"
+)
+
+// TrendFlatThreshold is the percentage move under which an APY trend is flat
+const TrendFlatThreshold = 1.0
+
+// APYTrend is the direction and percentage move of an APY over 24 hours
+type APYTrend struct {
+	Direction string          `json:"direction"` // up, down, flat
+	Change    decimal.Decimal `json:"change"`    // Percentage move relative to 24h ago
+}
+
+// NewAPYTrend compares an APY to its value 24 hours earlier. It returns nil
+// when there is no earlier value to compare to or it is zero, since a move
+// from zero has no percentage.
+func NewAPYTrend(current decimal.Decimal, previous decimal.NullDecimal) *APYTrend {
+	if !previous.Valid || previous.Decimal.IsZero() {
+		return nil
+	}
+
+	change := current.Sub(previous.Decimal).
+		Div(previous.Decimal.Abs()).
+		Mul(decimal.NewFromInt(100)).
+		Round(2)
+
+	direction := TrendFlat
+	switch {
+	case change.GreaterThanOrEqual(decimal.NewFromFloat(TrendFlatThreshold)):
+		direction = TrendUp
+	case change.LessThanOrEqual(decimal.NewFromFloat(-TrendFlatThreshold)):
+		direction = TrendDown
+	}
+
+	return &APYTrend{Direction: direction, Change: change}
+}
+
+// ChainOverride replaces the built-in security rating and/or gas cost used
+// for a chain in scoring. Nil fields keep the default.
+type ChainOverride struct {
+	Chain          string   `json:"chain" db:"chain"`
+	SecurityRating *float64 `json:"securityRating,omitempty" db:"security_rating"`
+	GasCostUSD     *float64 `json:"gasCostUsd,omitempty" db:"gas_cost_usd"`
+	NeedsReview    bool     `json:"needsReview,omitempty" db:"needs_review"` // Pools on the chain are never rated low risk
+}
+
+// ChainMetadata is the registry entry created for a chain the first time
+// ingestion sees it without a security rating. Operators review the
+// conservative defaults and clear NeedsReview.
+type ChainMetadata struct {
+	Chain          string    `json:"chain" db:"chain"`
+	SecurityRating float64   `json:"securityRating" db:"security_rating"`
+	GasCostUSD     float64   `json:"gasCostUsd" db:"gas_cost_usd"`
+	NeedsReview    bool      `json:"needsReview" db:"needs_review"`
+	PoolCount      int       `json:"poolCount" db:"pool_count"` // Pools in the most recent ingestion run
+	FirstSeenAt    time.Time `json:"firstSeenAt" db:"first_seen_at"`
+	LastSeenAt     time.Time `json:"lastSeenAt" db:"last_seen_at"`
+}
+
+// DataQualityReport lists data that needs operator attention
+type DataQualityReport struct {
+	ChainsNeedingReview []ChainMetadata `json:"chainsNeedingReview"`
+	GeneratedAt         time.Time       `json:"generatedAt"`
+}
+
+// ChainFilter defines sorting and paging options for chain queries
+type ChainFilter struct {
+	SortBy       string          `query:"sortBy"`    // tvl, poolCount, apy, weightedApy, maxApy, name
+	SortOrder    string          `query:"sortOrder"` // asc, desc
+	Limit        int             `query:"limit"`
+	Offset       int             `query:"offset"`
+	IncludeEmpty bool            `query:"includeEmpty"` // Count pools below the listing TVL floor, left out by default
+	TVLFloor     decimal.Decimal `query:"-"`            // Listing TVL floor applied unless IncludeEmpty (0 = none)
+}
+
 // ChainListResponse is the API response for listing chains
 type ChainListResponse struct {
-	Data  []Chain `json:"data"`
-	Total int     `json:"total"`
+	Data    []Chain `json:"data"`
+	Total   int64   `json:"total"`
+	Limit   int     `json:"limit"`
+	Offset  int     `json:"offset"`
+	HasMore bool    `json:"hasMore"`
 }
 
 // Protocol represents a DeFi protocol with aggregated statistics
@@ -44,6 +130,31 @@ type ProtocolFilter struct {
 	SortOrder string `query:"sortOrder"` // asc, desc
 	Limit    int    `query:"limit"`
 	Offset   int    `query:"offset"`
+	IncludeEmpty bool            `query:"includeEmpty"` // Count pools below the listing TVL floor, left out by default
+	TVLFloor     decimal.Decimal `query:"-"`            // Listing TVL floor applied unless IncludeEmpty (0 = none)
+}
+
+// AggregateHistoryPoint is one time bucket of APY history aggregated over
+// a group of pools
+type AggregateHistoryPoint struct {
+	Timestamp time.Time       `json:"timestamp"`
+	APY       decimal.Decimal `json:"apy"`       // TVL-weighted average APY
+	TVL       decimal.Decimal `json:"tvl"`       // Combined TVL of the pools with data in the bucket
+	PoolCount int             `json:"poolCount"` // Pools with data in the bucket
+}
+
+// ProtocolHistoryResponse is the API response for a protocol's APY history
+type ProtocolHistoryResponse struct {
+	Protocol   string                  `json:"protocol"`
+	Period     string                  `json:"period"`
+	DataPoints []AggregateHistoryPoint `json:"dataPoints"`
+}
+
+// ChainHistoryResponse is the API response for a chain's APY history
+type ChainHistoryResponse struct {
+	Chain      string                  `json:"chain"`
+	Period     string                  `json:"period"`
+	DataPoints []AggregateHistoryPoint `json:"dataPoints"`
 }
 
 // ProtocolListResponse is the API response for listing protocols
@@ -66,6 +177,8 @@ type PlatformStats struct {
 	TotalProtocols      int             `json:"totalProtocols"`
 	ActiveOpportunities int             `json:"activeOpportunities"`
 	LastUpdated         string          `json:"lastUpdated"`
+	Note                string          `json:"note,omitempty"` // Set when WORKER_CHAINS or WORKER_EXCLUDE_CHAINS limits the chains ingested
+	Source              string          `json:"source"`         // Backend that computed the stats (postgres, es)
 
 	// Distribution data for charts
 	TVLByChain          map[string]decimal.Decimal `json:"tvlByChain"`
@@ -73,6 +186,78 @@ type PlatformStats struct {
 	APYDistribution     APYDistribution            `json:"apyDistribution"`
 }
 
+// Platform stats sources
+const (
+	StatsSourcePostgres = "postgres" // Aggregated by PostgreSQL, the source of truth
+	StatsSourceES       = "es"       // Aggregated by ElasticSearch, offloading the database
+)
+
+// StatsVariantAll follows the source in the cache key of stats that include
+// the pools below the listing TVL floor
+const StatsVariantAll = ":all"
+
+// MetricsCounts holds the cheap aggregate counts exported as Prometheus gauges
+type MetricsCounts struct {
+	ActiveOpportunitiesByType map[string]int // Keyed by opportunity type
+	TotalPools                int
+	StalePools                int       // Pools not updated within the stale threshold
+	OutlierPools              int       // Pools whose reported APY is outside the plausible range
+	LastFetch                 time.Time // Most recent pool update; zero when there are no pools
+	ReviewChainPools          map[string]int // Pools per chain awaiting security review
+}
+
+// YieldGapScan summarises the pool universe seen by the last yield gap
+// detection run
+type YieldGapScan struct {
+	PoolsConsidered  int       `json:"poolsConsidered"`
+	AssetsConsidered int       `json:"assetsConsidered"`
+	Truncated        bool      `json:"truncated"` // The scan stopped at YIELD_GAP_MAX_POOLS
+	ScannedAt        time.Time `json:"scannedAt"`
+}
+
+// HistoryWrites counts the historical data points ingestion recorded and
+// those it skipped as unchanged, since the counters were created
+type HistoryWrites struct {
+	Written int64 `json:"written"`
+	Skipped int64 `json:"skipped"`
+}
+
+// PoolDistribution counts pools by score range, TVL range and chain, for
+// building scatter and histogram views in a single request
+type PoolDistribution struct {
+	TotalPools  int                  `json:"totalPools"`
+	ByScore     []DistributionBucket `json:"byScore"`
+	ByTVL       []DistributionBucket `json:"byTvl"`
+	ByChain     map[string]int       `json:"byChain"`
+	LastUpdated string               `json:"lastUpdated"`
+}
+
+// DistributionBucket is the number of pools with a value in [Min, Max).
+// Max is nil for the last, open-ended bucket.
+type DistributionBucket struct {
+	Label string   `json:"label"` // e.g. "20-40" or "80+"
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+// NewDistributionBuckets creates empty buckets from ascending lower bounds
+func NewDistributionBuckets(edges []float64) []DistributionBucket {
+	buckets := make([]DistributionBucket, len(edges))
+	for i, edge := range edges {
+		buckets[i] = DistributionBucket{
+			Label: strconv.FormatFloat(edge, 'f', -1, 64) + "+",
+			Min:   edge,
+		}
+		if i+1 < len(edges) {
+			upper := edges[i+1]
+			buckets[i].Max = &upper
+			buckets[i].Label = strconv.FormatFloat(edge, 'f', -1, 64) + "-" + strconv.FormatFloat(upper, 'f', -1, 64)
+		}
+	}
+	return buckets
+}
+
 // APYDistribution shows how pools are distributed across APY ranges
 type APYDistribution struct {
 	Range0to1    int `json:"range0to1"`    // 0-1% APY
@@ -91,6 +276,7 @@ type HealthCheck struct {
 	Uptime      string                 `json:"uptime"`
 	Timestamp   string                 `json:"timestamp"`
 	Services    map[string]ServiceHealth `json:"services"`
+	Data        *DataStatus              `json:"data,omitempty"` // Set once the worker's platform monitor has run
 }
 
 // ServiceHealth represents the health of an individual service
@@ -98,4 +284,59 @@ type ServiceHealth struct {
 	Status    string `json:"status"`    // up, down
 	Latency   string `json:"latency"`   // Response time
 	Message   string `json:"message,omitempty"`
+	Breaker   string `json:"breaker,omitempty"` // closed, open, half-open
+}
+
+// Snapshot describes an archived raw DeFiLlama pools response
+type Snapshot struct {
+	ID         string    `json:"id"`         // Unix timestamp, used in the download URL
+	CapturedAt time.Time `json:"capturedAt"`
+	SizeBytes  int64     `json:"sizeBytes"`  // Compressed size
+}
+
+// SnapshotListResponse is the API response for listing snapshots
+type SnapshotListResponse struct {
+	Data  []Snapshot `json:"data"`
+	Total int        `json:"total"`
+}
+
+// Reindex states
+const (
+	ReindexStateRunning   = "running"   // Copying pools into the new index
+	ReindexStateSwapped   = "swapped"   // Alias moved; old index awaits deletion
+	ReindexStateCompleted = "completed" // Old index deleted
+	ReindexStateFailed    = "failed"
+)
+
+// Reindex sources: where the rebuilt index's documents are copied from
+const (
+	ReindexSourcePostgres = "postgres" // Pools read from PostgreSQL in ID order
+	ReindexSourceIndex    = "index"    // Documents copied from the index behind the alias
+)
+
+// ReindexStatus is the progress of a pools index rebuild. It is also the
+// checkpoint a crashed run resumes from.
+type ReindexStatus struct {
+	State          string     `json:"state"`
+	Source         string     `json:"source"`                // Where documents are copied from (postgres, index)
+	SourceIndex    string     `json:"sourceIndex,omitempty"` // Index behind the alias when the run started
+	TargetIndex    string     `json:"targetIndex"`
+	MappingVersion int        `json:"mappingVersion"`
+	LastPoolID     string     `json:"lastPoolId,omitempty"` // Last pool copied; the next batch starts after it
+	Indexed        int64      `json:"indexed"`
+	Error          string     `json:"error,omitempty"`
+	StartedAt      time.Time  `json:"startedAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+}
+
+// FetchCheckpoint is how far a pools fetch got ingesting its pools, which
+// it does in ID order a chunk at a time. A fetch interrupted before it
+// finished resumes after LastPoolID.
+type FetchCheckpoint struct {
+	LastPoolID string    `json:"lastPoolId"` // Last pool of the last chunk stored
+	Ingested   int       `json:"ingested"`   // Pools up to and including LastPoolID
+	Total      int       `json:"total"`
+	StartedAt  time.Time `json:"startedAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
 }
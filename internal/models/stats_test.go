@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestNewDistributionBuckets(t *testing.T) {
+	buckets := NewDistributionBuckets([]float64{0, 20, 80})
+
+	if len(buckets) != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", len(buckets))
+	}
+
+	labels := []string{"0-20", "20-80", "80+"}
+	for i, want := range labels {
+		if buckets[i].Label != want {
+			t.Errorf("Bucket %d: expected label %s, got %s", i, want, buckets[i].Label)
+		}
+	}
+
+	if buckets[1].Min != 20 || buckets[1].Max == nil || *buckets[1].Max != 80 {
+		t.Errorf("Expected second bucket [20, 80), got %+v", buckets[1])
+	}
+	if buckets[2].Max != nil {
+		t.Errorf("Expected last bucket to be open-ended, got max %v", *buckets[2].Max)
+	}
+}
+
+func TestNewAPYTrend(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   float64
+		previous  decimal.NullDecimal
+		direction string
+		change    string
+	}{
+		{"up", 5.5, decimal.NewNullDecimal(decimal.NewFromInt(5)), TrendUp, "10"},
+		{"down", 4, decimal.NewNullDecimal(decimal.NewFromInt(5)), TrendDown, "-20"},
+		{"flat", 5.02, decimal.NewNullDecimal(decimal.NewFromInt(5)), TrendFlat, "0.4"},
+		{"threshold", 5.05, decimal.NewNullDecimal(decimal.NewFromInt(5)), TrendUp, "1"},
+		{"negative previous", -1, decimal.NewNullDecimal(decimal.NewFromInt(-2)), TrendUp, "50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend := NewAPYTrend(decimal.NewFromFloat(tt.current), tt.previous)
+			if trend == nil {
+				t.Fatal("Expected a trend")
+			}
+			if trend.Direction != tt.direction || trend.Change.String() != tt.change {
+				t.Errorf("Expected %s %s%%, got %s %s%%", tt.direction, tt.change, trend.Direction, trend.Change)
+			}
+		})
+	}
+}
+
+func TestNewAPYTrend_NoBaseline(t *testing.T) {
+	if trend := NewAPYTrend(decimal.NewFromInt(5), decimal.NullDecimal{}); trend != nil {
+		t.Errorf("Expected no trend without history, got %+v", trend)
+	}
+	if trend := NewAPYTrend(decimal.NewFromInt(5), decimal.NewNullDecimal(decimal.Zero)); trend != nil {
+		t.Errorf("Expected no trend from a zero APY, got %+v", trend)
+	}
+}
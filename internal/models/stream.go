@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Event types of the opportunity stream, sent as the event field of
+// server-sent events
+const (
+	OpportunityEventAlert      = "opportunity"
+	OpportunityEventRetraction = "retraction"
+	OpportunityEventGap        = "gap"
+)
+
+// OpportunityEvent is an opportunity alert, retraction or gap notice as
+// streamed over server-sent events. Data is the same JSON as the data of
+// the matching WebSocket message.
+type OpportunityEvent struct {
+	ID   uint64 // Sequence number on the opportunity stream; 0 for gap notices
+	Type string
+	Data json.RawMessage
+}
+
+// OpportunityStreamFilter selects the events of an opportunity stream.
+// Retractions only carry the opportunity type, so chain and minimum score
+// don't apply to them.
+type OpportunityStreamFilter struct {
+	Chain    string
+	Type     OpportunityType
+	MinScore decimal.Decimal
+}
+
+// MatchAlert reports whether an opportunity alert passes the filter
+func (f OpportunityStreamFilter) MatchAlert(opp *Opportunity) bool {
+	if f.Type != "" && opp.Type != f.Type {
+		return false
+	}
+	if f.Chain != "" && !strings.EqualFold(opp.Chain, f.Chain) {
+		return false
+	}
+	return f.MinScore.IsZero() || opp.Score.GreaterThanOrEqual(f.MinScore)
+}
+
+// MatchRetraction reports whether a retraction passes the filter
+func (f OpportunityStreamFilter) MatchRetraction(retraction *OpportunityRetraction) bool {
+	return f.Type == "" || retraction.Type == f.Type
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Pool categories
+const (
+	TagLending       = "lending"        // Supply and borrow markets
+	TagDEXLP         = "dex-lp"         // Liquidity provided to an exchange
+	TagLiquidStaking = "liquid-staking" // Staked assets with a liquid receipt token, e.g. stETH
+	TagRWA           = "rwa"            // Tokenised real-world assets, e.g. treasuries
+)
+
+// tagPattern matches valid tags: lowercase words joined by hyphens
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// MaxTagFilters is the most tags a pool filter may require at once
+const MaxTagFilters = 5
+
+// ValidTag reports whether tag is a lowercase, hyphenated slug
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+// NormalizeTags validates the tags of a pool filter and returns them
+// lowercased, sorted and without duplicates, so equivalent filters share a
+// cache key
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !ValidTag(tag) {
+			return nil, fmt.Errorf("invalid tag %q: must be lowercase words joined by hyphens", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTagFilters {
+		return nil, fmt.Errorf("at most %d tags allowed", MaxTagFilters)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// ProtocolCategory maps a protocol to the category its pools are tagged with
+type ProtocolCategory struct {
+	Protocol string `json:"protocol" db:"protocol"` // DeFiLlama project, without version suffix
+	Category string `json:"category" db:"category"`
+}
+
+// TagStats summarises the pools carrying a tag
+type TagStats struct {
+	Tag       string          `json:"tag" db:"tag"`
+	PoolCount int             `json:"poolCount" db:"pool_count"`
+	TotalTVL  decimal.Decimal `json:"totalTvl" db:"total_tvl"`
+}
+
+// TagListResponse is the API response for listing tags
+type TagListResponse struct {
+	Data  []TagStats `json:"data"`
+	Total int        `json:"total"`
+}
+
+// symbolRule tags pools whose symbol has any of its tokens, lowercased
+type symbolRule struct {
+	tag    string
+	tokens []string
+}
+
+// symbolRules apply to every pool whatever its protocol, so a Curve stETH
+// pool is liquid staking as well as an LP position
+var symbolRules = []symbolRule{
+	{TagLiquidStaking, []string{"steth", "wsteth", "reth", "cbeth", "sfrxeth", "ethx", "oseth", "ankreth", "msol", "jitosol", "bsol"}},
+	{TagRWA, []string{"usdy", "ousg", "buidl", "usyc"}},
+}
+
+// versionSuffix is the version DeFiLlama appends to projects, e.g. -v3
+var versionSuffix = regexp.MustCompile(`-v\d+$`)
+
+// Tagger tags pools from protocol categories and symbol rules
+type Tagger struct {
+	protocols map[string]string
+}
+
+// NewTagger prepares the protocol categories for tagging
+func NewTagger(protocols []ProtocolCategory) *Tagger {
+	t := &Tagger{protocols: make(map[string]string, len(protocols))}
+	for _, p := range protocols {
+		t.protocols[strings.ToLower(p.Protocol)] = p.Category
+	}
+	return t
+}
+
+// Tags returns the tags of a pool: its protocol's category first, then the
+// tags of the symbol rules it matches, each once. A pool of an unknown
+// protocol matching no symbol rule has no tags.
+func (t *Tagger) Tags(pool *Pool) []string {
+	var tags []string
+	if category, ok := t.category(pool.Protocol); ok {
+		tags = append(tags, category)
+	}
+
+	tokens := symbolTokens(pool.Symbol)
+	for _, rule := range symbolRules {
+		if containsTag(tags, rule.tag) {
+			continue
+		}
+		for _, token := range rule.tokens {
+			if tokens[token] {
+				tags = append(tags, rule.tag)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+// category returns the category of a protocol. An exact entry takes
+// precedence over the entry for the protocol without its version suffix,
+// so aave-v3 falls back to aave.
+func (t *Tagger) category(protocol string) (string, bool) {
+	protocol = strings.ToLower(protocol)
+	if category, ok := t.protocols[protocol]; ok {
+		return category, true
+	}
+	if base := versionSuffix.ReplaceAllString(protocol, ""); base != protocol {
+		category, ok := t.protocols[base]
+		return category, ok
+	}
+	return "", false
+}
+
+// symbolTokens splits a symbol into lowercased tokens the way
+// SymbolTokenPattern does
+func symbolTokens(symbol string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, token := range strings.FieldsFunc(strings.ToLower(symbol), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.')
+	}) {
+		tokens[token] = true
+	}
+	return tokens
+}
+
+// containsTag reports whether tags has tag
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaggerTags(t *testing.T) {
+	tagger := NewTagger([]ProtocolCategory{
+		{Protocol: "aave", Category: TagLending},
+		{Protocol: "curve-dex", Category: TagDEXLP},
+		{Protocol: "uniswap", Category: TagDEXLP},
+		{Protocol: "uniswap-v4", Category: "hooks"},
+		{Protocol: "lido", Category: TagLiquidStaking},
+		{Protocol: "ondo-finance", Category: TagRWA},
+	})
+
+	tests := []struct {
+		name     string
+		protocol string
+		symbol   string
+		expected []string
+	}{
+		{"protocol rule", "aave", "USDC", []string{TagLending}},
+		{"protocol family", "aave-v3", "USDC", []string{TagLending}},
+		{"exact protocol before family", "uniswap-v4", "WETH-USDC", []string{"hooks"}},
+		{"protocol names ignore case", "Curve-DEX", "DAI-USDC-USDT", []string{TagDEXLP}},
+		{"protocol rule first, then symbol rule", "curve-dex", "STETH-ETH", []string{TagDEXLP, TagLiquidStaking}},
+		{"protocol rule on a lending market of a staking token", "aave-v3", "WSTETH", []string{TagLending, TagLiquidStaking}},
+		{"symbol rule matching the protocol rule counted once", "lido", "STETH", []string{TagLiquidStaking}},
+		{"symbol rule alone", "some-new-dex", "RETH-WETH", []string{TagLiquidStaking}},
+		{"several symbol rules", "some-new-dex", "USDY-WSTETH", []string{TagLiquidStaking, TagRWA}},
+		{"symbol rule needs a whole token", "some-new-dex", "STETHX-ETH", nil},
+		{"unknown protocol untagged", "some-new-dex", "USDC-ETH", nil},
+		{"version suffix only", "aavesome", "USDC", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := tagger.Tags(&Pool{Protocol: tt.protocol, Symbol: tt.symbol})
+			if !reflect.DeepEqual(tags, tt.expected) {
+				t.Errorf("Expected tags %v, got %v", tt.expected, tags)
+			}
+		})
+	}
+}
+
+func TestValidTag(t *testing.T) {
+	for tag, valid := range map[string]bool{
+		"lending":        true,
+		"liquid-staking": true,
+		"rwa2":           true,
+		"":               false,
+		"Lending":        false,
+		"dex_lp":         false,
+		"-dex":           false,
+		"dex--lp":        false,
+	} {
+		if ValidTag(tag) != valid {
+			t.Errorf("Expected ValidTag(%q) to be %v", tag, valid)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// Retries wait retryBaseBackoff, doubling per attempt up to retryMaxBackoff
+const (
+	retryBaseBackoff = 100 * time.Millisecond
+	retryMaxBackoff  = 2 * time.Second
+)
+
+// retryOnStatus are the responses that are retried: overload and the
+// gateway errors of a node that is restarting
+var retryOnStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// ErrUnavailable is returned without calling ElasticSearch while the circuit
+// breaker is open. Callers serve the request from PostgreSQL.
+var ErrUnavailable = errors.New("ElasticSearch is unavailable")
+
+// statusError is an error response from ElasticSearch
+type statusError struct {
+	op     string
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.op, e.body)
+}
+
+// clientConfig builds the client configuration: retries with exponential
+// backoff, no node sniffing (the cluster is reached through one address),
+// and a transport with bounded dialing and a pool of idle connections
+func clientConfig(cfg config.ElasticSearchConfig) elasticsearch.Config {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	if cfg.RequestTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.RequestTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = cfg.RequestTimeout
+	}
+
+	esConfig := elasticsearch.Config{
+		Addresses:             []string{cfg.URL},
+		Transport:             transport,
+		RetryOnStatus:         retryOnStatus,
+		MaxRetries:            cfg.MaxRetries,
+		DisableRetry:          cfg.DisableRetry || cfg.MaxRetries == 0,
+		RetryOnError:          retryOnError,
+		RetryBackoff:          retryBackoff,
+		CompressRequestBody:   cfg.CompressRequests,
+		DiscoverNodesOnStart:  false,
+		DiscoverNodesInterval: 0,
+	}
+
+	// Add authentication if configured
+	if cfg.Username != "" && cfg.Password != "" {
+		esConfig.Username = cfg.Username
+		esConfig.Password = cfg.Password
+	}
+
+	return esConfig
+}
+
+// retryBackoff returns the wait before the given retry, starting at 1
+func retryBackoff(attempt int) time.Duration {
+	backoff := retryBaseBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > retryMaxBackoff {
+		return retryMaxBackoff
+	}
+	return backoff
+}
+
+// retryOnError retries connection errors unless the caller gave up
+func retryOnError(req *http.Request, err error) bool {
+	return req.Context().Err() == nil
+}
+
+// guard runs an ElasticSearch call through the circuit breaker. While the
+// breaker is open the call isn't made and ErrUnavailable is returned.
+func (r *Repository) guard(ctx context.Context, call func() error) error {
+	if err := r.breaker.Allow(); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	err := call()
+	if isFailure(ctx, err) {
+		r.breaker.Failure()
+	} else {
+		r.breaker.Success()
+	}
+	return err
+}
+
+// isFailure reports whether an error means ElasticSearch is unhealthy:
+// timeouts, connection errors and overload or server error responses.
+// Rejected queries and callers that went away don't count.
+func isFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *statusError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.status == http.StatusTooManyRequests || statusErr.status >= http.StatusInternalServerError
+	case errors.Is(err, ErrResultWindowExceeded):
+		return false
+	}
+	return true
+}
+
+// withRequestTimeout bounds a stats or health request by the request
+// timeout, if one is configured
+func (r *Repository) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.requestTimeout)
+}
+
+// BreakerState returns the state of the circuit breaker guarding searches
+func (r *Repository) BreakerState() breaker.State {
+	return r.breaker.State()
+}
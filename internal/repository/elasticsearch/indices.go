@@ -0,0 +1,323 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PoolsMappingVersion is the version of poolsIndexMapping. It is recorded in
+// the index's _meta; when the live index reports an older version the worker
+// rebuilds it with a reindex on startup.
+const PoolsMappingVersion = 4
+
+// IndexState describes the index currently behind the pools alias
+type IndexState struct {
+	Exists         bool   // An index or alias named IndexPools exists
+	Aliased        bool   // IndexPools is an alias; false for an unversioned legacy index
+	Name           string // Concrete index name
+	Generation     int    // N in defi_pools_vN; 0 for the legacy index
+	MappingVersion int    // Mapping version recorded in _meta; 0 if none
+}
+
+// Outdated reports whether the live index was built from an older mapping
+func (s IndexState) Outdated() bool {
+	return s.Exists && s.MappingVersion < PoolsMappingVersion
+}
+
+// PoolsIndexName returns the name of the given generation of the pools index
+func PoolsIndexName(generation int) string {
+	return fmt.Sprintf("%s_v%d", IndexPools, generation)
+}
+
+// poolsIndexGeneration extracts N from defi_pools_vN, returning 0 for names
+// that don't follow the pattern
+func poolsIndexGeneration(name string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, IndexPools+"_v"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// poolsIndexBody returns the create-index body for the pools index, with the
+// configured index settings, the mapping version recorded in _meta and,
+// optionally, the pools alias attached
+func poolsIndexBody(settings indexSettings, withAlias bool) ([]byte, error) {
+	body, err := settings.withSettings(poolsIndexMapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pools index mapping: %w", err)
+	}
+
+	mappings, ok := body["mappings"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid pools index mapping: no mappings")
+	}
+	mappings["_meta"] = map[string]interface{}{"mapping_version": PoolsMappingVersion}
+
+	if withAlias {
+		body["aliases"] = map[string]interface{}{IndexPools: map[string]interface{}{}}
+	}
+
+	return json.Marshal(body)
+}
+
+// PoolsIndexState resolves the pools alias to the index behind it and reads
+// the mapping version recorded on that index
+func (r *Repository) PoolsIndexState(ctx context.Context) (IndexState, error) {
+	var state IndexState
+
+	res, err := r.client.Indices.GetAlias(
+		r.client.Indices.GetAlias.WithContext(ctx),
+		r.client.Indices.GetAlias.WithName(IndexPools),
+	)
+	if err != nil {
+		return state, fmt.Errorf("failed to resolve pools alias: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		// No alias; an index created before versioning may still use the name
+		exists, err := r.IndexExists(ctx, IndexPools)
+		if err != nil || !exists {
+			return state, err
+		}
+		state.Exists = true
+		state.Name = IndexPools
+	case res.IsError():
+		return state, fmt.Errorf("failed to resolve pools alias: %s", res.String())
+	default:
+		var indices map[string]json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+			return state, fmt.Errorf("failed to decode pools alias: %w", err)
+		}
+		// Only one index should carry the alias; prefer the newest if an
+		// interrupted swap left more
+		for name := range indices {
+			if !state.Exists || poolsIndexGeneration(name) > state.Generation {
+				state.Name = name
+				state.Generation = poolsIndexGeneration(name)
+			}
+			state.Exists = true
+		}
+		state.Aliased = state.Exists
+	}
+
+	if !state.Exists {
+		return state, nil
+	}
+
+	state.MappingVersion, err = r.mappingVersion(ctx, state.Name)
+	return state, err
+}
+
+// mappingVersion reads the mapping version recorded in an index's _meta
+func (r *Repository) mappingVersion(ctx context.Context, index string) (int, error) {
+	res, err := r.client.Indices.GetMapping(
+		r.client.Indices.GetMapping.WithContext(ctx),
+		r.client.Indices.GetMapping.WithIndex(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s mapping: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("failed to get %s mapping: %s", index, res.String())
+	}
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta struct {
+				MappingVersion int `json:"mapping_version"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
+		return 0, fmt.Errorf("failed to decode %s mapping: %w", index, err)
+	}
+
+	return mappings[index].Mappings.Meta.MappingVersion, nil
+}
+
+// IndexExists reports whether an index or alias with the given name exists
+func (r *Repository) IndexExists(ctx context.Context, name string) (bool, error) {
+	res, err := r.client.Indices.Exists(
+		[]string{name},
+		r.client.Indices.Exists.WithContext(ctx),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to check index %s: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check index %s: %s", name, res.Status())
+	}
+}
+
+// CreatePoolsIndex creates the given generation of the pools index with the
+// current mapping and configured index settings, optionally attaching the pools alias. Returns the index name.
+func (r *Repository) CreatePoolsIndex(ctx context.Context, generation int, withAlias bool) (string, error) {
+	name := PoolsIndexName(generation)
+
+	body, err := poolsIndexBody(r.settings, withAlias)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := r.client.Indices.Create(
+		name,
+		r.client.Indices.Create.WithContext(ctx),
+		r.client.Indices.Create.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create index %s: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", fmt.Errorf("failed to create index %s: %s", name, res.String())
+	}
+
+	return name, nil
+}
+
+// DeleteIndex deletes an index. Deleting a missing index is not an error.
+func (r *Repository) DeleteIndex(ctx context.Context, name string) error {
+	res, err := r.client.Indices.Delete(
+		[]string{name},
+		r.client.Indices.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete index %s: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete index %s: %s", name, res.String())
+	}
+
+	return nil
+}
+
+// CountDocuments refreshes an index and returns its document count
+func (r *Repository) CountDocuments(ctx context.Context, index string) (int64, error) {
+	if err := r.RefreshIndex(ctx, index); err != nil {
+		return 0, err
+	}
+
+	res, err := r.client.Count(
+		r.client.Count.WithContext(ctx),
+		r.client.Count.WithIndex(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("failed to count %s: %s", index, res.String())
+	}
+
+	var count struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("failed to decode %s count: %w", index, err)
+	}
+
+	return count.Count, nil
+}
+
+// ReindexDocuments copies every document of source into target with the
+// _reindex API and waits for it to finish. Documents are copied as stored,
+// so fields renamed by a mapping change keep their old names. Returns the
+// number of documents written.
+func (r *Repository) ReindexDocuments(ctx context.Context, source, target string) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"source": map[string]interface{}{"index": source},
+		"dest":   map[string]interface{}{"index": target},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode reindex request: %w", err)
+	}
+
+	res, err := r.client.Reindex(
+		bytes.NewReader(body),
+		r.client.Reindex.WithContext(ctx),
+		r.client.Reindex.WithWaitForCompletion(true),
+		r.client.Reindex.WithRefresh(true),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reindex %s into %s: %w", source, target, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("failed to reindex %s into %s: %s", source, target, res.String())
+	}
+
+	var result struct {
+		Created  int64             `json:"created"`
+		Updated  int64             `json:"updated"`
+		Failures []json.RawMessage `json:"failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode reindex response: %w", err)
+	}
+	if len(result.Failures) > 0 {
+		return 0, fmt.Errorf("failed to reindex %s into %s: %d documents failed, first: %s", source, target, len(result.Failures), result.Failures[0])
+	}
+
+	return result.Created + result.Updated, nil
+}
+
+// SwapPoolsAlias atomically points the pools alias at newIndex. The alias is
+// removed from the previous index, or, for a legacy unversioned index that
+// holds the alias name itself, that index is deleted in the same request.
+func (r *Repository) SwapPoolsAlias(ctx context.Context, newIndex string, previous IndexState) error {
+	actions := []map[string]interface{}{
+		{"add": map[string]interface{}{"index": newIndex, "alias": IndexPools}},
+	}
+	switch {
+	case previous.Exists && previous.Aliased:
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": previous.Name, "alias": IndexPools},
+		})
+	case previous.Exists:
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": previous.Name},
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("failed to encode alias actions: %w", err)
+	}
+
+	res, err := r.client.Indices.UpdateAliases(
+		bytes.NewReader(body),
+		r.client.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to swap pools alias: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("failed to swap pools alias: %s", res.String())
+	}
+
+	return nil
+}
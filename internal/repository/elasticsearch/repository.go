@@ -6,14 +6,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
@@ -24,33 +28,59 @@ const (
 	IndexOpportunities = "defi_opportunities"
 )
 
+// defaultMaxResultWindow is the ElasticSearch default index.max_result_window
+const defaultMaxResultWindow = 10000
+
+// searchTimeoutSlack is how much longer than the search timeout the client
+// waits for a response, so ElasticSearch normally reports the timeout itself
+const searchTimeoutSlack = time.Second
+
+// ErrSearchTimeout is returned when a pool search doesn't complete within
+// the configured timeout. Callers serve the request from PostgreSQL.
+var ErrSearchTimeout = errors.New("ElasticSearch search timed out")
+
+// ErrResultWindowExceeded is returned when a page starts past the pools
+// index's max result window, which search_after can't reach either
+var ErrResultWindowExceeded = errors.New("page starts past the ElasticSearch result window")
+
 // Repository handles all ElasticSearch operations
 type Repository struct {
-	client *elasticsearch.Client
+	client          *elasticsearch.Client
+	settings        indexSettings
+	searchTimeout   time.Duration // 0 = no timeout
+	requestTimeout  time.Duration // 0 = no timeout
+	maxResultWindow int
+	breaker         *breaker.Breaker
 }
 
 // NewRepository creates a new ElasticSearch repository
 func NewRepository(cfg config.ElasticSearchConfig) (*Repository, error) {
-	esConfig := elasticsearch.Config{
-		Addresses: []string{cfg.URL},
-	}
-
-	// Add authentication if configured
-	if cfg.Username != "" && cfg.Password != "" {
-		esConfig.Username = cfg.Username
-		esConfig.Password = cfg.Password
-	}
-
-	client, err := elasticsearch.NewClient(esConfig)
+	client, err := elasticsearch.NewClient(clientConfig(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ElasticSearch client: %w", err)
 	}
 
-	return &Repository{client: client}, nil
+	maxResultWindow := cfg.MaxResultWindow
+	if maxResultWindow <= 0 {
+		maxResultWindow = defaultMaxResultWindow
+	}
+
+	return &Repository{
+		client:          client,
+		settings:        newIndexSettings(cfg),
+		searchTimeout:   cfg.SearchTimeout,
+		requestTimeout:  cfg.RequestTimeout,
+		maxResultWindow: maxResultWindow,
+		breaker:         breaker.New(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}, nil
 }
 
-// Ping checks if ElasticSearch connection is alive
+// Ping checks if ElasticSearch connection is alive. It bypasses the circuit
+// breaker, so health checks see a recovered cluster before searches do.
 func (r *Repository) Ping(ctx context.Context) error {
+	ctx, cancel := r.withRequestTimeout(ctx)
+	defer cancel()
+
 	res, err := r.client.Ping(r.client.Ping.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to ping ElasticSearch: %w", err)
@@ -79,12 +109,49 @@ func (r *Repository) CreateIndices(ctx context.Context) error {
 	return nil
 }
 
-// createPoolsIndex creates the pools index with proper mappings
+// createPoolsIndex makes sure the pools alias points at an index. A fresh
+// cluster gets the first versioned index with the alias attached; an existing
+// index is left alone and only reported if its mapping is out of date, since
+// upgrading it means a full reindex (see PoolsIndexState).
 func (r *Repository) createPoolsIndex(ctx context.Context) error {
-	mapping := `{
+	state, err := r.PoolsIndexState(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !state.Exists {
+		name, err := r.CreatePoolsIndex(ctx, 1, true)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("index", name).Str("alias", IndexPools).Msg("Pools index created")
+		return nil
+	}
+
+	// Replicas and the refresh interval can change in place; a failure only
+	// leaves the index on its previous settings
+	if err := r.UpdateIndexSettings(ctx, state.Name); err != nil {
+		log.Warn().Err(err).Str("index", state.Name).Msg("Failed to update pools index settings")
+	}
+
+	if state.Outdated() {
+		log.Warn().
+			Str("index", state.Name).
+			Int("mapping_version", state.MappingVersion).
+			Int("required_version", PoolsMappingVersion).
+			Msg("Pools index mapping is out of date, a reindex is required")
+		return nil
+	}
+
+	log.Info().Str("index", state.Name).Msg("Pools index verified")
+	return nil
+}
+
+// poolsIndexMapping holds the analysis settings and mappings of the pools
+// index. Bump PoolsMappingVersion whenever it changes. Shards, replicas and
+// the refresh interval come from the configuration (see indexSettings).
+const poolsIndexMapping = `{
 		"settings": {
-			"number_of_shards": 1,
-			"number_of_replicas": 0,
 			"analysis": {
 				"analyzer": {
 					"lowercase_analyzer": {
@@ -121,6 +188,7 @@ func (r *Repository) createPoolsIndex(ctx context.Context) error {
 				},
 				"tvl": { "type": "double" },
 				"apy": { "type": "double" },
+				"apy_raw": { "type": "double" },
 				"apy_base": { "type": "double" },
 				"apy_reward": { "type": "double" },
 				"reward_tokens": { "type": "keyword" },
@@ -130,44 +198,26 @@ func (r *Repository) createPoolsIndex(ctx context.Context) error {
 				"apy_mean_30d": { "type": "double" },
 				"volume_usd_1d": { "type": "double" },
 				"volume_usd_7d": { "type": "double" },
+				"volume_tvl_ratio": { "type": "double" },
+				"base_ratio": { "type": "double" },
 				"score": { "type": "double" },
 				"apy_change_1h": { "type": "double" },
 				"apy_change_24h": { "type": "double" },
 				"apy_change_7d": { "type": "double" },
 				"stablecoin": { "type": "boolean" },
 				"exposure": { "type": "keyword" },
+				"data_source": { "type": "keyword" },
+				"data_completeness": { "type": "double" },
+				"is_outlier": { "type": "boolean" },
+				"tags": { "type": "keyword" },
 				"created_at": { "type": "date" },
 				"updated_at": { "type": "date" }
 			}
 		}
 	}`
 
-	res, err := r.client.Indices.Create(
-		IndexPools,
-		r.client.Indices.Create.WithContext(ctx),
-		r.client.Indices.Create.WithBody(strings.NewReader(mapping)),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create pools index: %w", err)
-	}
-	defer res.Body.Close()
-
-	// Ignore "already exists" error
-	if res.IsError() && !strings.Contains(res.String(), "resource_already_exists_exception") {
-		return fmt.Errorf("failed to create pools index: %s", res.String())
-	}
-
-	log.Info().Msg("Pools index created/verified")
-	return nil
-}
-
-// createOpportunitiesIndex creates the opportunities index
-func (r *Repository) createOpportunitiesIndex(ctx context.Context) error {
-	mapping := `{
-		"settings": {
-			"number_of_shards": 1,
-			"number_of_replicas": 0
-		},
+// opportunitiesIndexMapping holds the mappings of the opportunities index
+const opportunitiesIndexMapping = `{
 		"mappings": {
 			"properties": {
 				"id": { "type": "keyword" },
@@ -184,6 +234,27 @@ func (r *Repository) createOpportunitiesIndex(ctx context.Context) error {
 				"current_apy": { "type": "double" },
 				"potential_profit": { "type": "double" },
 				"tvl": { "type": "double" },
+				"costs": {
+					"properties": {
+						"positionSizeUsd": { "type": "double" },
+						"withdrawGasUsd": { "type": "double" },
+						"bridgeFeeUsd": { "type": "double" },
+						"depositGasUsd": { "type": "double" },
+						"slippageUsd": { "type": "double" },
+						"totalUsd": { "type": "double" },
+						"crossChain": { "type": "boolean" },
+						"bridgeCost": {
+							"properties": {
+								"sourceChain": { "type": "keyword" },
+								"targetChain": { "type": "keyword" },
+								"flatFeeUsd": { "type": "double" },
+								"feePercent": { "type": "double" },
+								"delayHours": { "type": "double" },
+								"defaultRoute": { "type": "boolean" }
+							}
+						}
+					}
+				},
 				"risk_level": { "type": "keyword" },
 				"score": { "type": "double" },
 				"is_active": { "type": "boolean" },
@@ -196,18 +267,36 @@ func (r *Repository) createOpportunitiesIndex(ctx context.Context) error {
 		}
 	}`
 
+// createOpportunitiesIndex creates the opportunities index, or brings the
+// replicas and refresh interval of an existing one in line with the
+// configuration
+func (r *Repository) createOpportunitiesIndex(ctx context.Context) error {
+	body, err := r.settings.withSettings(opportunitiesIndexMapping)
+	if err != nil {
+		return fmt.Errorf("invalid opportunities index mapping: %w", err)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode opportunities index mapping: %w", err)
+	}
+
 	res, err := r.client.Indices.Create(
 		IndexOpportunities,
 		r.client.Indices.Create.WithContext(ctx),
-		r.client.Indices.Create.WithBody(strings.NewReader(mapping)),
+		r.client.Indices.Create.WithBody(bytes.NewReader(data)),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create opportunities index: %w", err)
 	}
 	defer res.Body.Close()
 
-	if res.IsError() && !strings.Contains(res.String(), "resource_already_exists_exception") {
-		return fmt.Errorf("failed to create opportunities index: %s", res.String())
+	if res.IsError() {
+		if !strings.Contains(res.String(), "resource_already_exists_exception") {
+			return fmt.Errorf("failed to create opportunities index: %s", res.String())
+		}
+		if err := r.UpdateIndexSettings(ctx, IndexOpportunities); err != nil {
+			log.Warn().Err(err).Msg("Failed to update opportunities index settings")
+		}
 	}
 
 	log.Info().Msg("Opportunities index created/verified")
@@ -220,13 +309,118 @@ func (r *Repository) createOpportunitiesIndex(ctx context.Context) error {
 
 // SearchPools performs a filtered search on pools
 func (r *Repository) SearchPools(ctx context.Context, filter models.PoolFilter) ([]models.Pool, int64, error) {
+	result, err := r.searchPools(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pools := make([]models.Pool, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		if pool, ok := hit.pool(); ok {
+			pools = append(pools, pool)
+		}
+	}
+
+	return pools, result.Hits.Total.Value, nil
+}
+
+// SearchPoolsWithHighlights performs a filtered search on pools and returns
+// each pool with the fragments of its symbol, protocol and pool meta that
+// matched the general search. Highlights are only requested when
+// filter.Search is set.
+func (r *Repository) SearchPoolsWithHighlights(ctx context.Context, filter models.PoolFilter) ([]models.PoolSearchHit, int64, error) {
+	result, err := r.searchPools(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]models.PoolSearchHit, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		if pool, ok := hit.pool(); ok {
+			hits = append(hits, models.PoolSearchHit{Pool: pool, Highlights: hit.highlights()})
+		}
+	}
+
+	return hits, result.Hits.Total.Value, nil
+}
+
+// searchPools runs the search built from filter. ElasticSearch rejects
+// from+size past index.max_result_window, so a page that ends past it is
+// read with search_after from the hit just before the page.
+func (r *Repository) searchPools(ctx context.Context, filter models.PoolFilter) (*searchResponse, error) {
 	// Build ElasticSearch query
 	query := buildPoolSearchQuery(filter)
+	if filter.Offset+filter.Limit <= r.maxResultWindow {
+		return r.search(ctx, query)
+	}
+	if filter.Offset > r.maxResultWindow {
+		return nil, ErrResultWindowExceeded
+	}
+
+	anchor, err := r.search(ctx, anchorQuery(query, filter.Offset-1))
+	if err != nil {
+		return nil, err
+	}
+	if len(anchor.Hits.Hits) == 0 {
+		// The page starts past the last hit
+		return anchor, nil
+	}
+
+	return r.search(ctx, searchAfterQuery(query, anchor.Hits.Hits[0].Sort))
+}
+
+// anchorQuery returns a copy of a search that reads only the sort values of
+// the hit at offset
+func anchorQuery(query map[string]interface{}, offset int) map[string]interface{} {
+	anchor := make(map[string]interface{}, len(query))
+	for key, value := range query {
+		anchor[key] = value
+	}
+	delete(anchor, "highlight")
+	anchor["from"] = offset
+	anchor["size"] = 1
+	anchor["_source"] = false
+	return anchor
+}
+
+// searchAfterQuery returns a copy of a search that continues after the hit
+// with the given sort values
+func searchAfterQuery(query map[string]interface{}, after json.RawMessage) map[string]interface{} {
+	page := make(map[string]interface{}, len(query)+1)
+	for key, value := range query {
+		page[key] = value
+	}
+	page["from"] = 0
+	page["search_after"] = after
+	return page
+}
+
+// search runs a pool search within the configured timeout, guarded by the
+// circuit breaker. A search that times out, on either side, returns
+// ErrSearchTimeout rather than partial results.
+func (r *Repository) search(ctx context.Context, query map[string]interface{}) (*searchResponse, error) {
+	var result *searchResponse
+	err := r.guard(ctx, func() error {
+		var err error
+		result, err = r.doSearch(ctx, query)
+		return err
+	})
+	return result, err
+}
+
+func (r *Repository) doSearch(ctx context.Context, query map[string]interface{}) (*searchResponse, error) {
+	if r.searchTimeout > 0 {
+		query["timeout"] = formatInterval(r.searchTimeout)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.searchTimeout+searchTimeoutSlack)
+		defer cancel()
+	}
 
 	// Serialize query
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		return nil, 0, fmt.Errorf("failed to encode query: %w", err)
+		return nil, fmt.Errorf("failed to encode query: %w", err)
 	}
 
 	// Execute search
@@ -237,31 +431,27 @@ func (r *Repository) SearchPools(ctx context.Context, filter models.PoolFilter)
 		r.client.Search.WithTrackTotalHits(true),
 	)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search pools: %w", err)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+			return nil, fmt.Errorf("%w after %s", ErrSearchTimeout, r.searchTimeout+searchTimeoutSlack)
+		}
+		return nil, fmt.Errorf("failed to search pools: %w", err)
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		return nil, 0, fmt.Errorf("search error: %s", res.String())
+		return nil, &statusError{op: "search error", status: res.StatusCode, body: res.String()}
 	}
 
 	// Parse response
 	var result searchResponse
 	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
-
-	pools := make([]models.Pool, 0, len(result.Hits.Hits))
-	for _, hit := range result.Hits.Hits {
-		var pool models.Pool
-		if err := json.Unmarshal(hit.Source, &pool); err != nil {
-			log.Warn().Err(err).Str("id", hit.ID).Msg("Failed to unmarshal pool")
-			continue
-		}
-		pools = append(pools, pool)
+	if result.TimedOut {
+		return nil, fmt.Errorf("%w after %s", ErrSearchTimeout, r.searchTimeout)
 	}
 
-	return pools, result.Hits.Total.Value, nil
+	return &result, nil
 }
 
 // buildPoolSearchQuery builds an ElasticSearch query from filter parameters
@@ -292,28 +482,39 @@ func buildPoolSearchQuery(filter models.PoolFilter) map[string]interface{} {
 		})
 	}
 
-	// Symbol search (fuzzy match)
+	// Symbol search (exact matches ranked above fuzzy ones). With exact
+	// only the exact and whole-token tiers match.
 	if filter.Symbol != "" {
-		must = append(must, map[string]interface{}{
-			"match": map[string]interface{}{
-				"symbol": map[string]interface{}{
-					"query":     filter.Symbol,
-					"fuzziness": "AUTO",
+		var fuzzy map[string]interface{}
+		if !filter.Exact {
+			fuzzy = map[string]interface{}{
+				"match": map[string]interface{}{
+					"symbol": map[string]interface{}{
+						"query":     filter.Symbol,
+						"fuzziness": "AUTO",
+					},
 				},
-			},
-		})
+			}
+		}
+		must = append(must, symbolRelevanceQuery(filter.Symbol, fuzzy))
 	}
 
-	// General search across multiple fields
+	// General search across multiple fields. With exact the terms must
+	// appear as a phrase in one of the fields.
 	if filter.Search != "" {
-		must = append(must, map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":     filter.Search,
-				"fields":    []string{"symbol^3", "protocol^2", "chain", "pool_meta"},
-				"type":      "best_fields",
-				"fuzziness": "AUTO",
-			},
-		})
+		multiMatch := map[string]interface{}{
+			"query":     filter.Search,
+			"fields":    []string{"symbol^3", "protocol^2", "chain", "pool_meta"},
+			"type":      "best_fields",
+			"fuzziness": "AUTO",
+		}
+		if filter.Exact {
+			multiMatch["type"] = "phrase"
+			delete(multiMatch, "fuzziness")
+		}
+		must = append(must, symbolRelevanceQuery(filter.Search, map[string]interface{}{
+			"multi_match": multiMatch,
+		}))
 	}
 
 	// APY range
@@ -332,10 +533,10 @@ func buildPoolSearchQuery(filter models.PoolFilter) map[string]interface{} {
 		})
 	}
 
-	// TVL range
+	// TVL range. The listing floor raises the minimum.
 	tvlRange := make(map[string]interface{})
-	if !filter.MinTVL.IsZero() {
-		tvlRange["gte"], _ = filter.MinTVL.Float64()
+	if minTVL := decimal.Max(filter.MinTVL, filter.TVLFloor); !minTVL.IsZero() {
+		tvlRange["gte"], _ = minTVL.Float64()
 	}
 	if !filter.MaxTVL.IsZero() {
 		tvlRange["lte"], _ = filter.MaxTVL.Float64()
@@ -348,6 +549,27 @@ func buildPoolSearchQuery(filter models.PoolFilter) map[string]interface{} {
 		})
 	}
 
+	// Volume filters
+	if !filter.MinVolume1D.IsZero() {
+		minVolume, _ := filter.MinVolume1D.Float64()
+		must = append(must, map[string]interface{}{
+			"range": map[string]interface{}{
+				"volume_usd_1d": map[string]interface{}{"gte": minVolume},
+			},
+		})
+	}
+	if !filter.MinVolumeTVLRatio.IsZero() {
+		minRatio, _ := filter.MinVolumeTVLRatio.Float64()
+		must = append(must, map[string]interface{}{
+			"range": map[string]interface{}{
+				"volume_tvl_ratio": map[string]interface{}{"gte": minRatio},
+			},
+		})
+	}
+	if filter.SustainableOnly {
+		must = append(must, sustainableQuery(filter.Sustainability))
+	}
+
 	// Stablecoin filter
 	if filter.StableCoin != nil {
 		must = append(must, map[string]interface{}{
@@ -357,13 +579,47 @@ func buildPoolSearchQuery(filter models.PoolFilter) map[string]interface{} {
 		})
 	}
 
+	// Data source filter
+	if filter.DataSource != "" {
+		must = append(must, map[string]interface{}{
+			"term": map[string]interface{}{
+				"data_source": filter.DataSource,
+			},
+		})
+	}
+
+	// Tag filter: pools must carry every tag
+	for _, tag := range filter.Tags {
+		must = append(must, map[string]interface{}{
+			"term": map[string]interface{}{
+				"tags": tag,
+			},
+		})
+	}
+
+	// Outliers are left out unless asked for. must_not keeps documents
+	// indexed before the flag existed.
+	var mustNot []map[string]interface{}
+	if !filter.IncludeOutliers {
+		mustNot = append(mustNot, map[string]interface{}{
+			"term": map[string]interface{}{
+				"is_outlier": true,
+			},
+		})
+	}
+
 	// Build query
 	var boolQuery map[string]interface{}
-	if len(must) > 0 {
+	if len(must) > 0 || len(mustNot) > 0 {
+		clauses := make(map[string]interface{})
+		if len(must) > 0 {
+			clauses["must"] = must
+		}
+		if len(mustNot) > 0 {
+			clauses["must_not"] = mustNot
+		}
 		boolQuery = map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": must,
-			},
+			"bool": clauses,
 		}
 	} else {
 		boolQuery = map[string]interface{}{
@@ -371,31 +627,184 @@ func buildPoolSearchQuery(filter models.PoolFilter) map[string]interface{} {
 		}
 	}
 
-	// Build sort
-	sortField := "tvl"
-	switch filter.SortBy {
-	case "apy":
-		sortField = "apy"
-	case "score":
-		sortField = "score"
+	// Freshness-decayed ranking: replace the relevance score with the stored
+	// score multiplied by an exponential decay on updated_at, then sort on _score
+	decayed := filter.RankMode == models.RankModeDecayed && filter.SortBy == "score"
+	if decayed {
+		boolQuery = buildDecayedScoreQuery(boolQuery, filter.DecayScale)
+	}
+
+	query := map[string]interface{}{
+		"query": boolQuery,
+		"sort":  buildPoolSort(filter.SortKeys(), decayed),
+		"from":  filter.Offset,
+		"size":  filter.Limit,
 	}
 
-	sortOrder := "desc"
-	if filter.SortOrder == "asc" {
-		sortOrder = "asc"
+	// Show which fields a general search matched
+	if filter.Search != "" {
+		query["highlight"] = searchHighlight()
+	}
+
+	return query
+}
+
+// highlightFields maps the document fields highlighted for a general search
+// to the pool JSON names they are returned under
+var highlightFields = map[string]string{
+	"symbol":    "symbol",
+	"protocol":  "protocol",
+	"pool_meta": "poolMeta",
+}
+
+// searchHighlight builds the highlight section of a general search. The
+// fields are short, so each is returned whole with its matches marked.
+func searchHighlight() map[string]interface{} {
+	fields := make(map[string]interface{}, len(highlightFields))
+	for field := range highlightFields {
+		fields[field] = map[string]interface{}{"number_of_fragments": 0}
 	}
 
 	return map[string]interface{}{
-		"query": boolQuery,
-		"sort": []map[string]interface{}{
-			{
-				sortField: map[string]interface{}{
-					"order": sortOrder,
+		"pre_tags":  []string{"<em>"},
+		"post_tags": []string{"</em>"},
+		"fields":    fields,
+	}
+}
+
+// Boosts of the symbol relevance tiers. Each clause scores a constant, so an
+// exact match (all three) scores 7, a whole-token match 3 and a fuzzy match 1.
+const (
+	exactMatchBoost   = 4
+	partialMatchBoost = 2
+	fuzzyMatchBoost   = 1
+)
+
+// symbolRelevanceQuery wraps a fuzzy clause so that documents whose symbol
+// equals the query, ignoring case, score above those containing it as a whole
+// token, which score above fuzzy matches such as USDD for USDC. Matching
+// documents are the same as for the fuzzy clause alone plus exact matches.
+// A nil fuzzy clause leaves only the exact and whole-token tiers.
+func symbolRelevanceQuery(query string, fuzzy map[string]interface{}) map[string]interface{} {
+	constantScore := func(filter map[string]interface{}, boost float64) map[string]interface{} {
+		return map[string]interface{}{
+			"constant_score": map[string]interface{}{
+				"filter": filter,
+				"boost":  boost,
+			},
+		}
+	}
+
+	should := []map[string]interface{}{
+		constantScore(map[string]interface{}{
+			"term": map[string]interface{}{
+				"symbol.keyword": map[string]interface{}{
+					"value":            query,
+					"case_insensitive": true,
 				},
 			},
+		}, exactMatchBoost),
+		constantScore(map[string]interface{}{
+			"match_phrase": map[string]interface{}{"symbol": query},
+		}, partialMatchBoost),
+	}
+	if fuzzy != nil {
+		should = append(should, constantScore(fuzzy, fuzzyMatchBoost))
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// poolSortFields maps pool sort fields to sortable document fields
+var poolSortFields = map[string]string{
+	"apy":        "apy",
+	"tvl":        "tvl",
+	"score":      "score",
+	"updated_at": "updated_at",
+	"chain":      "chain.keyword",
+	"protocol":   "protocol.keyword",
+	"stablecoin": "stablecoin",
+	"relevance":  "_score",
+}
+
+// buildPoolSort builds the sort clauses for pool sort keys, matching the
+// PostgreSQL ORDER BY: unknown fields are skipped, defaulting to TVL
+// descending, and id breaks ties. With decayed set, score sorts use _score.
+func buildPoolSort(keys []models.SortKey, decayed bool) []map[string]interface{} {
+	clauses := make([]map[string]interface{}, 0, len(keys)+1)
+	for _, key := range keys {
+		field, ok := poolSortFields[key.Field]
+		if !ok {
+			continue
+		}
+		if key.Field == "score" && decayed {
+			field = "_score"
+		}
+
+		order := "desc"
+		if key.Order == "asc" {
+			order = "asc"
+		}
+		clauses = append(clauses, map[string]interface{}{
+			field: map[string]interface{}{"order": order},
+		})
+	}
+
+	if len(clauses) == 0 {
+		clauses = append(clauses, map[string]interface{}{
+			"tvl": map[string]interface{}{"order": "desc"},
+		})
+	}
+	return append(clauses, map[string]interface{}{
+		"id": map[string]interface{}{"order": "asc"},
+	})
+}
+
+// defaultDecayScale is used when no freshness decay scale is configured
+const defaultDecayScale = 6 * time.Hour
+
+// buildDecayedScoreQuery wraps a query in a function_score that ranks documents
+// by score * exp(-age / scale), age being the time since updated_at: the exp
+// function with a decay of 1/e at the configured scale, so a pool untouched
+// for one scale period keeps 37% of its score.
+//
+// exp rather than gauss: PostgreSQL, which serves the listing when
+// ElasticSearch is down, has exp() but no gauss decay to match it with. On
+// the same curve a page ranks the same whichever backend served it, instead
+// of reordering on failover.
+func buildDecayedScoreQuery(query map[string]interface{}, scale time.Duration) map[string]interface{} {
+	if scale <= 0 {
+		scale = defaultDecayScale
+	}
+
+	return map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query": query,
+			"functions": []map[string]interface{}{
+				{
+					"field_value_factor": map[string]interface{}{
+						"field":   "score",
+						"missing": 0,
+					},
+				},
+				{
+					"exp": map[string]interface{}{
+						"updated_at": map[string]interface{}{
+							"origin": "now",
+							"scale":  fmt.Sprintf("%ds", int64(scale.Seconds())),
+							"decay":  math.Exp(-1),
+						},
+					},
+				},
+			},
+			"score_mode": "multiply",
+			"boost_mode": "replace",
 		},
-		"from": filter.Offset,
-		"size": filter.Limit,
 	}
 }
 
@@ -433,6 +842,11 @@ func (r *Repository) IndexPool(ctx context.Context, pool *models.Pool) error {
 
 // BulkIndexPools indexes multiple pools efficiently
 func (r *Repository) BulkIndexPools(ctx context.Context, pools []models.Pool) error {
+	return r.BulkIndexPoolsInto(ctx, IndexPools, pools)
+}
+
+// BulkIndexPoolsInto bulk indexes pools into the given index or alias
+func (r *Repository) BulkIndexPoolsInto(ctx context.Context, index string, pools []models.Pool) error {
 	if len(pools) == 0 {
 		return nil
 	}
@@ -443,7 +857,7 @@ func (r *Repository) BulkIndexPools(ctx context.Context, pools []models.Pool) er
 		// Action line
 		meta := map[string]interface{}{
 			"index": map[string]interface{}{
-				"_index": IndexPools,
+				"_index": index,
 				"_id":    pool.ID,
 			},
 		}
@@ -472,7 +886,7 @@ func (r *Repository) BulkIndexPools(ctx context.Context, pools []models.Pool) er
 		return fmt.Errorf("bulk indexing error: %s", res.String())
 	}
 
-	log.Info().Int("count", len(pools)).Msg("Bulk indexed pools")
+	log.Info().Int("count", len(pools)).Str("index", index).Msg("Bulk indexed pools")
 	return nil
 }
 
@@ -523,57 +937,143 @@ func (r *Repository) RefreshIndex(ctx context.Context, index string) error {
 // Analytics Operations
 // =============================================================================
 
-// GetPoolAggregations returns aggregated pool statistics
-func (r *Repository) GetPoolAggregations(ctx context.Context) (map[string]interface{}, error) {
+// apyRanges are the APYDistribution buckets, matching the PostgreSQL stats
+// query: lower bounds inclusive, upper bounds exclusive
+var apyRanges = []struct {
+	key      string
+	from, to float64 // to is 0 for the open-ended last range
+}{
+	{"0-1", 0, 1},
+	{"1-5", 1, 5},
+	{"5-10", 5, 10},
+	{"10-25", 10, 25},
+	{"25-50", 25, 50},
+	{"50-100", 50, 100},
+	{"100+", 100, 0},
+}
+
+// maxStatsChains bounds the per-chain TVL buckets. It is well above the
+// number of chains DeFiLlama tracks, so every chain gets a bucket.
+const maxStatsChains = 500
+
+// platformStatsQuery builds the aggregation-only search behind
+// GetPlatformStats, over the pools with at least minTVL of TVL
+func platformStatsQuery(minTVL decimal.Decimal) map[string]interface{} {
+	ranges := make([]map[string]interface{}, len(apyRanges))
+	for i, r := range apyRanges {
+		ranges[i] = map[string]interface{}{"key": r.key, "from": r.from}
+		if r.to > 0 {
+			ranges[i]["to"] = r.to
+		}
+	}
+
 	query := map[string]interface{}{
-		"size": 0,
+		"size":             0,
+		"track_total_hits": true,
 		"aggs": map[string]interface{}{
+			"total_tvl":  map[string]interface{}{"sum": map[string]interface{}{"field": "tvl"}},
+			"avg_apy":    map[string]interface{}{"avg": map[string]interface{}{"field": "apy"}},
+			"max_apy":    map[string]interface{}{"max": map[string]interface{}{"field": "apy"}},
+			"median_apy": map[string]interface{}{"percentiles": map[string]interface{}{"field": "apy", "percents": []float64{50}}},
+			"protocol_count": map[string]interface{}{
+				"cardinality": map[string]interface{}{"field": "protocol.keyword", "precision_threshold": 40000},
+			},
 			"chains": map[string]interface{}{
-				"terms": map[string]interface{}{
-					"field": "chain",
-					"size":  100,
-				},
+				"terms": map[string]interface{}{"field": "chain.keyword", "size": maxStatsChains},
 				"aggs": map[string]interface{}{
-					"total_tvl": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "tvl",
-						},
-					},
-					"avg_apy": map[string]interface{}{
-						"avg": map[string]interface{}{
-							"field": "apy",
-						},
-					},
+					"total_tvl": map[string]interface{}{"sum": map[string]interface{}{"field": "tvl"}},
 				},
 			},
-			"protocols": map[string]interface{}{
-				"terms": map[string]interface{}{
-					"field": "protocol",
-					"size":  100,
+			// Outliers sit at the clamp bounds and would skew the distribution
+			"apy_ranges": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"must_not": map[string]interface{}{"term": map[string]interface{}{"is_outlier": true}},
+					},
 				},
 				"aggs": map[string]interface{}{
-					"total_tvl": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "tvl",
-						},
+					"ranges": map[string]interface{}{
+						"range": map[string]interface{}{"field": "apy", "ranges": ranges},
 					},
 				},
 			},
-			"total_tvl": map[string]interface{}{
-				"sum": map[string]interface{}{
-					"field": "tvl",
-				},
-			},
-			"avg_apy": map[string]interface{}{
-				"avg": map[string]interface{}{
-					"field": "apy",
-				},
-			},
 		},
 	}
 
+	if minTVL.IsPositive() {
+		floor, _ := minTVL.Float64()
+		query["query"] = map[string]interface{}{
+			"range": map[string]interface{}{"tvl": map[string]interface{}{"gte": floor}},
+		}
+	}
+	return query
+}
+
+// platformStatsResponse is the part of the platformStatsQuery response
+// GetPlatformStats reads. Metrics over no documents are null.
+type platformStatsResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		TotalTVL struct {
+			Value float64 `json:"value"`
+		} `json:"total_tvl"`
+		AvgAPY struct {
+			Value *float64 `json:"value"`
+		} `json:"avg_apy"`
+		MaxAPY struct {
+			Value *float64 `json:"value"`
+		} `json:"max_apy"`
+		MedianAPY struct {
+			Values map[string]*float64 `json:"values"`
+		} `json:"median_apy"`
+		ProtocolCount struct {
+			Value int `json:"value"`
+		} `json:"protocol_count"`
+		Chains struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+				TotalTVL struct {
+					Value float64 `json:"value"`
+				} `json:"total_tvl"`
+			} `json:"buckets"`
+		} `json:"chains"`
+		APYRanges struct {
+			Ranges struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"ranges"`
+		} `json:"apy_ranges"`
+	} `json:"aggregations"`
+}
+
+// GetPlatformStats computes the pool figures of the platform stats from the
+// pools index: totals, APY summary, per-chain TVL and pool counts, and the
+// APY distribution. ActiveOpportunities is left for the caller. The protocol
+// count is approximate above 40,000 protocols. Guarded by the circuit
+// breaker like pool searches.
+func (r *Repository) GetPlatformStats(ctx context.Context, minTVL decimal.Decimal) (*models.PlatformStats, error) {
+	var stats *models.PlatformStats
+	err := r.guard(ctx, func() error {
+		var err error
+		stats, err = r.getPlatformStats(ctx, minTVL)
+		return err
+	})
+	return stats, err
+}
+
+func (r *Repository) getPlatformStats(ctx context.Context, minTVL decimal.Decimal) (*models.PlatformStats, error) {
+	ctx, cancel := r.withRequestTimeout(ctx)
+	defer cancel()
+
 	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+	if err := json.NewEncoder(&buf).Encode(platformStatsQuery(minTVL)); err != nil {
 		return nil, err
 	}
 
@@ -583,16 +1083,68 @@ func (r *Repository) GetPoolAggregations(ctx context.Context) (map[string]interf
 		r.client.Search.WithBody(&buf),
 	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to aggregate pool stats: %w", err)
 	}
 	defer res.Body.Close()
 
-	var result map[string]interface{}
+	if res.IsError() {
+		return nil, &statusError{op: "failed to aggregate pool stats", status: res.StatusCode, body: res.String()}
+	}
+
+	var result platformStatsResponse
 	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to decode pool stats: %w", err)
 	}
 
-	return result, nil
+	return result.platformStats(), nil
+}
+
+// platformStats converts the aggregation response to the PlatformStats shape
+// the PostgreSQL stats query returns
+func (resp platformStatsResponse) platformStats() *models.PlatformStats {
+	aggs := resp.Aggregations
+	optional := func(v *float64) decimal.Decimal {
+		if v == nil {
+			return decimal.Zero
+		}
+		return decimal.NewFromFloat(*v)
+	}
+
+	stats := &models.PlatformStats{
+		TotalPools:     resp.Hits.Total.Value,
+		TotalTVL:       decimal.NewFromFloat(aggs.TotalTVL.Value),
+		AverageAPY:     optional(aggs.AvgAPY.Value),
+		MedianAPY:      optional(aggs.MedianAPY.Values["50.0"]),
+		MaxAPY:         optional(aggs.MaxAPY.Value),
+		TotalChains:    len(aggs.Chains.Buckets),
+		TotalProtocols: aggs.ProtocolCount.Value,
+		LastUpdated:    time.Now().UTC().Format(time.RFC3339),
+		TVLByChain:     make(map[string]decimal.Decimal, len(aggs.Chains.Buckets)),
+		PoolsByChain:   make(map[string]int, len(aggs.Chains.Buckets)),
+	}
+
+	for _, bucket := range aggs.Chains.Buckets {
+		stats.TVLByChain[bucket.Key] = decimal.NewFromFloat(bucket.TotalTVL.Value)
+		stats.PoolsByChain[bucket.Key] = bucket.DocCount
+	}
+
+	dist := &stats.APYDistribution
+	counts := map[string]*int{
+		"0-1":    &dist.Range0to1,
+		"1-5":    &dist.Range1to5,
+		"5-10":   &dist.Range5to10,
+		"10-25":  &dist.Range10to25,
+		"25-50":  &dist.Range25to50,
+		"50-100": &dist.Range50to100,
+		"100+":   &dist.Range100Plus,
+	}
+	for _, bucket := range aggs.APYRanges.Ranges.Buckets {
+		if count, ok := counts[bucket.Key]; ok {
+			*count = bucket.DocCount
+		}
+	}
+
+	return stats
 }
 
 // =============================================================================
@@ -601,17 +1153,65 @@ func (r *Repository) GetPoolAggregations(ctx context.Context) (map[string]interf
 
 // searchResponse represents an ElasticSearch search response
 type searchResponse struct {
-	Hits struct {
+	TimedOut bool `json:"timed_out"`
+	Hits     struct {
 		Total struct {
 			Value int64 `json:"value"`
 		} `json:"total"`
-		Hits []struct {
-			ID     string          `json:"_id"`
-			Source json.RawMessage `json:"_source"`
-		} `json:"hits"`
+		Hits []searchHit `json:"hits"`
 	} `json:"hits"`
 }
 
+// searchHit is a single hit of a search response
+type searchHit struct {
+	ID        string              `json:"_id"`
+	Source    json.RawMessage     `json:"_source"`
+	Highlight map[string][]string `json:"highlight"`
+	Sort      json.RawMessage     `json:"sort"`
+}
+
+// pool decodes the pool document of a hit, logging documents that can't be
+// decoded
+func (h searchHit) pool() (models.Pool, bool) {
+	var pool models.Pool
+	if err := json.Unmarshal(h.Source, &pool); err != nil {
+		log.Warn().Err(err).Str("id", h.ID).Msg("Failed to unmarshal pool")
+		return models.Pool{}, false
+	}
+	pool.VolumeTVLRatio = models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL)
+
+	// The outlier flag and the APY composition are indexed under their
+	// document names
+	var doc struct {
+		IsOutlier bool            `json:"is_outlier"`
+		APYBase   decimal.Decimal `json:"apy_base"`
+		APYReward decimal.Decimal `json:"apy_reward"`
+	}
+	if err := json.Unmarshal(h.Source, &doc); err == nil {
+		pool.IsOutlier = doc.IsOutlier
+		pool.APYBase = doc.APYBase
+		pool.APYReward = doc.APYReward
+	}
+	pool.BaseRatio = models.CalculateBaseRatio(pool.APYBase, pool.APY)
+	return pool, true
+}
+
+// highlights returns the highlighted fragments of a hit keyed by pool JSON
+// name, or nil when nothing was highlighted
+func (h searchHit) highlights() map[string][]string {
+	if len(h.Highlight) == 0 {
+		return nil
+	}
+
+	out := make(map[string][]string, len(h.Highlight))
+	for field, fragments := range h.Highlight {
+		if name, ok := highlightFields[field]; ok {
+			out[name] = fragments
+		}
+	}
+	return out
+}
+
 // esDocument represents a pool document for ElasticSearch
 type esDocument struct {
 	ID               string   `json:"id"`
@@ -620,6 +1220,7 @@ type esDocument struct {
 	Symbol           string   `json:"symbol"`
 	TVL              float64  `json:"tvl"`
 	APY              float64  `json:"apy"`
+	APYRaw           float64  `json:"apy_raw"`
 	APYBase          float64  `json:"apy_base"`
 	APYReward        float64  `json:"apy_reward"`
 	RewardTokens     []string `json:"reward_tokens"`
@@ -629,12 +1230,18 @@ type esDocument struct {
 	APYMean30D       float64  `json:"apy_mean_30d"`
 	VolumeUSD1D      float64  `json:"volume_usd_1d"`
 	VolumeUSD7D      float64  `json:"volume_usd_7d"`
+	VolumeTVLRatio   float64  `json:"volume_tvl_ratio"`
+	BaseRatio        float64  `json:"base_ratio"`
 	Score            float64  `json:"score"`
 	APYChange1H      float64  `json:"apy_change_1h"`
 	APYChange24H     float64  `json:"apy_change_24h"`
 	APYChange7D      float64  `json:"apy_change_7d"`
 	StableCoin       bool     `json:"stablecoin"`
 	Exposure         string   `json:"exposure"`
+	DataSource       string   `json:"data_source"`
+	DataCompleteness float64  `json:"data_completeness"`
+	IsOutlier        bool     `json:"is_outlier"`
+	Tags             []string `json:"tags"`
 	CreatedAt        string   `json:"created_at"`
 	UpdatedAt        string   `json:"updated_at"`
 }
@@ -648,6 +1255,7 @@ func poolToDocument(pool *models.Pool) esDocument {
 		Symbol:           pool.Symbol,
 		TVL:              decimalToFloat(pool.TVL),
 		APY:              decimalToFloat(pool.APY),
+		APYRaw:           decimalToFloat(pool.APYRaw),
 		APYBase:          decimalToFloat(pool.APYBase),
 		APYReward:        decimalToFloat(pool.APYReward),
 		RewardTokens:     pool.RewardTokens,
@@ -657,17 +1265,48 @@ func poolToDocument(pool *models.Pool) esDocument {
 		APYMean30D:       decimalToFloat(pool.APYMean30D),
 		VolumeUSD1D:      decimalToFloat(pool.VolumeUSD1D),
 		VolumeUSD7D:      decimalToFloat(pool.VolumeUSD7D),
+		VolumeTVLRatio:   decimalToFloat(models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL)),
+		BaseRatio:        decimalToFloat(models.CalculateBaseRatio(pool.APYBase, pool.APY)),
 		Score:            decimalToFloat(pool.Score),
 		APYChange1H:      decimalToFloat(pool.APYChange1H),
 		APYChange24H:     decimalToFloat(pool.APYChange24H),
 		APYChange7D:      decimalToFloat(pool.APYChange7D),
 		StableCoin:       pool.StableCoin,
 		Exposure:         pool.Exposure,
+		DataSource:       pool.DataSource,
+		DataCompleteness: decimalToFloat(pool.DataCompleteness),
+		IsOutlier:        pool.IsOutlier,
+		Tags:             pool.Tags,
 		CreatedAt:        pool.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:        pool.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
 
+// sustainableQuery matches pools whose yield is sustainable by the indexed
+// base ratio, or by base APY alone when that floor is set. Documents indexed
+// before base_ratio existed match neither until the pools are reindexed.
+func sustainableQuery(s models.SustainableYield) map[string]interface{} {
+	ratio := map[string]interface{}{
+		"range": map[string]interface{}{
+			"base_ratio": map[string]interface{}{"gte": decimalToFloat(s.MinBaseRatio)},
+		},
+	}
+	if !s.MinBaseAPY.IsPositive() {
+		return ratio
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				ratio,
+				{"range": map[string]interface{}{
+					"apy_base": map[string]interface{}{"gte": decimalToFloat(s.MinBaseAPY)},
+				}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
 func decimalToFloat(d decimal.Decimal) float64 {
 	f, _ := d.Float64()
 	return f
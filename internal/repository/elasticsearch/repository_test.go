@@ -0,0 +1,963 @@
+package elasticsearch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestBuildPoolSearchQuery_StandardScoreSort(t *testing.T) {
+	filter := models.PoolFilter{
+		SortBy:    "score",
+		SortOrder: "desc",
+		RankMode:  models.RankModeStandard,
+		Limit:     50,
+	}
+
+	query := buildPoolSearchQuery(filter)
+
+	q := query["query"].(map[string]interface{})
+	if _, ok := q["function_score"]; ok {
+		t.Fatal("Expected no function_score in standard rank mode")
+	}
+
+	sortClause := query["sort"].([]map[string]interface{})
+	if _, ok := sortClause[0]["score"]; !ok {
+		t.Errorf("Expected sort on score, got %v", sortClause)
+	}
+}
+
+func TestBuildPoolSearchQuery_DecayedRequiresScoreSort(t *testing.T) {
+	filter := models.PoolFilter{
+		SortBy:     "tvl",
+		SortOrder:  "desc",
+		RankMode:   models.RankModeDecayed,
+		DecayScale: time.Hour,
+		Limit:      50,
+	}
+
+	query := buildPoolSearchQuery(filter)
+
+	q := query["query"].(map[string]interface{})
+	if _, ok := q["function_score"]; ok {
+		t.Fatal("Expected decayed rank mode to be ignored when not sorting by score")
+	}
+}
+
+func TestBuildPoolSearchQuery_DecayedScoreSort(t *testing.T) {
+	filter := models.PoolFilter{
+		Chain:      "ethereum",
+		SortBy:     "score",
+		SortOrder:  "desc",
+		RankMode:   models.RankModeDecayed,
+		DecayScale: 2 * time.Hour,
+		Limit:      50,
+	}
+
+	query := buildPoolSearchQuery(filter)
+
+	q := query["query"].(map[string]interface{})
+	fs, ok := q["function_score"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected function_score query, got %v", q)
+	}
+	if _, ok := fs["query"].(map[string]interface{})["bool"]; !ok {
+		t.Errorf("Expected filters to be preserved inside function_score")
+	}
+	if fs["boost_mode"] != "replace" || fs["score_mode"] != "multiply" {
+		t.Errorf("Unexpected function_score modes: %v / %v", fs["boost_mode"], fs["score_mode"])
+	}
+
+	functions := fs["functions"].([]map[string]interface{})
+	decay := functions[1]["exp"].(map[string]interface{})["updated_at"].(map[string]interface{})
+	if decay["scale"] != "7200s" {
+		t.Errorf("Expected scale 7200s, got %v", decay["scale"])
+	}
+
+	sortClause := query["sort"].([]map[string]interface{})
+	if _, ok := sortClause[0]["_score"]; !ok {
+		t.Errorf("Expected sort on _score, got %v", sortClause)
+	}
+}
+
+func TestBuildDecayedScoreQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		scale     time.Duration
+		wantScale string
+	}{
+		{"configured", 2 * time.Hour, "7200s"},
+		{"zero uses default", 0, "21600s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildDecayedScoreQuery(map[string]interface{}{"match_all": map[string]interface{}{}}, tt.scale)
+
+			got, err := json.Marshal(query)
+			if err != nil {
+				t.Fatalf("Failed to marshal query: %v", err)
+			}
+
+			// exp with a decay of 1/e at scale is exp(-age / scale), the
+			// curve PostgreSQL ranks by
+			want := `{"function_score":{` +
+				`"boost_mode":"replace",` +
+				`"functions":[` +
+				`{"field_value_factor":{"field":"score","missing":0}},` +
+				`{"exp":{"updated_at":{"decay":` + strconv.FormatFloat(math.Exp(-1), 'g', -1, 64) + `,"origin":"now","scale":"` + tt.wantScale + `"}}}` +
+				`],` +
+				`"query":{"match_all":{}},` +
+				`"score_mode":"multiply"}}`
+			if string(got) != want {
+				t.Errorf("Expected query\n%s\ngot\n%s", want, got)
+			}
+		})
+	}
+}
+
+// decayedScore computes the _score ElasticSearch gives a document with the
+// given stored score and age under a buildDecayedScoreQuery query: the
+// field_value_factor times the exp decay of
+// exp(ln(decay) / scale * age), multiplied and replacing the query score
+func decayedScore(t *testing.T, query map[string]interface{}, score float64, age time.Duration) float64 {
+	t.Helper()
+
+	fs := query["function_score"].(map[string]interface{})
+	if fs["score_mode"] != "multiply" || fs["boost_mode"] != "replace" {
+		t.Fatalf("Expected functions multiplied, replacing the query score, got %v", fs)
+	}
+	functions := fs["functions"].([]map[string]interface{})
+	if field := functions[0]["field_value_factor"].(map[string]interface{})["field"]; field != "score" {
+		t.Fatalf("Expected a factor of the score field, got %v", field)
+	}
+	decay := functions[1]["exp"].(map[string]interface{})["updated_at"].(map[string]interface{})
+	scale, err := time.ParseDuration(decay["scale"].(string))
+	if err != nil {
+		t.Fatalf("Invalid scale %v: %v", decay["scale"], err)
+	}
+
+	lambda := math.Log(decay["decay"].(float64)) / scale.Seconds()
+	return score * math.Exp(lambda*age.Seconds())
+}
+
+func TestDecayedRankingFlipsOrder(t *testing.T) {
+	type doc struct {
+		id    string
+		score float64
+		age   time.Duration
+	}
+	// Equal scores; "a-stale" sorts first on stored score by the ID tiebreak
+	docs := []doc{
+		{id: "b-fresh", score: 80, age: 5 * time.Minute},
+		{id: "a-stale", score: 80, age: 12 * time.Hour},
+	}
+	standard := append([]doc(nil), docs...)
+	sort.SliceStable(standard, func(i, j int) bool {
+		if standard[i].score != standard[j].score {
+			return standard[i].score > standard[j].score
+		}
+		return standard[i].id < standard[j].id
+	})
+	if standard[0].id != "a-stale" {
+		t.Fatalf("Expected stored-score order to rank a-stale first, got %s", standard[0].id)
+	}
+
+	query := buildDecayedScoreQuery(map[string]interface{}{"match_all": map[string]interface{}{}}, 6*time.Hour)
+	decayed := append([]doc(nil), docs...)
+	sort.SliceStable(decayed, func(i, j int) bool {
+		return decayedScore(t, query, decayed[i].score, decayed[i].age) > decayedScore(t, query, decayed[j].score, decayed[j].age)
+	})
+	if decayed[0].id != "b-fresh" {
+		t.Errorf("Expected decayed order to rank b-fresh first, got %s", decayed[0].id)
+	}
+
+	// One scale period keeps 1/e of the score, as in PostgreSQL
+	if got := decayedScore(t, query, 80, 6*time.Hour); math.Abs(got-80/math.E) > 1e-9 {
+		t.Errorf("Expected 80/e after one scale period, got %v", got)
+	}
+}
+
+func TestBuildPoolSearchQuery_VolumeFilters(t *testing.T) {
+	filter := models.PoolFilter{
+		MinVolume1D:       decimal.NewFromInt(50000),
+		MinVolumeTVLRatio: decimal.NewFromFloat(0.05),
+		SortBy:            "tvl",
+		SortOrder:         "desc",
+		Limit:             50,
+	}
+
+	query := buildPoolSearchQuery(filter)
+
+	must := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]map[string]interface{})
+	ranges := make(map[string]interface{})
+	for _, clause := range must {
+		if r, ok := clause["range"].(map[string]interface{}); ok {
+			for field, bounds := range r {
+				ranges[field] = bounds.(map[string]interface{})["gte"]
+			}
+		}
+	}
+
+	if ranges["volume_usd_1d"] != 50000.0 {
+		t.Errorf("Expected volume_usd_1d >= 50000, got %v", ranges["volume_usd_1d"])
+	}
+	if ranges["volume_tvl_ratio"] != 0.05 {
+		t.Errorf("Expected volume_tvl_ratio >= 0.05, got %v", ranges["volume_tvl_ratio"])
+	}
+}
+
+func TestBuildPoolSearchQuery_Outliers(t *testing.T) {
+	query := buildPoolSearchQuery(models.PoolFilter{SortBy: "score", SortOrder: "desc", Limit: 50})
+	boolQuery := query["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	mustNot, _ := boolQuery["must_not"].([]map[string]interface{})
+	if len(mustNot) != 1 || mustNot[0]["term"].(map[string]interface{})["is_outlier"] != true {
+		t.Errorf("Expected outliers excluded by default, got %v", boolQuery)
+	}
+	if _, ok := boolQuery["must"]; ok {
+		t.Errorf("Expected no must clauses without filters, got %v", boolQuery["must"])
+	}
+
+	query = buildPoolSearchQuery(models.PoolFilter{SortBy: "score", SortOrder: "desc", Limit: 50, IncludeOutliers: true})
+	if _, ok := query["query"].(map[string]interface{})["match_all"]; !ok {
+		t.Errorf("Expected every pool matched with includeOutliers, got %v", query["query"])
+	}
+}
+
+func TestBuildPoolSearchQuery_Tags(t *testing.T) {
+	query := buildPoolSearchQuery(models.PoolFilter{Tags: []string{"dex-lp", "liquid-staking"}, SortBy: "tvl", SortOrder: "desc", Limit: 50})
+
+	must := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]map[string]interface{})
+	var tags []interface{}
+	for _, clause := range must {
+		if term, ok := clause["term"].(map[string]interface{}); ok {
+			if tag, ok := term["tags"]; ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) != 2 || tags[0] != "dex-lp" || tags[1] != "liquid-staking" {
+		t.Errorf("Expected a term clause per tag, got %v", must)
+	}
+}
+
+// sortFixture holds pool documents with ties on every sort field, keyed by
+// their sortable field names
+var sortFixture = []map[string]interface{}{
+	{"id": "d", "chain.keyword": "polygon", "protocol.keyword": "aave-v3", "score": 70.0, "apy": 4.0, "tvl": 5e6, "stablecoin": true},
+	{"id": "a", "chain.keyword": "ethereum", "protocol.keyword": "curve", "score": 80.0, "apy": 3.0, "tvl": 9e6, "stablecoin": true},
+	{"id": "e", "chain.keyword": "polygon", "protocol.keyword": "curve", "score": 70.0, "apy": 9.0, "tvl": 1e6, "stablecoin": false},
+	{"id": "b", "chain.keyword": "ethereum", "protocol.keyword": "aave-v3", "score": 90.0, "apy": 3.0, "tvl": 2e6, "stablecoin": false},
+	{"id": "c", "chain.keyword": "ethereum", "protocol.keyword": "lido", "score": 80.0, "apy": 6.0, "tvl": 7e6, "stablecoin": true},
+}
+
+// applySort sorts the fixture the way ElasticSearch would for a list of
+// field sort clauses
+func applySort(t *testing.T, clauses []map[string]interface{}) []string {
+	t.Helper()
+
+	compare := func(a, b interface{}) int {
+		switch av := a.(type) {
+		case string:
+			return strings.Compare(av, b.(string))
+		case float64:
+			return cmp.Compare(av, b.(float64))
+		case bool:
+			// Booleans sort as 0 and 1
+			return cmp.Compare(boolToInt(av), boolToInt(b.(bool)))
+		}
+		t.Fatalf("Unsupported fixture value %v", a)
+		return 0
+	}
+
+	docs := append([]map[string]interface{}(nil), sortFixture...)
+	sort.Slice(docs, func(i, j int) bool {
+		for _, clause := range clauses {
+			for field, opts := range clause {
+				c := compare(docs[i][field], docs[j][field])
+				if c == 0 {
+					continue
+				}
+				return (c < 0) != (opts.(map[string]interface{})["order"] == "desc")
+			}
+		}
+		return false
+	})
+
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc["id"].(string)
+	}
+	return ids
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestBuildPoolSearchQuery_MultiKeySort(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  models.PoolFilter
+		wantIDs string
+	}{
+		{
+			"single key keeps working",
+			models.PoolFilter{SortBy: "tvl", SortOrder: "desc"},
+			"a,c,d,b,e",
+		},
+		{
+			"chain then score",
+			models.PoolFilter{SortBy: "chain", SortOrder: "asc", Sort: []models.SortKey{{Field: "chain", Order: "asc"}, {Field: "score", Order: "desc"}}},
+			"b,a,c,d,e",
+		},
+		{
+			"stablecoin first then apy",
+			models.PoolFilter{SortBy: "stablecoin", SortOrder: "desc", Sort: []models.SortKey{{Field: "stablecoin", Order: "desc"}, {Field: "apy", Order: "desc"}}},
+			"c,d,a,e,b",
+		},
+		{
+			"ties fall back to id",
+			models.PoolFilter{SortBy: "score", SortOrder: "desc", Sort: []models.SortKey{{Field: "score", Order: "desc"}, {Field: "chain", Order: "asc"}, {Field: "protocol", Order: "asc"}}},
+			"b,a,c,d,e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 50
+			clauses := buildPoolSearchQuery(tt.filter)["sort"].([]map[string]interface{})
+
+			last := clauses[len(clauses)-1]
+			if _, ok := last["id"]; !ok {
+				t.Errorf("Expected id as the final tiebreaker, got %v", clauses)
+			}
+			if got := strings.Join(applySort(t, clauses), ","); got != tt.wantIDs {
+				t.Errorf("Expected order %s, got %s", tt.wantIDs, got)
+			}
+		})
+	}
+}
+
+func TestBuildPoolSearchQuery_DecayedMultiKeySort(t *testing.T) {
+	filter := models.PoolFilter{
+		SortBy:    "score",
+		SortOrder: "desc",
+		Sort:      []models.SortKey{{Field: "score", Order: "desc"}, {Field: "chain", Order: "asc"}},
+		RankMode:  models.RankModeDecayed,
+		Limit:     50,
+	}
+
+	clauses := buildPoolSearchQuery(filter)["sort"].([]map[string]interface{})
+	if len(clauses) != 3 {
+		t.Fatalf("Expected _score, chain and id clauses, got %v", clauses)
+	}
+	if _, ok := clauses[0]["_score"]; !ok {
+		t.Errorf("Expected the decayed score first, got %v", clauses[0])
+	}
+	if _, ok := clauses[1]["chain.keyword"]; !ok {
+		t.Errorf("Expected chain.keyword second, got %v", clauses[1])
+	}
+}
+
+func TestPoolsIndexBody(t *testing.T) {
+	settings := indexSettings{shards: 3, replicas: 1, refreshInterval: 5 * time.Second}
+
+	for _, withAlias := range []bool{false, true} {
+		data, err := poolsIndexBody(settings, withAlias)
+		if err != nil {
+			t.Fatalf("poolsIndexBody(%v) failed: %v", withAlias, err)
+		}
+
+		var body struct {
+			Aliases  map[string]interface{} `json:"aliases"`
+			Settings struct {
+				Shards          int                    `json:"number_of_shards"`
+				Replicas        int                    `json:"number_of_replicas"`
+				RefreshInterval string                 `json:"refresh_interval"`
+				Analysis        map[string]interface{} `json:"analysis"`
+			} `json:"settings"`
+			Mappings struct {
+				Meta struct {
+					MappingVersion int `json:"mapping_version"`
+				} `json:"_meta"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"mappings"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("Invalid index body: %v", err)
+		}
+
+		if body.Mappings.Meta.MappingVersion != PoolsMappingVersion {
+			t.Errorf("Expected mapping version %d, got %d", PoolsMappingVersion, body.Mappings.Meta.MappingVersion)
+		}
+		if _, ok := body.Mappings.Properties["score"]; !ok {
+			t.Error("Expected the pool field mappings to be kept")
+		}
+		if body.Settings.Shards != 3 || body.Settings.Replicas != 1 || body.Settings.RefreshInterval != "5s" {
+			t.Errorf("Expected the configured index settings, got %+v", body.Settings)
+		}
+		if body.Settings.Analysis == nil {
+			t.Error("Expected the analysis settings to be kept")
+		}
+		if _, ok := body.Aliases[IndexPools]; ok != withAlias {
+			t.Errorf("withAlias=%v: expected alias attached %v, got %v", withAlias, withAlias, body.Aliases)
+		}
+	}
+}
+
+func TestPoolsIndexGeneration(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{PoolsIndexName(1), 1},
+		{PoolsIndexName(12), 12},
+		{IndexPools, 0},
+		{"defi_pools_vx", 0},
+	}
+
+	for _, tt := range tests {
+		if got := poolsIndexGeneration(tt.name); got != tt.want {
+			t.Errorf("poolsIndexGeneration(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIndexSettingsChanges(t *testing.T) {
+	current := map[string]string{
+		"index.number_of_shards":   "1",
+		"index.number_of_replicas": "0",
+	}
+
+	tests := []struct {
+		name         string
+		settings     indexSettings
+		want         map[string]string
+		shardsDiffer bool
+	}{
+		{"matching", indexSettings{shards: 1}, map[string]string{}, false},
+		{"replicas", indexSettings{shards: 1, replicas: 2}, map[string]string{"index.number_of_replicas": "2"}, false},
+		{"refresh interval", indexSettings{shards: 1, refreshInterval: 1500 * time.Millisecond}, map[string]string{"index.refresh_interval": "1500ms"}, false},
+		{"shards only reported", indexSettings{shards: 3}, map[string]string{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, shardsDiffer := tt.settings.changes(current)
+			if !reflect.DeepEqual(changes, tt.want) || shardsDiffer != tt.shardsDiffer {
+				t.Errorf("Expected %v (shards differ %v), got %v (%v)", tt.want, tt.shardsDiffer, changes, shardsDiffer)
+			}
+		})
+	}
+}
+
+// scoreSymbolRelevance scores a symbol against a symbolRelevanceQuery the way
+// ElasticSearch would for the indexed symbol mapping: the keyword term
+// compares case-insensitively, the phrase needs the query as a whole token of
+// the standard-tokenized symbol, and the fuzzy clause is taken to match, as
+// it does for every pool in the fixtures
+func scoreSymbolRelevance(t *testing.T, query map[string]interface{}, symbol string) float64 {
+	t.Helper()
+
+	tokens := strings.FieldsFunc(strings.ToLower(symbol), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.')
+	})
+
+	var score float64
+	for _, clause := range query["bool"].(map[string]interface{})["should"].([]map[string]interface{}) {
+		constant := clause["constant_score"].(map[string]interface{})
+		filter := constant["filter"].(map[string]interface{})
+
+		matched := true
+		if term, ok := filter["term"]; ok {
+			value := term.(map[string]interface{})["symbol.keyword"].(map[string]interface{})["value"].(string)
+			matched = strings.EqualFold(symbol, value)
+		} else if phrase, ok := filter["match_phrase"]; ok {
+			value := strings.ToLower(phrase.(map[string]interface{})["symbol"].(string))
+			matched = false
+			for _, token := range tokens {
+				matched = matched || token == value
+			}
+		}
+		if matched {
+			score += constant["boost"].(float64)
+		}
+	}
+	return score
+}
+
+func TestBuildPoolSearchQuery_SymbolRelevance(t *testing.T) {
+	filter := models.PoolFilter{
+		Symbol:    "USDC",
+		SortBy:    "relevance",
+		SortOrder: "desc",
+		Sort:      []models.SortKey{{Field: "relevance", Order: "desc"}, {Field: "tvl", Order: "desc"}},
+		Limit:     50,
+	}
+	query := buildPoolSearchQuery(filter)
+
+	clauses := query["sort"].([]map[string]interface{})
+	if len(clauses) != 3 || clauses[0]["_score"] == nil || clauses[1]["tvl"] == nil || clauses[2]["id"] == nil {
+		t.Fatalf("Expected _score, tvl and id sort clauses, got %v", clauses)
+	}
+
+	must := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]map[string]interface{})
+	relevance := must[0]
+	should := relevance["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+	if len(should) != 3 || relevance["bool"].(map[string]interface{})["minimum_should_match"] != 1 {
+		t.Fatalf("Expected exact, phrase and fuzzy should clauses, got %v", relevance)
+	}
+	fuzzy := should[2]["constant_score"].(map[string]interface{})["filter"].(map[string]interface{})
+	if fuzzy["match"].(map[string]interface{})["symbol"].(map[string]interface{})["fuzziness"] != "AUTO" {
+		t.Errorf("Expected the fuzzy clause kept, got %v", fuzzy)
+	}
+
+	// The fuzzy matches hold more TVL, so a TVL sort would list them first
+	pools := []struct {
+		symbol string
+		tvl    float64
+	}{
+		{"USDD", 900},
+		{"sUSD", 800},
+		{"USDC.e", 700},
+		{"USDC-ETH", 300},
+		{"USDC", 200},
+		{"usdc", 100},
+	}
+	sort.SliceStable(pools, func(i, j int) bool {
+		si, sj := scoreSymbolRelevance(t, relevance, pools[i].symbol), scoreSymbolRelevance(t, relevance, pools[j].symbol)
+		if si != sj {
+			return si > sj
+		}
+		return pools[i].tvl > pools[j].tvl
+	})
+
+	got := make([]string, len(pools))
+	for i, pool := range pools {
+		got[i] = pool.symbol
+	}
+	if want := "USDC,usdc,USDC-ETH,USDD,sUSD,USDC.e"; strings.Join(got, ",") != want {
+		t.Errorf("Expected order %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestBuildPoolSearchQuery_SearchRelevance(t *testing.T) {
+	filter := models.PoolFilter{Search: "usdc", SortBy: "tvl", SortOrder: "desc", Limit: 50}
+	query := buildPoolSearchQuery(filter)
+
+	must := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]map[string]interface{})
+	should := must[0]["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+	if len(should) != 3 {
+		t.Fatalf("Expected exact, phrase and fuzzy should clauses, got %v", must[0])
+	}
+	fuzzy := should[2]["constant_score"].(map[string]interface{})["filter"].(map[string]interface{})
+	if _, ok := fuzzy["multi_match"]; !ok {
+		t.Errorf("Expected the multi-field search as the fuzzy clause, got %v", fuzzy)
+	}
+
+	// An explicit sort is kept
+	if clauses := query["sort"].([]map[string]interface{}); clauses[0]["tvl"] == nil {
+		t.Errorf("Expected the TVL sort kept, got %v", clauses)
+	}
+}
+
+func TestBuildPoolSearchQuery_Exact(t *testing.T) {
+	should := func(t *testing.T, filter models.PoolFilter) []map[string]interface{} {
+		t.Helper()
+		must := buildPoolSearchQuery(filter)["query"].(map[string]interface{})["bool"].(map[string]interface{})["must"].([]map[string]interface{})
+		return must[0]["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+	}
+	encoded := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	t.Run("symbol fuzzy by default", func(t *testing.T) {
+		clauses := should(t, models.PoolFilter{Symbol: "ETH", Limit: 50})
+		if len(clauses) != 3 || !strings.Contains(encoded(clauses[2]), `"fuzziness":"AUTO"`) {
+			t.Errorf("Expected a fuzzy third clause, got %s", encoded(clauses))
+		}
+	})
+
+	t.Run("symbol exact", func(t *testing.T) {
+		clauses := should(t, models.PoolFilter{Symbol: "ETH", Exact: true, Limit: 50})
+		if len(clauses) != 2 || strings.Contains(encoded(clauses), "fuzziness") {
+			t.Fatalf("Expected only the term and phrase clauses, got %s", encoded(clauses))
+		}
+		if !strings.Contains(encoded(clauses[0]), `"symbol.keyword"`) || !strings.Contains(encoded(clauses[1]), `"match_phrase"`) {
+			t.Errorf("Expected a keyword term then a phrase match, got %s", encoded(clauses))
+		}
+	})
+
+	t.Run("search fuzzy by default", func(t *testing.T) {
+		clauses := should(t, models.PoolFilter{Search: "aave", Limit: 50})
+		multiMatch := clauses[2]["constant_score"].(map[string]interface{})["filter"].(map[string]interface{})["multi_match"].(map[string]interface{})
+		if multiMatch["fuzziness"] != "AUTO" || multiMatch["type"] != "best_fields" {
+			t.Errorf("Expected a fuzzy best_fields search, got %v", multiMatch)
+		}
+	})
+
+	t.Run("search exact", func(t *testing.T) {
+		clauses := should(t, models.PoolFilter{Search: "aave", Exact: true, Limit: 50})
+		multiMatch := clauses[2]["constant_score"].(map[string]interface{})["filter"].(map[string]interface{})["multi_match"].(map[string]interface{})
+		if _, ok := multiMatch["fuzziness"]; ok || multiMatch["type"] != "phrase" {
+			t.Errorf("Expected a phrase search without fuzziness, got %v", multiMatch)
+		}
+	})
+}
+
+func TestBuildPoolSearchQuery_Highlight(t *testing.T) {
+	if query := buildPoolSearchQuery(models.PoolFilter{Symbol: "usdc", Limit: 50}); query["highlight"] != nil {
+		t.Errorf("Expected no highlight without a general search, got %v", query["highlight"])
+	}
+
+	query := buildPoolSearchQuery(models.PoolFilter{Search: "aave", Limit: 50})
+	highlight, ok := query["highlight"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a highlight section for a general search, got %v", query)
+	}
+	fields := highlight["fields"].(map[string]interface{})
+	for _, field := range []string{"symbol", "protocol", "pool_meta"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("Expected %s highlighted, got %v", field, fields)
+		}
+	}
+	if len(fields) != 3 {
+		t.Errorf("Expected only symbol, protocol and pool_meta highlighted, got %v", fields)
+	}
+}
+
+func TestSearchHit_Highlights(t *testing.T) {
+	body := `{"hits": {"total": {"value": 2}, "hits": [
+		{"_id": "a", "_source": {"id": "a", "symbol": "USDC"},
+		 "highlight": {"protocol": ["<em>aave</em>-v3"], "pool_meta": ["<em>Aave</em> lending"], "chain": ["ignored"]}},
+		{"_id": "b", "_source": {"id": "b", "symbol": "DAI"}}
+	]}}`
+
+	var result searchResponse
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	got := result.Hits.Hits[0].highlights()
+	want := map[string][]string{
+		"protocol": {"<em>aave</em>-v3"},
+		"poolMeta": {"<em>Aave</em> lending"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected highlights %v, got %v", want, got)
+	}
+	if got := result.Hits.Hits[1].highlights(); got != nil {
+		t.Errorf("Expected no highlights, got %v", got)
+	}
+	if pool, ok := result.Hits.Hits[0].pool(); !ok || pool.ID != "a" || pool.Symbol != "USDC" {
+		t.Errorf("Expected the hit's pool decoded, got %+v", pool)
+	}
+}
+
+func TestPlatformStatsQuery(t *testing.T) {
+	query := platformStatsQuery(decimal.Zero)
+	if query["size"] != 0 || query["track_total_hits"] != true {
+		t.Errorf("Expected an aggregation-only query counting every hit, got %v", query)
+	}
+
+	aggs := query["aggs"].(map[string]interface{})
+	chains := aggs["chains"].(map[string]interface{})["terms"].(map[string]interface{})
+	if chains["field"] != "chain.keyword" {
+		t.Errorf("Expected chains bucketed on chain.keyword, got %v", chains["field"])
+	}
+	protocols := aggs["protocol_count"].(map[string]interface{})["cardinality"].(map[string]interface{})
+	if protocols["field"] != "protocol.keyword" {
+		t.Errorf("Expected protocols counted on protocol.keyword, got %v", protocols["field"])
+	}
+
+	distribution := aggs["apy_ranges"].(map[string]interface{})
+	if _, ok := distribution["filter"].(map[string]interface{})["bool"].(map[string]interface{})["must_not"]; !ok {
+		t.Errorf("Expected outliers filtered out of the APY distribution, got %v", distribution["filter"])
+	}
+	ranges := distribution["aggs"].(map[string]interface{})["ranges"].(map[string]interface{})["range"].(map[string]interface{})["ranges"].([]map[string]interface{})
+	last := ranges[len(ranges)-1]
+	if len(ranges) != 7 || last["key"] != "100+" || last["to"] != nil {
+		t.Errorf("Expected 7 APY ranges ending open-ended at 100+, got %v", ranges)
+	}
+	if _, ok := query["query"]; ok {
+		t.Errorf("Expected every pool aggregated without a TVL floor, got %v", query["query"])
+	}
+
+	// With a floor, dead pools are left out of every figure
+	query = platformStatsQuery(decimal.NewFromInt(1))
+	tvl, _ := query["query"].(map[string]interface{})["range"].(map[string]interface{})["tvl"].(map[string]interface{})
+	if tvl["gte"] != 1.0 {
+		t.Errorf("Expected the stats limited to pools with at least $1 TVL, got %v", query["query"])
+	}
+}
+
+func TestPlatformStatsResponse(t *testing.T) {
+	body := `{
+		"hits": {"total": {"value": 3, "relation": "eq"}},
+		"aggregations": {
+			"total_tvl": {"value": 3500000},
+			"avg_apy": {"value": 4.5},
+			"max_apy": {"value": 120},
+			"median_apy": {"values": {"50.0": 3.25}},
+			"protocol_count": {"value": 2},
+			"chains": {"buckets": [
+				{"key": "ethereum", "doc_count": 2, "total_tvl": {"value": 3000000}},
+				{"key": "arbitrum", "doc_count": 1, "total_tvl": {"value": 500000}}
+			]},
+			"apy_ranges": {"doc_count": 3, "ranges": {"buckets": [
+				{"key": "0-1", "doc_count": 0},
+				{"key": "1-5", "doc_count": 2},
+				{"key": "100+", "doc_count": 1}
+			]}}
+		}
+	}`
+
+	var resp platformStatsResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	stats := resp.platformStats()
+
+	if stats.TotalPools != 3 || stats.TotalChains != 2 || stats.TotalProtocols != 2 {
+		t.Errorf("Unexpected counts: pools %d, chains %d, protocols %d", stats.TotalPools, stats.TotalChains, stats.TotalProtocols)
+	}
+	if stats.TotalTVL.String() != "3500000" || stats.AverageAPY.String() != "4.5" ||
+		stats.MedianAPY.String() != "3.25" || stats.MaxAPY.String() != "120" {
+		t.Errorf("Unexpected metrics: %+v", stats)
+	}
+	if stats.TVLByChain["ethereum"].String() != "3000000" || stats.PoolsByChain["arbitrum"] != 1 {
+		t.Errorf("Unexpected chain breakdown: %v %v", stats.TVLByChain, stats.PoolsByChain)
+	}
+	if stats.APYDistribution.Range1to5 != 2 || stats.APYDistribution.Range100Plus != 1 {
+		t.Errorf("Unexpected APY distribution: %+v", stats.APYDistribution)
+	}
+
+	// An empty index has null metrics
+	empty := `{"hits": {"total": {"value": 0}}, "aggregations": {
+		"total_tvl": {"value": 0}, "avg_apy": {"value": null}, "max_apy": {"value": null},
+		"median_apy": {"values": {"50.0": null}}, "protocol_count": {"value": 0},
+		"chains": {"buckets": []}, "apy_ranges": {"doc_count": 0, "ranges": {"buckets": []}}
+	}}`
+	resp = platformStatsResponse{}
+	if err := json.Unmarshal([]byte(empty), &resp); err != nil {
+		t.Fatalf("Failed to decode empty response: %v", err)
+	}
+	if stats := resp.platformStats(); stats.TotalPools != 0 || !stats.AverageAPY.IsZero() || !stats.MedianAPY.IsZero() {
+		t.Errorf("Expected zero stats for an empty index, got %+v", stats)
+	}
+}
+
+// fakeSearchServer answers searches with the given bodies in turn and
+// records the search requests it gets
+func fakeSearchServer(t *testing.T, responses ...string) (*Repository, *[]map[string]interface{}) {
+	t.Helper()
+
+	var requests []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var query map[string]interface{}
+		if err := json.Unmarshal(body, &query); err != nil {
+			t.Errorf("Failed to decode search: %v", err)
+		}
+		requests = append(requests, query)
+
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) > len(responses) {
+			t.Errorf("Unexpected search %d: %s", len(requests), body)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, responses[len(requests)-1])
+	}))
+	t.Cleanup(srv.Close)
+
+	repo, err := NewRepository(config.ElasticSearchConfig{URL: srv.URL, SearchTimeout: 2 * time.Second, MaxResultWindow: 100})
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	return repo, &requests
+}
+
+func TestSearchPools_WithinResultWindow(t *testing.T) {
+	repo, requests := fakeSearchServer(t, `{"timed_out": false, "hits": {"total": {"value": 1}, "hits": [{"_id": "a", "_source": {"id": "a"}}]}}`)
+
+	pools, total, err := repo.SearchPools(context.Background(), models.PoolFilter{Limit: 20, Offset: 80})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 1 || len(pools) != 1 {
+		t.Fatalf("Expected one pool, got %d of %d", len(pools), total)
+	}
+
+	query := (*requests)[0]
+	if query["from"] != float64(80) || query["size"] != float64(20) || query["timeout"] != "2s" {
+		t.Errorf("Expected from 80, size 20 and a 2s timeout, got %v", query)
+	}
+}
+
+func TestSearchPools_PastResultWindow(t *testing.T) {
+	repo, requests := fakeSearchServer(t,
+		`{"hits": {"total": {"value": 500}, "hits": [{"_id": "p89", "sort": [1500000.5, "p89"]}]}}`,
+		`{"hits": {"total": {"value": 500}, "hits": [{"_id": "p90", "_source": {"id": "p90"}, "sort": [1400000, "p90"]}]}}`,
+	)
+
+	pools, total, err := repo.SearchPools(context.Background(), models.PoolFilter{Search: "usdc", Limit: 20, Offset: 90})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 500 || len(pools) != 1 || pools[0].ID != "p90" {
+		t.Fatalf("Expected the page after the anchor, got %+v of %d", pools, total)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected an anchor search and a page search, got %d searches", len(*requests))
+	}
+	anchor, page := (*requests)[0], (*requests)[1]
+	if anchor["from"] != float64(89) || anchor["size"] != float64(1) || anchor["_source"] != false || anchor["highlight"] != nil {
+		t.Errorf("Expected the anchor to read only the hit before the page, got %v", anchor)
+	}
+	after, _ := json.Marshal(page["search_after"])
+	if page["from"] != float64(0) || page["size"] != float64(20) || string(after) != `[1500000.5,"p89"]` {
+		t.Errorf("Expected the page to continue after the anchor's sort values, got %v", page)
+	}
+	if page["highlight"] == nil || !reflect.DeepEqual(page["sort"], anchor["sort"]) {
+		t.Errorf("Expected the page to keep the search's sort and highlight, got %v", page)
+	}
+}
+
+func TestSearchPools_PastEndOfResults(t *testing.T) {
+	repo, requests := fakeSearchServer(t, `{"hits": {"total": {"value": 40}, "hits": []}}`)
+
+	pools, total, err := repo.SearchPools(context.Background(), models.PoolFilter{Limit: 20, Offset: 95})
+	if err != nil || total != 40 || len(pools) != 0 || len(*requests) != 1 {
+		t.Errorf("Expected an empty page after the anchor search, got %d pools of %d after %d searches (%v)", len(pools), total, len(*requests), err)
+	}
+}
+
+func TestSearchPools_ResultWindowExceeded(t *testing.T) {
+	repo, requests := fakeSearchServer(t)
+
+	_, _, err := repo.SearchPools(context.Background(), models.PoolFilter{Limit: 20, Offset: 101})
+	if !errors.Is(err, ErrResultWindowExceeded) || len(*requests) != 0 {
+		t.Errorf("Expected ErrResultWindowExceeded without searching, got %v after %d searches", err, len(*requests))
+	}
+}
+
+func TestSearchPools_TimedOut(t *testing.T) {
+	repo, _ := fakeSearchServer(t, `{"timed_out": true, "hits": {"total": {"value": 3}, "hits": [{"_id": "a", "_source": {"id": "a"}}]}}`)
+
+	_, _, err := repo.SearchPools(context.Background(), models.PoolFilter{Limit: 20})
+	if !errors.Is(err, ErrSearchTimeout) {
+		t.Errorf("Expected partial results reported as ErrSearchTimeout, got %v", err)
+	}
+}
+
+// failingSearchServer answers every request with the given status and
+// counts the requests it gets
+func failingSearchServer(t *testing.T, status int, cfg config.ElasticSearchConfig) (*Repository, *int) {
+	t.Helper()
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"error": {"type": "failure"}, "status": `+strconv.Itoa(status)+`}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg.URL = srv.URL
+	repo, err := NewRepository(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	return repo, &requests
+}
+
+func TestSearchPools_BreakerOpens(t *testing.T) {
+	repo, requests := failingSearchServer(t, http.StatusServiceUnavailable, config.ElasticSearchConfig{
+		SearchTimeout:    2 * time.Second,
+		MaxRetries:       2,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := repo.SearchPools(ctx, models.PoolFilter{Limit: 20}); err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Expected search %d to reach ElasticSearch and fail, got %v", i+1, err)
+		}
+	}
+	if *requests != 6 {
+		t.Errorf("Expected each failed search retried twice, got %d requests", *requests)
+	}
+	if repo.BreakerState() != breaker.StateOpen {
+		t.Fatalf("Expected the breaker open, got %s", repo.BreakerState())
+	}
+
+	start := time.Now()
+	_, _, err := repo.SearchPools(ctx, models.PoolFilter{Limit: 20})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Expected ErrUnavailable while the breaker is open, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond || *requests != 6 {
+		t.Errorf("Expected a fast failure without calling ElasticSearch, took %s after %d requests", elapsed, *requests)
+	}
+
+	if _, err := repo.GetPlatformStats(ctx, decimal.Zero); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected platform stats to fail fast too, got %v", err)
+	}
+}
+
+func TestSearchPools_RejectedQueryKeepsBreakerClosed(t *testing.T) {
+	repo, requests := failingSearchServer(t, http.StatusBadRequest, config.ElasticSearchConfig{
+		MaxRetries:       3,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := repo.SearchPools(context.Background(), models.PoolFilter{Limit: 20}); err == nil {
+			t.Fatal("Expected the rejected search to fail")
+		}
+	}
+	if *requests != 3 || repo.BreakerState() != breaker.StateClosed {
+		t.Errorf("Expected rejected searches neither retried nor opening the breaker, got %d requests and %s", *requests, repo.BreakerState())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 2 * time.Second}
+	for i, w := range want {
+		if got := retryBackoff(i + 1); got != w {
+			t.Errorf("Attempt %d: expected %s, got %s", i+1, w, got)
+		}
+	}
+	if got := retryBackoff(100); got != retryMaxBackoff {
+		t.Errorf("Expected the backoff capped at %s, got %s", retryMaxBackoff, got)
+	}
+}
@@ -0,0 +1,156 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// indexSettings are the shard, replica and refresh settings of the indices
+// this repository creates. Shards are fixed when an index is created;
+// replicas and the refresh interval can be changed on a live index.
+type indexSettings struct {
+	shards          int
+	replicas        int
+	refreshInterval time.Duration // 0 keeps the ElasticSearch default
+}
+
+// newIndexSettings reads the index settings from the configuration,
+// falling back to one shard and no replicas
+func newIndexSettings(cfg config.ElasticSearchConfig) indexSettings {
+	settings := indexSettings{
+		shards:          cfg.IndexShards,
+		replicas:        cfg.IndexReplicas,
+		refreshInterval: cfg.IndexRefreshInterval,
+	}
+	if settings.shards <= 0 {
+		settings.shards = 1
+	}
+	if settings.replicas < 0 {
+		settings.replicas = 0
+	}
+	return settings
+}
+
+// apply writes the settings into the settings block of a create-index body
+func (s indexSettings) apply(settings map[string]interface{}) {
+	settings["number_of_shards"] = s.shards
+	settings["number_of_replicas"] = s.replicas
+	if s.refreshInterval > 0 {
+		settings["refresh_interval"] = formatInterval(s.refreshInterval)
+	}
+}
+
+// changes returns the dynamic settings that differ from an index's current
+// flat settings, and whether its shard count differs from the configured one
+func (s indexSettings) changes(current map[string]string) (map[string]string, bool) {
+	changes := make(map[string]string)
+
+	replicas := strconv.Itoa(s.replicas)
+	if current["index.number_of_replicas"] != replicas {
+		changes["index.number_of_replicas"] = replicas
+	}
+
+	if s.refreshInterval > 0 {
+		interval := formatInterval(s.refreshInterval)
+		if current["index.refresh_interval"] != interval {
+			changes["index.refresh_interval"] = interval
+		}
+	}
+
+	return changes, current["index.number_of_shards"] != strconv.Itoa(s.shards)
+}
+
+// formatInterval renders a duration as an ElasticSearch time value
+func formatInterval(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// withSettings parses a create-index body and applies the index settings
+func (s indexSettings) withSettings(mapping string) (map[string]interface{}, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(mapping), &body); err != nil {
+		return nil, err
+	}
+
+	settings, ok := body["settings"].(map[string]interface{})
+	if !ok {
+		settings = make(map[string]interface{})
+		body["settings"] = settings
+	}
+	s.apply(settings)
+
+	return body, nil
+}
+
+// UpdateIndexSettings brings the replica count and refresh interval of an
+// existing index in line with the configuration. The shard count of a live
+// index can't change; a mismatch is logged and takes effect on the indices
+// created by the next reindex.
+func (r *Repository) UpdateIndexSettings(ctx context.Context, index string) error {
+	res, err := r.client.Indices.GetSettings(
+		r.client.Indices.GetSettings.WithContext(ctx),
+		r.client.Indices.GetSettings.WithIndex(index),
+		r.client.Indices.GetSettings.WithFlatSettings(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get %s settings: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("failed to get %s settings: %s", index, res.String())
+	}
+
+	var indices map[string]struct {
+		Settings map[string]string `json:"settings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return fmt.Errorf("failed to decode %s settings: %w", index, err)
+	}
+	current := indices[index].Settings
+
+	changes, shardsDiffer := r.settings.changes(current)
+	if shardsDiffer {
+		log.Warn().
+			Str("index", index).
+			Str("shards", current["index.number_of_shards"]).
+			Int("configured_shards", r.settings.shards).
+			Msg("Index shard count differs from the configuration; reindex to apply it")
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s settings: %w", index, err)
+	}
+
+	update, err := r.client.Indices.PutSettings(
+		bytes.NewReader(body),
+		r.client.Indices.PutSettings.WithContext(ctx),
+		r.client.Indices.PutSettings.WithIndex(index),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update %s settings: %w", index, err)
+	}
+	defer update.Body.Close()
+
+	if update.IsError() {
+		return fmt.Errorf("failed to update %s settings: %s", index, update.String())
+	}
+
+	log.Info().Str("index", index).Interface("settings", changes).Msg("Updated index settings")
+	return nil
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// listQuery composes a filtered, sorted and paginated listing and the query
+// counting its rows. Conditions and their arguments are added once; the
+// count query is derived from the same conditions, so the two can't drift
+// apart.
+//
+// Conditions must all be added before anything is bound for sorting, which
+// the count query doesn't take.
+type listQuery struct {
+	selectSQL  string // SELECT ... FROM ..., without a WHERE clause
+	countSQL   string // SELECT COUNT(...) FROM ..., without a WHERE clause
+	conds      []string
+	args       []interface{}
+	filterArgs int    // Leading args bound by conditions
+	groupBy    string // GROUP BY expression, if any
+	orderBy    string
+	limit      int
+	offset     int
+	paged      bool
+}
+
+// newListQuery starts a listing selecting with selectSQL and counted with
+// countSQL. Both end with their FROM clause; they may differ there, e.g. a
+// join only the listing needs.
+func newListQuery(selectSQL, countSQL string) *listQuery {
+	return &listQuery{selectSQL: selectSQL, countSQL: countSQL}
+}
+
+// bind adds an argument and returns its number, for $n
+func (q *listQuery) bind(arg interface{}) int {
+	q.args = append(q.args, arg)
+	return len(q.args)
+}
+
+// where adds a condition. Each argument is bound and its placeholder
+// formatted into cond as a string, so "apy >= %s" takes one argument and
+// "(a ILIKE %[1]s OR b ILIKE %[1]s)" uses one twice. A condition without
+// arguments is added as is.
+func (q *listQuery) where(cond string, args ...interface{}) {
+	if len(args) == 0 {
+		q.conds = append(q.conds, cond)
+		return
+	}
+
+	placeholders := make([]interface{}, len(args))
+	for i, arg := range args {
+		placeholders[i] = fmt.Sprintf("$%d", q.bind(arg))
+	}
+	q.conds = append(q.conds, fmt.Sprintf(cond, placeholders...))
+	q.filterArgs = len(q.args)
+}
+
+// group groups the listing's rows by expr
+func (q *listQuery) group(expr string) {
+	q.groupBy = expr
+}
+
+// order sorts the listing by expr
+func (q *listQuery) order(expr string) {
+	q.orderBy = expr
+}
+
+// page limits the listing to a page of limit rows after offset
+func (q *listQuery) page(limit, offset int) {
+	q.limit, q.offset, q.paged = limit, offset, true
+}
+
+// whereSQL returns the WHERE clause of both queries
+func (q *listQuery) whereSQL() string {
+	var b strings.Builder
+	b.WriteString(" WHERE 1=1")
+	for _, cond := range q.conds {
+		b.WriteString(" AND ")
+		b.WriteString(cond)
+	}
+	return b.String()
+}
+
+// sql returns the listing query and its arguments
+func (q *listQuery) sql() (string, []interface{}) {
+	query := q.selectSQL + q.whereSQL()
+	args := append([]interface{}(nil), q.args...)
+	if q.groupBy != "" {
+		query += " GROUP BY " + q.groupBy
+	}
+	if q.orderBy != "" {
+		query += " ORDER BY " + q.orderBy
+	}
+	if q.paged {
+		args = append(args, q.limit, q.offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	return query, args
+}
+
+// count returns the count query and its arguments, those of the conditions
+func (q *listQuery) count() (string, []interface{}) {
+	return q.countSQL + q.whereSQL(), q.args[:q.filterArgs:q.filterArgs]
+}
+
+// fingerprintKey is the context key of a listing's filter fingerprint
+type fingerprintKey struct{}
+
+// withFilterFingerprint tags the queries run with ctx with a short hash of
+// the filter that built them. The query tracer logs it, so the queries of
+// one listing can be told apart and matched to the filter.
+func withFilterFingerprint(ctx context.Context, filter interface{}) context.Context {
+	return context.WithValue(ctx, fingerprintKey{}, filterFingerprint(filter))
+}
+
+// filterFingerprint returns a short hash of a filter's JSON encoding
+func filterFingerprint(filter interface{}) string {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,271 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestPoolsQuery(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name      string
+		filter    models.PoolFilter
+		where     string
+		args      []interface{} // Bound by the conditions
+		orderBy   string
+		orderArgs []interface{} // Bound for sorting, after the conditions
+	}{
+		{
+			name:    "unfiltered",
+			filter:  models.PoolFilter{SortBy: "tvl"},
+			where:   " WHERE 1=1 AND NOT is_outlier",
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:    "dead pools left out",
+			filter:  models.PoolFilter{SortBy: "apy", SortOrder: "asc", TVLFloor: decimal.NewFromInt(1)},
+			where:   " WHERE 1=1 AND tvl >= $1 AND NOT is_outlier",
+			args:    []interface{}{decimal.NewFromInt(1)},
+			orderBy: "apy ASC, id ASC",
+		},
+		{
+			name:    "outliers included",
+			filter:  models.PoolFilter{SortBy: "apy", SortOrder: "asc", IncludeOutliers: true},
+			where:   " WHERE 1=1",
+			orderBy: "apy ASC, id ASC",
+		},
+		{
+			name: "chain, protocol and ranges",
+			filter: models.PoolFilter{
+				Chain: "Ethereum", Protocol: "aave-v3",
+				MinAPY: decimal.NewFromInt(5), MaxAPY: decimal.NewFromInt(50),
+				MinTVL: decimal.NewFromInt(1000), MaxTVL: decimal.NewFromInt(5000),
+				MinVolume1D: decimal.NewFromInt(10),
+				SortBy:      "tvl",
+			},
+			where: " WHERE 1=1 AND LOWER(chain) = LOWER($1) AND LOWER(protocol) = LOWER($2)" +
+				" AND apy >= $3 AND apy <= $4 AND tvl >= $5 AND tvl <= $6 AND volume_usd_1d >= $7 AND NOT is_outlier",
+			args: []interface{}{"Ethereum", "aave-v3", decimal.NewFromInt(5), decimal.NewFromInt(50),
+				decimal.NewFromInt(1000), decimal.NewFromInt(5000), decimal.NewFromInt(10)},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:    "symbol",
+			filter:  models.PoolFilter{Symbol: "USDC", SortBy: "tvl"},
+			where:   " WHERE 1=1 AND symbol ILIKE $1 AND NOT is_outlier",
+			args:    []interface{}{"%USDC%"},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:    "exact symbol",
+			filter:  models.PoolFilter{Symbol: "USDC", Exact: true, SortBy: "tvl"},
+			where:   " WHERE 1=1 AND LOWER(symbol) ~ $1 AND NOT is_outlier",
+			args:    []interface{}{models.SymbolTokenPattern("USDC")},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:   "search",
+			filter: models.PoolFilter{Search: "eth", SortBy: "tvl"},
+			where: " WHERE 1=1 AND (symbol ILIKE $1 OR protocol ILIKE $1 OR chain ILIKE $1 OR pool_meta ILIKE $1)" +
+				" AND NOT is_outlier",
+			args:    []interface{}{"%eth%"},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:   "exact search",
+			filter: models.PoolFilter{Chain: "base", Search: "eth", Exact: true, SortBy: "tvl"},
+			where: " WHERE 1=1 AND LOWER(chain) = LOWER($1)" +
+				" AND (LOWER(symbol) ~ $2 OR protocol ILIKE $3 OR chain ILIKE $3 OR pool_meta ILIKE $3) AND NOT is_outlier",
+			args:    []interface{}{"base", models.SymbolTokenPattern("eth"), "%eth%"},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name: "ratios, stablecoin, source and tags",
+			filter: models.PoolFilter{
+				MinVolumeTVLRatio: decimal.RequireFromString("0.1"),
+				MaxRewardRatio:    decimal.RequireFromString("0.5"),
+				StableCoin:        &no,
+				DataSource:        "defillama",
+				Tags:              []string{"lending", "blue-chip"},
+				SortBy:            "tvl",
+			},
+			where: " WHERE 1=1 AND tvl > 0 AND volume_usd_1d >= $1 * tvl" +
+				" AND (apy <= 0 OR COALESCE(apy_reward, 0) <= $2 * apy)" +
+				" AND stablecoin = $3 AND data_source = $4 AND tags @> $5::text[] AND NOT is_outlier",
+			args: []interface{}{decimal.RequireFromString("0.1"), decimal.RequireFromString("0.5"),
+				false, "defillama", []string{"lending", "blue-chip"}},
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:   "curation",
+			filter: models.PoolFilter{Curated: &yes, Audited: &no, SortBy: "tvl"},
+			where: " WHERE 1=1 AND EXISTS (SELECT 1 FROM pool_curation pc WHERE pc.pool_id = pools.id)" +
+				" AND NOT EXISTS (SELECT 1 FROM pool_curation pc WHERE pc.pool_id = pools.id AND pc.audited)" +
+				" AND NOT is_outlier",
+			orderBy: "tvl DESC, id ASC",
+		},
+		{
+			name:      "decayed score",
+			filter:    models.PoolFilter{Chain: "ethereum", SortBy: "score", RankMode: models.RankModeDecayed},
+			where:     " WHERE 1=1 AND LOWER(chain) = LOWER($1) AND NOT is_outlier",
+			args:      []interface{}{"ethereum"},
+			orderBy:   decayedScoreExpr(2) + " DESC, id ASC",
+			orderArgs: []interface{}{decayScaleSeconds(0)},
+		},
+		{
+			name:      "relevance",
+			filter:    models.PoolFilter{Symbol: "USDC", SortBy: models.SortRelevance},
+			where:     " WHERE 1=1 AND symbol ILIKE $1 AND NOT is_outlier",
+			args:      []interface{}{"%USDC%"},
+			orderBy:   symbolMatchExpr(2) + " DESC, id ASC",
+			orderArgs: []interface{}{"usdc", models.SymbolTokenPattern("USDC")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit, tt.filter.Offset = 20, 40
+			q := poolsQuery(tt.filter)
+
+			countQuery, countArgs := q.count()
+			if want := "SELECT COUNT(*) FROM pools" + tt.where; countQuery != want {
+				t.Errorf("Expected count query %q, got %q", want, countQuery)
+			}
+			assertArgs(t, "count", countArgs, tt.args)
+
+			query, args := q.sql()
+			n := len(tt.args) + len(tt.orderArgs)
+			suffix := fmt.Sprintf("LEFT JOIN pool_curation ON pool_curation.pool_id = pools.id%s ORDER BY %s LIMIT $%d OFFSET $%d",
+				tt.where, tt.orderBy, n+1, n+2)
+			if !strings.HasSuffix(query, suffix) {
+				t.Errorf("Expected query ending %q, got %q", suffix, query)
+			}
+			want := append(append(append([]interface{}{}, tt.args...), tt.orderArgs...), 20, 40)
+			assertArgs(t, "query", args, want)
+		})
+	}
+}
+
+func TestOpportunitiesQuery(t *testing.T) {
+	detectedAfter := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	detectedBefore := detectedAfter.Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		filter  models.OpportunityFilter
+		where   string
+		args    []interface{}
+		orderBy string
+	}{
+		{
+			name:    "unfiltered",
+			filter:  models.OpportunityFilter{},
+			where:   " WHERE 1=1",
+			orderBy: "score DESC",
+		},
+		{
+			name: "every filter",
+			filter: models.OpportunityFilter{
+				ActiveOnly: true, Type: "yield_gap", RiskLevel: "low", Chain: "arbitrum",
+				MinProfit: decimal.NewFromInt(100), MinScore: decimal.NewFromInt(40),
+				SortBy: "profit", SortOrder: "asc",
+			},
+			where:   " WHERE 1=1 AND is_active = true AND type = $1 AND risk_level = $2 AND chain = $3 AND potential_profit >= $4 AND score >= $5",
+			args:    []interface{}{"yield_gap", "low", "arbitrum", decimal.NewFromInt(100), decimal.NewFromInt(40)},
+			orderBy: "potential_profit ASC",
+		},
+		{
+			name:    "by detection time",
+			filter:  models.OpportunityFilter{ActiveOnly: true, SortBy: "detectedAt"},
+			where:   " WHERE 1=1 AND is_active = true",
+			orderBy: "detected_at DESC",
+		},
+		{
+			name:    "by detection time, snake case",
+			filter:  models.OpportunityFilter{ActiveOnly: true, SortBy: "detected_at", SortOrder: "asc"},
+			where:   " WHERE 1=1 AND is_active = true",
+			orderBy: "detected_at ASC",
+		},
+		{
+			name: "detection time bounds",
+			filter: models.OpportunityFilter{
+				ActiveOnly: true, SortBy: "detectedAt",
+				DetectedAfter: detectedAfter, DetectedBefore: detectedBefore,
+			},
+			where:   " WHERE 1=1 AND is_active = true AND detected_at >= $1 AND detected_at < $2",
+			args:    []interface{}{detectedAfter, detectedBefore},
+			orderBy: "detected_at DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 10
+			q := opportunitiesQuery(tt.filter)
+
+			countQuery, countArgs := q.count()
+			if want := "SELECT COUNT(*) FROM opportunities" + tt.where; countQuery != want {
+				t.Errorf("Expected count query %q, got %q", want, countQuery)
+			}
+			assertArgs(t, "count", countArgs, tt.args)
+
+			query, args := q.sql()
+			suffix := fmt.Sprintf("FROM opportunities%s ORDER BY %s LIMIT $%d OFFSET $%d",
+				tt.where, tt.orderBy, len(tt.args)+1, len(tt.args)+2)
+			if !strings.HasSuffix(query, suffix) {
+				t.Errorf("Expected query ending %q, got %q", suffix, query)
+			}
+			assertArgs(t, "query", args, append(append([]interface{}{}, tt.args...), 10, 0))
+		})
+	}
+}
+
+func TestListQuery_CountIgnoresLaterBinds(t *testing.T) {
+	q := newListQuery("SELECT id FROM pools", "SELECT COUNT(*) FROM pools")
+	q.where("chain = %s", "ethereum")
+	q.order(fmt.Sprintf("apy * $%d DESC", q.bind(2)))
+	q.page(5, 10)
+
+	query, args := q.sql()
+	if want := "SELECT id FROM pools WHERE 1=1 AND chain = $1 ORDER BY apy * $2 DESC LIMIT $3 OFFSET $4"; query != want {
+		t.Errorf("Expected query %q, got %q", want, query)
+	}
+	assertArgs(t, "query", args, []interface{}{"ethereum", 2, 5, 10})
+
+	// Building the listing must not leak into the count, however often
+	_, _ = q.sql()
+	countQuery, countArgs := q.count()
+	if want := "SELECT COUNT(*) FROM pools WHERE 1=1 AND chain = $1"; countQuery != want {
+		t.Errorf("Expected count query %q, got %q", want, countQuery)
+	}
+	assertArgs(t, "count", countArgs, []interface{}{"ethereum"})
+}
+
+func TestFilterFingerprint(t *testing.T) {
+	a := filterFingerprint(models.PoolFilter{Chain: "ethereum", Limit: 20})
+	if len(a) != 12 {
+		t.Fatalf("Expected a 12 character fingerprint, got %q", a)
+	}
+	if b := filterFingerprint(models.PoolFilter{Chain: "ethereum", Limit: 20}); b != a {
+		t.Errorf("Expected equal filters to share a fingerprint, got %q and %q", a, b)
+	}
+	if c := filterFingerprint(models.PoolFilter{Chain: "arbitrum", Limit: 20}); c == a {
+		t.Errorf("Expected different filters to differ, both got %q", a)
+	}
+}
+
+// assertArgs compares query arguments by their printed form, which decimals
+// and slices share when equal
+func assertArgs(t *testing.T, name string, got, want []interface{}) {
+	t.Helper()
+	if len(got) != len(want) || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %s arguments %v, got %v", name, want, got)
+	}
+}
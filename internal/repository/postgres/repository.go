@@ -4,8 +4,14 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -67,11 +73,16 @@ func (r *Repository) Ping(ctx context.Context) error {
 // queryTracer implements pgx.QueryTracer for logging queries
 type queryTracer struct{}
 
+// TraceQueryStart logs a query. Listing queries carry the fingerprint of the
+// filter that built them.
 func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
-	log.Debug().
+	event := log.Debug().
 		Str("sql", data.SQL).
-		Interface("args", data.Args).
-		Msg("Executing query")
+		Interface("args", data.Args)
+	if fingerprint, ok := ctx.Value(fingerprintKey{}).(string); ok {
+		event = event.Str("filter", fingerprint)
+	}
+	event.Msg("Executing query")
 	return ctx
 }
 
@@ -87,282 +98,638 @@ func (t *queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pg
 
 // ListPools returns a paginated list of pools with optional filters
 func (r *Repository) ListPools(ctx context.Context, filter models.PoolFilter) ([]models.Pool, int64, error) {
-	// Build dynamic query based on filters
-	query := `
+	ctx = withFilterFingerprint(ctx, filter)
+	q := poolsQuery(filter)
+
+	// Get total count
+	var total int64
+	countQuery, countArgs := q.count()
+	err := r.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count pools: %w", err)
+	}
+
+	// Execute query
+	query, args := q.sql()
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query pools: %w", err)
+	}
+	defer rows.Close()
+
+	pools := make([]models.Pool, 0)
+	for rows.Next() {
+		var pool models.Pool
+		var cur curationRow
+		err := rows.Scan(
+			&pool.ID, &pool.Chain, &pool.Protocol, &pool.Symbol,
+			&pool.TVL, &pool.APY, &pool.APYBase, &pool.APYReward,
+			&pool.RewardTokens, &pool.UnderlyingTokens, &pool.PoolMeta,
+			&pool.IL7D, &pool.APYMean30D, &pool.VolumeUSD1D, &pool.VolumeUSD7D,
+			&pool.Score, &pool.APYChange1H, &pool.APYChange24H, &pool.APYChange7D,
+			&pool.StableCoin, &pool.Exposure, &pool.DataSource, &pool.DataCompleteness,
+			&pool.APYRaw, &pool.IsOutlier, &pool.Tags, &pool.CreatedAt, &pool.UpdatedAt,
+			&cur.rewardSchedule, &cur.audited, &cur.notes, &cur.curatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan pool: %w", err)
+		}
+		pool.VolumeTVLRatio = models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL)
+		pool.BaseRatio = models.CalculateBaseRatio(pool.APYBase, pool.APY)
+		pool.Curation = cur.curation()
+		pools = append(pools, pool)
+	}
+
+	return pools, total, nil
+}
+
+// poolsQuery builds the pools listing and count queries
+func poolsQuery(filter models.PoolFilter) *listQuery {
+	q := newListQuery(`
 		SELECT
 			id, chain, protocol, symbol, tvl, apy, apy_base, apy_reward,
 			reward_tokens, underlying_tokens, pool_meta, il_7d, apy_mean_30d,
 			volume_usd_1d, volume_usd_7d, score, apy_change_1h, apy_change_24h,
-			apy_change_7d, stablecoin, exposure, created_at, updated_at
+			apy_change_7d, stablecoin, exposure, data_source, data_completeness,
+			COALESCE(apy_raw, apy), is_outlier, tags, created_at, updated_at,
+			reward_schedule, audited, notes, curated_at
 		FROM pools
-		WHERE 1=1
-	`
-	countQuery := "SELECT COUNT(*) FROM pools WHERE 1=1"
-	args := []interface{}{}
-	argCount := 0
+		LEFT JOIN pool_curation ON pool_curation.pool_id = pools.id`,
+		"SELECT COUNT(*) FROM pools")
 
 	// Apply filters (using ILIKE for case-insensitive matching)
 	if filter.Chain != "" {
-		argCount++
-		query += fmt.Sprintf(" AND LOWER(chain) = LOWER($%d)", argCount)
-		countQuery += fmt.Sprintf(" AND LOWER(chain) = LOWER($%d)", argCount)
-		args = append(args, filter.Chain)
+		q.where("LOWER(chain) = LOWER(%s)", filter.Chain)
 	}
 
 	if filter.Protocol != "" {
-		argCount++
-		query += fmt.Sprintf(" AND LOWER(protocol) = LOWER($%d)", argCount)
-		countQuery += fmt.Sprintf(" AND LOWER(protocol) = LOWER($%d)", argCount)
-		args = append(args, filter.Protocol)
+		q.where("LOWER(protocol) = LOWER(%s)", filter.Protocol)
 	}
 
+	// Exact lookups match the symbol as a whole token, like the
+	// ElasticSearch term and phrase clauses, instead of any substring
 	if filter.Symbol != "" {
-		argCount++
-		query += fmt.Sprintf(" AND symbol ILIKE $%d", argCount)
-		countQuery += fmt.Sprintf(" AND symbol ILIKE $%d", argCount)
-		args = append(args, "%"+filter.Symbol+"%")
+		if filter.Exact {
+			q.where("LOWER(symbol) ~ %s", models.SymbolTokenPattern(filter.Symbol))
+		} else {
+			q.where("symbol ILIKE %s", "%"+filter.Symbol+"%")
+		}
 	}
 
 	// Search across multiple fields (symbol, protocol, chain, pool_meta)
 	if filter.Search != "" {
-		argCount++
 		searchPattern := "%" + filter.Search + "%"
-		query += fmt.Sprintf(" AND (symbol ILIKE $%d OR protocol ILIKE $%d OR chain ILIKE $%d OR pool_meta ILIKE $%d)", argCount, argCount, argCount, argCount)
-		countQuery += fmt.Sprintf(" AND (symbol ILIKE $%d OR protocol ILIKE $%d OR chain ILIKE $%d OR pool_meta ILIKE $%d)", argCount, argCount, argCount, argCount)
-		args = append(args, searchPattern)
+		if filter.Exact {
+			q.where("(LOWER(symbol) ~ %[1]s OR protocol ILIKE %[2]s OR chain ILIKE %[2]s OR pool_meta ILIKE %[2]s)",
+				models.SymbolTokenPattern(filter.Search), searchPattern)
+		} else {
+			q.where("(symbol ILIKE %[1]s OR protocol ILIKE %[1]s OR chain ILIKE %[1]s OR pool_meta ILIKE %[1]s)", searchPattern)
+		}
 	}
 
 	if !filter.MinAPY.IsZero() {
-		argCount++
-		query += fmt.Sprintf(" AND apy >= $%d", argCount)
-		countQuery += fmt.Sprintf(" AND apy >= $%d", argCount)
-		args = append(args, filter.MinAPY)
+		q.where("apy >= %s", filter.MinAPY)
 	}
 
 	if !filter.MaxAPY.IsZero() {
-		argCount++
-		query += fmt.Sprintf(" AND apy <= $%d", argCount)
-		countQuery += fmt.Sprintf(" AND apy <= $%d", argCount)
-		args = append(args, filter.MaxAPY)
+		q.where("apy <= %s", filter.MaxAPY)
 	}
 
 	if !filter.MinTVL.IsZero() {
-		argCount++
-		query += fmt.Sprintf(" AND tvl >= $%d", argCount)
-		countQuery += fmt.Sprintf(" AND tvl >= $%d", argCount)
-		args = append(args, filter.MinTVL)
+		q.where("tvl >= %s", filter.MinTVL)
 	}
 
 	if !filter.MaxTVL.IsZero() {
-		argCount++
-		query += fmt.Sprintf(" AND tvl <= $%d", argCount)
-		countQuery += fmt.Sprintf(" AND tvl <= $%d", argCount)
-		args = append(args, filter.MaxTVL)
+		q.where("tvl <= %s", filter.MaxTVL)
+	}
+
+	if !filter.MinVolume1D.IsZero() {
+		q.where("volume_usd_1d >= %s", filter.MinVolume1D)
+	}
+
+	if !filter.MinVolumeTVLRatio.IsZero() {
+		q.where(minVolumeTVLRatioCond("%s"), filter.MinVolumeTVLRatio)
+	}
+
+	// Compare reward APY against ratio * APY to avoid dividing by zero APY
+	if !filter.MaxRewardRatio.IsZero() {
+		q.where("(apy <= 0 OR COALESCE(apy_reward, 0) <= %s * apy)", filter.MaxRewardRatio)
+	}
+
+	if filter.SustainableOnly {
+		cond, args := sustainableCond("pools", filter.Sustainability)
+		q.where(cond, args...)
 	}
 
 	if filter.StableCoin != nil {
-		argCount++
-		query += fmt.Sprintf(" AND stablecoin = $%d", argCount)
-		countQuery += fmt.Sprintf(" AND stablecoin = $%d", argCount)
-		args = append(args, *filter.StableCoin)
+		q.where("stablecoin = %s", *filter.StableCoin)
 	}
 
-	// Get total count
-	var total int64
-	err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count pools: %w", err)
+	if filter.DataSource != "" {
+		q.where("data_source = %s", filter.DataSource)
 	}
 
-	// Add sorting
-	sortColumn := "tvl"
-	switch filter.SortBy {
-	case "apy":
-		sortColumn = "apy"
-	case "score":
-		sortColumn = "score"
-	case "tvl":
-		sortColumn = "tvl"
+	// Pools must carry every requested tag; the GIN index serves @>
+	if len(filter.Tags) > 0 {
+		q.where("tags @> %s::text[]", filter.Tags)
 	}
 
-	sortOrder := "DESC"
-	if filter.SortOrder == "asc" {
-		sortOrder = "ASC"
+	// Curation is joined for the pools returned; filters test it directly so
+	// the count query needs no join
+	if filter.Curated != nil {
+		q.where(curationFilter(*filter.Curated, ""))
+	}
+	if filter.Audited != nil {
+		q.where(curationFilter(*filter.Audited, " AND pc.audited"))
 	}
 
-	query += fmt.Sprintf(" ORDER BY %s %s", sortColumn, sortOrder)
+	// Dead pools would fill the bottom of every APY and TVL ranking
+	if filter.TVLFloor.IsPositive() {
+		q.where("tvl >= %s", filter.TVLFloor)
+	}
 
-	// Add pagination
-	argCount++
-	query += fmt.Sprintf(" LIMIT $%d", argCount)
-	args = append(args, filter.Limit)
+	// Pools with implausible APYs would top every APY ranking
+	if !filter.IncludeOutliers {
+		q.where("NOT is_outlier")
+	}
 
-	argCount++
-	query += fmt.Sprintf(" OFFSET $%d", argCount)
-	args = append(args, filter.Offset)
+	// Add sorting. Freshness-decayed ranking uses the same exponential decay
+	// on the age of the row as ElasticSearch.
+	decayArg := 0
+	if filter.RankMode == models.RankModeDecayed && filter.SortBy == "score" {
+		decayArg = q.bind(decayScaleSeconds(filter.DecayScale))
+	}
+	// Relevance ranks exact symbol matches first, then whole-token matches
+	matchArg := 0
+	if match := filter.MatchQuery(); match != "" && filter.SortsByRelevance() {
+		matchArg = q.bind(strings.ToLower(match))
+		q.bind(models.SymbolTokenPattern(match))
+	}
+	q.order(poolOrderBy(filter.SortKeys(), decayArg, matchArg))
+	q.page(filter.Limit, filter.Offset)
+
+	return q
+}
+
+// ListPoolsAfter returns up to limit pools with an ID greater than afterID,
+// ordered by ID, for scanning the whole table in keyset-paginated batches.
+// Only the TVL and volume/TVL floors are applied.
+func (r *Repository) ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error) {
+	query := `
+		SELECT
+			id, chain, protocol, symbol, tvl, apy, apy_base, apy_reward,
+			reward_tokens, underlying_tokens, pool_meta, il_7d, apy_mean_30d,
+			volume_usd_1d, volume_usd_7d, score, apy_change_1h, apy_change_24h,
+			apy_change_7d, stablecoin, exposure, data_source, data_completeness,
+			COALESCE(apy_raw, apy), is_outlier, tags, created_at, updated_at,
+			reward_schedule, audited, notes, curated_at
+		FROM pools
+		LEFT JOIN pool_curation ON pool_curation.pool_id = pools.id
+		WHERE id > $1 AND tvl >= $2
+	`
+	args := []interface{}{afterID, minTVL}
+
+	if !minVolumeTVLRatio.IsZero() {
+		query += " AND " + minVolumeTVLRatioCond("$3")
+		args = append(args, minVolumeTVLRatio)
+	}
+
+	query += fmt.Sprintf(" ORDER BY id LIMIT %d", limit)
 
-	// Execute query
 	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query pools: %w", err)
+		return nil, fmt.Errorf("failed to query pools: %w", err)
 	}
 	defer rows.Close()
 
-	pools := make([]models.Pool, 0)
+	pools := make([]models.Pool, 0, limit)
 	for rows.Next() {
 		var pool models.Pool
+		var cur curationRow
 		err := rows.Scan(
 			&pool.ID, &pool.Chain, &pool.Protocol, &pool.Symbol,
 			&pool.TVL, &pool.APY, &pool.APYBase, &pool.APYReward,
 			&pool.RewardTokens, &pool.UnderlyingTokens, &pool.PoolMeta,
 			&pool.IL7D, &pool.APYMean30D, &pool.VolumeUSD1D, &pool.VolumeUSD7D,
 			&pool.Score, &pool.APYChange1H, &pool.APYChange24H, &pool.APYChange7D,
-			&pool.StableCoin, &pool.Exposure, &pool.CreatedAt, &pool.UpdatedAt,
+			&pool.StableCoin, &pool.Exposure, &pool.DataSource, &pool.DataCompleteness,
+			&pool.APYRaw, &pool.IsOutlier, &pool.Tags, &pool.CreatedAt, &pool.UpdatedAt,
+			&cur.rewardSchedule, &cur.audited, &cur.notes, &cur.curatedAt,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan pool: %w", err)
+			return nil, fmt.Errorf("failed to scan pool: %w", err)
 		}
+		pool.VolumeTVLRatio = models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL)
+		pool.BaseRatio = models.CalculateBaseRatio(pool.APYBase, pool.APY)
+		pool.Curation = cur.curation()
 		pools = append(pools, pool)
 	}
 
-	return pools, total, nil
+	return pools, rows.Err()
+}
+
+// poolSortColumns maps pool sort fields to columns
+var poolSortColumns = map[string]string{
+	"apy":        "apy",
+	"tvl":        "tvl",
+	"score":      "score",
+	"updated_at": "updated_at",
+	"chain":      "chain",
+	"protocol":   "protocol",
+	"stablecoin": "stablecoin",
+}
+
+// poolOrderBy builds the ORDER BY list for pool sort keys. Unknown fields are
+// skipped, defaulting to TVL descending, and id breaks ties so pages are
+// stable. When decayArg is set, score sorts use the decayed score expression
+// with the scale bound to that placeholder. Relevance sorts need matchArg
+// (see symbolMatchExpr) and are skipped without it.
+func poolOrderBy(keys []models.SortKey, decayArg, matchArg int) string {
+	clauses := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		column, ok := poolSortColumns[key.Field]
+		if key.Field == models.SortRelevance && matchArg > 0 {
+			column, ok = symbolMatchExpr(matchArg), true
+		}
+		if !ok {
+			continue
+		}
+		if key.Field == "score" && decayArg > 0 {
+			column = decayedScoreExpr(decayArg)
+		}
+
+		direction := "DESC"
+		if key.Order == "asc" {
+			direction = "ASC"
+		}
+		clauses = append(clauses, column+" "+direction)
+	}
+
+	if len(clauses) == 0 {
+		clauses = append(clauses, "tvl DESC")
+	}
+	return strings.Join(append(clauses, "id ASC"), ", ")
+}
+
+// symbolMatchExpr returns the ORDER BY expression for relevance: 2 for an
+// exact symbol match, 1 when the query is a whole token of the symbol and 0
+// otherwise, mirroring models.SymbolMatchQuality. The lowercased query is
+// bound to matchArg and its token pattern to matchArg+1.
+func symbolMatchExpr(matchArg int) string {
+	return fmt.Sprintf("CASE WHEN LOWER(symbol) = $%d THEN 2 WHEN LOWER(symbol) ~ $%d THEN 1 ELSE 0 END", matchArg, matchArg+1)
+}
+
+// minVolumeTVLRatioCond returns the condition that a pool's 24h volume is at
+// least the ratio bound to placeholder times its TVL. Volume is compared
+// against ratio * TVL to avoid dividing by zero TVL.
+func minVolumeTVLRatioCond(placeholder string) string {
+	return "tvl > 0 AND volume_usd_1d >= " + placeholder + " * tvl"
+}
+
+// decayedScoreExpr returns the ORDER BY expression for freshness-decayed
+// ranking, with the decay scale (in seconds) bound to the given placeholder
+func decayedScoreExpr(scaleArg int) string {
+	return fmt.Sprintf("score * exp(-extract(epoch from now() - updated_at) / $%d::double precision)", scaleArg)
+}
+
+// decayScaleSeconds converts a decay scale to seconds, defaulting to 6 hours
+func decayScaleSeconds(scale time.Duration) float64 {
+	if scale <= 0 {
+		scale = 6 * time.Hour
+	}
+	return scale.Seconds()
 }
 
-// GetPool returns a single pool by ID
+// GetPool returns a single pool by ID. The error wraps os.ErrNotExist if
+// there is no such pool.
 func (r *Repository) GetPool(ctx context.Context, id string) (*models.Pool, error) {
 	query := `
 		SELECT
 			id, chain, protocol, symbol, tvl, apy, apy_base, apy_reward,
 			reward_tokens, underlying_tokens, pool_meta, il_7d, apy_mean_30d,
 			volume_usd_1d, volume_usd_7d, score, apy_change_1h, apy_change_24h,
-			apy_change_7d, stablecoin, exposure, created_at, updated_at
+			apy_change_7d, stablecoin, exposure, data_source, data_completeness,
+			COALESCE(apy_raw, apy), is_outlier, tags, created_at, updated_at,
+			reward_schedule, audited, notes, curated_at
 		FROM pools
+		LEFT JOIN pool_curation ON pool_curation.pool_id = pools.id
 		WHERE id = $1
 	`
 
 	var pool models.Pool
+	var cur curationRow
 	err := r.pool.QueryRow(ctx, query, id).Scan(
 		&pool.ID, &pool.Chain, &pool.Protocol, &pool.Symbol,
 		&pool.TVL, &pool.APY, &pool.APYBase, &pool.APYReward,
 		&pool.RewardTokens, &pool.UnderlyingTokens, &pool.PoolMeta,
 		&pool.IL7D, &pool.APYMean30D, &pool.VolumeUSD1D, &pool.VolumeUSD7D,
 		&pool.Score, &pool.APYChange1H, &pool.APYChange24H, &pool.APYChange7D,
-		&pool.StableCoin, &pool.Exposure, &pool.CreatedAt, &pool.UpdatedAt,
+		&pool.StableCoin, &pool.Exposure, &pool.DataSource, &pool.DataCompleteness,
+		&pool.APYRaw, &pool.IsOutlier, &pool.Tags, &pool.CreatedAt, &pool.UpdatedAt,
+		&cur.rewardSchedule, &cur.audited, &cur.notes, &cur.curatedAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("pool not found")
+			return nil, fmt.Errorf("pool not found: %w", os.ErrNotExist)
 		}
 		return nil, fmt.Errorf("failed to get pool: %w", err)
 	}
+	pool.VolumeTVLRatio = models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL)
+	pool.BaseRatio = models.CalculateBaseRatio(pool.APYBase, pool.APY)
+	pool.Curation = cur.curation()
 
 	return &pool, nil
 }
 
-// GetPoolHistory returns historical APY data for a pool
-func (r *Repository) GetPoolHistory(ctx context.Context, poolID string, period string) ([]models.HistoricalAPY, error) {
-	// Calculate time range based on period
-	var interval string
-	var bucketInterval string
+// PoolExists reports whether a pool with the given ID exists
+func (r *Repository) PoolExists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := r.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM pools WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check pool: %w", err)
+	}
+	return exists, nil
+}
 
-	switch period {
-	case "1h":
-		interval = "1 hour"
-		bucketInterval = "1 minute"
-	case "24h":
-		interval = "24 hours"
-		bucketInterval = "5 minutes"
-	case "7d":
-		interval = "7 days"
-		bucketInterval = "1 hour"
-	case "30d":
-		interval = "30 days"
-		bucketInterval = "6 hours"
-	default:
-		interval = "24 hours"
-		bucketInterval = "5 minutes"
+// GetPoolHistory returns historical APY data for a pool since a time,
+// averaged per bucket of the given width aligned in loc. Bucket timestamps
+// are returned in loc.
+func (r *Repository) GetPoolHistory(ctx context.Context, poolID string, since time.Time, bucket string, loc *time.Location) ([]models.HistoricalAPY, error) {
+	history := make([]models.HistoricalAPY, 0)
+	err := r.StreamPoolHistory(ctx, poolID, since, bucket, loc, 0, func(h models.HistoricalAPY) error {
+		history = append(history, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Use TimescaleDB time_bucket for efficient aggregation
-	query := fmt.Sprintf(`
+	return history, nil
+}
+
+// StreamPoolHistory is GetPoolHistory calling fn with each bucket, oldest
+// first, as the rows are read instead of collecting them. At most limit
+// buckets are read (0 = all). An error from fn cancels the query and is
+// returned.
+func (r *Repository) StreamPoolHistory(ctx context.Context, poolID string, since time.Time, bucket string, loc *time.Location, limit int, fn func(models.HistoricalAPY) error) error {
+	width, ok := models.HistoryBuckets[bucket]
+	if !ok {
+		return fmt.Errorf("unknown history bucket %q", bucket)
+	}
+
+	// time_bucket with a time zone buckets by the wall clock in it from
+	// local midnight, matching models.HistoryBucketStart
+	query := `
 		SELECT
 			pool_id,
-			time_bucket('%s', timestamp) AS bucket,
+			time_bucket($2::interval, timestamp, $3) AS bucket,
 			AVG(apy) AS apy,
 			AVG(tvl) AS tvl,
 			AVG(apy_base) AS apy_base,
 			AVG(apy_reward) AS apy_reward
 		FROM historical_apy
 		WHERE pool_id = $1
-		  AND timestamp > NOW() - INTERVAL '%s'
+		  AND timestamp >= $4
 		GROUP BY pool_id, bucket
 		ORDER BY bucket ASC
-	`, bucketInterval, interval)
+		LIMIT NULLIF($5::int, 0)
+	`
 
-	rows, err := r.pool.Query(ctx, query, poolID)
+	// Stopping early cancels the query rather than reading the rest of it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, query, poolID, fmt.Sprintf("%d minutes", int(width/time.Minute)), loc.String(), since, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query pool history: %w", err)
+		return fmt.Errorf("failed to query pool history: %w", err)
 	}
 	defer rows.Close()
 
-	history := make([]models.HistoricalAPY, 0)
 	for rows.Next() {
 		var h models.HistoricalAPY
 		err := rows.Scan(&h.PoolID, &h.Timestamp, &h.APY, &h.TVL, &h.APYBase, &h.APYReward)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan history: %w", err)
+			return fmt.Errorf("failed to scan history: %w", err)
 		}
-		history = append(history, h)
+		h.Timestamp = h.Timestamp.In(loc)
+		if err := fn(h); err != nil {
+			cancel()
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read pool history: %w", err)
 	}
 
-	return history, nil
+	return nil
 }
 
-// UpsertPool inserts or updates a pool
-func (r *Repository) UpsertPool(ctx context.Context, pool *models.Pool) error {
+// GetPoolSparklines returns the hourly average APY of the given pools since
+// a time by pool ID, oldest first, rounded to 2 decimals. Pools without
+// history are left out. It is one query however many pools are asked for.
+func (r *Repository) GetPoolSparklines(ctx context.Context, ids []string, since time.Time) (map[string][]float64, error) {
 	query := `
-		INSERT INTO pools (
-			id, chain, protocol, symbol, tvl, apy, apy_base, apy_reward,
-			reward_tokens, underlying_tokens, pool_meta, il_7d, apy_mean_30d,
-			volume_usd_1d, volume_usd_7d, score, apy_change_1h, apy_change_24h,
-			apy_change_7d, stablecoin, exposure, created_at, updated_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
-			$16, $17, $18, $19, $20, $21, $22, $23
-		)
-		ON CONFLICT (id) DO UPDATE SET
-			tvl = EXCLUDED.tvl,
-			apy = EXCLUDED.apy,
-			apy_base = EXCLUDED.apy_base,
-			apy_reward = EXCLUDED.apy_reward,
-			reward_tokens = EXCLUDED.reward_tokens,
-			il_7d = EXCLUDED.il_7d,
-			apy_mean_30d = EXCLUDED.apy_mean_30d,
-			volume_usd_1d = EXCLUDED.volume_usd_1d,
-			volume_usd_7d = EXCLUDED.volume_usd_7d,
-			score = EXCLUDED.score,
-			apy_change_1h = EXCLUDED.apy_change_1h,
-			apy_change_24h = EXCLUDED.apy_change_24h,
-			apy_change_7d = EXCLUDED.apy_change_7d,
-			updated_at = NOW()
+		SELECT pool_id, array_agg(apy ORDER BY bucket)
+		FROM (
+			SELECT
+				pool_id,
+				time_bucket('1 hour', timestamp) AS bucket,
+				ROUND(AVG(apy), 2)::float8 AS apy
+			FROM historical_apy
+			WHERE pool_id = ANY($1)
+			  AND timestamp >= $2
+			GROUP BY pool_id, bucket
+		) hourly
+		GROUP BY pool_id
 	`
 
-	_, err := r.pool.Exec(ctx, query,
+	rows, err := r.pool.Query(ctx, query, ids, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool sparklines: %w", err)
+	}
+	defer rows.Close()
+
+	sparklines := make(map[string][]float64, len(ids))
+	for rows.Next() {
+		var id string
+		var points []float64
+		if err := rows.Scan(&id, &points); err != nil {
+			return nil, fmt.Errorf("failed to scan pool sparkline: %w", err)
+		}
+		sparklines[id] = points
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pool sparklines: %w", err)
+	}
+
+	return sparklines, nil
+}
+
+// historyWindow returns the time range and time_bucket width for a history
+// period, defaulting to 24h
+func historyWindow(period string) (interval, bucketInterval string) {
+	switch period {
+	case "1h":
+		return "1 hour", "1 minute"
+	case "7d":
+		return "7 days", "1 hour"
+	case "30d":
+		return "30 days", "6 hours"
+	default:
+		return "24 hours", "5 minutes"
+	}
+}
+
+// GetProtocolHistory returns the APY history of a protocol: per time bucket,
+// the TVL-weighted average APY and combined TVL of its pools
+func (r *Repository) GetProtocolHistory(ctx context.Context, protocol string, period string) ([]models.AggregateHistoryPoint, error) {
+	history, err := r.aggregateHistory(ctx, "protocol", protocol, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query protocol history: %w", err)
+	}
+	return history, nil
+}
+
+// GetChainHistory returns the APY history of a chain: per time bucket, the
+// TVL-weighted average APY and total TVL of the pools on it
+func (r *Repository) GetChainHistory(ctx context.Context, chain string, period string) ([]models.AggregateHistoryPoint, error) {
+	history, err := r.aggregateHistory(ctx, "chain", chain, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chain history: %w", err)
+	}
+	return history, nil
+}
+
+// aggregateHistory buckets the history of the pools whose column matches
+// value case-insensitively. Each pool's samples are averaged within the
+// bucket first, so pools sampled more often don't weigh more. Buckets where
+// every pool reports zero TVL fall back to the plain average APY. column is
+// a fixed pools column, never user input.
+func (r *Repository) aggregateHistory(ctx context.Context, column, value, period string) ([]models.AggregateHistoryPoint, error) {
+	interval, bucketInterval := historyWindow(period)
+
+	query := fmt.Sprintf(`
+		WITH per_pool AS (
+			SELECT
+				time_bucket('%s', h.timestamp) AS bucket,
+				h.pool_id,
+				AVG(h.apy) AS apy,
+				AVG(h.tvl) AS tvl
+			FROM historical_apy h
+			JOIN pools p ON p.id = h.pool_id
+			WHERE LOWER(p.%s) = LOWER($1)
+			  AND h.timestamp > NOW() - INTERVAL '%s'
+			GROUP BY bucket, h.pool_id
+		)
+		SELECT
+			bucket,
+			COALESCE(SUM(apy * tvl) / NULLIF(SUM(tvl), 0), AVG(apy)) AS apy,
+			SUM(tvl) AS tvl,
+			COUNT(*) AS pool_count
+		FROM per_pool
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, bucketInterval, column, interval)
+
+	rows, err := r.pool.Query(ctx, query, value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]models.AggregateHistoryPoint, 0)
+	for rows.Next() {
+		var h models.AggregateHistoryPoint
+		if err := rows.Scan(&h.Timestamp, &h.APY, &h.TVL, &h.PoolCount); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
+
+// ErrDataSourceConflict is returned when a pool would be overwritten with
+// data from another source, e.g. a manual import of a DeFiLlama pool
+var ErrDataSourceConflict = errors.New("pool belongs to another data source")
+
+// UpsertPool inserts or updates a pool. A pool is only ever updated from the
+// source it was first stored from; otherwise the error wraps
+// ErrDataSourceConflict and the pool is left as it was.
+func (r *Repository) UpsertPool(ctx context.Context, pool *models.Pool) error {
+	tag, err := r.pool.Exec(ctx, upsertPoolQuery,
 		pool.ID, pool.Chain, pool.Protocol, pool.Symbol,
 		pool.TVL, pool.APY, pool.APYBase, pool.APYReward,
 		pool.RewardTokens, pool.UnderlyingTokens, pool.PoolMeta,
 		pool.IL7D, pool.APYMean30D, pool.VolumeUSD1D, pool.VolumeUSD7D,
 		pool.Score, pool.APYChange1H, pool.APYChange24H, pool.APYChange7D,
-		pool.StableCoin, pool.Exposure, pool.CreatedAt, pool.UpdatedAt,
+		pool.StableCoin, pool.Exposure, dataSourceOrDefault(pool.DataSource), pool.DataCompleteness,
+		pool.APYRaw, pool.IsOutlier, tagsOrEmpty(pool.Tags), pool.CreatedAt, pool.UpdatedAt,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to upsert pool: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to upsert pool %s: %w", pool.ID, ErrDataSourceConflict)
+	}
 
 	return nil
 }
 
+// upsertPoolQuery inserts a pool or updates it from the same data source.
+// The data source itself is never updated.
+const upsertPoolQuery = `
+	INSERT INTO pools (
+		id, chain, protocol, symbol, tvl, apy, apy_base, apy_reward,
+		reward_tokens, underlying_tokens, pool_meta, il_7d, apy_mean_30d,
+		volume_usd_1d, volume_usd_7d, score, apy_change_1h, apy_change_24h,
+		apy_change_7d, stablecoin, exposure, data_source, data_completeness,
+		apy_raw, is_outlier, tags, created_at, updated_at
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+		$16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28
+	)
+	ON CONFLICT (id) DO UPDATE SET
+		tvl = EXCLUDED.tvl,
+		apy = EXCLUDED.apy,
+		apy_base = EXCLUDED.apy_base,
+		apy_reward = EXCLUDED.apy_reward,
+		reward_tokens = EXCLUDED.reward_tokens,
+		il_7d = EXCLUDED.il_7d,
+		apy_mean_30d = EXCLUDED.apy_mean_30d,
+		volume_usd_1d = EXCLUDED.volume_usd_1d,
+		volume_usd_7d = EXCLUDED.volume_usd_7d,
+		score = EXCLUDED.score,
+		apy_change_1h = EXCLUDED.apy_change_1h,
+		apy_change_24h = EXCLUDED.apy_change_24h,
+		apy_change_7d = EXCLUDED.apy_change_7d,
+		data_completeness = EXCLUDED.data_completeness,
+		apy_raw = EXCLUDED.apy_raw,
+		is_outlier = EXCLUDED.is_outlier,
+		tags = EXCLUDED.tags,
+		updated_at = NOW()
+	WHERE pools.data_source = EXCLUDED.data_source
+`
+
+// tagsOrEmpty returns the pool's tags, as an empty array for an untagged
+// pool since the column is NOT NULL
+func tagsOrEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// dataSourceOrDefault returns the pool's data source, treating an unset
+// source as DeFiLlama
+func dataSourceOrDefault(source string) string {
+	if source == "" {
+		return models.DataSourceDeFiLlama
+	}
+	return source
+}
+
 // InsertHistoricalAPY records a historical APY data point
 func (r *Repository) InsertHistoricalAPY(ctx context.Context, h *models.HistoricalAPY) error {
 	query := `
@@ -381,91 +748,317 @@ func (r *Repository) InsertHistoricalAPY(ctx context.Context, h *models.Historic
 	return nil
 }
 
-// =============================================================================
-// Opportunity Operations
-// =============================================================================
-
-// ListOpportunities returns opportunities based on filters
-func (r *Repository) ListOpportunities(ctx context.Context, filter models.OpportunityFilter) ([]models.Opportunity, int64, error) {
-	query := `
-		SELECT
-			id, type, title, description, source_pool_id, target_pool_id,
-			pool_id, asset, chain, apy_difference, apy_growth, current_apy,
-			potential_profit, tvl, risk_level, score, is_active,
-			detected_at, last_seen_at, expires_at, created_at, updated_at
-		FROM opportunities
-		WHERE 1=1
-	`
-	countQuery := "SELECT COUNT(*) FROM opportunities WHERE 1=1"
-	args := []interface{}{}
-	argCount := 0
+// InsertHistoricalAPYPoints records a pool's historical data points, leaving
+// any already recorded at the same timestamp untouched. Returns the number of
+// points inserted.
+func (r *Repository) InsertHistoricalAPYPoints(ctx context.Context, poolID string, points []models.HistoricalAPY) (int64, error) {
+	if len(points) == 0 {
+		return 0, nil
+	}
 
-	if filter.ActiveOnly {
-		query += " AND is_active = true"
-		countQuery += " AND is_active = true"
+	timestamps := make([]time.Time, len(points))
+	apys := make([]string, len(points))
+	tvls := make([]string, len(points))
+	bases := make([]string, len(points))
+	rewards := make([]string, len(points))
+	for i, p := range points {
+		timestamps[i] = p.Timestamp
+		apys[i] = p.APY.String()
+		tvls[i] = p.TVL.String()
+		bases[i] = p.APYBase.String()
+		rewards[i] = p.APYReward.String()
 	}
 
-	if filter.Type != "" {
-		argCount++
-		query += fmt.Sprintf(" AND type = $%d", argCount)
-		countQuery += fmt.Sprintf(" AND type = $%d", argCount)
-		args = append(args, filter.Type)
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO historical_apy (pool_id, timestamp, apy, tvl, apy_base, apy_reward)
+		SELECT $1, v.ts, v.apy::numeric, v.tvl::numeric, v.apy_base::numeric, v.apy_reward::numeric
+		FROM unnest($2::timestamptz[], $3::text[], $4::text[], $5::text[], $6::text[]) AS v(ts, apy, tvl, apy_base, apy_reward)
+		ON CONFLICT (pool_id, timestamp) DO NOTHING
+	`, poolID, timestamps, apys, tvls, bases, rewards)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert historical APY points: %w", err)
 	}
 
-	if filter.RiskLevel != "" {
-		argCount++
-		query += fmt.Sprintf(" AND risk_level = $%d", argCount)
-		countQuery += fmt.Sprintf(" AND risk_level = $%d", argCount)
-		args = append(args, filter.RiskLevel)
+	return tag.RowsAffected(), nil
+}
+
+// DeleteHistoricalAPYBefore removes the historical data points recorded
+// before cutoff and returns how many were removed
+func (r *Repository) DeleteHistoricalAPYBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM historical_apy WHERE timestamp < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete historical APY: %w", err)
 	}
+	return tag.RowsAffected(), nil
+}
 
-	if filter.Chain != "" {
-		argCount++
-		query += fmt.Sprintf(" AND chain = $%d", argCount)
-		countQuery += fmt.Sprintf(" AND chain = $%d", argCount)
-		args = append(args, filter.Chain)
+// UpdatePoolScores sets the score of each pool in scores, keyed by pool ID
+func (r *Repository) UpdatePoolScores(ctx context.Context, scores map[string]decimal.Decimal) error {
+	if len(scores) == 0 {
+		return nil
 	}
 
-	if !filter.MinProfit.IsZero() {
-		argCount++
-		query += fmt.Sprintf(" AND potential_profit >= $%d", argCount)
-		countQuery += fmt.Sprintf(" AND potential_profit >= $%d", argCount)
-		args = append(args, filter.MinProfit)
+	ids := make([]string, 0, len(scores))
+	values := make([]string, 0, len(scores))
+	for id, score := range scores {
+		ids = append(ids, id)
+		values = append(values, score.String())
 	}
 
-	// Get total count
-	var total int64
-	err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total)
+	_, err := r.pool.Exec(ctx, `
+		UPDATE pools p
+		SET score = v.score::numeric
+		FROM unnest($1::text[], $2::text[]) AS v(id, score)
+		WHERE p.id = v.id
+	`, ids, values)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count opportunities: %w", err)
+		return fmt.Errorf("failed to update pool scores: %w", err)
 	}
 
-	// Add sorting
-	sortColumn := "score"
-	switch filter.SortBy {
-	case "profit":
-		sortColumn = "potential_profit"
-	case "apy":
-		sortColumn = "current_apy"
-	case "detectedAt":
-		sortColumn = "detected_at"
-	}
+	return nil
+}
 
-	sortOrder := "DESC"
-	if filter.SortOrder == "asc" {
-		sortOrder = "ASC"
+// GetPoolRiskLevels returns the stored risk level of each of poolIDs. Pools
+// without a stored level are omitted.
+func (r *Repository) GetPoolRiskLevels(ctx context.Context, poolIDs []string) (map[string]models.RiskLevel, error) {
+	levels := make(map[string]models.RiskLevel, len(poolIDs))
+	if len(poolIDs) == 0 {
+		return levels, nil
 	}
 
-	query += fmt.Sprintf(" ORDER BY %s %s", sortColumn, sortOrder)
-
-	// Add pagination
-	argCount++
-	query += fmt.Sprintf(" LIMIT $%d", argCount)
-	args = append(args, filter.Limit)
+	query := `
+		SELECT id, risk_level
+		FROM pools
+		WHERE id = ANY($1) AND risk_level IS NOT NULL
+	`
 
-	argCount++
-	query += fmt.Sprintf(" OFFSET $%d", argCount)
-	args = append(args, filter.Offset)
+	rows, err := r.pool.Query(ctx, query, poolIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool risk levels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var level models.RiskLevel
+		if err := rows.Scan(&id, &level); err != nil {
+			return nil, fmt.Errorf("failed to scan pool risk level: %w", err)
+		}
+		levels[id] = level
+	}
+
+	return levels, rows.Err()
+}
+
+// SavePoolRiskLevels stores new risk levels on pools and appends the given
+// transitions to the audit log, in one transaction
+func (r *Repository) SavePoolRiskLevels(ctx context.Context, levels map[string]models.RiskLevel, transitions []models.RiskTransition) error {
+	if len(levels) == 0 && len(transitions) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(levels))
+	values := make([]string, 0, len(levels))
+	for id, level := range levels {
+		ids = append(ids, id)
+		values = append(values, string(level))
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin risk level transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE pools p
+		SET risk_level = v.level
+		FROM unnest($1::text[], $2::text[]) AS v(id, level)
+		WHERE p.id = v.id
+	`, ids, values)
+	if err != nil {
+		return fmt.Errorf("failed to update pool risk levels: %w", err)
+	}
+
+	for _, t := range transitions {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pool_risk_transitions (pool_id, from_level, to_level, factors, transitioned_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, t.PoolID, t.FromLevel, t.ToLevel, t.Factors, t.TransitionedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert risk transition for %s: %w", t.PoolID, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit risk levels: %w", err)
+	}
+
+	return nil
+}
+
+// GetPoolRiskTransitions returns a pool's most recent risk transitions,
+// newest first
+func (r *Repository) GetPoolRiskTransitions(ctx context.Context, poolID string, limit int) ([]models.RiskTransition, error) {
+	query := `
+		SELECT id, pool_id, from_level, to_level, factors, transitioned_at
+		FROM pool_risk_transitions
+		WHERE pool_id = $1
+		ORDER BY transitioned_at DESC, id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.pool.Query(ctx, query, poolID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query risk transitions: %w", err)
+	}
+	defer rows.Close()
+
+	transitions := make([]models.RiskTransition, 0)
+	for rows.Next() {
+		var t models.RiskTransition
+		if err := rows.Scan(&t.ID, &t.PoolID, &t.FromLevel, &t.ToLevel, &t.Factors, &t.TransitionedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan risk transition: %w", err)
+		}
+		transitions = append(transitions, t)
+	}
+
+	return transitions, rows.Err()
+}
+
+// curationRow scans the pool_curation columns of a LEFT JOIN, all NULL for a
+// pool that isn't curated
+type curationRow struct {
+	rewardSchedule *string
+	audited        *bool
+	notes          *string
+	curatedAt      *time.Time
+}
+
+// curation returns the scanned curation, nil if the pool isn't curated
+func (c curationRow) curation() *models.PoolCuration {
+	if c.rewardSchedule == nil {
+		return nil
+	}
+	return &models.PoolCuration{
+		RewardSchedule: *c.rewardSchedule,
+		Audited:        *c.audited,
+		Notes:          *c.notes,
+		CuratedAt:      *c.curatedAt,
+	}
+}
+
+// sustainableCond returns the condition that the pool in table has
+// sustainable yield, with its arguments. Base APY is compared against ratio
+// * APY to avoid dividing by zero APY.
+func sustainableCond(table string, s models.SustainableYield) (string, []interface{}) {
+	base := "COALESCE(" + table + ".apy_base, 0)"
+	cond := "(" + table + ".apy > 0 AND " + base + " >= %[1]s * " + table + ".apy)"
+	if !s.MinBaseAPY.IsPositive() {
+		return cond, []interface{}{s.MinBaseRatio}
+	}
+	return "(" + cond + " OR " + base + " >= %[2]s)", []interface{}{s.MinBaseRatio, s.MinBaseAPY}
+}
+
+// curationFilter returns the condition selecting pools with a curation
+// matching cond, or with none if want is false
+func curationFilter(want bool, cond string) string {
+	exists := "EXISTS (SELECT 1 FROM pool_curation pc WHERE pc.pool_id = pools.id" + cond + ")"
+	if !want {
+		return "NOT " + exists
+	}
+	return exists
+}
+
+// GetPoolCurations returns the curation of each of poolIDs. Pools that
+// aren't curated are omitted.
+func (r *Repository) GetPoolCurations(ctx context.Context, poolIDs []string) (map[string]models.PoolCuration, error) {
+	curations := make(map[string]models.PoolCuration, len(poolIDs))
+	if len(poolIDs) == 0 {
+		return curations, nil
+	}
+
+	query := `
+		SELECT pool_id, reward_schedule, audited, notes, curated_at
+		FROM pool_curation
+		WHERE pool_id = ANY($1)
+	`
+
+	rows, err := r.pool.Query(ctx, query, poolIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool curations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var c models.PoolCuration
+		if err := rows.Scan(&id, &c.RewardSchedule, &c.Audited, &c.Notes, &c.CuratedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pool curation: %w", err)
+		}
+		curations[id] = c
+	}
+
+	return curations, rows.Err()
+}
+
+// SetPoolCuration creates or replaces the curation of a pool. The error
+// wraps os.ErrNotExist if there is no such pool.
+func (r *Repository) SetPoolCuration(ctx context.Context, poolID string, c *models.PoolCuration) error {
+	query := `
+		INSERT INTO pool_curation (pool_id, reward_schedule, audited, notes)
+		SELECT id, $2, $3, $4 FROM pools WHERE id = $1
+		ON CONFLICT (pool_id) DO UPDATE SET
+			reward_schedule = EXCLUDED.reward_schedule,
+			audited = EXCLUDED.audited,
+			notes = EXCLUDED.notes,
+			curated_at = NOW()
+		RETURNING curated_at
+	`
+
+	err := r.pool.QueryRow(ctx, query, poolID, c.RewardSchedule, c.Audited, c.Notes).Scan(&c.CuratedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("pool not found: %w", os.ErrNotExist)
+		}
+		return fmt.Errorf("failed to set pool curation: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePoolCuration removes the curation of a pool. The error wraps
+// os.ErrNotExist if the pool isn't curated.
+func (r *Repository) DeletePoolCuration(ctx context.Context, poolID string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM pool_curation WHERE pool_id = $1`, poolID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pool curation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("pool curation not found: %w", os.ErrNotExist)
+	}
+
+	return nil
+}
+
+// =============================================================================
+// Opportunity Operations
+// =============================================================================
+
+// ListOpportunities returns opportunities based on filters
+func (r *Repository) ListOpportunities(ctx context.Context, filter models.OpportunityFilter) ([]models.Opportunity, int64, error) {
+	ctx = withFilterFingerprint(ctx, filter)
+	q := opportunitiesQuery(filter)
+
+	// Get total count
+	var total int64
+	countQuery, countArgs := q.count()
+	err := r.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count opportunities: %w", err)
+	}
+
+	query, args := q.sql()
 
 	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
@@ -480,9 +1073,9 @@ func (r *Repository) ListOpportunities(ctx context.Context, filter models.Opport
 			&o.ID, &o.Type, &o.Title, &o.Description,
 			&o.SourcePoolID, &o.TargetPoolID, &o.PoolID,
 			&o.Asset, &o.Chain, &o.APYDifference, &o.APYGrowth,
-			&o.CurrentAPY, &o.PotentialProfit, &o.TVL, &o.RiskLevel,
-			&o.Score, &o.IsActive, &o.DetectedAt, &o.LastSeenAt,
-			&o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt,
+			&o.CurrentAPY, &o.PotentialProfit, &o.TVL, &o.Costs, &o.ProfitByHorizon, &o.RiskLevel,
+			&o.Score, &o.IsActive, &o.StatusReason, &o.DetectedAt, &o.LastSeenAt,
+			&o.ExpiresAt, &o.RealizedAPYDiff, &o.OutcomeClass, &o.CreatedAt, &o.UpdatedAt,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan opportunity: %w", err)
@@ -493,15 +1086,221 @@ func (r *Repository) ListOpportunities(ctx context.Context, filter models.Opport
 	return opportunities, total, nil
 }
 
+// opportunitiesQuery builds the opportunities listing and count queries
+func opportunitiesQuery(filter models.OpportunityFilter) *listQuery {
+	q := newListQuery(`
+		SELECT
+			id, type, title, description, source_pool_id, target_pool_id,
+			pool_id, asset, chain, apy_difference, apy_growth, current_apy,
+			potential_profit, tvl, costs, profit_by_horizon, risk_level, score, is_active,
+			COALESCE(status_reason, ''),
+			detected_at, last_seen_at, expires_at,
+			realized_apy_diff, COALESCE(outcome_class, ''),
+			created_at, updated_at
+		FROM opportunities`,
+		"SELECT COUNT(*) FROM opportunities")
+
+	if filter.ActiveOnly {
+		q.where("is_active = true")
+	}
+
+	if filter.Type != "" {
+		q.where("type = %s", filter.Type)
+	}
+
+	if filter.RiskLevel != "" {
+		q.where("risk_level = %s", filter.RiskLevel)
+	}
+
+	if filter.Chain != "" {
+		q.where("chain = %s", filter.Chain)
+	}
+
+	if !filter.MinProfit.IsZero() {
+		q.where("potential_profit >= %s", filter.MinProfit)
+	}
+
+	if !filter.MinScore.IsZero() {
+		q.where("score >= %s", filter.MinScore)
+	}
+
+	// Judged by the pool's current yield; a yield gap by its target
+	if filter.SustainableOnly {
+		cond, args := sustainableCond("p", filter.Sustainability)
+		q.where("EXISTS (SELECT 1 FROM pools p WHERE p.id = COALESCE(opportunities.pool_id, opportunities.target_pool_id) AND "+cond+")", args...)
+	}
+
+	// The time bounds let the (is_active, detected_at) index serve the most
+	// common listings
+	if !filter.DetectedAfter.IsZero() {
+		q.where("detected_at >= %s", filter.DetectedAfter)
+	}
+	if !filter.DetectedBefore.IsZero() {
+		q.where("detected_at < %s", filter.DetectedBefore)
+	}
+
+	// Add sorting
+	sortColumn := "score"
+	switch filter.SortBy {
+	case "profit":
+		sortColumn = "potential_profit"
+	case "apy":
+		sortColumn = "current_apy"
+	case "detected_at", "detectedAt": // The REST docs and GraphQL use detected_at
+		sortColumn = "detected_at"
+	}
+
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	q.order(sortColumn + " " + sortOrder)
+	q.page(filter.Limit, filter.Offset)
+
+	return q
+}
+
+// GetPoolOpportunities returns the active opportunities involving a pool as
+// the source or target of a yield gap or as the subject of the opportunity,
+// highest score first
+func (r *Repository) GetPoolOpportunities(ctx context.Context, poolID string) ([]models.Opportunity, error) {
+	query := `
+		SELECT
+			id, type, title, description, source_pool_id, target_pool_id,
+			pool_id, asset, chain, apy_difference, apy_growth, current_apy,
+			potential_profit, tvl, costs, profit_by_horizon, risk_level, score, is_active,
+			COALESCE(status_reason, ''),
+			detected_at, last_seen_at, expires_at, created_at, updated_at
+		FROM opportunities
+		WHERE is_active = true
+			AND (pool_id = $1 OR source_pool_id = $1 OR target_pool_id = $1)
+		ORDER BY score DESC, id ASC
+	`
+
+	rows, err := r.pool.Query(ctx, query, poolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool opportunities: %w", err)
+	}
+	defer rows.Close()
+
+	opportunities := make([]models.Opportunity, 0)
+	for rows.Next() {
+		var o models.Opportunity
+		err := rows.Scan(
+			&o.ID, &o.Type, &o.Title, &o.Description,
+			&o.SourcePoolID, &o.TargetPoolID, &o.PoolID,
+			&o.Asset, &o.Chain, &o.APYDifference, &o.APYGrowth,
+			&o.CurrentAPY, &o.PotentialProfit, &o.TVL, &o.Costs, &o.ProfitByHorizon, &o.RiskLevel,
+			&o.Score, &o.IsActive, &o.StatusReason, &o.DetectedAt, &o.LastSeenAt,
+			&o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity: %w", err)
+		}
+		opportunities = append(opportunities, o)
+	}
+
+	return opportunities, rows.Err()
+}
+
+// ListActiveOpportunities returns every active opportunity, most recently
+// detected first
+func (r *Repository) ListActiveOpportunities(ctx context.Context) ([]models.Opportunity, error) {
+	query := `
+		SELECT
+			id, type, title, description, source_pool_id, target_pool_id,
+			pool_id, asset, chain, apy_difference, apy_growth, current_apy,
+			potential_profit, tvl, costs, profit_by_horizon, risk_level, score, is_active,
+			COALESCE(status_reason, ''),
+			detected_at, last_seen_at, expires_at, created_at, updated_at
+		FROM opportunities
+		WHERE is_active = true
+		ORDER BY detected_at DESC, id ASC
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active opportunities: %w", err)
+	}
+	defer rows.Close()
+
+	opportunities := make([]models.Opportunity, 0)
+	for rows.Next() {
+		var o models.Opportunity
+		err := rows.Scan(
+			&o.ID, &o.Type, &o.Title, &o.Description,
+			&o.SourcePoolID, &o.TargetPoolID, &o.PoolID,
+			&o.Asset, &o.Chain, &o.APYDifference, &o.APYGrowth,
+			&o.CurrentAPY, &o.PotentialProfit, &o.TVL, &o.Costs, &o.ProfitByHorizon, &o.RiskLevel,
+			&o.Score, &o.IsActive, &o.StatusReason, &o.DetectedAt, &o.LastSeenAt,
+			&o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity: %w", err)
+		}
+		opportunities = append(opportunities, o)
+	}
+
+	return opportunities, rows.Err()
+}
+
+// GetBestOpportunitiesPerChain returns the highest-scoring active
+// opportunity of each chain, best first, for up to limit chains
+func (r *Repository) GetBestOpportunitiesPerChain(ctx context.Context, limit int) ([]models.Opportunity, error) {
+	query := `
+		SELECT * FROM (
+			SELECT DISTINCT ON (chain)
+				id, type, title, description, source_pool_id, target_pool_id,
+				pool_id, asset, chain, apy_difference, apy_growth, current_apy,
+				potential_profit, tvl, costs, profit_by_horizon, risk_level, score, is_active,
+				COALESCE(status_reason, ''),
+				detected_at, last_seen_at, expires_at, created_at, updated_at
+			FROM opportunities
+			WHERE is_active = true AND chain <> ''
+			ORDER BY chain, score DESC, detected_at DESC, id ASC
+		) best
+		ORDER BY score DESC, chain ASC
+		LIMIT $1
+	`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query best opportunities per chain: %w", err)
+	}
+	defer rows.Close()
+
+	opportunities := make([]models.Opportunity, 0)
+	for rows.Next() {
+		var o models.Opportunity
+		err := rows.Scan(
+			&o.ID, &o.Type, &o.Title, &o.Description,
+			&o.SourcePoolID, &o.TargetPoolID, &o.PoolID,
+			&o.Asset, &o.Chain, &o.APYDifference, &o.APYGrowth,
+			&o.CurrentAPY, &o.PotentialProfit, &o.TVL, &o.Costs, &o.ProfitByHorizon, &o.RiskLevel,
+			&o.Score, &o.IsActive, &o.StatusReason, &o.DetectedAt, &o.LastSeenAt,
+			&o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity: %w", err)
+		}
+		opportunities = append(opportunities, o)
+	}
+
+	return opportunities, rows.Err()
+}
+
 // GetTrendingPools returns pools with significant APY growth
 func (r *Repository) GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error) {
 	query := `
 		SELECT
 			p.id, p.chain, p.protocol, p.symbol, p.tvl, p.apy,
 			p.apy_base, p.apy_reward, p.score,
-			p.apy_change_1h, p.apy_change_24h, p.apy_change_7d
+			p.apy_change_1h, p.apy_change_24h, p.apy_change_7d,
+			c.reward_schedule, c.audited, c.notes, c.curated_at
 		FROM pools p
-		WHERE p.apy_change_24h > $1
+		LEFT JOIN pool_curation c ON c.pool_id = p.id
+		WHERE p.apy_change_24h > $1 AND NOT p.is_outlier
 	`
 	args := []interface{}{minGrowth}
 	argCount := 1
@@ -532,15 +1331,19 @@ func (r *Repository) GetTrendingPools(ctx context.Context, chain string, minGrow
 	for rows.Next() {
 		var pool models.Pool
 		var change1h, change24h, change7d decimal.Decimal
+		var cur curationRow
 
 		err := rows.Scan(
 			&pool.ID, &pool.Chain, &pool.Protocol, &pool.Symbol,
 			&pool.TVL, &pool.APY, &pool.APYBase, &pool.APYReward, &pool.Score,
 			&change1h, &change24h, &change7d,
+			&cur.rewardSchedule, &cur.audited, &cur.notes, &cur.curatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan trending pool: %w", err)
 		}
+		pool.BaseRatio = models.CalculateBaseRatio(pool.APYBase, pool.APY)
+		pool.Curation = cur.curation()
 
 		trending = append(trending, models.TrendingPool{
 			Pool:         &pool,
@@ -558,100 +1361,132 @@ func (r *Repository) GetTrendingPools(ctx context.Context, chain string, minGrow
 // Stats Operations
 // =============================================================================
 
-// ListChains returns all chains with aggregated statistics
-func (r *Repository) ListChains(ctx context.Context) ([]models.Chain, error) {
-	query := `
-		SELECT
-			chain,
-			COUNT(*) as pool_count,
-			SUM(tvl) as total_tvl,
-			AVG(apy) as average_apy,
-			MAX(apy) as max_apy
-		FROM pools
-		GROUP BY chain
-		ORDER BY total_tvl DESC
-	`
+// chainSortColumns maps chain sort fields to their columns
+var chainSortColumns = map[string]string{
+	"tvl":         "total_tvl",
+	"poolCount":   "pool_count",
+	"apy":         "average_apy",
+	"weightedApy": "weighted_apy",
+	"maxApy":      "max_apy",
+	"name":        "chain",
+}
 
-	rows, err := r.pool.Query(ctx, query)
+// ListChains returns a page of chains with aggregated statistics, including
+// the 24h trend of their TVL-weighted APY, and the total number of chains.
+// Pools below the filter's TVL floor are left out.
+func (r *Repository) ListChains(ctx context.Context, filter models.ChainFilter) ([]models.Chain, int64, error) {
+	var total int64
+	if err := r.pool.QueryRow(ctx, "SELECT COUNT(DISTINCT chain) FROM pools WHERE tvl >= $1", filter.TVLFloor).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count chains: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, chainsQuery(filter), filter.Limit, filter.Offset, filter.TVLFloor)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query chains: %w", err)
+		return nil, 0, fmt.Errorf("failed to query chains: %w", err)
 	}
 	defer rows.Close()
 
 	chains := make([]models.Chain, 0)
 	for rows.Next() {
 		var c models.Chain
+		var previousAPY decimal.NullDecimal
 		err := rows.Scan(
-			&c.Name, &c.PoolCount, &c.TotalTVL, &c.AverageAPY, &c.MaxAPY,
+			&c.Name, &c.PoolCount, &c.TotalTVL, &c.AverageAPY, &c.WeightedAPY, &c.MaxAPY,
+			&previousAPY,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan chain: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan chain: %w", err)
 		}
 		c.DisplayName = c.Name // Can be mapped to human-readable names
+		c.APYTrend = models.NewAPYTrend(c.WeightedAPY, previousAPY)
 		chains = append(chains, c)
 	}
 
-	return chains, nil
+	return chains, total, nil
 }
 
-// ListProtocols returns protocols with aggregated statistics
-func (r *Repository) ListProtocols(ctx context.Context, filter models.ProtocolFilter) ([]models.Protocol, int64, error) {
-	query := `
-		SELECT
-			protocol,
-			array_agg(DISTINCT chain) as chains,
-			COUNT(*) as pool_count,
-			SUM(tvl) as total_tvl,
-			AVG(apy) as average_apy,
-			MAX(apy) as max_apy
-		FROM pools
-		WHERE 1=1
-	`
-	countQuery := "SELECT COUNT(DISTINCT protocol) FROM pools WHERE 1=1"
-	args := []interface{}{}
-	argCount := 0
+// chainsQuery builds the chains listing query, with the limit and offset
+// bound to $1 and $2 and the TVL floor to $3. Unknown sort fields default to
+// TVL, and the chain name breaks ties so pages are stable.
+//
+// The weighted APY falls back to the plain average for chains whose TVL
+// sums to zero. The weighted APY 24 hours ago is computed the same way from
+// each pool's last history point in the 24 hours before that, and is NULL
+// for chains without such history.
+func chainsQuery(filter models.ChainFilter) string {
+	sortColumn, ok := chainSortColumns[filter.SortBy]
+	if !ok {
+		sortColumn = "total_tvl"
+	}
 
-	if filter.Chain != "" {
-		argCount++
-		query += fmt.Sprintf(" AND chain = $%d", argCount)
-		countQuery += fmt.Sprintf(" AND chain = $%d", argCount)
-		args = append(args, filter.Chain)
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
 	}
 
-	query += " GROUP BY protocol"
+	orderBy := sortColumn + " " + sortOrder
+	if sortColumn != "chain" {
+		orderBy += ", chain ASC"
+	}
 
-	// Get count
+	return fmt.Sprintf(`
+		WITH chain_stats AS (
+			SELECT
+				chain,
+				COUNT(*) as pool_count,
+				SUM(tvl) as total_tvl,
+				AVG(apy) as average_apy,
+				COALESCE(SUM(apy * tvl) / NULLIF(SUM(tvl), 0), AVG(apy)) as weighted_apy,
+				MAX(apy) as max_apy
+			FROM pools
+			WHERE tvl >= $3
+			GROUP BY chain
+		),
+		day_ago AS (
+			SELECT DISTINCT ON (pool_id) pool_id, apy, tvl
+			FROM historical_apy
+			WHERE timestamp <= NOW() - INTERVAL '24 hours'
+			  AND timestamp > NOW() - INTERVAL '48 hours'
+			ORDER BY pool_id, timestamp DESC
+		),
+		chain_day_ago AS (
+			SELECT
+				p.chain,
+				COALESCE(SUM(h.apy * h.tvl) / NULLIF(SUM(h.tvl), 0), AVG(h.apy)) as weighted_apy
+			FROM day_ago h
+			JOIN pools p ON p.id = h.pool_id
+			WHERE p.tvl >= $3
+			GROUP BY p.chain
+		)
+		SELECT
+			s.chain,
+			s.pool_count,
+			s.total_tvl,
+			s.average_apy,
+			s.weighted_apy,
+			s.max_apy,
+			d.weighted_apy as weighted_apy_24h
+		FROM chain_stats s
+		LEFT JOIN chain_day_ago d ON d.chain = s.chain
+		ORDER BY %s
+		LIMIT $1 OFFSET $2
+	`, orderBy)
+}
+
+// ListProtocols returns protocols with aggregated statistics
+func (r *Repository) ListProtocols(ctx context.Context, filter models.ProtocolFilter) ([]models.Protocol, int64, error) {
+	ctx = withFilterFingerprint(ctx, filter)
+	q := protocolsQuery(filter)
+
+	// Get count; it binds only the filter arguments
 	var total int64
-	err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total)
+	countQuery, countArgs := q.count()
+	err := r.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count protocols: %w", err)
 	}
 
-	// Add sorting
-	sortColumn := "total_tvl"
-	switch filter.SortBy {
-	case "poolCount":
-		sortColumn = "pool_count"
-	case "apy":
-		sortColumn = "average_apy"
-	}
-
-	sortOrder := "DESC"
-	if filter.SortOrder == "asc" {
-		sortOrder = "ASC"
-	}
-
-	query += fmt.Sprintf(" ORDER BY %s %s", sortColumn, sortOrder)
-
-	// Add pagination
-	argCount++
-	query += fmt.Sprintf(" LIMIT $%d", argCount)
-	args = append(args, filter.Limit)
-
-	argCount++
-	query += fmt.Sprintf(" OFFSET $%d", argCount)
-	args = append(args, filter.Offset)
-
+	query, args := q.sql()
 	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query protocols: %w", err)
@@ -674,8 +1509,57 @@ func (r *Repository) ListProtocols(ctx context.Context, filter models.ProtocolFi
 	return protocols, total, nil
 }
 
-// GetPlatformStats returns overall platform statistics
-func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStats, error) {
+// protocolsQuery builds the protocols listing and count queries.
+//
+// The statistics cover the pools matching the filter, but the chains of a
+// protocol always list every chain it has pools on, so filtering by chain
+// doesn't hide where else the protocol is deployed.
+func protocolsQuery(filter models.ProtocolFilter) *listQuery {
+	q := newListQuery(`
+		SELECT
+			p.protocol,
+			(SELECT array_agg(DISTINCT c.chain) FROM pools c WHERE c.protocol = p.protocol) as chains,
+			COUNT(*) as pool_count,
+			SUM(p.tvl) as total_tvl,
+			AVG(p.apy) as average_apy,
+			MAX(p.apy) as max_apy
+		FROM pools p`,
+		"SELECT COUNT(DISTINCT protocol) FROM pools p")
+
+	if filter.Chain != "" {
+		q.where("p.chain = %s", filter.Chain)
+	}
+
+	// Dead pools would skew the pool counts and average APYs
+	if filter.TVLFloor.IsPositive() {
+		q.where("p.tvl >= %s", filter.TVLFloor)
+	}
+
+	q.group("p.protocol")
+
+	// Add sorting
+	sortColumn := "total_tvl"
+	switch filter.SortBy {
+	case "poolCount":
+		sortColumn = "pool_count"
+	case "apy":
+		sortColumn = "average_apy"
+	}
+
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	q.order(fmt.Sprintf("%s %s, p.protocol ASC", sortColumn, sortOrder))
+	q.page(filter.Limit, filter.Offset)
+
+	return q
+}
+
+// GetPlatformStats returns overall platform statistics over the pools with at
+// least minTVL of TVL
+func (r *Repository) GetPlatformStats(ctx context.Context, minTVL decimal.Decimal) (*models.PlatformStats, error) {
 	stats := &models.PlatformStats{
 		TVLByChain:   make(map[string]decimal.Decimal),
 		PoolsByChain: make(map[string]int),
@@ -691,8 +1575,9 @@ func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStat
 			COUNT(DISTINCT chain) as total_chains,
 			COUNT(DISTINCT protocol) as total_protocols
 		FROM pools
+		WHERE tvl >= $1
 	`
-	err := r.pool.QueryRow(ctx, query).Scan(
+	err := r.pool.QueryRow(ctx, query, minTVL).Scan(
 		&stats.TotalPools, &stats.TotalTVL, &stats.AverageAPY,
 		&stats.MaxAPY, &stats.TotalChains, &stats.TotalProtocols,
 	)
@@ -701,9 +1586,7 @@ func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStat
 	}
 
 	// Get active opportunities count
-	var activeOpps int
-	err = r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM opportunities WHERE is_active = true").Scan(&activeOpps)
-	if err == nil {
+	if activeOpps, err := r.CountActiveOpportunities(ctx); err == nil {
 		stats.ActiveOpportunities = activeOpps
 	}
 
@@ -711,9 +1594,10 @@ func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStat
 	chainQuery := `
 		SELECT chain, SUM(tvl) as tvl, COUNT(*) as pool_count
 		FROM pools
+		WHERE tvl >= $1
 		GROUP BY chain
 	`
-	rows, err := r.pool.Query(ctx, chainQuery)
+	rows, err := r.pool.Query(ctx, chainQuery, minTVL)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -738,8 +1622,9 @@ func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStat
 			COUNT(*) FILTER (WHERE apy >= 50 AND apy < 100) as range_50_100,
 			COUNT(*) FILTER (WHERE apy >= 100) as range_100_plus
 		FROM pools
+		WHERE NOT is_outlier AND tvl >= $1
 	`
-	err = r.pool.QueryRow(ctx, distQuery).Scan(
+	err = r.pool.QueryRow(ctx, distQuery, minTVL).Scan(
 		&stats.APYDistribution.Range0to1,
 		&stats.APYDistribution.Range1to5,
 		&stats.APYDistribution.Range5to10,
@@ -757,6 +1642,147 @@ func (r *Repository) GetPlatformStats(ctx context.Context) (*models.PlatformStat
 	return stats, nil
 }
 
+// CountActiveOpportunities returns the number of active opportunities
+func (r *Repository) CountActiveOpportunities(ctx context.Context) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM opportunities WHERE is_active = true").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active opportunities: %w", err)
+	}
+	return count, nil
+}
+
+// poolsByChainQuery counts the pools of each chain with at least $1 of TVL
+const poolsByChainQuery = "SELECT chain, COUNT(*) FROM pools WHERE tvl >= $1 GROUP BY chain"
+
+// GetPoolDistribution counts pools per score bucket, TVL bucket and chain,
+// over the pools with at least minTVL of TVL. Edges are ascending lower
+// bounds; pools below the first edge are only included in the total.
+func (r *Repository) GetPoolDistribution(ctx context.Context, scoreEdges, tvlEdges []float64, minTVL decimal.Decimal) (*models.PoolDistribution, error) {
+	dist := &models.PoolDistribution{
+		ByScore: models.NewDistributionBuckets(scoreEdges),
+		ByTVL:   models.NewDistributionBuckets(tvlEdges),
+		ByChain: make(map[string]int),
+	}
+
+	query, args, dest := poolDistributionQuery(dist, minTVL)
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to get pool distribution: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, poolsByChainQuery, minTVL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool distribution by chain: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chain string
+		var count int
+		if err := rows.Scan(&chain, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan chain count: %w", err)
+		}
+		dist.ByChain[chain] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get pool distribution by chain: %w", err)
+	}
+
+	dist.LastUpdated = time.Now().UTC().Format(time.RFC3339)
+
+	return dist, nil
+}
+
+// poolDistributionQuery builds the query counting the pools with at least
+// minTVL of TVL, bound to $1, in total and per bucket of dist. It returns
+// the query, its arguments and the counts of dist to scan into.
+func poolDistributionQuery(dist *models.PoolDistribution, minTVL decimal.Decimal) (string, []interface{}, []interface{}) {
+	columns := []string{"COUNT(*)"}
+	dest := []interface{}{&dist.TotalPools}
+	args := []interface{}{minTVL}
+
+	// One FILTER clause per bucket, so all counts come from a single scan
+	addBuckets := func(column string, buckets []models.DistributionBucket) {
+		for i := range buckets {
+			args = append(args, buckets[i].Min)
+			clause := fmt.Sprintf("%s >= $%d", column, len(args))
+			if buckets[i].Max != nil {
+				args = append(args, *buckets[i].Max)
+				clause += fmt.Sprintf(" AND %s < $%d", column, len(args))
+			}
+			columns = append(columns, "COUNT(*) FILTER (WHERE "+clause+")")
+			dest = append(dest, &buckets[i].Count)
+		}
+	}
+	addBuckets("score", dist.ByScore)
+	addBuckets("tvl", dist.ByTVL)
+
+	return "SELECT " + strings.Join(columns, ", ") + " FROM pools WHERE tvl >= $1", args, dest
+}
+
+// GetMetricsCounts returns pool and active opportunity counts for metrics.
+// Pools not updated since staleAfter ago are counted as stale. Manual pools
+// are only updated when imported again, so they never count as stale, and
+// the last fetch is that of the fetched pools.
+func (r *Repository) GetMetricsCounts(ctx context.Context, staleAfter time.Duration) (*models.MetricsCounts, error) {
+	counts := &models.MetricsCounts{
+		ActiveOpportunitiesByType: make(map[string]int),
+		ReviewChainPools:          make(map[string]int),
+	}
+
+	poolQuery := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE updated_at < $1 AND data_source <> $2),
+			COUNT(*) FILTER (WHERE is_outlier),
+			MAX(updated_at) FILTER (WHERE data_source <> $2)
+		FROM pools
+	`
+	var lastFetch *time.Time
+	err := r.pool.QueryRow(ctx, poolQuery, time.Now().Add(-staleAfter), models.DataSourceManual).Scan(&counts.TotalPools, &counts.StalePools, &counts.OutlierPools, &lastFetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pools: %w", err)
+	}
+	if lastFetch != nil {
+		counts.LastFetch = *lastFetch
+	}
+
+	rows, err := r.pool.Query(ctx, "SELECT type, COUNT(*) FROM opportunities WHERE is_active = true GROUP BY type")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count opportunities: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var oppType string
+		var count int
+		if err := rows.Scan(&oppType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity count: %w", err)
+		}
+		counts.ActiveOpportunitiesByType[oppType] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count opportunities: %w", err)
+	}
+
+	reviewRows, err := r.pool.Query(ctx, "SELECT chain, pool_count FROM chain_metadata WHERE needs_review")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count chains awaiting review: %w", err)
+	}
+	defer reviewRows.Close()
+
+	for reviewRows.Next() {
+		var chain string
+		var count int
+		if err := reviewRows.Scan(&chain, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan chain review count: %w", err)
+		}
+		counts.ReviewChainPools[chain] = count
+	}
+
+	return counts, reviewRows.Err()
+}
+
 // =============================================================================
 // Opportunity Write Operations
 // =============================================================================
@@ -767,11 +1793,11 @@ func (r *Repository) UpsertOpportunity(ctx context.Context, opp *models.Opportun
 		INSERT INTO opportunities (
 			id, type, title, description, source_pool_id, target_pool_id,
 			pool_id, asset, chain, apy_difference, apy_growth, current_apy,
-			potential_profit, tvl, risk_level, score, is_active,
+			potential_profit, tvl, costs, profit_by_horizon, risk_level, score, is_active,
 			detected_at, last_seen_at, expires_at, created_at, updated_at
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
-			$13, $14, $15, $16, $17, $18, $19, $20, $21, $22
+			$13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24
 		)
 		ON CONFLICT (id) DO UPDATE SET
 			title = EXCLUDED.title,
@@ -779,9 +1805,12 @@ func (r *Repository) UpsertOpportunity(ctx context.Context, opp *models.Opportun
 			current_apy = EXCLUDED.current_apy,
 			potential_profit = EXCLUDED.potential_profit,
 			tvl = EXCLUDED.tvl,
+			costs = EXCLUDED.costs,
+			profit_by_horizon = EXCLUDED.profit_by_horizon,
 			score = EXCLUDED.score,
 			is_active = EXCLUDED.is_active,
 			last_seen_at = EXCLUDED.last_seen_at,
+			expires_at = EXCLUDED.expires_at,
 			updated_at = NOW()
 	`
 
@@ -789,7 +1818,7 @@ func (r *Repository) UpsertOpportunity(ctx context.Context, opp *models.Opportun
 		opp.ID, opp.Type, opp.Title, opp.Description,
 		opp.SourcePoolID, opp.TargetPoolID, opp.PoolID,
 		opp.Asset, opp.Chain, opp.APYDifference, opp.APYGrowth,
-		opp.CurrentAPY, opp.PotentialProfit, opp.TVL, opp.RiskLevel,
+		opp.CurrentAPY, opp.PotentialProfit, opp.TVL, opp.Costs, opp.ProfitByHorizon, opp.RiskLevel,
 		opp.Score, opp.IsActive, opp.DetectedAt, opp.LastSeenAt,
 		opp.ExpiresAt, opp.CreatedAt, opp.UpdatedAt,
 	)
@@ -801,6 +1830,194 @@ func (r *Repository) UpsertOpportunity(ctx context.Context, opp *models.Opportun
 	return nil
 }
 
+// GetOpportunityLifetimes returns the stored opportunities with the given
+// IDs, keyed by ID. Only the ID, active flag and timestamps are read.
+func (r *Repository) GetOpportunityLifetimes(ctx context.Context, ids []string) (map[string]models.Opportunity, error) {
+	opportunities := make(map[string]models.Opportunity, len(ids))
+	if len(ids) == 0 {
+		return opportunities, nil
+	}
+
+	query := `
+		SELECT id, is_active, detected_at, last_seen_at, expires_at, created_at
+		FROM opportunities
+		WHERE id = ANY($1)
+	`
+
+	rows, err := r.pool.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query opportunity lifetimes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.Opportunity
+		if err := rows.Scan(&o.ID, &o.IsActive, &o.DetectedAt, &o.LastSeenAt, &o.ExpiresAt, &o.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity lifetime: %w", err)
+		}
+		opportunities[o.ID] = o
+	}
+
+	return opportunities, rows.Err()
+}
+
+// ArchiveOpportunity moves an ended opportunity to an ID suffixed with its
+// detection time, freeing its ID for a new detection event. The archived
+// row is inactive and keeps its outcome.
+func (r *Repository) ArchiveOpportunity(ctx context.Context, id string) error {
+	query := `
+		UPDATE opportunities
+		SET id = id || '@' || to_char(detected_at AT TIME ZONE 'UTC', 'YYYYMMDD"T"HH24MISS'),
+			is_active = false,
+			updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to archive opportunity: %w", err)
+	}
+
+	return nil
+}
+
+// GetChainOverrides returns the configured per-chain scoring overrides.
+// Registered chain metadata is included; chain_overrides values win where
+// both set a column.
+func (r *Repository) GetChainOverrides(ctx context.Context) ([]models.ChainOverride, error) {
+	query := `
+		SELECT
+			COALESCE(o.chain, m.chain),
+			COALESCE(o.security_rating, m.security_rating),
+			COALESCE(o.gas_cost_usd, m.gas_cost_usd),
+			COALESCE(m.needs_review, false)
+		FROM chain_overrides o
+		FULL OUTER JOIN chain_metadata m ON m.chain = o.chain
+		ORDER BY 1
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chain overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make([]models.ChainOverride, 0)
+	for rows.Next() {
+		var o models.ChainOverride
+		if err := rows.Scan(&o.Chain, &o.SecurityRating, &o.GasCostUSD, &o.NeedsReview); err != nil {
+			return nil, fmt.Errorf("failed to scan chain override: %w", err)
+		}
+		overrides = append(overrides, o)
+	}
+
+	return overrides, rows.Err()
+}
+
+// EnsureChainMetadata registers chains seen during ingestion. New chains are
+// inserted as given; existing rows only have their pool count and last seen
+// time refreshed, so reviewed values are kept. Returns the newly created chains.
+func (r *Repository) EnsureChainMetadata(ctx context.Context, chains []models.ChainMetadata) ([]string, error) {
+	query := `
+		INSERT INTO chain_metadata (chain, security_rating, gas_cost_usd, needs_review, pool_count)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chain) DO UPDATE SET
+			pool_count = EXCLUDED.pool_count,
+			last_seen_at = NOW()
+		RETURNING (xmax = 0)
+	`
+
+	created := make([]string, 0)
+	for _, c := range chains {
+		var inserted bool
+		err := r.pool.QueryRow(ctx, query, c.Chain, c.SecurityRating, c.GasCostUSD, c.NeedsReview, c.PoolCount).Scan(&inserted)
+		if err != nil {
+			return created, fmt.Errorf("failed to register chain %s: %w", c.Chain, err)
+		}
+		if inserted {
+			created = append(created, c.Chain)
+		}
+	}
+
+	return created, nil
+}
+
+// ListChainMetadata returns registered chains, optionally only those awaiting review
+func (r *Repository) ListChainMetadata(ctx context.Context, needsReviewOnly bool) ([]models.ChainMetadata, error) {
+	query := `
+		SELECT chain, security_rating, gas_cost_usd, needs_review, pool_count, first_seen_at, last_seen_at
+		FROM chain_metadata
+		WHERE needs_review OR NOT $1
+		ORDER BY pool_count DESC, chain
+	`
+
+	rows, err := r.pool.Query(ctx, query, needsReviewOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chain metadata: %w", err)
+	}
+	defer rows.Close()
+
+	chains := make([]models.ChainMetadata, 0)
+	for rows.Next() {
+		var m models.ChainMetadata
+		if err := rows.Scan(&m.Chain, &m.SecurityRating, &m.GasCostUSD, &m.NeedsReview, &m.PoolCount, &m.FirstSeenAt, &m.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chain metadata: %w", err)
+		}
+		chains = append(chains, m)
+	}
+
+	return chains, rows.Err()
+}
+
+// ListProtocolCategories returns the category of every protocol in
+// protocol_metadata, for tagging pools
+func (r *Repository) ListProtocolCategories(ctx context.Context) ([]models.ProtocolCategory, error) {
+	rows, err := r.pool.Query(ctx, "SELECT protocol, category FROM protocol_metadata ORDER BY protocol")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query protocol metadata: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make([]models.ProtocolCategory, 0)
+	for rows.Next() {
+		var c models.ProtocolCategory
+		if err := rows.Scan(&c.Protocol, &c.Category); err != nil {
+			return nil, fmt.Errorf("failed to scan protocol metadata: %w", err)
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// ListTags returns every tag carried by a pool with its pool count and TVL,
+// largest TVL first. Outliers are left out, as in the other listings.
+func (r *Repository) ListTags(ctx context.Context) ([]models.TagStats, error) {
+	query := `
+		SELECT tag, COUNT(*) as pool_count, COALESCE(SUM(p.tvl), 0) as total_tvl
+		FROM pools p, unnest(p.tags) AS tag
+		WHERE NOT p.is_outlier
+		GROUP BY tag
+		ORDER BY total_tvl DESC, tag ASC
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make([]models.TagStats, 0)
+	for rows.Next() {
+		var t models.TagStats
+		if err := rows.Scan(&t.Tag, &t.PoolCount, &t.TotalTVL); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
 // DeactivateExpiredOpportunities marks expired opportunities as inactive
 func (r *Repository) DeactivateExpiredOpportunities(ctx context.Context) error {
 	query := `
@@ -816,3 +2033,506 @@ func (r *Repository) DeactivateExpiredOpportunities(ctx context.Context) error {
 
 	return nil
 }
+
+// unavailableOpportunityPoolsQuery selects the pools referenced by active
+// opportunities that were deleted, or not updated since $1. Pools from the
+// data source $2 (manual) are only updated when imported again, so they
+// never go stale.
+const unavailableOpportunityPoolsQuery = `
+		SELECT ref.pool_id, p.id IS NULL
+		FROM (
+			SELECT pool_id FROM opportunities WHERE is_active = true
+			UNION SELECT source_pool_id FROM opportunities WHERE is_active = true
+			UNION SELECT target_pool_id FROM opportunities WHERE is_active = true
+		) AS ref(pool_id)
+		LEFT JOIN pools p ON p.id = ref.pool_id
+		WHERE ref.pool_id <> '' AND (p.id IS NULL OR (p.updated_at < $1 AND p.data_source <> $2))
+		ORDER BY ref.pool_id
+	`
+
+// GetUnavailableOpportunityPools returns the pools referenced by active
+// opportunities that were deleted or haven't been updated since staleBefore.
+// Manual pools are never stale.
+func (r *Repository) GetUnavailableOpportunityPools(ctx context.Context, staleBefore time.Time) (stale, deleted []string, err error) {
+	rows, err := r.pool.Query(ctx, unavailableOpportunityPoolsQuery, staleBefore, models.DataSourceManual)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query unavailable opportunity pools: %w", err)
+	}
+	defer rows.Close()
+
+	stale, deleted = make([]string, 0), make([]string, 0)
+	for rows.Next() {
+		var id string
+		var missing bool
+		if err := rows.Scan(&id, &missing); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan unavailable pool: %w", err)
+		}
+		if missing {
+			deleted = append(deleted, id)
+		} else {
+			stale = append(stale, id)
+		}
+	}
+
+	return stale, deleted, rows.Err()
+}
+
+// DeactivateOpportunitiesForPools deactivates active opportunities that
+// reference any of poolIDs, recording reason as their status reason.
+// Returns a retraction for each opportunity deactivated.
+func (r *Repository) DeactivateOpportunitiesForPools(ctx context.Context, poolIDs []string, reason string) ([]models.OpportunityRetraction, error) {
+	retractions := make([]models.OpportunityRetraction, 0)
+	if len(poolIDs) == 0 {
+		return retractions, nil
+	}
+
+	query := `
+		UPDATE opportunities
+		SET is_active = false, status_reason = $2, updated_at = NOW()
+		WHERE is_active = true
+			AND (pool_id = ANY($1) OR source_pool_id = ANY($1) OR target_pool_id = ANY($1))
+		RETURNING id, type, COALESCE(source_pool_id, ''), COALESCE(target_pool_id, ''),
+			COALESCE(pool_id, ''), updated_at
+	`
+
+	rows, err := r.pool.Query(ctx, query, poolIDs, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deactivate opportunities: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := models.OpportunityRetraction{Reason: reason}
+		if err := rows.Scan(&t.OpportunityID, &t.Type, &t.SourcePoolID, &t.TargetPoolID, &t.PoolID, &t.RetractedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deactivated opportunity: %w", err)
+		}
+		retractions = append(retractions, t)
+	}
+
+	return retractions, rows.Err()
+}
+
+// ListOpportunitiesAwaitingOutcome returns expired yield-gap and trending
+// opportunities that have no outcome yet and whose evaluation window has
+// passed: yield gaps that expired before expiredBefore and trending pools
+// detected before detectedBefore. Opportunities that expired before since
+// are left out. Oldest first.
+func (r *Repository) ListOpportunitiesAwaitingOutcome(ctx context.Context, expiredBefore, detectedBefore, since time.Time, limit int) ([]models.Opportunity, error) {
+	query := `
+		SELECT
+			id, type, source_pool_id, target_pool_id, pool_id,
+			apy_difference, apy_growth, current_apy, detected_at, expires_at
+		FROM opportunities
+		WHERE is_active = false AND outcome_class IS NULL
+			AND type IN ('yield-gap', 'trending')
+			AND expires_at > $3
+			AND ((type = 'yield-gap' AND expires_at <= $1)
+				OR (type = 'trending' AND detected_at <= $2))
+		ORDER BY expires_at ASC, id ASC
+		LIMIT $4
+	`
+
+	rows, err := r.pool.Query(ctx, query, expiredBefore, detectedBefore, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query opportunities awaiting outcome: %w", err)
+	}
+	defer rows.Close()
+
+	opportunities := make([]models.Opportunity, 0)
+	for rows.Next() {
+		var o models.Opportunity
+		err := rows.Scan(
+			&o.ID, &o.Type, &o.SourcePoolID, &o.TargetPoolID, &o.PoolID,
+			&o.APYDifference, &o.APYGrowth, &o.CurrentAPY, &o.DetectedAt, &o.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity: %w", err)
+		}
+		opportunities = append(opportunities, o)
+	}
+
+	return opportunities, rows.Err()
+}
+
+// GetAPYSeries returns the APY history of each window in one query, oldest
+// first. The result has one series per window, in the same order.
+func (r *Repository) GetAPYSeries(ctx context.Context, windows []models.APYWindow) ([][]models.APYPoint, error) {
+	series := make([][]models.APYPoint, len(windows))
+	if len(windows) == 0 {
+		return series, nil
+	}
+
+	poolIDs := make([]string, len(windows))
+	from := make([]time.Time, len(windows))
+	to := make([]time.Time, len(windows))
+	for i, w := range windows {
+		poolIDs[i] = w.PoolID
+		from[i] = w.From
+		to[i] = w.To
+	}
+
+	query := `
+		SELECT w.idx, h.timestamp, h.apy
+		FROM unnest($1::text[], $2::timestamptz[], $3::timestamptz[])
+			WITH ORDINALITY AS w(pool_id, from_ts, to_ts, idx)
+		JOIN historical_apy h
+			ON h.pool_id = w.pool_id AND h.timestamp >= w.from_ts AND h.timestamp <= w.to_ts
+		ORDER BY w.idx, h.timestamp
+	`
+
+	rows, err := r.pool.Query(ctx, query, poolIDs, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query APY series: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx int
+		var p models.APYPoint
+		if err := rows.Scan(&idx, &p.Timestamp, &p.APY); err != nil {
+			return nil, fmt.Errorf("failed to scan APY point: %w", err)
+		}
+		// Ordinality counts from 1
+		series[idx-1] = append(series[idx-1], p)
+	}
+
+	return series, rows.Err()
+}
+
+// SaveOpportunityOutcomes records the realized outcomes of expired
+// opportunities in one statement
+func (r *Repository) SaveOpportunityOutcomes(ctx context.Context, outcomes []models.OpportunityOutcome) error {
+	if len(outcomes) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(outcomes))
+	diffs := make([]*string, len(outcomes))
+	classes := make([]string, len(outcomes))
+	for i, o := range outcomes {
+		ids[i] = o.OpportunityID
+		if o.RealizedAPYDiff != nil {
+			diff := o.RealizedAPYDiff.String()
+			diffs[i] = &diff
+		}
+		classes[i] = string(o.Class)
+	}
+
+	_, err := r.pool.Exec(ctx, `
+		UPDATE opportunities o
+		SET realized_apy_diff = v.diff::numeric,
+			outcome_class = v.class,
+			outcome_computed_at = NOW()
+		FROM unnest($1::text[], $2::text[], $3::text[]) AS v(id, diff, class)
+		WHERE o.id = v.id
+	`, ids, diffs, classes)
+	if err != nil {
+		return fmt.Errorf("failed to save opportunity outcomes: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpportunityAccuracy counts the outcomes of opportunities that expired
+// since the given time, per opportunity type
+func (r *Repository) GetOpportunityAccuracy(ctx context.Context, since time.Time) ([]models.OpportunityAccuracy, error) {
+	query := `
+		SELECT
+			type,
+			COUNT(*) FILTER (WHERE outcome_class = 'confirmed'),
+			COUNT(*) FILTER (WHERE outcome_class = 'faded'),
+			COUNT(*) FILTER (WHERE outcome_class = 'reversed'),
+			COUNT(*) FILTER (WHERE outcome_class = 'unknown')
+		FROM opportunities
+		WHERE outcome_class IS NOT NULL AND expires_at >= $1
+		GROUP BY type
+		ORDER BY type
+	`
+
+	rows, err := r.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query opportunity accuracy: %w", err)
+	}
+	defer rows.Close()
+
+	accuracy := make([]models.OpportunityAccuracy, 0)
+	for rows.Next() {
+		var a models.OpportunityAccuracy
+		if err := rows.Scan(&a.Type, &a.Confirmed, &a.Faded, &a.Reversed, &a.Unknown); err != nil {
+			return nil, fmt.Errorf("failed to scan opportunity accuracy: %w", err)
+		}
+		if classified := a.Confirmed + a.Faded + a.Reversed; classified > 0 {
+			a.ConfirmedRate = decimal.NewFromInt(int64(a.Confirmed)).
+				Div(decimal.NewFromInt(int64(classified))).Round(4)
+		}
+		accuracy = append(accuracy, a)
+	}
+
+	return accuracy, rows.Err()
+}
+
+// SaveSnapshot stores a compressed raw DeFiLlama snapshot
+func (r *Repository) SaveSnapshot(ctx context.Context, capturedAt time.Time, data []byte) error {
+	query := `
+		INSERT INTO pool_snapshots (captured_at, size_bytes, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (captured_at) DO UPDATE SET
+			size_bytes = EXCLUDED.size_bytes,
+			data = EXCLUDED.data
+	`
+
+	_, err := r.pool.Exec(ctx, query, capturedAt, len(data), data)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the stored snapshots without their data, newest first
+func (r *Repository) ListSnapshots(ctx context.Context) ([]models.Snapshot, error) {
+	query := `
+		SELECT captured_at, size_bytes
+		FROM pool_snapshots
+		ORDER BY captured_at DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := make([]models.Snapshot, 0)
+	for rows.Next() {
+		var s models.Snapshot
+		if err := rows.Scan(&s.CapturedAt, &s.SizeBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		s.CapturedAt = s.CapturedAt.UTC()
+		s.ID = strconv.FormatInt(s.CapturedAt.Unix(), 10)
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// OpenSnapshot returns a reader over the compressed snapshot captured at the
+// given time. The error wraps os.ErrNotExist if there is no such snapshot.
+func (r *Repository) OpenSnapshot(ctx context.Context, capturedAt time.Time) (io.ReadCloser, int64, error) {
+	query := `SELECT data FROM pool_snapshots WHERE captured_at = $1`
+
+	var data []byte
+	if err := r.pool.QueryRow(ctx, query, capturedAt).Scan(&data); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, 0, fmt.Errorf("snapshot not found: %w", os.ErrNotExist)
+		}
+		return nil, 0, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+// DeleteSnapshotsBefore removes snapshots captured before the cutoff
+func (r *Repository) DeleteSnapshotsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM pool_snapshots WHERE captured_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete snapshots: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// apyIndexColumns are the definition columns read for an APY index. Unset
+// filters are stored as NULL.
+const apyIndexColumns = `
+	i.name, COALESCE(i.description, ''), COALESCE(i.chain, ''),
+	COALESCE(i.protocol, ''), i.stablecoin, COALESCE(i.asset, ''),
+	i.created_at, i.updated_at
+`
+
+// ListAPYIndices returns the index definitions with their latest values, by name
+func (r *Repository) ListAPYIndices(ctx context.Context) ([]models.APYIndex, error) {
+	query := `
+		SELECT ` + apyIndexColumns + `, v.day, v.apy, v.tvl, v.constituents
+		FROM apy_indices i
+		LEFT JOIN LATERAL (
+			SELECT day, apy, tvl, constituents
+			FROM apy_index_values
+			WHERE index_name = i.name
+			ORDER BY day DESC
+			LIMIT 1
+		) v ON true
+		ORDER BY i.name
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indices: %w", err)
+	}
+	defer rows.Close()
+
+	indices := make([]models.APYIndex, 0)
+	for rows.Next() {
+		var (
+			idx          models.APYIndex
+			day          *time.Time
+			apy, tvl     decimal.NullDecimal
+			constituents *int
+		)
+		err := rows.Scan(
+			&idx.Name, &idx.Description, &idx.Chain, &idx.Protocol, &idx.StableCoin, &idx.Asset,
+			&idx.CreatedAt, &idx.UpdatedAt, &day, &apy, &tvl, &constituents,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		if day != nil {
+			idx.Latest = &models.APYIndexValue{
+				Day:          day.UTC(),
+				APY:          apy.Decimal,
+				TVL:          tvl.Decimal,
+				Constituents: *constituents,
+			}
+		}
+		indices = append(indices, idx)
+	}
+
+	return indices, rows.Err()
+}
+
+// GetAPYIndex returns an index definition. The error wraps os.ErrNotExist
+// if there is no such index.
+func (r *Repository) GetAPYIndex(ctx context.Context, name string) (*models.APYIndex, error) {
+	query := `SELECT ` + apyIndexColumns + ` FROM apy_indices i WHERE i.name = $1`
+
+	var idx models.APYIndex
+	err := r.pool.QueryRow(ctx, query, name).Scan(
+		&idx.Name, &idx.Description, &idx.Chain, &idx.Protocol, &idx.StableCoin, &idx.Asset,
+		&idx.CreatedAt, &idx.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("index not found: %w", os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to get index: %w", err)
+	}
+
+	return &idx, nil
+}
+
+// CreateAPYIndex stores a new index definition and sets its timestamps. The
+// error wraps os.ErrExist if an index with the name exists.
+func (r *Repository) CreateAPYIndex(ctx context.Context, idx *models.APYIndex) error {
+	query := `
+		INSERT INTO apy_indices (name, description, chain, protocol, stablecoin, asset)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, NULLIF($6, ''))
+		ON CONFLICT (name) DO NOTHING
+		RETURNING created_at, updated_at
+	`
+
+	err := r.pool.QueryRow(ctx, query,
+		idx.Name, idx.Description, idx.Chain, idx.Protocol, idx.StableCoin, idx.Asset,
+	).Scan(&idx.CreatedAt, &idx.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("index %s already exists: %w", idx.Name, os.ErrExist)
+		}
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAPYIndex replaces an index definition's description and filters and
+// sets its timestamps. Recorded values are kept. The error wraps
+// os.ErrNotExist if there is no such index.
+func (r *Repository) UpdateAPYIndex(ctx context.Context, idx *models.APYIndex) error {
+	query := `
+		UPDATE apy_indices SET
+			description = NULLIF($2, ''),
+			chain = NULLIF($3, ''),
+			protocol = NULLIF($4, ''),
+			stablecoin = $5,
+			asset = NULLIF($6, ''),
+			updated_at = NOW()
+		WHERE name = $1
+		RETURNING created_at, updated_at
+	`
+
+	err := r.pool.QueryRow(ctx, query,
+		idx.Name, idx.Description, idx.Chain, idx.Protocol, idx.StableCoin, idx.Asset,
+	).Scan(&idx.CreatedAt, &idx.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("index not found: %w", os.ErrNotExist)
+		}
+		return fmt.Errorf("failed to update index: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAPYIndex removes an index definition and its values. The error wraps
+// os.ErrNotExist if there is no such index.
+func (r *Repository) DeleteAPYIndex(ctx context.Context, name string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM apy_indices WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete index: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("index not found: %w", os.ErrNotExist)
+	}
+
+	return nil
+}
+
+// SaveAPYIndexValue records an index's value for a day, replacing any
+// recorded earlier for the same day
+func (r *Repository) SaveAPYIndexValue(ctx context.Context, name string, value models.APYIndexValue) error {
+	query := `
+		INSERT INTO apy_index_values (index_name, day, apy, tvl, constituents)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (index_name, day) DO UPDATE SET
+			apy = EXCLUDED.apy,
+			tvl = EXCLUDED.tvl,
+			constituents = EXCLUDED.constituents,
+			computed_at = NOW()
+	`
+
+	_, err := r.pool.Exec(ctx, query, name, value.Day, value.APY, value.TVL, value.Constituents)
+	if err != nil {
+		return fmt.Errorf("failed to save index value: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPYIndexHistory returns an index's daily values since the given day,
+// oldest first
+func (r *Repository) GetAPYIndexHistory(ctx context.Context, name string, since time.Time) ([]models.APYIndexValue, error) {
+	query := `
+		SELECT day, apy, tvl, constituents
+		FROM apy_index_values
+		WHERE index_name = $1 AND day >= $2
+		ORDER BY day
+	`
+
+	rows, err := r.pool.Query(ctx, query, name, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index history: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]models.APYIndexValue, 0)
+	for rows.Next() {
+		var v models.APYIndexValue
+		if err := rows.Scan(&v.Day, &v.APY, &v.TVL, &v.Constituents); err != nil {
+			return nil, fmt.Errorf("failed to scan index value: %w", err)
+		}
+		v.Day = v.Day.UTC()
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
@@ -0,0 +1,600 @@
+package postgres
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func TestDecayedScoreExpr(t *testing.T) {
+	expr := decayedScoreExpr(3)
+
+	if !strings.Contains(expr, "$3") {
+		t.Errorf("Expected expression to bind scale to $3, got %s", expr)
+	}
+	if !strings.HasPrefix(expr, "score * exp(") {
+		t.Errorf("Expected score to be multiplied by decay, got %s", expr)
+	}
+}
+
+// evalDecayedScore evaluates decayedScoreExpr for one row the way
+// PostgreSQL would, so the test ranks by the SQL that actually runs
+func evalDecayedScore(t *testing.T, expr string, score float64, age, scale time.Duration) float64 {
+	t.Helper()
+
+	sql := strings.NewReplacer(
+		"extract(epoch from now() - updated_at)", fmt.Sprint(age.Seconds()),
+		"$1::double precision", fmt.Sprint(decayScaleSeconds(scale)),
+		"score", fmt.Sprint(score),
+	).Replace(expr)
+
+	e := &arithExpr{src: strings.ReplaceAll(sql, " ", "")}
+	value := e.sum()
+	if e.pos != len(e.src) {
+		t.Fatalf("Cannot evaluate %q (from %q) past offset %d", e.src, expr, e.pos)
+	}
+	return value
+}
+
+// arithExpr is a recursive-descent evaluator for the numbers, + - * /,
+// parentheses and exp() that the decayed score uses
+type arithExpr struct {
+	src string
+	pos int
+}
+
+func (e *arithExpr) sum() float64 {
+	value := e.product()
+	for e.pos < len(e.src) && (e.src[e.pos] == '+' || e.src[e.pos] == '-') {
+		op := e.src[e.pos]
+		e.pos++
+		if op == '+' {
+			value += e.product()
+		} else {
+			value -= e.product()
+		}
+	}
+	return value
+}
+
+func (e *arithExpr) product() float64 {
+	value := e.unary()
+	for e.pos < len(e.src) && (e.src[e.pos] == '*' || e.src[e.pos] == '/') {
+		op := e.src[e.pos]
+		e.pos++
+		if op == '*' {
+			value *= e.unary()
+		} else {
+			value /= e.unary()
+		}
+	}
+	return value
+}
+
+func (e *arithExpr) unary() float64 {
+	switch {
+	case strings.HasPrefix(e.src[e.pos:], "-"):
+		e.pos++
+		return -e.unary()
+	case strings.HasPrefix(e.src[e.pos:], "exp("):
+		e.pos += len("exp")
+		return math.Exp(e.unary())
+	case strings.HasPrefix(e.src[e.pos:], "("):
+		e.pos++
+		value := e.sum()
+		if e.pos < len(e.src) && e.src[e.pos] == ')' {
+			e.pos++
+		}
+		return value
+	}
+
+	start := e.pos
+	for e.pos < len(e.src) && strings.IndexByte("0123456789.e", e.src[e.pos]) >= 0 {
+		e.pos++
+	}
+	value, _ := strconv.ParseFloat(e.src[start:e.pos], 64)
+	return value
+}
+
+func TestDecayedRankingFlipsOrder(t *testing.T) {
+	// Equal scores: the standard order breaks the tie on id, the decayed
+	// order puts the fresher pool first
+	pools := []struct {
+		id    string
+		score float64
+		age   time.Duration
+	}{
+		{"b-fresh", 80, 5 * time.Minute},
+		{"a-stale", 80, 12 * time.Hour},
+	}
+	expr := decayedScoreExpr(1)
+
+	standard := append(pools[:0:0], pools...)
+	sort.SliceStable(standard, func(i, j int) bool {
+		if standard[i].score != standard[j].score {
+			return standard[i].score > standard[j].score
+		}
+		return standard[i].id < standard[j].id
+	})
+	if standard[0].id != "a-stale" {
+		t.Fatalf("Expected a-stale first by score, got %s", standard[0].id)
+	}
+
+	decayed := append(pools[:0:0], pools...)
+	sort.SliceStable(decayed, func(i, j int) bool {
+		return evalDecayedScore(t, expr, decayed[i].score, decayed[i].age, 0) >
+			evalDecayedScore(t, expr, decayed[j].score, decayed[j].age, 0)
+	})
+	if decayed[0].id != "b-fresh" {
+		t.Errorf("Expected b-fresh first by decayed score, got %s", decayed[0].id)
+	}
+
+	// One scale period decays the score by 1/e, as the ElasticSearch curve does
+	if got, want := evalDecayedScore(t, expr, 80, 6*time.Hour, 0), 80/math.E; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected %v after one scale period, got %v", want, got)
+	}
+}
+
+func TestDecayScaleSeconds(t *testing.T) {
+	tests := []struct {
+		name  string
+		scale time.Duration
+		want  float64
+	}{
+		{"configured", 2 * time.Hour, 7200},
+		{"zero uses default", 0, 21600},
+		{"negative uses default", -time.Minute, 21600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decayScaleSeconds(tt.scale); got != tt.want {
+				t.Errorf("decayScaleSeconds(%v) = %v, want %v", tt.scale, got, tt.want)
+			}
+		})
+	}
+}
+
+// sortFixture is a small pool table with ties on every sort field
+var sortFixture = []map[string]interface{}{
+	{"id": "d", "chain": "polygon", "protocol": "aave-v3", "score": 70.0, "apy": 4.0, "tvl": 5e6, "stablecoin": true},
+	{"id": "a", "chain": "ethereum", "protocol": "curve", "score": 80.0, "apy": 3.0, "tvl": 9e6, "stablecoin": true},
+	{"id": "e", "chain": "polygon", "protocol": "curve", "score": 70.0, "apy": 9.0, "tvl": 1e6, "stablecoin": false},
+	{"id": "b", "chain": "ethereum", "protocol": "aave-v3", "score": 90.0, "apy": 3.0, "tvl": 2e6, "stablecoin": false},
+	{"id": "c", "chain": "ethereum", "protocol": "lido", "score": 80.0, "apy": 6.0, "tvl": 7e6, "stablecoin": true},
+}
+
+// compareValues orders two fixture values of the same type
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+		return 0
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1 // false sorts before true, as in PostgreSQL
+		}
+		return 1
+	}
+	panic("unsupported fixture value")
+}
+
+// applyOrderBy sorts the fixture the way PostgreSQL would for an ORDER BY
+// list of plain "column DIRECTION" clauses
+func applyOrderBy(t *testing.T, orderBy string) []string {
+	t.Helper()
+
+	type clause struct {
+		column string
+		desc   bool
+	}
+	var clauses []clause
+	for _, part := range strings.Split(orderBy, ", ") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			t.Fatalf("Unexpected ORDER BY clause %q", part)
+		}
+		clauses = append(clauses, clause{fields[0], fields[1] == "DESC"})
+	}
+
+	rows := append([]map[string]interface{}(nil), sortFixture...)
+	sort.Slice(rows, func(i, j int) bool {
+		for _, c := range clauses {
+			cmp := compareValues(rows[i][c.column], rows[j][c.column])
+			if cmp == 0 {
+				continue
+			}
+			return (cmp < 0) != c.desc
+		}
+		return false
+	})
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row["id"].(string)
+	}
+	return ids
+}
+
+func TestPoolOrderBy_MultiKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []models.SortKey
+		wantSQL string
+		wantIDs string
+	}{
+		{
+			"single key keeps working",
+			[]models.SortKey{{Field: "tvl", Order: "desc"}},
+			"tvl DESC, id ASC",
+			"a,c,d,b,e",
+		},
+		{
+			"chain then score",
+			[]models.SortKey{{Field: "chain", Order: "asc"}, {Field: "score", Order: "desc"}},
+			"chain ASC, score DESC, id ASC",
+			"b,a,c,d,e",
+		},
+		{
+			"stablecoin first then apy",
+			[]models.SortKey{{Field: "stablecoin", Order: "desc"}, {Field: "apy", Order: "desc"}},
+			"stablecoin DESC, apy DESC, id ASC",
+			"c,d,a,e,b",
+		},
+		{
+			"ties fall back to id",
+			[]models.SortKey{{Field: "score", Order: "desc"}, {Field: "chain", Order: "asc"}, {Field: "protocol", Order: "asc"}},
+			"score DESC, chain ASC, protocol ASC, id ASC",
+			"b,a,c,d,e",
+		},
+		{
+			"unknown fields fall back to tvl",
+			[]models.SortKey{{Field: "symbol", Order: "asc"}},
+			"tvl DESC, id ASC",
+			"a,c,d,b,e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderBy := poolOrderBy(tt.keys, 0, 0)
+			if orderBy != tt.wantSQL {
+				t.Fatalf("poolOrderBy() = %q, want %q", orderBy, tt.wantSQL)
+			}
+			if got := strings.Join(applyOrderBy(t, orderBy), ","); got != tt.wantIDs {
+				t.Errorf("Expected order %s, got %s", tt.wantIDs, got)
+			}
+		})
+	}
+}
+
+func TestPoolOrderBy_Decayed(t *testing.T) {
+	orderBy := poolOrderBy([]models.SortKey{{Field: "score", Order: "desc"}, {Field: "chain", Order: "asc"}}, 4, 0)
+
+	want := decayedScoreExpr(4) + " DESC, chain ASC, id ASC"
+	if orderBy != want {
+		t.Errorf("poolOrderBy() = %q, want %q", orderBy, want)
+	}
+}
+
+func TestPoolOrderBy_Relevance(t *testing.T) {
+	keys := []models.SortKey{{Field: "relevance", Order: "desc"}, {Field: "tvl", Order: "desc"}}
+
+	if got, want := poolOrderBy(keys, 0, 5), symbolMatchExpr(5)+" DESC, tvl DESC, id ASC"; got != want {
+		t.Errorf("poolOrderBy() = %q, want %q", got, want)
+	}
+	if got, want := symbolMatchExpr(5), "CASE WHEN LOWER(symbol) = $5 THEN 2 WHEN LOWER(symbol) ~ $6 THEN 1 ELSE 0 END"; got != want {
+		t.Errorf("symbolMatchExpr() = %q, want %q", got, want)
+	}
+	// Without a query to match, relevance is skipped
+	if got := poolOrderBy(keys, 0, 0); got != "tvl DESC, id ASC" {
+		t.Errorf("Expected relevance skipped without a match argument, got %q", got)
+	}
+}
+
+func TestSymbolMatchRanking(t *testing.T) {
+	// ILIKE %USDC% matches all of these; the largest pools are not exact matches
+	pools := []struct {
+		symbol string
+		tvl    float64
+	}{
+		{"XUSDC2", 900},
+		{"USDC-ETH", 800},
+		{"USDC.e", 700},
+		{"SUSDC", 600},
+		{"USDC", 100},
+		{"usdc", 50},
+	}
+
+	// Evaluate the CASE expression with the bound arguments ListPools passes
+	query := "USDC"
+	lower := strings.ToLower(query)
+	token := regexp.MustCompile(models.SymbolTokenPattern(query))
+	rank := func(symbol string) int {
+		switch symbol = strings.ToLower(symbol); {
+		case symbol == lower:
+			return 2
+		case token.MatchString(symbol):
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	sort.SliceStable(pools, func(i, j int) bool {
+		if ri, rj := rank(pools[i].symbol), rank(pools[j].symbol); ri != rj {
+			return ri > rj
+		}
+		return pools[i].tvl > pools[j].tvl
+	})
+
+	got := make([]string, len(pools))
+	for i, pool := range pools {
+		got[i] = pool.symbol
+	}
+	if want := "USDC,usdc,USDC-ETH,XUSDC2,USDC.e,SUSDC"; strings.Join(got, ",") != want {
+		t.Errorf("Expected order %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestProtocolsQuery_ChainFilter(t *testing.T) {
+	q := protocolsQuery(models.ProtocolFilter{Chain: "polygon", Limit: 20, Offset: 40})
+	query, args := q.sql()
+	countQuery, countArgs := q.count()
+
+	if len(args) != 3 || args[0] != "polygon" || args[1] != 20 || args[2] != 40 {
+		t.Fatalf("Expected chain, limit and offset arguments, got %v", args)
+	}
+	if len(countArgs) != 1 || countArgs[0] != "polygon" {
+		t.Fatalf("Expected the count to bind only the chain, got %v", countArgs)
+	}
+	if !strings.HasSuffix(countQuery, " AND p.chain = $1") {
+		t.Errorf("Expected the count to apply the chain filter, got %q", countQuery)
+	}
+	if !strings.Contains(query, " AND p.chain = $1 GROUP BY p.protocol") {
+		t.Errorf("Expected the statistics to apply the chain filter, got %q", query)
+	}
+
+	// The chains subquery must only correlate on the protocol
+	sub := regexp.MustCompile(`\(SELECT array_agg\(DISTINCT c\.chain\) FROM pools c WHERE ([^)]*)\) as chains`).FindStringSubmatch(query)
+	if sub == nil {
+		t.Fatalf("Expected a chains subquery, got %q", query)
+	}
+	if sub[1] != "c.protocol = p.protocol" {
+		t.Fatalf("Expected the chains subquery to ignore the chain filter, got %q", sub[1])
+	}
+
+	// Evaluate the query over the multi-chain fixture: aave-v3 and curve
+	// have pools on ethereum and polygon, lido only on ethereum
+	type protocolRow struct {
+		pools  int
+		chains map[string]bool
+	}
+	got := make(map[string]*protocolRow)
+	for _, pool := range sortFixture {
+		if pool["chain"] != args[0] {
+			continue
+		}
+		name := pool["protocol"].(string)
+		if got[name] == nil {
+			got[name] = &protocolRow{chains: make(map[string]bool)}
+			for _, other := range sortFixture {
+				if other["protocol"] == name {
+					got[name].chains[other["chain"].(string)] = true
+				}
+			}
+		}
+		got[name].pools++
+	}
+
+	if len(got) != 2 || got["lido"] != nil {
+		t.Fatalf("Expected aave-v3 and curve on polygon, got %v", got)
+	}
+	for _, name := range []string{"aave-v3", "curve"} {
+		row := got[name]
+		if row.pools != 1 {
+			t.Errorf("Expected 1 polygon pool for %s, got %d", name, row.pools)
+		}
+		if len(row.chains) != 2 || !row.chains["ethereum"] || !row.chains["polygon"] {
+			t.Errorf("Expected %s to list ethereum and polygon, got %v", name, row.chains)
+		}
+	}
+}
+
+func TestProtocolsQuery_Unfiltered(t *testing.T) {
+	q := protocolsQuery(models.ProtocolFilter{SortBy: "poolCount", SortOrder: "asc", Limit: 10})
+	query, args := q.sql()
+	countQuery, countArgs := q.count()
+
+	if len(args) != 2 {
+		t.Fatalf("Expected only limit and offset arguments, got %v", args)
+	}
+	if strings.Contains(countQuery, "$") || len(countArgs) != 0 {
+		t.Errorf("Expected an unfiltered count, got %q", countQuery)
+	}
+	if !strings.HasSuffix(query, " ORDER BY pool_count ASC, p.protocol ASC LIMIT $1 OFFSET $2") {
+		t.Errorf("Expected sorting by pool count with a stable tie-break, got %q", query)
+	}
+}
+
+func TestChainsQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter models.ChainFilter
+		want   string
+	}{
+		{"default", models.ChainFilter{}, "ORDER BY total_tvl DESC, chain ASC"},
+		{"by name", models.ChainFilter{SortBy: "name", SortOrder: "asc"}, "ORDER BY chain ASC\n"},
+		{"by max apy", models.ChainFilter{SortBy: "maxApy"}, "ORDER BY max_apy DESC, chain ASC"},
+		{"by weighted apy", models.ChainFilter{SortBy: "weightedApy"}, "ORDER BY weighted_apy DESC, chain ASC"},
+		{"unknown field", models.ChainFilter{SortBy: "tvl; DROP TABLE pools", SortOrder: "asc"}, "ORDER BY total_tvl ASC, chain ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := chainsQuery(tt.filter)
+			if !strings.Contains(query, tt.want) {
+				t.Errorf("Expected %q in %q", tt.want, query)
+			}
+			if !strings.Contains(query, "LIMIT $1 OFFSET $2") {
+				t.Errorf("Expected the query to be paged, got %q", query)
+			}
+		})
+	}
+}
+
+func TestChainsQuery_WeightedAPY(t *testing.T) {
+	query := chainsQuery(models.ChainFilter{})
+
+	// Chains with no TVL fall back to the plain average instead of dividing by zero
+	if !strings.Contains(query, "COALESCE(SUM(apy * tvl) / NULLIF(SUM(tvl), 0), AVG(apy)) as weighted_apy") {
+		t.Errorf("Expected the current weighted APY guarded against zero TVL, got %q", query)
+	}
+	if !strings.Contains(query, "COALESCE(SUM(h.apy * h.tvl) / NULLIF(SUM(h.tvl), 0), AVG(h.apy)) as weighted_apy") {
+		t.Errorf("Expected the weighted APY 24h ago guarded against zero TVL, got %q", query)
+	}
+
+	// Chains without history from a day ago are still listed
+	if !strings.Contains(query, "LEFT JOIN chain_day_ago d ON d.chain = s.chain") {
+		t.Errorf("Expected the day-ago APY left joined, got %q", query)
+	}
+}
+
+// poolsAboveFloor returns the fixture pools kept by the "column >= $N"
+// clause of query, given its arguments, or every pool if there is none
+func poolsAboveFloor(t *testing.T, query string, args []interface{}, column string) []map[string]interface{} {
+	t.Helper()
+
+	clause := regexp.MustCompile(`(?:^|[\s(])` + regexp.QuoteMeta(column) + ` >= \$(\d+)`).FindStringSubmatch(query)
+	if clause == nil {
+		return sortFixture
+	}
+	n, _ := strconv.Atoi(clause[1])
+	if n > len(args) {
+		t.Fatalf("Expected $%d bound, got %v", n, args)
+	}
+	floor, ok := args[n-1].(decimal.Decimal)
+	if !ok {
+		t.Fatalf("Expected a decimal TVL floor in $%d, got %v", n, args[n-1])
+	}
+
+	var kept []map[string]interface{}
+	for _, pool := range sortFixture {
+		if decimal.NewFromFloat(pool["tvl"].(float64)).GreaterThanOrEqual(floor) {
+			kept = append(kept, pool)
+		}
+	}
+	return kept
+}
+
+// countBy counts pools by the value of field
+func countBy(pools []map[string]interface{}, field string) map[string]int {
+	counts := make(map[string]int)
+	for _, pool := range pools {
+		counts[pool[field].(string)]++
+	}
+	return counts
+}
+
+func TestTVLFloor_StatsQueries(t *testing.T) {
+	// The floor leaves out b (2M, ethereum, aave-v3) and e (1M, polygon, curve)
+	floor := decimal.NewFromInt(3_000_000)
+
+	t.Run("chains", func(t *testing.T) {
+		filter := models.ChainFilter{Limit: 100, TVLFloor: floor}
+		query := chainsQuery(filter)
+		args := []interface{}{filter.Limit, filter.Offset, filter.TVLFloor} // As ListChains binds them
+
+		got := countBy(poolsAboveFloor(t, query, args, "tvl"), "chain")
+		if got["ethereum"] != 2 || got["polygon"] != 1 {
+			t.Errorf("Expected 2 ethereum and 1 polygon pool, got %v", got)
+		}
+		// The APY a day ago covers the same pools
+		if dayAgo := poolsAboveFloor(t, query, args, "p.tvl"); len(dayAgo) != 3 {
+			t.Errorf("Expected the day-ago APY over the 3 pools above the floor, got %d", len(dayAgo))
+		}
+	})
+
+	t.Run("protocols", func(t *testing.T) {
+		q := protocolsQuery(models.ProtocolFilter{Limit: 20, TVLFloor: floor})
+		query, args := q.sql()
+		countQuery, countArgs := q.count()
+
+		got := countBy(poolsAboveFloor(t, query, args, "p.tvl"), "protocol")
+		if got["aave-v3"] != 1 || got["curve"] != 1 || got["lido"] != 1 {
+			t.Errorf("Expected 1 pool per protocol, got %v", got)
+		}
+		if counted := poolsAboveFloor(t, countQuery, countArgs, "p.tvl"); len(counted) != 3 {
+			t.Errorf("Expected the count over the 3 pools above the floor, got %d", len(counted))
+		}
+	})
+
+	t.Run("protocols without a floor", func(t *testing.T) {
+		query, args := protocolsQuery(models.ProtocolFilter{Limit: 20}).sql()
+
+		got := countBy(poolsAboveFloor(t, query, args, "p.tvl"), "protocol")
+		if got["aave-v3"] != 2 || got["curve"] != 2 || got["lido"] != 1 {
+			t.Errorf("Expected every pool counted, got %v", got)
+		}
+	})
+
+	t.Run("distribution", func(t *testing.T) {
+		dist := &models.PoolDistribution{ByTVL: models.NewDistributionBuckets([]float64{0, 5e6})}
+		query, args, dest := poolDistributionQuery(dist, floor)
+
+		if len(dest) != 3 {
+			t.Fatalf("Expected the total and 2 bucket counts, got %d", len(dest))
+		}
+		// Bucket clauses compare tvl too; the floor is the WHERE clause
+		if kept := poolsAboveFloor(t, query, args, "pools WHERE tvl"); len(kept) != 3 {
+			t.Errorf("Expected 3 pools counted, got %d", len(kept))
+		}
+		got := countBy(poolsAboveFloor(t, poolsByChainQuery, []interface{}{floor}, "pools WHERE tvl"), "chain")
+		if got["ethereum"] != 2 || got["polygon"] != 1 {
+			t.Errorf("Expected 2 ethereum and 1 polygon pool by chain, got %v", got)
+		}
+	})
+}
+
+func TestUnavailableOpportunityPoolsQuery_ManualPoolsNeverStale(t *testing.T) {
+	query := strings.Join(strings.Fields(unavailableOpportunityPoolsQuery), " ")
+
+	// Deleted pools are unavailable whatever their source; only the staleness
+	// check leaves manual pools out
+	want := "WHERE ref.pool_id <> '' AND (p.id IS NULL OR (p.updated_at < $1 AND p.data_source <> $2))"
+	if !strings.Contains(query, want) {
+		t.Errorf("Expected %q in %q", want, query)
+	}
+}
+
+func TestUpsertPoolQuery_KeepsDataSource(t *testing.T) {
+	update := upsertPoolQuery[strings.Index(upsertPoolQuery, "DO UPDATE SET"):]
+
+	if strings.Contains(update, "data_source = EXCLUDED.data_source,") {
+		t.Error("Expected the data source not to be updated on conflict")
+	}
+	if !strings.HasSuffix(strings.TrimSpace(update), "WHERE pools.data_source = EXCLUDED.data_source") {
+		t.Errorf("Expected updates to be limited to the pool's own data source, got %s", update)
+	}
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+)
+
+// ErrUnavailable is returned without calling Redis while the circuit
+// breaker is open. Cache reads treat it as a miss.
+var ErrUnavailable = errors.New("Redis is unavailable")
+
+// breakerHook runs every command through the repository's circuit breaker.
+// While Redis is down commands fail fast with ErrUnavailable instead of
+// each waiting out a connection timeout. PING, sent by health checks, always
+// goes through; its outcome is the health flag that closes the breaker as
+// soon as Redis is back.
+type breakerHook struct {
+	r *Repository
+}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "ping" {
+			err := next(ctx, cmd)
+			h.r.record(ctx, err)
+			return err
+		}
+		return h.r.guard(ctx, func() error { return next(ctx, cmd) }, cmd)
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return h.r.guard(ctx, func() error { return next(ctx, cmds) }, cmds...)
+	}
+}
+
+// guard runs a Redis call through the circuit breaker. While the breaker is
+// open the call isn't made, the skip is counted and ErrUnavailable is set on
+// cmds and returned.
+func (r *Repository) guard(ctx context.Context, call func() error, cmds ...redis.Cmder) error {
+	if err := r.breaker.Allow(); err != nil {
+		r.unavailable.Add(1)
+		err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		for _, cmd := range cmds {
+			cmd.SetErr(err)
+		}
+		return err
+	}
+
+	err := call()
+	r.record(ctx, err)
+	return err
+}
+
+// record feeds the outcome of a Redis call to the circuit breaker, logging
+// when Redis goes down and when it recovers
+func (r *Repository) record(ctx context.Context, err error) {
+	before := r.breaker.State()
+	if isFailure(ctx, err) {
+		r.breaker.Failure()
+		if before != breaker.StateOpen && r.breaker.State() == breaker.StateOpen {
+			log.Warn().Err(err).Msg("Redis is unavailable, skipping cache calls until it recovers")
+		}
+		return
+	}
+
+	r.breaker.Success()
+	if before != breaker.StateClosed {
+		log.Info().Msg("Redis recovered, cache calls resumed")
+	}
+}
+
+// isFailure reports whether an error means Redis is unreachable: timeouts
+// and connection errors. Error replies, including a missing key, and
+// callers that went away don't count.
+func isFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var replyErr redis.Error
+	return !errors.As(err, &replyErr)
+}
+
+// BreakerState returns the state of the circuit breaker guarding Redis
+func (r *Repository) BreakerState() breaker.State {
+	return r.breaker.State()
+}
+
+// UnavailableCount returns the number of Redis calls skipped while the
+// circuit breaker was open
+func (r *Repository) UnavailableCount() int64 {
+	return r.unavailable.Load()
+}
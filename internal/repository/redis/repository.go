@@ -5,37 +5,67 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
 
 // Cache key prefixes
 const (
-	PrefixPool          = "pool:"
-	PrefixPools         = "pools:"
-	PrefixOpportunities = "opportunities:"
-	PrefixTrending      = "trending:"
-	PrefixChains        = "chains"
-	PrefixProtocols     = "protocols:"
-	PrefixStats         = "stats"
-	PrefixPrices        = "prices:"
+	PrefixPool           = "pool:"
+	PrefixPoolTombstone  = "pool_tombstone:" // Pool IDs recently looked up and not found
+	PrefixPools          = "pools:"
+	KeyPoolsGeneration   = "cache:pools_generation" // Part of every pool list key; bumping it retires them all at once
+	PrefixOpportunities  = "opportunities:"
+	PrefixPoolOpps       = PrefixOpportunities + "pool:" // Under PrefixOpportunities so opportunity invalidation clears it
+	PrefixBestPerChain   = PrefixOpportunities + "best_per_chain:"
+	PrefixTrending       = "trending:"
+	PrefixChains         = "chains"
+	PrefixProtocols      = "protocols:"
+	PrefixStats          = "stats"
+	KeyStatsES           = PrefixStats + ":es" // Platform stats aggregated by ElasticSearch
+	PrefixDistribution   = "distribution"
+	KeyTags              = "tags" // Tag listing, cleared with the stats
+	PrefixPrices         = "prices:"
+	PrefixTokens         = "tokens:" // Resolved reward token contracts, by chain and address
+	KeyRewardTokens      = "rewards:price_tokens"
+	PrefixReindex        = "reindex:"
+	KeyYieldGapScan      = "detection:yield_gap_scan"
+	KeyHistoryWrites     = "metrics:history_writes"          // Historical data points written and skipped by ingestion
+	KeyDiscarded         = "metrics:opportunities_discarded" // Detected opportunities over the caps, by type
+	KeyDetectionLock     = "detection:lock"
+	KeyFetchCheckpoint   = "fetch:checkpoint"
+	KeyMonitorState      = "monitor:state"       // Platform monitor baseline and breach counts
+	KeyDataStatus        = "monitor:data_status" // Whether the latest data looks suspect
+	PrefixProcessMetrics = "metrics:process:"    // Metric families of each process of a preforked server
+	PrefixRateLimit      = "ratelimit:"          // API rate limiter counters shared by preforked processes
 )
 
 // Pub/Sub channels
 const (
-	ChannelPoolUpdates       = "pool_updates"
-	ChannelOpportunityAlerts = "opportunity_alerts"
+	ChannelPoolUpdates            = "pool_updates"
+	ChannelOpportunityAlerts      = "opportunity_alerts"
+	ChannelOpportunityRetractions = "opportunity_retractions"
+	ChannelPlatformAlerts         = "platform_alerts" // Operator alerts on platform-wide anomalies
 )
 
 // Repository handles all Redis operations
 type Repository struct {
-	client *redis.Client
+	client      *redis.Client
+	breaker     *breaker.Breaker
+	unavailable atomic.Int64 // Calls skipped while the breaker was open
 }
 
 // NewRepository creates a new Redis repository
@@ -52,7 +82,9 @@ func NewRepository(ctx context.Context, cfg config.RedisConfig) (*Repository, er
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &Repository{client: client}, nil
+	r := &Repository{client: client, breaker: breaker.New(cfg.BreakerThreshold, cfg.BreakerCooldown)}
+	client.AddHook(breakerHook{r: r})
+	return r, nil
 }
 
 // Close closes the Redis connection
@@ -60,7 +92,9 @@ func (r *Repository) Close() error {
 	return r.client.Close()
 }
 
-// Ping checks if Redis connection is alive
+// Ping checks if Redis connection is alive. It bypasses the circuit
+// breaker and closes it on success, so cache calls resume as soon as a
+// health check sees Redis again.
 func (r *Repository) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
@@ -104,9 +138,40 @@ func (r *Repository) SetPool(ctx context.Context, pool *models.Pool, ttlSeconds
 	return r.client.Set(ctx, key, data, time.Duration(ttlSeconds)*time.Second).Err()
 }
 
+// getPoolListScript reads a pool list entry stored under the current
+// generation: KEYS[1] is the generation, ARGV[1] the entry's key without it
+var getPoolListScript = redis.NewScript(`
+local generation = redis.call('GET', KEYS[1]) or '0'
+return redis.call('GET', ARGV[1] .. ':g' .. generation)
+`)
+
+// setPoolListScript stores a pool list entry under the current generation,
+// with ARGV[2] the value and ARGV[3] the TTL in seconds
+var setPoolListScript = redis.NewScript(`
+local generation = redis.call('GET', KEYS[1]) or '0'
+return redis.call('SET', ARGV[1] .. ':g' .. generation, ARGV[2], 'EX', ARGV[3])
+`)
+
+// getPoolList reads a cached pool list or search page. Lists are stored
+// under the generation current when they were written, so bumping it
+// retires them all in one atomic step.
+func (r *Repository) getPoolList(ctx context.Context, cacheKey string) ([]byte, error) {
+	data, err := getPoolListScript.Run(ctx, r.client, []string{KeyPoolsGeneration}, cacheKey).Text()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// setPoolList caches a pool list or search page under the current
+// generation
+func (r *Repository) setPoolList(ctx context.Context, cacheKey string, data []byte, ttlSeconds int) error {
+	return setPoolListScript.Run(ctx, r.client, []string{KeyPoolsGeneration}, cacheKey, data, ttlSeconds).Err()
+}
+
 // GetPoolsCache retrieves cached pool list response
 func (r *Repository) GetPoolsCache(ctx context.Context, cacheKey string) (*models.PoolListResponse, error) {
-	data, err := r.client.Get(ctx, cacheKey).Bytes()
+	data, err := r.getPoolList(ctx, cacheKey)
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -129,27 +194,154 @@ func (r *Repository) SetPoolsCache(ctx context.Context, cacheKey string, respons
 		return err
 	}
 
-	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
+	return r.setPoolList(ctx, cacheKey, data, ttlSeconds)
+}
+
+// GetPoolSearchCache retrieves a cached pool search response
+func (r *Repository) GetPoolSearchCache(ctx context.Context, cacheKey string) (*models.PoolSearchResponse, error) {
+	data, err := r.getPoolList(ctx, cacheKey)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var response models.PoolSearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetPoolSearchCache caches a pool search response
+func (r *Repository) SetPoolSearchCache(ctx context.Context, cacheKey string, response *models.PoolSearchResponse, ttlSeconds int) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return r.setPoolList(ctx, cacheKey, data, ttlSeconds)
 }
 
-// SetMultiplePools caches multiple pools at once using pipeline
+// HasPoolTombstone reports whether a pool ID was recently looked up and not
+// found
+func (r *Repository) HasPoolTombstone(ctx context.Context, id string) (bool, error) {
+	n, err := r.client.Exists(ctx, PrefixPoolTombstone+id).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check pool tombstone: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SetPoolTombstone remembers that a pool ID wasn't found for ttlSeconds, so
+// lookups of it are answered without the database until then
+func (r *Repository) SetPoolTombstone(ctx context.Context, id string, ttlSeconds int) error {
+	return r.client.Set(ctx, PrefixPoolTombstone+id, 1, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// SetMultiplePools caches multiple pools at once using pipeline. Tombstones
+// of the pools are cleared, so a pool that appears is found right away.
 func (r *Repository) SetMultiplePools(ctx context.Context, pools []models.Pool, ttlSeconds int) error {
 	pipe := r.client.Pipeline()
+	queuePools(ctx, pipe, pools, time.Duration(ttlSeconds)*time.Second)
 
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// queuePools queues the writes caching pools and clearing their tombstones
+func queuePools(ctx context.Context, pipe redis.Pipeliner, pools []models.Pool, ttl time.Duration) {
 	for _, pool := range pools {
-		key := PrefixPool + pool.ID
 		data, err := json.Marshal(pool)
 		if err != nil {
 			log.Warn().Str("pool_id", pool.ID).Err(err).Msg("Failed to marshal pool")
 			continue
 		}
-		pipe.Set(ctx, key, data, time.Duration(ttlSeconds)*time.Second)
+		pipe.Set(ctx, PrefixPool+pool.ID, data, ttl)
+		pipe.Del(ctx, PrefixPoolTombstone+pool.ID)
 	}
+}
 
-	_, err := pipe.Exec(ctx)
+// IngestionCacheUpdate is what an ingestion cycle changes in the cache
+type IngestionCacheUpdate struct {
+	Pools     []models.Pool // Cached for PoolTTL, clearing their tombstones
+	PoolTTL   time.Duration
+	PoolLists bool // Retire every cached pool list and search page
+	Stats     bool // Delete the cached stats, chain pages, distribution and tag listing
+}
+
+// ApplyIngestionCacheUpdate writes the pools of an ingestion cycle and
+// clears the caches derived from them in one MULTI/EXEC transaction, so
+// readers see all of it or none of it: never a fresh pool detail next to a
+// list from before the cycle. Pool updates should be published only once
+// it succeeded.
+//
+// If the transaction can't be sent or is discarded nothing was applied.
+// Redis doesn't roll back, though: a command failing inside an executed
+// transaction leaves the others applied and its error is returned. Either
+// way the caller skips publishing, and the next cycle writes the pools
+// again.
+func (r *Repository) ApplyIngestionCacheUpdate(ctx context.Context, update IngestionCacheUpdate) error {
+	// Chain pages are found with SCAN, which can't run in a transaction; a
+	// page cached in between is left to its TTL
+	var statsKeys []string
+	if update.Stats {
+		keys, err := r.statsCacheKeys(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list stats cache keys: %w", err)
+		}
+		statsKeys = keys
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		queuePools(ctx, pipe, update.Pools, update.PoolTTL)
+		if update.PoolLists {
+			pipe.Incr(ctx, KeyPoolsGeneration)
+		}
+		if len(statsKeys) > 0 {
+			pipe.Del(ctx, statsKeys...)
+		}
+		return nil
+	})
 	return err
 }
 
+// GetPools retrieves cached pools by ID in a single round trip. Pools that
+// aren't cached, or whose entry can't be decoded, are left out of the result.
+func (r *Repository) GetPools(ctx context.Context, ids []string) (map[string]models.Pool, error) {
+	pools := make(map[string]models.Pool, len(ids))
+	if len(ids) == 0 {
+		return pools, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = PrefixPool + id
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pools from cache: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // Cache miss
+		}
+		var pool models.Pool
+		if err := json.Unmarshal([]byte(data), &pool); err != nil {
+			log.Warn().Str("pool_id", ids[i]).Err(err).Msg("Failed to unmarshal cached pool")
+			continue
+		}
+		pools[ids[i]] = pool
+	}
+
+	return pools, nil
+}
+
 // =============================================================================
 // Opportunity Cache Operations
 // =============================================================================
@@ -182,6 +374,64 @@ func (r *Repository) SetOpportunitiesCache(ctx context.Context, cacheKey string,
 	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
 }
 
+// GetPoolOpportunitiesCache retrieves a pool's cached opportunities
+func (r *Repository) GetPoolOpportunitiesCache(ctx context.Context, poolID string) (*models.PoolOpportunitiesResponse, error) {
+	data, err := r.client.Get(ctx, PrefixPoolOpps+poolID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var response models.PoolOpportunitiesResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetPoolOpportunitiesCache caches a pool's opportunities
+func (r *Repository) SetPoolOpportunitiesCache(ctx context.Context, response *models.PoolOpportunitiesResponse, ttlSeconds int) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, PrefixPoolOpps+response.PoolID, data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// GetBestOpportunitiesCache retrieves the cached best opportunity per
+// chain for a chain limit
+func (r *Repository) GetBestOpportunitiesCache(ctx context.Context, limit int) ([]models.Opportunity, error) {
+	data, err := r.client.Get(ctx, PrefixBestPerChain+strconv.Itoa(limit)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var opportunities []models.Opportunity
+	if err := json.Unmarshal(data, &opportunities); err != nil {
+		return nil, err
+	}
+
+	return opportunities, nil
+}
+
+// SetBestOpportunitiesCache caches the best opportunity per chain for a
+// chain limit
+func (r *Repository) SetBestOpportunitiesCache(ctx context.Context, limit int, opportunities []models.Opportunity, ttlSeconds int) error {
+	data, err := json.Marshal(opportunities)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, PrefixBestPerChain+strconv.Itoa(limit), data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
 // GetTrendingCache retrieves cached trending pools
 func (r *Repository) GetTrendingCache(ctx context.Context, cacheKey string) ([]models.TrendingPool, error) {
 	data, err := r.client.Get(ctx, cacheKey).Bytes()
@@ -214,9 +464,9 @@ func (r *Repository) SetTrendingCache(ctx context.Context, cacheKey string, tren
 // Stats Cache Operations
 // =============================================================================
 
-// GetChainsCache retrieves cached chains
-func (r *Repository) GetChainsCache(ctx context.Context) (*models.ChainListResponse, error) {
-	data, err := r.client.Get(ctx, PrefixChains).Bytes()
+// GetChainsCache retrieves a cached page of chains
+func (r *Repository) GetChainsCache(ctx context.Context, cacheKey string) (*models.ChainListResponse, error) {
+	data, err := r.client.Get(ctx, cacheKey).Bytes()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -232,14 +482,14 @@ func (r *Repository) GetChainsCache(ctx context.Context) (*models.ChainListRespo
 	return &response, nil
 }
 
-// SetChainsCache caches chains
-func (r *Repository) SetChainsCache(ctx context.Context, response *models.ChainListResponse, ttlSeconds int) error {
+// SetChainsCache caches a page of chains
+func (r *Repository) SetChainsCache(ctx context.Context, cacheKey string, response *models.ChainListResponse, ttlSeconds int) error {
 	data, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
 
-	return r.client.Set(ctx, PrefixChains, data, time.Duration(ttlSeconds)*time.Second).Err()
+	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
 }
 
 // GetProtocolsCache retrieves cached protocols
@@ -270,9 +520,79 @@ func (r *Repository) SetProtocolsCache(ctx context.Context, cacheKey string, res
 	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
 }
 
-// GetStatsCache retrieves cached platform stats
-func (r *Repository) GetStatsCache(ctx context.Context) (*models.PlatformStats, error) {
-	data, err := r.client.Get(ctx, PrefixStats).Bytes()
+// GetProtocolHistoryCache retrieves a cached protocol APY history
+func (r *Repository) GetProtocolHistoryCache(ctx context.Context, cacheKey string) (*models.ProtocolHistoryResponse, error) {
+	data, err := r.client.Get(ctx, cacheKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var response models.ProtocolHistoryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetProtocolHistoryCache caches a protocol APY history
+func (r *Repository) SetProtocolHistoryCache(ctx context.Context, cacheKey string, response *models.ProtocolHistoryResponse, ttlSeconds int) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// GetChainHistoryCache retrieves a cached chain APY history
+func (r *Repository) GetChainHistoryCache(ctx context.Context, cacheKey string) (*models.ChainHistoryResponse, error) {
+	data, err := r.client.Get(ctx, cacheKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var response models.ChainHistoryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetChainHistoryCache caches a chain APY history
+func (r *Repository) SetChainHistoryCache(ctx context.Context, cacheKey string, response *models.ChainHistoryResponse, ttlSeconds int) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, cacheKey, data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// statsCacheKey returns the cache key of platform stats from a source,
+// possibly followed by models.StatsVariantAll
+func statsCacheKey(source string) string {
+	source, all := strings.CutSuffix(source, models.StatsVariantAll)
+	key := PrefixStats
+	if source == models.StatsSourceES {
+		key = KeyStatsES
+	}
+	if all {
+		key += models.StatsVariantAll
+	}
+	return key
+}
+
+// GetStatsCache retrieves cached platform stats requested from source
+func (r *Repository) GetStatsCache(ctx context.Context, source string) (*models.PlatformStats, error) {
+	data, err := r.client.Get(ctx, statsCacheKey(source)).Bytes()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -288,14 +608,177 @@ func (r *Repository) GetStatsCache(ctx context.Context) (*models.PlatformStats,
 	return &stats, nil
 }
 
-// SetStatsCache caches platform stats
-func (r *Repository) SetStatsCache(ctx context.Context, stats *models.PlatformStats, ttlSeconds int) error {
+// SetStatsCache caches platform stats requested from source
+func (r *Repository) SetStatsCache(ctx context.Context, source string, stats *models.PlatformStats, ttlSeconds int) error {
 	data, err := json.Marshal(stats)
 	if err != nil {
 		return err
 	}
 
-	return r.client.Set(ctx, PrefixStats, data, time.Duration(ttlSeconds)*time.Second).Err()
+	return r.client.Set(ctx, statsCacheKey(source), data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// distributionCacheKey returns the cache key of the pool distribution, with
+// or without the pools below the listing TVL floor
+func distributionCacheKey(includeEmpty bool) string {
+	if includeEmpty {
+		return PrefixDistribution + models.StatsVariantAll
+	}
+	return PrefixDistribution
+}
+
+// GetDistributionCache retrieves the cached pool distribution
+func (r *Repository) GetDistributionCache(ctx context.Context, includeEmpty bool) (*models.PoolDistribution, error) {
+	data, err := r.client.Get(ctx, distributionCacheKey(includeEmpty)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dist models.PoolDistribution
+	if err := json.Unmarshal(data, &dist); err != nil {
+		return nil, err
+	}
+
+	return &dist, nil
+}
+
+// SetDistributionCache caches the pool distribution
+func (r *Repository) SetDistributionCache(ctx context.Context, includeEmpty bool, dist *models.PoolDistribution, ttlSeconds int) error {
+	data, err := json.Marshal(dist)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, distributionCacheKey(includeEmpty), data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// GetTagsCache retrieves the cached tag listing
+func (r *Repository) GetTagsCache(ctx context.Context) (*models.TagListResponse, error) {
+	data, err := r.client.Get(ctx, KeyTags).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var response models.TagListResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetTagsCache caches the tag listing
+func (r *Repository) SetTagsCache(ctx context.Context, response *models.TagListResponse, ttlSeconds int) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, KeyTags, data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// GetYieldGapScan retrieves the summary of the last yield gap detection run
+func (r *Repository) GetYieldGapScan(ctx context.Context) (*models.YieldGapScan, error) {
+	data, err := r.client.Get(ctx, KeyYieldGapScan).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var scan models.YieldGapScan
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, err
+	}
+
+	return &scan, nil
+}
+
+// SetYieldGapScan stores the summary of a yield gap detection run so the API
+// server can export it
+func (r *Repository) SetYieldGapScan(ctx context.Context, scan *models.YieldGapScan, ttlSeconds int) error {
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, KeyYieldGapScan, data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// AddHistoryWrites adds to the counts of historical data points written and
+// skipped, shared by every worker so the API server can export them
+func (r *Repository) AddHistoryWrites(ctx context.Context, written, skipped int64) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, KeyHistoryWrites, "written", written)
+		pipe.HIncrBy(ctx, KeyHistoryWrites, "skipped", skipped)
+		return nil
+	})
+	return err
+}
+
+// GetHistoryWrites retrieves the counts of historical data points written
+// and skipped, nil before any were counted
+func (r *Repository) GetHistoryWrites(ctx context.Context) (*models.HistoryWrites, error) {
+	fields, err := r.client.HGetAll(ctx, KeyHistoryWrites).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	var writes models.HistoryWrites
+	if writes.Written, err = strconv.ParseInt(fields["written"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid written count: %w", err)
+	}
+	if writes.Skipped, err = strconv.ParseInt(fields["skipped"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid skipped count: %w", err)
+	}
+	return &writes, nil
+}
+
+// AddDiscardedOpportunities adds to the counts of detected opportunities
+// discarded by the per-run caps, by type, so the API server can export them
+func (r *Repository) AddDiscardedOpportunities(ctx context.Context, discarded map[models.OpportunityType]int) error {
+	if len(discarded) == 0 {
+		return nil
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for oppType, n := range discarded {
+			pipe.HIncrBy(ctx, KeyDiscarded, string(oppType), int64(n))
+		}
+		return nil
+	})
+	return err
+}
+
+// GetDiscardedOpportunities retrieves the counts of discarded opportunities
+// by type, nil before any were discarded
+func (r *Repository) GetDiscardedOpportunities(ctx context.Context) (map[string]int64, error) {
+	fields, err := r.client.HGetAll(ctx, KeyDiscarded).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	discarded := make(map[string]int64, len(fields))
+	for oppType, value := range fields {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid discarded count for %s: %w", oppType, err)
+		}
+		discarded[oppType] = n
+	}
+	return discarded, nil
 }
 
 // =============================================================================
@@ -334,6 +817,452 @@ func (r *Repository) SetMultipleTokenPrices(ctx context.Context, prices map[stri
 	return err
 }
 
+// tokenKey returns the cache key of a resolved token contract
+func tokenKey(chain, address string) string {
+	return PrefixTokens + strings.ToLower(chain) + ":" + strings.ToLower(address)
+}
+
+// GetResolvedToken retrieves a cached token resolution, or nil on a miss
+func (r *Repository) GetResolvedToken(ctx context.Context, chain, address string) (*models.ResolvedToken, error) {
+	data, err := r.client.Get(ctx, tokenKey(chain, address)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get resolved token from cache: %w", err)
+	}
+
+	var token models.ResolvedToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resolved token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// SetResolvedToken caches a token resolution with TTL in seconds
+func (r *Repository) SetResolvedToken(ctx context.Context, token *models.ResolvedToken, ttlSeconds int) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resolved token: %w", err)
+	}
+
+	return r.client.Set(ctx, tokenKey(token.Chain, token.Address), data, time.Duration(ttlSeconds)*time.Second).Err()
+}
+
+// AddRewardTokens records CoinGecko IDs of reward tokens the API has been
+// asked about, so the worker fetches their prices
+func (r *Repository) AddRewardTokens(ctx context.Context, tokenIDs []string, at time.Time) error {
+	if len(tokenIDs) == 0 {
+		return nil
+	}
+
+	members := make([]redis.Z, len(tokenIDs))
+	for i, id := range tokenIDs {
+		members[i] = redis.Z{Score: float64(at.Unix()), Member: id}
+	}
+	return r.client.ZAdd(ctx, KeyRewardTokens, members...).Err()
+}
+
+// GetRewardTokens returns the reward token IDs recorded since a time and
+// drops older ones
+func (r *Repository) GetRewardTokens(ctx context.Context, since time.Time) ([]string, error) {
+	min := strconv.FormatInt(since.Unix(), 10)
+	if err := r.client.ZRemRangeByScore(ctx, KeyRewardTokens, "-inf", "("+min).Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire reward tokens: %w", err)
+	}
+
+	return r.client.ZRange(ctx, KeyRewardTokens, 0, -1).Result()
+}
+
+// =============================================================================
+// Reindex Coordination
+// =============================================================================
+
+// GetReindexStatus retrieves the pools reindex checkpoint, or nil if no
+// reindex has run
+func (r *Repository) GetReindexStatus(ctx context.Context) (*models.ReindexStatus, error) {
+	data, err := r.client.Get(ctx, PrefixReindex+"pools").Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var status models.ReindexStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// SetReindexStatus stores the pools reindex checkpoint. It is kept for a
+// week so the outcome of the last run can still be inspected.
+func (r *Repository) SetReindexStatus(ctx context.Context, status *models.ReindexStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, PrefixReindex+"pools", data, 7*24*time.Hour).Err()
+}
+
+// AcquireReindexLock takes the pools reindex lock for ttl, returning the
+// owner token, or false if another process holds it
+func (r *Repository) AcquireReindexLock(ctx context.Context, ttl time.Duration) (string, bool, error) {
+	return r.acquireLock(ctx, PrefixReindex+"pools:lock", ttl)
+}
+
+// ExtendReindexLock renews the pools reindex lock owned by token, or returns
+// ErrLockLost if it expired
+func (r *Repository) ExtendReindexLock(ctx context.Context, token string, ttl time.Duration) error {
+	return r.extendLock(ctx, PrefixReindex+"pools:lock", token, ttl)
+}
+
+// ReleaseReindexLock releases the pools reindex lock, if token still owns it
+func (r *Repository) ReleaseReindexLock(ctx context.Context, token string) error {
+	return r.releaseLock(ctx, PrefixReindex+"pools:lock", token)
+}
+
+// ErrLockLost is returned when extending a lock that expired, and may have
+// been taken by another process since
+var ErrLockLost = errors.New("lock is no longer held")
+
+// extendLockScript renews the TTL of the lock KEYS[1], ARGV[2] milliseconds,
+// only while it still holds the owner token ARGV[1]
+var extendLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes the lock KEYS[1] only while it still holds the
+// owner token ARGV[1]
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// acquireLock takes the lock key for ttl, returning the owner token that
+// extends and releases it, or false if another process holds it. The token
+// is random, so a process whose lock expired can't extend or release the
+// lock of the one that took it next.
+func (r *Repository) acquireLock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	token := uuid.New().String()
+	acquired, err := r.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !acquired {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// extendLock renews the lock key for ttl if token still owns it, or returns
+// ErrLockLost
+func (r *Repository) extendLock(ctx context.Context, key, token string, ttl time.Duration) error {
+	extended, err := extendLockScript.Run(ctx, r.client, []string{key}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// releaseLock deletes the lock key if token still owns it. A lock that
+// expired and was taken by another process is left alone.
+func (r *Repository) releaseLock(ctx context.Context, key, token string) error {
+	return releaseLockScript.Run(ctx, r.client, []string{key}, token).Err()
+}
+
+// AcquireDetectionLock takes the opportunity detection lock for ttl,
+// returning the owner token, or false if another run holds it
+func (r *Repository) AcquireDetectionLock(ctx context.Context, ttl time.Duration) (string, bool, error) {
+	return r.acquireLock(ctx, KeyDetectionLock, ttl)
+}
+
+// ExtendDetectionLock renews the opportunity detection lock owned by token,
+// or returns ErrLockLost if it expired
+func (r *Repository) ExtendDetectionLock(ctx context.Context, token string, ttl time.Duration) error {
+	return r.extendLock(ctx, KeyDetectionLock, token, ttl)
+}
+
+// ReleaseDetectionLock releases the opportunity detection lock, if token
+// still owns it
+func (r *Repository) ReleaseDetectionLock(ctx context.Context, token string) error {
+	return r.releaseLock(ctx, KeyDetectionLock, token)
+}
+
+// GetFetchCheckpoint retrieves the checkpoint of an unfinished pools fetch,
+// or nil if the last fetch finished or the checkpoint expired
+func (r *Repository) GetFetchCheckpoint(ctx context.Context) (*models.FetchCheckpoint, error) {
+	data, err := r.client.Get(ctx, KeyFetchCheckpoint).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint models.FetchCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+// SetFetchCheckpoint stores the pools fetch checkpoint for ttl
+func (r *Repository) SetFetchCheckpoint(ctx context.Context, checkpoint *models.FetchCheckpoint, ttl time.Duration) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, KeyFetchCheckpoint, data, ttl).Err()
+}
+
+// ClearFetchCheckpoint deletes the pools fetch checkpoint once a fetch
+// finished
+func (r *Repository) ClearFetchCheckpoint(ctx context.Context) error {
+	return r.client.Del(ctx, KeyFetchCheckpoint).Err()
+}
+
+// GetMonitorState retrieves what the platform monitor kept from earlier
+// fetches, or nil before its first check
+func (r *Repository) GetMonitorState(ctx context.Context) (*models.MonitorState, error) {
+	data, err := r.client.Get(ctx, KeyMonitorState).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state models.MonitorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// SetMonitorState stores the platform monitor's state. It doesn't expire,
+// so a long outage is still compared with the last healthy fetch.
+func (r *Repository) SetMonitorState(ctx context.Context, state *models.MonitorState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, KeyMonitorState, data, 0).Err()
+}
+
+// GetDataStatus retrieves whether the latest data looks suspect, or nil if
+// the platform monitor never ran
+func (r *Repository) GetDataStatus(ctx context.Context) (*models.DataStatus, error) {
+	data, err := r.client.Get(ctx, KeyDataStatus).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var status models.DataStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// SetDataStatus stores whether the latest data looks suspect
+func (r *Repository) SetDataStatus(ctx context.Context, status *models.DataStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Set(ctx, KeyDataStatus, data, 0).Err()
+}
+
+// =============================================================================
+// Preforked Server Coordination
+// =============================================================================
+
+// SetProcessMetrics stores the metric families of one process of a
+// preforked server until it publishes them again or ttl passes
+func (r *Repository) SetProcessMetrics(ctx context.Context, group, process string, data []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, PrefixProcessMetrics+group+":"+process, data, ttl).Err()
+}
+
+// GetProcessMetrics returns the metric families stored by each live process
+// of a preforked server
+func (r *Repository) GetProcessMetrics(ctx context.Context, group string) ([][]byte, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, PrefixProcessMetrics+group+":*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list process metrics: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get process metrics: %w", err)
+	}
+
+	published := make([][]byte, 0, len(values))
+	for _, value := range values {
+		if data, ok := value.(string); ok { // Expired since the scan otherwise
+			published = append(published, []byte(data))
+		}
+	}
+	return published, nil
+}
+
+// LimiterStorage keeps the API rate limiter's counters in Redis, so the
+// processes of a preforked server count requests against one limit instead
+// of each allowing the full limit. It implements fiber.Storage.
+//
+// When Redis fails, or the circuit breaker skips it, counters are kept in
+// memory instead: each process then enforces the limit on its own, rather
+// than the limiter starting every count from zero and letting everything
+// through.
+type LimiterStorage struct {
+	client   *redis.Client
+	fallback *memoryCounters
+}
+
+// LimiterStorage returns storage for the API rate limiter
+func (r *Repository) LimiterStorage() *LimiterStorage {
+	return &LimiterStorage{client: r.client, fallback: newMemoryCounters()}
+}
+
+// Get returns the value of key, or nil if there is none
+func (s *LimiterStorage) Get(key string) ([]byte, error) {
+	data, err := s.client.Get(context.Background(), PrefixRateLimit+key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return s.fallback.get(key), nil
+	}
+	return data, nil
+}
+
+// Set stores val under key for exp, or without expiry if exp is 0
+func (s *LimiterStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	if err := s.client.Set(context.Background(), PrefixRateLimit+key, val, exp).Err(); err != nil {
+		s.fallback.set(key, val, exp)
+	}
+	return nil
+}
+
+// Delete removes key
+func (s *LimiterStorage) Delete(key string) error {
+	s.fallback.delete(key)
+	s.client.Del(context.Background(), PrefixRateLimit+key)
+	return nil
+}
+
+// Reset removes every rate limiter counter
+func (s *LimiterStorage) Reset() error {
+	s.fallback.reset()
+
+	ctx := context.Background()
+	iter := s.client.Scan(ctx, 0, PrefixRateLimit+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		if err := s.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); !errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	return nil
+}
+
+// Close does nothing; the connection belongs to the repository
+func (s *LimiterStorage) Close() error {
+	return nil
+}
+
+// memoryCounters holds rate limiter counters in memory while Redis fails
+type memoryCounters struct {
+	mu        sync.Mutex
+	entries   map[string]memoryCounter
+	lastSweep time.Time
+}
+
+type memoryCounter struct {
+	val     []byte
+	expires time.Time // Zero for no expiry
+}
+
+func newMemoryCounters() *memoryCounters {
+	return &memoryCounters{entries: make(map[string]memoryCounter), lastSweep: time.Now()}
+}
+
+func (m *memoryCounters) get(key string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil
+	}
+	return entry.val
+}
+
+// set stores val under key for exp. Expired counters are swept once a
+// minute, so an outage doesn't leave one behind for every client seen.
+func (m *memoryCounters) set(key string, val []byte, exp time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry := memoryCounter{val: append([]byte(nil), val...)}
+	if exp > 0 {
+		entry.expires = now.Add(exp)
+	}
+	m.entries[key] = entry
+
+	if now.Sub(m.lastSweep) >= time.Minute {
+		for k, e := range m.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+}
+
+func (m *memoryCounters) delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *memoryCounters) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]memoryCounter)
+}
+
 // =============================================================================
 // Pub/Sub Operations for Real-Time Updates
 // =============================================================================
@@ -348,6 +1277,27 @@ func (r *Repository) PublishPoolUpdate(ctx context.Context, pool *models.Pool) e
 	return r.client.Publish(ctx, ChannelPoolUpdates, data).Err()
 }
 
+// PublishPoolUpdates publishes many pool updates in a single pipeline
+func (r *Repository) PublishPoolUpdates(ctx context.Context, updates []models.PoolUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+
+	for i := range updates {
+		data, err := json.Marshal(&updates[i])
+		if err != nil {
+			log.Warn().Str("pool_id", updates[i].ID).Err(err).Msg("Failed to marshal pool for publish")
+			continue
+		}
+		pipe.Publish(ctx, ChannelPoolUpdates, data)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 // PublishOpportunityAlert publishes a new opportunity alert
 func (r *Repository) PublishOpportunityAlert(ctx context.Context, opportunity *models.Opportunity) error {
 	data, err := json.Marshal(opportunity)
@@ -358,6 +1308,37 @@ func (r *Repository) PublishOpportunityAlert(ctx context.Context, opportunity *m
 	return r.client.Publish(ctx, ChannelOpportunityAlerts, data).Err()
 }
 
+// PublishOpportunityRetractions publishes retracted opportunities in a single pipeline
+func (r *Repository) PublishOpportunityRetractions(ctx context.Context, retractions []models.OpportunityRetraction) error {
+	if len(retractions) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+
+	for i := range retractions {
+		data, err := json.Marshal(&retractions[i])
+		if err != nil {
+			log.Warn().Str("opportunity_id", retractions[i].OpportunityID).Err(err).Msg("Failed to marshal retraction for publish")
+			continue
+		}
+		pipe.Publish(ctx, ChannelOpportunityRetractions, data)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PublishPlatformAlert publishes an operator alert on a platform-wide anomaly
+func (r *Repository) PublishPlatformAlert(ctx context.Context, alert *models.PlatformAlert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, ChannelPlatformAlerts, data).Err()
+}
+
 // SubscribePoolUpdates returns a channel for pool update events
 func (r *Repository) SubscribePoolUpdates(ctx context.Context) *redis.PubSub {
 	return r.client.Subscribe(ctx, ChannelPoolUpdates)
@@ -368,6 +1349,11 @@ func (r *Repository) SubscribeOpportunityAlerts(ctx context.Context) *redis.PubS
 	return r.client.Subscribe(ctx, ChannelOpportunityAlerts)
 }
 
+// SubscribeOpportunityRetractions returns a channel for opportunity retraction events
+func (r *Repository) SubscribeOpportunityRetractions(ctx context.Context) *redis.PubSub {
+	return r.client.Subscribe(ctx, ChannelOpportunityRetractions)
+}
+
 // =============================================================================
 // Cache Invalidation
 // =============================================================================
@@ -377,9 +1363,15 @@ func (r *Repository) InvalidatePoolCache(ctx context.Context, id string) error {
 	return r.client.Del(ctx, PrefixPool+id).Err()
 }
 
-// InvalidateAllPoolsCache removes all cached pool lists
+// InvalidateAllPoolsCache retires all cached pool lists and search pages by
+// bumping their generation. The old entries expire with their TTL.
 func (r *Repository) InvalidateAllPoolsCache(ctx context.Context) error {
-	iter := r.client.Scan(ctx, 0, PrefixPools+"*", 0).Iterator()
+	return r.client.Incr(ctx, KeyPoolsGeneration).Err()
+}
+
+// InvalidateOpportunitiesCache removes all cached opportunity lists
+func (r *Repository) InvalidateOpportunitiesCache(ctx context.Context) error {
+	iter := r.client.Scan(ctx, 0, PrefixOpportunities+"*", 0).Iterator()
 	for iter.Next(ctx) {
 		if err := r.client.Del(ctx, iter.Val()).Err(); err != nil {
 			log.Warn().Str("key", iter.Val()).Err(err).Msg("Failed to delete cache key")
@@ -388,8 +1380,28 @@ func (r *Repository) InvalidateAllPoolsCache(ctx context.Context) error {
 	return iter.Err()
 }
 
-// InvalidateStatsCache removes all cached stats
+// InvalidateStatsCache removes all cached stats, including every cached
+// page of chains and the tag listing
 func (r *Repository) InvalidateStatsCache(ctx context.Context) error {
-	keys := []string{PrefixStats, PrefixChains}
+	keys, err := r.statsCacheKeys(ctx)
+	if err != nil {
+		return err
+	}
 	return r.client.Del(ctx, keys...).Err()
 }
+
+// statsCacheKeys lists the keys of the cached stats: the fixed ones and
+// every cached page of chains
+func (r *Repository) statsCacheKeys(ctx context.Context) ([]string, error) {
+	keys := []string{
+		PrefixStats, KeyStatsES,
+		PrefixStats + models.StatsVariantAll, KeyStatsES + models.StatsVariantAll,
+		PrefixDistribution, PrefixDistribution + models.StatsVariantAll, KeyTags,
+	}
+
+	iter := r.client.Scan(ctx, 0, PrefixChains+":*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
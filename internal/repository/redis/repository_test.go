@@ -0,0 +1,410 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/middleware"
+	"github.com/maxjove/defi-yield-aggregator/internal/breaker"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+func newTestRepository(t *testing.T) (*Repository, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &Repository{client: client}, mr
+}
+
+func TestPoolTombstone_Expires(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := repo.SetPoolTombstone(ctx, "bogus", 30); err != nil {
+		t.Fatalf("Failed to set tombstone: %v", err)
+	}
+	if missing, err := repo.HasPoolTombstone(ctx, "bogus"); err != nil || !missing {
+		t.Fatalf("Expected a tombstone, got %v (%v)", missing, err)
+	}
+
+	mr.FastForward(29 * time.Second)
+	if missing, _ := repo.HasPoolTombstone(ctx, "bogus"); !missing {
+		t.Fatal("Expected the tombstone to last its TTL")
+	}
+
+	mr.FastForward(time.Second)
+	if missing, _ := repo.HasPoolTombstone(ctx, "bogus"); missing {
+		t.Error("Expected the tombstone to expire after its TTL")
+	}
+}
+
+func TestSetMultiplePools_ClearsTombstones(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	repo.SetPoolTombstone(ctx, "pool-1", 30)
+	repo.SetPoolTombstone(ctx, "pool-2", 30)
+
+	if err := repo.SetMultiplePools(ctx, []models.Pool{{ID: "pool-1"}}, 60); err != nil {
+		t.Fatalf("Failed to cache pools: %v", err)
+	}
+
+	if missing, _ := repo.HasPoolTombstone(ctx, "pool-1"); missing {
+		t.Error("Expected the ingested pool's tombstone cleared")
+	}
+	if missing, _ := repo.HasPoolTombstone(ctx, "pool-2"); !missing {
+		t.Error("Expected other tombstones kept")
+	}
+	if pool, err := repo.GetPool(ctx, "pool-1"); err != nil || pool == nil {
+		t.Errorf("Expected the pool cached, got %v (%v)", pool, err)
+	}
+}
+
+func TestProcessMetrics_ExpireAndGroup(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	repo.SetProcessMetrics(ctx, "host:100", "101", []byte(`[1]`), 30*time.Second)
+	repo.SetProcessMetrics(ctx, "host:100", "102", []byte(`[2]`), 10*time.Second)
+	repo.SetProcessMetrics(ctx, "host:200", "201", []byte(`[3]`), 30*time.Second)
+
+	if published, err := repo.GetProcessMetrics(ctx, "host:100"); err != nil || len(published) != 2 {
+		t.Fatalf("Expected both processes of the group, got %q (%v)", published, err)
+	}
+
+	mr.FastForward(10 * time.Second)
+	published, err := repo.GetProcessMetrics(ctx, "host:100")
+	if err != nil || len(published) != 1 || string(published[0]) != `[1]` {
+		t.Errorf("Expected the process that stopped publishing dropped, got %q (%v)", published, err)
+	}
+}
+
+func TestHistoryWrites(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	if writes, err := repo.GetHistoryWrites(ctx); err != nil || writes != nil {
+		t.Fatalf("Expected no counts yet, got %+v (%v)", writes, err)
+	}
+
+	repo.AddHistoryWrites(ctx, 10, 90)
+	repo.AddHistoryWrites(ctx, 5, 0)
+	writes, err := repo.GetHistoryWrites(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (models.HistoryWrites{Written: 15, Skipped: 90}); *writes != want {
+		t.Errorf("Expected %+v, got %+v", want, *writes)
+	}
+}
+
+func TestDiscardedOpportunities(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	if discarded, err := repo.GetDiscardedOpportunities(ctx); err != nil || discarded != nil {
+		t.Fatalf("Expected no counts yet, got %v (%v)", discarded, err)
+	}
+
+	repo.AddDiscardedOpportunities(ctx, map[models.OpportunityType]int{models.OpportunityTypeHighScore: 40, models.OpportunityTypeTrending: 2})
+	repo.AddDiscardedOpportunities(ctx, map[models.OpportunityType]int{models.OpportunityTypeHighScore: 10})
+	discarded, err := repo.GetDiscardedOpportunities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discarded["high-score"] != 50 || discarded["trending"] != 2 || len(discarded) != 2 {
+		t.Errorf("Expected 50 high-score and 2 trending, got %v", discarded)
+	}
+}
+
+func TestDetectionLock_Ownership(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	token, acquired, err := repo.AcquireDetectionLock(ctx, time.Minute)
+	if err != nil || !acquired || token == "" {
+		t.Fatalf("Expected the lock taken with a token, got %q %v (%v)", token, acquired, err)
+	}
+	if _, acquired, _ := repo.AcquireDetectionLock(ctx, time.Minute); acquired {
+		t.Fatal("Expected the lock held by the first run")
+	}
+
+	// Renewing keeps the lock past its first TTL
+	mr.FastForward(50 * time.Second)
+	if err := repo.ExtendDetectionLock(ctx, token, time.Minute); err != nil {
+		t.Fatalf("Failed to extend: %v", err)
+	}
+	mr.FastForward(50 * time.Second)
+	if !mr.Exists(KeyDetectionLock) {
+		t.Fatal("Expected the extended lock to still be held")
+	}
+
+	// Once it expires and another run takes it, the first run can neither
+	// extend nor release it
+	mr.FastForward(time.Minute)
+	other, acquired, _ := repo.AcquireDetectionLock(ctx, time.Minute)
+	if !acquired {
+		t.Fatal("Expected the expired lock to be taken")
+	}
+	if err := repo.ExtendDetectionLock(ctx, token, time.Hour); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Expected ErrLockLost, got %v", err)
+	}
+	if err := repo.ReleaseDetectionLock(ctx, token); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if value, _ := mr.Get(KeyDetectionLock); value != other {
+		t.Fatalf("Expected the other run's lock kept, got %q", value)
+	}
+	if ttl := mr.TTL(KeyDetectionLock); ttl != time.Minute {
+		t.Errorf("Expected the other run's TTL kept, got %v", ttl)
+	}
+
+	if err := repo.ReleaseDetectionLock(ctx, other); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	if mr.Exists(KeyDetectionLock) {
+		t.Error("Expected the owner's release to delete the lock")
+	}
+}
+
+func TestReindexLock_Ownership(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	token, acquired, err := repo.AcquireReindexLock(ctx, time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("Expected the lock taken, got %v (%v)", acquired, err)
+	}
+
+	if err := repo.ExtendReindexLock(ctx, "stale-token", time.Hour); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Expected ErrLockLost for another token, got %v", err)
+	}
+	repo.ReleaseReindexLock(ctx, "stale-token")
+	if ttl := mr.TTL(PrefixReindex + "pools:lock"); ttl != time.Minute {
+		t.Fatalf("Expected another token to leave the lock alone, got TTL %v", ttl)
+	}
+
+	if err := repo.ExtendReindexLock(ctx, token, time.Hour); err != nil {
+		t.Fatalf("Failed to extend: %v", err)
+	}
+	if ttl := mr.TTL(PrefixReindex + "pools:lock"); ttl != time.Hour {
+		t.Errorf("Expected the owner to extend the lock, got TTL %v", ttl)
+	}
+	repo.ReleaseReindexLock(ctx, token)
+	if mr.Exists(PrefixReindex + "pools:lock") {
+		t.Error("Expected the owner's release to delete the lock")
+	}
+}
+
+func TestLimiterStorage(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	storage := repo.LimiterStorage()
+
+	if data, err := storage.Get("1.2.3.4"); err != nil || data != nil {
+		t.Fatalf("Expected nothing stored, got %q (%v)", data, err)
+	}
+	if err := storage.Set("1.2.3.4", []byte("hits"), time.Minute); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	if data, _ := storage.Get("1.2.3.4"); string(data) != "hits" {
+		t.Errorf("Expected the stored value, got %q", data)
+	}
+	if !mr.Exists(PrefixRateLimit + "1.2.3.4") {
+		t.Error("Expected the counter under the rate limit prefix")
+	}
+
+	storage.Set("5.6.7.8", []byte("hits"), time.Minute)
+	if err := storage.Reset(); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if len(mr.Keys()) != 0 {
+		t.Errorf("Expected every counter removed, got %v", mr.Keys())
+	}
+}
+
+func TestLimiterStorage_BreakerOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	repo, err := NewRepository(context.Background(), config.RedisConfig{
+		Host:             mr.Host(),
+		Port:             mr.Port(),
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	app := fiber.New()
+	app.Use(middleware.RateLimiter(config.RateLimitConfig{Requests: 2, Window: time.Minute}, repo.LimiterStorage()))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	mr.Close()
+	repo.GetPool(context.Background(), "pool-1")
+	if repo.BreakerState() != breaker.StateOpen {
+		t.Fatalf("Expected the breaker open, got %s", repo.BreakerState())
+	}
+
+	// Requests are still served, and counted in memory against the limit
+	for i, want := range []int{fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i+1, err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, want, resp.StatusCode)
+		}
+	}
+
+	storage := repo.LimiterStorage()
+	if err := storage.Delete("1.2.3.4"); err != nil {
+		t.Errorf("Expected Delete to succeed with the breaker open, got %v", err)
+	}
+	if err := storage.Reset(); err != nil {
+		t.Errorf("Expected Reset to succeed with the breaker open, got %v", err)
+	}
+}
+
+func TestLimiterStorage_RedisDown(t *testing.T) {
+	// No breaker: every call reaches the closed connection and fails
+	repo, mr := newTestRepository(t)
+	storage := repo.LimiterStorage()
+	mr.Close()
+
+	if err := storage.Set("1.2.3.4", []byte("hits"), time.Minute); err != nil {
+		t.Fatalf("Expected Set to fall back to memory, got %v", err)
+	}
+	if data, err := storage.Get("1.2.3.4"); err != nil || string(data) != "hits" {
+		t.Errorf("Expected the counter from memory, got %q (%v)", data, err)
+	}
+	if data, _ := storage.Get("5.6.7.8"); data != nil {
+		t.Errorf("Expected nothing for another client, got %q", data)
+	}
+
+	if err := storage.Delete("1.2.3.4"); err != nil {
+		t.Fatalf("Expected Delete to succeed, got %v", err)
+	}
+	if data, _ := storage.Get("1.2.3.4"); data != nil {
+		t.Errorf("Expected the counter deleted, got %q", data)
+	}
+}
+
+func TestApplyIngestionCacheUpdate(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	repo.SetPoolsCache(ctx, "pools:v2:all:abc", &models.PoolListResponse{Total: 1}, 30)
+	repo.SetPoolSearchCache(ctx, "pools:v2:search:def", &models.PoolSearchResponse{}, 30)
+	repo.SetStatsCache(ctx, models.StatsSourcePostgres, &models.PlatformStats{TotalPools: 1}, 120)
+	mr.Set(PrefixChains+":v2::123", "page")
+	repo.SetPoolTombstone(ctx, "pool-1", 30)
+
+	update := IngestionCacheUpdate{
+		Pools:     []models.Pool{{ID: "pool-1"}},
+		PoolTTL:   time.Minute,
+		PoolLists: true,
+		Stats:     true,
+	}
+	if err := repo.ApplyIngestionCacheUpdate(ctx, update); err != nil {
+		t.Fatalf("Failed to apply the update: %v", err)
+	}
+
+	if pool, err := repo.GetPool(ctx, "pool-1"); err != nil || pool == nil {
+		t.Errorf("Expected the pool cached, got %v (%v)", pool, err)
+	}
+	if missing, _ := repo.HasPoolTombstone(ctx, "pool-1"); missing {
+		t.Error("Expected the tombstone cleared")
+	}
+	if list, err := repo.GetPoolsCache(ctx, "pools:v2:all:abc"); err != nil || list != nil {
+		t.Errorf("Expected the pool list retired, got %+v (%v)", list, err)
+	}
+	if page, err := repo.GetPoolSearchCache(ctx, "pools:v2:search:def"); err != nil || page != nil {
+		t.Errorf("Expected the search page retired, got %+v (%v)", page, err)
+	}
+	if stats, _ := repo.GetStatsCache(ctx, models.StatsSourcePostgres); stats != nil || mr.Exists(PrefixChains+":v2::123") {
+		t.Error("Expected the stats and chain pages deleted")
+	}
+
+	// Lists cached after the update are served again
+	repo.SetPoolsCache(ctx, "pools:v2:all:abc", &models.PoolListResponse{Total: 2}, 30)
+	if list, _ := repo.GetPoolsCache(ctx, "pools:v2:all:abc"); list == nil || list.Total != 2 {
+		t.Errorf("Expected the new list served, got %+v", list)
+	}
+}
+
+func TestApplyIngestionCacheUpdate_Fails(t *testing.T) {
+	repo, mr := newTestRepository(t)
+	ctx := context.Background()
+
+	// INCR fails inside the transaction on a generation that isn't a number
+	mr.Set(KeyPoolsGeneration, "corrupt")
+	update := IngestionCacheUpdate{Pools: []models.Pool{{ID: "pool-1"}}, PoolTTL: time.Minute, PoolLists: true}
+	if err := repo.ApplyIngestionCacheUpdate(ctx, update); err == nil {
+		t.Error("Expected the failing command reported")
+	}
+
+	mr.Close()
+	if err := repo.ApplyIngestionCacheUpdate(ctx, update); err == nil {
+		t.Error("Expected an error with Redis down")
+	}
+}
+
+func TestBreaker_SkipsCallsWhileRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	repo, err := NewRepository(context.Background(), config.RedisConfig{
+		Host:             mr.Host(),
+		Port:             mr.Port(),
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	ctx := context.Background()
+
+	mr.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := repo.GetPool(ctx, "pool-1"); err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Call %d: expected a connection error, got %v", i+1, err)
+		}
+	}
+	if repo.BreakerState() != breaker.StateOpen {
+		t.Fatalf("Expected the breaker open, got %s", repo.BreakerState())
+	}
+
+	// Calls are skipped, pipelines included, and counted
+	if _, err := repo.GetPool(ctx, "pool-1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+	if err := repo.SetMultiplePools(ctx, []models.Pool{{ID: "pool-1"}}, 60); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable from a pipeline, got %v", err)
+	}
+	if got := repo.UnavailableCount(); got != 2 {
+		t.Errorf("Expected 2 skipped calls, got %d", got)
+	}
+
+	// A health check ping that reaches Redis again resumes calls
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("Expected the ping to bypass the breaker, got %v", err)
+	}
+	if repo.BreakerState() != breaker.StateClosed {
+		t.Fatalf("Expected the breaker closed, got %s", repo.BreakerState())
+	}
+	if err := repo.SetPool(ctx, &models.Pool{ID: "pool-1"}, 60); err != nil {
+		t.Errorf("Expected calls to resume, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Conservative bridge costs assumed for a cross-chain move over a route
+// without a configured entry, see BridgeRoute
+const (
+	UnknownBridgeFlatFeeUSD = 10.0
+	UnknownBridgeFeePercent = 0.1
+	UnknownBridgeDelayHours = 24.0
+)
+
+// BridgeRoute is the cost of bridging from one chain to another: a flat fee,
+// a fee as a percentage of the amount bridged, and the typical time until
+// the funds arrive. Routes are directional.
+type BridgeRoute struct {
+	SourceChain string  `json:"sourceChain" yaml:"sourceChain"`
+	TargetChain string  `json:"targetChain" yaml:"targetChain"`
+	FlatFeeUSD  float64 `json:"flatFeeUsd" yaml:"flatFeeUsd"`
+	FeePercent  float64 `json:"feePercent" yaml:"feePercent"`
+	DelayHours  float64 `json:"delayHours" yaml:"delayHours"`
+}
+
+// validate checks a configured route
+func (r BridgeRoute) validate() error {
+	switch {
+	case r.SourceChain == "" || r.TargetChain == "":
+		return errors.New("source and target chain are required")
+	case strings.EqualFold(r.SourceChain, r.TargetChain):
+		return errors.New("source and target chain are the same")
+	case r.FlatFeeUSD < 0 || r.FeePercent < 0 || r.DelayHours < 0:
+		return errors.New("fees and delay must be non-negative")
+	case r.FeePercent >= 100:
+		return errors.New("fee percent must be below 100")
+	}
+	return nil
+}
+
+// fee returns the fee in USD for bridging positionUSD
+func (r BridgeRoute) fee(positionUSD float64) float64 {
+	return r.FlatFeeUSD + positionUSD*r.FeePercent/100
+}
+
+// routeKey identifies a directional route by lowercase chain names
+type routeKey struct {
+	source, target string
+}
+
+func newRouteKey(source, target string) routeKey {
+	return routeKey{source: strings.ToLower(source), target: strings.ToLower(target)}
+}
+
+// bridgeRoute returns the configured route from sourceChain to targetChain,
+// or the conservative default and false if there is none
+func (s *Service) bridgeRoute(sourceChain, targetChain string) (BridgeRoute, bool) {
+	s.mu.RLock()
+	route, ok := s.chains.bridgeRoutes[newRouteKey(sourceChain, targetChain)]
+	s.mu.RUnlock()
+
+	if !ok {
+		return BridgeRoute{
+			SourceChain: sourceChain,
+			TargetChain: targetChain,
+			FlatFeeUSD:  UnknownBridgeFlatFeeUSD,
+			FeePercent:  UnknownBridgeFeePercent,
+			DelayHours:  UnknownBridgeDelayHours,
+		}, false
+	}
+	return route, true
+}
+
+// bridgeCost describes the route a cost estimate assumed
+func bridgeCost(sourceChain, targetChain string, route BridgeRoute, known bool) *models.BridgeCost {
+	return &models.BridgeCost{
+		SourceChain:  strings.ToLower(sourceChain),
+		TargetChain:  strings.ToLower(targetChain),
+		FlatFeeUSD:   decimal.NewFromFloat(route.FlatFeeUSD).Round(2),
+		FeePercent:   decimal.NewFromFloat(route.FeePercent),
+		DelayHours:   decimal.NewFromFloat(route.DelayHours),
+		DefaultRoute: !known,
+	}
+}
@@ -0,0 +1,221 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// ChainOverrides holds per-chain values that replace the built-in defaults.
+// Chains not listed keep their default rating and gas cost.
+type ChainOverrides struct {
+	SecurityRatings map[string]float64 `json:"securityRatings" yaml:"securityRatings"`
+	GasCosts        map[string]float64 `json:"gasCosts" yaml:"gasCosts"`
+	NeedsReview     []string           `json:"needsReview" yaml:"needsReview"`   // Chains whose pools are never rated low risk
+	BridgeRoutes    []BridgeRoute      `json:"bridgeRoutes" yaml:"bridgeRoutes"` // Bridge costs per source and target chain
+}
+
+// Conservative defaults registered for a chain seen without a security
+// rating, until an operator reviews it. The rating is below the low-risk
+// threshold used by CalculateRiskLevel.
+const (
+	UnknownChainSecurityRating = 40.0
+	UnknownChainGasCostUSD     = 10.0
+)
+
+// ChainOverrideSource provides chain overrides from a persistent store
+type ChainOverrideSource interface {
+	GetChainOverrides(ctx context.Context) ([]models.ChainOverride, error)
+}
+
+// chainParams holds the effective per-chain ratings and gas costs
+type chainParams struct {
+	securityRatings map[string]float64
+	gasCosts        map[string]float64
+	needsReview     map[string]bool
+	bridgeRoutes    map[routeKey]BridgeRoute
+}
+
+// mergeChainParams builds chain parameters from the defaults with the given
+// overrides applied on top. Out-of-range values are skipped.
+func mergeChainParams(overrides ChainOverrides) chainParams {
+	params := chainParams{
+		securityRatings: make(map[string]float64, len(defaultChainSecurityRatings)),
+		gasCosts:        make(map[string]float64, len(defaultGasCosts)),
+		needsReview:     make(map[string]bool, len(overrides.NeedsReview)),
+		bridgeRoutes:    make(map[routeKey]BridgeRoute, len(overrides.BridgeRoutes)),
+	}
+
+	for chain, rating := range defaultChainSecurityRatings {
+		params.securityRatings[chain] = rating
+	}
+	for chain, cost := range defaultGasCosts {
+		params.gasCosts[chain] = cost
+	}
+
+	for chain, rating := range overrides.SecurityRatings {
+		if rating < 0 || rating > 100 {
+			log.Warn().Str("chain", chain).Float64("rating", rating).Msg("Ignoring chain security rating outside 0-100")
+			continue
+		}
+		params.securityRatings[strings.ToLower(chain)] = rating
+	}
+	for chain, cost := range overrides.GasCosts {
+		if cost < 0 {
+			log.Warn().Str("chain", chain).Float64("gas_cost", cost).Msg("Ignoring negative chain gas cost")
+			continue
+		}
+		params.gasCosts[strings.ToLower(chain)] = cost
+	}
+	for _, chain := range overrides.NeedsReview {
+		params.needsReview[strings.ToLower(chain)] = true
+	}
+	for _, route := range overrides.BridgeRoutes {
+		if err := route.validate(); err != nil {
+			log.Warn().Str("source", route.SourceChain).Str("target", route.TargetChain).Err(err).Msg("Ignoring bridge route")
+			continue
+		}
+		params.bridgeRoutes[newRouteKey(route.SourceChain, route.TargetChain)] = route
+	}
+
+	return params
+}
+
+// ApplyChainOverrides replaces the effective chain ratings, gas costs and
+// bridge routes with the defaults merged with the given overrides. Overrides
+// from a previous call are discarded, so removing an entry reverts the chain
+// to its default.
+func (s *Service) ApplyChainOverrides(overrides ChainOverrides) {
+	params := mergeChainParams(overrides)
+
+	s.mu.Lock()
+	s.chains = params
+	s.mu.Unlock()
+}
+
+// chainSecurityRating returns the effective security rating for a chain.
+// Chain names are matched case-insensitively.
+func (s *Service) chainSecurityRating(chain string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rating, ok := s.chains.securityRatings[strings.ToLower(chain)]
+	return rating, ok
+}
+
+// ChainNeedsReview reports whether a chain has no security rating or is
+// flagged for operator review
+func (s *Service) ChainNeedsReview(chain string) bool {
+	chain = strings.ToLower(chain)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, rated := s.chains.securityRatings[chain]
+	return !rated || s.chains.needsReview[chain]
+}
+
+// MarkChainsForReview flags chains for review. Chains without a rating get
+// the conservative defaults until overrides are next applied.
+func (s *Service) MarkChainsForReview(chains []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, chain := range chains {
+		chain = strings.ToLower(chain)
+		s.chains.needsReview[chain] = true
+		if _, ok := s.chains.securityRatings[chain]; !ok {
+			s.chains.securityRatings[chain] = UnknownChainSecurityRating
+		}
+		if _, ok := s.chains.gasCosts[chain]; !ok {
+			s.chains.gasCosts[chain] = UnknownChainGasCostUSD
+		}
+	}
+}
+
+// LoadChainOverridesFile reads chain overrides from a JSON or YAML file.
+// The format is chosen from the file extension.
+func LoadChainOverridesFile(path string) (ChainOverrides, error) {
+	var overrides ChainOverrides
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return overrides, fmt.Errorf("failed to read chain overrides file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &overrides)
+	case ".json":
+		err = json.Unmarshal(data, &overrides)
+	default:
+		return overrides, fmt.Errorf("unsupported chain overrides file type: %s", path)
+	}
+	if err != nil {
+		return overrides, fmt.Errorf("failed to parse chain overrides file: %w", err)
+	}
+
+	return overrides, nil
+}
+
+// LoadChainOverrides collects overrides from the file at path and from source,
+// either of which may be empty/nil. Source values take precedence over the file.
+func LoadChainOverrides(ctx context.Context, path string, source ChainOverrideSource) (ChainOverrides, error) {
+	overrides := ChainOverrides{
+		SecurityRatings: make(map[string]float64),
+		GasCosts:        make(map[string]float64),
+	}
+
+	var layers []ChainOverrides
+	if path != "" {
+		fromFile, err := LoadChainOverridesFile(path)
+		if err != nil {
+			return overrides, err
+		}
+		layers = append(layers, fromFile)
+	}
+	if source != nil {
+		rows, err := source.GetChainOverrides(ctx)
+		if err != nil {
+			return overrides, fmt.Errorf("failed to load chain overrides: %w", err)
+		}
+
+		fromSource := ChainOverrides{
+			SecurityRatings: make(map[string]float64),
+			GasCosts:        make(map[string]float64),
+		}
+		for _, row := range rows {
+			if row.SecurityRating != nil {
+				fromSource.SecurityRatings[row.Chain] = *row.SecurityRating
+			}
+			if row.GasCostUSD != nil {
+				fromSource.GasCosts[row.Chain] = *row.GasCostUSD
+			}
+			if row.NeedsReview {
+				fromSource.NeedsReview = append(fromSource.NeedsReview, row.Chain)
+			}
+		}
+		layers = append(layers, fromSource)
+	}
+
+	for _, layer := range layers {
+		for chain, rating := range layer.SecurityRatings {
+			overrides.SecurityRatings[chain] = rating
+		}
+		for chain, cost := range layer.GasCosts {
+			overrides.GasCosts[chain] = cost
+		}
+		overrides.NeedsReview = append(overrides.NeedsReview, layer.NeedsReview...)
+		overrides.BridgeRoutes = append(overrides.BridgeRoutes, layer.BridgeRoutes...)
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+type fakeChainOverrideSource struct {
+	rows []models.ChainOverride
+}
+
+func (f fakeChainOverrideSource) GetChainOverrides(ctx context.Context) ([]models.ChainOverride, error) {
+	return f.rows, nil
+}
+
+func TestApplyChainOverrides(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+
+	service.ApplyChainOverrides(ChainOverrides{
+		SecurityRatings: map[string]float64{"Harmony": 90, "ethereum": 150},
+		GasCosts:        map[string]float64{"ethereum": 5, "newchain": 0.2, "polygon": -1},
+	})
+
+	if rating, _ := service.chainSecurityRating("harmony"); rating != 90 {
+		t.Errorf("Expected overridden harmony rating 90, got %v", rating)
+	}
+	if rating, _ := service.chainSecurityRating("ethereum"); rating != 95 {
+		t.Errorf("Expected out-of-range override to keep default 95, got %v", rating)
+	}
+	if cost := service.estimateGasCost("ethereum"); cost != 5 {
+		t.Errorf("Expected overridden ethereum gas cost 5, got %v", cost)
+	}
+	if cost := service.estimateGasCost("newchain"); cost != 0.2 {
+		t.Errorf("Expected new chain gas cost 0.2, got %v", cost)
+	}
+	if cost := service.estimateGasCost("polygon"); cost != 0.1 {
+		t.Errorf("Expected negative override to keep default 0.1, got %v", cost)
+	}
+
+	// Reloading without the override reverts to the default
+	service.ApplyChainOverrides(ChainOverrides{})
+	if rating, _ := service.chainSecurityRating("harmony"); rating != 50 {
+		t.Errorf("Expected harmony rating to revert to 50, got %v", rating)
+	}
+	if cost := service.estimateGasCost("newchain"); cost != 10 {
+		t.Errorf("Expected unknown chain gas cost 10, got %v", cost)
+	}
+}
+
+func TestLoadChainOverridesFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"overrides.json": `{"securityRatings": {"base": 88}, "gasCosts": {"base": 0.05},
+			"bridgeRoutes": [{"sourceChain": "polygon", "targetChain": "base", "flatFeeUsd": 2, "feePercent": 0.05, "delayHours": 12}]}`,
+		"overrides.yaml": "securityRatings:\n  base: 88\ngasCosts:\n  base: 0.05\n" +
+			"bridgeRoutes:\n  - sourceChain: polygon\n    targetChain: base\n    flatFeeUsd: 2\n    feePercent: 0.05\n    delayHours: 12\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			overrides, err := LoadChainOverridesFile(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if overrides.SecurityRatings["base"] != 88 || overrides.GasCosts["base"] != 0.05 {
+				t.Errorf("Unexpected overrides: %+v", overrides)
+			}
+			want := BridgeRoute{SourceChain: "polygon", TargetChain: "base", FlatFeeUSD: 2, FeePercent: 0.05, DelayHours: 12}
+			if len(overrides.BridgeRoutes) != 1 || overrides.BridgeRoutes[0] != want {
+				t.Errorf("Expected bridge route %+v, got %+v", want, overrides.BridgeRoutes)
+			}
+		})
+	}
+
+	if _, err := LoadChainOverridesFile(filepath.Join(dir, "overrides.txt")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestLoadChainOverrides_SourceTakesPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	content := `{"securityRatings": {"base": 88, "fantom": 60}, "gasCosts": {"base": 0.05}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	rating := 92.0
+	source := fakeChainOverrideSource{rows: []models.ChainOverride{
+		{Chain: "base", SecurityRating: &rating},
+	}}
+
+	overrides, err := LoadChainOverrides(context.Background(), path, source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if overrides.SecurityRatings["base"] != 92 {
+		t.Errorf("Expected database rating 92 for base, got %v", overrides.SecurityRatings["base"])
+	}
+	if overrides.SecurityRatings["fantom"] != 60 {
+		t.Errorf("Expected file rating 60 for fantom, got %v", overrides.SecurityRatings["fantom"])
+	}
+	if overrides.GasCosts["base"] != 0.05 {
+		t.Errorf("Expected file gas cost 0.05 for base, got %v", overrides.GasCosts["base"])
+	}
+}
+
+func TestChainNeedsReview(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+
+	if service.ChainNeedsReview("Ethereum") {
+		t.Error("Expected a rated chain not to need review, regardless of case")
+	}
+	if !service.ChainNeedsReview("scroll") {
+		t.Error("Expected an unrated chain to need review")
+	}
+
+	// A reviewed rating still needs review while the flag is set, and such
+	// pools are never rated low risk
+	service.ApplyChainOverrides(ChainOverrides{
+		SecurityRatings: map[string]float64{"scroll": 85},
+		NeedsReview:     []string{"Scroll"},
+	})
+	if !service.ChainNeedsReview("scroll") {
+		t.Error("Expected flagged chain to need review")
+	}
+
+	pool := &models.Pool{
+		Chain: "scroll",
+		APY:   decimal.NewFromFloat(5),
+		TVL:   decimal.NewFromFloat(500000000),
+		Score: decimal.NewFromFloat(90),
+	}
+	if level := service.CalculateRiskLevel(pool); level != models.RiskLevelMedium {
+		t.Errorf("Expected medium risk on a flagged chain, got %s", level)
+	}
+
+	pool.Chain = "arbitrum"
+	if level := service.CalculateRiskLevel(pool); level != models.RiskLevelLow {
+		t.Errorf("Expected low risk on a reviewed chain, got %s", level)
+	}
+}
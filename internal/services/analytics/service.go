@@ -4,6 +4,8 @@ package analytics
 
 import (
 	"math"
+	"strings"
+	"sync"
 
 	"github.com/shopspring/decimal"
 
@@ -11,9 +13,10 @@ import (
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
 
-// Chain security ratings (0-100)
+// Default chain security ratings (0-100)
 // Higher = more secure/established
-var chainSecurityRatings = map[string]float64{
+// Overrides can be loaded at runtime, see ApplyChainOverrides
+var defaultChainSecurityRatings = map[string]float64{
 	"ethereum":   95,
 	"bsc":        75,
 	"polygon":    80,
@@ -35,14 +38,57 @@ var chainSecurityRatings = map[string]float64{
 	"solana":     75,
 }
 
+// Default gas cost estimates in USD for a deposit or withdrawal on a chain
+// These would ideally be fetched from a gas oracle
+var defaultGasCosts = map[string]float64{
+	"ethereum":  50.0, // High gas
+	"arbitrum":  1.0,
+	"optimism":  1.0,
+	"polygon":   0.1,
+	"bsc":       0.5,
+	"avalanche": 0.5,
+	"fantom":    0.1,
+	"base":      0.5,
+	"gnosis":    0.1,
+}
+
 // Service provides analytics and scoring functionality
 type Service struct {
+	// mu guards weights and chains, which can be swapped at runtime by
+	// SetWeights and ApplyChainOverrides while scores are being calculated
+	mu      sync.RWMutex
 	weights config.ScoringConfig
+	chains  chainParams
 }
 
 // NewService creates a new analytics service
 func NewService(weights config.ScoringConfig) *Service {
-	return &Service{weights: weights}
+	return &Service{
+		weights: weights,
+		chains:  mergeChainParams(ChainOverrides{}),
+	}
+}
+
+// Weights returns the scoring weights currently in use
+func (s *Service) Weights() config.ScoringConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.weights
+}
+
+// SetWeights validates and atomically replaces the scoring weights. Invalid
+// weights are rejected and the current ones are kept.
+func (s *Service) SetWeights(weights config.ScoringConfig) error {
+	if err := weights.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.weights = weights
+	s.mu.Unlock()
+
+	return nil
 }
 
 // CalculateScore computes a risk-adjusted opportunity score for a pool
@@ -58,16 +104,22 @@ func NewService(weights config.ScoringConfig) *Service {
 //	(tvl_weight * normalized_tvl) +
 //	(stability_weight * (1 - volatility)) +
 //	(trend_weight * normalized_trend)
+//
+// The result is scaled by the chain security multiplier and reduced for pools
+// with incomplete data (see models.CalculateDataCompleteness).
 func (s *Service) CalculateScore(pool *models.Pool) decimal.Decimal {
-	// Normalize APY (0-1 scale, capped at 100%)
+	weights := s.Weights()
+	tvlMin, tvlMax, apyMax := normalizationBounds(weights)
+
+	// Normalize APY (0-1 scale, capped at the configured maximum)
 	// Uses logarithmic scaling for APY since it can vary widely
 	apy, _ := pool.APY.Float64()
-	normalizedAPY := normalizeAPY(apy)
+	normalizedAPY := normalizeAPY(apy, apyMax)
 
 	// Normalize TVL (0-1 scale, using logarithmic scaling)
 	// Higher TVL = safer (more liquidity, harder to manipulate)
 	tvl, _ := pool.TVL.Float64()
-	normalizedTVL := normalizeTVL(tvl)
+	normalizedTVL := normalizeTVL(tvl, tvlMin, tvlMax)
 
 	// Calculate stability score (0-1, higher = more stable)
 	// Based on APY volatility over 30 days
@@ -78,56 +130,91 @@ func (s *Service) CalculateScore(pool *models.Pool) decimal.Decimal {
 	change24h, _ := pool.APYChange24H.Float64()
 	normalizedTrend := normalizeTrend(change24h)
 
+	// Normalize volume/TVL ratio (0-1, more trading activity = higher score)
+	volumeRatio, _ := models.CalculateVolumeTVLRatio(pool.VolumeUSD1D, pool.TVL).Float64()
+	normalizedVolume := normalizeVolumeRatio(volumeRatio)
+
 	// Apply chain security multiplier
-	chainMultiplier := getChainSecurityMultiplier(pool.Chain)
+	chainMultiplier := s.chainSecurityMultiplier(pool.Chain)
 
 	// Calculate weighted score
-	score := (s.weights.APYWeight * normalizedAPY) +
-		(s.weights.TVLWeight * normalizedTVL) +
-		(s.weights.StabilityWeight * stability) +
-		(s.weights.TrendWeight * normalizedTrend)
+	score := (weights.APYWeight * normalizedAPY) +
+		(weights.TVLWeight * normalizedTVL) +
+		(weights.StabilityWeight * stability) +
+		(weights.TrendWeight * normalizedTrend) +
+		(weights.VolumeWeight * normalizedVolume)
 
 	// Apply chain security multiplier
 	score *= chainMultiplier
 
+	// Down-weight pools missing data: their stability and volume terms are
+	// guesses, so the score is less trustworthy
+	completeness, _ := models.CalculateDataCompleteness(pool).Float64()
+	score *= 1 - weights.CompletenessPenalty*(1-completeness)
+
 	// Scale to 0-100
 	score *= 100
 
+	// decimal.NewFromFloat panics on NaN and infinities; a score that isn't
+	// a number is worth nothing
+	if !isFinite(score) {
+		return decimal.Zero
+	}
 	return decimal.NewFromFloat(math.Max(0, math.Min(100, score)))
 }
 
+// normalizationBounds returns the TVL and APY normalization bounds from the
+// scoring config, falling back to the defaults for unset values
+func normalizationBounds(cfg config.ScoringConfig) (tvlMin, tvlMax, apyMax float64) {
+	tvlMin, tvlMax, apyMax = cfg.TVLNormMin, cfg.TVLNormMax, cfg.APYNormMax
+	if tvlMin <= 0 {
+		tvlMin = config.DefaultTVLNormMin
+	}
+	if tvlMax <= tvlMin {
+		tvlMax = math.Max(config.DefaultTVLNormMax, tvlMin*10)
+	}
+	if apyMax <= 0 {
+		apyMax = config.DefaultAPYNormMax
+	}
+	return tvlMin, tvlMax, apyMax
+}
+
 // normalizeAPY converts APY to a 0-1 scale using logarithmic scaling
 // This handles the wide range of APYs (0.1% to 1000%+)
-func normalizeAPY(apy float64) float64 {
-	if apy <= 0 {
+func normalizeAPY(apy, maxAPY float64) float64 {
+	if math.IsNaN(apy) || apy <= 0 {
 		return 0
 	}
+	if math.IsInf(apy, 1) {
+		return 1
+	}
 
 	// Use log scaling: score increases logarithmically with APY
-	// 1% APY -> ~0.25, 10% APY -> ~0.5, 100% APY -> ~0.75, 1000% APY -> ~1.0
+	// With the default 10000% cap:
+	// 1% APY -> ~0.08, 10% APY -> ~0.26, 100% APY -> ~0.5, 1000% APY -> ~0.75
 	logAPY := math.Log10(apy + 1)
 
-	// Normalize to 0-1 range (assuming max reasonable APY is 10000%)
-	maxLogAPY := math.Log10(10001)
+	// Normalize to 0-1 range (maxAPY is the highest APY worth distinguishing)
+	maxLogAPY := math.Log10(maxAPY + 1)
 	normalized := logAPY / maxLogAPY
 
 	return math.Min(1, normalized)
 }
 
 // normalizeTVL converts TVL to a 0-1 scale using logarithmic scaling
-func normalizeTVL(tvl float64) float64 {
+func normalizeTVL(tvl, minTVL, maxTVL float64) float64 {
 	if tvl <= 0 {
 		return 0
 	}
 
 	// Use log scaling
-	// $100K TVL -> ~0.4, $1M TVL -> ~0.5, $10M TVL -> ~0.6, $100M TVL -> ~0.7, $1B TVL -> ~0.8
+	// With the default $1K-$10B range:
+	// $100K TVL -> ~0.29, $1M TVL -> ~0.43, $100M TVL -> ~0.71, $1B TVL -> ~0.86
 	logTVL := math.Log10(tvl)
 
-	// Normalize: $1K (3) to $10B (10)
-	// Map log values 3-10 to 0-1
-	minLog := 3.0  // $1,000
-	maxLog := 10.0 // $10,000,000,000
+	// Map log values of the range bounds to 0-1
+	minLog := math.Log10(minTVL)
+	maxLog := math.Log10(maxTVL)
 
 	normalized := (logTVL - minLog) / (maxLog - minLog)
 
@@ -137,7 +224,7 @@ func normalizeTVL(tvl float64) float64 {
 // calculateStability calculates how stable the APY has been
 // Lower deviation from mean = higher stability score
 func calculateStability(currentAPY, meanAPY float64) float64 {
-	if meanAPY <= 0 {
+	if !isFinite(currentAPY) || !isFinite(meanAPY) || meanAPY <= 0 {
 		return 0.5 // Unknown stability, return neutral
 	}
 
@@ -153,6 +240,10 @@ func calculateStability(currentAPY, meanAPY float64) float64 {
 
 // normalizeTrend converts APY change percentage to a 0-1 score
 func normalizeTrend(change24h float64) float64 {
+	if math.IsNaN(change24h) {
+		return 0.5 // Unknown trend, return neutral
+	}
+
 	// Positive change = higher score, negative = lower
 	// Cap at +/- 100% change
 	change := math.Max(-100, math.Min(100, change24h))
@@ -163,9 +254,27 @@ func normalizeTrend(change24h float64) float64 {
 	return normalized
 }
 
-// getChainSecurityMultiplier returns a multiplier based on chain security
-func getChainSecurityMultiplier(chain string) float64 {
-	rating, ok := chainSecurityRatings[chain]
+// isFinite reports whether f is neither NaN nor infinite
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// volumeRatioSaturation is the 24h volume / TVL ratio that earns a full volume score
+const volumeRatioSaturation = 0.5
+
+// normalizeVolumeRatio converts a 24h volume / TVL ratio to a 0-1 scale
+// Pools turning over half their TVL daily or more get the maximum
+func normalizeVolumeRatio(ratio float64) float64 {
+	if ratio <= 0 {
+		return 0
+	}
+
+	return math.Min(1, ratio/volumeRatioSaturation)
+}
+
+// chainSecurityMultiplier returns a multiplier based on chain security
+func (s *Service) chainSecurityMultiplier(chain string) float64 {
+	rating, ok := s.chainSecurityRating(chain)
 	if !ok {
 		rating = 50 // Unknown chain gets neutral rating
 	}
@@ -175,63 +284,147 @@ func getChainSecurityMultiplier(chain string) float64 {
 	return 0.5 + (rating / 200)
 }
 
+// Yield-gap cost model parameters
+const (
+	// yieldGapPositionUSD is the position size used for profit and cost estimates
+	yieldGapPositionUSD = 10000.0
+
+	// yieldGapHorizonDays is the period profit is estimated over
+	yieldGapHorizonDays = 30.0
+
+	// maxSlippageRate caps the slippage estimate as a fraction of the position
+	maxSlippageRate = 0.01
+)
+
+// CalculateYieldGapCosts estimates the cost of moving a position from a pool on
+// sourceChain to a pool on targetChain. The breakdown covers withdraw gas on the
+// source chain, a bridge fee when the chains differ, deposit gas on the target
+// chain and a slippage estimate based on the position's share of target TVL.
+// The bridge fee comes from the configured route, or the conservative
+// default for routes without one (flagged in BridgeCost).
+func (s *Service) CalculateYieldGapCosts(
+	sourceChain, targetChain string,
+	positionUSD float64,
+	targetTVL float64,
+) models.OpportunityCosts {
+	withdrawGas := s.estimateGasCost(sourceChain)
+	depositGas := s.estimateGasCost(targetChain)
+
+	crossChain := !strings.EqualFold(sourceChain, targetChain)
+	bridgeFee := 0.0
+	var bridge *models.BridgeCost
+	if crossChain {
+		route, known := s.bridgeRoute(sourceChain, targetChain)
+		bridgeFee = route.fee(positionUSD)
+		bridge = bridgeCost(sourceChain, targetChain, route, known)
+	}
+
+	// Approximate price impact as the position's share of target TVL
+	slippage := 0.0
+	if targetTVL > 0 {
+		slippage = positionUSD * math.Min(maxSlippageRate, positionUSD/targetTVL)
+	}
+
+	total := withdrawGas + bridgeFee + depositGas + slippage
+
+	return models.OpportunityCosts{
+		PositionSizeUSD: decimal.NewFromFloat(positionUSD),
+		WithdrawGasUSD:  decimal.NewFromFloat(withdrawGas).Round(2),
+		BridgeFeeUSD:    decimal.NewFromFloat(bridgeFee).Round(2),
+		DepositGasUSD:   decimal.NewFromFloat(depositGas).Round(2),
+		SlippageUSD:     decimal.NewFromFloat(slippage).Round(2),
+		TotalUSD:        decimal.NewFromFloat(total).Round(2),
+		CrossChain:      crossChain,
+		BridgeCost:      bridge,
+	}
+}
+
 // CalculateYieldGapProfit calculates potential profit from yield gap arbitrage
 // This considers:
 // - APY difference
-// - Gas costs (estimated based on chain)
+// - Costs of moving the position (see CalculateYieldGapCosts)
+// - The bridge delay, during which the position earns nothing
 // - Minimum investment period to be profitable
 func (s *Service) CalculateYieldGapProfit(
 	lowAPY, highAPY float64,
 	tvl float64,
 	sourceChain, targetChain string,
-) (profit float64, minDays int) {
+) (profit float64, minDays int, costs models.OpportunityCosts) {
 	apyDiff := highAPY - lowAPY
 
 	if apyDiff <= 0 {
-		return 0, 0
+		return 0, 0, costs
 	}
 
-	// Estimate gas costs (simplified)
-	gasCostUSD := estimateGasCost(sourceChain) + estimateGasCost(targetChain)
+	costs = s.CalculateYieldGapCosts(sourceChain, targetChain, yieldGapPositionUSD, tvl)
+	totalCostUSD, _ := costs.TotalUSD.Float64()
+
+	// Fixed costs don't scale with position size; slippage and percentage
+	// bridge fees do
+	fixed := costs.WithdrawGasUSD.Add(costs.DepositGasUSD)
+	delayDays := 0.0
+	if costs.BridgeCost != nil {
+		fixed = fixed.Add(costs.BridgeCost.FlatFeeUSD)
+		delayHours, _ := costs.BridgeCost.DelayHours.Float64()
+		delayDays = delayHours / 24
+	}
+	fixedCostUSD, _ := fixed.Float64()
 
-	// Calculate minimum investment to cover gas costs in 7 days
-	// profit = (investment * apyDiff/100 / 365 * days) - gasCost
-	// To break even in 7 days: investment = gasCost * 365 / (apyDiff * 7)
+	// Calculate minimum investment to cover fixed costs in 7 days
+	// profit = (investment * apyDiff/100 / 365 * days) - cost
+	// To break even in 7 days: investment = cost * 365 / (apyDiff * 7)
+	minInvestment := fixedCostUSD * 365 / (apyDiff * 7)
+	minDays = int(math.Ceil(totalCostUSD*365/(apyDiff*yieldGapPositionUSD/100) + delayDays))
 
-	if apyDiff > 0 {
-		minInvestment := gasCostUSD * 365 / (apyDiff * 7)
-		minDays = int(math.Ceil(gasCostUSD * 365 / (apyDiff * 10000)))
+	// Calculate profit assuming a $10,000 position over 30 days, less the
+	// days spent bridging
+	profit = yieldGapProfitOver(yieldGapHorizonDays, apyDiff, totalCostUSD, delayDays)
 
-		// Calculate profit assuming $10,000 investment over 30 days
-		investmentAmount := 10000.0
-		profit = (investmentAmount * apyDiff / 100 / 365 * 30) - gasCostUSD
+	// If can't break even in 30 days with $10K, not a good opportunity
+	if profit < 0 || minInvestment > 100000 {
+		return 0, 0, costs
+	}
 
-		// If can't break even in 30 days with $10K, not a good opportunity
-		if profit < 0 || minInvestment > 100000 {
-			return 0, 0
-		}
+	return profit, minDays, costs
+}
+
+// CalculateProfitByHorizon estimates the profit of a yield gap if the
+// position is held for each of horizons days, with the costs from
+// CalculateYieldGapProfit. The costs are paid once, so short horizons may
+// lose money while long ones amortise them.
+func (s *Service) CalculateProfitByHorizon(apyDiff float64, costs models.OpportunityCosts, horizons []int) []models.HorizonProfit {
+	if len(horizons) == 0 || apyDiff <= 0 {
+		return nil
+	}
+
+	totalCostUSD, _ := costs.TotalUSD.Float64()
+	delayDays := 0.0
+	if costs.BridgeCost != nil {
+		delayHours, _ := costs.BridgeCost.DelayHours.Float64()
+		delayDays = delayHours / 24
 	}
 
-	return profit, minDays
+	profits := make([]models.HorizonProfit, len(horizons))
+	for i, days := range horizons {
+		profit := yieldGapProfitOver(float64(days), apyDiff, totalCostUSD, delayDays)
+		profits[i] = models.HorizonProfit{Days: days, ProfitUSD: decimal.NewFromFloat(profit).Round(2)}
+	}
+	return profits
+}
+
+// yieldGapProfitOver returns the profit of the yield gap position held for
+// days: the APY difference earned outside the bridge delay, less the costs
+func yieldGapProfitOver(days, apyDiff, totalCostUSD, delayDays float64) float64 {
+	earningDays := math.Max(0, days-delayDays)
+	return yieldGapPositionUSD*apyDiff/100/365*earningDays - totalCostUSD
 }
 
 // estimateGasCost returns estimated gas cost in USD for transactions on a chain
-func estimateGasCost(chain string) float64 {
-	// Simplified gas cost estimates (in USD)
-	// These would ideally be fetched from a gas oracle
-	gasCosts := map[string]float64{
-		"ethereum":  50.0, // High gas
-		"arbitrum":  1.0,
-		"optimism":  1.0,
-		"polygon":   0.1,
-		"bsc":       0.5,
-		"avalanche": 0.5,
-		"fantom":    0.1,
-		"base":      0.5,
-		"gnosis":    0.1,
-	}
-
-	cost, ok := gasCosts[chain]
+func (s *Service) estimateGasCost(chain string) float64 {
+	s.mu.RLock()
+	cost, ok := s.chains.gasCosts[strings.ToLower(chain)]
+	s.mu.RUnlock()
+
 	if !ok {
 		return 10.0 // Default estimate for unknown chains
 	}
@@ -239,50 +432,88 @@ func estimateGasCost(chain string) float64 {
 	return cost
 }
 
+// adjustableRewardAPYThreshold is the reward APY (%) above which emissions
+// curated as adjustable at will count as a risk indicator
+const adjustableRewardAPYThreshold = 20.0
+
 // CalculateRiskLevel determines the risk level of a pool
 func (s *Service) CalculateRiskLevel(pool *models.Pool) models.RiskLevel {
+	level, _ := s.AssessRisk(pool)
+	return level
+}
+
+// AssessRisk determines the risk level of a pool and returns the factors
+// behind it
+func (s *Service) AssessRisk(pool *models.Pool) (models.RiskLevel, models.RiskFactors) {
 	score, _ := pool.Score.Float64()
 	tvl, _ := pool.TVL.Float64()
 	apy, _ := pool.APY.Float64()
+	chainRating, _ := s.chainSecurityRating(pool.Chain)
+
+	factors := models.RiskFactors{
+		APY:         apy,
+		TVL:         tvl,
+		Score:       score,
+		ChainRating: chainRating,
+		Triggered:   make([]string, 0),
+	}
 
 	// High risk indicators:
 	// - Very high APY (>100%)
 	// - Low TVL (<$100K)
 	// - Low score (<30)
 	// - Unknown or low-security chain
-
-	riskFactors := 0
+	// - High reward APY on emissions curated as adjustable at will
 
 	if apy > 100 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorAPYAbove100)
 	}
 	if apy > 500 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorAPYAbove500)
 	}
 
 	if tvl < 100000 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorTVLBelow100K)
 	}
 	if tvl < 10000 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorTVLBelow10K)
 	}
 
 	if score < 30 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorScoreBelow30)
 	}
 
-	chainRating := chainSecurityRatings[pool.Chain]
 	if chainRating < 60 {
-		riskFactors++
+		factors.Triggered = append(factors.Triggered, models.RiskFactorLowChainRating)
+	}
+
+	// Rewards a multisig can switch off tomorrow are not a yield to count on
+	curation := pool.Curation
+	if curation != nil && curation.RewardSchedule == models.RewardScheduleAdjustable {
+		if apyReward, _ := pool.APYReward.Float64(); apyReward > adjustableRewardAPYThreshold {
+			factors.Triggered = append(factors.Triggered, models.RiskFactorAdjustableReward)
+		}
+	}
+
+	// Chains awaiting review are never low risk, whatever rating they were given
+	if len(factors.Triggered) == 0 && s.ChainNeedsReview(pool.Chain) {
+		factors.Triggered = append(factors.Triggered, models.RiskFactorChainNeedsReview)
+	}
+
+	// An audit is a mild positive: one more indicator is needed to rate high
+	highAt := 3
+	if curation != nil && curation.Audited {
+		factors.Audited = true
+		highAt++
 	}
 
 	switch {
-	case riskFactors >= 3:
-		return models.RiskLevelHigh
-	case riskFactors >= 1:
-		return models.RiskLevelMedium
+	case len(factors.Triggered) >= highAt:
+		return models.RiskLevelHigh, factors
+	case len(factors.Triggered) >= 1:
+		return models.RiskLevelMedium, factors
 	default:
-		return models.RiskLevelLow
+		return models.RiskLevelLow, factors
 	}
 }
 
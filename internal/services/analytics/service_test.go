@@ -1,6 +1,7 @@
 package analytics
 
 import (
+	"math"
 	"testing"
 
 	"github.com/shopspring/decimal"
@@ -49,6 +50,18 @@ func TestCalculateScore(t *testing.T) {
 			minScore: 0,
 			maxScore: 50,
 		},
+		{
+			name: "borrowing-dominated pool",
+			pool: models.Pool{
+				Chain:        "ethereum",
+				APY:          decimal.NewFromFloat(-40), // Negative APY
+				TVL:          decimal.NewFromFloat(1000000),
+				APYMean30D:   decimal.NewFromFloat(-5),
+				APYChange24H: decimal.NewFromFloat(-250),
+			},
+			minScore: 0,
+			maxScore: 50,
+		},
 	}
 
 	for _, tt := range tests {
@@ -99,6 +112,41 @@ func TestCalculateRiskLevel(t *testing.T) {
 			},
 			wantLevel: models.RiskLevelHigh,
 		},
+		{
+			name: "medium risk - high reward apy on adjustable emissions",
+			pool: models.Pool{
+				Chain:     "ethereum",
+				APY:       decimal.NewFromFloat(35),
+				APYReward: decimal.NewFromFloat(30),
+				TVL:       decimal.NewFromFloat(100000000),
+				Score:     decimal.NewFromFloat(80),
+				Curation:  &models.PoolCuration{RewardSchedule: models.RewardScheduleAdjustable},
+			},
+			wantLevel: models.RiskLevelMedium,
+		},
+		{
+			name: "low risk - high reward apy on locked emissions",
+			pool: models.Pool{
+				Chain:     "ethereum",
+				APY:       decimal.NewFromFloat(35),
+				APYReward: decimal.NewFromFloat(30),
+				TVL:       decimal.NewFromFloat(100000000),
+				Score:     decimal.NewFromFloat(80),
+				Curation:  &models.PoolCuration{RewardSchedule: models.RewardScheduleLocked},
+			},
+			wantLevel: models.RiskLevelLow,
+		},
+		{
+			name: "medium risk - audited pool with three indicators",
+			pool: models.Pool{
+				Chain:    "ethereum",
+				APY:      decimal.NewFromFloat(150),
+				TVL:      decimal.NewFromFloat(50000),
+				Score:    decimal.NewFromFloat(20),
+				Curation: &models.PoolCuration{RewardSchedule: models.RewardScheduleUnknown, Audited: true},
+			},
+			wantLevel: models.RiskLevelMedium,
+		},
 	}
 
 	for _, tt := range tests {
@@ -111,7 +159,15 @@ func TestCalculateRiskLevel(t *testing.T) {
 	}
 }
 
+// defaultNormBounds returns the normalization bounds a zero-valued scoring
+// config resolves to
+func defaultNormBounds() (tvlMin, tvlMax, apyMax float64) {
+	return normalizationBounds(config.ScoringConfig{})
+}
+
 func TestNormalizeAPY(t *testing.T) {
+	_, _, apyMax := defaultNormBounds()
+
 	tests := []struct {
 		apy      float64
 		minNorm  float64
@@ -125,7 +181,7 @@ func TestNormalizeAPY(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		norm := normalizeAPY(tt.apy)
+		norm := normalizeAPY(tt.apy, apyMax)
 		if norm < tt.minNorm || norm > tt.maxNorm {
 			t.Errorf("APY %.2f normalized to %.4f, expected [%.2f, %.2f]",
 				tt.apy, norm, tt.minNorm, tt.maxNorm)
@@ -133,7 +189,59 @@ func TestNormalizeAPY(t *testing.T) {
 	}
 }
 
+func TestNormalizeAPY_Degenerate(t *testing.T) {
+	_, _, apyMax := defaultNormBounds()
+
+	tests := []struct {
+		name string
+		apy  float64
+		want float64
+	}{
+		{"negative", -25, 0},
+		{"zero", 0, 0},
+		{"NaN", math.NaN(), 0},
+		{"negative infinity", math.Inf(-1), 0},
+		{"infinity", math.Inf(1), 1},
+		{"above the cap", 1e9, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAPY(tt.apy, apyMax); got != tt.want {
+				t.Errorf("normalizeAPY(%v) = %v, want %v", tt.apy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTrend(t *testing.T) {
+	tests := []struct {
+		name   string
+		change float64
+		want   float64
+	}{
+		{"flat", 0, 0.5},
+		{"rising", 50, 0.75},
+		{"falling", -50, 0.25},
+		{"capped rise", 1e6, 1},
+		{"capped fall", -1e6, 0},
+		{"NaN", math.NaN(), 0.5},
+		{"infinity", math.Inf(1), 1},
+		{"negative infinity", math.Inf(-1), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTrend(tt.change); got != tt.want {
+				t.Errorf("normalizeTrend(%v) = %v, want %v", tt.change, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNormalizeTVL(t *testing.T) {
+	tvlMin, tvlMax, _ := defaultNormBounds()
+
 	tests := []struct {
 		tvl      float64
 		minNorm  float64
@@ -147,7 +255,7 @@ func TestNormalizeTVL(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		norm := normalizeTVL(tt.tvl)
+		norm := normalizeTVL(tt.tvl, tvlMin, tvlMax)
 		if norm < tt.minNorm || norm > tt.maxNorm {
 			t.Errorf("TVL %.0f normalized to %.4f, expected [%.2f, %.2f]",
 				tt.tvl, norm, tt.minNorm, tt.maxNorm)
@@ -155,6 +263,37 @@ func TestNormalizeTVL(t *testing.T) {
 	}
 }
 
+func TestNormalizationBounds_FromConfig(t *testing.T) {
+	cfg := config.ScoringConfig{TVLNormMin: 10000, TVLNormMax: 1000000000, APYNormMax: 1000}
+	tvlMin, tvlMax, apyMax := normalizationBounds(cfg)
+	if tvlMin != cfg.TVLNormMin || tvlMax != cfg.TVLNormMax || apyMax != cfg.APYNormMax {
+		t.Fatalf("Expected configured bounds, got %v/%v/%v", tvlMin, tvlMax, apyMax)
+	}
+
+	// The configured bounds map to the ends of the curve
+	if norm := normalizeTVL(cfg.TVLNormMin, tvlMin, tvlMax); norm != 0 {
+		t.Errorf("Expected TVL at minimum to normalize to 0, got %.4f", norm)
+	}
+	if norm := normalizeTVL(cfg.TVLNormMax, tvlMin, tvlMax); norm != 1 {
+		t.Errorf("Expected TVL at maximum to normalize to 1, got %.4f", norm)
+	}
+	if norm := normalizeTVL(1000000*10, tvlMin, tvlMax); math.Abs(norm-0.6) > 1e-9 {
+		t.Errorf("Expected $10M TVL to normalize to 0.6, got %.4f", norm)
+	}
+	if norm := normalizeAPY(cfg.APYNormMax, apyMax); norm != 1 {
+		t.Errorf("Expected APY at cap to normalize to 1, got %.4f", norm)
+	}
+
+	// A narrower range rewards the same pool more than the defaults do
+	defMin, defMax, defAPY := defaultNormBounds()
+	if normalizeTVL(100000000, tvlMin, tvlMax) <= normalizeTVL(100000000, defMin, defMax) {
+		t.Error("Expected narrower TVL range to raise normalized TVL")
+	}
+	if normalizeAPY(100, apyMax) <= normalizeAPY(100, defAPY) {
+		t.Error("Expected lower APY cap to raise normalized APY")
+	}
+}
+
 func TestCalculateStability(t *testing.T) {
 	tests := []struct {
 		currentAPY float64
@@ -175,3 +314,312 @@ func TestCalculateStability(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculateYieldGapCosts(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+
+	tests := []struct {
+		name           string
+		sourceChain    string
+		targetChain    string
+		targetTVL      float64
+		wantCrossChain bool
+		wantBridgeFee  float64
+		wantSlippage   float64
+	}{
+		{"same chain", "arbitrum", "arbitrum", 100000000, false, 0, 1},
+		{"cross chain", "polygon", "arbitrum", 100000000, true, 20, 1},
+		{"shallow target pool caps slippage", "arbitrum", "arbitrum", 200000, false, 0, 100},
+		{"unknown tvl skips slippage", "arbitrum", "arbitrum", 0, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs := service.CalculateYieldGapCosts(tt.sourceChain, tt.targetChain, 10000, tt.targetTVL)
+
+			if costs.CrossChain != tt.wantCrossChain {
+				t.Errorf("Expected crossChain=%v, got %v", tt.wantCrossChain, costs.CrossChain)
+			}
+			if got, _ := costs.BridgeFeeUSD.Float64(); got != tt.wantBridgeFee {
+				t.Errorf("Expected bridge fee %.2f, got %.2f", tt.wantBridgeFee, got)
+			}
+			if got, _ := costs.SlippageUSD.Float64(); got != tt.wantSlippage {
+				t.Errorf("Expected slippage %.2f, got %.2f", tt.wantSlippage, got)
+			}
+
+			sum := costs.WithdrawGasUSD.Add(costs.BridgeFeeUSD).Add(costs.DepositGasUSD).Add(costs.SlippageUSD)
+			if !sum.Equal(costs.TotalUSD) {
+				t.Errorf("Expected total %s to equal sum of components %s", costs.TotalUSD, sum)
+			}
+		})
+	}
+}
+
+func TestCalculateYieldGapProfit_UsesCosts(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+
+	profit, minDays, costs := service.CalculateYieldGapProfit(2, 12, 100000000, "arbitrum", "optimism")
+	if profit <= 0 {
+		t.Fatalf("Expected a profitable gap, got profit %.2f", profit)
+	}
+
+	totalCost, _ := costs.TotalUSD.Float64()
+	delayHours, _ := costs.BridgeCost.DelayHours.Float64()
+	grossProfit := 10000.0 * 10 / 100 / 365 * (30 - delayHours/24)
+	if diff := grossProfit - totalCost - profit; diff > 0.01 || diff < -0.01 {
+		t.Errorf("Expected profit %.2f to equal gross %.2f minus costs %.2f", profit, grossProfit, totalCost)
+	}
+	if minDays < 1 || minDays > 30 {
+		t.Errorf("Expected break-even within 30 days, got %d", minDays)
+	}
+}
+
+func TestCalculateProfitByHorizon(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+
+	// $100 of gas to move within ethereum against a 2 point gap: $0.55 a day
+	costs := service.CalculateYieldGapCosts("ethereum", "ethereum", 10000, 1_000_000_000)
+	profits := service.CalculateProfitByHorizon(2, costs, []int{7, 30, 90, 365})
+
+	want := []struct {
+		days   int
+		profit string
+	}{{7, "-96.26"}, {30, "-83.66"}, {90, "-50.78"}, {365, "99.9"}}
+	if len(profits) != len(want) {
+		t.Fatalf("Expected %d horizons, got %+v", len(want), profits)
+	}
+	for i, w := range want {
+		if profits[i].Days != w.days || profits[i].ProfitUSD.String() != w.profit {
+			t.Errorf("Expected $%s over %d days, got $%s over %d", w.profit, w.days, profits[i].ProfitUSD, profits[i].Days)
+		}
+	}
+
+	if profits := service.CalculateProfitByHorizon(0, costs, []int{30}); profits != nil {
+		t.Errorf("Expected no horizons without a gap, got %+v", profits)
+	}
+}
+
+func TestCalculateYieldGapProfit_BridgeRoutes(t *testing.T) {
+	service := NewService(config.ScoringConfig{})
+	service.ApplyChainOverrides(ChainOverrides{BridgeRoutes: []BridgeRoute{
+		{SourceChain: "Polygon", TargetChain: "arbitrum", FlatFeeUSD: 2, FeePercent: 0.05, DelayHours: 12},
+		{SourceChain: "arbitrum", TargetChain: "arbitrum", FlatFeeUSD: 1}, // Same chain, ignored
+		{SourceChain: "polygon", TargetChain: "base", FlatFeeUSD: -1},     // Negative fee, ignored
+	}})
+
+	tests := []struct {
+		name        string
+		sourceChain string
+		targetChain string
+		wantBridge  *models.BridgeCost
+		wantFee     string
+		wantTotal   string
+		wantProfit  string
+		wantMinDays int
+	}{
+		{
+			name:        "same chain skips bridging",
+			sourceChain: "arbitrum",
+			targetChain: "arbitrum",
+			wantFee:     "0",
+			wantTotal:   "3",
+			wantProfit:  "79.19",
+			wantMinDays: 2,
+		},
+		{
+			name:        "known route",
+			sourceChain: "polygon",
+			targetChain: "arbitrum",
+			wantBridge: &models.BridgeCost{
+				SourceChain: "polygon", TargetChain: "arbitrum",
+				FlatFeeUSD: decimal.NewFromInt(2), FeePercent: decimal.RequireFromString("0.05"), DelayHours: decimal.NewFromInt(12),
+			},
+			wantFee:     "7",
+			wantTotal:   "9.1",
+			wantProfit:  "71.72",
+			wantMinDays: 4,
+		},
+		{
+			name:        "unknown route falls back to the default",
+			sourceChain: "polygon",
+			targetChain: "base",
+			wantBridge: &models.BridgeCost{
+				SourceChain: "polygon", TargetChain: "base",
+				FlatFeeUSD: decimal.NewFromInt(10), FeePercent: decimal.RequireFromString("0.1"), DelayHours: decimal.NewFromInt(24),
+				DefaultRoute: true,
+			},
+			wantFee:     "20",
+			wantTotal:   "21.6",
+			wantProfit:  "57.85",
+			wantMinDays: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profit, minDays, costs := service.CalculateYieldGapProfit(2, 12, 100000000, tt.sourceChain, tt.targetChain)
+
+			if !bridgeCostEqual(costs.BridgeCost, tt.wantBridge) {
+				t.Errorf("Expected bridge cost %+v, got %+v", tt.wantBridge, costs.BridgeCost)
+			}
+			if got := costs.BridgeFeeUSD.String(); got != tt.wantFee {
+				t.Errorf("Expected bridge fee %s, got %s", tt.wantFee, got)
+			}
+			if got := costs.TotalUSD.String(); got != tt.wantTotal {
+				t.Errorf("Expected total cost %s, got %s", tt.wantTotal, got)
+			}
+			if got := decimal.NewFromFloat(profit).Round(2).String(); got != tt.wantProfit {
+				t.Errorf("Expected profit %s, got %s", tt.wantProfit, got)
+			}
+			if minDays != tt.wantMinDays {
+				t.Errorf("Expected %d days to break even, got %d", tt.wantMinDays, minDays)
+			}
+		})
+	}
+}
+
+func bridgeCostEqual(a, b *models.BridgeCost) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.SourceChain == b.SourceChain && a.TargetChain == b.TargetChain && a.DefaultRoute == b.DefaultRoute &&
+		a.FlatFeeUSD.Equal(b.FlatFeeUSD) && a.FeePercent.Equal(b.FeePercent) && a.DelayHours.Equal(b.DelayHours)
+}
+
+func TestSetWeights(t *testing.T) {
+	initial := config.ScoringConfig{APYWeight: 0.35, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.15}
+	service := NewService(initial)
+
+	pool := &models.Pool{
+		Chain:      "ethereum",
+		APY:        decimal.NewFromFloat(5.0),
+		TVL:        decimal.NewFromFloat(100000000),
+		APYMean30D: decimal.NewFromFloat(5.0),
+	}
+	before := service.CalculateScore(pool)
+
+	// Invalid weights are rejected and the current ones kept
+	if err := service.SetWeights(config.ScoringConfig{APYWeight: -1, TVLWeight: 2}); err == nil {
+		t.Error("Expected error for negative weight")
+	}
+	if err := service.SetWeights(config.ScoringConfig{APYWeight: 0.5, TVLWeight: 0.5, TrendWeight: 0.5}); err == nil {
+		t.Error("Expected error for weights not summing to 1")
+	}
+	if err := service.SetWeights(config.ScoringConfig{}); err == nil {
+		t.Error("Expected error for all-zero weights")
+	}
+	if service.Weights() != initial {
+		t.Errorf("Expected weights to be unchanged, got %+v", service.Weights())
+	}
+
+	// Valid weights take effect for subsequent scores
+	tvlOnly := config.ScoringConfig{TVLWeight: 1}
+	if err := service.SetWeights(tvlOnly); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if service.Weights() != tvlOnly {
+		t.Errorf("Expected weights %+v, got %+v", tvlOnly, service.Weights())
+	}
+	if after := service.CalculateScore(pool); after.Equal(before) {
+		t.Errorf("Expected score to change after reload, still %s", after)
+	}
+}
+
+func TestSetWeights_Concurrent(t *testing.T) {
+	service := NewService(config.ScoringConfig{APYWeight: 0.5, TVLWeight: 0.5})
+	pool := &models.Pool{Chain: "ethereum", APY: decimal.NewFromFloat(5.0), TVL: decimal.NewFromFloat(1000000)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			apyWeight := 0.4 + 0.2*float64(i%2)
+			if err := service.SetWeights(config.ScoringConfig{APYWeight: apyWeight, TVLWeight: 1 - apyWeight}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		service.CalculateScore(pool)
+	}
+	<-done
+}
+
+func TestNormalizeVolumeRatio(t *testing.T) {
+	tests := []struct {
+		ratio    float64
+		expected float64
+	}{
+		{0, 0},
+		{-1, 0},
+		{0.25, 0.5},
+		{0.5, 1},
+		{5, 1},
+	}
+
+	for _, tt := range tests {
+		if result := normalizeVolumeRatio(tt.ratio); result != tt.expected {
+			t.Errorf("normalizeVolumeRatio(%v) = %v, expected %v", tt.ratio, result, tt.expected)
+		}
+	}
+}
+
+func TestCalculateScore_VolumeWeight(t *testing.T) {
+	weights := config.ScoringConfig{APYWeight: 0.35, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.15}
+
+	quiet := models.Pool{
+		Chain:      "arbitrum",
+		APY:        decimal.NewFromFloat(12),
+		TVL:        decimal.NewFromFloat(2000000),
+		APYMean30D: decimal.NewFromFloat(12),
+	}
+	active := quiet
+	active.VolumeUSD1D = decimal.NewFromFloat(1000000)
+
+	// With the default zero weight, volume doesn't affect the score
+	service := NewService(weights)
+	if !service.CalculateScore(&quiet).Equal(service.CalculateScore(&active)) {
+		t.Error("Expected volume to be ignored when VolumeWeight is 0")
+	}
+
+	weights.APYWeight = 0.25
+	weights.VolumeWeight = 0.1
+	service = NewService(weights)
+	if !service.CalculateScore(&active).GreaterThan(service.CalculateScore(&quiet)) {
+		t.Error("Expected active pool to outscore quiet pool when VolumeWeight is set")
+	}
+}
+
+func TestCalculateScore_CompletenessPenalty(t *testing.T) {
+	weights := config.ScoringConfig{APYWeight: 0.35, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.15}
+
+	complete := models.Pool{
+		Chain:      "ethereum",
+		APY:        decimal.NewFromFloat(5.0),
+		TVL:        decimal.NewFromFloat(100000000),
+		APYMean30D: decimal.NewFromFloat(5.0),
+	}
+	sparse := complete
+	sparse.APYMean30D = decimal.Zero
+
+	// Without a penalty, only the neutral stability guess separates them
+	service := NewService(weights)
+	completeScore := service.CalculateScore(&complete)
+	sparseScore := service.CalculateScore(&sparse)
+
+	weights.CompletenessPenalty = 0.3
+	service = NewService(weights)
+
+	if got := service.CalculateScore(&complete); !got.Equal(completeScore) {
+		t.Errorf("Expected complete pool score %s to be unaffected by the penalty, got %s", completeScore, got)
+	}
+
+	// One of three expected fields missing removes a third of the penalty
+	expected, _ := sparseScore.Float64()
+	expected *= 1 - 0.3/3
+	got, _ := service.CalculateScore(&sparse).Float64()
+	if math.Abs(got-expected) > 0.01 {
+		t.Errorf("Expected penalized score %.4f, got %.4f", expected, got)
+	}
+}
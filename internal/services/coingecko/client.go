@@ -9,12 +9,11 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/httputil"
 )
 
 // PriceResponse represents the API response from /simple/price endpoint
@@ -23,25 +22,24 @@ type PriceResponse map[string]map[string]float64
 
 // Client is the CoinGecko API client
 type Client struct {
-	baseURL     string
-	apiKey      string
-	httpClient  *http.Client
-	rateLimiter *rate.Limiter
+	baseURL string
+	apiKey  string
+	http    *httputil.RateLimitedClient
 }
 
 // NewClient creates a new CoinGecko API client with rate limiting
 func NewClient(cfg config.CoinGeckoConfig) *Client {
-	// CoinGecko Demo plan: 30 requests/min
-	rps := float64(cfg.RateLimit) / 60.0
-
 	return &Client{
 		baseURL: cfg.BaseURL,
 		apiKey:  cfg.APIKey,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		// Allow burst of 5 requests, then rate limit
-		rateLimiter: rate.NewLimiter(rate.Limit(rps), 5),
+		http: httputil.NewRateLimitedClient(httputil.RateLimitedConfig{
+			Name: "coingecko",
+			HTTP: cfg.HTTP,
+			// CoinGecko Demo plan: 30 requests/min
+			RequestsPerMinute: cfg.RateLimit,
+			// Allow burst of 5 requests, then rate limit
+			Burst: 5,
+		}),
 	}
 }
 
@@ -51,11 +49,6 @@ func (c *Client) FetchPrices(ctx context.Context, tokenIDs []string) (map[string
 		return make(map[string]float64), nil
 	}
 
-	// Wait for rate limiter
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter error: %w", err)
-	}
-
 	// Build URL with token IDs
 	ids := strings.Join(tokenIDs, ",")
 	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", c.baseURL, ids)
@@ -79,55 +72,9 @@ func (c *Client) FetchPrices(ctx context.Context, tokenIDs []string) (map[string
 		req.Header.Set("x-cg-demo-api-key", c.apiKey)
 	}
 
-	// Execute request with retry logic
-	var resp *http.Response
-	maxRetries := 3
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		resp, err = c.httpClient.Do(req)
-		if err != nil {
-			log.Warn().
-				Err(err).
-				Int("attempt", attempt).
-				Msg("CoinGecko request failed, retrying...")
-
-			if attempt == maxRetries {
-				return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, err)
-			}
-
-			// Exponential backoff
-			backoff := time.Duration(attempt*attempt) * time.Second
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(backoff):
-				continue
-			}
-		}
-
-		// Check for rate limiting
-		if resp.StatusCode == http.StatusTooManyRequests {
-			log.Warn().
-				Int("attempt", attempt).
-				Msg("CoinGecko rate limit hit, waiting...")
-
-			resp.Body.Close()
-
-			if attempt == maxRetries {
-				return nil, fmt.Errorf("rate limit exceeded after %d attempts", maxRetries)
-			}
-
-			// Wait longer for rate limit
-			backoff := time.Duration(attempt*10) * time.Second
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(backoff):
-				continue
-			}
-		}
-
-		break
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -178,10 +125,6 @@ func (c *Client) FetchMarketData(ctx context.Context, tokenIDs []string) ([]Mark
 		return []MarketData{}, nil
 	}
 
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter error: %w", err)
-	}
-
 	ids := strings.Join(tokenIDs, ",")
 	url := fmt.Sprintf(
 		"%s/coins/markets?vs_currency=usd&ids=%s&order=market_cap_desc&sparkline=false",
@@ -198,9 +141,9 @@ func (c *Client) FetchMarketData(ctx context.Context, tokenIDs []string) ([]Mark
 		req.Header.Set("x-cg-demo-api-key", c.apiKey)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -277,3 +220,36 @@ func GetTokenID(symbol string) string {
 	// Return lowercase symbol as fallback
 	return strings.ToLower(symbol)
 }
+
+// coreTokens are the CoinGecko IDs whose prices are fetched whatever chains
+// are ingested
+var coreTokens = []string{"ethereum", "bitcoin", "tether", "usd-coin"}
+
+// chainTokens are the symbols of each chain's own token, in fetch order
+var chainTokens = []struct {
+	chain  string
+	symbol string
+}{
+	{"bsc", "BNB"},
+	{"polygon", "MATIC"},
+	{"avalanche", "AVAX"},
+	{"fantom", "FTM"},
+	{"arbitrum", "ARB"},
+	{"optimism", "OP"},
+}
+
+// PriceTokens returns the CoinGecko IDs to fetch prices for: the core tokens
+// plus the tokens of the chains the filter allows. IDs are resolved like
+// reward tokens, see ResolveToken.
+func PriceTokens(chains config.ChainFilter) []string {
+	tokens := append([]string(nil), coreTokens...)
+	for _, ct := range chainTokens {
+		if !chains.Allows(ct.chain) {
+			continue
+		}
+		if token, ok := ResolveToken(ct.chain, ct.symbol); ok {
+			tokens = append(tokens, token.ID)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,119 @@
+package coingecko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
+)
+
+// Token is a token resolved to its CoinGecko coin
+type Token struct {
+	ID     string `json:"id"`     // CoinGecko coin ID
+	Symbol string `json:"symbol"` // Display symbol, uppercase
+}
+
+// addressPattern matches EVM contract addresses
+var addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// nativeAddresses stand for a chain's gas token in DeFiLlama reward lists
+var nativeAddresses = map[string]bool{
+	"0x0000000000000000000000000000000000000000": true,
+	"0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee": true,
+}
+
+// nativeSymbols are the gas token symbols of chains whose gas token isn't ETH
+var nativeSymbols = map[string]string{
+	"bsc":       "BNB",
+	"polygon":   "MATIC",
+	"avalanche": "AVAX",
+	"fantom":    "FTM",
+}
+
+// platformIDs are CoinGecko's asset platform IDs for contract lookups
+var platformIDs = map[string]string{
+	"ethereum":  "ethereum",
+	"arbitrum":  "arbitrum-one",
+	"optimism":  "optimistic-ethereum",
+	"polygon":   "polygon-pos",
+	"bsc":       "binance-smart-chain",
+	"avalanche": "avalanche",
+	"fantom":    "fantom",
+	"base":      "base",
+}
+
+// IsAddress reports whether token is a contract address rather than a symbol
+func IsAddress(token string) bool {
+	return addressPattern.MatchString(token)
+}
+
+// ResolveToken resolves a token without calling the API: a symbol known to
+// TokenIDMap, or the native token address of a chain. Other contract
+// addresses need LookupContract.
+func ResolveToken(chain, token string) (Token, bool) {
+	symbol := strings.ToUpper(strings.TrimSpace(token))
+	if IsAddress(token) {
+		if !nativeAddresses[strings.ToLower(token)] {
+			return Token{}, false
+		}
+		symbol = "ETH"
+		if native, ok := nativeSymbols[utils.NormalizeChainName(chain)]; ok {
+			symbol = native
+		}
+	}
+
+	id, ok := TokenIDMap[symbol]
+	if !ok {
+		return Token{}, false
+	}
+	return Token{ID: id, Symbol: symbol}, true
+}
+
+// LookupContract resolves a token contract on a chain through CoinGecko.
+// The error wraps os.ErrNotExist if CoinGecko doesn't list the contract or
+// the chain.
+func (c *Client) LookupContract(ctx context.Context, chain, address string) (Token, error) {
+	platform, ok := platformIDs[utils.NormalizeChainName(chain)]
+	if !ok {
+		return Token{}, fmt.Errorf("chain %s: %w", chain, os.ErrNotExist)
+	}
+
+	url := fmt.Sprintf("%s/coins/%s/contract/%s", c.baseURL, platform, strings.ToLower(address))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("x-cg-demo-api-key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Token{}, fmt.Errorf("contract %s on %s: %w", address, chain, os.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var coin struct {
+		ID     string `json:"id"`
+		Symbol string `json:"symbol"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&coin); err != nil {
+		return Token{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return Token{ID: coin.ID, Symbol: strings.ToUpper(coin.Symbol)}, nil
+}
@@ -4,17 +4,20 @@
 package defillama
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
-	"golang.org/x/time/rate"
 
 	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/httputil"
 	"github.com/maxjove/defi-yield-aggregator/internal/models"
 )
 
@@ -45,41 +48,73 @@ type Pool struct {
 	PoolMeta         string   `json:"poolMeta"`
 }
 
-// PoolsResponse represents the API response from /pools endpoint
+// PoolsResponse represents the API response from /pools endpoint. FetchPools
+// decodes it a pool at a time rather than into this type.
 type PoolsResponse struct {
 	Status string `json:"status"`
 	Data   []Pool `json:"data"`
 }
 
+// ChartPoint is one data point of a pool's history from the /chart endpoint.
+// Fields DeFiLlama reports as null are zero.
+type ChartPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	TVLUsd    float64   `json:"tvlUsd"`
+	APY       float64   `json:"apy"`
+	APYBase   float64   `json:"apyBase"`
+	APYReward float64   `json:"apyReward"`
+}
+
+// ChartResponse represents the API response from /chart/{pool} endpoint
+type ChartResponse struct {
+	Status string       `json:"status"`
+	Data   []ChartPoint `json:"data"`
+}
+
 // Client is the DeFiLlama API client
 type Client struct {
-	baseURL     string
-	httpClient  *http.Client
-	rateLimiter *rate.Limiter
+	baseURL string
+	http    *httputil.RateLimitedClient
 }
 
 // NewClient creates a new DeFiLlama API client with rate limiting
 func NewClient(cfg config.DeFiLlamaConfig) *Client {
-	// Calculate rate limiter: requests per minute -> requests per second
-	rps := float64(cfg.RateLimit) / 60.0
-
 	return &Client{
 		baseURL: cfg.BaseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		// Allow burst of 10 requests, then rate limit
-		rateLimiter: rate.NewLimiter(rate.Limit(rps), 10),
+		http: httputil.NewRateLimitedClient(httputil.RateLimitedConfig{
+			Name:              "defillama",
+			HTTP:              cfg.HTTP,
+			RequestsPerMinute: cfg.RateLimit,
+			// Allow burst of 10 requests, then rate limit
+			Burst: 10,
+		}),
 	}
 }
 
-// FetchPools retrieves all yield pools from DeFiLlama
+// ErrPartialResponse is wrapped by the error of a pools fetch whose response
+// broke off part way, e.g. on a dropped connection. The pools decoded before
+// the break are returned along with it.
+var ErrPartialResponse = errors.New("partial response")
+
+// FetchPools retrieves all yield pools from DeFiLlama. The response is
+// decoded a pool at a time as it arrives; see fetchPools.
 func (c *Client) FetchPools(ctx context.Context) ([]Pool, error) {
-	// Wait for rate limiter
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter error: %w", err)
-	}
+	return c.fetchPools(ctx, nil)
+}
 
+// FetchPoolsRaw retrieves all yield pools from DeFiLlama along with the raw
+// response body, so callers can archive exactly what the API returned
+func (c *Client) FetchPoolsRaw(ctx context.Context) ([]Pool, []byte, error) {
+	var raw bytes.Buffer
+	pools, err := c.fetchPools(ctx, &raw)
+	return pools, raw.Bytes(), err
+}
+
+// fetchPools retrieves all yield pools, copying the response body to raw
+// unless it is nil. Pools without an ID or with a field of the wrong type
+// are skipped. If the response breaks off after some pools were decoded,
+// they are returned with an error wrapping ErrPartialResponse.
+func (c *Client) fetchPools(ctx context.Context, raw io.Writer) ([]Pool, error) {
 	url := c.baseURL + "/pools"
 	log.Debug().Str("url", url).Msg("Fetching pools from DeFiLlama")
 
@@ -92,32 +127,9 @@ func (c *Client) FetchPools(ctx context.Context) ([]Pool, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "DeFiYieldAggregator/1.0")
 
-	// Execute request with retry logic
-	var resp *http.Response
-	maxRetries := 3
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		resp, err = c.httpClient.Do(req)
-		if err != nil {
-			log.Warn().
-				Err(err).
-				Int("attempt", attempt).
-				Msg("DeFiLlama request failed, retrying...")
-
-			if attempt == maxRetries {
-				return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, err)
-			}
-
-			// Exponential backoff
-			backoff := time.Duration(attempt*attempt) * time.Second
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(backoff):
-				continue
-			}
-		}
-		break
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -126,25 +138,115 @@ func (c *Client) FetchPools(ctx context.Context) ([]Pool, error) {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// Parse response
-	var poolsResp PoolsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&poolsResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	var body io.Reader = resp.Body
+	if raw != nil {
+		body = io.TeeReader(resp.Body, raw)
+	}
+
+	pools, skipped, err := decodePools(ctx, body)
+	if skipped > 0 {
+		log.Warn().
+			Int("skipped", skipped).
+			Msg("Skipped malformed pools in DeFiLlama response")
+	}
+	if err != nil {
+		// A fetch abandoned by its caller isn't a partial response
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if len(pools) == 0 {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		log.Warn().
+			Err(err).
+			Int("count", len(pools)).
+			Msg("DeFiLlama response broke off, returning the pools decoded before it")
+		return pools, fmt.Errorf("%w after %d pools: %w", ErrPartialResponse, len(pools), err)
 	}
 
 	log.Info().
-		Int("count", len(poolsResp.Data)).
+		Int("count", len(pools)).
 		Msg("Successfully fetched pools from DeFiLlama")
 
-	return poolsResp.Data, nil
+	return pools, nil
 }
 
-// FetchPool retrieves a specific pool by ID
-func (c *Client) FetchPool(ctx context.Context, poolID string) (*Pool, error) {
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter error: %w", err)
+// decodePools decodes the pools of a /pools response one at a time, so the
+// whole body is never held in memory at once. It returns the pools decoded
+// and how many were skipped as malformed; on an error the pools decoded
+// before it are returned with it. Fields other than data are ignored.
+func decodePools(ctx context.Context, r io.Reader) ([]Pool, int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, 0, err
+	}
+
+	var pools []Pool
+	skipped := 0
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return pools, skipped, err
+		}
+		if key != "data" {
+			var ignored json.RawMessage
+			if err := dec.Decode(&ignored); err != nil {
+				return pools, skipped, err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return pools, skipped, err
+		}
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				return pools, skipped, err
+			}
+
+			var pool Pool
+			err := dec.Decode(&pool)
+			var typeErr *json.UnmarshalTypeError
+			switch {
+			case errors.As(err, &typeErr):
+				// The decoder has read past the pool and can go on
+				skipped++
+				log.Debug().Err(err).Str("pool_id", pool.Pool).Msg("Skipping pool with a malformed field")
+				continue
+			case err != nil:
+				return pools, skipped, err
+			case pool.Pool == "":
+				skipped++
+				continue
+			}
+			pools = append(pools, pool)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return pools, skipped, err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return pools, skipped, err
 	}
+	return pools, skipped, nil
+}
 
+// expectDelim reads the next token, failing unless it is delim
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// FetchPool retrieves a specific pool by ID
+func (c *Client) FetchPool(ctx context.Context, poolID string) (*Pool, error) {
 	url := fmt.Sprintf("%s/chart/%s", c.baseURL, poolID)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -154,9 +256,9 @@ func (c *Client) FetchPool(ctx context.Context, poolID string) (*Pool, error) {
 
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -172,6 +274,68 @@ func (c *Client) FetchPool(ctx context.Context, poolID string) (*Pool, error) {
 	return &pool, nil
 }
 
+// FetchPoolChart retrieves the history of a pool, oldest first
+func (c *Client) FetchPoolChart(ctx context.Context, poolID string) ([]ChartPoint, error) {
+	url := fmt.Sprintf("%s/chart/%s", c.baseURL, poolID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "DeFiYieldAggregator/1.0")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var chart ChartResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chart); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return chart.Data, nil
+}
+
+// ToHistoricalAPY converts a chart point of a pool to a historical data point
+func ToHistoricalAPY(poolID string, p ChartPoint) models.HistoricalAPY {
+	return models.HistoricalAPY{
+		PoolID:    poolID,
+		Timestamp: p.Timestamp.UTC(),
+		APY:       decimal.NewFromFloat(p.APY),
+		TVL:       decimal.NewFromFloat(p.TVLUsd),
+		APYBase:   decimal.NewFromFloat(p.APYBase),
+		APYReward: decimal.NewFromFloat(p.APYReward),
+	}
+}
+
+// FilterChains returns the pools on chains the filter allows, and how many
+// pools were skipped per skipped chain, keyed by the chain as DeFiLlama names
+// it. The input slice is left untouched.
+func FilterChains(pools []Pool, filter config.ChainFilter) ([]Pool, map[string]int) {
+	skipped := make(map[string]int)
+	if !filter.Active() {
+		return pools, skipped
+	}
+
+	kept := make([]Pool, 0, len(pools))
+	for _, p := range pools {
+		if !filter.Allows(p.Chain) {
+			skipped[p.Chain]++
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept, skipped
+}
+
 // ToPoolModel converts a DeFiLlama Pool to our internal Pool model
 func ToPoolModel(p Pool) models.Pool {
 	now := time.Now().UTC()
@@ -197,6 +361,7 @@ func ToPoolModel(p Pool) models.Pool {
 		APYChange7D:      decimal.NewFromFloat(p.APYPct7D),
 		StableCoin:       p.Stablecoin,
 		Exposure:         p.Exposure,
+		DataSource:       models.DataSourceDeFiLlama,
 		CreatedAt:        now,
 		UpdatedAt:        now,
 	}
@@ -0,0 +1,130 @@
+package defillama
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+// poolsFixture is a /pools response with pools on four chains
+const poolsFixture = `{"status":"success","data":[
+	{"pool":"eth-1","chain":"Ethereum","project":"aave-v3","symbol":"USDC","tvlUsd":5000000,"apy":4.1},
+	{"pool":"arb-1","chain":"Arbitrum","project":"aave-v3","symbol":"USDC","tvlUsd":3000000,"apy":5.2},
+	{"pool":"bsc-1","chain":"BSC","project":"venus","symbol":"USDT","tvlUsd":2000000,"apy":6.3},
+	{"pool":"bsc-2","chain":"BSC","project":"venus","symbol":"BUSD","tvlUsd":1000000,"apy":3.4},
+	{"pool":"ftm-1","chain":"Fantom","project":"geist","symbol":"DAI","tvlUsd":500000,"apy":8.5}
+]}`
+
+func TestFilterChains(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(poolsFixture))
+	}))
+	defer server.Close()
+
+	pools, err := NewClient(config.DeFiLlamaConfig{BaseURL: server.URL, RateLimit: 600}).FetchPools(context.Background())
+	if err != nil {
+		t.Fatalf("FetchPools failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.WorkerConfig
+		wantIDs     []string
+		wantSkipped map[string]int
+	}{
+		{"no filter", config.WorkerConfig{}, []string{"eth-1", "arb-1", "bsc-1", "bsc-2", "ftm-1"}, map[string]int{}},
+		{"allowlist with aliases", config.WorkerConfig{Chains: []string{"eth", "arb"}}, []string{"eth-1", "arb-1"}, map[string]int{"BSC": 2, "Fantom": 1}},
+		{"exclusions", config.WorkerConfig{ExcludeChains: []string{"binance"}}, []string{"eth-1", "arb-1", "ftm-1"}, map[string]int{"BSC": 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped := FilterChains(pools, tt.cfg.ChainFilter())
+
+			ids := make([]string, 0, len(kept))
+			for _, p := range kept {
+				ids = append(ids, ToPoolModel(p).ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Expected pools %v, got %v", tt.wantIDs, ids)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("Expected skipped %v, got %v", tt.wantSkipped, skipped)
+			}
+		})
+	}
+
+	if len(pools) != 5 {
+		t.Errorf("Expected the fetched pools untouched, got %d", len(pools))
+	}
+}
+
+func TestFetchPools_Truncated(t *testing.T) {
+	// The connection drops part way through the third pool
+	truncated := poolsFixture[:strings.Index(poolsFixture, `"bsc-1"`)+20]
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(truncated))
+	}))
+	defer server.Close()
+
+	client := NewClient(config.DeFiLlamaConfig{BaseURL: server.URL, RateLimit: 600})
+	pools, raw, err := client.FetchPoolsRaw(context.Background())
+	if !errors.Is(err, ErrPartialResponse) {
+		t.Fatalf("Expected a partial response error, got %v", err)
+	}
+	if len(pools) != 2 || pools[0].Pool != "eth-1" || pools[1].Pool != "arb-1" {
+		t.Errorf("Expected the 2 pools before the break, got %+v", pools)
+	}
+	if string(raw) != truncated {
+		t.Errorf("Expected the raw body as received, got %q", raw)
+	}
+}
+
+func TestFetchPools_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantIDs []string
+		wantErr bool
+	}{
+		{"complete", poolsFixture, []string{"eth-1", "arb-1", "bsc-1", "bsc-2", "ftm-1"}, false},
+		{"fields after data", `{"data":[{"pool":"a"}],"status":"success"}`, []string{"a"}, false},
+		{"wrong field type skipped", `{"data":[{"pool":"a","tvlUsd":"lots"},{"pool":"b","tvlUsd":1}]}`, []string{"b"}, false},
+		{"missing ID skipped", `{"data":[{"chain":"Ethereum"},{"pool":"b"}]}`, []string{"b"}, false},
+		{"cut before any pool", `{"status":"success","data":[{"po`, nil, true},
+		{"not an object", `[]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			pools, err := NewClient(config.DeFiLlamaConfig{BaseURL: server.URL, RateLimit: 600}).FetchPools(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if errors.Is(err, ErrPartialResponse) {
+				t.Errorf("Expected a plain error without pools, got %v", err)
+			}
+
+			var ids []string
+			for _, p := range pools {
+				ids = append(ids, p.Pool)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Expected pools %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Package indices computes benchmark APY indices: the TVL-weighted average
+// APY of the pools matching each index definition, recorded once a day.
+package indices
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+const (
+	// batchSize is how many pools are read per query while scanning
+	batchSize = 1000
+
+	// apyPlaces is the precision index APYs are stored with, as for pools
+	apyPlaces = 6
+)
+
+// poolReader scans the pools table in ID order.
+// Implemented by the PostgreSQL repository.
+type poolReader interface {
+	ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error)
+}
+
+// indexStore lists index definitions and records their daily values.
+// Implemented by the PostgreSQL repository.
+type indexStore interface {
+	ListAPYIndices(ctx context.Context) ([]models.APYIndex, error)
+	SaveAPYIndexValue(ctx context.Context, name string, value models.APYIndexValue) error
+}
+
+// Service computes and stores index values
+type Service struct {
+	pools      poolReader
+	store      indexStore
+	staleAfter time.Duration
+	now        func() time.Time
+}
+
+// NewService creates a new index service. Pools not updated within the
+// worker's POOL_STALE_AFTER, and outliers, are left out of the indices.
+func NewService(cfg config.WorkerConfig, pools poolReader, store indexStore) *Service {
+	return &Service{
+		pools:      pools,
+		store:      store,
+		staleAfter: cfg.PoolStaleAfter,
+		now:        time.Now,
+	}
+}
+
+// Run computes every index over the current pools and stores the values for
+// today (UTC), replacing any computed earlier the same day. An index with no
+// weighted constituents is skipped for the day. Returns the values stored by
+// index name.
+func (s *Service) Run(ctx context.Context) (map[string]models.APYIndexValue, error) {
+	defs, err := s.store.ListAPYIndices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indices: %w", err)
+	}
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	matchers := make([]models.APYIndexMatcher, len(defs))
+	sums := make([]weightedSum, len(defs))
+	for i, def := range defs {
+		matchers[i] = models.NewAPYIndexMatcher(def)
+	}
+
+	var staleBefore time.Time
+	if s.staleAfter > 0 {
+		staleBefore = now.Add(-s.staleAfter)
+	}
+
+	afterID := ""
+	for {
+		batch, err := s.pools.ListPoolsAfter(ctx, afterID, decimal.Zero, decimal.Zero, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pools: %w", err)
+		}
+
+		for _, pool := range batch {
+			// An implausible APY on a large pool would swing the average
+			if pool.IsStale(staleBefore) || pool.IsOutlier {
+				continue
+			}
+			for i, m := range matchers {
+				if m.Matches(pool) {
+					sums[i].add(pool)
+				}
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+
+	stored := make(map[string]models.APYIndexValue, len(defs))
+	for i, def := range defs {
+		value, ok := sums[i].value()
+		if !ok {
+			log.Warn().Str("index", def.Name).Msg("Index has no constituents with TVL, skipping today's value")
+			continue
+		}
+		value.Day = day
+
+		if err := s.store.SaveAPYIndexValue(ctx, def.Name, value); err != nil {
+			return stored, fmt.Errorf("failed to save index %s: %w", def.Name, err)
+		}
+		stored[def.Name] = value
+	}
+
+	return stored, nil
+}
+
+// Compute returns the TVL-weighted average APY of pools, or false if none
+// has any TVL. Pools without TVL are not counted as constituents.
+func Compute(pools []models.Pool) (models.APYIndexValue, bool) {
+	var sum weightedSum
+	for _, pool := range pools {
+		sum.add(pool)
+	}
+	return sum.value()
+}
+
+// weightedSum accumulates the constituents of an index
+type weightedSum struct {
+	apyTVL       decimal.Decimal // Sum of APY × TVL
+	tvl          decimal.Decimal
+	constituents int
+}
+
+// add counts pool in if it has TVL to weight its APY by
+func (w *weightedSum) add(pool models.Pool) {
+	if !pool.TVL.IsPositive() {
+		return
+	}
+	w.apyTVL = w.apyTVL.Add(pool.APY.Mul(pool.TVL))
+	w.tvl = w.tvl.Add(pool.TVL)
+	w.constituents++
+}
+
+// value returns the weighted average, or false without constituents
+func (w *weightedSum) value() (models.APYIndexValue, bool) {
+	if w.constituents == 0 {
+		return models.APYIndexValue{}, false
+	}
+	return models.APYIndexValue{
+		APY:          w.apyTVL.DivRound(w.tvl, apyPlaces),
+		TVL:          w.tvl,
+		Constituents: w.constituents,
+	}, true
+}
@@ -0,0 +1,187 @@
+package indices
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// fakePools serves pools in ID order like the repository
+type fakePools []models.Pool
+
+func (f fakePools) ListPoolsAfter(_ context.Context, afterID string, _, _ decimal.Decimal, limit int) ([]models.Pool, error) {
+	sorted := append([]models.Pool(nil), f...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	batch := make([]models.Pool, 0, limit)
+	for _, p := range sorted {
+		if p.ID > afterID && len(batch) < limit {
+			batch = append(batch, p)
+		}
+	}
+	return batch, nil
+}
+
+// fakeStore records saved index values
+type fakeStore struct {
+	defs  []models.APYIndex
+	saved map[string]models.APYIndexValue
+}
+
+func (f *fakeStore) ListAPYIndices(context.Context) ([]models.APYIndex, error) {
+	return f.defs, nil
+}
+
+func (f *fakeStore) SaveAPYIndexValue(_ context.Context, name string, value models.APYIndexValue) error {
+	if f.saved == nil {
+		f.saved = make(map[string]models.APYIndexValue)
+	}
+	f.saved[name] = value
+	return nil
+}
+
+func pool(id, chain, protocol, symbol string, stable bool, apy, tvl string, updated time.Time) models.Pool {
+	return models.Pool{
+		ID:         id,
+		Chain:      chain,
+		Protocol:   protocol,
+		Symbol:     symbol,
+		StableCoin: stable,
+		APY:        decimal.RequireFromString(apy),
+		TVL:        decimal.RequireFromString(tvl),
+		UpdatedAt:  updated,
+	}
+}
+
+func TestCompute(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name             string
+		pools            []models.Pool
+		wantOK           bool
+		wantAPY, wantTVL string
+		wantConstituents int
+	}{
+		{
+			name: "weighted by TVL",
+			pools: []models.Pool{
+				pool("a", "ethereum", "aave-v3", "USDC", true, "4.25", "1000000", now),
+				pool("b", "ethereum", "compound-v3", "USDC", true, "3.1", "3000000", now),
+			},
+			wantOK: true, wantAPY: "3.3875", wantTVL: "4000000", wantConstituents: 2,
+		},
+		{
+			name: "rounded to six places",
+			pools: []models.Pool{
+				pool("a", "ethereum", "aave-v3", "USDC", true, "4.25", "1000000", now),
+				pool("b", "ethereum", "compound-v3", "USDC", true, "3.1", "3000000", now),
+				pool("c", "ethereum", "spark", "USDC", true, "5.5", "2000000", now),
+			},
+			wantOK: true, wantAPY: "4.091667", wantTVL: "6000000", wantConstituents: 3,
+		},
+		{
+			name: "zero TVL carries no weight",
+			pools: []models.Pool{
+				pool("a", "ethereum", "aave-v3", "USDC", true, "4.25", "1000000", now),
+				pool("z", "ethereum", "new-protocol", "USDC", true, "900", "0", now),
+			},
+			wantOK: true, wantAPY: "4.25", wantTVL: "1000000", wantConstituents: 1,
+		},
+		{
+			name: "only zero TVL",
+			pools: []models.Pool{
+				pool("z", "ethereum", "new-protocol", "USDC", true, "900", "0", now),
+			},
+		},
+		{name: "no pools"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Compute(tt.pools)
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if !ok {
+				return
+			}
+			if !got.APY.Equal(decimal.RequireFromString(tt.wantAPY)) {
+				t.Errorf("Expected APY %s, got %s", tt.wantAPY, got.APY)
+			}
+			if !got.TVL.Equal(decimal.RequireFromString(tt.wantTVL)) {
+				t.Errorf("Expected TVL %s, got %s", tt.wantTVL, got.TVL)
+			}
+			if got.Constituents != tt.wantConstituents {
+				t.Errorf("Expected %d constituents, got %d", tt.wantConstituents, got.Constituents)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	now := time.Date(2024, 6, 3, 0, 10, 0, 0, time.UTC)
+	stale := now.Add(-2 * time.Hour)
+	stable := true
+
+	pools := fakePools{
+		pool("p1", "Ethereum", "aave-v3", "USDC", true, "4.25", "1000000", now),
+		pool("p2", "ethereum", "compound-v3", "USDC-USDT", true, "3.1", "3000000", now),
+		pool("p3", "ethereum", "uniswap-v3", "WETH-USDC", false, "20", "500000", now),
+		pool("p4", "arbitrum", "aave-v3", "USDC.e", true, "6", "800000", now),
+		pool("p5", "ethereum", "aave-v3", "USDC", true, "50", "9000000", stale),
+		pool("p6", "zksync", "new-protocol", "USDC", true, "900", "0", now),
+		pool("p7", "ethereum", "spark", "USDC", true, "100000", "5000000", now),
+		pool("p8", "ethereum", "private-vault", "DAI", true, "5", "2000000", now.AddDate(0, -1, 0)),
+	}
+	pools[6].IsOutlier = true
+	pools[7].DataSource = models.DataSourceManual
+	store := &fakeStore{defs: []models.APYIndex{
+		{Name: "ethereum-stablecoins", Chain: "ethereum", StableCoin: &stable},
+		{Name: "aave-usdc", Protocol: "AAVE-V3", Asset: "usdc"},
+		{Name: "solana", Chain: "solana"},
+		{Name: "zksync", Chain: "zksync"},
+	}}
+
+	service := NewService(config.WorkerConfig{PoolStaleAfter: time.Hour}, pools, store)
+	service.now = func() time.Time { return now }
+
+	stored, err := service.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := map[string]struct {
+		apy          string
+		constituents int
+	}{
+		// p1, p2 and p8, imported a month ago but never stale; p5 is stale
+		// and p7 an outlier
+		"ethereum-stablecoins": {"3.925", 3},
+		// p1 only: USDC.e is a token of its own
+		"aave-usdc": {"4.25", 1},
+	}
+
+	if len(store.saved) != len(want) || len(stored) != len(want) {
+		t.Fatalf("Expected %d indices stored, got %v", len(want), store.saved)
+	}
+	for name, w := range want {
+		got, ok := store.saved[name]
+		if !ok {
+			t.Errorf("Expected a value for %s", name)
+			continue
+		}
+		if !got.APY.Equal(decimal.RequireFromString(w.apy)) || got.Constituents != w.constituents {
+			t.Errorf("%s: expected APY %s over %d pools, got %s over %d", name, w.apy, w.constituents, got.APY, got.Constituents)
+		}
+		if !got.Day.Equal(time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: expected the UTC day, got %s", name, got.Day)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ingestion
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// historyCounter adds up the historical data points written and skipped
+// across workers. Implemented by the Redis repository.
+type historyCounter interface {
+	AddHistoryWrites(ctx context.Context, written, skipped int64) error
+}
+
+// historyGate remembers the last historical data point recorded for each
+// pool, so a cycle that changed nothing doesn't add another. DeFiLlama
+// refreshes many pools only hourly while they are fetched every few
+// minutes. The gate lives in memory: after a restart every pool records a
+// point on its first cycle.
+type historyGate struct {
+	mu   sync.Mutex
+	last map[string]models.HistoricalAPY
+}
+
+// due reports whether a point for pool should be recorded at now: it is the
+// pool's first, the last one is HistoryHeartbeat old or more, or any of the
+// values moved beyond its epsilon
+func (g *historyGate) due(pool models.Pool, now time.Time, cfg config.IngestionConfig) bool {
+	if cfg.HistoryHeartbeat <= 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	last, ok := g.last[pool.ID]
+	g.mu.Unlock()
+	if !ok || now.Sub(last.Timestamp) >= cfg.HistoryHeartbeat {
+		return true
+	}
+
+	apyEpsilon := decimal.NewFromFloat(cfg.HistoryAPYEpsilon)
+	for _, pair := range [][2]decimal.Decimal{
+		{last.APY, pool.APY},
+		{last.APYBase, pool.APYBase},
+		{last.APYReward, pool.APYReward},
+	} {
+		if pair[1].Sub(pair[0]).Abs().GreaterThan(apyEpsilon) {
+			return true
+		}
+	}
+
+	tvlDelta := pool.TVL.Sub(last.TVL).Abs()
+	if last.TVL.IsZero() {
+		return !tvlDelta.IsZero()
+	}
+	return tvlDelta.Div(last.TVL.Abs()).GreaterThan(decimal.NewFromFloat(cfg.HistoryTVLEpsilon))
+}
+
+// recorded remembers a point once it is stored
+func (g *historyGate) recorded(point models.HistoricalAPY) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.last == nil {
+		g.last = make(map[string]models.HistoricalAPY)
+	}
+	g.last[point.PoolID] = point
+}
@@ -0,0 +1,492 @@
+// Package ingestion provides the storage pipeline shared by every source of
+// pool data. Pools are scored, persisted to PostgreSQL with a historical data
+// point, indexed in ElasticSearch, cached in Redis and published to WebSocket
+// subscribers.
+package ingestion
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+	"github.com/maxjove/defi-yield-aggregator/pkg/eventlog"
+)
+
+// poolCacheTTL is how long ingested pools stay cached in Redis
+const poolCacheTTL = 300 * time.Second
+
+// poolCache holds the cached pools and lists the API serves and delivers
+// pool updates to WebSocket subscribers.
+// Implemented by the Redis repository.
+type poolCache interface {
+	GetPools(ctx context.Context, ids []string) (map[string]models.Pool, error)
+	ApplyIngestionCacheUpdate(ctx context.Context, update redis.IngestionCacheUpdate) error
+	PublishPoolUpdates(ctx context.Context, updates []models.PoolUpdate) error
+}
+
+// chainRegistry records chains seen without a security rating.
+// Implemented by the PostgreSQL repository.
+type chainRegistry interface {
+	EnsureChainMetadata(ctx context.Context, chains []models.ChainMetadata) ([]string, error)
+}
+
+// riskStore keeps each pool's last risk level and the log of changes to it.
+// Implemented by the PostgreSQL repository.
+type riskStore interface {
+	GetPoolRiskLevels(ctx context.Context, poolIDs []string) (map[string]models.RiskLevel, error)
+	SavePoolRiskLevels(ctx context.Context, levels map[string]models.RiskLevel, transitions []models.RiskTransition) error
+}
+
+// protocolCategories lists the category of each known protocol.
+// Implemented by the PostgreSQL repository.
+type protocolCategories interface {
+	ListProtocolCategories(ctx context.Context) ([]models.ProtocolCategory, error)
+}
+
+// eventRecorder appends published events to the event log.
+// Implemented by the event log writer.
+type eventRecorder interface {
+	Append(eventType string, v interface{}) error
+}
+
+// curationStore reads the curated attributes of pools, which ingestion
+// never writes. Implemented by the PostgreSQL repository.
+type curationStore interface {
+	GetPoolCurations(ctx context.Context, poolIDs []string) (map[string]models.PoolCuration, error)
+}
+
+// Service runs pools through the ingestion pipeline
+type Service struct {
+	config     config.IngestionConfig
+	pgRepo     *postgres.Repository
+	cache      poolCache
+	esRepo     *elasticsearch.Repository
+	analytics  *analytics.Service
+	chains     chainRegistry
+	risk       riskStore
+	categories protocolCategories
+	curations  curationStore
+	history    historyGate
+	counter    historyCounter                // Nil without Redis
+	events     eventRecorder                 // Nil without an event log
+	tagger     atomic.Pointer[models.Tagger] // Last successfully loaded rules
+}
+
+// NewService creates a new ingestion service
+func NewService(
+	cfg config.IngestionConfig,
+	pg *postgres.Repository,
+	redis *redis.Repository,
+	es *elasticsearch.Repository,
+	analytics *analytics.Service,
+	events *eventlog.Writer,
+) *Service {
+	s := &Service{
+		config:     cfg,
+		pgRepo:     pg,
+		esRepo:     es,
+		analytics:  analytics,
+		chains:     pg,
+		risk:       pg,
+		categories: pg,
+		curations:  pg,
+	}
+	if redis != nil {
+		s.cache = redis
+		s.counter = redis
+	}
+	if events != nil {
+		s.events = events
+	}
+	return s
+}
+
+// Result summarises an ingestion run
+type Result struct {
+	Stored   []models.Pool    // Pools persisted to PostgreSQL
+	Failed   map[string]error // Pool ID -> reason the pool could not be stored
+	Outliers []string         // IDs of pools whose APY was clamped to the plausible range
+
+	// Historical data points recorded, and skipped as unchanged since the
+	// pool's last one
+	HistoryWritten int
+	HistorySkipped int
+}
+
+// Ingest scores and stores pools. A pool that fails to persist is reported in
+// Result.Failed and skipped by the downstream index, cache and publish steps;
+// failures in those steps are logged but don't fail the pool.
+func (s *Service) Ingest(ctx context.Context, pools []models.Pool) Result {
+	result := Result{
+		Stored: make([]models.Pool, 0, len(pools)),
+		Failed: make(map[string]error),
+	}
+
+	// Register new chains first so their pools are scored with the
+	// conservative defaults
+	s.registerReviewChains(ctx, pools)
+
+	// Clamp implausible APYs before they reach the scores, the database and
+	// the rankings
+	for i := range pools {
+		if s.sanitizeAPY(&pools[i]) {
+			result.Outliers = append(result.Outliers, pools[i].ID)
+		}
+	}
+	if len(result.Outliers) > 0 {
+		log.Warn().
+			Int("count", len(result.Outliers)).
+			Float64("apy_min", s.config.APYMin).
+			Float64("apy_max", s.config.APYMax).
+			Msg("Clamped pools with APYs outside the plausible range")
+	}
+
+	// Calculate derived fields, tags and opportunity scores
+	tagger := s.loadTagger(ctx)
+	for i := range pools {
+		pools[i].Tags = tagger.Tags(&pools[i])
+		pools[i].VolumeTVLRatio = models.CalculateVolumeTVLRatio(pools[i].VolumeUSD1D, pools[i].TVL)
+		pools[i].BaseRatio = models.CalculateBaseRatio(pools[i].APYBase, pools[i].APY)
+		pools[i].DataCompleteness = models.CalculateDataCompleteness(&pools[i])
+		pools[i].Score = s.analytics.CalculateScore(&pools[i])
+	}
+	s.applyCuration(ctx, pools)
+
+	// Store in PostgreSQL
+	for _, pool := range pools {
+		if err := s.pgRepo.UpsertPool(ctx, &pool); err != nil {
+			log.Warn().Err(err).Str("pool_id", pool.ID).Msg("Failed to upsert pool")
+			result.Failed[pool.ID] = err
+			continue
+		}
+
+		// Record historical data point, unless nothing changed since the last
+		now := time.Now().UTC()
+		if s.history.due(pool, now, s.config) {
+			historical := &models.HistoricalAPY{
+				PoolID:    pool.ID,
+				Timestamp: now,
+				APY:       pool.APY,
+				TVL:       pool.TVL,
+				APYBase:   pool.APYBase,
+				APYReward: pool.APYReward,
+			}
+			if err := s.pgRepo.InsertHistoricalAPY(ctx, historical); err != nil {
+				log.Warn().Err(err).Str("pool_id", pool.ID).Msg("Failed to insert historical APY")
+			} else {
+				s.history.recorded(*historical)
+				result.HistoryWritten++
+			}
+		} else {
+			result.HistorySkipped++
+		}
+
+		result.Stored = append(result.Stored, pool)
+	}
+	s.countHistoryWrites(ctx, result)
+
+	if len(result.Stored) == 0 {
+		return result
+	}
+
+	s.recordRiskTransitions(ctx, result.Stored)
+
+	// Index in ElasticSearch (bulk)
+	if err := s.esRepo.BulkIndexPools(ctx, result.Stored); err != nil {
+		log.Warn().Err(err).Msg("Failed to bulk index pools in ElasticSearch")
+	}
+
+	s.updateCache(ctx, result.Stored)
+	return result
+}
+
+// updateCache caches the stored pools, retires the pool lists and stats
+// built from their previous values and publishes the pools' updates. The
+// writes and invalidations become visible together; updates are published
+// only after that, so a client acting on one reads the new data
+// everywhere. If the cache update fails nothing is published.
+func (s *Service) updateCache(ctx context.Context, stored []models.Pool) {
+	// Pick the pools to publish and summarise their changes while the cache
+	// still holds the previous values
+	previous, cacheOK := s.cachedPools(ctx, stored)
+	toPublish := stored
+	if s.config.PublishMode == config.PublishModeChanged && cacheOK {
+		toPublish = changedPools(previous, stored, s.config)
+	}
+
+	update := redis.IngestionCacheUpdate{Pools: stored, PoolTTL: poolCacheTTL, PoolLists: true, Stats: true}
+	if err := s.cache.ApplyIngestionCacheUpdate(ctx, update); err != nil {
+		log.Warn().Err(err).Int("pools", len(stored)).Msg("Failed to update the Redis cache, skipping pool update publishing")
+		return
+	}
+
+	// Publish updates for WebSocket clients
+	updates := poolUpdates(previous, toPublish)
+	if err := s.cache.PublishPoolUpdates(ctx, updates); err != nil {
+		log.Debug().Err(err).Int("pools", len(toPublish)).Msg("Failed to publish pool updates")
+	}
+	s.logEvents(updates)
+	log.Debug().
+		Int("published", len(toPublish)).
+		Int("stored", len(stored)).
+		Str("mode", s.config.PublishMode).
+		Msg("Published pool updates")
+}
+
+// countHistoryWrites adds the historical data points of a run to the shared
+// counts the API server exports
+func (s *Service) countHistoryWrites(ctx context.Context, result Result) {
+	if s.counter == nil || result.HistoryWritten+result.HistorySkipped == 0 {
+		return
+	}
+
+	log.Debug().
+		Int("written", result.HistoryWritten).
+		Int("skipped", result.HistorySkipped).
+		Msg("Recorded historical data points")
+	if err := s.counter.AddHistoryWrites(ctx, int64(result.HistoryWritten), int64(result.HistorySkipped)); err != nil {
+		log.Debug().Err(err).Msg("Failed to count historical data points")
+	}
+}
+
+// sanitizeAPY keeps the reported APY in APYRaw and clamps the APY, base APY
+// and reward APY to the plausible range, so scores and sorting use the
+// clamped values. Reports whether any of them was out of range, which flags
+// the pool as an outlier.
+func (s *Service) sanitizeAPY(pool *models.Pool) bool {
+	low := decimal.NewFromFloat(s.config.APYMin)
+	high := decimal.NewFromFloat(s.config.APYMax)
+
+	pool.APYRaw = pool.APY
+	pool.IsOutlier = false
+	for _, apy := range []*decimal.Decimal{&pool.APY, &pool.APYBase, &pool.APYReward} {
+		switch {
+		case apy.LessThan(low):
+			*apy = low
+			pool.IsOutlier = true
+		case apy.GreaterThan(high):
+			*apy = high
+			pool.IsOutlier = true
+		}
+	}
+	return pool.IsOutlier
+}
+
+// applyCuration attaches the stored curation to pools, which arrive from
+// their source without one, so risk levels, the cache and pool updates
+// carry it. If it can't be read the pools are left uncurated.
+func (s *Service) applyCuration(ctx context.Context, pools []models.Pool) {
+	ids := make([]string, len(pools))
+	for i, pool := range pools {
+		ids[i] = pool.ID
+	}
+
+	curations, err := s.curations.GetPoolCurations(ctx, ids)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read pool curations, ingesting pools uncurated")
+		return
+	}
+	models.ApplyCuration(pools, curations)
+}
+
+// loadTagger prepares the tagging rules from the current protocol
+// categories. When they can't be read the last loaded ones are used, so a
+// failed read doesn't strip the protocol tags of every pool; before any load
+// succeeded only the symbol rules apply.
+func (s *Service) loadTagger(ctx context.Context) *models.Tagger {
+	categories, err := s.categories.ListProtocolCategories(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load protocol categories, tagging with the last loaded ones")
+		if tagger := s.tagger.Load(); tagger != nil {
+			return tagger
+		}
+		return models.NewTagger(nil)
+	}
+
+	tagger := models.NewTagger(categories)
+	s.tagger.Store(tagger)
+	return tagger
+}
+
+// cachedPools returns the cached copies of pools from the previous cycle.
+// If the cache can't be read it returns false, and every pool is published
+// without a change summary so updates are never lost.
+//
+// The cache is overwritten every cycle, so a pool drifting by less than an
+// epsilon per cycle is never published; its latest values are still served
+// over REST.
+func (s *Service) cachedPools(ctx context.Context, pools []models.Pool) (map[string]models.Pool, bool) {
+	ids := make([]string, len(pools))
+	for i, pool := range pools {
+		ids[i] = pool.ID
+	}
+
+	cached, err := s.cache.GetPools(ctx, ids)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read cached pools, publishing all updates")
+		return nil, false
+	}
+	return cached, true
+}
+
+// logEvents appends published pool updates to the event log, if there is
+// one. Failures are logged and never affect ingestion.
+func (s *Service) logEvents(updates []models.PoolUpdate) {
+	if s.events == nil {
+		return
+	}
+	for i := range updates {
+		if err := s.events.Append(eventlog.TypePoolUpdate, &updates[i]); err != nil {
+			log.Warn().Err(err).Msg("Failed to log pool updates")
+			return
+		}
+	}
+}
+
+// poolUpdates pairs each pool with its changes since its copy in previous.
+// Pools absent from previous, such as newly listed ones, carry no changes.
+func poolUpdates(previous map[string]models.Pool, pools []models.Pool) []models.PoolUpdate {
+	updates := make([]models.PoolUpdate, len(pools))
+	for i, pool := range pools {
+		updates[i].Pool = pool
+		if prev, ok := previous[pool.ID]; ok {
+			changes := models.DiffPool(prev, pool)
+			updates[i].Changes = &changes
+		}
+	}
+	return updates
+}
+
+// changedPools returns the pools that are absent from previous or moved
+// beyond the configured epsilons
+func changedPools(previous map[string]models.Pool, pools []models.Pool, cfg config.IngestionConfig) []models.Pool {
+	changed := make([]models.Pool, 0, len(pools))
+	for _, pool := range pools {
+		prev, ok := previous[pool.ID]
+		if ok && !poolMoved(prev, pool, cfg) {
+			continue
+		}
+		changed = append(changed, pool)
+	}
+	return changed
+}
+
+// poolMoved reports whether APY or score moved by more than their absolute
+// epsilons, or TVL by more than its epsilon relative to the previous TVL
+func poolMoved(prev, cur models.Pool, cfg config.IngestionConfig) bool {
+	if cur.APY.Sub(prev.APY).Abs().GreaterThan(decimal.NewFromFloat(cfg.PublishAPYEpsilon)) {
+		return true
+	}
+	if cur.Score.Sub(prev.Score).Abs().GreaterThan(decimal.NewFromFloat(cfg.PublishScoreEpsilon)) {
+		return true
+	}
+
+	tvlDelta := cur.TVL.Sub(prev.TVL).Abs()
+	if prev.TVL.IsZero() {
+		return !tvlDelta.IsZero()
+	}
+	return tvlDelta.Div(prev.TVL.Abs()).GreaterThan(decimal.NewFromFloat(cfg.PublishTVLEpsilon))
+}
+
+// recordRiskTransitions stores each pool's risk level and logs a transition
+// for every pool whose level differs from the stored one. Only changes are
+// written; a pool's first level is stored without a transition. Failures are
+// logged and retried implicitly by the next cycle, which still sees the old
+// level.
+func (s *Service) recordRiskTransitions(ctx context.Context, pools []models.Pool) {
+	ids := make([]string, len(pools))
+	for i, pool := range pools {
+		ids[i] = pool.ID
+	}
+
+	stored, err := s.risk.GetPoolRiskLevels(ctx, ids)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read pool risk levels")
+		return
+	}
+
+	now := time.Now().UTC()
+	levels := make(map[string]models.RiskLevel)
+	transitions := make([]models.RiskTransition, 0)
+	for i := range pools {
+		level, factors := s.analytics.AssessRisk(&pools[i])
+
+		prev, ok := stored[pools[i].ID]
+		if ok && prev == level {
+			continue
+		}
+		levels[pools[i].ID] = level
+
+		if ok {
+			transitions = append(transitions, models.RiskTransition{
+				PoolID:         pools[i].ID,
+				FromLevel:      prev,
+				ToLevel:        level,
+				Factors:        factors,
+				TransitionedAt: now,
+			})
+		}
+	}
+
+	if err := s.risk.SavePoolRiskLevels(ctx, levels, transitions); err != nil {
+		log.Warn().Err(err).Int("transitions", len(transitions)).Msg("Failed to save pool risk levels")
+		return
+	}
+	if len(transitions) > 0 {
+		log.Info().Int("transitions", len(transitions)).Msg("Recorded pool risk level transitions")
+	}
+}
+
+// registerReviewChains counts pools on chains without a reviewed security
+// rating, records them in the chain registry and flags newly seen chains for
+// review. Registry failures are logged; ingestion continues regardless.
+func (s *Service) registerReviewChains(ctx context.Context, pools []models.Pool) {
+	counts := make(map[string]int)
+	for _, pool := range pools {
+		if s.analytics.ChainNeedsReview(pool.Chain) {
+			counts[strings.ToLower(pool.Chain)]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	chains := make([]models.ChainMetadata, 0, len(counts))
+	for chain, count := range counts {
+		chains = append(chains, models.ChainMetadata{
+			Chain:          chain,
+			SecurityRating: analytics.UnknownChainSecurityRating,
+			GasCostUSD:     analytics.UnknownChainGasCostUSD,
+			NeedsReview:    true,
+			PoolCount:      count,
+		})
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].Chain < chains[j].Chain })
+
+	log.Warn().Interface("pools_by_chain", counts).Msg("Ingested pools from chains awaiting security review")
+
+	created, err := s.chains.EnsureChainMetadata(ctx, chains)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to register chains awaiting review")
+	}
+	if len(created) > 0 {
+		log.Warn().Strs("chains", created).Msg("Registered new chains with conservative defaults")
+	}
+
+	names := make([]string, len(chains))
+	for i, c := range chains {
+		names[i] = c.Chain
+	}
+	s.analytics.MarkChainsForReview(names)
+}
@@ -0,0 +1,543 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+)
+
+// fakeRegistry keeps registered chains in memory like chain_metadata
+type fakeRegistry struct {
+	rows map[string]models.ChainMetadata
+}
+
+func (f *fakeRegistry) EnsureChainMetadata(ctx context.Context, chains []models.ChainMetadata) ([]string, error) {
+	created := make([]string, 0)
+	for _, c := range chains {
+		if existing, ok := f.rows[c.Chain]; ok {
+			existing.PoolCount = c.PoolCount
+			f.rows[c.Chain] = existing
+			continue
+		}
+		f.rows[c.Chain] = c
+		created = append(created, c.Chain)
+	}
+	return created, nil
+}
+
+func TestRegisterReviewChains_NewChain(t *testing.T) {
+	registry := &fakeRegistry{rows: make(map[string]models.ChainMetadata)}
+	svc := &Service{
+		analytics: analytics.NewService(config.ScoringConfig{}),
+		chains:    registry,
+	}
+
+	feed := []models.Pool{
+		{ID: "a", Chain: "Ethereum"},
+		{ID: "b", Chain: "Monad"},
+		{ID: "c", Chain: "monad"},
+	}
+	svc.registerReviewChains(context.Background(), feed)
+
+	if len(registry.rows) != 1 {
+		t.Fatalf("Expected only the new chain to be registered, got %v", registry.rows)
+	}
+	row, ok := registry.rows["monad"]
+	if !ok {
+		t.Fatalf("Expected a chain_metadata row for monad, got %v", registry.rows)
+	}
+	if !row.NeedsReview || row.PoolCount != 2 || row.SecurityRating != analytics.UnknownChainSecurityRating || row.GasCostUSD != analytics.UnknownChainGasCostUSD {
+		t.Errorf("Expected conservative defaults flagged for review with 2 pools, got %+v", row)
+	}
+
+	// A later run refreshes the count but keeps flagging the chain
+	svc.registerReviewChains(context.Background(), feed[:2])
+	if got := registry.rows["monad"].PoolCount; got != 1 {
+		t.Errorf("Expected pool count refreshed to 1, got %d", got)
+	}
+
+	// Pools on the chain are never rated low risk, even with strong metrics
+	pool := &models.Pool{
+		Chain: "monad",
+		APY:   decimal.NewFromFloat(5),
+		TVL:   decimal.NewFromFloat(500000000),
+		Score: decimal.NewFromFloat(90),
+	}
+	if level := svc.analytics.CalculateRiskLevel(pool); level == models.RiskLevelLow {
+		t.Errorf("Expected at least medium risk on a chain awaiting review, got %s", level)
+	}
+}
+
+func TestChangedPools(t *testing.T) {
+	pool := func(id string, apy, tvl, score float64) models.Pool {
+		return models.Pool{
+			ID:    id,
+			APY:   decimal.NewFromFloat(apy),
+			TVL:   decimal.NewFromFloat(tvl),
+			Score: decimal.NewFromFloat(score),
+		}
+	}
+
+	previous := map[string]models.Pool{
+		"same":        pool("same", 5, 1000000, 60),
+		"apy-noise":   pool("apy-noise", 5, 1000000, 60),
+		"apy":         pool("apy", 5, 1000000, 60),
+		"tvl-noise":   pool("tvl-noise", 5, 1000000, 60),
+		"tvl":         pool("tvl", 5, 1000000, 60),
+		"score-noise": pool("score-noise", 5, 1000000, 60),
+		"score":       pool("score", 5, 1000000, 60),
+		"from-zero":   pool("from-zero", 5, 0, 60),
+	}
+	current := []models.Pool{
+		pool("same", 5, 1000000, 60),
+		pool("apy-noise", 5.005, 1000000, 60),
+		pool("apy", 5.5, 1000000, 60),
+		pool("tvl-noise", 5, 1000500, 60),
+		pool("tvl", 5, 1200000, 60),
+		pool("score-noise", 5, 1000000, 60.05),
+		pool("score", 5, 1000000, 61),
+		pool("from-zero", 5, 1000, 60),
+		pool("new", 3, 500000, 40),
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.IngestionConfig
+		want []string
+	}{
+		{
+			name: "epsilons",
+			cfg:  config.IngestionConfig{PublishAPYEpsilon: 0.01, PublishTVLEpsilon: 0.001, PublishScoreEpsilon: 0.1},
+			want: []string{"apy", "tvl", "score", "from-zero", "new"},
+		},
+		{
+			name: "zero epsilons publish any change",
+			cfg:  config.IngestionConfig{},
+			want: []string{"apy-noise", "apy", "tvl-noise", "tvl", "score-noise", "score", "from-zero", "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := changedPools(previous, current, tt.cfg)
+
+			got := make([]string, len(changed))
+			for i, p := range changed {
+				got[i] = p.ID
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+// fakeRiskStore keeps pool risk levels and transitions in memory
+func TestHistoryGate(t *testing.T) {
+	cfg := config.IngestionConfig{HistoryAPYEpsilon: 0.01, HistoryTVLEpsilon: 0.001, HistoryHeartbeat: time.Hour}
+	start := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	pool := func(apy, base, tvl float64) models.Pool {
+		return models.Pool{
+			ID:        "pool-1",
+			APY:       decimal.NewFromFloat(apy),
+			APYBase:   decimal.NewFromFloat(base),
+			APYReward: decimal.NewFromFloat(apy - base),
+			TVL:       decimal.NewFromFloat(tvl),
+		}
+	}
+
+	var gate historyGate
+	if !gate.due(pool(5, 3, 1_000_000), start, cfg) {
+		t.Fatal("Expected a pool's first point recorded")
+	}
+	gate.recorded(models.HistoricalAPY{
+		PoolID:    "pool-1",
+		Timestamp: start,
+		APY:       decimal.NewFromFloat(5),
+		APYBase:   decimal.NewFromFloat(3),
+		APYReward: decimal.NewFromFloat(2),
+		TVL:       decimal.NewFromFloat(1_000_000),
+	})
+
+	tests := []struct {
+		name  string
+		pool  models.Pool
+		after time.Duration
+		want  bool
+	}{
+		{"unchanged", pool(5, 3, 1_000_000), 3 * time.Minute, false},
+		{"within epsilons", pool(5.005, 3, 1_000_500), 3 * time.Minute, false},
+		{"apy moved", pool(5.02, 3, 1_000_000), 3 * time.Minute, true},
+		{"base and reward traded places", pool(5, 2, 1_000_000), 3 * time.Minute, true},
+		{"tvl moved", pool(5, 3, 1_002_000), 3 * time.Minute, true},
+		{"unchanged just before the heartbeat", pool(5, 3, 1_000_000), 59 * time.Minute, false},
+		{"heartbeat", pool(5, 3, 1_000_000), time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gate.due(tt.pool, start.Add(tt.after), cfg); got != tt.want {
+				t.Errorf("Expected due %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	cfg.HistoryHeartbeat = 0
+	if !gate.due(pool(5, 3, 1_000_000), start.Add(time.Minute), cfg) {
+		t.Error("Expected every cycle recorded without a heartbeat")
+	}
+}
+
+type fakeRiskStore struct {
+	levels      map[string]models.RiskLevel
+	transitions []models.RiskTransition
+}
+
+func (f *fakeRiskStore) GetPoolRiskLevels(ctx context.Context, poolIDs []string) (map[string]models.RiskLevel, error) {
+	levels := make(map[string]models.RiskLevel)
+	for _, id := range poolIDs {
+		if level, ok := f.levels[id]; ok {
+			levels[id] = level
+		}
+	}
+	return levels, nil
+}
+
+func (f *fakeRiskStore) SavePoolRiskLevels(ctx context.Context, levels map[string]models.RiskLevel, transitions []models.RiskTransition) error {
+	for id, level := range levels {
+		f.levels[id] = level
+	}
+	f.transitions = append(f.transitions, transitions...)
+	return nil
+}
+
+func TestPoolUpdates(t *testing.T) {
+	d := decimal.RequireFromString
+	previous := map[string]models.Pool{
+		"known": {ID: "known", APY: d("5"), TVL: d("1000"), Score: d("60")},
+	}
+	pools := []models.Pool{
+		{ID: "known", APY: d("5.5"), TVL: d("1000"), Score: d("60")},
+		{ID: "new", APY: d("3"), TVL: d("500"), Score: d("40")},
+	}
+
+	updates := poolUpdates(previous, pools)
+
+	known := updates[0]
+	if known.Changes == nil || known.Changes.APY == nil || known.Changes.APY.Delta.String() != "0.5" {
+		t.Fatalf("Expected an APY delta of 0.5, got %+v", known.Changes)
+	}
+	if known.Changes.TVL != nil || known.Changes.Score != nil {
+		t.Errorf("Expected only APY in the changes, got %+v", known.Changes)
+	}
+
+	// A pool seen for the first time has nothing to compare with
+	if updates[1].Changes != nil {
+		t.Errorf("Expected no changes for a new pool, got %+v", updates[1].Changes)
+	}
+
+	// The pool is encoded flat, so consumers decoding a Pool are unaffected
+	raw, err := json.Marshal(updates[1])
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, ok := fields["changes"]; ok {
+		t.Errorf("Expected changes omitted for a new pool, got %s", raw)
+	}
+	var pool models.Pool
+	if err := json.Unmarshal(raw, &pool); err != nil || pool.ID != "new" {
+		t.Errorf("Expected the update to decode as a pool, got %+v (%v)", pool, err)
+	}
+}
+
+func TestSanitizeAPY(t *testing.T) {
+	d := decimal.RequireFromString
+	svc := &Service{config: config.IngestionConfig{APYMin: -100, APYMax: 100000}}
+
+	tests := []struct {
+		name        string
+		pool        models.Pool
+		wantAPY     string
+		wantReward  string
+		wantOutlier bool
+	}{
+		{"plausible", models.Pool{APY: d("12.5"), APYReward: d("2")}, "12.5", "2", false},
+		{"negative within range", models.Pool{APY: d("-3")}, "-3", "0", false},
+		{"below the minimum", models.Pool{APY: d("-250")}, "-100", "0", true},
+		{"above the maximum", models.Pool{APY: d("4000000"), APYReward: d("3999990")}, "100000", "100000", true},
+		{"reward only out of range", models.Pool{APY: d("50"), APYReward: d("200000")}, "50", "100000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := tt.pool
+			raw := pool.APY
+
+			if got := svc.sanitizeAPY(&pool); got != tt.wantOutlier || pool.IsOutlier != tt.wantOutlier {
+				t.Errorf("Expected outlier %v, got %v (flag %v)", tt.wantOutlier, got, pool.IsOutlier)
+			}
+			if !pool.APYRaw.Equal(raw) {
+				t.Errorf("Expected the raw APY %s kept, got %s", raw, pool.APYRaw)
+			}
+			if !pool.APY.Equal(d(tt.wantAPY)) || !pool.APYReward.Equal(d(tt.wantReward)) {
+				t.Errorf("Expected APY %s and reward %s, got %s and %s", tt.wantAPY, tt.wantReward, pool.APY, pool.APYReward)
+			}
+		})
+	}
+}
+
+func TestRecordRiskTransitions_TVLCollapse(t *testing.T) {
+	store := &fakeRiskStore{levels: make(map[string]models.RiskLevel)}
+	svc := &Service{
+		analytics: analytics.NewService(config.ScoringConfig{}),
+		risk:      store,
+	}
+
+	// One pool per cycle as its TVL collapses and its score follows
+	cycles := []struct {
+		tvl   int64
+		score int64
+	}{
+		{10_000_000, 70}, // low: first level, stored without a transition
+		{10_000_000, 70}, // low
+		{5_000_000, 65},  // low
+		{50_000, 45},     // medium
+		{40_000, 40},     // medium
+		{5_000, 20},      // high
+		{4_000, 18},      // high
+	}
+	for _, c := range cycles {
+		pool := models.Pool{
+			ID:    "pool-1",
+			Chain: "ethereum",
+			APY:   decimal.NewFromInt(5),
+			TVL:   decimal.NewFromInt(c.tvl),
+			Score: decimal.NewFromInt(c.score),
+		}
+		svc.recordRiskTransitions(context.Background(), []models.Pool{pool})
+	}
+
+	if len(store.transitions) != 2 {
+		t.Fatalf("Expected one transition per level change (2), got %d: %+v", len(store.transitions), store.transitions)
+	}
+
+	first, second := store.transitions[0], store.transitions[1]
+	if first.FromLevel != models.RiskLevelLow || first.ToLevel != models.RiskLevelMedium {
+		t.Errorf("Expected low -> medium, got %s -> %s", first.FromLevel, first.ToLevel)
+	}
+	if first.Factors.TVL != 50_000 || len(first.Factors.Triggered) != 1 || first.Factors.Triggered[0] != models.RiskFactorTVLBelow100K {
+		t.Errorf("Expected the TVL drop as the only factor, got %+v", first.Factors)
+	}
+	if second.FromLevel != models.RiskLevelMedium || second.ToLevel != models.RiskLevelHigh {
+		t.Errorf("Expected medium -> high, got %s -> %s", second.FromLevel, second.ToLevel)
+	}
+	if second.Factors.Score != 20 || second.Factors.ChainRating != 95 || len(second.Factors.Triggered) != 3 {
+		t.Errorf("Expected TVL and score factors at score 20 on a 95-rated chain, got %+v", second.Factors)
+	}
+	if store.levels["pool-1"] != models.RiskLevelHigh {
+		t.Errorf("Expected the stored level to be high, got %s", store.levels["pool-1"])
+	}
+}
+
+// fakeCategories serves protocol categories, or fails with err
+type fakeCategories struct {
+	categories []models.ProtocolCategory
+	err        error
+}
+
+func (f *fakeCategories) ListProtocolCategories(ctx context.Context) ([]models.ProtocolCategory, error) {
+	return f.categories, f.err
+}
+
+func TestLoadTagger_KeepsLastRules(t *testing.T) {
+	source := &fakeCategories{err: errors.New("connection refused")}
+	svc := &Service{categories: source}
+	pool := &models.Pool{Protocol: "curve-dex", Symbol: "STETH-ETH"}
+
+	// Before any load only the symbol rules apply
+	if tags := svc.loadTagger(context.Background()).Tags(pool); !reflect.DeepEqual(tags, []string{models.TagLiquidStaking}) {
+		t.Errorf("Expected only the symbol tag, got %v", tags)
+	}
+
+	source.categories, source.err = []models.ProtocolCategory{{Protocol: "curve-dex", Category: models.TagDEXLP}}, nil
+	want := []string{models.TagDEXLP, models.TagLiquidStaking}
+	if tags := svc.loadTagger(context.Background()).Tags(pool); !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected %v, got %v", want, tags)
+	}
+
+	// A failed load keeps the protocol tags
+	source.categories, source.err = nil, errors.New("connection refused")
+	if tags := svc.loadTagger(context.Background()).Tags(pool); !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected the last loaded rules to give %v, got %v", want, tags)
+	}
+}
+
+// recordingCache passes calls on to the Redis repository, recording their
+// order
+type recordingCache struct {
+	*redis.Repository
+	calls []string
+}
+
+func (c *recordingCache) ApplyIngestionCacheUpdate(ctx context.Context, update redis.IngestionCacheUpdate) error {
+	c.calls = append(c.calls, "apply")
+	return c.Repository.ApplyIngestionCacheUpdate(ctx, update)
+}
+
+func (c *recordingCache) PublishPoolUpdates(ctx context.Context, updates []models.PoolUpdate) error {
+	c.calls = append(c.calls, "publish")
+	return c.Repository.PublishPoolUpdates(ctx, updates)
+}
+
+func TestUpdateCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		corrupt     bool // The pool list generation isn't a number, failing the transaction
+		wantCalls   []string
+		wantPublish bool
+	}{
+		{"published after the cache update", false, []string{"apply", "publish"}, true},
+		{"nothing published when the update fails", true, []string{"apply"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			repo, err := redis.NewRepository(context.Background(), config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			if tt.corrupt {
+				mr.Set(redis.KeyPoolsGeneration, "corrupt")
+			}
+
+			sub := repo.SubscribePoolUpdates(context.Background())
+			defer sub.Close()
+			if _, err := sub.Receive(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			cache := &recordingCache{Repository: repo}
+			svc := &Service{config: config.IngestionConfig{PublishMode: config.PublishModeAll}, cache: cache}
+			svc.updateCache(context.Background(), []models.Pool{{ID: "pool-1"}})
+
+			if !reflect.DeepEqual(cache.calls, tt.wantCalls) {
+				t.Errorf("Expected calls %v, got %v", tt.wantCalls, cache.calls)
+			}
+
+			select {
+			case msg := <-sub.Channel():
+				if !tt.wantPublish {
+					t.Errorf("Expected nothing published, got %s", msg.Payload)
+				} else if pool, err := repo.GetPool(context.Background(), "pool-1"); err != nil || pool == nil {
+					t.Errorf("Expected the pool cached before its update was published, got %v (%v)", pool, err)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.wantPublish {
+					t.Error("Expected the pool update published")
+				}
+			}
+		})
+	}
+}
+
+// fakeCurations keeps pool curations in memory like pool_curation
+type fakeCurations struct {
+	curations map[string]models.PoolCuration
+}
+
+func (f *fakeCurations) GetPoolCurations(ctx context.Context, poolIDs []string) (map[string]models.PoolCuration, error) {
+	found := make(map[string]models.PoolCuration)
+	for _, id := range poolIDs {
+		if c, ok := f.curations[id]; ok {
+			found[id] = c
+		}
+	}
+	return found, nil
+}
+
+func TestApplyCuration_SurvivesReingest(t *testing.T) {
+	mr := miniredis.RunT(t)
+	repo, err := redis.NewRepository(context.Background(), config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	curations := &fakeCurations{curations: make(map[string]models.PoolCuration)}
+	risk := &fakeRiskStore{levels: make(map[string]models.RiskLevel)}
+	svc := &Service{
+		config:    config.IngestionConfig{PublishMode: config.PublishModeAll},
+		cache:     repo,
+		analytics: analytics.NewService(config.ScoringConfig{}),
+		risk:      risk,
+		curations: curations,
+	}
+
+	// Each cycle ingests the pool as the source reports it, uncurated, with
+	// 30% of its 35% APY from rewards
+	ingest := func() models.Pool {
+		pools := []models.Pool{{
+			ID:        "pool-1",
+			Chain:     "ethereum",
+			APY:       decimal.NewFromInt(35),
+			APYReward: decimal.NewFromInt(30),
+			TVL:       decimal.NewFromInt(10_000_000),
+			Score:     decimal.NewFromInt(70),
+		}}
+		svc.applyCuration(context.Background(), pools)
+		svc.recordRiskTransitions(context.Background(), pools)
+		svc.updateCache(context.Background(), pools)
+		return pools[0]
+	}
+
+	if pool := ingest(); pool.Curation != nil || risk.levels["pool-1"] != models.RiskLevelLow {
+		t.Fatalf("Expected an uncurated low risk pool, got %+v at %s", pool.Curation, risk.levels["pool-1"])
+	}
+
+	// An admin curates the emissions as adjustable at will
+	curations.curations["pool-1"] = models.PoolCuration{RewardSchedule: models.RewardScheduleAdjustable, Notes: "3/5 multisig"}
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		pool := ingest()
+		if pool.Curation == nil || pool.Curation.RewardSchedule != models.RewardScheduleAdjustable {
+			t.Fatalf("Cycle %d: expected the curation to survive re-ingestion, got %+v", cycle, pool.Curation)
+		}
+
+		cached, err := repo.GetPool(context.Background(), "pool-1")
+		if err != nil || cached == nil || cached.Curation == nil || cached.Curation.Notes != "3/5 multisig" {
+			t.Fatalf("Cycle %d: expected the cached pool to carry the curation, got %+v (%v)", cycle, cached, err)
+		}
+	}
+
+	// The adjustable rewards raised the risk once, and it held
+	if len(risk.transitions) != 1 {
+		t.Fatalf("Expected one risk transition, got %+v", risk.transitions)
+	}
+	transition := risk.transitions[0]
+	if transition.ToLevel != models.RiskLevelMedium || !reflect.DeepEqual(transition.Factors.Triggered, []string{models.RiskFactorAdjustableReward}) {
+		t.Errorf("Expected medium risk from the adjustable rewards, got %s from %v", transition.ToLevel, transition.Factors.Triggered)
+	}
+}
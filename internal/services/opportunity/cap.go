@@ -0,0 +1,46 @@
+package opportunity
+
+import (
+	"sort"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// CapDetections keeps the highest-scoring opportunities of a detection run:
+// at most OpportunityMaxPerType of each type and OpportunityMaxPerRun in
+// all. It is applied to the merged output of every detector, so a type that
+// finds many opportunities competes on score with the others instead of
+// crowding them out. The kept opportunities are returned best first with
+// the number discarded per type.
+func (s *Service) CapDetections(detected []models.Opportunity) ([]models.Opportunity, map[models.OpportunityType]int) {
+	cfg := s.Thresholds()
+	return capDetections(detected, cfg.OpportunityMaxPerType, cfg.OpportunityMaxPerRun)
+}
+
+// capDetections ranks opportunities by score, ties broken by ID so the same
+// candidates always keep the same ones, and keeps the best within
+// maxPerType per type and maxTotal in all (0 = no cap)
+func capDetections(detected []models.Opportunity, maxPerType, maxTotal int) ([]models.Opportunity, map[models.OpportunityType]int) {
+	ranked := make([]models.Opportunity, len(detected))
+	copy(ranked, detected)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if !ranked[i].Score.Equal(ranked[j].Score) {
+			return ranked[i].Score.GreaterThan(ranked[j].Score)
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	kept := make([]models.Opportunity, 0, len(ranked))
+	perType := make(map[models.OpportunityType]int)
+	discarded := make(map[models.OpportunityType]int)
+	for _, opp := range ranked {
+		if (maxPerType > 0 && perType[opp.Type] >= maxPerType) || (maxTotal > 0 && len(kept) >= maxTotal) {
+			discarded[opp.Type]++
+			continue
+		}
+		perType[opp.Type]++
+		kept = append(kept, opp)
+	}
+
+	return kept, discarded
+}
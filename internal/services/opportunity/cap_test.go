@@ -0,0 +1,101 @@
+package opportunity
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// candidates returns n opportunities of a type scoring score(i), with IDs
+// in reverse order of i so ties can't be kept by insertion order
+func candidates(oppType models.OpportunityType, n int, score func(i int) float64) []models.Opportunity {
+	opps := make([]models.Opportunity, n)
+	for i := range opps {
+		opps[i] = models.Opportunity{
+			ID:    fmt.Sprintf("%s-%03d", oppType, n-i),
+			Type:  oppType,
+			Score: decimal.NewFromFloat(score(i)),
+		}
+	}
+	return opps
+}
+
+func TestCapDetections_KeepsTopKByScore(t *testing.T) {
+	// 150 high-score candidates scoring 0-149 in insertion order, the best
+	// inserted last
+	detected := candidates(models.OpportunityTypeHighScore, 150, func(i int) float64 { return float64(i) })
+
+	kept, discarded := capDetections(detected, 50, 0)
+	if len(kept) != 50 || discarded[models.OpportunityTypeHighScore] != 100 {
+		t.Fatalf("Expected 50 kept and 100 discarded, got %d and %v", len(kept), discarded)
+	}
+	for i, opp := range kept {
+		if want := decimal.NewFromInt(int64(149 - i)); !opp.Score.Equal(want) {
+			t.Errorf("Expected rank %d to score %s, got %s", i, want, opp.Score)
+		}
+	}
+}
+
+func TestCapDetections_BreaksTiesByID(t *testing.T) {
+	detected := candidates(models.OpportunityTypeHighScore, 10, func(i int) float64 { return 80 })
+
+	for run := 0; run < 3; run++ {
+		kept, _ := capDetections(detected, 3, 0)
+		ids := []string{kept[0].ID, kept[1].ID, kept[2].ID}
+		if ids[0] != "high-score-001" || ids[1] != "high-score-002" || ids[2] != "high-score-003" {
+			t.Fatalf("Expected the lowest IDs among equal scores, got %v", ids)
+		}
+	}
+}
+
+func TestCapDetections_RanksAcrossTypes(t *testing.T) {
+	var detected []models.Opportunity
+	detected = append(detected, candidates(models.OpportunityTypeHighScore, 100, func(i int) float64 { return 50 + float64(i)/10 })...)
+	detected = append(detected, candidates(models.OpportunityTypeTrending, 20, func(i int) float64 { return 90 })...)
+	detected = append(detected, candidates(models.OpportunityTypeYieldGap, 5, func(i int) float64 { return 40 })...)
+
+	tests := []struct {
+		name       string
+		maxPerType int
+		maxTotal   int
+		wantKept   map[models.OpportunityType]int
+	}{
+		{"no caps", 0, 0, map[models.OpportunityType]int{"high-score": 100, "trending": 20, "yield-gap": 5}},
+		{"per type", 10, 0, map[models.OpportunityType]int{"high-score": 10, "trending": 10, "yield-gap": 5}},
+		{"per run", 0, 30, map[models.OpportunityType]int{"high-score": 10, "trending": 20}},
+		{"both", 15, 30, map[models.OpportunityType]int{"high-score": 15, "trending": 15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, discarded := capDetections(detected, tt.maxPerType, tt.maxTotal)
+
+			got := make(map[models.OpportunityType]int)
+			for _, opp := range kept {
+				got[opp.Type]++
+			}
+			for _, oppType := range []models.OpportunityType{"high-score", "trending", "yield-gap"} {
+				if got[oppType] != tt.wantKept[oppType] {
+					t.Errorf("Expected %d %s kept, got %d", tt.wantKept[oppType], oppType, got[oppType])
+				}
+				if total := got[oppType] + discarded[oppType]; total != len(filterType(detected, oppType)) {
+					t.Errorf("Expected every %s kept or discarded, got %d of %d", oppType, total, len(filterType(detected, oppType)))
+				}
+			}
+		})
+	}
+}
+
+// filterType returns the opportunities of one type
+func filterType(opps []models.Opportunity, oppType models.OpportunityType) []models.Opportunity {
+	var matched []models.Opportunity
+	for _, opp := range opps {
+		if opp.Type == oppType {
+			matched = append(matched, opp)
+		}
+	}
+	return matched
+}
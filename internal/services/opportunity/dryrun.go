@@ -0,0 +1,161 @@
+package opportunity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// dryRunTopNew caps the added opportunities listed in a dry-run report
+const dryRunTopNew = 20
+
+// ErrInvalidThresholds is returned by DryRun when the thresholds after
+// applying the overrides are unusable
+var ErrInvalidThresholds = errors.New("invalid detection thresholds")
+
+// DryRun runs yield gap, trending and high-score detection against current
+// pool data with the live thresholds plus overrides, and compares what it
+// finds with the active opportunities. Nothing is stored or published and
+// the live thresholds are left as they are.
+func (s *Service) DryRun(ctx context.Context, overrides models.DetectionThresholdOverrides) (*models.DetectionDryRunReport, error) {
+	cfg := applyOverrides(s.Thresholds(), overrides)
+	if err := cfg.ValidateThresholds(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidThresholds, err)
+	}
+
+	gaps, scan, err := s.detectYieldGaps(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	trending, err := s.detectTrendingPools(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	highScore, err := s.detectHighScorePools(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := s.store.ListActiveOpportunities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active opportunities: %w", err)
+	}
+
+	detected := make([]models.Opportunity, 0, len(gaps)+len(trending)+len(highScore))
+	detected = append(detected, gaps...)
+	detected = append(detected, trending...)
+	detected = append(detected, highScore...)
+
+	report := compareDetections(detected, active)
+	report.Thresholds = models.DetectionThresholds{
+		MinTVL:            cfg.MinTVLThreshold,
+		YieldGapMinProfit: cfg.YieldGapMinProfit,
+		APYJumpThreshold:  cfg.APYJumpThreshold,
+		MinScore:          cfg.HighScoreMinScore,
+	}
+	report.YieldGapScan = scan
+	report.GeneratedAt = time.Now().UTC()
+
+	log.Info().
+		Int("detected", report.Detected).
+		Int("active", report.Active).
+		Int("added", report.Added).
+		Int("removed", report.Removed).
+		Int("changed", report.Changed).
+		Msg("Completed opportunity detection dry run")
+
+	return report, nil
+}
+
+// applyOverrides returns cfg with the set overrides applied
+func applyOverrides(cfg config.WorkerConfig, overrides models.DetectionThresholdOverrides) config.WorkerConfig {
+	if overrides.MinTVL != nil {
+		cfg.MinTVLThreshold = *overrides.MinTVL
+	}
+	if overrides.YieldGapMinProfit != nil {
+		cfg.YieldGapMinProfit = *overrides.YieldGapMinProfit
+	}
+	if overrides.APYJumpThreshold != nil {
+		cfg.APYJumpThreshold = *overrides.APYJumpThreshold
+	}
+	if overrides.MinScore != nil {
+		cfg.HighScoreMinScore = *overrides.MinScore
+	}
+	return cfg
+}
+
+// compareDetections diffs detected opportunities against active ones by
+// identity. Active is expected newest first: earlier detections of the same
+// opportunity that haven't expired yet are ignored.
+func compareDetections(detected, active []models.Opportunity) *models.DetectionDryRunReport {
+	current := make(map[string]models.Opportunity, len(active))
+	for _, opp := range active {
+		key := opportunityKey(opp)
+		if _, ok := current[key]; !ok {
+			current[key] = opp
+		}
+	}
+
+	report := &models.DetectionDryRunReport{Active: len(current)}
+	seen := make(map[string]bool, len(detected))
+	added := make([]models.Opportunity, 0)
+
+	for _, opp := range detected {
+		key := opportunityKey(opp)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		report.Detected++
+
+		prev, ok := current[key]
+		switch {
+		case !ok:
+			added = append(added, opp)
+		case opportunityChanged(prev, opp):
+			report.Changed++
+		default:
+			report.Unchanged++
+		}
+	}
+
+	for key := range current {
+		if !seen[key] {
+			report.Removed++
+		}
+	}
+
+	sort.SliceStable(added, func(i, j int) bool {
+		if !added[i].Score.Equal(added[j].Score) {
+			return added[i].Score.GreaterThan(added[j].Score)
+		}
+		return added[i].PotentialProfit.GreaterThan(added[j].PotentialProfit)
+	})
+	report.Added = len(added)
+	report.TopNew = added[:min(len(added), dryRunTopNew)]
+
+	return report
+}
+
+// opportunityKey identifies an opportunity across detection runs: its type
+// and the pools it involves
+func opportunityKey(opp models.Opportunity) string {
+	return strings.Join([]string{string(opp.Type), opp.PoolID, opp.SourcePoolID, opp.TargetPoolID}, "|")
+}
+
+// opportunityChanged reports whether a detection differs from the stored
+// opportunity, comparing at the precision the opportunities table keeps
+func opportunityChanged(stored, detected models.Opportunity) bool {
+	return !stored.CurrentAPY.Round(6).Equal(detected.CurrentAPY.Round(6)) ||
+		!stored.PotentialProfit.Round(6).Equal(detected.PotentialProfit.Round(6)) ||
+		!stored.Score.Round(2).Equal(detected.Score.Round(2)) ||
+		stored.RiskLevel != detected.RiskLevel
+}
@@ -0,0 +1,132 @@
+package opportunity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+)
+
+// newDryRunService builds a service whose active opportunities are what the
+// live thresholds detect: the 9-point DAI gap and the two pools scoring 70+
+func newDryRunService(t *testing.T) (*Service, *fakeStore) {
+	t.Helper()
+
+	pools := []models.Pool{
+		{ID: "dai-high", Chain: "arbitrum", Protocol: "high", Symbol: "DAI", APY: decimal.NewFromFloat(10), TVL: decimal.NewFromFloat(100000000), Score: decimal.NewFromFloat(50)},
+		{ID: "dai-low", Chain: "arbitrum", Protocol: "low", Symbol: "DAI", APY: decimal.NewFromFloat(1), TVL: decimal.NewFromFloat(100000000), Score: decimal.NewFromFloat(85)},
+		{ID: "usdc-high", Chain: "arbitrum", Protocol: "high", Symbol: "USDC", APY: decimal.NewFromFloat(5), TVL: decimal.NewFromFloat(100000000), Score: decimal.NewFromFloat(75)},
+		{ID: "usdc-low", Chain: "arbitrum", Protocol: "low", Symbol: "USDC", APY: decimal.NewFromFloat(2), TVL: decimal.NewFromFloat(100000000), Score: decimal.NewFromFloat(60)},
+	}
+
+	store := &fakeStore{}
+	service := &Service{
+		config: config.WorkerConfig{
+			MinTVLThreshold:   100000,
+			YieldGapMinProfit: 5,
+			APYJumpThreshold:  50,
+			HighScoreMinScore: 70,
+		},
+		pools:     &fakePager{pools: pools},
+		store:     store,
+		analytics: analytics.NewService(config.ScoringConfig{}),
+	}
+
+	ctx := context.Background()
+	gaps, err := service.DetectYieldGaps(ctx)
+	if err != nil {
+		t.Fatalf("DetectYieldGaps failed: %v", err)
+	}
+	highScore, err := service.DetectHighScorePools(ctx)
+	if err != nil {
+		t.Fatalf("DetectHighScorePools failed: %v", err)
+	}
+	if len(gaps) != 1 || len(highScore) != 2 {
+		t.Fatalf("Expected 1 yield gap and 2 high-score pools live, got %d and %d", len(gaps), len(highScore))
+	}
+	store.opportunities = append(gaps, highScore...)
+
+	return service, store
+}
+
+func TestDryRun_Overrides(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	ctx := context.Background()
+
+	t.Run("live thresholds match the active set", func(t *testing.T) {
+		service, _ := newDryRunService(t)
+
+		report, err := service.DryRun(ctx, models.DetectionThresholdOverrides{})
+		if err != nil {
+			t.Fatalf("DryRun failed: %v", err)
+		}
+		if report.Detected != 3 || report.Active != 3 || report.Unchanged != 3 ||
+			report.Added != 0 || report.Removed != 0 || report.Changed != 0 {
+			t.Errorf("Expected no differences, got %+v", report)
+		}
+	})
+
+	t.Run("lower gap threshold adds opportunities", func(t *testing.T) {
+		service, store := newDryRunService(t)
+
+		report, err := service.DryRun(ctx, models.DetectionThresholdOverrides{YieldGapMinProfit: float(2)})
+		if err != nil {
+			t.Fatalf("DryRun failed: %v", err)
+		}
+		if report.Detected <= report.Active || report.Added != 1 || report.Removed != 0 {
+			t.Fatalf("Expected strictly more opportunities with one added, got %+v", report)
+		}
+		if len(report.TopNew) != 1 || report.TopNew[0].SourcePoolID != "usdc-low" || report.TopNew[0].TargetPoolID != "usdc-high" {
+			t.Errorf("Expected the USDC gap as the new candidate, got %+v", report.TopNew)
+		}
+		if report.Thresholds.YieldGapMinProfit != 2 || report.Thresholds.MinScore != 70 {
+			t.Errorf("Expected the override applied over the live thresholds, got %+v", report.Thresholds)
+		}
+
+		// Nothing is persisted and the live thresholds are untouched
+		if len(store.opportunities) != 3 {
+			t.Errorf("Expected the active set unchanged, got %d opportunities", len(store.opportunities))
+		}
+		if cfg := service.Thresholds(); cfg.YieldGapMinProfit != 5 {
+			t.Errorf("Expected the live gap threshold kept, got %v", cfg.YieldGapMinProfit)
+		}
+	})
+
+	t.Run("higher score threshold removes opportunities", func(t *testing.T) {
+		service, _ := newDryRunService(t)
+
+		report, err := service.DryRun(ctx, models.DetectionThresholdOverrides{MinScore: float(80)})
+		if err != nil {
+			t.Fatalf("DryRun failed: %v", err)
+		}
+		if report.Detected >= report.Active || report.Removed != 1 || report.Added != 0 || len(report.TopNew) != 0 {
+			t.Errorf("Expected strictly fewer opportunities with one removed, got %+v", report)
+		}
+	})
+
+	t.Run("changed metrics", func(t *testing.T) {
+		service, store := newDryRunService(t)
+		store.opportunities[0].CurrentAPY = decimal.NewFromFloat(9)
+
+		report, err := service.DryRun(ctx, models.DetectionThresholdOverrides{})
+		if err != nil {
+			t.Fatalf("DryRun failed: %v", err)
+		}
+		if report.Changed != 1 || report.Unchanged != 2 {
+			t.Errorf("Expected one changed opportunity, got %+v", report)
+		}
+	})
+
+	t.Run("invalid override", func(t *testing.T) {
+		service, _ := newDryRunService(t)
+
+		if _, err := service.DryRun(ctx, models.DetectionThresholdOverrides{MinScore: float(150)}); !errors.Is(err, ErrInvalidThresholds) {
+			t.Errorf("Expected ErrInvalidThresholds, got %v", err)
+		}
+	})
+}
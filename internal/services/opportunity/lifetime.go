@@ -0,0 +1,113 @@
+package opportunity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Built-in opportunity lifetimes, used when the TTL settings are unset
+const (
+	defaultYieldGapTTL  = time.Hour
+	defaultTrendingTTL  = 6 * time.Hour
+	defaultHighScoreTTL = 24 * time.Hour // High-score pools are stable
+)
+
+// detectionStore reads and writes the stored copies of detected
+// opportunities. Implemented by the PostgreSQL repository.
+type detectionStore interface {
+	GetOpportunityLifetimes(ctx context.Context, ids []string) (map[string]models.Opportunity, error)
+	ArchiveOpportunity(ctx context.Context, id string) error
+	UpsertOpportunity(ctx context.Context, opp *models.Opportunity) error
+}
+
+// opportunityTTL returns how long an opportunity of the given type stays
+// active after it was last detected
+func opportunityTTL(cfg config.WorkerConfig, oppType models.OpportunityType) time.Duration {
+	ttl, fallback := cfg.HighScoreTTL, defaultHighScoreTTL
+	switch oppType {
+	case models.OpportunityTypeYieldGap:
+		ttl, fallback = cfg.YieldGapTTL, defaultYieldGapTTL
+	case models.OpportunityTypeTrending:
+		ttl, fallback = cfg.TrendingTTL, defaultTrendingTTL
+	}
+	if ttl <= 0 {
+		return fallback
+	}
+	return ttl
+}
+
+// detectionID derives an opportunity's ID from its type and pools, so
+// detecting the same opportunity again updates the stored one
+func detectionID(oppType models.OpportunityType, poolIDs ...string) string {
+	name := string(oppType) + "/" + strings.Join(poolIDs, "/")
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("defi-yield-aggregator/opportunity/"+name)).String()
+}
+
+// SaveDetections stores the opportunities found by a detection run and
+// returns them as stored. An opportunity that is still active slides its
+// expiry forward from the new last_seen_at and keeps its detected_at. One
+// that reappears after it expired or was retracted starts a new detection
+// event: the old row is archived under a new ID, keeping its outcome, and a
+// fresh row takes over the ID.
+func (s *Service) SaveDetections(ctx context.Context, detected []models.Opportunity) ([]models.Opportunity, error) {
+	if len(detected) == 0 {
+		return detected, nil
+	}
+
+	ids := make([]string, len(detected))
+	for i, opp := range detected {
+		ids[i] = opp.ID
+	}
+	stored, err := s.detections.GetOpportunityLifetimes(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored opportunities: %w", err)
+	}
+
+	saved := make([]models.Opportunity, 0, len(detected))
+	for _, opp := range detected {
+		var previous *models.Opportunity
+		if p, ok := stored[opp.ID]; ok {
+			previous = &p
+		}
+
+		merged, archive := mergeDetection(previous, opp)
+		if archive {
+			if err := s.detections.ArchiveOpportunity(ctx, opp.ID); err != nil {
+				return saved, fmt.Errorf("failed to archive opportunity %s: %w", opp.ID, err)
+			}
+		}
+		if err := s.detections.UpsertOpportunity(ctx, &merged); err != nil {
+			return saved, fmt.Errorf("failed to save opportunity %s: %w", opp.ID, err)
+		}
+		saved = append(saved, merged)
+	}
+
+	return saved, nil
+}
+
+// mergeDetection decides how a detection is stored given the stored
+// opportunity with the same ID, if any. It returns the opportunity to
+// upsert and whether the stored one ended and must be archived first.
+func mergeDetection(stored *models.Opportunity, detected models.Opportunity) (models.Opportunity, bool) {
+	if stored == nil {
+		return detected, false
+	}
+
+	// Expired or retracted: a new detection event with its own detected_at
+	if !stored.IsActive || !stored.ExpiresAt.After(detected.LastSeenAt) {
+		return detected, true
+	}
+
+	// Still live: the detected copy already expires a TTL after
+	// last_seen_at, so only the start of the event is carried over
+	detected.DetectedAt = stored.DetectedAt
+	detected.CreatedAt = stored.CreatedAt
+	return detected, false
+}
@@ -0,0 +1,179 @@
+package opportunity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// fakeDetectionStore keeps opportunities by ID like the opportunities table
+// and records archived IDs
+type fakeDetectionStore struct {
+	rows     map[string]models.Opportunity
+	archived []models.Opportunity
+}
+
+func (f *fakeDetectionStore) GetOpportunityLifetimes(ctx context.Context, ids []string) (map[string]models.Opportunity, error) {
+	found := make(map[string]models.Opportunity)
+	for _, id := range ids {
+		if o, ok := f.rows[id]; ok {
+			found[id] = o
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeDetectionStore) ArchiveOpportunity(ctx context.Context, id string) error {
+	o := f.rows[id]
+	o.IsActive = false
+	f.archived = append(f.archived, o)
+	delete(f.rows, id)
+	return nil
+}
+
+func (f *fakeDetectionStore) UpsertOpportunity(ctx context.Context, opp *models.Opportunity) error {
+	stored, ok := f.rows[opp.ID]
+	if !ok {
+		f.rows[opp.ID] = *opp
+		return nil
+	}
+	// The ON CONFLICT SET list
+	stored.IsActive = opp.IsActive
+	stored.LastSeenAt = opp.LastSeenAt
+	stored.ExpiresAt = opp.ExpiresAt
+	f.rows[opp.ID] = stored
+	return nil
+}
+
+// detectAt returns a yield gap detected at the given time with a 1h TTL
+func detectAt(at time.Time) models.Opportunity {
+	return models.Opportunity{
+		ID:         detectionID(models.OpportunityTypeYieldGap, "src", "dst"),
+		Type:       models.OpportunityTypeYieldGap,
+		IsActive:   true,
+		DetectedAt: at,
+		LastSeenAt: at,
+		ExpiresAt:  at.Add(time.Hour),
+		CreatedAt:  at,
+	}
+}
+
+func TestSaveDetections(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeDetectionStore{rows: make(map[string]models.Opportunity)}
+	s := &Service{detections: store}
+	id := detectAt(start).ID
+
+	save := func(at time.Time) models.Opportunity {
+		t.Helper()
+		saved, err := s.SaveDetections(context.Background(), []models.Opportunity{detectAt(at)})
+		if err != nil || len(saved) != 1 {
+			t.Fatalf("Failed to save detection: %v", err)
+		}
+		return saved[0]
+	}
+
+	// First detection
+	save(start)
+	if got := store.rows[id]; !got.DetectedAt.Equal(start) || !got.ExpiresAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Expected a new opportunity expiring in 1h, got %+v", got)
+	}
+
+	// Slide-forward: re-detected while live
+	saved := save(start.Add(50 * time.Minute))
+	got := store.rows[id]
+	if !got.DetectedAt.Equal(start) || !got.ExpiresAt.Equal(start.Add(110*time.Minute)) || !got.LastSeenAt.Equal(start.Add(50*time.Minute)) {
+		t.Errorf("Expected the expiry to slide to 1h after last seen with detected_at kept, got %+v", got)
+	}
+	if !saved.DetectedAt.Equal(start) {
+		t.Errorf("Expected the saved copy to carry the original detected_at, got %s", saved.DetectedAt)
+	}
+	if len(store.archived) != 0 {
+		t.Errorf("Expected nothing archived, got %d", len(store.archived))
+	}
+
+	// Natural expiry: not re-detected, the opportunity ages out where it is
+	if !got.ExpiresAt.Before(start.Add(3 * time.Hour)) {
+		t.Errorf("Expected the opportunity to expire without re-detection, got %s", got.ExpiresAt)
+	}
+
+	// Reappearance after expiry: a fresh detection event
+	reappeared := start.Add(3 * time.Hour)
+	save(reappeared)
+	got = store.rows[id]
+	if !got.DetectedAt.Equal(reappeared) || !got.ExpiresAt.Equal(reappeared.Add(time.Hour)) || !got.IsActive {
+		t.Errorf("Expected a fresh detection event at %s, got %+v", reappeared, got)
+	}
+	if len(store.archived) != 1 || !store.archived[0].DetectedAt.Equal(start) || store.archived[0].IsActive {
+		t.Errorf("Expected the ended event archived inactive with its detected_at, got %+v", store.archived)
+	}
+}
+
+func TestMergeDetection(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	live := detectAt(start)
+	retracted := detectAt(start)
+	retracted.IsActive = false
+
+	tests := []struct {
+		name         string
+		stored       *models.Opportunity
+		at           time.Time
+		wantDetected time.Time
+		wantArchive  bool
+	}{
+		{"new", nil, start, start, false},
+		{"live", &live, start.Add(30 * time.Minute), start, false},
+		{"expired", &live, start.Add(time.Hour), start.Add(time.Hour), true},
+		{"retracted", &retracted, start.Add(10 * time.Minute), start.Add(10 * time.Minute), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, archive := mergeDetection(tt.stored, detectAt(tt.at))
+			if archive != tt.wantArchive || !merged.DetectedAt.Equal(tt.wantDetected) {
+				t.Errorf("Expected detected_at %s and archive=%v, got %s and %v", tt.wantDetected, tt.wantArchive, merged.DetectedAt, archive)
+			}
+			if !merged.ExpiresAt.Equal(tt.at.Add(time.Hour)) {
+				t.Errorf("Expected expiry 1h after last seen, got %s", merged.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestDetectionID(t *testing.T) {
+	a := detectionID(models.OpportunityTypeYieldGap, "src", "dst")
+	if a != detectionID(models.OpportunityTypeYieldGap, "src", "dst") {
+		t.Error("Expected the same ID for the same opportunity")
+	}
+	for _, other := range []string{
+		detectionID(models.OpportunityTypeYieldGap, "dst", "src"),
+		detectionID(models.OpportunityTypeTrending, "src"),
+		detectionID(models.OpportunityTypeHighScore, "src"),
+	} {
+		if other == a {
+			t.Errorf("Expected different opportunities to get different IDs, got %s twice", a)
+		}
+	}
+}
+
+func TestOpportunityTTL(t *testing.T) {
+	cfg := config.WorkerConfig{TrendingTTL: 2 * time.Hour}
+
+	tests := []struct {
+		oppType models.OpportunityType
+		want    time.Duration
+	}{
+		{models.OpportunityTypeYieldGap, time.Hour},
+		{models.OpportunityTypeTrending, 2 * time.Hour},
+		{models.OpportunityTypeHighScore, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := opportunityTTL(cfg, tt.oppType); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.oppType, tt.want, got)
+		}
+	}
+}
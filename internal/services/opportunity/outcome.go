@@ -0,0 +1,193 @@
+package opportunity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+const (
+	// outcomeSettleDelay gives the fetch job time to store the history that
+	// closes an opportunity's evaluation window
+	outcomeSettleDelay = 10 * time.Minute
+
+	// trendingOutcomeWindow is how long after detection a trending pool is
+	// followed
+	trendingOutcomeWindow = 24 * time.Hour
+
+	// outcomeLookback bounds how far back expired opportunities are still
+	// given an outcome
+	outcomeLookback = 30 * 24 * time.Hour
+
+	// outcomeBatchSize is how many opportunities are judged per history query
+	outcomeBatchSize = 200
+
+	// minOutcomePoints is the history a series needs to be judged on
+	minOutcomePoints = 2
+)
+
+// confirmedShare is the share of the detected edge that must hold up for an
+// opportunity to count as confirmed
+var confirmedShare = decimal.NewFromFloat(0.5)
+
+// outcomeStore finds expired opportunities awaiting an outcome, reads the
+// APY history they are judged on and records the outcomes. Implemented by
+// the PostgreSQL repository.
+type outcomeStore interface {
+	ListOpportunitiesAwaitingOutcome(ctx context.Context, expiredBefore, detectedBefore, since time.Time, limit int) ([]models.Opportunity, error)
+	GetAPYSeries(ctx context.Context, windows []models.APYWindow) ([][]models.APYPoint, error)
+	SaveOpportunityOutcomes(ctx context.Context, outcomes []models.OpportunityOutcome) error
+}
+
+// ComputeOutcomes records what actually happened to yield-gap and trending
+// opportunities whose evaluation window has passed. Expired opportunities
+// without an outcome form the queue, so none are lost if the worker
+// restarts. Returns the number of outcomes recorded.
+func (s *Service) ComputeOutcomes(ctx context.Context) (int, error) {
+	now := time.Now()
+	expiredBefore := now.Add(-outcomeSettleDelay)
+	detectedBefore := now.Add(-trendingOutcomeWindow - outcomeSettleDelay)
+	since := now.Add(-outcomeLookback)
+
+	recorded := 0
+	for ctx.Err() == nil {
+		pending, err := s.outcomes.ListOpportunitiesAwaitingOutcome(ctx, expiredBefore, detectedBefore, since, outcomeBatchSize)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to list opportunities awaiting outcome: %w", err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		outcomes, err := s.judgeOutcomes(ctx, pending)
+		if err != nil {
+			return recorded, err
+		}
+		if err := s.outcomes.SaveOpportunityOutcomes(ctx, outcomes); err != nil {
+			return recorded, fmt.Errorf("failed to save opportunity outcomes: %w", err)
+		}
+		recorded += len(outcomes)
+
+		if len(pending) < outcomeBatchSize {
+			break
+		}
+	}
+
+	if recorded > 0 {
+		log.Info().Int("count", recorded).Msg("Recorded opportunity outcomes")
+	}
+
+	return recorded, nil
+}
+
+// judgeOutcomes reads the history of a batch of opportunities in one query
+// and classifies each of them
+func (s *Service) judgeOutcomes(ctx context.Context, pending []models.Opportunity) ([]models.OpportunityOutcome, error) {
+	windows := make([]models.APYWindow, 0, 2*len(pending))
+	for _, opp := range pending {
+		windows = append(windows, outcomeWindows(opp)...)
+	}
+
+	series, err := s.outcomes.GetAPYSeries(ctx, windows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read opportunity history: %w", err)
+	}
+
+	outcomes := make([]models.OpportunityOutcome, len(pending))
+	next := 0
+	for i, opp := range pending {
+		switch opp.Type {
+		case models.OpportunityTypeYieldGap:
+			outcomes[i] = yieldGapOutcome(opp, series[next], series[next+1])
+			next += 2
+		default:
+			outcomes[i] = trendingOutcome(opp, series[next])
+			next++
+		}
+	}
+
+	return outcomes, nil
+}
+
+// outcomeWindows returns the history an opportunity is judged on: the
+// source and target pools over a yield gap's lifetime, or a trending pool
+// over the day after detection
+func outcomeWindows(opp models.Opportunity) []models.APYWindow {
+	if opp.Type == models.OpportunityTypeYieldGap {
+		return []models.APYWindow{
+			{PoolID: opp.SourcePoolID, From: opp.DetectedAt, To: opp.ExpiresAt},
+			{PoolID: opp.TargetPoolID, From: opp.DetectedAt, To: opp.ExpiresAt},
+		}
+	}
+	return []models.APYWindow{
+		{PoolID: opp.PoolID, From: opp.DetectedAt, To: opp.DetectedAt.Add(trendingOutcomeWindow)},
+	}
+}
+
+// yieldGapOutcome judges a yield gap on the average APY difference between
+// its target and source pools over its lifetime. It is confirmed if at
+// least half of the detected difference persisted, faded if less did, and
+// reversed if the target paid no more than the source.
+func yieldGapOutcome(opp models.Opportunity, source, target []models.APYPoint) models.OpportunityOutcome {
+	outcome := models.OpportunityOutcome{OpportunityID: opp.ID, Class: models.OutcomeUnknown}
+	if len(source) < minOutcomePoints || len(target) < minOutcomePoints {
+		return outcome
+	}
+
+	realized := averageAPY(target).Sub(averageAPY(source)).Round(6)
+	outcome.RealizedAPYDiff = &realized
+
+	switch {
+	case !realized.IsPositive():
+		outcome.Class = models.OutcomeReversed
+	case realized.GreaterThanOrEqual(opp.APYDifference.Mul(confirmedShare)):
+		outcome.Class = models.OutcomeConfirmed
+	default:
+		outcome.Class = models.OutcomeFaded
+	}
+
+	return outcome
+}
+
+// trendingOutcome judges a trending pool on its APY at the end of the day
+// after detection. It is confirmed if the APY held or kept rising, reversed
+// if it gave back at least half of the jump that got it detected, and faded
+// in between. The realized difference is the APY change since detection.
+func trendingOutcome(opp models.Opportunity, series []models.APYPoint) models.OpportunityOutcome {
+	outcome := models.OpportunityOutcome{OpportunityID: opp.ID, Class: models.OutcomeUnknown}
+	if len(series) < minOutcomePoints {
+		return outcome
+	}
+
+	final := series[len(series)-1].APY
+	realized := final.Sub(opp.CurrentAPY).Round(6)
+	outcome.RealizedAPYDiff = &realized
+
+	// Halfway between the APY before the jump and the APY at detection
+	midpoint := opp.CurrentAPY.Sub(opp.APYGrowth.Div(decimal.NewFromInt(2)))
+
+	switch {
+	case final.GreaterThanOrEqual(opp.CurrentAPY):
+		outcome.Class = models.OutcomeConfirmed
+	case final.LessThanOrEqual(midpoint):
+		outcome.Class = models.OutcomeReversed
+	default:
+		outcome.Class = models.OutcomeFaded
+	}
+
+	return outcome
+}
+
+// averageAPY returns the mean APY of a non-empty series
+func averageAPY(series []models.APYPoint) decimal.Decimal {
+	sum := decimal.Zero
+	for _, p := range series {
+		sum = sum.Add(p.APY)
+	}
+	return sum.Div(decimal.NewFromInt(int64(len(series))))
+}
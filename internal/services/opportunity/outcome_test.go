@@ -0,0 +1,189 @@
+package opportunity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// series builds an APY history with one reading every step from start
+func series(start time.Time, step time.Duration, apys ...float64) []models.APYPoint {
+	points := make([]models.APYPoint, len(apys))
+	for i, apy := range apys {
+		points[i] = models.APYPoint{Timestamp: start.Add(time.Duration(i) * step), APY: decimal.NewFromFloat(apy)}
+	}
+	return points
+}
+
+func TestYieldGapOutcome(t *testing.T) {
+	detected := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	opp := models.Opportunity{
+		ID:            "gap-1",
+		Type:          models.OpportunityTypeYieldGap,
+		APYDifference: decimal.NewFromInt(4), // Target paid 8%, source 4%
+		DetectedAt:    detected,
+		ExpiresAt:     detected.Add(time.Hour),
+	}
+	source := series(detected, 15*time.Minute, 4, 4, 4, 4, 4)
+
+	tests := []struct {
+		name      string
+		target    []models.APYPoint
+		wantClass models.OutcomeClass
+		wantDiff  string
+	}{
+		{"gap persisted", series(detected, 15*time.Minute, 8, 8, 7, 7, 7.5), models.OutcomeConfirmed, "3.5"},
+		{"gap narrowed", series(detected, 15*time.Minute, 8, 6, 5, 4.5, 4.5), models.OutcomeFaded, "1.6"},
+		{"gap closed", series(detected, 15*time.Minute, 8, 3, 3, 3, 3), models.OutcomeReversed, "0"},
+		{"gap flipped", series(detected, 15*time.Minute, 3, 3, 2, 2, 2), models.OutcomeReversed, "-1.6"},
+		{"too little history", series(detected, 15*time.Minute, 8), models.OutcomeUnknown, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := yieldGapOutcome(opp, source, tt.target)
+			if got.OpportunityID != opp.ID || got.Class != tt.wantClass {
+				t.Fatalf("Expected %s, got %+v", tt.wantClass, got)
+			}
+			if tt.wantDiff == "" {
+				if got.RealizedAPYDiff != nil {
+					t.Errorf("Expected no realized difference, got %s", got.RealizedAPYDiff)
+				}
+				return
+			}
+			if got.RealizedAPYDiff == nil || !got.RealizedAPYDiff.Equal(decimal.RequireFromString(tt.wantDiff)) {
+				t.Errorf("Expected realized difference %s, got %v", tt.wantDiff, got.RealizedAPYDiff)
+			}
+		})
+	}
+}
+
+func TestTrendingOutcome(t *testing.T) {
+	detected := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Detected at 20% after jumping 10 points from 10%
+	opp := models.Opportunity{
+		ID:         "trend-1",
+		Type:       models.OpportunityTypeTrending,
+		APYGrowth:  decimal.NewFromInt(10),
+		CurrentAPY: decimal.NewFromInt(20),
+		DetectedAt: detected,
+	}
+
+	tests := []struct {
+		name      string
+		history   []models.APYPoint
+		wantClass models.OutcomeClass
+		wantDiff  string
+	}{
+		{"kept rising", series(detected, 6*time.Hour, 20, 22, 25, 24, 26), models.OutcomeConfirmed, "6"},
+		{"held", series(detected, 6*time.Hour, 20, 18, 19, 21, 20), models.OutcomeConfirmed, "0"},
+		{"gave back some", series(detected, 6*time.Hour, 20, 19, 17, 16, 17), models.OutcomeFaded, "-3"},
+		{"mean-reverted", series(detected, 6*time.Hour, 20, 16, 12, 11, 10), models.OutcomeReversed, "-10"},
+		{"back to the midpoint", series(detected, 6*time.Hour, 20, 15), models.OutcomeReversed, "-5"},
+		{"too little history", series(detected, 6*time.Hour, 20), models.OutcomeUnknown, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trendingOutcome(opp, tt.history)
+			if got.OpportunityID != opp.ID || got.Class != tt.wantClass {
+				t.Fatalf("Expected %s, got %+v", tt.wantClass, got)
+			}
+			if tt.wantDiff == "" {
+				if got.RealizedAPYDiff != nil {
+					t.Errorf("Expected no realized difference, got %s", got.RealizedAPYDiff)
+				}
+				return
+			}
+			if got.RealizedAPYDiff == nil || !got.RealizedAPYDiff.Equal(decimal.RequireFromString(tt.wantDiff)) {
+				t.Errorf("Expected realized difference %s, got %v", tt.wantDiff, got.RealizedAPYDiff)
+			}
+		})
+	}
+}
+
+// fakeOutcomeStore queues pending opportunities and serves synthetic APY
+// history by pool ID, recording the history queries it gets
+type fakeOutcomeStore struct {
+	pending []models.Opportunity
+	history map[string][]models.APYPoint
+	queries [][]models.APYWindow
+	saved   []models.OpportunityOutcome
+}
+
+func (f *fakeOutcomeStore) ListOpportunitiesAwaitingOutcome(ctx context.Context, expiredBefore, detectedBefore, since time.Time, limit int) ([]models.Opportunity, error) {
+	n := min(limit, len(f.pending))
+	batch := f.pending[:n]
+	f.pending = f.pending[n:]
+	return batch, nil
+}
+
+func (f *fakeOutcomeStore) GetAPYSeries(ctx context.Context, windows []models.APYWindow) ([][]models.APYPoint, error) {
+	f.queries = append(f.queries, windows)
+	result := make([][]models.APYPoint, len(windows))
+	for i, w := range windows {
+		for _, p := range f.history[w.PoolID] {
+			if !p.Timestamp.Before(w.From) && !p.Timestamp.After(w.To) {
+				result[i] = append(result[i], p)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeOutcomeStore) SaveOpportunityOutcomes(ctx context.Context, outcomes []models.OpportunityOutcome) error {
+	f.saved = append(f.saved, outcomes...)
+	return nil
+}
+
+func TestComputeOutcomes(t *testing.T) {
+	detected := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeOutcomeStore{
+		history: map[string][]models.APYPoint{
+			"src":   series(detected, 15*time.Minute, 4, 4, 4, 4, 4),
+			"dst":   series(detected, 15*time.Minute, 8, 8, 8, 8, 8, 1, 1), // Drops after expiry
+			"trend": series(detected, 6*time.Hour, 20, 12, 10, 10, 10, 40), // Spikes after the window
+		},
+	}
+	store.pending = append(store.pending, models.Opportunity{
+		ID: "trend-1", Type: models.OpportunityTypeTrending, PoolID: "trend",
+		APYGrowth: decimal.NewFromInt(10), CurrentAPY: decimal.NewFromInt(20), DetectedAt: detected,
+	})
+	// Enough yield gaps to take more than one batch
+	for i := 0; i < outcomeBatchSize; i++ {
+		store.pending = append(store.pending, models.Opportunity{
+			ID: "gap", Type: models.OpportunityTypeYieldGap, SourcePoolID: "src", TargetPoolID: "dst",
+			APYDifference: decimal.NewFromInt(4), DetectedAt: detected, ExpiresAt: detected.Add(time.Hour),
+		})
+	}
+
+	s := &Service{outcomes: store}
+	recorded, err := s.ComputeOutcomes(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if recorded != outcomeBatchSize+1 || len(store.saved) != recorded {
+		t.Fatalf("Expected %d outcomes recorded, got %d (%d saved)", outcomeBatchSize+1, recorded, len(store.saved))
+	}
+	// One history query per batch, with two windows per yield gap
+	if len(store.queries) != 2 || len(store.queries[0]) != 2*outcomeBatchSize-1 || len(store.queries[1]) != 2 {
+		t.Fatalf("Expected two batched history queries, got %d", len(store.queries))
+	}
+	if w := store.queries[0][0]; w.PoolID != "trend" || !w.To.Equal(detected.Add(24*time.Hour)) {
+		t.Errorf("Expected the trending pool followed for 24h, got %+v", w)
+	}
+
+	if store.saved[0].OpportunityID != "trend-1" || store.saved[0].Class != models.OutcomeReversed {
+		t.Errorf("Expected the trending pool reversed, got %+v", store.saved[0])
+	}
+	for _, o := range store.saved[1:] {
+		if o.Class != models.OutcomeConfirmed || !o.RealizedAPYDiff.Equal(decimal.NewFromInt(4)) {
+			t.Fatalf("Expected yield gaps confirmed on their lifetime only, got %+v", o)
+		}
+	}
+}
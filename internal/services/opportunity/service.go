@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/shopspring/decimal"
 
@@ -20,12 +20,52 @@ import (
 	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
 )
 
+// defaultYieldGapBatchSize is used when YIELD_GAP_BATCH_SIZE is unset
+const defaultYieldGapBatchSize = 1000
+
+// defaultTrendingFetchLimit is used when TRENDING_FETCH_LIMIT is unset
+const defaultTrendingFetchLimit = 100
+
+// poolReader lists pools for detection.
+// Implemented by the PostgreSQL repository.
+type poolReader interface {
+	ListPools(ctx context.Context, filter models.PoolFilter) ([]models.Pool, int64, error)
+	ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error)
+	GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error)
+}
+
+// opportunityStore lists active opportunities and finds and deactivates
+// those whose pools went away. Implemented by the PostgreSQL repository.
+type opportunityStore interface {
+	ListActiveOpportunities(ctx context.Context) ([]models.Opportunity, error)
+	GetUnavailableOpportunityPools(ctx context.Context, staleBefore time.Time) (stale, deleted []string, err error)
+	DeactivateOpportunitiesForPools(ctx context.Context, poolIDs []string, reason string) ([]models.OpportunityRetraction, error)
+}
+
+// retractionPublisher announces retracted opportunities and drops the cached
+// lists that still contain them. Implemented by the Redis repository.
+type retractionPublisher interface {
+	PublishOpportunityRetractions(ctx context.Context, retractions []models.OpportunityRetraction) error
+	InvalidateOpportunitiesCache(ctx context.Context) error
+}
+
 // Service handles opportunity detection and analysis
 type Service struct {
-	config    config.WorkerConfig
-	pgRepo    *postgres.Repository
-	redisRepo *redis.Repository
-	analytics *analytics.Service
+	// mu guards config, whose detection thresholds can be swapped at runtime,
+	// and lastScan
+	mu         sync.RWMutex
+	config     config.WorkerConfig
+	lastScan   models.YieldGapScan
+	chains     config.ChainFilter // Skips pools stored before a chain was filtered out
+	pgRepo     *postgres.Repository
+	pools      poolReader
+	store      opportunityStore
+	outcomes   outcomeStore
+	detections detectionStore
+	history    apySeriesReader
+	redisRepo  *redis.Repository
+	publisher  retractionPublisher
+	analytics  *analytics.Service
 }
 
 // NewService creates a new opportunity detection service
@@ -36,60 +76,127 @@ func NewService(
 	analytics *analytics.Service,
 ) *Service {
 	return &Service{
-		config:    cfg,
-		pgRepo:    pg,
-		redisRepo: redis,
-		analytics: analytics,
+		config:     cfg,
+		chains:     cfg.ChainFilter(),
+		pgRepo:     pg,
+		pools:      pg,
+		store:      pg,
+		outcomes:   pg,
+		detections: pg,
+		history:    pg,
+		redisRepo:  redis,
+		publisher:  redis,
+		analytics:  analytics,
+	}
+}
+
+// Thresholds returns the detection settings currently in use
+func (s *Service) Thresholds() config.WorkerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.config
+}
+
+// SetThresholds validates and atomically swaps in the detection thresholds
+// of cfg: its TVL, APY, profit, volume, score and sustainability floors.
+// Its other settings, such as batch sizes, caps and TTLs, are only read at
+// startup. Invalid thresholds are rejected and the current ones are kept.
+func (s *Service) SetThresholds(cfg config.WorkerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := withThresholds(s.config, cfg)
+	if err := next.ValidateThresholds(); err != nil {
+		return err
 	}
+
+	s.config = next
+	return nil
+}
+
+// withThresholds returns cfg with the detection thresholds of from
+func withThresholds(cfg, from config.WorkerConfig) config.WorkerConfig {
+	cfg.MinTVLThreshold = from.MinTVLThreshold
+	cfg.MinAPYThreshold = from.MinAPYThreshold
+	cfg.YieldGapMinProfit = from.YieldGapMinProfit
+	cfg.APYJumpThreshold = from.APYJumpThreshold
+	cfg.MinVolumeTVLRatio = from.MinVolumeTVLRatio
+	cfg.HighScoreMaxRewardRatio = from.HighScoreMaxRewardRatio
+	cfg.HighScoreMinScore = from.HighScoreMinScore
+	cfg.SustainableMinBaseRatio = from.SustainableMinBaseRatio
+	cfg.SustainableMinBaseAPY = from.SustainableMinBaseAPY
+	return cfg
+}
+
+// LastYieldGapScan returns the summary of the most recent DetectYieldGaps run
+func (s *Service) LastYieldGapScan() models.YieldGapScan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastScan
 }
 
 // DetectYieldGaps finds yield gap arbitrage opportunities
 // This identifies the same asset with different APYs across protocols
 func (s *Service) DetectYieldGaps(ctx context.Context) ([]models.Opportunity, error) {
-	log.Debug().Msg("Detecting yield gap opportunities")
-
-	// Fetch all pools above minimum TVL
-	filter := models.PoolFilter{
-		MinTVL: decimal.NewFromFloat(s.config.MinTVLThreshold),
-		Limit:  5000,
+	opportunities, scan, err := s.detectYieldGaps(ctx, s.Thresholds())
+	if err != nil {
+		return nil, err
 	}
 
-	pools, _, err := s.pgRepo.ListPools(ctx, filter)
+	s.mu.Lock()
+	s.lastScan = scan
+	s.mu.Unlock()
+
+	return opportunities, nil
+}
+
+// detectYieldGaps runs yield gap detection with the given thresholds and
+// returns the opportunities along with the scan summary
+func (s *Service) detectYieldGaps(ctx context.Context, cfg config.WorkerConfig) ([]models.Opportunity, models.YieldGapScan, error) {
+	log.Debug().Msg("Detecting yield gap opportunities")
+
+	// Scan every pool above minimum TVL, keeping only the highest and lowest
+	// APY pool per asset so memory stays bounded by the number of assets
+	ranges, scan, err := s.scanAssetRanges(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch pools: %w", err)
+		return nil, scan, fmt.Errorf("failed to fetch pools: %w", err)
 	}
 
-	// Group pools by base asset
-	assetPools := groupPoolsByAsset(pools)
+	logEvent := log.Info()
+	if scan.Truncated {
+		logEvent = log.Warn()
+	}
+	logEvent.
+		Int("pools", scan.PoolsConsidered).
+		Int("assets", scan.AssetsConsidered).
+		Bool("truncated", scan.Truncated).
+		Msg("Scanned pools for yield gaps")
 
 	opportunities := make([]models.Opportunity, 0)
 	now := time.Now().UTC()
 
-	for asset, assetPoolList := range assetPools {
-		if len(assetPoolList) < 2 {
+	for asset, r := range ranges {
+		if r.count < 2 {
 			continue // Need at least 2 pools to compare
 		}
 
-		// Sort by APY descending
-		sort.Slice(assetPoolList, func(i, j int) bool {
-			return assetPoolList[i].APY.GreaterThan(assetPoolList[j].APY)
-		})
-
 		// Compare highest APY pools with lowest APY pools
-		highestPool := assetPoolList[0]
-		lowestPool := assetPoolList[len(assetPoolList)-1]
+		highestPool := r.highest
+		lowestPool := r.lowest
 
 		apyDiff := highestPool.APY.Sub(lowestPool.APY)
 		apyDiffFloat, _ := apyDiff.Float64()
 
 		// Check if difference is above threshold
-		if apyDiffFloat >= s.config.YieldGapMinProfit {
+		if apyDiffFloat >= cfg.YieldGapMinProfit {
 			highAPY, _ := highestPool.APY.Float64()
 			lowAPY, _ := lowestPool.APY.Float64()
 			tvl, _ := highestPool.TVL.Float64()
 
 			// Calculate potential profit
-			profit, minDays := s.analytics.CalculateYieldGapProfit(
+			profit, minDays, costs := s.analytics.CalculateYieldGapProfit(
 				lowAPY, highAPY, tvl,
 				lowestPool.Chain, highestPool.Chain,
 			)
@@ -102,10 +209,10 @@ func (s *Service) DetectYieldGaps(ctx context.Context) ([]models.Opportunity, er
 			riskLevel := s.analytics.CalculateRiskLevel(&highestPool)
 
 			opp := models.Opportunity{
-				ID:              uuid.New().String(),
+				ID:              detectionID(models.OpportunityTypeYieldGap, lowestPool.ID, highestPool.ID),
 				Type:            models.OpportunityTypeYieldGap,
 				Title:           fmt.Sprintf("%s Yield Gap: %.2f%% difference", asset, apyDiffFloat),
-				Description:     fmt.Sprintf("Move %s from %s (%s) at %.2f%% APY to %s (%s) at %.2f%% APY. Potential profit: $%.2f over 30 days (min %d days to break even)", asset, lowestPool.Protocol, lowestPool.Chain, lowAPY, highestPool.Protocol, highestPool.Chain, highAPY, profit, minDays),
+				Description:     fmt.Sprintf("Move %s from %s (%s) at %.2f%% APY to %s (%s) at %.2f%% APY. Potential profit: $%.2f over 30 days after $%s in costs (min %d days to break even)", asset, lowestPool.Protocol, lowestPool.Chain, lowAPY, highestPool.Protocol, highestPool.Chain, highAPY, profit, costs.TotalUSD.StringFixed(2), minDays) + bridgeAssumption(costs.BridgeCost) + sustainableNote(cfg, &highestPool, "the target APY"),
 				SourcePoolID:    lowestPool.ID,
 				TargetPoolID:    highestPool.ID,
 				Asset:           asset,
@@ -114,12 +221,14 @@ func (s *Service) DetectYieldGaps(ctx context.Context) ([]models.Opportunity, er
 				CurrentAPY:      highestPool.APY,
 				PotentialProfit: decimal.NewFromFloat(profit),
 				TVL:             highestPool.TVL.Add(lowestPool.TVL),
+				Costs:           &costs,
+				ProfitByHorizon: s.analytics.CalculateProfitByHorizon(highAPY-lowAPY, costs, cfg.YieldGapProfitHorizons),
 				RiskLevel:       riskLevel,
 				Score:           highestPool.Score,
 				IsActive:        true,
 				DetectedAt:      now,
 				LastSeenAt:      now,
-				ExpiresAt:       now.Add(1 * time.Hour), // Opportunities expire after 1 hour
+				ExpiresAt:       now.Add(opportunityTTL(cfg, models.OpportunityTypeYieldGap)),
 				CreatedAt:       now,
 				UpdatedAt:       now,
 			}
@@ -142,32 +251,66 @@ func (s *Service) DetectYieldGaps(ctx context.Context) ([]models.Opportunity, er
 		Int("count", len(opportunities)).
 		Msg("Detected yield gap opportunities")
 
-	return opportunities, nil
+	return opportunities, scan, nil
+}
+
+// bridgeAssumption describes the bridge route a cross-chain estimate
+// assumed, or nothing for same-chain moves
+func bridgeAssumption(bridge *models.BridgeCost) string {
+	if bridge == nil {
+		return ""
+	}
+
+	route := "Assumes bridging"
+	if bridge.DefaultRoute {
+		route = "Assumes default bridge costs (route not configured)"
+	}
+	return fmt.Sprintf(". %s: $%s + %s%% fee, %sh without yield", route, bridge.FlatFeeUSD.StringFixed(2), bridge.FeePercent.String(), bridge.DelayHours.String())
 }
 
 // DetectTrendingPools finds pools with rapidly increasing APY
 func (s *Service) DetectTrendingPools(ctx context.Context) ([]models.Opportunity, error) {
+	return s.detectTrendingPools(ctx, s.Thresholds())
+}
+
+// detectTrendingPools runs trending detection with the given thresholds
+func (s *Service) detectTrendingPools(ctx context.Context, cfg config.WorkerConfig) ([]models.Opportunity, error) {
 	log.Debug().Msg("Detecting trending pools")
 
-	// Fetch pools with significant APY growth
-	trending, err := s.pgRepo.GetTrendingPools(
+	limit := cfg.TrendingFetchLimit
+	if limit <= 0 {
+		limit = defaultTrendingFetchLimit
+	}
+
+	// Fetch pools with significant APY growth, fastest growing first
+	trending, err := s.pools.GetTrendingPools(
 		ctx,
 		"", // All chains
-		decimal.NewFromFloat(s.config.APYJumpThreshold),
-		100,
+		decimal.NewFromFloat(cfg.APYJumpThreshold),
+		limit,
 		0,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch trending pools: %w", err)
 	}
 
-	opportunities := make([]models.Opportunity, 0)
 	now := time.Now().UTC()
 
+	candidates := make([]models.TrendingPool, 0, len(trending))
 	for _, tp := range trending {
-		if tp.Pool == nil {
-			continue
+		if tp.Pool != nil && s.chains.Allows(tp.Pool.Chain) {
+			candidates = append(candidates, tp)
 		}
+	}
+
+	// Single-point spikes are upstream glitches, not trends
+	confirmed, err := s.confirmTrending(ctx, candidates, cfg.TrendingConfirmPoints, now)
+	if err != nil {
+		return nil, err
+	}
+
+	opportunities := make([]models.Opportunity, 0, len(confirmed))
+	for _, tp := range confirmed {
 
 		pool := tp.Pool
 		growth24h, _ := tp.APYGrowth24H.Float64()
@@ -177,7 +320,7 @@ func (s *Service) DetectTrendingPools(ctx context.Context) ([]models.Opportunity
 		riskLevel := s.analytics.CalculateRiskLevel(pool)
 
 		opp := models.Opportunity{
-			ID:          uuid.New().String(),
+			ID:          detectionID(models.OpportunityTypeTrending, pool.ID),
 			Type:        models.OpportunityTypeTrending,
 			Title:       fmt.Sprintf("Trending: %s on %s (+%.1f%% APY)", pool.Symbol, pool.Protocol, growth24h),
 			Description: fmt.Sprintf("%s pool on %s (%s) has seen APY increase from %.2f%% to %.2f%% in the last 24 hours (%.1f%% growth)", pool.Symbol, pool.Protocol, pool.Chain, apy-growth24h, apy, growth24h),
@@ -192,7 +335,7 @@ func (s *Service) DetectTrendingPools(ctx context.Context) ([]models.Opportunity
 			IsActive:    true,
 			DetectedAt:  now,
 			LastSeenAt:  now,
-			ExpiresAt:   now.Add(6 * time.Hour), // Trending opportunities last longer
+			ExpiresAt:   now.Add(opportunityTTL(cfg, models.OpportunityTypeTrending)),
 			CreatedAt:   now,
 			UpdatedAt:   now,
 		}
@@ -202,6 +345,7 @@ func (s *Service) DetectTrendingPools(ctx context.Context) ([]models.Opportunity
 
 	log.Info().
 		Int("count", len(opportunities)).
+		Int("suppressed", len(candidates)-len(confirmed)).
 		Msg("Detected trending pool opportunities")
 
 	return opportunities, nil
@@ -209,19 +353,28 @@ func (s *Service) DetectTrendingPools(ctx context.Context) ([]models.Opportunity
 
 // DetectHighScorePools finds pools with excellent risk-adjusted scores
 func (s *Service) DetectHighScorePools(ctx context.Context) ([]models.Opportunity, error) {
+	return s.detectHighScorePools(ctx, s.Thresholds())
+}
+
+// detectHighScorePools runs high-score detection with the given thresholds
+func (s *Service) detectHighScorePools(ctx context.Context, cfg config.WorkerConfig) ([]models.Opportunity, error) {
 	log.Debug().Msg("Detecting high-score opportunities")
 
 	// Fetch high-scoring pools
 	filter := models.PoolFilter{
-		MinScore:  decimal.NewFromFloat(70), // Minimum score of 70/100
-		MinTVL:    decimal.NewFromFloat(s.config.MinTVLThreshold),
-		MinAPY:    decimal.NewFromFloat(s.config.MinAPYThreshold),
-		SortBy:    "score",
-		SortOrder: "desc",
-		Limit:     100,
+		MinScore:          decimal.NewFromFloat(cfg.HighScoreMinScore),
+		MinTVL:            decimal.NewFromFloat(cfg.MinTVLThreshold),
+		MinAPY:            decimal.NewFromFloat(cfg.MinAPYThreshold),
+		MinVolumeTVLRatio: decimal.NewFromFloat(cfg.MinVolumeTVLRatio),
+		MaxRewardRatio:    decimal.NewFromFloat(cfg.HighScoreMaxRewardRatio), // Skip emission-driven yields
+		SustainableOnly:   cfg.DetectSustainableOnly,
+		Sustainability:    sustainability(cfg),
+		SortBy:            "score",
+		SortOrder:         "desc",
+		Limit:             100,
 	}
 
-	pools, _, err := s.pgRepo.ListPools(ctx, filter)
+	pools, _, err := s.pools.ListPools(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch high-score pools: %w", err)
 	}
@@ -230,6 +383,10 @@ func (s *Service) DetectHighScorePools(ctx context.Context) ([]models.Opportunit
 	now := time.Now().UTC()
 
 	for _, pool := range pools {
+		if !s.chains.Allows(pool.Chain) {
+			continue
+		}
+
 		score, _ := pool.Score.Float64()
 		apy, _ := pool.APY.Float64()
 		tvl, _ := pool.TVL.Float64()
@@ -238,10 +395,10 @@ func (s *Service) DetectHighScorePools(ctx context.Context) ([]models.Opportunit
 		riskLevel := s.analytics.CalculateRiskLevel(&pool)
 
 		opp := models.Opportunity{
-			ID:          uuid.New().String(),
+			ID:          detectionID(models.OpportunityTypeHighScore, pool.ID),
 			Type:        models.OpportunityTypeHighScore,
 			Title:       fmt.Sprintf("High Score: %s on %s (%.1f/100)", pool.Symbol, pool.Protocol, score),
-			Description: fmt.Sprintf("%s pool on %s (%s) offers %.2f%% APY with $%.0f TVL. Risk-adjusted score: %.1f/100", pool.Symbol, pool.Protocol, pool.Chain, apy, tvl, score),
+			Description: fmt.Sprintf("%s pool on %s (%s) offers %.2f%% APY with $%.0f TVL. Risk-adjusted score: %.1f/100", pool.Symbol, pool.Protocol, pool.Chain, apy, tvl, score) + sustainableNote(cfg, &pool, "its APY"),
 			PoolID:      pool.ID,
 			Asset:       pool.Symbol,
 			Chain:       pool.Chain,
@@ -252,7 +409,7 @@ func (s *Service) DetectHighScorePools(ctx context.Context) ([]models.Opportunit
 			IsActive:    true,
 			DetectedAt:  now,
 			LastSeenAt:  now,
-			ExpiresAt:   now.Add(24 * time.Hour), // High-score opportunities are stable
+			ExpiresAt:   now.Add(opportunityTTL(cfg, models.OpportunityTypeHighScore)),
 			CreatedAt:   now,
 			UpdatedAt:   now,
 		}
@@ -267,22 +424,114 @@ func (s *Service) DetectHighScorePools(ctx context.Context) ([]models.Opportunit
 	return opportunities, nil
 }
 
-// groupPoolsByAsset groups pools by their primary asset
+// sustainability returns the sustainable yield thresholds of cfg
+func sustainability(cfg config.WorkerConfig) models.SustainableYield {
+	return models.SustainableYield{
+		MinBaseRatio: decimal.NewFromFloat(cfg.SustainableMinBaseRatio),
+		MinBaseAPY:   decimal.NewFromFloat(cfg.SustainableMinBaseAPY),
+	}
+}
+
+// sustainableNote describes how much of a pool's yield is base yield, for
+// opportunities detected in sustainable mode
+func sustainableNote(cfg config.WorkerConfig, pool *models.Pool, of string) string {
+	if !cfg.DetectSustainableOnly {
+		return ""
+	}
+	ratio, _ := models.CalculateBaseRatio(pool.APYBase, pool.APY).Float64()
+	return fmt.Sprintf(". Sustainable yield: %.0f%% of %s is base yield rather than reward emissions", ratio*100, of)
+}
+
+// assetRange tracks the highest and lowest APY pools seen for an asset
+type assetRange struct {
+	highest models.Pool
+	lowest  models.Pool
+	count   int
+}
+
+// addPool records a pool in its asset's range
 // This is used for yield gap detection
-func groupPoolsByAsset(pools []models.Pool) map[string][]models.Pool {
-	groups := make(map[string][]models.Pool)
+func addPool(ranges map[string]*assetRange, pool models.Pool) {
+	// Normalize asset name
+	asset := normalizeAsset(pool.Symbol)
+	if asset == "" {
+		return
+	}
 
-	for _, pool := range pools {
-		// Normalize asset name
-		asset := normalizeAsset(pool.Symbol)
-		if asset == "" {
-			continue
+	r, ok := ranges[asset]
+	if !ok {
+		ranges[asset] = &assetRange{highest: pool, lowest: pool, count: 1}
+		return
+	}
+
+	r.count++
+	if pool.APY.GreaterThan(r.highest.APY) {
+		r.highest = pool
+	}
+	if pool.APY.LessThan(r.lowest.APY) {
+		r.lowest = pool
+	}
+}
+
+// scanAssetRanges reads pools in ID order, batch by batch, until the table
+// is exhausted or YieldGapMaxPools is reached
+func (s *Service) scanAssetRanges(ctx context.Context, cfg config.WorkerConfig) (map[string]*assetRange, models.YieldGapScan, error) {
+	batchSize := cfg.YieldGapBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultYieldGapBatchSize
+	}
+	minTVL := decimal.NewFromFloat(cfg.MinTVLThreshold)
+	minRatio := decimal.NewFromFloat(cfg.MinVolumeTVLRatio)
+
+	sustainable := sustainability(cfg)
+
+	ranges := make(map[string]*assetRange)
+	scan := models.YieldGapScan{ScannedAt: time.Now().UTC()}
+	afterID := ""
+
+	for {
+		limit := batchSize
+		if cfg.YieldGapMaxPools > 0 {
+			remaining := cfg.YieldGapMaxPools - scan.PoolsConsidered
+			if remaining <= 0 {
+				// Only truncated if there was anything left to read
+				more, err := s.pools.ListPoolsAfter(ctx, afterID, minTVL, minRatio, 1)
+				if err != nil {
+					return nil, scan, err
+				}
+				scan.Truncated = len(more) > 0
+				break
+			}
+			limit = min(limit, remaining)
+		}
+
+		batch, err := s.pools.ListPoolsAfter(ctx, afterID, minTVL, minRatio, limit)
+		if err != nil {
+			return nil, scan, err
+		}
+
+		for _, pool := range batch {
+			// An outlier's clamped APY would open a gap that isn't there
+			if pool.IsOutlier || !s.chains.Allows(pool.Chain) {
+				continue
+			}
+			// In sustainable mode neither side of a gap may be
+			// emission-driven
+			if cfg.DetectSustainableOnly && !sustainable.Allows(&pool) {
+				continue
+			}
+			addPool(ranges, pool)
 		}
+		scan.PoolsConsidered += len(batch)
 
-		groups[asset] = append(groups[asset], pool)
+		if len(batch) < limit {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
 	}
 
-	return groups
+	scan.AssetsConsidered = len(ranges)
+	return ranges, scan, nil
 }
 
 // normalizeAsset extracts and normalizes the primary asset from a pool symbol
@@ -312,6 +561,61 @@ func normalizeAsset(symbol string) string {
 	return symbol
 }
 
+// RetractUnavailableOpportunities deactivates active opportunities that
+// reference a stale or deleted pool, publishes a retraction for each and
+// invalidates the cached opportunity lists. Run it before detection so the
+// retractions reach subscribers ahead of the cycle's new alerts.
+func (s *Service) RetractUnavailableOpportunities(ctx context.Context) ([]models.OpportunityRetraction, error) {
+	cfg := s.Thresholds()
+	if cfg.PoolStaleAfter <= 0 {
+		return nil, nil
+	}
+
+	stale, deleted, err := s.store.GetUnavailableOpportunityPools(ctx, time.Now().Add(-cfg.PoolStaleAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unavailable pools: %w", err)
+	}
+
+	groups := []struct {
+		reason  string
+		poolIDs []string
+	}{
+		{models.StatusReasonPoolDeleted, deleted},
+		{models.StatusReasonPoolStale, stale},
+	}
+
+	retractions := make([]models.OpportunityRetraction, 0)
+	for _, g := range groups {
+		if len(g.poolIDs) == 0 {
+			continue
+		}
+		deactivated, err := s.store.DeactivateOpportunitiesForPools(ctx, g.poolIDs, g.reason)
+		if err != nil {
+			return retractions, fmt.Errorf("failed to deactivate opportunities (%s): %w", g.reason, err)
+		}
+		retractions = append(retractions, deactivated...)
+	}
+
+	if len(retractions) == 0 {
+		return retractions, nil
+	}
+
+	if err := s.publisher.PublishOpportunityRetractions(ctx, retractions); err != nil {
+		log.Warn().Err(err).Msg("Failed to publish opportunity retractions")
+	}
+	if err := s.publisher.InvalidateOpportunitiesCache(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to invalidate opportunities cache")
+	}
+
+	log.Info().
+		Int("retracted", len(retractions)).
+		Int("stale_pools", len(stale)).
+		Int("deleted_pools", len(deleted)).
+		Msg("Retracted opportunities on unavailable pools")
+
+	return retractions, nil
+}
+
 // RefreshOpportunities updates existing opportunities and deactivates expired ones
 func (s *Service) RefreshOpportunities(ctx context.Context) error {
 	log.Debug().Msg("Refreshing opportunities")
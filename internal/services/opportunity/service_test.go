@@ -0,0 +1,544 @@
+package opportunity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+)
+
+// fakePager serves pools from memory: ListPoolsAfter in ID order, ListPools
+// in slice order honouring the score, reward ratio and sustainability
+// filters
+type fakePager struct {
+	pools   []models.Pool
+	queries int
+
+	trendingLimit  int
+	trendingOffset int
+}
+
+func (f *fakePager) ListPools(ctx context.Context, filter models.PoolFilter) ([]models.Pool, int64, error) {
+	pools := make([]models.Pool, 0)
+	for _, pool := range f.pools {
+		if pool.Score.LessThan(filter.MinScore) {
+			continue
+		}
+		if !filter.MaxRewardRatio.IsZero() && models.CalculateRewardRatio(pool.APYReward, pool.APY).GreaterThan(filter.MaxRewardRatio) {
+			continue
+		}
+		if filter.SustainableOnly && !filter.Sustainability.Allows(&pool) {
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	return pools, int64(len(pools)), nil
+}
+
+func (f *fakePager) ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error) {
+	f.queries++
+
+	batch := make([]models.Pool, 0, limit)
+	for _, pool := range f.pools {
+		if pool.ID <= afterID || pool.TVL.LessThan(minTVL) {
+			continue
+		}
+		batch = append(batch, pool)
+		if len(batch) == limit {
+			break
+		}
+	}
+	return batch, nil
+}
+
+func (f *fakePager) GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error) {
+	f.trendingLimit, f.trendingOffset = limit, offset
+	return nil, nil
+}
+
+// newTestService builds a service over a large synthetic universe: 6,000
+// high-TVL pools of unrelated assets plus two low-TVL pools of the same
+// asset with a wide APY gap. A single 5,000-row query sorted by TVL would
+// never see the latter.
+func newTestService(cfg config.WorkerConfig) (*Service, *fakePager) {
+	pools := make([]models.Pool, 0, 6002)
+	for i := 0; i < 6000; i++ {
+		pools = append(pools, models.Pool{
+			ID:     fmt.Sprintf("pool-%05d", i),
+			Chain:  "ethereum",
+			Symbol: fmt.Sprintf("TKN%d", i),
+			APY:    decimal.NewFromFloat(5),
+			TVL:    decimal.NewFromFloat(50000000),
+		})
+	}
+	pools = append(pools,
+		models.Pool{ID: "pool-a", Chain: "arbitrum", Protocol: "low", Symbol: "OBSCURE", APY: decimal.NewFromFloat(2), TVL: decimal.NewFromFloat(1000000)},
+		models.Pool{ID: "pool-b", Chain: "arbitrum", Protocol: "high", Symbol: "OBSCURE", APY: decimal.NewFromFloat(30), TVL: decimal.NewFromFloat(1000000)},
+	)
+	sort.Slice(pools, func(i, j int) bool { return pools[i].ID < pools[j].ID })
+
+	pager := &fakePager{pools: pools}
+	return &Service{
+		config:    cfg,
+		pools:     pager,
+		analytics: analytics.NewService(config.ScoringConfig{}),
+	}, pager
+}
+
+func TestDetectYieldGaps_ScansFullUniverse(t *testing.T) {
+	service, pager := newTestService(config.WorkerConfig{
+		MinTVLThreshold:   100000,
+		YieldGapMinProfit: 0.5,
+		YieldGapBatchSize: 1000,
+	})
+
+	opportunities, err := service.DetectYieldGaps(context.Background())
+	if err != nil {
+		t.Fatalf("DetectYieldGaps failed: %v", err)
+	}
+
+	if len(opportunities) != 1 {
+		t.Fatalf("Expected 1 opportunity, got %d", len(opportunities))
+	}
+	opp := opportunities[0]
+	if opp.Asset != "OBSCURE" || opp.SourcePoolID != "pool-a" || opp.TargetPoolID != "pool-b" {
+		t.Errorf("Expected OBSCURE gap from pool-a to pool-b, got %s %s -> %s", opp.Asset, opp.SourcePoolID, opp.TargetPoolID)
+	}
+
+	scan := service.LastYieldGapScan()
+	if scan.PoolsConsidered != 6002 || scan.AssetsConsidered != 6001 || scan.Truncated {
+		t.Errorf("Expected 6002 pools and 6001 assets untruncated, got %+v", scan)
+	}
+	if pager.queries != 7 {
+		t.Errorf("Expected 7 batched queries, got %d", pager.queries)
+	}
+}
+
+func TestDetectYieldGaps_MaxPoolsGuard(t *testing.T) {
+	service, _ := newTestService(config.WorkerConfig{
+		MinTVLThreshold:   100000,
+		YieldGapMinProfit: 0.5,
+		YieldGapBatchSize: 1000,
+		YieldGapMaxPools:  2500,
+	})
+
+	if _, err := service.DetectYieldGaps(context.Background()); err != nil {
+		t.Fatalf("DetectYieldGaps failed: %v", err)
+	}
+
+	scan := service.LastYieldGapScan()
+	if scan.PoolsConsidered != 2500 || !scan.Truncated {
+		t.Errorf("Expected a truncated scan of 2500 pools, got %+v", scan)
+	}
+
+	// A cap that exactly fits the universe is not a truncation
+	service, _ = newTestService(config.WorkerConfig{MinTVLThreshold: 100000, YieldGapBatchSize: 1000, YieldGapMaxPools: 6002})
+	if _, err := service.DetectYieldGaps(context.Background()); err != nil {
+		t.Fatalf("DetectYieldGaps failed: %v", err)
+	}
+	if scan := service.LastYieldGapScan(); scan.PoolsConsidered != 6002 || scan.Truncated {
+		t.Errorf("Expected a complete scan of 6002 pools, got %+v", scan)
+	}
+}
+
+func TestDetectHighScorePools_ExcludeRewardHeavy(t *testing.T) {
+	pools := []models.Pool{
+		{ID: "organic", Chain: "ethereum", Symbol: "USDC", APY: decimal.NewFromFloat(8), APYBase: decimal.NewFromFloat(7), APYReward: decimal.NewFromFloat(1), Score: decimal.NewFromFloat(80)},
+		{ID: "emissions", Chain: "ethereum", Symbol: "FARM", APY: decimal.NewFromFloat(40), APYBase: decimal.NewFromFloat(4), APYReward: decimal.NewFromFloat(36), Score: decimal.NewFromFloat(75)},
+	}
+
+	detect := func(maxRewardRatio float64) []string {
+		service := &Service{
+			config:    config.WorkerConfig{HighScoreMaxRewardRatio: maxRewardRatio},
+			pools:     &fakePager{pools: pools},
+			analytics: analytics.NewService(config.ScoringConfig{}),
+		}
+
+		opportunities, err := service.DetectHighScorePools(context.Background())
+		if err != nil {
+			t.Fatalf("DetectHighScorePools failed: %v", err)
+		}
+
+		ids := make([]string, len(opportunities))
+		for i, opp := range opportunities {
+			ids[i] = opp.PoolID
+		}
+		return ids
+	}
+
+	// Default keeps every high-score pool
+	if ids := detect(0); len(ids) != 2 {
+		t.Errorf("Expected both pools by default, got %v", ids)
+	}
+
+	// 90% of FARM's APY is rewards, above the 50% limit
+	if ids := detect(0.5); len(ids) != 1 || ids[0] != "organic" {
+		t.Errorf("Expected only the organic pool, got %v", ids)
+	}
+}
+
+// sustainablePools are USDC pools with every base/reward composition: all
+// base, mixed, all rewards, and no APY at all
+func sustainablePools() []models.Pool {
+	pool := func(id string, base, reward float64) models.Pool {
+		return models.Pool{
+			ID:        id,
+			Chain:     "arbitrum",
+			Protocol:  id,
+			Symbol:    "USDC",
+			APY:       decimal.NewFromFloat(base + reward),
+			APYBase:   decimal.NewFromFloat(base),
+			APYReward: decimal.NewFromFloat(reward),
+			TVL:       decimal.NewFromFloat(1000000),
+			Score:     decimal.NewFromFloat(80),
+		}
+	}
+	return []models.Pool{
+		pool("a-base", 4, 0),
+		pool("b-mixed", 12, 8),
+		pool("c-rewards", 0, 30),
+		pool("d-zero", 0, 0),
+	}
+}
+
+func TestDetectYieldGaps_SustainableOnly(t *testing.T) {
+	cfg := config.WorkerConfig{
+		YieldGapMinProfit:       0.5,
+		YieldGapBatchSize:       10,
+		SustainableMinBaseRatio: 0.5,
+	}
+	detect := func(cfg config.WorkerConfig) models.Opportunity {
+		service := &Service{
+			config:    cfg,
+			pools:     &fakePager{pools: sustainablePools()},
+			analytics: analytics.NewService(config.ScoringConfig{}),
+		}
+		opportunities, err := service.DetectYieldGaps(context.Background())
+		if err != nil {
+			t.Fatalf("DetectYieldGaps failed: %v", err)
+		}
+		if len(opportunities) != 1 {
+			t.Fatalf("Expected 1 opportunity, got %d", len(opportunities))
+		}
+		return opportunities[0]
+	}
+
+	// By default the emission-driven pool is the target and the pool
+	// without APY the source
+	if opp := detect(cfg); opp.SourcePoolID != "d-zero" || opp.TargetPoolID != "c-rewards" {
+		t.Errorf("Expected d-zero -> c-rewards by default, got %s -> %s", opp.SourcePoolID, opp.TargetPoolID)
+	}
+
+	// Sustainable mode compares only the pools mostly paid in base yield
+	cfg.DetectSustainableOnly = true
+	opp := detect(cfg)
+	if opp.SourcePoolID != "a-base" || opp.TargetPoolID != "b-mixed" {
+		t.Errorf("Expected a-base -> b-mixed in sustainable mode, got %s -> %s", opp.SourcePoolID, opp.TargetPoolID)
+	}
+	if want := "Sustainable yield: 60% of the target APY is base yield"; !strings.Contains(opp.Description, want) {
+		t.Errorf("Expected description to contain %q, got %q", want, opp.Description)
+	}
+}
+
+func TestDetectHighScorePools_SustainableOnly(t *testing.T) {
+	detect := func(cfg config.WorkerConfig) map[string]string {
+		service := &Service{
+			config:    cfg,
+			pools:     &fakePager{pools: sustainablePools()},
+			analytics: analytics.NewService(config.ScoringConfig{}),
+		}
+		opportunities, err := service.DetectHighScorePools(context.Background())
+		if err != nil {
+			t.Fatalf("DetectHighScorePools failed: %v", err)
+		}
+		descriptions := make(map[string]string, len(opportunities))
+		for _, opp := range opportunities {
+			descriptions[opp.PoolID] = opp.Description
+		}
+		return descriptions
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.WorkerConfig
+		want []string
+	}{
+		{"off", config.WorkerConfig{SustainableMinBaseRatio: 0.5}, []string{"a-base", "b-mixed", "c-rewards", "d-zero"}},
+		{"half base", config.WorkerConfig{SustainableMinBaseRatio: 0.5, DetectSustainableOnly: true}, []string{"a-base", "b-mixed"}},
+		{"mostly base", config.WorkerConfig{SustainableMinBaseRatio: 0.75, DetectSustainableOnly: true}, []string{"a-base"}},
+		{"base apy floor", config.WorkerConfig{SustainableMinBaseRatio: 0.75, SustainableMinBaseAPY: 10, DetectSustainableOnly: true}, []string{"a-base", "b-mixed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			descriptions := detect(tt.cfg)
+			if len(descriptions) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, descriptions)
+			}
+			for _, id := range tt.want {
+				description, ok := descriptions[id]
+				if !ok {
+					t.Errorf("Expected %s to be detected", id)
+				}
+				if strings.Contains(description, "Sustainable yield") != tt.cfg.DetectSustainableOnly {
+					t.Errorf("Expected sustainable note only in sustainable mode, got %q", description)
+				}
+			}
+		})
+	}
+
+	descriptions := detect(config.WorkerConfig{SustainableMinBaseRatio: 0.5, DetectSustainableOnly: true})
+	if want := "Sustainable yield: 100% of its APY is base yield"; !strings.Contains(descriptions["a-base"], want) {
+		t.Errorf("Expected description to contain %q, got %q", want, descriptions["a-base"])
+	}
+}
+
+func TestDetect_SkipsFilteredChains(t *testing.T) {
+	// The allowlist was set after arbitrum pools were stored
+	cfg := config.WorkerConfig{
+		MinTVLThreshold:   100000,
+		YieldGapMinProfit: 0.5,
+		YieldGapBatchSize: 1000,
+		Chains:            []string{"eth"},
+	}
+	service, pager := newTestService(cfg)
+	service.chains = cfg.ChainFilter()
+
+	gaps, err := service.DetectYieldGaps(context.Background())
+	if err != nil {
+		t.Fatalf("DetectYieldGaps failed: %v", err)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("Expected the arbitrum gap skipped, got %d opportunities", len(gaps))
+	}
+	if scan := service.LastYieldGapScan(); scan.AssetsConsidered != 6000 {
+		t.Errorf("Expected only ethereum assets considered, got %+v", scan)
+	}
+
+	pager.pools = []models.Pool{
+		{ID: "eth", Chain: "Ethereum", Symbol: "USDC", APY: decimal.NewFromFloat(8), Score: decimal.NewFromFloat(80)},
+		{ID: "arb", Chain: "Arbitrum", Symbol: "USDC", APY: decimal.NewFromFloat(9), Score: decimal.NewFromFloat(85)},
+	}
+	highScore, err := service.DetectHighScorePools(context.Background())
+	if err != nil {
+		t.Fatalf("DetectHighScorePools failed: %v", err)
+	}
+	if len(highScore) != 1 || highScore[0].PoolID != "eth" {
+		t.Errorf("Expected only the ethereum pool, got %+v", highScore)
+	}
+}
+
+func TestDetectTrendingPools_FetchLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"configured", 250, 250},
+		{"unset uses default", 0, defaultTrendingFetchLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, pager := newTestService(config.WorkerConfig{TrendingFetchLimit: tt.limit})
+
+			if _, err := svc.DetectTrendingPools(context.Background()); err != nil {
+				t.Fatalf("DetectTrendingPools failed: %v", err)
+			}
+			if pager.trendingLimit != tt.want || pager.trendingOffset != 0 {
+				t.Errorf("Expected limit %d offset 0, got limit %d offset %d", tt.want, pager.trendingLimit, pager.trendingOffset)
+			}
+		})
+	}
+}
+
+// fakeStore keeps pools and opportunities in memory like the pools and
+// opportunities tables. A pool missing from updatedAt has been deleted.
+type fakeStore struct {
+	updatedAt     map[string]time.Time
+	opportunities []models.Opportunity
+}
+
+func (f *fakeStore) ListActiveOpportunities(ctx context.Context) ([]models.Opportunity, error) {
+	active := make([]models.Opportunity, 0)
+	for _, o := range f.opportunities {
+		if o.IsActive {
+			active = append(active, o)
+		}
+	}
+	return active, nil
+}
+
+func (f *fakeStore) GetUnavailableOpportunityPools(ctx context.Context, staleBefore time.Time) (stale, deleted []string, err error) {
+	seen := make(map[string]bool)
+	for _, o := range f.opportunities {
+		if !o.IsActive {
+			continue
+		}
+		for _, id := range []string{o.PoolID, o.SourcePoolID, o.TargetPoolID} {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			updated, ok := f.updatedAt[id]
+			switch {
+			case !ok:
+				deleted = append(deleted, id)
+			case updated.Before(staleBefore):
+				stale = append(stale, id)
+			}
+		}
+	}
+	return stale, deleted, nil
+}
+
+func (f *fakeStore) DeactivateOpportunitiesForPools(ctx context.Context, poolIDs []string, reason string) ([]models.OpportunityRetraction, error) {
+	ids := make(map[string]bool)
+	for _, id := range poolIDs {
+		ids[id] = true
+	}
+
+	retractions := make([]models.OpportunityRetraction, 0)
+	for i := range f.opportunities {
+		o := &f.opportunities[i]
+		if !o.IsActive || !(ids[o.PoolID] || ids[o.SourcePoolID] || ids[o.TargetPoolID]) {
+			continue
+		}
+		o.IsActive = false
+		o.StatusReason = reason
+		retractions = append(retractions, models.OpportunityRetraction{OpportunityID: o.ID, Type: o.Type, Reason: reason})
+	}
+	return retractions, nil
+}
+
+// fakePublisher records published retractions and cache invalidations
+type fakePublisher struct {
+	published     []models.OpportunityRetraction
+	invalidations int
+}
+
+func (f *fakePublisher) PublishOpportunityRetractions(ctx context.Context, retractions []models.OpportunityRetraction) error {
+	f.published = append(f.published, retractions...)
+	return nil
+}
+
+func (f *fakePublisher) InvalidateOpportunitiesCache(ctx context.Context) error {
+	f.invalidations++
+	return nil
+}
+
+func TestRetractUnavailableOpportunities(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{
+		updatedAt: map[string]time.Time{"pool-a": now, "pool-b": now, "pool-c": now},
+		opportunities: []models.Opportunity{
+			{ID: "gap", Type: models.OpportunityTypeYieldGap, SourcePoolID: "pool-a", TargetPoolID: "pool-b", IsActive: true},
+			{ID: "trend-a", Type: models.OpportunityTypeTrending, PoolID: "pool-a", IsActive: true},
+			{ID: "score-c", Type: models.OpportunityTypeHighScore, PoolID: "pool-c", IsActive: true},
+		},
+	}
+	publisher := &fakePublisher{}
+	service := &Service{
+		config:    config.WorkerConfig{PoolStaleAfter: time.Hour},
+		store:     store,
+		publisher: publisher,
+	}
+	ctx := context.Background()
+
+	// Nothing is stale yet
+	retracted, err := service.RetractUnavailableOpportunities(ctx)
+	if err != nil {
+		t.Fatalf("RetractUnavailableOpportunities failed: %v", err)
+	}
+	if len(retracted) != 0 || publisher.invalidations != 0 {
+		t.Fatalf("Expected no retractions, got %v", retracted)
+	}
+
+	// pool-a stops updating mid-cycle
+	store.updatedAt["pool-a"] = now.Add(-2 * time.Hour)
+
+	retracted, err = service.RetractUnavailableOpportunities(ctx)
+	if err != nil {
+		t.Fatalf("RetractUnavailableOpportunities failed: %v", err)
+	}
+
+	want := map[string]bool{"gap": true, "trend-a": true}
+	if len(retracted) != len(want) || len(publisher.published) != len(want) {
+		t.Fatalf("Expected retractions for %v, got %v (published %v)", want, retracted, publisher.published)
+	}
+	for _, r := range publisher.published {
+		if !want[r.OpportunityID] || r.Reason != models.StatusReasonPoolStale {
+			t.Errorf("Unexpected retraction %+v", r)
+		}
+	}
+	for _, o := range store.opportunities {
+		if want[o.ID] && (o.IsActive || o.StatusReason != models.StatusReasonPoolStale) {
+			t.Errorf("Expected %s deactivated as stale, got active=%v reason=%q", o.ID, o.IsActive, o.StatusReason)
+		}
+		if o.ID == "score-c" && !o.IsActive {
+			t.Errorf("Expected score-c to stay active")
+		}
+	}
+	if publisher.invalidations != 1 {
+		t.Errorf("Expected opportunities cache invalidated once, got %d", publisher.invalidations)
+	}
+
+	// A deleted pool retracts its opportunity with its own reason, and
+	// already retracted opportunities aren't announced again
+	delete(store.updatedAt, "pool-c")
+	publisher.published = nil
+
+	if _, err := service.RetractUnavailableOpportunities(ctx); err != nil {
+		t.Fatalf("RetractUnavailableOpportunities failed: %v", err)
+	}
+	if len(publisher.published) != 1 || publisher.published[0].OpportunityID != "score-c" || publisher.published[0].Reason != models.StatusReasonPoolDeleted {
+		t.Errorf("Expected score-c retracted as deleted, got %+v", publisher.published)
+	}
+}
+
+func TestSetThresholds_KeepsOtherSettings(t *testing.T) {
+	service := &Service{config: config.WorkerConfig{
+		MinTVLThreshold:       100000,
+		YieldGapMinProfit:     10,
+		YieldGapBatchSize:     500,
+		TrendingFetchLimit:    200,
+		PoolStaleAfter:        time.Hour,
+		OpportunityMaxPerType: 50,
+	}}
+
+	// A reload carries every setting; only the thresholds are swapped in
+	err := service.SetThresholds(config.WorkerConfig{
+		MinTVLThreshold:   250000,
+		YieldGapMinProfit: 25,
+		HighScoreMinScore: 80,
+	})
+	if err != nil {
+		t.Fatalf("SetThresholds failed: %v", err)
+	}
+
+	cfg := service.Thresholds()
+	if cfg.MinTVLThreshold != 250000 || cfg.YieldGapMinProfit != 25 || cfg.HighScoreMinScore != 80 {
+		t.Errorf("Expected the reloaded thresholds, got %+v", cfg)
+	}
+	if cfg.YieldGapBatchSize != 500 || cfg.TrendingFetchLimit != 200 ||
+		cfg.PoolStaleAfter != time.Hour || cfg.OpportunityMaxPerType != 50 {
+		t.Errorf("Expected non-threshold settings to be unchanged, got %+v", cfg)
+	}
+
+	// Invalid thresholds leave everything as it was
+	if err := service.SetThresholds(config.WorkerConfig{MinTVLThreshold: -1}); err == nil {
+		t.Fatal("Expected negative thresholds to be rejected")
+	}
+	if cfg := service.Thresholds(); cfg.MinTVLThreshold != 250000 {
+		t.Errorf("Expected the current thresholds to be kept, got %v", cfg.MinTVLThreshold)
+	}
+}
@@ -0,0 +1,77 @@
+package opportunity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// trendingHistoryWindow is how far back trending detection reads a pool's
+// APY history to confirm a jump, the span the 24h growth covers
+const trendingHistoryWindow = 24 * time.Hour
+
+// apySeriesReader reads the recorded APY history of pools.
+// Implemented by the PostgreSQL repository.
+type apySeriesReader interface {
+	GetAPYSeries(ctx context.Context, windows []models.APYWindow) ([][]models.APYPoint, error)
+}
+
+// confirmTrending drops the trending pools whose APY jump is not yet held
+// by the latest confirmPoints readings of their history. DeFiLlama
+// occasionally reports one absurd APY, say 5000% for a pool earning 5%,
+// and is back to normal on the next fetch; such a jump shows in a single
+// point and is suppressed as a likely data error. A reading holds the jump
+// when it is at least halfway from the APY 24h ago to the current one.
+// With confirmPoints at 1 or less every pool is kept.
+func (s *Service) confirmTrending(ctx context.Context, trending []models.TrendingPool, confirmPoints int, now time.Time) ([]models.TrendingPool, error) {
+	if confirmPoints <= 1 || len(trending) == 0 {
+		return trending, nil
+	}
+
+	windows := make([]models.APYWindow, len(trending))
+	for i, tp := range trending {
+		windows[i] = models.APYWindow{PoolID: tp.Pool.ID, From: now.Add(-trendingHistoryWindow), To: now}
+	}
+	series, err := s.history.GetAPYSeries(ctx, windows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch APY history of trending pools: %w", err)
+	}
+
+	confirmed := make([]models.TrendingPool, 0, len(trending))
+	for i, tp := range trending {
+		holding, ok := jumpHeld(series[i], tp.Pool.APY, tp.APYGrowth24H, confirmPoints)
+		if !ok {
+			log.Info().
+				Str("pool_id", tp.Pool.ID).
+				Str("apy", tp.Pool.APY.StringFixed(2)).
+				Str("apy_24h_ago", tp.Pool.APY.Sub(tp.APYGrowth24H).StringFixed(2)).
+				Int("holding_points", holding).
+				Int("confirm_points", confirmPoints).
+				Msg("Suppressed trending pool as a likely data error")
+			continue
+		}
+		confirmed = append(confirmed, tp)
+	}
+	return confirmed, nil
+}
+
+// jumpHeld reports whether each of the latest points of an APY series, of
+// which there must be at least that many, holds a jump of growth up to apy.
+// It also returns how many of them do.
+func jumpHeld(series []models.APYPoint, apy, growth decimal.Decimal, points int) (int, bool) {
+	midpoint := apy.Sub(growth.Div(decimal.NewFromInt(2)))
+
+	latest := series[max(len(series)-points, 0):]
+	holding := 0
+	for _, p := range latest {
+		if p.APY.GreaterThanOrEqual(midpoint) {
+			holding++
+		}
+	}
+	return holding, holding == points
+}
@@ -0,0 +1,98 @@
+package opportunity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+)
+
+// trendingPager serves fixed trending pools
+type trendingPager struct {
+	fakePager
+	trending []models.TrendingPool
+}
+
+func (f *trendingPager) GetTrendingPools(ctx context.Context, chain string, minGrowth decimal.Decimal, limit, offset int) ([]models.TrendingPool, error) {
+	return f.trending, nil
+}
+
+// hourlySeries returns APY readings an hour apart, the last one now
+func hourlySeries(now time.Time, apys ...float64) []models.APYPoint {
+	points := make([]models.APYPoint, len(apys))
+	for i, apy := range apys {
+		points[i] = models.APYPoint{
+			Timestamp: now.Add(-time.Duration(len(apys)-1-i) * time.Hour),
+			APY:       decimal.NewFromFloat(apy),
+		}
+	}
+	return points
+}
+
+func TestDetectTrendingPools_SuppressesSpikes(t *testing.T) {
+	now := time.Now().UTC()
+	trending := func(id string, apy, growth float64) models.TrendingPool {
+		return models.TrendingPool{
+			Pool:         &models.Pool{ID: id, Chain: "ethereum", Symbol: id, APY: decimal.NewFromFloat(apy)},
+			APYGrowth24H: decimal.NewFromFloat(growth),
+		}
+	}
+	pager := &trendingPager{trending: []models.TrendingPool{
+		trending("glitch", 5000, 4995),
+		trending("sustained", 80, 70),
+		trending("new", 60, 55),
+		trending("volatile", 90, 80),
+	}}
+	history := &fakeOutcomeStore{history: map[string][]models.APYPoint{
+		"glitch":    hourlySeries(now, 5, 5, 5, 5, 5000),
+		"sustained": hourlySeries(now, 10, 10, 75, 78, 80),
+		"new":       hourlySeries(now, 58, 60),
+		// The middle reading fell back below the halfway mark at 50
+		"volatile": hourlySeries(now, 10, 85, 40, 90),
+	}}
+
+	tests := []struct {
+		name          string
+		confirmPoints int
+		want          []string
+	}{
+		{"three points", 3, []string{"sustained"}},
+		{"two points", 2, []string{"sustained", "new"}},
+		{"off", 0, []string{"glitch", "sustained", "new", "volatile"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &Service{
+				config:    config.WorkerConfig{TrendingConfirmPoints: tt.confirmPoints},
+				pools:     pager,
+				history:   history,
+				analytics: analytics.NewService(config.ScoringConfig{}),
+			}
+
+			opportunities, err := svc.DetectTrendingPools(context.Background())
+			if err != nil {
+				t.Fatalf("DetectTrendingPools failed: %v", err)
+			}
+
+			got := make([]string, len(opportunities))
+			for i, opp := range opportunities {
+				got[i] = opp.PoolID
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected pools %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected pools %v, got %v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+}
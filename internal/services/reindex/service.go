@@ -0,0 +1,420 @@
+// Package reindex rebuilds the ElasticSearch pools index from PostgreSQL,
+// or from the current index. Documents are copied into a new versioned
+// index, the document count is verified and the pools alias is swapped over
+// atomically, so searches keep working throughout and mapping changes apply
+// without downtime. Progress is checkpointed in Redis so a run interrupted by
+// a crash resumes where it stopped.
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+)
+
+// defaultBatchSize is used when ELASTICSEARCH_REINDEX_BATCH_SIZE is unset
+const defaultBatchSize = 1000
+
+// lockTTL bounds how long a crashed run blocks the next one. The lock is
+// renewed after every batch.
+const lockTTL = 2 * time.Minute
+
+// ErrRunning is returned when another reindex holds the lock
+var ErrRunning = errors.New("a pools reindex is already running")
+
+// ErrNoSourceIndex is returned by RunFromIndex when there is no pools index
+// to copy from
+var ErrNoSourceIndex = errors.New("no pools index to copy from")
+
+// indexManager manages the versioned pools indices.
+// Implemented by the ElasticSearch repository.
+type indexManager interface {
+	PoolsIndexState(ctx context.Context) (elasticsearch.IndexState, error)
+	IndexExists(ctx context.Context, name string) (bool, error)
+	CreatePoolsIndex(ctx context.Context, generation int, withAlias bool) (string, error)
+	DeleteIndex(ctx context.Context, name string) error
+	BulkIndexPoolsInto(ctx context.Context, index string, pools []models.Pool) error
+	ReindexDocuments(ctx context.Context, source, target string) (int64, error)
+	CountDocuments(ctx context.Context, index string) (int64, error)
+	SwapPoolsAlias(ctx context.Context, newIndex string, previous elasticsearch.IndexState) error
+}
+
+// poolSource pages through every pool in ID order.
+// Implemented by the PostgreSQL repository.
+type poolSource interface {
+	ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error)
+}
+
+// checkpointStore keeps the reindex checkpoint and the cross-process lock.
+// Implemented by the Redis repository.
+type checkpointStore interface {
+	GetReindexStatus(ctx context.Context) (*models.ReindexStatus, error)
+	SetReindexStatus(ctx context.Context, status *models.ReindexStatus) error
+	AcquireReindexLock(ctx context.Context, ttl time.Duration) (string, bool, error)
+	ExtendReindexLock(ctx context.Context, token string, ttl time.Duration) error
+	ReleaseReindexLock(ctx context.Context, token string) error
+}
+
+// Service rebuilds the pools index
+type Service struct {
+	index       indexManager
+	source      poolSource
+	checkpoints checkpointStore
+	batchSize   int
+	gracePeriod time.Duration
+
+	// mu guards running, which stops Start from launching a second run in
+	// this process before the first has taken the Redis lock
+	mu      sync.Mutex
+	running bool
+}
+
+// NewService creates a new reindex service
+func NewService(
+	cfg config.ElasticSearchConfig,
+	es *elasticsearch.Repository,
+	pg *postgres.Repository,
+	redis *redis.Repository,
+) *Service {
+	batchSize := cfg.ReindexBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	return &Service{
+		index:       es,
+		source:      pg,
+		checkpoints: redis,
+		batchSize:   batchSize,
+		gracePeriod: cfg.ReindexGracePeriod,
+	}
+}
+
+// Status returns the progress of the current or last reindex, or nil if
+// none has run
+func (s *Service) Status(ctx context.Context) (*models.ReindexStatus, error) {
+	return s.checkpoints.GetReindexStatus(ctx)
+}
+
+// Start runs a reindex in the background. It returns ErrRunning if one is
+// already in progress in this process; a run in another process is detected
+// by the background run itself and logged.
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return ErrRunning
+	}
+	s.running = true
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+		}()
+
+		if _, err := s.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("Pools reindex failed")
+		}
+	}()
+
+	return nil
+}
+
+// EnsureCurrent reindexes when the live pools index was built from an older
+// mapping than PoolsMappingVersion
+func (s *Service) EnsureCurrent(ctx context.Context) error {
+	state, err := s.index.PoolsIndexState(ctx)
+	if err != nil {
+		return err
+	}
+	if !state.Outdated() {
+		return nil
+	}
+
+	log.Info().
+		Str("index", state.Name).
+		Int("mapping_version", state.MappingVersion).
+		Int("required_version", elasticsearch.PoolsMappingVersion).
+		Msg("Reindexing pools for the new mapping")
+
+	_, err = s.Run(ctx)
+	return err
+}
+
+// Run rebuilds the pools index: it copies every pool from PostgreSQL into the
+// next index generation in batches, checks that the document count matches,
+// swaps the alias and, after the grace period, deletes the previous index.
+// An interrupted run for the same source index resumes from its checkpoint.
+//
+// Pools written through the alias while the copy runs land in the old index
+// only. The copy reads them from PostgreSQL afterwards if their batch hasn't
+// been reached yet; otherwise the next ingestion cycle refreshes them.
+func (s *Service) Run(ctx context.Context) (*models.ReindexStatus, error) {
+	return s.run(ctx, models.ReindexSourcePostgres)
+}
+
+// RunFromIndex rebuilds the pools index like Run, but copies the documents
+// of the index behind the alias with the ElasticSearch _reindex API instead
+// of reading PostgreSQL. It is faster, and suits mapping changes that only
+// change how existing fields are indexed; documents are copied as stored, so
+// use Run when the fields themselves change. The copy isn't checkpointed: an
+// interrupted run copies everything again.
+func (s *Service) RunFromIndex(ctx context.Context) (*models.ReindexStatus, error) {
+	return s.run(ctx, models.ReindexSourceIndex)
+}
+
+// run rebuilds the pools index from the given reindex source
+func (s *Service) run(ctx context.Context, from string) (*models.ReindexStatus, error) {
+	status, source, err := s.rebuild(ctx, from)
+	if err != nil {
+		return status, err
+	}
+
+	// A legacy index is removed by the swap itself
+	if source.Aliased {
+		if err := s.deleteAfterGrace(ctx, source.Name); err != nil {
+			log.Warn().Err(err).Str("index", source.Name).Msg("Failed to delete previous pools index")
+			return status, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	status.State = models.ReindexStateCompleted
+	status.CompletedAt = &now
+	s.save(ctx, status)
+
+	log.Info().Str("index", status.TargetIndex).Int64("pools", status.Indexed).Msg("Pools reindex completed")
+	return status, nil
+}
+
+// rebuild runs the locked part of a reindex, up to and including the alias
+// swap. Returns the checkpoint and the index the alias pointed at before.
+func (s *Service) rebuild(ctx context.Context, from string) (*models.ReindexStatus, elasticsearch.IndexState, error) {
+	var source elasticsearch.IndexState
+
+	token, acquired, err := s.checkpoints.AcquireReindexLock(ctx, lockTTL)
+	if err != nil {
+		return nil, source, fmt.Errorf("failed to acquire reindex lock: %w", err)
+	}
+	if !acquired {
+		return nil, source, ErrRunning
+	}
+	defer func() {
+		// Release even if ctx was cancelled, so a restart doesn't wait out the TTL
+		if err := s.checkpoints.ReleaseReindexLock(context.Background(), token); err != nil {
+			log.Warn().Err(err).Msg("Failed to release reindex lock")
+		}
+	}()
+
+	source, err = s.index.PoolsIndexState(ctx)
+	if err != nil {
+		return nil, source, err
+	}
+	if from == models.ReindexSourceIndex && !source.Exists {
+		return nil, source, ErrNoSourceIndex
+	}
+
+	status, err := s.prepare(ctx, source, from)
+	if err != nil {
+		return nil, source, err
+	}
+
+	if from == models.ReindexSourceIndex {
+		err = s.copyIndex(ctx, status, source, token)
+	} else {
+		err = s.copyPools(ctx, status, token)
+	}
+	if err != nil {
+		return s.fail(status, source, err)
+	}
+
+	count, err := s.index.CountDocuments(ctx, status.TargetIndex)
+	if err != nil {
+		return s.fail(status, source, err)
+	}
+	if count != status.Indexed {
+		return s.fail(status, source, fmt.Errorf("index %s holds %d documents, expected %d", status.TargetIndex, count, status.Indexed))
+	}
+
+	if err := s.index.SwapPoolsAlias(ctx, status.TargetIndex, source); err != nil {
+		return s.fail(status, source, err)
+	}
+	status.State = models.ReindexStateSwapped
+	s.save(ctx, status)
+
+	log.Info().
+		Str("index", status.TargetIndex).
+		Str("previous", source.Name).
+		Int64("pools", status.Indexed).
+		Msg("Swapped pools alias to the rebuilt index")
+
+	return status, source, nil
+}
+
+// prepare returns the checkpoint to continue from, creating the target index
+// for a fresh run
+func (s *Service) prepare(ctx context.Context, source elasticsearch.IndexState, from string) (*models.ReindexStatus, error) {
+	prev, err := s.checkpoints.GetReindexStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reindex checkpoint: %w", err)
+	}
+
+	if prev != nil && prev.State == models.ReindexStateRunning && prev.Source == from &&
+		prev.SourceIndex == source.Name && prev.MappingVersion == elasticsearch.PoolsMappingVersion {
+		exists, err := s.index.IndexExists(ctx, prev.TargetIndex)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			log.Info().
+				Str("index", prev.TargetIndex).
+				Str("after", prev.LastPoolID).
+				Int64("indexed", prev.Indexed).
+				Msg("Resuming pools reindex")
+			return prev, nil
+		}
+	}
+
+	// Start over; a target left by a failed or abandoned run is rebuilt
+	target := elasticsearch.PoolsIndexName(source.Generation + 1)
+	if err := s.index.DeleteIndex(ctx, target); err != nil {
+		return nil, err
+	}
+	if _, err := s.index.CreatePoolsIndex(ctx, source.Generation+1, false); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	status := &models.ReindexStatus{
+		State:          models.ReindexStateRunning,
+		Source:         from,
+		SourceIndex:    source.Name,
+		TargetIndex:    target,
+		MappingVersion: elasticsearch.PoolsMappingVersion,
+		StartedAt:      now,
+		UpdatedAt:      now,
+	}
+	s.save(ctx, status)
+
+	log.Info().Str("index", target).Str("previous", source.Name).Str("source", from).Msg("Started pools reindex")
+	return status, nil
+}
+
+// copyPools copies pools after the checkpoint into the target index,
+// checkpointing after every batch and renewing the lock owned by token. It
+// stops if the lock was lost, as another run may be writing the same index.
+func (s *Service) copyPools(ctx context.Context, status *models.ReindexStatus, token string) error {
+	for {
+		pools, err := s.source.ListPoolsAfter(ctx, status.LastPoolID, decimal.Zero, decimal.Zero, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read pools: %w", err)
+		}
+		if len(pools) == 0 {
+			return nil
+		}
+
+		if err := s.index.BulkIndexPoolsInto(ctx, status.TargetIndex, pools); err != nil {
+			return err
+		}
+
+		status.LastPoolID = pools[len(pools)-1].ID
+		status.Indexed += int64(len(pools))
+		s.save(ctx, status)
+
+		if err := s.checkpoints.ExtendReindexLock(ctx, token, lockTTL); errors.Is(err, redis.ErrLockLost) {
+			return fmt.Errorf("reindex lock expired: %w", err)
+		} else if err != nil {
+			log.Warn().Err(err).Msg("Failed to extend reindex lock")
+		}
+
+		if len(pools) < s.batchSize {
+			return nil
+		}
+	}
+}
+
+// copyIndex copies the documents of the index behind the alias into the
+// target index. Documents written to the old index after the copy started are
+// refreshed in the new one by the next ingestion cycle.
+func (s *Service) copyIndex(ctx context.Context, status *models.ReindexStatus, source elasticsearch.IndexState, token string) error {
+	// The copy is a single request that can outlast the lock TTL
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(lockTTL / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.checkpoints.ExtendReindexLock(ctx, token, lockTTL); err != nil {
+					log.Warn().Err(err).Msg("Failed to extend reindex lock")
+				}
+			}
+		}
+	}()
+
+	copied, err := s.index.ReindexDocuments(ctx, source.Name, status.TargetIndex)
+	if err != nil {
+		return err
+	}
+
+	status.Indexed = copied
+	s.save(ctx, status)
+	return nil
+}
+
+// deleteAfterGrace waits out the grace period, then deletes index
+func (s *Service) deleteAfterGrace(ctx context.Context, index string) error {
+	if s.gracePeriod > 0 {
+		timer := time.NewTimer(s.gracePeriod)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return s.index.DeleteIndex(ctx, index)
+}
+
+// fail records err on the checkpoint and returns it. The target index is
+// kept for inspection and rebuilt by the next run. A run stopped by shutdown
+// stays in the running state so the next one resumes it.
+func (s *Service) fail(status *models.ReindexStatus, source elasticsearch.IndexState, err error) (*models.ReindexStatus, elasticsearch.IndexState, error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status, source, err
+	}
+
+	status.State = models.ReindexStateFailed
+	status.Error = err.Error()
+	s.save(context.Background(), status)
+	return status, source, err
+}
+
+// save stores the checkpoint. Failures are logged: a lost checkpoint only
+// means a crashed run starts over.
+func (s *Service) save(ctx context.Context, status *models.ReindexStatus) {
+	status.UpdatedAt = time.Now().UTC()
+	if err := s.checkpoints.SetReindexStatus(ctx, status); err != nil {
+		log.Warn().Err(err).Msg("Failed to save reindex checkpoint")
+	}
+}
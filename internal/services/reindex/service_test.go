@@ -0,0 +1,382 @@
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+)
+
+// fakeCluster keeps indices and the pools alias in memory
+type fakeCluster struct {
+	indices map[string]map[string]bool // index -> document IDs
+	meta    map[string]int             // index -> mapping version
+	alias   string                     // index behind the pools alias; "" if none
+	legacy  bool                       // the unversioned defi_pools index exists
+
+	legacyDocs map[string]bool // documents in the legacy index
+
+	failBulkAfter int // fail bulk requests once this many have succeeded (0 = never)
+	bulks         int
+	dropDocs      int // documents silently lost by the next bulk request
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{indices: make(map[string]map[string]bool), meta: make(map[string]int)}
+}
+
+func (f *fakeCluster) PoolsIndexState(ctx context.Context) (elasticsearch.IndexState, error) {
+	switch {
+	case f.alias != "":
+		var gen int
+		fmt.Sscanf(f.alias, elasticsearch.IndexPools+"_v%d", &gen)
+		return elasticsearch.IndexState{Exists: true, Aliased: true, Name: f.alias, Generation: gen, MappingVersion: f.meta[f.alias]}, nil
+	case f.legacy:
+		return elasticsearch.IndexState{Exists: true, Name: elasticsearch.IndexPools}, nil
+	}
+	return elasticsearch.IndexState{}, nil
+}
+
+func (f *fakeCluster) IndexExists(ctx context.Context, name string) (bool, error) {
+	_, ok := f.indices[name]
+	return ok, nil
+}
+
+func (f *fakeCluster) CreatePoolsIndex(ctx context.Context, generation int, withAlias bool) (string, error) {
+	name := elasticsearch.PoolsIndexName(generation)
+	if _, ok := f.indices[name]; ok {
+		return "", fmt.Errorf("index %s already exists", name)
+	}
+	f.indices[name] = make(map[string]bool)
+	f.meta[name] = elasticsearch.PoolsMappingVersion
+	if withAlias {
+		f.alias = name
+	}
+	return name, nil
+}
+
+func (f *fakeCluster) DeleteIndex(ctx context.Context, name string) error {
+	delete(f.indices, name)
+	return nil
+}
+
+func (f *fakeCluster) BulkIndexPoolsInto(ctx context.Context, index string, pools []models.Pool) error {
+	if f.failBulkAfter > 0 && f.bulks >= f.failBulkAfter {
+		return errors.New("connection reset")
+	}
+	f.bulks++
+
+	for _, pool := range pools {
+		if f.dropDocs > 0 {
+			f.dropDocs--
+			continue
+		}
+		f.indices[index][pool.ID] = true
+	}
+	return nil
+}
+
+func (f *fakeCluster) ReindexDocuments(ctx context.Context, source, target string) (int64, error) {
+	docs, ok := f.indices[source]
+	if !ok && source == elasticsearch.IndexPools && f.legacy {
+		docs, ok = f.legacyDocs, true
+	}
+	if !ok {
+		return 0, fmt.Errorf("index %s not found", source)
+	}
+
+	var copied int64
+	for id := range docs {
+		if f.dropDocs > 0 {
+			f.dropDocs--
+			continue
+		}
+		f.indices[target][id] = true
+		copied++
+	}
+	return copied, nil
+}
+
+func (f *fakeCluster) CountDocuments(ctx context.Context, index string) (int64, error) {
+	return int64(len(f.indices[index])), nil
+}
+
+func (f *fakeCluster) SwapPoolsAlias(ctx context.Context, newIndex string, previous elasticsearch.IndexState) error {
+	if previous.Exists && !previous.Aliased {
+		f.legacy = false
+	}
+	f.alias = newIndex
+	return nil
+}
+
+// fakeSource serves pool IDs in order like ListPoolsAfter
+type fakeSource struct {
+	ids []string
+}
+
+func (f *fakeSource) ListPoolsAfter(ctx context.Context, afterID string, minTVL, minVolumeTVLRatio decimal.Decimal, limit int) ([]models.Pool, error) {
+	pools := make([]models.Pool, 0, limit)
+	for _, id := range f.ids {
+		if id <= afterID {
+			continue
+		}
+		pools = append(pools, models.Pool{ID: id})
+		if len(pools) == limit {
+			break
+		}
+	}
+	return pools, nil
+}
+
+// fakeCheckpoints keeps the checkpoint and lock in memory like Redis
+type fakeCheckpoints struct {
+	status *models.ReindexStatus
+	locked bool
+	lost   bool // The lock expired and can't be extended
+}
+
+func (f *fakeCheckpoints) GetReindexStatus(ctx context.Context) (*models.ReindexStatus, error) {
+	if f.status == nil {
+		return nil, nil
+	}
+	copied := *f.status
+	return &copied, nil
+}
+
+func (f *fakeCheckpoints) SetReindexStatus(ctx context.Context, status *models.ReindexStatus) error {
+	copied := *status
+	f.status = &copied
+	return nil
+}
+
+func (f *fakeCheckpoints) AcquireReindexLock(ctx context.Context, ttl time.Duration) (string, bool, error) {
+	if f.locked {
+		return "", false, nil
+	}
+	f.locked = true
+	return "token", true, nil
+}
+
+func (f *fakeCheckpoints) ExtendReindexLock(ctx context.Context, token string, ttl time.Duration) error {
+	if f.lost {
+		return redis.ErrLockLost
+	}
+	return nil
+}
+
+func (f *fakeCheckpoints) ReleaseReindexLock(ctx context.Context, token string) error {
+	f.locked = false
+	return nil
+}
+
+func newTestService(cluster *fakeCluster, poolCount int) (*Service, *fakeCheckpoints) {
+	ids := make([]string, poolCount)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("pool-%04d", i)
+	}
+	sort.Strings(ids)
+
+	checkpoints := &fakeCheckpoints{}
+	return &Service{
+		index:       cluster,
+		source:      &fakeSource{ids: ids},
+		checkpoints: checkpoints,
+		batchSize:   100,
+	}, checkpoints
+}
+
+func TestRun_ResumesAfterCrash(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.CreatePoolsIndex(context.Background(), 1, true)
+	service, checkpoints := newTestService(cluster, 250)
+	ctx := context.Background()
+
+	// The second batch fails, as if the worker died mid-copy
+	cluster.failBulkAfter = 1
+	if _, err := service.Run(ctx); err == nil {
+		t.Fatal("Expected the interrupted run to fail")
+	}
+	if checkpoints.locked {
+		t.Error("Expected the lock to be released after a failed run")
+	}
+	if cluster.alias != elasticsearch.PoolsIndexName(1) {
+		t.Fatalf("Expected the alias to stay on the old index, got %s", cluster.alias)
+	}
+
+	// Simulate a crash rather than a clean failure: the checkpoint is left running
+	checkpoints.status.State = models.ReindexStateRunning
+	checkpoints.status.Error = ""
+
+	cluster.failBulkAfter = 0
+	bulksBefore := cluster.bulks
+	status, err := service.Run(ctx)
+	if err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+
+	if got := cluster.bulks - bulksBefore; got != 2 {
+		t.Errorf("Expected the resumed run to copy the remaining 2 batches, copied %d", got)
+	}
+	if status.State != models.ReindexStateCompleted || status.Indexed != 250 {
+		t.Errorf("Expected a completed run over 250 pools, got %+v", status)
+	}
+	if cluster.alias != elasticsearch.PoolsIndexName(2) {
+		t.Errorf("Expected the alias on %s, got %s", elasticsearch.PoolsIndexName(2), cluster.alias)
+	}
+	if _, ok := cluster.indices[elasticsearch.PoolsIndexName(1)]; ok {
+		t.Error("Expected the previous index to be deleted")
+	}
+}
+
+func TestRun_CountMismatchKeepsAlias(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.CreatePoolsIndex(context.Background(), 1, true)
+	cluster.dropDocs = 3
+	service, checkpoints := newTestService(cluster, 150)
+
+	_, err := service.Run(context.Background())
+	if err == nil {
+		t.Fatal("Expected a document count mismatch error")
+	}
+
+	if cluster.alias != elasticsearch.PoolsIndexName(1) {
+		t.Errorf("Expected the alias to stay on the old index, got %s", cluster.alias)
+	}
+	if checkpoints.status.State != models.ReindexStateFailed || checkpoints.status.Error == "" {
+		t.Errorf("Expected a failed checkpoint with the reason, got %+v", checkpoints.status)
+	}
+
+	// A failed run isn't resumed; the next one starts over
+	status, err := service.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if status.Indexed != 150 || cluster.alias != elasticsearch.PoolsIndexName(2) {
+		t.Errorf("Expected a full rebuild into %s, got %+v", elasticsearch.PoolsIndexName(2), status)
+	}
+}
+
+func TestEnsureCurrent_MigratesLegacyIndex(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.legacy = true
+	service, _ := newTestService(cluster, 42)
+
+	if err := service.EnsureCurrent(context.Background()); err != nil {
+		t.Fatalf("EnsureCurrent failed: %v", err)
+	}
+	if cluster.legacy || cluster.alias != elasticsearch.PoolsIndexName(1) {
+		t.Fatalf("Expected the legacy index replaced by an aliased %s, got alias %q legacy %v", elasticsearch.PoolsIndexName(1), cluster.alias, cluster.legacy)
+	}
+
+	// The rebuilt index is current, so nothing else happens
+	bulks := cluster.bulks
+	if err := service.EnsureCurrent(context.Background()); err != nil {
+		t.Fatalf("EnsureCurrent failed: %v", err)
+	}
+	if cluster.bulks != bulks {
+		t.Error("Expected no reindex for an up-to-date index")
+	}
+}
+
+func TestRun_LockedByAnotherProcess(t *testing.T) {
+	service, checkpoints := newTestService(newFakeCluster(), 10)
+	checkpoints.locked = true
+
+	if _, err := service.Run(context.Background()); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning, got %v", err)
+	}
+}
+
+func TestRun_StopsWhenLockExpires(t *testing.T) {
+	cluster := newFakeCluster()
+	service, checkpoints := newTestService(cluster, 250)
+	checkpoints.lost = true
+
+	if _, err := service.Run(context.Background()); !errors.Is(err, redis.ErrLockLost) {
+		t.Fatalf("Expected ErrLockLost, got %v", err)
+	}
+	if cluster.bulks != 1 {
+		t.Errorf("Expected the run to stop after the first batch, got %d bulk requests", cluster.bulks)
+	}
+	if cluster.alias != "" {
+		t.Errorf("Expected the alias left alone, got %s", cluster.alias)
+	}
+}
+
+func TestRunFromIndex_CopiesCurrentIndex(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.CreatePoolsIndex(context.Background(), 1, true)
+	for i := 0; i < 30; i++ {
+		cluster.indices[elasticsearch.PoolsIndexName(1)][fmt.Sprintf("pool-%04d", i)] = true
+	}
+	// PostgreSQL holds different pools, so a copy from it would be noticed
+	service, checkpoints := newTestService(cluster, 5)
+
+	status, err := service.RunFromIndex(context.Background())
+	if err != nil {
+		t.Fatalf("RunFromIndex failed: %v", err)
+	}
+	if status.Source != models.ReindexSourceIndex || status.Indexed != 30 || status.State != models.ReindexStateCompleted {
+		t.Errorf("Expected 30 documents copied from the index, got %+v", status)
+	}
+	if cluster.bulks != 0 {
+		t.Errorf("Expected no pools read from PostgreSQL, got %d bulk requests", cluster.bulks)
+	}
+	if cluster.alias != elasticsearch.PoolsIndexName(2) || len(cluster.indices[elasticsearch.PoolsIndexName(2)]) != 30 {
+		t.Errorf("Expected the alias on a full %s, got alias %s", elasticsearch.PoolsIndexName(2), cluster.alias)
+	}
+	if checkpoints.locked {
+		t.Error("Expected the lock to be released")
+	}
+}
+
+func TestRunFromIndex_Failures(t *testing.T) {
+	t.Run("no index to copy from", func(t *testing.T) {
+		service, _ := newTestService(newFakeCluster(), 5)
+		if _, err := service.RunFromIndex(context.Background()); !errors.Is(err, ErrNoSourceIndex) {
+			t.Errorf("Expected ErrNoSourceIndex, got %v", err)
+		}
+	})
+
+	t.Run("lost documents keep the alias", func(t *testing.T) {
+		cluster := newFakeCluster()
+		cluster.legacy = true
+		cluster.legacyDocs = map[string]bool{"a": true, "b": true, "c": true}
+		service, checkpoints := newTestService(cluster, 5)
+
+		// The copy reports every document written but one never arrives
+		cluster.dropDocs = 1
+		service.index = &miscountingCluster{fakeCluster: cluster}
+
+		if _, err := service.RunFromIndex(context.Background()); err == nil {
+			t.Fatal("Expected a document count mismatch error")
+		}
+		if !cluster.legacy || cluster.alias != "" {
+			t.Errorf("Expected the legacy index kept, got alias %q legacy %v", cluster.alias, cluster.legacy)
+		}
+		if checkpoints.status.State != models.ReindexStateFailed || checkpoints.status.Source != models.ReindexSourceIndex {
+			t.Errorf("Expected a failed index checkpoint, got %+v", checkpoints.status)
+		}
+	})
+}
+
+// miscountingCluster reports every legacy document as copied, even ones the
+// cluster dropped
+type miscountingCluster struct {
+	*fakeCluster
+}
+
+func (m *miscountingCluster) ReindexDocuments(ctx context.Context, source, target string) (int64, error) {
+	if _, err := m.fakeCluster.ReindexDocuments(ctx, source, target); err != nil {
+		return 0, err
+	}
+	return int64(len(m.legacyDocs)), nil
+}
@@ -0,0 +1,153 @@
+// Package rewards resolves the reward tokens of pools and estimates what
+// their emissions are worth, for the pool detail's rewards section.
+package rewards
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/coingecko"
+	"github.com/maxjove/defi-yield-aggregator/internal/utils"
+)
+
+const (
+	// lookupTimeout bounds a CoinGecko contract lookup so an unknown token
+	// can't hold up the pool detail
+	lookupTimeout = 3 * time.Second
+	// knownTokenTTL is how long a resolved contract stays cached (seconds)
+	knownTokenTTL = 7 * 24 * 3600
+	// unknownTokenTTL is how long a contract CoinGecko doesn't list stays
+	// cached before it's looked up again (seconds)
+	unknownTokenTTL = 24 * 3600
+)
+
+// tokenLookup resolves token contracts.
+// Implemented by the CoinGecko client.
+type tokenLookup interface {
+	LookupContract(ctx context.Context, chain, address string) (coingecko.Token, error)
+}
+
+// tokenCache caches resolutions and holds the prices fetched by the worker.
+// Implemented by the Redis repository.
+type tokenCache interface {
+	GetResolvedToken(ctx context.Context, chain, address string) (*models.ResolvedToken, error)
+	SetResolvedToken(ctx context.Context, token *models.ResolvedToken, ttlSeconds int) error
+	GetTokenPrice(ctx context.Context, tokenID string) (float64, error)
+	AddRewardTokens(ctx context.Context, tokenIDs []string, at time.Time) error
+}
+
+// Service builds the rewards section of pool details
+type Service struct {
+	lookup tokenLookup
+	cache  tokenCache
+	now    func() time.Time
+}
+
+// NewService creates a new rewards service
+func NewService(lookup tokenLookup, cache tokenCache) *Service {
+	return &Service{
+		lookup: lookup,
+		cache:  cache,
+		now:    time.Now,
+	}
+}
+
+// PoolRewards resolves a pool's reward tokens and prices them from the
+// cache. Tokens that can't be resolved are listed by address only, and
+// tokens without a cached price have no price; resolved tokens are
+// registered so the worker starts fetching their prices.
+func (s *Service) PoolRewards(ctx context.Context, pool *models.Pool) *models.PoolRewards {
+	dailyUSD := models.EstimateDailyRewardPer1000(pool.APYReward)
+	rewards := &models.PoolRewards{
+		APYReward:                pool.APYReward,
+		Tokens:                   make([]models.RewardToken, 0, len(pool.RewardTokens)),
+		EstimatedDailyUSDPer1000: dailyUSD,
+		Note:                     models.RewardsEstimateNote,
+	}
+
+	var ids []string
+	for _, address := range pool.RewardTokens {
+		token := models.RewardToken{Address: address}
+
+		resolved, ok := s.resolve(ctx, pool.Chain, address)
+		if ok {
+			token.Symbol = resolved.Symbol
+			token.CoinGeckoID = resolved.ID
+			ids = append(ids, resolved.ID)
+
+			price, err := s.cache.GetTokenPrice(ctx, resolved.ID)
+			if err != nil {
+				log.Debug().Err(err).Str("token", resolved.ID).Msg("Failed to get cached token price")
+			} else if price > 0 {
+				p := decimal.NewFromFloat(price)
+				token.PriceUSD = &p
+			}
+		}
+		rewards.Tokens = append(rewards.Tokens, token)
+	}
+
+	// The reward APY can only be turned into a token amount when it all
+	// comes from one token
+	if len(rewards.Tokens) == 1 && rewards.Tokens[0].PriceUSD != nil {
+		amount := dailyUSD.Div(*rewards.Tokens[0].PriceUSD).Round(6)
+		rewards.Tokens[0].EstimatedDailyTokensPer1000 = &amount
+	}
+
+	if err := s.cache.AddRewardTokens(ctx, ids, s.now()); err != nil {
+		log.Debug().Err(err).Msg("Failed to register reward tokens for pricing")
+	}
+
+	return rewards
+}
+
+// resolve resolves a reward token without the API if possible, then from
+// the cache, then through a contract lookup
+func (s *Service) resolve(ctx context.Context, chain, address string) (coingecko.Token, bool) {
+	if token, ok := coingecko.ResolveToken(chain, address); ok {
+		return token, true
+	}
+	if !coingecko.IsAddress(address) {
+		return coingecko.Token{}, false
+	}
+
+	chain = utils.NormalizeChainName(chain)
+	address = strings.ToLower(address)
+
+	cached, err := s.cache.GetResolvedToken(ctx, chain, address)
+	if err != nil {
+		log.Debug().Err(err).Str("token", address).Msg("Failed to get cached token resolution")
+	}
+	if cached != nil {
+		return coingecko.Token{ID: cached.CoinGeckoID, Symbol: cached.Symbol}, cached.CoinGeckoID != ""
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	token, err := s.lookup.LookupContract(lookupCtx, chain, address)
+	resolution := &models.ResolvedToken{Chain: chain, Address: address}
+	ttl := knownTokenTTL
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		ttl = unknownTokenTTL
+	case err != nil:
+		// Transient failures aren't cached, the next request tries again
+		log.Warn().Err(err).Str("chain", chain).Str("token", address).Msg("Failed to look up reward token")
+		return coingecko.Token{}, false
+	default:
+		resolution.CoinGeckoID = token.ID
+		resolution.Symbol = token.Symbol
+	}
+
+	if err := s.cache.SetResolvedToken(ctx, resolution, ttl); err != nil {
+		log.Debug().Err(err).Str("token", address).Msg("Failed to cache token resolution")
+	}
+	return token, resolution.CoinGeckoID != ""
+}
@@ -0,0 +1,202 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/coingecko"
+)
+
+const (
+	pendleAddress  = "0x808507121B80c02388fAd14726482e061B8da827"
+	unknownAddress = "0x1111111111111111111111111111111111111111"
+	flakyAddress   = "0x2222222222222222222222222222222222222222"
+)
+
+// fakeLookup serves CoinGecko contract lookups and counts them
+type fakeLookup struct {
+	tokens map[string]coingecko.Token
+	calls  int
+}
+
+func (f *fakeLookup) LookupContract(_ context.Context, chain, address string) (coingecko.Token, error) {
+	f.calls++
+	if address == flakyAddress {
+		return coingecko.Token{}, errors.New("unexpected status code: 429")
+	}
+	if token, ok := f.tokens[chain+":"+address]; ok {
+		return token, nil
+	}
+	return coingecko.Token{}, fmt.Errorf("contract %s: %w", address, os.ErrNotExist)
+}
+
+// fakeCache keeps resolutions and prices in memory
+type fakeCache struct {
+	resolved   map[string]models.ResolvedToken
+	ttls       map[string]int
+	prices     map[string]float64
+	registered []string
+}
+
+func newFakeCache(prices map[string]float64) *fakeCache {
+	return &fakeCache{
+		resolved: make(map[string]models.ResolvedToken),
+		ttls:     make(map[string]int),
+		prices:   prices,
+	}
+}
+
+func (f *fakeCache) GetResolvedToken(_ context.Context, chain, address string) (*models.ResolvedToken, error) {
+	if token, ok := f.resolved[chain+":"+address]; ok {
+		return &token, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeCache) SetResolvedToken(_ context.Context, token *models.ResolvedToken, ttlSeconds int) error {
+	key := token.Chain + ":" + token.Address
+	f.resolved[key] = *token
+	f.ttls[key] = ttlSeconds
+	return nil
+}
+
+func (f *fakeCache) GetTokenPrice(_ context.Context, tokenID string) (float64, error) {
+	return f.prices[tokenID], nil
+}
+
+func (f *fakeCache) AddRewardTokens(_ context.Context, tokenIDs []string, _ time.Time) error {
+	f.registered = append(f.registered, tokenIDs...)
+	return nil
+}
+
+func rewardPool(apyReward string, tokens ...string) *models.Pool {
+	return &models.Pool{
+		ID:           "pool-1",
+		Chain:        "Ethereum",
+		APYReward:    decimal.RequireFromString(apyReward),
+		RewardTokens: tokens,
+	}
+}
+
+func TestPoolRewards_KnownToken(t *testing.T) {
+	lookup := &fakeLookup{tokens: map[string]coingecko.Token{
+		"ethereum:0x808507121b80c02388fad14726482e061b8da827": {ID: "pendle", Symbol: "PENDLE"},
+	}}
+	cache := newFakeCache(map[string]float64{"pendle": 5})
+	s := NewService(lookup, cache)
+
+	rewards := s.PoolRewards(context.Background(), rewardPool("73", pendleAddress))
+
+	// 73 / 100 / 365 * 1000
+	if !rewards.EstimatedDailyUSDPer1000.Equal(decimal.RequireFromString("2")) {
+		t.Errorf("Expected $2 a day per $1,000, got %s", rewards.EstimatedDailyUSDPer1000)
+	}
+	if rewards.Note == "" {
+		t.Error("Expected the estimate to be labeled")
+	}
+	if len(rewards.Tokens) != 1 {
+		t.Fatalf("Expected 1 reward token, got %+v", rewards.Tokens)
+	}
+
+	token := rewards.Tokens[0]
+	if token.Address != pendleAddress || token.Symbol != "PENDLE" || token.CoinGeckoID != "pendle" {
+		t.Errorf("Expected PENDLE resolved, got %+v", token)
+	}
+	if token.PriceUSD == nil || !token.PriceUSD.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("Expected the cached price, got %v", token.PriceUSD)
+	}
+	if token.EstimatedDailyTokensPer1000 == nil || !token.EstimatedDailyTokensPer1000.Equal(decimal.RequireFromString("0.4")) {
+		t.Errorf("Expected 0.4 PENDLE a day per $1,000, got %v", token.EstimatedDailyTokensPer1000)
+	}
+	if len(cache.registered) != 1 || cache.registered[0] != "pendle" {
+		t.Errorf("Expected pendle registered for pricing, got %v", cache.registered)
+	}
+
+	// The resolution is cached for later requests
+	s.PoolRewards(context.Background(), rewardPool("73", pendleAddress))
+	if lookup.calls != 1 {
+		t.Errorf("Expected one contract lookup, got %d", lookup.calls)
+	}
+	if ttl := cache.ttls["ethereum:0x808507121b80c02388fad14726482e061b8da827"]; ttl != knownTokenTTL {
+		t.Errorf("Expected the resolution cached for %ds, got %d", knownTokenTTL, ttl)
+	}
+}
+
+func TestPoolRewards_UnknownToken(t *testing.T) {
+	lookup := &fakeLookup{}
+	cache := newFakeCache(nil)
+	s := NewService(lookup, cache)
+
+	rewards := s.PoolRewards(context.Background(), rewardPool("36.5", unknownAddress, flakyAddress))
+
+	if len(rewards.Tokens) != 2 {
+		t.Fatalf("Expected 2 reward tokens, got %+v", rewards.Tokens)
+	}
+	for _, token := range rewards.Tokens {
+		if token.Symbol != "" || token.CoinGeckoID != "" || token.PriceUSD != nil || token.EstimatedDailyTokensPer1000 != nil {
+			t.Errorf("Expected only the address of an unresolved token, got %+v", token)
+		}
+	}
+	if !rewards.EstimatedDailyUSDPer1000.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Expected the USD estimate without prices, got %s", rewards.EstimatedDailyUSDPer1000)
+	}
+	if len(cache.registered) != 0 {
+		t.Errorf("Expected nothing registered for pricing, got %v", cache.registered)
+	}
+
+	// Unlisted contracts are remembered for a day, failed lookups retried
+	if ttl := cache.ttls["ethereum:"+unknownAddress]; ttl != unknownTokenTTL {
+		t.Errorf("Expected the unknown token cached for %ds, got %d", unknownTokenTTL, ttl)
+	}
+	if _, ok := cache.resolved["ethereum:"+flakyAddress]; ok {
+		t.Error("Expected a failed lookup not to be cached")
+	}
+
+	s.PoolRewards(context.Background(), rewardPool("36.5", unknownAddress, flakyAddress))
+	if lookup.calls != 3 {
+		t.Errorf("Expected only the failed lookup retried, got %d lookups", lookup.calls)
+	}
+}
+
+func TestPoolRewards_MultipleTokens(t *testing.T) {
+	lookup := &fakeLookup{}
+	cache := newFakeCache(map[string]float64{"curve-dao-token": 0.5})
+	s := NewService(lookup, cache)
+
+	pool := rewardPool("10", "CRV", "0x0000000000000000000000000000000000000000", unknownAddress)
+	pool.Chain = "Polygon"
+	rewards := s.PoolRewards(context.Background(), pool)
+
+	if len(rewards.Tokens) != 3 {
+		t.Fatalf("Expected 3 reward tokens, got %+v", rewards.Tokens)
+	}
+
+	crv, native, unknown := rewards.Tokens[0], rewards.Tokens[1], rewards.Tokens[2]
+	if crv.Symbol != "CRV" || crv.PriceUSD == nil || !crv.PriceUSD.Equal(decimal.RequireFromString("0.5")) {
+		t.Errorf("Expected priced CRV, got %+v", crv)
+	}
+	if native.Symbol != "MATIC" || native.CoinGeckoID != "matic-network" || native.PriceUSD != nil {
+		t.Errorf("Expected unpriced MATIC for the native token, got %+v", native)
+	}
+	if unknown.Address != unknownAddress || unknown.Symbol != "" {
+		t.Errorf("Expected the unknown token by address, got %+v", unknown)
+	}
+	for _, token := range rewards.Tokens {
+		if token.EstimatedDailyTokensPer1000 != nil {
+			t.Errorf("Expected no token amounts with several reward tokens, got %+v", token)
+		}
+	}
+	if lookup.calls != 1 {
+		t.Errorf("Expected only the unknown contract looked up, got %d", lookup.calls)
+	}
+	if len(cache.registered) != 2 {
+		t.Errorf("Expected CRV and MATIC registered for pricing, got %v", cache.registered)
+	}
+}
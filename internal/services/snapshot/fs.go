@@ -0,0 +1,135 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// fileSuffix is appended to the snapshot ID to form its file name
+const fileSuffix = ".json.gz"
+
+// FSStore stores snapshots as files in a directory
+type FSStore struct {
+	dir string
+}
+
+// NewFSStore creates a filesystem store, creating the directory if needed
+func NewFSStore(dir string) (*FSStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	return &FSStore{dir: dir}, nil
+}
+
+// path returns the file path for a capture time
+func (s *FSStore) path(capturedAt time.Time) string {
+	return filepath.Join(s.dir, ID(capturedAt)+fileSuffix)
+}
+
+// SaveSnapshot writes a snapshot file, replacing any with the same timestamp
+func (s *FSStore) SaveSnapshot(ctx context.Context, capturedAt time.Time, data []byte) error {
+	// Write to a temp file first so readers never see a partial snapshot
+	tmp, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(capturedAt)); err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots in the directory, newest first
+func (s *FSStore) ListSnapshots(ctx context.Context) ([]models.Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := make([]models.Snapshot, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), fileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		capturedAt, err := ParseID(id)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, models.Snapshot{
+			ID:         id,
+			CapturedAt: capturedAt,
+			SizeBytes:  info.Size(),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CapturedAt.After(snapshots[j].CapturedAt)
+	})
+
+	return snapshots, nil
+}
+
+// OpenSnapshot opens a snapshot file for reading
+func (s *FSStore) OpenSnapshot(ctx context.Context, capturedAt time.Time) (io.ReadCloser, int64, error) {
+	file, err := os.Open(s.path(capturedAt))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	return file, info.Size(), nil
+}
+
+// DeleteSnapshotsBefore removes snapshots captured before the cutoff
+func (s *FSStore) DeleteSnapshotsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	snapshots, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, snap := range snapshots {
+		if !snap.CapturedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(s.path(snap.CapturedAt)); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("failed to delete snapshot %s: %w", snap.ID, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
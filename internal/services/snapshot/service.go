@@ -0,0 +1,126 @@
+// Package snapshot archives the raw DeFiLlama pools responses fetched by the
+// worker, so the exact upstream data behind a historical opportunity can be
+// retrieved later. Snapshots are gzip-compressed and keyed by capture time.
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+)
+
+// Storage backends
+const (
+	BackendFS       = "fs"
+	BackendPostgres = "postgres"
+)
+
+var (
+	// ErrTooLarge is returned when a compressed snapshot exceeds the size cap
+	ErrTooLarge = errors.New("snapshot exceeds maximum size")
+	// ErrInvalidID is returned for snapshot IDs that aren't unix timestamps
+	ErrInvalidID = errors.New("invalid snapshot id")
+)
+
+// Store persists compressed snapshots. OpenSnapshot returns an error wrapping
+// os.ErrNotExist when no snapshot exists for the given time.
+type Store interface {
+	SaveSnapshot(ctx context.Context, capturedAt time.Time, data []byte) error
+	ListSnapshots(ctx context.Context) ([]models.Snapshot, error)
+	OpenSnapshot(ctx context.Context, capturedAt time.Time) (io.ReadCloser, int64, error)
+	DeleteSnapshotsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// NewStore returns the store for the configured backend
+func NewStore(cfg config.SnapshotConfig, pg *postgres.Repository) (Store, error) {
+	switch cfg.Backend {
+	case BackendFS:
+		return NewFSStore(cfg.Dir)
+	case BackendPostgres:
+		return pg, nil
+	default:
+		return nil, fmt.Errorf("unknown snapshot backend: %s", cfg.Backend)
+	}
+}
+
+// Service compresses, stores and prunes snapshots
+type Service struct {
+	store     Store
+	maxBytes  int
+	retention time.Duration
+}
+
+// NewService creates a new snapshot service
+func NewService(cfg config.SnapshotConfig, store Store) *Service {
+	return &Service{
+		store:     store,
+		maxBytes:  cfg.MaxBytes,
+		retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+	}
+}
+
+// Archive compresses and stores a raw response captured at the given time
+func (s *Service) Archive(ctx context.Context, capturedAt time.Time, raw []byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+
+	if s.maxBytes > 0 && buf.Len() > s.maxBytes {
+		return fmt.Errorf("%w: %d bytes, maximum is %d", ErrTooLarge, buf.Len(), s.maxBytes)
+	}
+
+	return s.store.SaveSnapshot(ctx, capturedAt.UTC().Truncate(time.Second), buf.Bytes())
+}
+
+// List returns the available snapshots, newest first
+func (s *Service) List(ctx context.Context) ([]models.Snapshot, error) {
+	return s.store.ListSnapshots(ctx)
+}
+
+// Open returns a reader over the compressed snapshot with the given ID and its size
+func (s *Service) Open(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	capturedAt, err := ParseID(id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.store.OpenSnapshot(ctx, capturedAt)
+}
+
+// Prune deletes snapshots older than the retention period
+func (s *Service) Prune(ctx context.Context, now time.Time) (int64, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+
+	return s.store.DeleteSnapshotsBefore(ctx, now.Add(-s.retention))
+}
+
+// ID returns the snapshot ID for a capture time
+func ID(capturedAt time.Time) string {
+	return strconv.FormatInt(capturedAt.Unix(), 10)
+}
+
+// ParseID converts a snapshot ID back to its capture time
+func ParseID(id string) (time.Time, error) {
+	sec, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || sec <= 0 {
+		return time.Time{}, ErrInvalidID
+	}
+
+	return time.Unix(sec, 0).UTC(), nil
+}
@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+)
+
+func newTestService(t *testing.T, cfg config.SnapshotConfig) *Service {
+	t.Helper()
+
+	store, err := NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	return NewService(cfg, store)
+}
+
+func TestArchiveListPrune(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t, config.SnapshotConfig{RetentionDays: 7})
+
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	old := now.Add(-8 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	raw := []byte(`{"status":"success","data":[{"pool":"abc","apy":40}]}`)
+	for _, ts := range []time.Time{old, recent} {
+		if err := service.Archive(ctx, ts, raw); err != nil {
+			t.Fatalf("Archive failed: %v", err)
+		}
+	}
+
+	snapshots, err := service.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(snapshots))
+	}
+	if snapshots[0].ID != ID(recent) || snapshots[1].ID != ID(old) {
+		t.Errorf("Expected newest first, got %s then %s", snapshots[0].ID, snapshots[1].ID)
+	}
+
+	// The stored snapshot decompresses back to the raw response
+	reader, size, err := service.Open(ctx, ID(recent))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer reader.Close()
+
+	if size != snapshots[0].SizeBytes {
+		t.Errorf("Expected size %d, got %d", snapshots[0].SizeBytes, size)
+	}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatalf("Snapshot is not gzip: %v", err)
+	}
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to decompress snapshot: %v", err)
+	}
+	if string(decoded) != string(raw) {
+		t.Errorf("Expected %s, got %s", raw, decoded)
+	}
+
+	deleted, err := service.Prune(ctx, now)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted snapshot, got %d", deleted)
+	}
+
+	snapshots, err = service.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != ID(recent) {
+		t.Errorf("Expected only the recent snapshot to remain, got %+v", snapshots)
+	}
+
+	if _, _, err := service.Open(ctx, ID(old)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not-exist error for pruned snapshot, got %v", err)
+	}
+}
+
+func TestArchive_SizeCap(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t, config.SnapshotConfig{MaxBytes: 16})
+
+	err := service.Archive(ctx, time.Now(), []byte(`{"status":"success","data":[{"pool":"abc"}]}`))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+
+	snapshots, err := service.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("Expected oversized snapshot to be skipped, got %d snapshots", len(snapshots))
+	}
+}
+
+func TestOpen_InvalidID(t *testing.T) {
+	service := newTestService(t, config.SnapshotConfig{})
+
+	for _, id := range []string{"", "abc", "-5"} {
+		if _, _, err := service.Open(context.Background(), id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ID %q: expected ErrInvalidID, got %v", id, err)
+		}
+	}
+}
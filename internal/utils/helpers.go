@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -87,22 +88,38 @@ func FormatPercentage(d decimal.Decimal) string {
 	return d.StringFixed(2) + "%"
 }
 
-// FormatUSD formats a decimal as USD string
+// usdUnits are the suffixes FormatUSD abbreviates amounts with, smallest
+// first
+var usdUnits = []struct {
+	scale  decimal.Decimal
+	suffix string
+}{
+	{decimal.NewFromInt(1), ""},
+	{decimal.NewFromInt(1e3), "K"},
+	{decimal.NewFromInt(1e6), "M"},
+	{decimal.NewFromInt(1e9), "B"},
+	{decimal.NewFromInt(1e12), "T"},
+}
+
+// FormatUSD formats a decimal as USD string, abbreviated with the largest
+// unit it reaches once rounded to 2 decimals: 999.994 is $999.99 but
+// 999.995 is $1.00K, never $1000.00
 func FormatUSD(d decimal.Decimal) string {
-	f, _ := d.Float64()
+	sign := ""
+	if d.IsNegative() {
+		sign = "-"
+		d = d.Abs()
+	}
 
-	switch {
-	case f >= 1e12:
-		return "$" + decimal.NewFromFloat(f/1e12).StringFixed(2) + "T"
-	case f >= 1e9:
-		return "$" + decimal.NewFromFloat(f/1e9).StringFixed(2) + "B"
-	case f >= 1e6:
-		return "$" + decimal.NewFromFloat(f/1e6).StringFixed(2) + "M"
-	case f >= 1e3:
-		return "$" + decimal.NewFromFloat(f/1e3).StringFixed(2) + "K"
-	default:
-		return "$" + d.StringFixed(2)
+	thousand := decimal.NewFromInt(1000)
+	unit := 0
+	scaled := d.Round(2)
+	for unit < len(usdUnits)-1 && scaled.GreaterThanOrEqual(thousand) {
+		unit++
+		scaled = d.Div(usdUnits[unit].scale).Round(2)
 	}
+
+	return sign + "$" + scaled.StringFixed(2) + usdUnits[unit].suffix
 }
 
 // Slugify converts a string to a URL-friendly slug
@@ -182,34 +199,36 @@ func UniqueStrings(slice []string) []string {
 
 // TimeAgo formats a time as a human-readable "time ago" string
 func TimeAgo(t time.Time) string {
-	duration := time.Since(t)
+	return timeAgo(t, time.Now())
+}
+
+// timeAgo formats t relative to now: "5 minutes ago" up to a week, the date
+// after that
+func timeAgo(t, now time.Time) string {
+	duration := now.Sub(t)
 
 	switch {
 	case duration < time.Minute:
 		return "just now"
 	case duration < time.Hour:
-		mins := int(duration.Minutes())
-		if mins == 1 {
-			return "1 minute ago"
-		}
-		return strings.Replace(duration.Truncate(time.Minute).String(), "0s", "", 1) + " ago"
+		return unitsAgo(int(duration/time.Minute), "minute")
 	case duration < 24*time.Hour:
-		hours := int(duration.Hours())
-		if hours == 1 {
-			return "1 hour ago"
-		}
-		return strings.Replace(duration.Truncate(time.Hour).String(), "0m0s", "", 1) + " ago"
+		return unitsAgo(int(duration/time.Hour), "hour")
 	case duration < 7*24*time.Hour:
-		days := int(duration.Hours() / 24)
-		if days == 1 {
-			return "1 day ago"
-		}
-		return string(rune(days)) + " days ago"
+		return unitsAgo(int(duration/(24*time.Hour)), "day")
 	default:
 		return t.Format("Jan 2, 2006")
 	}
 }
 
+// unitsAgo formats n whole units in the past: "1 hour ago", "3 hours ago"
+func unitsAgo(n int, unit string) string {
+	if n != 1 {
+		unit += "s"
+	}
+	return strconv.Itoa(n) + " " + unit + " ago"
+}
+
 // ParseDuration parses a duration string (e.g., "3m", "1h", "24h")
 func ParseDuration(s string) (time.Duration, error) {
 	return time.ParseDuration(s)
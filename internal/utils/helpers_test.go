@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeAgo(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		ago  time.Duration
+		want string
+	}{
+		{"now", 0, "just now"},
+		{"seconds", 45 * time.Second, "just now"},
+		{"one minute", time.Minute, "1 minute ago"},
+		{"minutes", 5*time.Minute + 30*time.Second, "5 minutes ago"},
+		{"under an hour", 59*time.Minute + 59*time.Second, "59 minutes ago"},
+		{"one hour", time.Hour + 20*time.Minute, "1 hour ago"},
+		{"hours", 3*time.Hour + 45*time.Minute, "3 hours ago"},
+		{"one day", 24 * time.Hour, "1 day ago"},
+		{"days", 2*24*time.Hour + 5*time.Hour, "2 days ago"},
+		{"under a week", 7*24*time.Hour - time.Second, "6 days ago"},
+		{"a week", 7 * 24 * time.Hour, "Mar 8, 2026"},
+		{"months", 60 * 24 * time.Hour, "Jan 14, 2026"},
+		{"future", -time.Hour, "just now"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timeAgo(now.Add(-tt.ago), now); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
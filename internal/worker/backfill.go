@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/defillama"
+)
+
+// BackfillSummary reports a pool history backfill
+type BackfillSummary struct {
+	PoolID   string `json:"poolId"`
+	Points   int    `json:"points"`   // Points returned by DeFiLlama
+	Inserted int64  `json:"inserted"` // Points not already recorded
+}
+
+// Backfiller loads a pool's full history from DeFiLlama, filling gaps
+// left by outages or by pools ingested after they launched
+type Backfiller struct {
+	client *defillama.Client
+	pgRepo *postgres.Repository
+}
+
+// NewBackfiller creates a new backfiller
+func NewBackfiller(client *defillama.Client, pg *postgres.Repository) *Backfiller {
+	return &Backfiller{
+		client: client,
+		pgRepo: pg,
+	}
+}
+
+// Run backfills the history of poolID. Points already recorded are kept.
+// The pool must already be stored.
+func (b *Backfiller) Run(ctx context.Context, poolID string) (BackfillSummary, error) {
+	summary := BackfillSummary{PoolID: poolID}
+
+	exists, err := b.pgRepo.PoolExists(ctx, poolID)
+	if err != nil {
+		return summary, err
+	}
+	if !exists {
+		return summary, fmt.Errorf("pool %s: %w", poolID, os.ErrNotExist)
+	}
+
+	chart, err := b.client.FetchPoolChart(ctx, poolID)
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch pool history from DeFiLlama: %w", err)
+	}
+	summary.Points = len(chart)
+
+	points := make([]models.HistoricalAPY, len(chart))
+	for i, p := range chart {
+		points[i] = defillama.ToHistoricalAPY(poolID, p)
+	}
+
+	summary.Inserted, err = b.pgRepo.InsertHistoricalAPYPoints(ctx, poolID, points)
+	if err != nil {
+		return summary, err
+	}
+
+	log.Info().
+		Str("pool_id", poolID).
+		Int("points", summary.Points).
+		Int64("inserted", summary.Inserted).
+		Msg("Backfilled pool history")
+
+	return summary, nil
+}
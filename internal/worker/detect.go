@@ -0,0 +1,214 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+	"github.com/maxjove/defi-yield-aggregator/pkg/eventlog"
+)
+
+// scanSummaryTTL is how long the yield gap scan summary is kept for the API
+// server's metrics (seconds)
+const scanSummaryTTL = 3600
+
+// detectionLockTTL bounds how long a crashed run can block detection. A
+// running detection renews the lock every third of it, so a run that takes
+// longer keeps it.
+const detectionLockTTL = 2 * time.Minute
+
+// DetectSummary reports an opportunity detection run
+type DetectSummary struct {
+	YieldGaps int  `json:"yieldGaps"`
+	Trending  int  `json:"trending"`
+	HighScore int  `json:"highScore"`
+	Discarded int  `json:"discarded,omitempty"` // Detected but over the per-run caps, not saved
+	Skipped   bool `json:"skipped,omitempty"`   // Another run held the detection lock
+}
+
+// Detector runs opportunity detection
+type Detector struct {
+	service *opportunity.Service
+	pgRepo  *postgres.Repository
+	redis   *redis.Repository
+	events  *eventlog.Writer // Nil without an event log
+}
+
+// NewDetector creates a new detector. Published alerts are also appended to
+// events, if it isn't nil.
+func NewDetector(service *opportunity.Service, pg *postgres.Repository, redis *redis.Repository, events *eventlog.Writer) *Detector {
+	return &Detector{
+		service: service,
+		pgRepo:  pg,
+		redis:   redis,
+		events:  events,
+	}
+}
+
+// Run expires, retracts and scores past opportunities, then runs every
+// detector and saves the best of what they find, within the per-run caps;
+// new yield gaps are published as alerts. A failing detector doesn't stop
+// the others, and all failures are returned together. Runs don't overlap:
+// while another run, on this worker or another replica, holds the
+// detection lock the run is skipped.
+func (d *Detector) Run(ctx context.Context) (DetectSummary, error) {
+	var summary DetectSummary
+	var errs []error
+
+	// Detect anyway when Redis is unavailable; an overlapping run only
+	// repeats work
+	token, acquired, err := d.redis.AcquireDetectionLock(ctx, detectionLockTTL)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to take the detection lock, detecting anyway")
+	} else if !acquired {
+		log.Info().Msg("Opportunity detection already running, skipping")
+		summary.Skipped = true
+		return summary, nil
+	} else {
+		stop := d.holdDetectionLock(ctx, token)
+		defer func() {
+			stop()
+			if err := d.redis.ReleaseDetectionLock(context.Background(), token); err != nil {
+				log.Warn().Err(err).Msg("Failed to release the detection lock")
+			}
+		}()
+	}
+
+	// Deactivate expired opportunities first
+	if err := d.pgRepo.DeactivateExpiredOpportunities(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to deactivate expired opportunities")
+	}
+
+	// Record how opportunities that expired a while ago turned out
+	if _, err := d.service.ComputeOutcomes(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to compute opportunity outcomes")
+	}
+
+	// Retract opportunities on stale or deleted pools before new alerts go out
+	if _, err := d.service.RetractUnavailableOpportunities(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to retract opportunities on unavailable pools")
+	}
+
+	var detected []models.Opportunity
+
+	// Detect yield gap opportunities
+	yieldGaps, err := d.service.DetectYieldGaps(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to detect yield gaps: %w", err))
+	} else {
+		summary.YieldGaps = len(yieldGaps)
+		log.Info().Int("count", len(yieldGaps)).Msg("Detected yield gap opportunities")
+		detected = append(detected, yieldGaps...)
+
+		// Share the scan summary with the API server's metrics
+		scan := d.service.LastYieldGapScan()
+		if err := d.redis.SetYieldGapScan(ctx, &scan, scanSummaryTTL); err != nil {
+			log.Warn().Err(err).Msg("Failed to store yield gap scan summary")
+		}
+	}
+
+	// Detect trending pools
+	trending, err := d.service.DetectTrendingPools(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to detect trending pools: %w", err))
+	} else {
+		summary.Trending = len(trending)
+		log.Info().Int("count", len(trending)).Msg("Detected trending pools")
+		detected = append(detected, trending...)
+	}
+
+	// Detect high-score opportunities
+	highScore, err := d.service.DetectHighScorePools(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to detect high-score pools: %w", err))
+	} else {
+		summary.HighScore = len(highScore)
+		log.Info().Int("count", len(highScore)).Msg("Detected high-score opportunities")
+		detected = append(detected, highScore...)
+	}
+
+	// Rank every detector's findings together and keep the best
+	kept, discarded := d.service.CapDetections(detected)
+	summary.Discarded = len(detected) - len(kept)
+	if summary.Discarded > 0 {
+		event := log.Info().Int("kept", len(kept)).Int("discarded", summary.Discarded)
+		for oppType, n := range discarded {
+			event = event.Int("discarded_"+string(oppType), n)
+		}
+		event.Msg("Discarded lower-scoring opportunities over the per-run caps")
+
+		if err := d.redis.AddDiscardedOpportunities(ctx, discarded); err != nil {
+			log.Warn().Err(err).Msg("Failed to count discarded opportunities")
+		}
+	}
+
+	// Save, then publish alerts for new yield gaps
+	saved, err := d.service.SaveDetections(ctx, kept)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to save opportunities")
+	}
+	d.publish(ctx, saved)
+
+	return summary, errors.Join(errs...)
+}
+
+// holdDetectionLock renews the detection lock owned by token in the
+// background until the returned function is called. Renewal stops if the
+// lock was lost; the run carries on, as it does when Redis is unavailable.
+func (d *Detector) holdDetectionLock(ctx context.Context, token string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(detectionLockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := d.redis.ExtendDetectionLock(ctx, token, detectionLockTTL)
+				if errors.Is(err, redis.ErrLockLost) {
+					log.Warn().Msg("Detection lock expired during the run, another run may overlap")
+					return
+				}
+				if err != nil {
+					log.Warn().Err(err).Msg("Failed to extend the detection lock")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// publish sends alerts for newly saved yield gaps
+func (d *Detector) publish(ctx context.Context, saved []models.Opportunity) {
+	for _, opp := range saved {
+		if opp.Type != models.OpportunityTypeYieldGap {
+			continue
+		}
+		if err := d.redis.PublishOpportunityAlert(ctx, &opp); err != nil {
+			log.Debug().Err(err).Msg("Failed to publish opportunity alert")
+		}
+		if d.events != nil {
+			if err := d.events.Append(eventlog.TypeOpportunityAlert, &opp); err != nil {
+				log.Warn().Err(err).Str("opportunity_id", opp.ID).Msg("Failed to log opportunity alert")
+			}
+		}
+	}
+}
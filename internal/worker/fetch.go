@@ -0,0 +1,315 @@
+// Package worker holds the background worker's tasks. The scheduler runs
+// them periodically and the worker's subcommands run them once, so both go
+// through the same code.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/defillama"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/snapshot"
+)
+
+// poolSource fetches every pool, with the raw response if asked. A
+// response that broke off returns the pools before the break and an error
+// wrapping defillama.ErrPartialResponse.
+// Implemented by the DeFiLlama client.
+type poolSource interface {
+	FetchPools(ctx context.Context) ([]defillama.Pool, error)
+	FetchPoolsRaw(ctx context.Context) ([]defillama.Pool, []byte, error)
+}
+
+// poolIngester stores fetched pools.
+// Implemented by the ingestion service.
+type poolIngester interface {
+	Ingest(ctx context.Context, pools []models.Pool) ingestion.Result
+}
+
+// snapshotArchiver keeps raw responses and expires old ones.
+// Implemented by the snapshot service.
+type snapshotArchiver interface {
+	Archive(ctx context.Context, capturedAt time.Time, raw []byte) error
+	Prune(ctx context.Context, now time.Time) (int64, error)
+}
+
+// fetchCheckpoints remembers how far an unfinished fetch got.
+// Implemented by the Redis repository.
+type fetchCheckpoints interface {
+	GetFetchCheckpoint(ctx context.Context) (*models.FetchCheckpoint, error)
+	SetFetchCheckpoint(ctx context.Context, checkpoint *models.FetchCheckpoint, ttl time.Duration) error
+	ClearFetchCheckpoint(ctx context.Context) error
+}
+
+// defaultFetchChunkSize is used when WORKER_FETCH_CHUNK_SIZE is unset
+const defaultFetchChunkSize = 500
+
+// fetchCheckpointTTL is how long an interrupted fetch can be resumed. Pools
+// stored longer ago than this are due a refresh, so a later fetch starts
+// over.
+const fetchCheckpointTTL = time.Hour
+
+// FetchSummary reports a pools fetch
+type FetchSummary struct {
+	Fetched     int `json:"fetched"`     // Pools returned by DeFiLlama
+	Kept        int `json:"kept"`        // Left after WORKER_CHAINS / WORKER_EXCLUDE_CHAINS
+	AboveMinTVL int `json:"aboveMinTvl"` // Left after MIN_TVL_THRESHOLD and WORKER_MIN_APY, and ingested
+	BelowMinAPY int `json:"belowMinApy"` // Above the minimum TVL but under WORKER_MIN_APY; ingested only with WORKER_STORE_BELOW_MIN_APY
+	Stored      int `json:"stored"`
+	Failed      int `json:"failed"`
+	Outliers    int `json:"outliers"` // APYs clamped to POOL_APY_MIN / POOL_APY_MAX
+	Resumed     int `json:"resumed"`  // Skipped as stored by an interrupted fetch
+
+	// TotalTVL is the TVL of the pools above the minimum TVL, in USD
+	TotalTVL float64 `json:"totalTvl"`
+
+	// Partial is set when the response broke off and only the pools before
+	// the break were ingested
+	Partial bool `json:"partial"`
+}
+
+// Fetcher fetches pools from DeFiLlama and ingests them
+type Fetcher struct {
+	cfg         config.WorkerConfig
+	source      poolSource
+	ingester    poolIngester
+	snapshots   snapshotArchiver // Nil when archiving is disabled
+	checkpoints fetchCheckpoints // Nil to always ingest every pool
+}
+
+// NewFetcher creates a new fetcher. snapshots may be nil to skip archiving
+// raw responses, and checkpoints nil to not resume interrupted fetches.
+func NewFetcher(cfg config.WorkerConfig, source poolSource, ingester poolIngester, snapshots *snapshot.Service, checkpoints *redis.Repository) *Fetcher {
+	f := &Fetcher{
+		cfg:      cfg,
+		source:   source,
+		ingester: ingester,
+	}
+	if snapshots != nil {
+		f.snapshots = snapshots
+	}
+	if checkpoints != nil {
+		f.checkpoints = checkpoints
+	}
+	return f
+}
+
+// Run fetches the pools once, drops those on excluded chains or below the
+// minimum TVL and ingests the rest. It fails if the fetch fails or no pool
+// could be stored; individual pools that fail are only counted.
+//
+// Pools are ingested in ID order, WORKER_FETCH_CHUNK_SIZE at a time, and
+// progress is checkpointed after each chunk. When the previous fetch was
+// interrupted, pools up to its checkpoint are skipped, so a worker that
+// crashed during a long fetch doesn't redo it on its next start.
+func (f *Fetcher) Run(ctx context.Context) (FetchSummary, error) {
+	var summary FetchSummary
+	startTime := time.Now()
+
+	pools, raw, err := f.fetch(ctx)
+	if errors.Is(err, defillama.ErrPartialResponse) {
+		// Pools missing from the response keep their last stored values
+		// until the next fetch
+		log.Warn().Err(err).Int("count", len(pools)).Msg("Ingesting the pools of a partial DeFiLlama response")
+		summary.Partial = true
+	} else if err != nil {
+		return summary, fmt.Errorf("failed to fetch pools from DeFiLlama: %w", err)
+	}
+	summary.Fetched = len(pools)
+
+	log.Info().Int("count", len(pools)).Msg("Fetched pools from DeFiLlama")
+
+	// Archive the raw response and sweep expired snapshots. A partial
+	// response isn't valid JSON, so it isn't archived.
+	if f.snapshots != nil && !summary.Partial {
+		f.archiveSnapshot(ctx, startTime, raw)
+	}
+
+	// Drop pools on chains excluded by WORKER_CHAINS / WORKER_EXCLUDE_CHAINS
+	if chains := f.cfg.ChainFilter(); chains.Active() {
+		var skipped map[string]int
+		pools, skipped = defillama.FilterChains(pools, chains)
+
+		log.Info().
+			Int("total", summary.Fetched).
+			Int("kept", len(pools)).
+			Interface("skipped_by_chain", skipped).
+			Msg("Filtered pools by chain")
+	}
+	summary.Kept = len(pools)
+
+	// Filter pools by minimum TVL and APY and convert them to internal
+	// models
+	modelPools := make([]models.Pool, 0, len(pools))
+	aboveMinTVL := 0
+	for _, p := range pools {
+		if p.TVLUsd < f.cfg.MinTVLThreshold {
+			continue
+		}
+		aboveMinTVL++
+		if f.cfg.IngestMinAPY != nil && p.APY < *f.cfg.IngestMinAPY {
+			summary.BelowMinAPY++
+			if !f.cfg.StoreBelowMinAPY {
+				continue
+			}
+		}
+		modelPools = append(modelPools, defillama.ToPoolModel(p))
+		summary.TotalTVL += p.TVLUsd
+	}
+	summary.AboveMinTVL = len(modelPools)
+
+	log.Info().
+		Int("total", len(pools)).
+		Int("filtered", aboveMinTVL).
+		Float64("min_tvl", f.cfg.MinTVLThreshold).
+		Msg("Filtered pools by TVL")
+
+	if f.cfg.IngestMinAPY != nil {
+		log.Info().
+			Int("below_min_apy", summary.BelowMinAPY).
+			Float64("min_apy", *f.cfg.IngestMinAPY).
+			Bool("stored_anyway", f.cfg.StoreBelowMinAPY).
+			Msg("Filtered pools by APY")
+	}
+
+	if len(modelPools) == 0 {
+		return summary, nil
+	}
+
+	sort.Slice(modelPools, func(i, j int) bool {
+		return modelPools[i].ID < modelPools[j].ID
+	})
+
+	checkpoint := f.resumeCheckpoint(ctx)
+	start := 0
+	if checkpoint != nil {
+		start = sort.Search(len(modelPools), func(i int) bool {
+			return modelPools[i].ID > checkpoint.LastPoolID
+		})
+		summary.Resumed = start
+
+		log.Info().
+			Str("last_pool_id", checkpoint.LastPoolID).
+			Int("skipped", start).
+			Time("started_at", checkpoint.StartedAt).
+			Msg("Resuming interrupted pools fetch")
+	} else {
+		checkpoint = &models.FetchCheckpoint{StartedAt: startTime.UTC()}
+	}
+	checkpoint.Total = len(modelPools)
+
+	chunkSize := f.cfg.FetchChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultFetchChunkSize
+	}
+
+	for i := start; i < len(modelPools); i += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return summary, fmt.Errorf("fetch interrupted after %d of %d pools: %w", i, len(modelPools), err)
+		}
+
+		chunk := modelPools[i:min(i+chunkSize, len(modelPools))]
+		result := f.ingester.Ingest(ctx, chunk)
+		summary.Stored += len(result.Stored)
+		summary.Failed += len(result.Failed)
+		summary.Outliers += len(result.Outliers)
+
+		// A chunk none of whose pools could be stored is left for the
+		// resumed fetch to retry
+		done := i + len(chunk)
+		if len(result.Stored) > 0 {
+			f.saveCheckpoint(ctx, checkpoint, chunk[len(chunk)-1].ID, done)
+		}
+
+		log.Info().
+			Int("ingested", done).
+			Int("total", len(modelPools)).
+			Int("stored", summary.Stored).
+			Int("failed", summary.Failed).
+			Msg("Ingest progress")
+	}
+
+	if f.checkpoints != nil {
+		if err := f.checkpoints.ClearFetchCheckpoint(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to clear the fetch checkpoint")
+		}
+	}
+
+	log.Info().
+		Int("pools_processed", summary.Stored).
+		Int("pools_failed", summary.Failed).
+		Int("pools_outliers", summary.Outliers).
+		Int("pools_resumed", summary.Resumed).
+		Msg("Ingested pools from DeFiLlama")
+
+	if remaining := len(modelPools) - start; summary.Stored == 0 && remaining > 0 {
+		return summary, fmt.Errorf("none of the %d pools could be stored", remaining)
+	}
+	return summary, nil
+}
+
+// resumeCheckpoint returns the checkpoint of an interrupted fetch, or nil
+// to ingest every pool
+func (f *Fetcher) resumeCheckpoint(ctx context.Context) *models.FetchCheckpoint {
+	if f.checkpoints == nil {
+		return nil
+	}
+
+	checkpoint, err := f.checkpoints.GetFetchCheckpoint(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get the fetch checkpoint, ingesting every pool")
+		return nil
+	}
+	return checkpoint
+}
+
+// saveCheckpoint records that the pools up to lastPoolID were ingested.
+// Failures are logged; the fetch carries on without a checkpoint.
+func (f *Fetcher) saveCheckpoint(ctx context.Context, checkpoint *models.FetchCheckpoint, lastPoolID string, ingested int) {
+	if f.checkpoints == nil {
+		return
+	}
+
+	checkpoint.LastPoolID = lastPoolID
+	checkpoint.Ingested = ingested
+	checkpoint.UpdatedAt = time.Now().UTC()
+	if err := f.checkpoints.SetFetchCheckpoint(ctx, checkpoint, fetchCheckpointTTL); err != nil {
+		log.Warn().Err(err).Msg("Failed to save the fetch checkpoint")
+	}
+}
+
+// fetch fetches the pools, keeping the raw response only when it is
+// archived
+func (f *Fetcher) fetch(ctx context.Context) ([]defillama.Pool, []byte, error) {
+	if f.snapshots != nil {
+		return f.source.FetchPoolsRaw(ctx)
+	}
+	pools, err := f.source.FetchPools(ctx)
+	return pools, nil, err
+}
+
+// archiveSnapshot stores a raw DeFiLlama response and prunes old snapshots.
+// Failures are logged and never affect the fetch.
+func (f *Fetcher) archiveSnapshot(ctx context.Context, capturedAt time.Time, raw []byte) {
+	if err := f.snapshots.Archive(ctx, capturedAt, raw); err != nil {
+		log.Warn().Err(err).Msg("Failed to archive DeFiLlama snapshot")
+	} else {
+		log.Debug().Int("raw_bytes", len(raw)).Msg("Archived DeFiLlama snapshot")
+	}
+
+	deleted, err := f.snapshots.Prune(ctx, time.Now())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prune DeFiLlama snapshots")
+	} else if deleted > 0 {
+		log.Info().Int64("deleted", deleted).Msg("Pruned expired DeFiLlama snapshots")
+	}
+}
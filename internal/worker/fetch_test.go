@@ -0,0 +1,294 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/defillama"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/ingestion"
+)
+
+type fakeSource struct {
+	pools []defillama.Pool
+	err   error
+}
+
+func (f *fakeSource) FetchPools(context.Context) ([]defillama.Pool, error) {
+	return f.pools, f.err
+}
+
+func (f *fakeSource) FetchPoolsRaw(context.Context) ([]defillama.Pool, []byte, error) {
+	return f.pools, []byte(`{"status":"success"}`), f.err
+}
+
+type fakeIngester struct {
+	ingested []models.Pool
+	chunks   int
+	failing  map[string]bool
+	onIngest func() // Called after each chunk
+}
+
+func (f *fakeIngester) Ingest(_ context.Context, pools []models.Pool) ingestion.Result {
+	f.ingested = append(f.ingested, pools...)
+	f.chunks++
+	if f.onIngest != nil {
+		defer f.onIngest()
+	}
+
+	result := ingestion.Result{Failed: make(map[string]error)}
+	for _, p := range pools {
+		if f.failing[p.ID] {
+			result.Failed[p.ID] = errors.New("upsert failed")
+			continue
+		}
+		result.Stored = append(result.Stored, p)
+	}
+	return result
+}
+
+type fakeCheckpoints struct {
+	checkpoint *models.FetchCheckpoint
+	saved      []string // LastPoolID of each checkpoint saved
+}
+
+func (f *fakeCheckpoints) GetFetchCheckpoint(context.Context) (*models.FetchCheckpoint, error) {
+	return f.checkpoint, nil
+}
+
+func (f *fakeCheckpoints) SetFetchCheckpoint(_ context.Context, checkpoint *models.FetchCheckpoint, _ time.Duration) error {
+	saved := *checkpoint
+	f.checkpoint = &saved
+	f.saved = append(f.saved, checkpoint.LastPoolID)
+	return nil
+}
+
+func (f *fakeCheckpoints) ClearFetchCheckpoint(context.Context) error {
+	f.checkpoint = nil
+	return nil
+}
+
+func testPools() []defillama.Pool {
+	return []defillama.Pool{
+		{Pool: "eth-large", Chain: "Ethereum", Project: "aave-v3", Symbol: "USDC", TVLUsd: 5_000_000, APY: 4},
+		{Pool: "eth-small", Chain: "Ethereum", Project: "aave-v3", Symbol: "DAI", TVLUsd: 5_000, APY: 9},
+		{Pool: "arb-large", Chain: "Arbitrum", Project: "gmx", Symbol: "GLP", TVLUsd: 2_000_000, APY: 12},
+		{Pool: "sol-large", Chain: "Solana", Project: "kamino", Symbol: "SOL", TVLUsd: 3_000_000, APY: 7},
+	}
+}
+
+func TestFetcherRun(t *testing.T) {
+	source := &fakeSource{pools: testPools()}
+	ingester := &fakeIngester{}
+	cfg := config.WorkerConfig{MinTVLThreshold: 100_000, ExcludeChains: []string{"solana"}}
+
+	summary, err := NewFetcher(cfg, source, ingester, nil, nil).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := FetchSummary{Fetched: 4, Kept: 3, AboveMinTVL: 2, Stored: 2, TotalTVL: 7_000_000}
+	if summary != want {
+		t.Errorf("Expected %+v, got %+v", want, summary)
+	}
+
+	if len(ingester.ingested) != 2 {
+		t.Fatalf("Expected 2 pools ingested, got %d", len(ingester.ingested))
+	}
+	for _, p := range ingester.ingested {
+		if p.ID != "eth-large" && p.ID != "arb-large" {
+			t.Errorf("Unexpected pool ingested: %s", p.ID)
+		}
+	}
+}
+
+func TestFetcherRun_Failures(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   *fakeSource
+		failing  map[string]bool
+		wantErr  bool
+		want     FetchSummary
+		ingested int
+	}{
+		{
+			name:    "fetch fails",
+			source:  &fakeSource{err: errors.New("status 503")},
+			wantErr: true,
+		},
+		{
+			name:     "some pools fail",
+			source:   &fakeSource{pools: testPools()},
+			failing:  map[string]bool{"eth-large": true},
+			want:     FetchSummary{Fetched: 4, Kept: 4, AboveMinTVL: 3, Stored: 2, Failed: 1, TotalTVL: 10_000_000},
+			ingested: 3,
+		},
+		{
+			name:     "every pool fails",
+			source:   &fakeSource{pools: testPools()[:1]},
+			failing:  map[string]bool{"eth-large": true},
+			wantErr:  true,
+			want:     FetchSummary{Fetched: 1, Kept: 1, AboveMinTVL: 1, Failed: 1, TotalTVL: 5_000_000},
+			ingested: 1,
+		},
+		{
+			name:   "nothing above the minimum TVL",
+			source: &fakeSource{pools: testPools()[1:2]},
+			want:   FetchSummary{Fetched: 1, Kept: 1},
+		},
+		{
+			name:     "partial response",
+			source:   &fakeSource{pools: testPools()[:2], err: fmt.Errorf("%w after 2 pools: unexpected EOF", defillama.ErrPartialResponse)},
+			want:     FetchSummary{Fetched: 2, Kept: 2, AboveMinTVL: 1, Stored: 1, TotalTVL: 5_000_000, Partial: true},
+			ingested: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingester := &fakeIngester{failing: tt.failing}
+			cfg := config.WorkerConfig{MinTVLThreshold: 100_000}
+
+			summary, err := NewFetcher(cfg, tt.source, ingester, nil, nil).Run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if summary != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, summary)
+			}
+			if len(ingester.ingested) != tt.ingested {
+				t.Errorf("Expected %d pools ingested, got %d", tt.ingested, len(ingester.ingested))
+			}
+		})
+	}
+}
+
+func TestFetcherRun_MinAPY(t *testing.T) {
+	minAPY := 5.0
+	tests := []struct {
+		name     string
+		store    bool
+		want     FetchSummary
+		ingested []string
+	}{
+		{
+			name:     "dropped",
+			want:     FetchSummary{Fetched: 4, Kept: 4, AboveMinTVL: 2, BelowMinAPY: 1, Stored: 2, TotalTVL: 5_000_000},
+			ingested: []string{"arb-large", "sol-large"},
+		},
+		{
+			name:     "stored anyway",
+			store:    true,
+			want:     FetchSummary{Fetched: 4, Kept: 4, AboveMinTVL: 3, BelowMinAPY: 1, Stored: 3, TotalTVL: 10_000_000},
+			ingested: []string{"arb-large", "eth-large", "sol-large"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingester := &fakeIngester{}
+			cfg := config.WorkerConfig{MinTVLThreshold: 100_000, IngestMinAPY: &minAPY, StoreBelowMinAPY: tt.store}
+
+			summary, err := NewFetcher(cfg, &fakeSource{pools: testPools()}, ingester, nil, nil).Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if summary != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, summary)
+			}
+
+			var ids []string
+			for _, p := range ingester.ingested {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.ingested) {
+				t.Errorf("Expected %v ingested, got %v", tt.ingested, ids)
+			}
+		})
+	}
+}
+
+func TestFetcherRun_Chunks(t *testing.T) {
+	ingester := &fakeIngester{failing: map[string]bool{"eth-large": true}}
+	checkpoints := &fakeCheckpoints{}
+	cfg := config.WorkerConfig{MinTVLThreshold: 100_000, FetchChunkSize: 1}
+
+	fetcher := NewFetcher(cfg, &fakeSource{pools: testPools()}, ingester, nil, nil)
+	fetcher.checkpoints = checkpoints
+
+	summary, err := fetcher.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := FetchSummary{Fetched: 4, Kept: 4, AboveMinTVL: 3, Stored: 2, Failed: 1, TotalTVL: 10_000_000}
+	if summary != want {
+		t.Errorf("Expected %+v, got %+v", want, summary)
+	}
+	if ingester.chunks != 3 {
+		t.Errorf("Expected 3 chunks, got %d", ingester.chunks)
+	}
+
+	// Pools go in ID order, and the chunk whose only pool failed isn't
+	// checkpointed
+	if want := []string{"arb-large", "sol-large"}; !slices.Equal(checkpoints.saved, want) {
+		t.Errorf("Expected checkpoints %v, got %v", want, checkpoints.saved)
+	}
+	if checkpoints.checkpoint != nil {
+		t.Errorf("Expected the checkpoint cleared after the fetch, got %+v", checkpoints.checkpoint)
+	}
+}
+
+func TestFetcherRun_Resumes(t *testing.T) {
+	ingester := &fakeIngester{}
+	checkpoints := &fakeCheckpoints{checkpoint: &models.FetchCheckpoint{LastPoolID: "arb-large", Ingested: 1, Total: 3}}
+	cfg := config.WorkerConfig{MinTVLThreshold: 100_000, FetchChunkSize: 2}
+
+	fetcher := NewFetcher(cfg, &fakeSource{pools: testPools()}, ingester, nil, nil)
+	fetcher.checkpoints = checkpoints
+
+	summary, err := fetcher.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := FetchSummary{Fetched: 4, Kept: 4, AboveMinTVL: 3, Stored: 2, Resumed: 1, TotalTVL: 10_000_000}
+	if summary != want {
+		t.Errorf("Expected %+v, got %+v", want, summary)
+	}
+	for _, p := range ingester.ingested {
+		if p.ID == "arb-large" {
+			t.Error("Expected the pool before the checkpoint skipped")
+		}
+	}
+}
+
+func TestFetcherRun_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ingester := &fakeIngester{onIngest: cancel}
+	checkpoints := &fakeCheckpoints{}
+	cfg := config.WorkerConfig{MinTVLThreshold: 100_000, FetchChunkSize: 1}
+
+	fetcher := NewFetcher(cfg, &fakeSource{pools: testPools()}, ingester, nil, nil)
+	fetcher.checkpoints = checkpoints
+
+	summary, err := fetcher.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the fetch interrupted, got %v", err)
+	}
+	if summary.Stored != 1 || ingester.chunks != 1 {
+		t.Errorf("Expected the fetch to stop after the first chunk, got %+v", summary)
+	}
+
+	// The next fetch resumes after the chunk that was stored
+	if checkpoints.checkpoint == nil || checkpoints.checkpoint.LastPoolID != "arb-large" || checkpoints.checkpoint.Ingested != 1 {
+		t.Errorf("Expected a checkpoint after arb-large, got %+v", checkpoints.checkpoint)
+	}
+}
@@ -0,0 +1,234 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+)
+
+// monitorStore keeps the platform monitor's state between fetches, the
+// data status the API reports and delivers operator alerts.
+// Implemented by the Redis repository.
+type monitorStore interface {
+	GetMonitorState(ctx context.Context) (*models.MonitorState, error)
+	SetMonitorState(ctx context.Context, state *models.MonitorState) error
+	GetDataStatus(ctx context.Context) (*models.DataStatus, error)
+	SetDataStatus(ctx context.Context, status *models.DataStatus) error
+	PublishPlatformAlert(ctx context.Context, alert *models.PlatformAlert) error
+}
+
+// anomalyKinds are checked and reported in this order
+var anomalyKinds = []string{models.AnomalyTVLDrop, models.AnomalyPoolCountDrop, models.AnomalyIngestionGap}
+
+// MonitorSummary reports a platform monitor check
+type MonitorSummary struct {
+	Anomalies []string `json:"anomalies"` // Kinds seen in this fetch
+	Alerted   []string `json:"alerted"`   // Kinds confirmed and alerted by this check
+	Suspect   bool     `json:"suspect"`
+}
+
+// Monitor checks the totals of each pools fetch for platform-wide
+// anomalies, which usually mean an upstream glitch rather than a market
+// move: total TVL or the pool count falling sharply from the last healthy
+// fetch, or no fetch succeeding for too long.
+type Monitor struct {
+	cfg     config.MonitorConfig
+	store   monitorStore
+	webhook *http.Client // Nil without MONITOR_WEBHOOK_URL
+	now     func() time.Time
+}
+
+// NewMonitor creates a platform monitor keeping its state in Redis
+func NewMonitor(cfg config.MonitorConfig, store *redis.Repository) *Monitor {
+	m := &Monitor{cfg: cfg, store: store, now: time.Now}
+	if cfg.WebhookURL != "" {
+		m.webhook = &http.Client{Timeout: cfg.WebhookTimeout}
+	}
+	return m
+}
+
+// Check compares a fetch, given its summary and error, with the last
+// healthy fetch. The data is flagged suspect while any anomaly shows, and
+// an anomaly is alerted once it showed in MONITOR_CONFIRM_CYCLES fetches
+// in a row, so a single odd response doesn't page anyone.
+//
+// The baseline moves to each fetch without an anomaly. A confirmed drop
+// becomes the new baseline too: the operators were told, and a lasting
+// drop mustn't keep the data flagged forever.
+func (m *Monitor) Check(ctx context.Context, fetch FetchSummary, fetchErr error) (MonitorSummary, error) {
+	var summary MonitorSummary
+	now := m.now().UTC()
+
+	state, err := m.store.GetMonitorState(ctx)
+	if err != nil {
+		return summary, fmt.Errorf("failed to get monitor state: %w", err)
+	}
+	if state == nil {
+		// Gaps are measured from the first check until a fetch succeeds
+		state = &models.MonitorState{LastSuccess: now}
+	}
+	if state.Breaches == nil {
+		state.Breaches = make(map[string]int)
+	}
+
+	var current *models.PlatformTotals
+	if fetchErr == nil && fetch.AboveMinTVL > 0 {
+		current = &models.PlatformTotals{TotalTVL: fetch.TotalTVL, PoolCount: fetch.AboveMinTVL, At: now}
+		state.LastSuccess = now
+	}
+
+	found := m.detect(state, current, now)
+
+	var alerts []*models.PlatformAlert
+	pendingDrop := false
+	for _, kind := range anomalyKinds {
+		alert, ok := found[kind]
+		if !ok {
+			delete(state.Breaches, kind)
+			continue
+		}
+
+		summary.Anomalies = append(summary.Anomalies, kind)
+		state.Breaches[kind]++
+		alert.Cycles = state.Breaches[kind]
+		switch {
+		case alert.Cycles == m.cfg.ConfirmCycles:
+			alerts = append(alerts, alert)
+			summary.Alerted = append(summary.Alerted, kind)
+		case alert.Cycles < m.cfg.ConfirmCycles && kind != models.AnomalyIngestionGap:
+			pendingDrop = true
+		}
+	}
+	if current != nil && !pendingDrop {
+		state.Baseline = current
+	}
+	summary.Suspect = len(summary.Anomalies) > 0
+
+	if err := m.store.SetMonitorState(ctx, state); err != nil {
+		return summary, fmt.Errorf("failed to save monitor state: %w", err)
+	}
+	if err := m.setDataStatus(ctx, summary, now); err != nil {
+		return summary, fmt.Errorf("failed to save data status: %w", err)
+	}
+
+	for _, alert := range alerts {
+		m.emit(ctx, alert)
+	}
+	return summary, nil
+}
+
+// detect returns the anomalies a fetch shows, by kind. current is nil when
+// the fetch failed.
+func (m *Monitor) detect(state *models.MonitorState, current *models.PlatformTotals, now time.Time) map[string]*models.PlatformAlert {
+	found := make(map[string]*models.PlatformAlert)
+
+	if current != nil && state.Baseline != nil {
+		drops := []struct {
+			kind      string
+			what      string
+			previous  float64
+			current   float64
+			threshold float64
+		}{
+			{models.AnomalyTVLDrop, "Total TVL", state.Baseline.TotalTVL, current.TotalTVL, m.cfg.TVLDropPercent},
+			{models.AnomalyPoolCountDrop, "Pool count", float64(state.Baseline.PoolCount), float64(current.PoolCount), m.cfg.PoolDropPercent},
+		}
+		for _, d := range drops {
+			if d.previous <= 0 {
+				continue
+			}
+			change := (d.current - d.previous) / d.previous * 100
+			if -change > d.threshold {
+				found[d.kind] = &models.PlatformAlert{
+					Kind:       d.kind,
+					Message:    fmt.Sprintf("%s fell %.1f%% in one fetch, from %.0f to %.0f", d.what, -change, d.previous, d.current),
+					Previous:   d.previous,
+					Current:    d.current,
+					Change:     change,
+					DetectedAt: now,
+				}
+			}
+		}
+	}
+
+	if gap := now.Sub(state.LastSuccess); m.cfg.IngestionGap > 0 && gap > m.cfg.IngestionGap {
+		found[models.AnomalyIngestionGap] = &models.PlatformAlert{
+			Kind:       models.AnomalyIngestionGap,
+			Message:    fmt.Sprintf("No successful pools fetch for %s", gap.Round(time.Second)),
+			DetectedAt: now,
+		}
+	}
+
+	for _, alert := range found {
+		alert.LastSuccess = state.LastSuccess
+	}
+	return found
+}
+
+// setDataStatus stores whether the data is suspect, keeping the time it
+// turned suspect while it stays so
+func (m *Monitor) setDataStatus(ctx context.Context, summary MonitorSummary, now time.Time) error {
+	status := &models.DataStatus{Suspect: summary.Suspect, Reasons: summary.Anomalies, UpdatedAt: now}
+	if status.Suspect {
+		since := now
+		if previous, err := m.store.GetDataStatus(ctx); err == nil && previous != nil && previous.Since != nil {
+			since = *previous.Since
+		}
+		status.Since = &since
+	}
+	return m.store.SetDataStatus(ctx, status)
+}
+
+// emit publishes an alert to the platform alerts channel and posts it to
+// the webhook. Failures are logged; the next anomaly is alerted again.
+func (m *Monitor) emit(ctx context.Context, alert *models.PlatformAlert) {
+	log.Error().
+		Str("kind", alert.Kind).
+		Int("cycles", alert.Cycles).
+		Time("last_success", alert.LastSuccess).
+		Msg(alert.Message)
+
+	if err := m.store.PublishPlatformAlert(ctx, alert); err != nil {
+		log.Warn().Err(err).Str("kind", alert.Kind).Msg("Failed to publish platform alert")
+	}
+
+	if m.webhook != nil {
+		if err := m.postWebhook(ctx, alert); err != nil {
+			log.Warn().Err(err).Str("kind", alert.Kind).Msg("Failed to post platform alert to webhook")
+		}
+	}
+}
+
+// postWebhook posts an alert as JSON to MONITOR_WEBHOOK_URL
+func (m *Monitor) postWebhook(ctx context.Context, alert *models.PlatformAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.webhook.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
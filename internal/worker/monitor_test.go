@@ -0,0 +1,175 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+type fakeMonitorStore struct {
+	state  *models.MonitorState
+	status *models.DataStatus
+	alerts []models.PlatformAlert
+}
+
+func (f *fakeMonitorStore) GetMonitorState(context.Context) (*models.MonitorState, error) {
+	return f.state, nil
+}
+
+func (f *fakeMonitorStore) SetMonitorState(_ context.Context, state *models.MonitorState) error {
+	f.state = state
+	return nil
+}
+
+func (f *fakeMonitorStore) GetDataStatus(context.Context) (*models.DataStatus, error) {
+	return f.status, nil
+}
+
+func (f *fakeMonitorStore) SetDataStatus(_ context.Context, status *models.DataStatus) error {
+	f.status = status
+	return nil
+}
+
+func (f *fakeMonitorStore) PublishPlatformAlert(_ context.Context, alert *models.PlatformAlert) error {
+	f.alerts = append(f.alerts, *alert)
+	return nil
+}
+
+// newTestMonitor returns a monitor on a fake store whose clock moves three
+// minutes, a fetch interval, per check
+func newTestMonitor(cfg config.MonitorConfig) (*Monitor, *fakeMonitorStore) {
+	store := &fakeMonitorStore{}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &Monitor{cfg: cfg, store: store, now: func() time.Time {
+		clock = clock.Add(3 * time.Minute)
+		return clock
+	}}
+	return m, store
+}
+
+func testMonitorConfig() config.MonitorConfig {
+	return config.MonitorConfig{Enabled: true, TVLDropPercent: 10, PoolDropPercent: 20, IngestionGap: 15 * time.Minute, ConfirmCycles: 2}
+}
+
+func TestMonitorCheck_TVLDrop(t *testing.T) {
+	var posted []models.PlatformAlert
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert models.PlatformAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		posted = append(posted, alert)
+	}))
+	defer webhook.Close()
+
+	cfg := testMonitorConfig()
+	cfg.WebhookURL = webhook.URL
+	m, store := newTestMonitor(cfg)
+	m.webhook = webhook.Client()
+	ctx := context.Background()
+
+	healthy := FetchSummary{AboveMinTVL: 1000, TotalTVL: 100_000_000}
+	halved := FetchSummary{AboveMinTVL: 1000, TotalTVL: 50_000_000}
+
+	if summary, err := m.Check(ctx, healthy, nil); err != nil || summary.Suspect {
+		t.Fatalf("Expected the first fetch healthy, got %+v (%v)", summary, err)
+	}
+
+	// The drop flags the data at once but waits a cycle to alert
+	summary, err := m.Check(ctx, halved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Suspect || !store.status.Suspect || !slices.Equal(store.status.Reasons, []string{models.AnomalyTVLDrop}) {
+		t.Errorf("Expected the data suspect for a TVL drop, got %+v", store.status)
+	}
+	if len(store.alerts) != 0 {
+		t.Errorf("Expected no alert before confirmation, got %+v", store.alerts)
+	}
+	since := store.status.Since
+
+	summary, err = m.Check(ctx, halved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(summary.Alerted, []string{models.AnomalyTVLDrop}) || len(store.alerts) != 1 {
+		t.Fatalf("Expected a TVL drop alert on the second cycle, got %+v", store.alerts)
+	}
+	if alert := store.alerts[0]; alert.Previous != 100_000_000 || alert.Current != 50_000_000 || alert.Change != -50 || alert.Cycles != 2 {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+	if len(posted) != 1 || posted[0].Kind != models.AnomalyTVLDrop {
+		t.Errorf("Expected the alert posted to the webhook, got %+v", posted)
+	}
+	if !store.status.Suspect || store.status.Since == nil || !store.status.Since.Equal(*since) {
+		t.Errorf("Expected the data still suspect since the drop, got %+v", store.status)
+	}
+
+	// The alerted level is the new baseline
+	summary, err = m.Check(ctx, halved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Suspect || store.status.Suspect || store.status.Since != nil || len(store.alerts) != 1 {
+		t.Errorf("Expected the data healthy again without another alert, got %+v", store.status)
+	}
+}
+
+func TestMonitorCheck_OneOffDrop(t *testing.T) {
+	m, store := newTestMonitor(testMonitorConfig())
+	ctx := context.Background()
+
+	healthy := FetchSummary{AboveMinTVL: 1000, TotalTVL: 100_000_000}
+	truncated := FetchSummary{AboveMinTVL: 400, TotalTVL: 95_000_000, Partial: true}
+
+	for i, fetch := range []FetchSummary{healthy, truncated, healthy, healthy} {
+		if _, err := m.Check(ctx, fetch, nil); err != nil {
+			t.Fatal(err)
+		}
+		if wantSuspect := i == 1; store.status.Suspect != wantSuspect {
+			t.Errorf("Fetch %d: expected suspect %v, got %+v", i, wantSuspect, store.status)
+		}
+	}
+	if len(store.alerts) != 0 {
+		t.Errorf("Expected a one-off drop not to alert, got %+v", store.alerts)
+	}
+	if store.state.Baseline.PoolCount != 1000 {
+		t.Errorf("Expected the baseline kept at the healthy fetch, got %+v", store.state.Baseline)
+	}
+}
+
+func TestMonitorCheck_IngestionGap(t *testing.T) {
+	m, store := newTestMonitor(testMonitorConfig())
+	ctx := context.Background()
+
+	if _, err := m.Check(ctx, FetchSummary{AboveMinTVL: 1000, TotalTVL: 100_000_000}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed fetches every 3 minutes: the gap exceeds 15 minutes on the
+	// sixth and is confirmed on the seventh
+	for i := 1; i <= 7; i++ {
+		summary, err := m.Check(ctx, FetchSummary{}, errors.New("status 503"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantSuspect := i >= 6; summary.Suspect != wantSuspect {
+			t.Errorf("Failure %d: expected suspect %v, got %+v", i, wantSuspect, summary)
+		}
+	}
+	if len(store.alerts) != 1 || store.alerts[0].Kind != models.AnomalyIngestionGap {
+		t.Fatalf("Expected one ingestion gap alert, got %+v", store.alerts)
+	}
+
+	if summary, err := m.Check(ctx, FetchSummary{AboveMinTVL: 1000, TotalTVL: 100_000_000}, nil); err != nil || summary.Suspect {
+		t.Errorf("Expected a successful fetch to clear the gap, got %+v (%v)", summary, err)
+	}
+}
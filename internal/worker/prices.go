@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/coingecko"
+)
+
+// priceCacheTTL is how long fetched token prices stay cached (seconds)
+const priceCacheTTL = 900
+
+// rewardTokenWindow is how long a reward token keeps being priced after the
+// API was last asked about it
+const rewardTokenWindow = 7 * 24 * time.Hour
+
+// PriceSummary reports a token price fetch
+type PriceSummary struct {
+	Tokens int `json:"tokens"` // Prices fetched
+}
+
+// PriceFetcher fetches token prices from CoinGecko and caches them
+type PriceFetcher struct {
+	client *coingecko.Client
+	tokens []string
+	cache  *redis.Repository
+}
+
+// NewPriceFetcher creates a new price fetcher for the given tokens
+func NewPriceFetcher(client *coingecko.Client, tokens []string, cache *redis.Repository) *PriceFetcher {
+	return &PriceFetcher{
+		client: client,
+		tokens: tokens,
+		cache:  cache,
+	}
+}
+
+// Run fetches the prices once and caches them in Redis. Reward tokens
+// recently shown in pool details are priced along with the given tokens.
+func (p *PriceFetcher) Run(ctx context.Context) (PriceSummary, error) {
+	tokens := p.tokens
+	rewardTokens, err := p.cache.GetRewardTokens(ctx, time.Now().Add(-rewardTokenWindow))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get reward tokens to price")
+	}
+	tokens = mergeTokens(tokens, rewardTokens)
+
+	prices, err := p.client.FetchPrices(ctx, tokens)
+	if err != nil {
+		return PriceSummary{}, fmt.Errorf("failed to fetch prices from CoinGecko: %w", err)
+	}
+
+	if err := p.cache.SetMultipleTokenPrices(ctx, prices, priceCacheTTL); err != nil {
+		log.Warn().Err(err).Msg("Failed to cache token prices")
+	}
+
+	return PriceSummary{Tokens: len(prices)}, nil
+}
+
+// mergeTokens appends the extra token IDs not already in tokens
+func mergeTokens(tokens, extra []string) []string {
+	if len(extra) == 0 {
+		return tokens
+	}
+
+	seen := make(map[string]bool, len(tokens))
+	for _, id := range tokens {
+		seen[id] = true
+	}
+	merged := append([]string(nil), tokens...)
+	for _, id := range extra {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+)
+
+// PruneSummary reports a history prune
+type PruneSummary struct {
+	Cutoff  time.Time `json:"cutoff"`
+	Deleted int64     `json:"deleted"`
+}
+
+// Pruner removes old historical data points
+type Pruner struct {
+	pgRepo *postgres.Repository
+}
+
+// NewPruner creates a new pruner
+func NewPruner(pg *postgres.Repository) *Pruner {
+	return &Pruner{pgRepo: pg}
+}
+
+// Run deletes the history of every pool recorded more than olderThan ago
+func (p *Pruner) Run(ctx context.Context, olderThan time.Duration) (PruneSummary, error) {
+	summary := PruneSummary{Cutoff: time.Now().Add(-olderThan).UTC()}
+
+	deleted, err := p.pgRepo.DeleteHistoricalAPYBefore(ctx, summary.Cutoff)
+	if err != nil {
+		return summary, err
+	}
+	summary.Deleted = deleted
+
+	log.Info().
+		Time("cutoff", summary.Cutoff).
+		Int64("deleted", deleted).
+		Msg("Pruned pool history")
+
+	return summary, nil
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+)
+
+// Reloader applies the runtime-tunable parts of the configuration: scoring
+// weights, chain overrides and, in the worker, detection thresholds. Both
+// binaries apply chain overrides at startup and everything on SIGHUP. Other
+// settings still require a restart.
+type Reloader struct {
+	analytics   *analytics.Service
+	opportunity *opportunity.Service          // Nil on the API server
+	overrides   analytics.ChainOverrideSource // Read with CHAIN_OVERRIDES_FROM_DB
+}
+
+// NewReloader creates a reloader for the given services. opportunityService
+// may be nil where no detection runs.
+func NewReloader(analyticsService *analytics.Service, opportunityService *opportunity.Service, overrides analytics.ChainOverrideSource) *Reloader {
+	return &Reloader{
+		analytics:   analyticsService,
+		opportunity: opportunityService,
+		overrides:   overrides,
+	}
+}
+
+// Watch re-reads the configuration whenever SIGHUP is received and applies
+// it, until ctx is done
+func (r *Reloader) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info().Msg("Received SIGHUP, reloading configuration")
+
+			cfg, err := config.Reload()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to reload configuration")
+				continue
+			}
+			r.Apply(ctx, cfg)
+		}
+	}
+}
+
+// Apply swaps in the runtime-tunable parts of cfg. Each part is validated
+// on its own; a rejected part keeps its current values.
+func (r *Reloader) Apply(ctx context.Context, cfg *config.Config) {
+	r.reloadScoringWeights(cfg.Scoring)
+	if r.opportunity != nil {
+		r.reloadDetectionThresholds(cfg.Worker)
+	}
+	r.LoadChainOverrides(ctx, cfg)
+}
+
+// LoadChainOverrides loads chain overrides from the configured file and/or
+// database and applies them to the analytics service. On failure the
+// previously applied values are kept.
+func (r *Reloader) LoadChainOverrides(ctx context.Context, cfg *config.Config) {
+	if cfg.Scoring.ChainOverridesFile == "" && !cfg.Scoring.ChainOverridesFromDB {
+		return
+	}
+
+	var source analytics.ChainOverrideSource
+	if cfg.Scoring.ChainOverridesFromDB {
+		source = r.overrides
+	}
+
+	overrides, err := analytics.LoadChainOverrides(ctx, cfg.Scoring.ChainOverridesFile, source)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load chain overrides, keeping current values")
+		return
+	}
+
+	r.analytics.ApplyChainOverrides(overrides)
+	log.Info().
+		Int("security_ratings", len(overrides.SecurityRatings)).
+		Int("gas_costs", len(overrides.GasCosts)).
+		Msg("Applied chain overrides")
+}
+
+// reloadScoringWeights swaps in new scoring weights if they are valid
+func (r *Reloader) reloadScoringWeights(weights config.ScoringConfig) {
+	old := r.analytics.Weights()
+	if err := r.analytics.SetWeights(weights); err != nil {
+		log.Error().Err(err).Msg("Rejected reloaded scoring weights, keeping current values")
+		return
+	}
+
+	log.Info().
+		Dict("old", scoringWeightsDict(old)).
+		Dict("new", scoringWeightsDict(weights)).
+		Msg("Reloaded scoring weights")
+}
+
+// reloadDetectionThresholds swaps in new detection thresholds if they are valid
+func (r *Reloader) reloadDetectionThresholds(cfg config.WorkerConfig) {
+	old := r.opportunity.Thresholds()
+	if err := r.opportunity.SetThresholds(cfg); err != nil {
+		log.Error().Err(err).Msg("Rejected reloaded detection thresholds, keeping current values")
+		return
+	}
+
+	log.Info().
+		Dict("old", thresholdsDict(old)).
+		Dict("new", thresholdsDict(cfg)).
+		Msg("Reloaded detection thresholds")
+}
+
+// scoringWeightsDict formats scoring weights for logging
+func scoringWeightsDict(w config.ScoringConfig) *zerolog.Event {
+	return zerolog.Dict().
+		Float64("apy", w.APYWeight).
+		Float64("tvl", w.TVLWeight).
+		Float64("stability", w.StabilityWeight).
+		Float64("trend", w.TrendWeight).
+		Float64("volume", w.VolumeWeight)
+}
+
+// thresholdsDict formats detection thresholds for logging
+func thresholdsDict(cfg config.WorkerConfig) *zerolog.Event {
+	return zerolog.Dict().
+		Float64("min_tvl", cfg.MinTVLThreshold).
+		Float64("min_apy", cfg.MinAPYThreshold).
+		Float64("yield_gap_min_profit", cfg.YieldGapMinProfit).
+		Float64("apy_jump", cfg.APYJumpThreshold).
+		Float64("min_volume_tvl_ratio", cfg.MinVolumeTVLRatio).
+		Float64("high_score_max_reward_ratio", cfg.HighScoreMaxRewardRatio).
+		Float64("high_score_min_score", cfg.HighScoreMinScore).
+		Float64("sustainable_min_base_ratio", cfg.SustainableMinBaseRatio).
+		Float64("sustainable_min_base_apy", cfg.SustainableMinBaseAPY)
+}
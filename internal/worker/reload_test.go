@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/opportunity"
+)
+
+type fakeChainOverrideSource struct {
+	rows []models.ChainOverride
+	err  error
+}
+
+func (f fakeChainOverrideSource) GetChainOverrides(context.Context) ([]models.ChainOverride, error) {
+	return f.rows, f.err
+}
+
+var validWeights = config.ScoringConfig{APYWeight: 0.35, TVLWeight: 0.25, StabilityWeight: 0.25, TrendWeight: 0.15}
+
+func TestReloaderApply(t *testing.T) {
+	analyticsService := analytics.NewService(validWeights)
+	opportunityService := opportunity.NewService(config.WorkerConfig{MinTVLThreshold: 100000}, nil, nil, analyticsService)
+	rating := 90.0
+	reloader := NewReloader(analyticsService, opportunityService, fakeChainOverrideSource{
+		rows: []models.ChainOverride{{Chain: "newchain", SecurityRating: &rating}},
+	})
+
+	weights := config.ScoringConfig{APYWeight: 0.4, TVLWeight: 0.2, StabilityWeight: 0.25, TrendWeight: 0.15, ChainOverridesFromDB: true}
+	reloader.Apply(context.Background(), &config.Config{
+		Scoring: weights,
+		Worker:  config.WorkerConfig{MinTVLThreshold: 250000},
+	})
+
+	if w := analyticsService.Weights(); w.APYWeight != 0.4 {
+		t.Errorf("Expected the reloaded APY weight 0.4, got %v", w.APYWeight)
+	}
+	if cfg := opportunityService.Thresholds(); cfg.MinTVLThreshold != 250000 {
+		t.Errorf("Expected the reloaded TVL threshold, got %v", cfg.MinTVLThreshold)
+	}
+	if analyticsService.ChainNeedsReview("newchain") {
+		t.Error("Expected the chain rating from the database to be applied")
+	}
+
+	// Invalid weights and thresholds are each rejected, keeping their
+	// current values
+	reloader.Apply(context.Background(), &config.Config{
+		Scoring: config.ScoringConfig{APYWeight: 2},
+		Worker:  config.WorkerConfig{MinTVLThreshold: -1},
+	})
+
+	if w := analyticsService.Weights(); w.APYWeight != 0.4 {
+		t.Errorf("Expected invalid weights to be rejected, got APY weight %v", w.APYWeight)
+	}
+	if cfg := opportunityService.Thresholds(); cfg.MinTVLThreshold != 250000 {
+		t.Errorf("Expected invalid thresholds to be rejected, got %v", cfg.MinTVLThreshold)
+	}
+}
+
+func TestReloaderApply_WithoutDetection(t *testing.T) {
+	analyticsService := analytics.NewService(validWeights)
+	reloader := NewReloader(analyticsService, nil, nil)
+
+	weights := validWeights
+	weights.APYWeight, weights.TVLWeight = 0.3, 0.3
+	reloader.Apply(context.Background(), &config.Config{Scoring: weights})
+
+	if w := analyticsService.Weights(); w.APYWeight != 0.3 {
+		t.Errorf("Expected the reloaded APY weight 0.3, got %v", w.APYWeight)
+	}
+}
+
+func TestReloaderLoadChainOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(path, []byte(`{"securityRatings": {"filechain": 80}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write overrides: %v", err)
+	}
+
+	analyticsService := analytics.NewService(validWeights)
+	reloader := NewReloader(analyticsService, nil, fakeChainOverrideSource{err: errors.New("db down")})
+
+	reloader.LoadChainOverrides(context.Background(), &config.Config{Scoring: config.ScoringConfig{ChainOverridesFile: path}})
+	if analyticsService.ChainNeedsReview("filechain") {
+		t.Fatal("Expected the chain rating from the file to be applied")
+	}
+
+	// A failing source keeps the overrides applied before
+	reloader.LoadChainOverrides(context.Background(), &config.Config{Scoring: config.ScoringConfig{ChainOverridesFromDB: true}})
+	if analyticsService.ChainNeedsReview("filechain") {
+		t.Error("Expected the current overrides to be kept when loading fails")
+	}
+}
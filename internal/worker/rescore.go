@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/elasticsearch"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/postgres"
+	"github.com/maxjove/defi-yield-aggregator/internal/repository/redis"
+	"github.com/maxjove/defi-yield-aggregator/internal/services/analytics"
+)
+
+// rescoreBatchSize is how many pools are scored per database round trip
+const rescoreBatchSize = 1000
+
+// RescoreSummary reports a rescoring run
+type RescoreSummary struct {
+	Scanned  int `json:"scanned"`
+	Rescored int `json:"rescored"` // Pools whose score changed
+}
+
+// Rescorer recomputes stored pool scores with the current scoring weights
+// and chain overrides, without waiting for the next fetch
+type Rescorer struct {
+	cfg       config.WorkerConfig
+	pgRepo    *postgres.Repository
+	esRepo    *elasticsearch.Repository
+	redisRepo *redis.Repository
+	analytics *analytics.Service
+}
+
+// NewRescorer creates a new rescorer
+func NewRescorer(cfg config.WorkerConfig, pg *postgres.Repository, es *elasticsearch.Repository, redis *redis.Repository, analytics *analytics.Service) *Rescorer {
+	return &Rescorer{
+		cfg:       cfg,
+		pgRepo:    pg,
+		esRepo:    es,
+		redisRepo: redis,
+		analytics: analytics,
+	}
+}
+
+// Run scores every pool again and stores the scores that changed. Stale
+// pools are left alone: updating them would bump their updated_at and make
+// them look fresh.
+func (r *Rescorer) Run(ctx context.Context) (RescoreSummary, error) {
+	var summary RescoreSummary
+
+	var staleBefore time.Time
+	if r.cfg.PoolStaleAfter > 0 {
+		staleBefore = time.Now().Add(-r.cfg.PoolStaleAfter)
+	}
+
+	afterID := ""
+	for {
+		pools, err := r.pgRepo.ListPoolsAfter(ctx, afterID, decimal.Zero, decimal.Zero, rescoreBatchSize)
+		if err != nil {
+			return summary, err
+		}
+		if len(pools) == 0 {
+			break
+		}
+		afterID = pools[len(pools)-1].ID
+		summary.Scanned += len(pools)
+
+		scores := make(map[string]decimal.Decimal)
+		changed := make([]models.Pool, 0)
+		for _, pool := range pools {
+			if pool.IsStale(staleBefore) {
+				continue
+			}
+
+			pool.DataCompleteness = models.CalculateDataCompleteness(&pool)
+			score := r.analytics.CalculateScore(&pool).Round(2)
+			if score.Equal(pool.Score) {
+				continue
+			}
+			pool.Score = score
+			scores[pool.ID] = score
+			changed = append(changed, pool)
+		}
+
+		if err := r.pgRepo.UpdatePoolScores(ctx, scores); err != nil {
+			return summary, err
+		}
+		summary.Rescored += len(changed)
+
+		if len(changed) > 0 {
+			if err := r.esRepo.BulkIndexPools(ctx, changed); err != nil {
+				log.Warn().Err(err).Int("count", len(changed)).Msg("Failed to index rescored pools")
+			}
+		}
+	}
+
+	if summary.Rescored > 0 {
+		if err := r.redisRepo.InvalidateAllPoolsCache(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to invalidate pools cache")
+		}
+		if err := r.redisRepo.InvalidateStatsCache(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to invalidate stats cache")
+		}
+	}
+
+	log.Info().
+		Int("scanned", summary.Scanned).
+		Int("rescored", summary.Rescored).
+		Msg("Rescored pools")
+
+	return summary, nil
+}
@@ -0,0 +1,10 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 002_opportunity_costs
+-- =============================================================================
+-- Adds a structured cost breakdown (withdraw gas, bridge fee, deposit gas,
+-- slippage) to yield-gap opportunities so the break-even math is auditable.
+
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS costs JSONB;
+
+COMMENT ON COLUMN opportunities.costs IS 'Estimated USD cost breakdown for yield-gap opportunities';
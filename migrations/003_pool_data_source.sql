@@ -0,0 +1,13 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 003_pool_data_source
+-- =============================================================================
+-- Records where each pool's data came from. Pools fetched by the worker are
+-- 'defillama'; pools uploaded through the admin import endpoint are 'manual'
+-- and are not refreshed by the DeFiLlama fetch job.
+
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS data_source VARCHAR(20) NOT NULL DEFAULT 'defillama';
+
+CREATE INDEX IF NOT EXISTS idx_pools_data_source ON pools(data_source);
+
+COMMENT ON COLUMN pools.data_source IS 'Origin of the pool data: defillama or manual';
@@ -0,0 +1,16 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 004_chain_overrides
+-- =============================================================================
+-- Per-chain overrides for the security ratings and gas cost estimates used in
+-- scoring. Loaded when CHAIN_OVERRIDES_FROM_DB=true, at startup and on SIGHUP.
+-- A NULL column keeps the built-in default for that chain.
+
+CREATE TABLE IF NOT EXISTS chain_overrides (
+    chain VARCHAR(50) PRIMARY KEY,
+    security_rating DECIMAL(5, 2) CHECK (security_rating BETWEEN 0 AND 100),
+    gas_cost_usd DECIMAL(12, 4) CHECK (gas_cost_usd >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE chain_overrides IS 'Per-chain security rating and gas cost overrides for scoring';
@@ -0,0 +1,15 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 005_pool_snapshots
+-- =============================================================================
+-- Gzip-compressed raw DeFiLlama /pools responses, used when the snapshot
+-- archiver runs with SNAPSHOT_BACKEND=postgres. Rows older than
+-- SNAPSHOT_RETENTION_DAYS are deleted by the worker.
+
+CREATE TABLE IF NOT EXISTS pool_snapshots (
+    captured_at TIMESTAMPTZ PRIMARY KEY,
+    size_bytes BIGINT NOT NULL,
+    data BYTEA NOT NULL
+);
+
+COMMENT ON TABLE pool_snapshots IS 'Compressed raw DeFiLlama pools responses for reproducibility';
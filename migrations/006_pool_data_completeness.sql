@@ -0,0 +1,12 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 006_pool_data_completeness
+-- =============================================================================
+-- Fraction of the fields used in scoring that a pool actually reports. Pools
+-- missing the 30-day mean APY, impermanent loss or volume data have their
+-- score down-weighted. Computed by the ingestion pipeline; existing rows are
+-- filled in on the next fetch.
+
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS data_completeness DECIMAL(5, 4) NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN pools.data_completeness IS 'Fraction (0-1) of expected data fields present';
@@ -0,0 +1,24 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 007_chain_metadata
+-- =============================================================================
+-- Registry of chains seen in the feed without a built-in security rating. A
+-- row is created with conservative defaults and needs_review set the first
+-- time ingestion sees the chain; operators assign real values and clear the
+-- flag. With CHAIN_OVERRIDES_FROM_DB=true the values are used in scoring, with
+-- chain_overrides taking precedence.
+
+CREATE TABLE IF NOT EXISTS chain_metadata (
+    chain VARCHAR(50) PRIMARY KEY,
+    security_rating DECIMAL(5, 2) NOT NULL CHECK (security_rating BETWEEN 0 AND 100),
+    gas_cost_usd DECIMAL(12, 4) NOT NULL CHECK (gas_cost_usd >= 0),
+    needs_review BOOLEAN NOT NULL DEFAULT TRUE,
+    pool_count INTEGER NOT NULL DEFAULT 0,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chain_metadata_needs_review ON chain_metadata(chain) WHERE needs_review;
+
+COMMENT ON TABLE chain_metadata IS 'Chains first seen in the feed, with review status';
+COMMENT ON COLUMN chain_metadata.pool_count IS 'Pools on the chain in the most recent ingestion run';
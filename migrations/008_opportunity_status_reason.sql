@@ -0,0 +1,18 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 008_opportunity_status_reason
+-- =============================================================================
+-- Records why an opportunity was deactivated before it expired, e.g. because
+-- a pool it references went stale or was deleted. NULL for opportunities that
+-- are active or simply expired.
+
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS status_reason VARCHAR(50);
+
+-- Active opportunities are looked up by the pools they reference when those
+-- pools go away
+CREATE INDEX IF NOT EXISTS idx_opportunities_active_pool_id
+    ON opportunities(pool_id) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_opportunities_active_source_pool_id
+    ON opportunities(source_pool_id) WHERE is_active = true;
+CREATE INDEX IF NOT EXISTS idx_opportunities_active_target_pool_id
+    ON opportunities(target_pool_id) WHERE is_active = true;
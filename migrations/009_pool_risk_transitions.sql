@@ -0,0 +1,23 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 009_pool_risk_transitions
+-- =============================================================================
+-- Audit log of pool risk level changes. The worker stores each pool's latest
+-- computed risk level on the pool and appends a row here only when the level
+-- differs from the stored one, together with the factors that produced it.
+
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS risk_level VARCHAR(10);
+
+CREATE TABLE IF NOT EXISTS pool_risk_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    pool_id VARCHAR(255) NOT NULL,
+    from_level VARCHAR(10) NOT NULL,
+    to_level VARCHAR(10) NOT NULL,
+    factors JSONB NOT NULL,                    -- APY, TVL, score and chain rating at the time of the change
+    transitioned_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_risk_transitions_pool
+    ON pool_risk_transitions(pool_id, transitioned_at DESC);
+
+COMMENT ON TABLE pool_risk_transitions IS 'Pool risk level changes with the factors behind them';
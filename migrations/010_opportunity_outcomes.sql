@@ -0,0 +1,21 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 010_opportunity_outcomes
+-- =============================================================================
+-- Realized outcomes of expired yield-gap and trending opportunities, used to
+-- measure detector quality. The worker fills these in once an opportunity's
+-- evaluation window has passed; until then outcome_class is NULL, and the
+-- expired opportunities without one are the worker's queue.
+
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS realized_apy_diff DECIMAL(12, 6);
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS outcome_class VARCHAR(20);  -- confirmed, faded, reversed, unknown
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS outcome_computed_at TIMESTAMPTZ;
+
+-- Expired opportunities still waiting for an outcome
+CREATE INDEX IF NOT EXISTS idx_opportunities_pending_outcome
+    ON opportunities(expires_at)
+    WHERE is_active = false AND outcome_class IS NULL AND type IN ('yield-gap', 'trending');
+
+-- Accuracy report over recent outcomes
+CREATE INDEX IF NOT EXISTS idx_opportunities_outcome
+    ON opportunities(type, expires_at DESC) WHERE outcome_class IS NOT NULL;
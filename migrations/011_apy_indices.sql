@@ -0,0 +1,33 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 011_apy_indices
+-- =============================================================================
+-- Benchmark APY indices. A definition selects pools by chain, protocol,
+-- stablecoin flag and asset; a NULL column doesn't filter. Once a day the
+-- worker computes the TVL-weighted average APY of each index's pools and
+-- appends it to apy_index_values. Days without weighted constituents have no
+-- row.
+
+CREATE TABLE IF NOT EXISTS apy_indices (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT,
+    chain VARCHAR(50),
+    protocol VARCHAR(100),
+    stablecoin BOOLEAN,
+    asset VARCHAR(50),                         -- Whole token of the pool symbol, e.g. USDC
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS apy_index_values (
+    index_name VARCHAR(64) NOT NULL REFERENCES apy_indices(name) ON DELETE CASCADE,
+    day DATE NOT NULL,                         -- UTC day the value was computed for
+    apy DECIMAL(12, 6) NOT NULL,               -- TVL-weighted average APY
+    tvl DECIMAL(24, 2) NOT NULL,               -- Combined TVL of the constituents
+    constituents INTEGER NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (index_name, day)
+);
+
+COMMENT ON TABLE apy_indices IS 'Benchmark APY index definitions';
+COMMENT ON TABLE apy_index_values IS 'Daily TVL-weighted APY of each index';
@@ -0,0 +1,19 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 012_pool_apy_outliers
+-- =============================================================================
+-- DeFiLlama occasionally reports negative or absurd APYs. The ingestion
+-- pipeline clamps APYs to a plausible range (POOL_APY_MIN / POOL_APY_MAX) and
+-- flags the pool as an outlier; apy holds the clamped value used for scoring
+-- and sorting, apy_raw the value as reported. Outliers are left out of pool
+-- rankings, trending pools and the APY distribution.
+
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS apy_raw NUMERIC;
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS is_outlier BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE pools SET apy_raw = apy WHERE apy_raw IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_pools_outlier ON pools(id) WHERE is_outlier;
+
+COMMENT ON COLUMN pools.apy_raw IS 'APY as reported by the source, before clamping to the plausible range';
+COMMENT ON COLUMN pools.is_outlier IS 'Reported APY outside the plausible range';
@@ -0,0 +1,48 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 013_pool_tags
+-- =============================================================================
+-- Pool categories. Ingestion tags each pool from two kinds of rules: the
+-- category of its protocol in protocol_metadata, and patterns on its symbol
+-- (stETH or rETH pools are liquid staking whatever the protocol). A protocol
+-- row matches the project exactly or with a version suffix, so "aave" covers
+-- aave-v2 and aave-v3. Pools of unknown protocols with no matching symbol are
+-- left untagged.
+
+CREATE TABLE IF NOT EXISTS protocol_metadata (
+    protocol VARCHAR(100) PRIMARY KEY,        -- DeFiLlama project, without version suffix
+    category VARCHAR(50) NOT NULL CHECK (category ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO protocol_metadata (protocol, category) VALUES
+    ('aave', 'lending'),
+    ('compound', 'lending'),
+    ('spark', 'lending'),
+    ('morpho-blue', 'lending'),
+    ('venus-core-pool', 'lending'),
+    ('uniswap', 'dex-lp'),
+    ('curve-dex', 'dex-lp'),
+    ('sushiswap', 'dex-lp'),
+    ('balancer', 'dex-lp'),
+    ('pancakeswap-amm', 'dex-lp'),
+    ('aerodrome-slipstream', 'dex-lp'),
+    ('lido', 'liquid-staking'),
+    ('rocket-pool', 'liquid-staking'),
+    ('frax-ether', 'liquid-staking'),
+    ('stader', 'liquid-staking'),
+    ('jito', 'liquid-staking'),
+    ('marinade-finance', 'liquid-staking'),
+    ('ondo-finance', 'rwa'),
+    ('maple', 'rwa'),
+    ('centrifuge', 'rwa'),
+    ('goldfinch', 'rwa')
+ON CONFLICT (protocol) DO NOTHING;
+
+ALTER TABLE pools ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_pools_tags ON pools USING GIN (tags);
+
+COMMENT ON TABLE protocol_metadata IS 'Category of each known protocol, used to tag its pools';
+COMMENT ON COLUMN pools.tags IS 'Categories from protocol and symbol rules, e.g. lending, dex-lp';
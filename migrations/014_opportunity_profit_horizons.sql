@@ -0,0 +1,11 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 014_opportunity_profit_horizons
+-- =============================================================================
+-- Adds the estimated profit of yield-gap opportunities at several holding
+-- periods (YIELD_GAP_PROFIT_HORIZONS, 7/30/90/365 days by default), so the
+-- fixed cost of moving weighs against the longer earning window explicitly.
+
+ALTER TABLE opportunities ADD COLUMN IF NOT EXISTS profit_by_horizon JSONB;
+
+COMMENT ON COLUMN opportunities.profit_by_horizon IS 'Estimated USD profit of yield-gap opportunities per holding period, [{days, profitUsd}]';
@@ -0,0 +1,25 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 015_pool_curation
+-- =============================================================================
+-- Attributes of a pool that no data source reports, set by hand through the
+-- admin API: whether its reward emissions follow a locked schedule or can be
+-- changed at will (say by a multisig), and whether it was audited. They live
+-- in their own table so re-ingesting a pool never overwrites them, and
+-- without a foreign key so they outlive a pool dropped and listed again.
+-- The pool queries select these columns without the table name, so none may
+-- share a name with a pools column.
+
+CREATE TABLE IF NOT EXISTS pool_curation (
+    pool_id VARCHAR(255) PRIMARY KEY,
+    reward_schedule VARCHAR(20) NOT NULL DEFAULT 'unknown'
+        CHECK (reward_schedule IN ('locked', 'adjustable', 'unknown')),
+    audited BOOLEAN NOT NULL DEFAULT FALSE,
+    notes TEXT NOT NULL DEFAULT '',
+    curated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_curation_audited ON pool_curation(pool_id) WHERE audited;
+
+COMMENT ON TABLE pool_curation IS 'Hand-curated pool attributes, kept apart from pools so ingestion never overwrites them';
+COMMENT ON COLUMN pool_curation.reward_schedule IS 'locked: emissions follow a schedule nobody can change; adjustable: emissions can be changed or stopped at will; unknown';
@@ -0,0 +1,15 @@
+-- =============================================================================
+-- DeFi Yield Aggregator - Database Schema
+-- Migration: 016_opportunity_listing_indexes
+-- =============================================================================
+-- Indexes for the opportunity listing. Listings are bounded to a detected_at
+-- window, by default the last 7 days, so the most common query, active
+-- opportunities newest first, reads a range of one index instead of sorting
+-- the whole table. Filtering by type while sorting by score, the default
+-- sort, reads the second.
+
+CREATE INDEX IF NOT EXISTS idx_opportunities_active_detected_at
+    ON opportunities(is_active, detected_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_opportunities_type_score
+    ON opportunities(type, score DESC);
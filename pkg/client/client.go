@@ -0,0 +1,361 @@
+// Package client is a typed Go client for the DeFi Yield Aggregator REST
+// API and its WebSocket streams. Requests and responses use the same types
+// as the server, re-exported in this package.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of a new Client
+const (
+	DefaultAPIKeyHeader = "X-API-Key"
+	DefaultTimeout      = 30 * time.Second
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// maxRetryWait caps the wait before a retry, including a Retry-After
+	// given by the server
+	maxRetryWait = time.Minute
+)
+
+// Client calls the REST API. Safe for concurrent use.
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	apiKey       string
+	apiKeyHeader string
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey sends key in the API key header with every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithAPIKeyHeader sets the header the API key is sent in
+// (default X-API-Key)
+func WithAPIKeyHeader(header string) Option {
+	return func(c *Client) {
+		c.apiKeyHeader = header
+	}
+}
+
+// WithRetries sets how often a request is retried after a 429, 502, 503 or
+// 504 response or a connection error, and the backoff before the first
+// retry, which doubles per attempt. A Retry-After header takes precedence.
+// 0 retries turns retrying off.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// New creates a client for the API at baseURL, e.g. https://api.example.com
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:      u,
+		httpClient:   &http.Client{Timeout: DefaultTimeout},
+		apiKeyHeader: DefaultAPIKeyHeader,
+		maxRetries:   DefaultMaxRetries,
+		retryBackoff: DefaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// =============================================================================
+// Pools
+// =============================================================================
+
+// ListPools lists pools matching filter. A general search (filter.Search)
+// returns the matching pools without their highlights.
+func (c *Client) ListPools(ctx context.Context, filter PoolFilter) (*PoolListResponse, error) {
+	var resp PoolListResponse
+	if err := c.get(ctx, "/api/v1/pools", poolFilterQuery(filter), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetPool returns one pool
+func (c *Client) GetPool(ctx context.Context, id string) (*Pool, error) {
+	var pool Pool
+	if err := c.get(ctx, "/api/v1/pools/"+url.PathEscape(id), nil, &pool); err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// GetPoolHistory returns the APY and TVL history of a pool over period
+// (1h, 24h, 7d or 30d; empty means 24h)
+func (c *Client) GetPoolHistory(ctx context.Context, id, period string) (*PoolHistoryResponse, error) {
+	query := url.Values{}
+	if period != "" {
+		query.Set("period", period)
+	}
+
+	var resp PoolHistoryResponse
+	if err := c.get(ctx, "/api/v1/pools/"+url.PathEscape(id)+"/history", query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// =============================================================================
+// Opportunities
+// =============================================================================
+
+// ListOpportunities lists opportunities matching filter. ActiveOnly is sent
+// as given, so set it to list only active opportunities like the API does
+// by default.
+func (c *Client) ListOpportunities(ctx context.Context, filter OpportunityFilter) (*OpportunityListResponse, error) {
+	var resp OpportunityListResponse
+	if err := c.get(ctx, "/api/v1/opportunities", opportunityFilterQuery(filter), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// =============================================================================
+// Aggregated data
+// =============================================================================
+
+// GetStats returns the platform statistics
+func (c *Client) GetStats(ctx context.Context) (*PlatformStats, error) {
+	var stats PlatformStats
+	if err := c.get(ctx, "/api/v1/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Chains lists the chains with their pool statistics. The zero filter
+// returns up to 100 chains by TVL.
+func (c *Client) Chains(ctx context.Context, filter ChainFilter) (*ChainListResponse, error) {
+	var resp ChainListResponse
+	if err := c.get(ctx, "/api/v1/chains", filterQuery(filter), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Protocols lists protocols matching filter
+func (c *Client) Protocols(ctx context.Context, filter ProtocolFilter) (*ProtocolListResponse, error) {
+	var resp ProtocolListResponse
+	if err := c.get(ctx, "/api/v1/protocols", filterQuery(filter), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Tags lists the pool tags with their pool counts and TVL
+func (c *Client) Tags(ctx context.Context) (*TagListResponse, error) {
+	var resp TagListResponse
+	if err := c.get(ctx, "/api/v1/tags", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// =============================================================================
+// Requests
+// =============================================================================
+
+// APIError is an error response from the API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    string
+	Fields     []FieldError // Validation failures, if any
+}
+
+// FieldError is a parameter that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API error %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Details != "" {
+		msg += " (" + e.Details + ")"
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// errorBody is the error envelope of the API. The rate limiter sends a
+// numeric code, so the code is decoded either way.
+type errorBody struct {
+	Error struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+		Details string          `json:"details"`
+		Errors  []FieldError    `json:"errors"`
+	} `json:"error"`
+}
+
+// get sends a GET request, retrying transient failures, and decodes the
+// JSON response into out
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, u.String())
+		wait := c.backoff(attempt)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.maxRetries {
+				return err
+			}
+		} else {
+			if !retryable(res.StatusCode) || attempt >= c.maxRetries {
+				defer res.Body.Close()
+				return decodeResponse(res, out)
+			}
+			wait = retryAfter(res, wait)
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes a single request
+func (c *Client) send(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set(c.apiKeyHeader, c.apiKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", req.URL.Path, err)
+	}
+	return res, nil
+}
+
+// backoff returns the wait before the retry after the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.retryBackoff << attempt
+	if wait <= 0 || wait > maxRetryWait {
+		return maxRetryWait
+	}
+	return wait
+}
+
+// retryable reports whether a response status is worth retrying
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait the server asked for in a Retry-After header,
+// in seconds or as a date, or fallback if it gave none
+func retryAfter(res *http.Response, fallback time.Duration) time.Duration {
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return fallback
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = time.Until(at)
+	} else {
+		return fallback
+	}
+
+	return min(max(wait, 0), maxRetryWait)
+}
+
+// decodeResponse decodes a successful response into out, or an error
+// response into an *APIError
+func decodeResponse(res *http.Response, out interface{}) error {
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+
+		var body errorBody
+		if err := json.NewDecoder(res.Body).Decode(&body); err == nil {
+			apiErr.Code = strings.Trim(string(body.Error.Code), `"`)
+			if body.Error.Message != "" {
+				apiErr.Message = body.Error.Message
+			}
+			apiErr.Details = body.Error.Details
+			apiErr.Fields = body.Error.Errors
+		}
+		return apiErr
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is a 404 response from the API
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
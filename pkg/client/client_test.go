@@ -0,0 +1,364 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	fiberws "github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/api/handlers"
+	ws "github.com/maxjove/defi-yield-aggregator/internal/api/websocket"
+	"github.com/maxjove/defi-yield-aggregator/internal/config"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// testServer is the API served in-process on a local listener. Routes are
+// registered at the paths of cmd/server and parse their parameters with the
+// server's own parsers, so a client that sends a parameter the server
+// doesn't read fails here. Responses come from fixtures instead of the
+// repositories.
+type testServer struct {
+	client *Client
+	hub    *ws.Hub
+
+	mu          sync.Mutex
+	poolFilter  models.PoolFilter
+	oppFilter   models.OpportunityFilter
+	protoFilter models.ProtocolFilter
+	apiKeys     []string
+}
+
+var fixturePool = models.Pool{
+	ID:       "pool-1",
+	Chain:    "ethereum",
+	Protocol: "aave-v3",
+	Symbol:   "USDC",
+	TVL:      decimal.NewFromInt(1000000),
+	APY:      decimal.RequireFromString("4.25"),
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	t.Helper()
+
+	s := &testServer{hub: ws.NewHub(config.WebSocketConfig{
+		PingInterval:   time.Hour,
+		PongTimeout:    time.Hour,
+		WriteTimeout:   time.Second,
+		MaxMessageSize: 512,
+	})}
+	go s.hub.Run()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		s.mu.Lock()
+		s.apiKeys = append(s.apiKeys, c.Get(DefaultAPIKeyHeader))
+		s.mu.Unlock()
+		return c.Next()
+	})
+
+	v1 := app.Group("/api/v1")
+	v1.Get("/pools", func(c *fiber.Ctx) error {
+		filter, errs := handlers.ParsePoolFilter(c)
+		if len(errs) > 0 {
+			return handlers.SendValidationError(c, errs)
+		}
+		s.mu.Lock()
+		s.poolFilter = filter
+		s.mu.Unlock()
+		return c.JSON(models.PoolListResponse{Data: []models.Pool{fixturePool}, Total: 1, Limit: filter.Limit, Offset: filter.Offset})
+	})
+	v1.Get("/pools/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") != fixturePool.ID {
+			return handlers.SendError(c, handlers.ErrNotFound.WithDetails("Pool not found"))
+		}
+		return c.JSON(fixturePool)
+	})
+	v1.Get("/pools/:id/history", func(c *fiber.Ctx) error {
+		period := c.Query("period", "24h")
+		if errs := handlers.ValidatePeriod(period); len(errs) > 0 {
+			return handlers.SendValidationError(c, errs)
+		}
+		return c.JSON(models.PoolHistoryResponse{
+			PoolID:     c.Params("id"),
+			Period:     period,
+			DataPoints: []models.HistoricalAPY{{PoolID: c.Params("id"), APY: fixturePool.APY}},
+		})
+	})
+	v1.Get("/opportunities", func(c *fiber.Ctx) error {
+		filter, errs := handlers.ParseOpportunityFilter(c)
+		if len(errs) > 0 {
+			return handlers.SendValidationError(c, errs)
+		}
+		s.mu.Lock()
+		s.oppFilter = filter
+		s.mu.Unlock()
+		return c.JSON(models.OpportunityListResponse{Data: []models.Opportunity{{ID: "opp-1", Type: filter.Type}}, Total: 1})
+	})
+	v1.Get("/stats", func(c *fiber.Ctx) error {
+		return c.JSON(models.PlatformStats{TotalPools: 42})
+	})
+	v1.Get("/chains", func(c *fiber.Ctx) error {
+		return c.JSON(models.ChainListResponse{Data: []models.Chain{{Name: "ethereum", PoolCount: 42}}, Total: 1})
+	})
+	v1.Get("/protocols", func(c *fiber.Ctx) error {
+		filter := models.ProtocolFilter{}
+		if err := c.QueryParser(&filter); err != nil {
+			return handlers.SendError(c, handlers.ErrBadRequest)
+		}
+		s.mu.Lock()
+		s.protoFilter = filter
+		s.mu.Unlock()
+		return c.JSON(models.ProtocolListResponse{Data: []models.Protocol{{Name: "aave-v3"}}, Total: 1})
+	})
+	v1.Get("/tags", func(c *fiber.Ctx) error {
+		return c.JSON(models.TagListResponse{Data: []models.TagStats{{Tag: models.TagLending, PoolCount: 12}}, Total: 1})
+	})
+
+	wsHandler := ws.NewHandler(s.hub, nil)
+	wsGroup := app.Group("/ws", ws.UpgradeCheck)
+	wsGroup.Get("/pools", fiberws.New(wsHandler.HandlePoolUpdates))
+	wsGroup.Get("/opportunities", fiberws.New(wsHandler.HandleOpportunityAlerts))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.hub.Shutdown(ctx)
+		app.Shutdown()
+	})
+
+	s.client, err = New("http://"+ln.Addr().String(), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return s
+}
+
+func TestListPools(t *testing.T) {
+	s := newTestServer(t)
+	stable := false
+	filter := PoolFilter{
+		Chain:      "ethereum",
+		Symbol:     "usdc",
+		MinAPY:     decimal.RequireFromString("2.5"),
+		StableCoin: &stable,
+		Tags:       []string{"liquid-staking", "dex-lp"},
+		Sort:       []SortKey{{Field: "apy", Order: "desc"}, {Field: "tvl", Order: "asc"}},
+		Limit:      10,
+		Offset:     20,
+	}
+
+	resp, err := s.client.ListPools(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != fixturePool.ID || !resp.Data[0].APY.Equal(fixturePool.APY) {
+		t.Errorf("Expected the fixture pool, got %+v", resp.Data)
+	}
+
+	got := s.poolFilter
+	if got.Chain != "ethereum" || got.Symbol != "usdc" || !got.MinAPY.Equal(filter.MinAPY) ||
+		got.StableCoin == nil || *got.StableCoin || got.Limit != 10 || got.Offset != 20 {
+		t.Errorf("Expected the server to parse the filter sent, got %+v", got)
+	}
+	if !reflect.DeepEqual(got.Sort, filter.Sort) {
+		t.Errorf("Expected sort %v, got %v", filter.Sort, got.Sort)
+	}
+	if !reflect.DeepEqual(got.Tags, []string{"dex-lp", "liquid-staking"}) {
+		t.Errorf("Expected both tags parsed, got %v", got.Tags)
+	}
+}
+
+func TestGetPool(t *testing.T) {
+	s := newTestServer(t)
+
+	pool, err := s.client.GetPool(context.Background(), fixturePool.ID)
+	if err != nil || pool.ID != fixturePool.ID || pool.Symbol != "USDC" {
+		t.Fatalf("Expected the fixture pool, got %+v (%v)", pool, err)
+	}
+
+	_, err = s.client.GetPool(context.Background(), "missing")
+	var apiErr *APIError
+	if !IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Code != "NOT_FOUND" || apiErr.Details != "Pool not found" {
+		t.Errorf("Expected a NOT_FOUND API error, got %v", err)
+	}
+}
+
+func TestGetPoolHistory(t *testing.T) {
+	s := newTestServer(t)
+
+	history, err := s.client.GetPoolHistory(context.Background(), fixturePool.ID, "7d")
+	if err != nil || history.Period != "7d" || len(history.DataPoints) != 1 {
+		t.Fatalf("Expected a 7d history, got %+v (%v)", history, err)
+	}
+
+	_, err = s.client.GetPoolHistory(context.Background(), fixturePool.ID, "2y")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "period" {
+		t.Errorf("Expected a validation error on period, got %v", err)
+	}
+}
+
+func TestListOpportunities(t *testing.T) {
+	s := newTestServer(t)
+	filter := OpportunityFilter{
+		Type:      models.OpportunityTypeYieldGap,
+		MinProfit: decimal.NewFromInt(5),
+		SortBy:    "profit",
+		Limit:     5,
+	}
+
+	resp, err := s.client.ListOpportunities(context.Background(), filter)
+	if err != nil || len(resp.Data) != 1 || resp.Data[0].Type != models.OpportunityTypeYieldGap {
+		t.Fatalf("Expected the fixture opportunity, got %+v (%v)", resp, err)
+	}
+
+	got := s.oppFilter
+	if got.Type != filter.Type || !got.MinProfit.Equal(filter.MinProfit) || got.SortBy != "profit" || got.Limit != 5 || got.ActiveOnly {
+		t.Errorf("Expected the server to parse the filter sent, got %+v", got)
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	s := newTestServer(t, WithAPIKey("secret"))
+	ctx := context.Background()
+
+	stats, err := s.client.GetStats(ctx)
+	if err != nil || stats.TotalPools != 42 {
+		t.Errorf("Expected stats, got %+v (%v)", stats, err)
+	}
+
+	chains, err := s.client.Chains(ctx, ChainFilter{})
+	if err != nil || len(chains.Data) != 1 || chains.Data[0].Name != "ethereum" {
+		t.Errorf("Expected chains, got %+v (%v)", chains, err)
+	}
+
+	protocols, err := s.client.Protocols(ctx, ProtocolFilter{Chain: "ethereum", SortBy: "apy", Limit: 5})
+	if err != nil || len(protocols.Data) != 1 {
+		t.Errorf("Expected protocols, got %+v (%v)", protocols, err)
+	}
+	if got := s.protoFilter; got.Chain != "ethereum" || got.SortBy != "apy" || got.Limit != 5 {
+		t.Errorf("Expected the server to parse the filter sent, got %+v", got)
+	}
+
+	tags, err := s.client.Tags(ctx)
+	if err != nil || len(tags.Data) != 1 || tags.Data[0].Tag != models.TagLending {
+		t.Errorf("Expected tags, got %+v (%v)", tags, err)
+	}
+
+	for _, key := range s.apiKeys {
+		if key != "secret" {
+			t.Errorf("Expected every request to carry the API key, got %q", key)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub, err := s.client.Subscribe(ctx, StreamPools, 0)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Wait for the hub to register the subscriber before broadcasting
+	deadline := time.Now().Add(2 * time.Second)
+	for s.hub.ClientsByChannel()["pools"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Subscriber never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.hub.BroadcastPoolUpdate(&fixturePool, nil)
+
+	var msg Message
+	select {
+	case msg = <-sub.Messages():
+	case <-time.After(2 * time.Second):
+		t.Fatal("No message received")
+	}
+	if msg.Type != MessageTypePoolUpdate || msg.Seq == 0 || len(msg.Data) == 0 {
+		t.Errorf("Expected the pool update, got %+v", msg)
+	}
+	if sub.LastSeq() != msg.Seq {
+		t.Errorf("Expected last seq %d, got %d", msg.Seq, sub.LastSeq())
+	}
+
+	cancel()
+	for range sub.Messages() {
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Expected the subscription to end with the context, got %v", sub.Err())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"code": 429, "message": "Rate limit exceeded. Please try again later."}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"code": "SERVICE_UNAVAILABLE", "message": "Service temporarily unavailable"}}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	_, err = c.GetStats(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "SERVICE_UNAVAILABLE" {
+		t.Errorf("Expected the last 503 returned, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected the request and two retries, got %d attempts", attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"none", "", time.Second},
+		{"seconds", "5", 5 * time.Second},
+		{"capped", "3600", maxRetryWait},
+		{"date in the past", "Mon, 01 Jan 2024 00:00:00 GMT", 0},
+		{"invalid", "soon", time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				res.Header.Set("Retry-After", tt.header)
+			}
+			if got := retryAfter(res, time.Second); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
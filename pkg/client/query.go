@@ -0,0 +1,85 @@
+package client
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// poolFilterQuery encodes a pool filter. Multi-key sorts are sent as a sort
+// spec in sortBy, and tags as a comma-separated list.
+func poolFilterQuery(filter PoolFilter) url.Values {
+	query := filterQuery(filter)
+	if len(filter.Tags) > 0 {
+		query["tag"] = []string{strings.Join(filter.Tags, ",")}
+	}
+	if len(filter.Sort) > 0 {
+		spec := make([]string, len(filter.Sort))
+		for i, key := range filter.Sort {
+			spec[i] = key.Field + ":" + key.Order
+		}
+		query["sortBy"] = []string{strings.Join(spec, ",")}
+		delete(query, "sortOrder")
+	}
+	return query
+}
+
+// opportunityFilterQuery encodes an opportunity filter. activeOnly is
+// always sent, since the API defaults it to true.
+func opportunityFilterQuery(filter OpportunityFilter) url.Values {
+	query := filterQuery(filter)
+	query["activeOnly"] = []string{strconv.FormatBool(filter.ActiveOnly)}
+	return query
+}
+
+// decimalType is the type of decimal filter values
+var decimalType = reflect.TypeOf(decimal.Decimal{})
+
+// filterQuery encodes the fields of a filter struct under their query tags,
+// the names the server parses them from. Zero values are left out so the
+// server applies its defaults.
+func filterQuery(filter interface{}) url.Values {
+	query := url.Values{}
+
+	v := reflect.ValueOf(filter)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("query")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		if value, ok := queryValue(v.Field(i)); ok {
+			query[name] = []string{value}
+		}
+	}
+
+	return query
+}
+
+// queryValue formats a filter field, reporting false for zero values
+func queryValue(field reflect.Value) (string, bool) {
+	if field.Type() == decimalType {
+		d := field.Interface().(decimal.Decimal)
+		return d.String(), !d.IsZero()
+	}
+
+	switch field.Kind() {
+	case reflect.Pointer:
+		// Set pointers are sent even when they point at a zero value
+		if field.IsNil() {
+			return "", false
+		}
+		value, _ := queryValue(field.Elem())
+		return value, true
+	case reflect.String:
+		return field.String(), field.String() != ""
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), field.Int() != 0
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), field.Bool()
+	}
+	return "", false
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Stream is a WebSocket stream of the API
+type Stream string
+
+// Streams
+const (
+	StreamPools         Stream = "pools"         // Pool updates
+	StreamOpportunities Stream = "opportunities" // Opportunity alerts and retractions
+)
+
+// Subscription is an open WebSocket stream. Messages are delivered on
+// Messages until the context ends, Close is called or the connection
+// drops; Err then tells why.
+type Subscription struct {
+	conn     *websocket.Conn
+	messages chan Message
+	lastSeq  atomic.Uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// Subscribe opens a WebSocket stream. A lastSeq from a previous
+// subscription's LastSeq resumes it: the server replays the messages missed
+// since, or sends a gap notice if it no longer has them. 0 starts fresh.
+func (c *Client) Subscribe(ctx context.Context, stream Stream, lastSeq uint64) (*Subscription, error) {
+	u := *c.baseURL
+	u.Scheme = "ws"
+	if c.baseURL.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.Path += "/ws/" + string(stream)
+	if lastSeq > 0 {
+		u.RawQuery = "lastSeq=" + strconv.FormatUint(lastSeq, 10)
+	}
+
+	header := http.Header{}
+	if c.apiKey != "" {
+		header.Set(c.apiKeyHeader, c.apiKey)
+	}
+
+	conn, res, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if res != nil {
+			return nil, fmt.Errorf("failed to subscribe to %s: %s", stream, res.Status)
+		}
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", stream, err)
+	}
+
+	s := &Subscription{
+		conn:     conn,
+		messages: make(chan Message),
+		closed:   make(chan struct{}),
+	}
+	s.lastSeq.Store(lastSeq)
+
+	go s.readLoop(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.closed:
+		}
+	}()
+
+	return s, nil
+}
+
+// Messages returns the channel messages are delivered on. It is closed when
+// the subscription ends.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// LastSeq returns the sequence number of the last message delivered, to
+// resume from after a reconnect
+func (s *Subscription) LastSeq() uint64 {
+	return s.lastSeq.Load()
+}
+
+// Err returns why the subscription ended once Messages is closed: nil after
+// Close, the context's error, or the connection error
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+// readLoop parses messages off the connection and delivers them until the
+// subscription ends
+func (s *Subscription) readLoop(ctx context.Context) {
+	defer close(s.messages)
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.end(ctx, err)
+			return
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.end(ctx, fmt.Errorf("failed to parse message: %w", err))
+			return
+		}
+
+		select {
+		case s.messages <- msg:
+			if msg.Seq > 0 {
+				s.lastSeq.Store(msg.Seq)
+			}
+		case <-s.closed:
+			s.end(ctx, nil)
+			return
+		}
+	}
+}
+
+// end records why the subscription ended and closes it. Errors caused by
+// closing the connection ourselves are not reported.
+func (s *Subscription) end(ctx context.Context, err error) {
+	select {
+	case <-s.closed:
+		err = ctx.Err()
+	default:
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+			err = nil
+		}
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+
+	s.Close()
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"github.com/maxjove/defi-yield-aggregator/internal/api/websocket"
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// Request and response types, shared with the server
+type (
+	Pool                    = models.Pool
+	PoolFilter              = models.PoolFilter
+	PoolListResponse        = models.PoolListResponse
+	PoolHistoryResponse     = models.PoolHistoryResponse
+	HistoricalAPY           = models.HistoricalAPY
+	SortKey                 = models.SortKey
+	Opportunity             = models.Opportunity
+	OpportunityType         = models.OpportunityType
+	OpportunityFilter       = models.OpportunityFilter
+	OpportunityListResponse = models.OpportunityListResponse
+	RiskLevel               = models.RiskLevel
+	PlatformStats           = models.PlatformStats
+	Chain                   = models.Chain
+	ChainFilter             = models.ChainFilter
+	ChainListResponse       = models.ChainListResponse
+	Protocol                = models.Protocol
+	ProtocolFilter          = models.ProtocolFilter
+	ProtocolListResponse    = models.ProtocolListResponse
+	TagStats                = models.TagStats
+	TagListResponse         = models.TagListResponse
+)
+
+// WebSocket message types, shared with the server
+type (
+	Message     = websocket.Message
+	MessageType = websocket.MessageType
+	GapNotice   = websocket.GapNotice
+	MergedAlert = websocket.MergedAlert
+)
+
+// WebSocket message types
+const (
+	MessageTypePoolUpdate           = websocket.MessageTypePoolUpdate
+	MessageTypePoolsSnapshot        = websocket.MessageTypePoolsSnapshot
+	MessageTypeOpportunityAlert     = websocket.MessageTypeOpportunityAlert
+	MessageTypeOpportunityRetracted = websocket.MessageTypeOpportunityRetracted
+	MessageTypeOpportunityMerged    = websocket.MessageTypeOpportunityMerged
+	MessageTypeGap                  = websocket.MessageTypeGap
+	MessageTypeError                = websocket.MessageTypeError
+)
@@ -0,0 +1,115 @@
+// Package eventlog writes and reads the worker's event log: every pool update
+// and opportunity alert it publishes, appended as NDJSON to one file per hour
+// so a day of events can be replayed for analysis after the pub/sub messages
+// are gone.
+//
+// The hour being written is a plain .ndjson file. When the hour is over it is
+// compressed to a .ndjson.gz file, written under a temporary name and renamed
+// into place, and the plain file removed. Readers read both.
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// SchemaVersion is the version of the event envelope and payloads written.
+// Readers reject events of a newer version.
+const SchemaVersion = 1
+
+// Event types
+const (
+	TypePoolUpdate       = "pool_update"
+	TypeOpportunityAlert = "opportunity_alert"
+)
+
+// Event payload types, shared with the server
+type (
+	PoolUpdate  = models.PoolUpdate
+	Opportunity = models.Opportunity
+)
+
+// Event is one line of the log
+type Event struct {
+	Schema int             `json:"schema"`
+	Type   string          `json:"type"`
+	Time   time.Time       `json:"time"` // When the event was published
+	Data   json.RawMessage `json:"data"`
+}
+
+// PoolUpdate decodes the payload of a pool_update event
+func (e Event) PoolUpdate() (*PoolUpdate, error) {
+	if e.Type != TypePoolUpdate {
+		return nil, fmt.Errorf("event is a %s, not a %s", e.Type, TypePoolUpdate)
+	}
+	var update PoolUpdate
+	if err := json.Unmarshal(e.Data, &update); err != nil {
+		return nil, fmt.Errorf("failed to decode pool update: %w", err)
+	}
+	return &update, nil
+}
+
+// Opportunity decodes the payload of an opportunity_alert event
+func (e Event) Opportunity() (*Opportunity, error) {
+	if e.Type != TypeOpportunityAlert {
+		return nil, fmt.Errorf("event is a %s, not a %s", e.Type, TypeOpportunityAlert)
+	}
+	var opp Opportunity
+	if err := json.Unmarshal(e.Data, &opp); err != nil {
+		return nil, fmt.Errorf("failed to decode opportunity: %w", err)
+	}
+	return &opp, nil
+}
+
+// File names: events-2026-01-02T15.ndjson while the hour is written,
+// events-2026-01-02T15.ndjson.gz once it is rotated
+const (
+	filePrefix    = "events-"
+	hourLayout    = "2006-01-02T15"
+	activeSuffix  = ".ndjson"
+	rotatedSuffix = ".ndjson.gz"
+	tempSuffix    = ".tmp"
+)
+
+// hourOf returns the UTC hour a time falls in
+func hourOf(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// activePath returns the path of the plain file of an hour
+func activePath(dir string, hour time.Time) string {
+	return filepath.Join(dir, filePrefix+hour.Format(hourLayout)+activeSuffix)
+}
+
+// rotatedPath returns the path of the compressed file of an hour
+func rotatedPath(dir string, hour time.Time) string {
+	return filepath.Join(dir, filePrefix+hour.Format(hourLayout)+rotatedSuffix)
+}
+
+// parseFileName returns the hour of a log file and whether it is rotated.
+// ok is false for files that aren't part of the log, temporary files
+// included.
+func parseFileName(name string) (hour time.Time, rotated, ok bool) {
+	rest, found := strings.CutPrefix(name, filePrefix)
+	if !found {
+		return time.Time{}, false, false
+	}
+	if stamp, found := strings.CutSuffix(rest, rotatedSuffix); found {
+		rest, rotated = stamp, true
+	} else if stamp, found := strings.CutSuffix(rest, activeSuffix); found {
+		rest = stamp
+	} else {
+		return time.Time{}, false, false
+	}
+
+	hour, err := time.Parse(hourLayout, rest)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return hour, rotated, true
+}
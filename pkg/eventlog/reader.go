@@ -0,0 +1,130 @@
+package eventlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrStop can be returned by a Read callback to end the read early without
+// an error
+var ErrStop = errors.New("stop reading")
+
+// Read streams the events of the log in dir published in [from, to) to fn,
+// hour by hour and in the order they were written within an hour. A zero
+// from or to leaves that end open. Lines that don't decode, such as a
+// partial line at the end of the file being written, are skipped. An event
+// of a newer schema version than this package knows ends the read with an
+// error.
+func Read(dir string, from, to time.Time, fn func(Event) error) error {
+	files, err := listFiles(dir, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := readFile(file, from, to, fn); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// logFile is a file of the log
+type logFile struct {
+	path    string
+	hour    time.Time
+	rotated bool
+}
+
+// listFiles returns the files of the hours overlapping [from, to), oldest
+// first. An hour both rotated and plain, left by a crash during rotation,
+// is read from the rotated file.
+func listFiles(dir string, from, to time.Time) ([]logFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event log: %w", err)
+	}
+
+	byHour := make(map[time.Time]logFile)
+	for _, entry := range entries {
+		hour, rotated, ok := parseFileName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if !to.IsZero() && !hour.Before(to) {
+			continue
+		}
+		if !from.IsZero() && !hour.Add(time.Hour).After(from) {
+			continue
+		}
+		if existing, ok := byHour[hour]; ok && existing.rotated {
+			continue
+		}
+		byHour[hour] = logFile{path: filepath.Join(dir, entry.Name()), hour: hour, rotated: rotated}
+	}
+
+	files := make([]logFile, 0, len(byHour))
+	for _, file := range byHour {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].hour.Before(files[j].hour)
+	})
+	return files, nil
+}
+
+// readFile streams the events of one file in [from, to) to fn
+func readFile(file logFile, from, to time.Time, fn func(Event) error) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return fmt.Errorf("failed to open event log file: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if file.rotated {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file.path), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without its newline is still being written
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file.path), err)
+		}
+
+		var event Event
+		if json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		if event.Schema > SchemaVersion {
+			return fmt.Errorf("event log schema version %d is newer than the supported %d", event.Schema, SchemaVersion)
+		}
+		if (!from.IsZero() && event.Time.Before(from)) || (!to.IsZero() && !event.Time.Before(to)) {
+			continue
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package eventlog
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRead_FiltersByTimeRange(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	clock := &testClock{t: start}
+	w, _ := open(Config{Dir: dir, BatchSize: 1}, clock.now)
+
+	// One event every 30 minutes from 10:30 to 13:00
+	for i := 0; i < 6; i++ {
+		clock.t = start.Add(time.Duration(i) * 30 * time.Minute)
+		_ = w.Append(TypePoolUpdate, poolUpdate(clock.t.Format("15:04")))
+	}
+	_ = w.Close()
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"everything", time.Time{}, time.Time{}, []string{"10:30", "11:00", "11:30", "12:00", "12:30", "13:00"}},
+		{"within an hour", at(11, 15), at(11, 45), []string{"11:30"}},
+		{"across hours", at(11, 0), at(12, 30), []string{"11:00", "11:30", "12:00"}},
+		{"open start", time.Time{}, at(11, 0), []string{"10:30"}},
+		{"open end", at(12, 30), time.Time{}, []string{"12:30", "13:00"}},
+		{"nothing", at(14, 0), at(15, 0), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := Read(dir, tt.from, tt.to, func(e Event) error {
+				update, err := e.PoolUpdate()
+				if err != nil {
+					return err
+				}
+				got = append(got, update.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func TestRead_SkipsPartialLinesAndStops(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{t: at(12, 0)}
+	w, _ := open(Config{Dir: dir, BatchSize: 1}, clock.now)
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	_ = w.Append(TypePoolUpdate, poolUpdate("b"))
+
+	// A line being written
+	f, _ := os.OpenFile(activePath(dir, at(12, 0)), os.O_WRONLY|os.O_APPEND, 0)
+	_, _ = f.WriteString(`{"schema":1,"type":"pool_`)
+	f.Close()
+
+	if events := readAll(t, dir); len(events) != 2 {
+		t.Errorf("Expected the 2 complete events, got %d", len(events))
+	}
+
+	count := 0
+	err := Read(dir, time.Time{}, time.Time{}, func(Event) error {
+		count++
+		return ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Expected ErrStop to end the read after 1 event without error, got %d, %v", count, err)
+	}
+}
+
+func TestRead_RejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	line := `{"schema":99,"type":"pool_update","time":"2026-03-01T12:00:00Z","data":{}}` + "\n"
+	if err := os.WriteFile(activePath(dir, at(12, 0)), []byte(line), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	err := Read(dir, time.Time{}, time.Time{}, func(Event) error { return nil })
+	if err == nil || errors.Is(err, ErrStop) {
+		t.Errorf("Expected a newer schema to fail the read, got %v", err)
+	}
+}
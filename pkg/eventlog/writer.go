@@ -0,0 +1,348 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the settings of a Writer
+type Config struct {
+	Dir       string
+	BatchSize int           // Events buffered before they are written; 1 or less writes each at once
+	Retention time.Duration // Rotated files older than this are deleted (0 = kept forever)
+}
+
+// Writer appends events to the log. Events are buffered and written in
+// batches, each followed by an fsync, so a crash loses at most the events
+// buffered and can leave at most one partial line at the end of the active
+// file, which Open cuts off. It is safe for concurrent use.
+type Writer struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File  // Plain file of the active hour; nil until written to
+	hour    time.Time // Hour of file
+	buf     bytes.Buffer
+	bufHour time.Time // Hour of the buffered events
+	pending int       // Events buffered
+}
+
+// Open opens the log in cfg.Dir for appending, creating the directory if
+// needed. It recovers from a crash first: partial lines at the end of plain
+// files are cut off, hours that are over are rotated and leftover temporary
+// files removed.
+func Open(cfg Config) (*Writer, error) {
+	return open(cfg, time.Now)
+}
+
+// open opens the log with a clock
+func open(cfg Config, now func() time.Time) (*Writer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+
+	w := &Writer{cfg: cfg, now: now}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// recover repairs the log after an unclean shutdown
+func (w *Writer) recover() error {
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list event log: %w", err)
+	}
+
+	rotated := make(map[time.Time]bool)
+	var active []time.Time
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, tempSuffix) {
+			// A rotation that didn't finish; its plain file is still there
+			if err := os.Remove(filepath.Join(w.cfg.Dir, name)); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+			continue
+		}
+		hour, isRotated, ok := parseFileName(name)
+		switch {
+		case !ok:
+		case isRotated:
+			rotated[hour] = true
+		default:
+			active = append(active, hour)
+		}
+	}
+
+	current := hourOf(w.now())
+	for _, hour := range active {
+		path := activePath(w.cfg.Dir, hour)
+		if rotated[hour] {
+			// Rotated, but the crash came before the plain file was removed
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove rotated event log file: %w", err)
+			}
+			continue
+		}
+		if err := repairTail(path); err != nil {
+			return err
+		}
+		if hour.Before(current) {
+			if err := w.rotate(hour); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// repairTail cuts a plain file off after its last complete, valid line
+func repairTail(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open event log file: %w", err)
+	}
+	defer file.Close()
+
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil || !json.Valid(line) {
+			break
+		}
+		valid += int64(len(line))
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat event log file: %w", err)
+	}
+	if info.Size() == valid {
+		return nil
+	}
+	if err := file.Truncate(valid); err != nil {
+		return fmt.Errorf("failed to cut off partial events: %w", err)
+	}
+	return file.Sync()
+}
+
+// Append adds an event of the given type with v as its payload, stamped
+// with the current time. It is written with the next batch.
+func (w *Writer) Append(eventType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	now := w.now().UTC()
+	line, err := json.Marshal(Event{Schema: SchemaVersion, Type: eventType, Time: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// A batch holds the events of one hour
+	if hour := hourOf(now); w.pending > 0 && !hour.Equal(w.bufHour) {
+		if err := w.flushLocked(); err != nil {
+			return err
+		}
+	}
+	if w.pending == 0 {
+		w.bufHour = hourOf(now)
+	}
+	w.buf.Write(line)
+	w.buf.WriteByte('\n')
+	w.pending++
+
+	if w.pending >= w.cfg.BatchSize {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+// Flush writes the buffered events and rotates the active file if its hour
+// is over
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if w.file != nil && w.hour.Before(hourOf(w.now())) {
+		return w.closeAndRotate()
+	}
+	return nil
+}
+
+// flushLocked writes the buffered events to the file of their hour. Events
+// arriving late for an hour already rotated go to the active file, or that
+// of the current hour. The lock must be held.
+func (w *Writer) flushLocked() error {
+	if w.pending == 0 {
+		return nil
+	}
+
+	if w.file != nil && w.bufHour.After(w.hour) {
+		if err := w.closeAndRotate(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		hour := w.bufHour
+		if _, err := os.Stat(rotatedPath(w.cfg.Dir, hour)); err == nil {
+			hour = hourOf(w.now())
+		}
+		file, err := os.OpenFile(activePath(w.cfg.Dir, hour), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open event log file: %w", err)
+		}
+		w.file, w.hour = file, hour
+	}
+
+	if _, err := w.file.Write(w.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync events: %w", err)
+	}
+	w.buf.Reset()
+	w.pending = 0
+	return nil
+}
+
+// closeAndRotate closes the active file and rotates it. The lock must be
+// held.
+func (w *Writer) closeAndRotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close event log file: %w", err)
+	}
+	return w.rotate(w.hour)
+}
+
+// rotate compresses the plain file of an hour that is over and deletes the
+// rotated files past the retention. The compressed file is written under a
+// temporary name and renamed into place, so it is either complete or
+// absent; the plain file is removed only then.
+func (w *Writer) rotate(hour time.Time) error {
+	src := activePath(w.cfg.Dir, hour)
+	dst := rotatedPath(w.cfg.Dir, hour)
+
+	if err := compressFile(src, dst+tempSuffix); err != nil {
+		os.Remove(dst + tempSuffix)
+		return err
+	}
+	if err := os.Rename(dst+tempSuffix, dst); err != nil {
+		return fmt.Errorf("failed to rotate event log file: %w", err)
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove rotated event log file: %w", err)
+	}
+
+	return w.prune()
+}
+
+// compressFile writes a gzip copy of src to dst and syncs it
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open event log file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create rotated event log file: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return fmt.Errorf("failed to compress event log file: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress event log file: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync rotated event log file: %w", err)
+	}
+	return out.Close()
+}
+
+// prune deletes rotated files whose hour ended before the retention
+func (w *Writer) prune() error {
+	if w.cfg.Retention <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list event log: %w", err)
+	}
+	cutoff := w.now().Add(-w.cfg.Retention)
+	for _, entry := range entries {
+		hour, rotated, ok := parseFileName(entry.Name())
+		if !ok || !rotated || !hour.Add(time.Hour).Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.cfg.Dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete expired event log file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close writes the buffered events and closes the active file. Its hour is
+// rotated by the next Open once it is over.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	flushErr := w.flushLocked()
+	if w.file == nil {
+		return flushErr
+	}
+	closeErr := w.file.Close()
+	w.file = nil
+	return errors.Join(flushErr, closeErr)
+}
+
+// Run flushes the log every interval, so events are written and hours
+// rotated even while few are published, until ctx is done; then it closes
+// the log. Failures are reported to onError.
+func (w *Writer) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := w.Close(); err != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package eventlog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/maxjove/defi-yield-aggregator/internal/models"
+)
+
+// testClock is a settable clock
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+// logFiles returns the names of the files in dir
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readAll reads every event of the log
+func readAll(t *testing.T, dir string) []Event {
+	t.Helper()
+	var events []Event
+	if err := Read(dir, time.Time{}, time.Time{}, func(e Event) error {
+		events = append(events, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return events
+}
+
+func poolUpdate(id string) PoolUpdate {
+	return PoolUpdate{Pool: models.Pool{ID: id}}
+}
+
+func TestWriter_RotatesOnTheHour(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{t: time.Date(2026, 3, 1, 12, 59, 59, 999e6, time.UTC)}
+	w, err := open(Config{Dir: dir, BatchSize: 10}, clock.now)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	clock.t = clock.t.Add(time.Millisecond) // 13:00:00
+	_ = w.Append(TypePoolUpdate, poolUpdate("b"))
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	want := []string{"events-2026-03-01T12.ndjson.gz", "events-2026-03-01T13.ndjson"}
+	if got := logFiles(t, dir); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Expected files %v, got %v", want, got)
+	}
+
+	// The active hour is rotated by a flush once it is over, even without
+	// new events
+	clock.t = time.Date(2026, 3, 1, 14, 0, 1, 0, time.UTC)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	want = []string{"events-2026-03-01T12.ndjson.gz", "events-2026-03-01T13.ndjson.gz"}
+	if got := logFiles(t, dir); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Expected files %v, got %v", want, got)
+	}
+
+	events := readAll(t, dir)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	for i, id := range []string{"a", "b"} {
+		update, err := events[i].PoolUpdate()
+		if err != nil || update.ID != id {
+			t.Errorf("Expected event %d to update pool %s, got %v, %v", i, id, update, err)
+		}
+		if events[i].Schema != SchemaVersion {
+			t.Errorf("Expected schema %d, got %d", SchemaVersion, events[i].Schema)
+		}
+	}
+}
+
+func TestWriter_BatchesEvents(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	w, _ := open(Config{Dir: dir, BatchSize: 3}, clock.now)
+
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	_ = w.Append(TypePoolUpdate, poolUpdate("b"))
+	if events := readAll(t, dir); len(events) != 0 {
+		t.Fatalf("Expected the events to be buffered, read %d", len(events))
+	}
+
+	_ = w.Append(TypeOpportunityAlert, Opportunity{ID: "opp"})
+	events := readAll(t, dir)
+	if len(events) != 3 {
+		t.Fatalf("Expected a full batch to be written, read %d", len(events))
+	}
+	if opp, err := events[2].Opportunity(); err != nil || opp.ID != "opp" {
+		t.Errorf("Expected the opportunity alert, got %v, %v", opp, err)
+	}
+	if _, err := events[2].PoolUpdate(); err == nil {
+		t.Error("Expected decoding an alert as a pool update to fail")
+	}
+}
+
+func TestOpen_RecoversCorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{t: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	w, _ := open(Config{Dir: dir, BatchSize: 1}, clock.now)
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	_ = w.Append(TypePoolUpdate, poolUpdate("b"))
+
+	// Crash midway through writing a line, without closing
+	active := activePath(dir, hourOf(clock.t))
+	f, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	_, _ = f.WriteString(`{"schema":1,"type":"pool_update","time":"2026-03-01T12:`)
+	f.Close()
+	before, _ := os.Stat(active)
+
+	// Restart within the hour: the tail is cut off and appending resumes
+	clock.t = clock.t.Add(time.Minute)
+	w, err = open(Config{Dir: dir, BatchSize: 1}, clock.now)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	after, _ := os.Stat(active)
+	if after.Size() >= before.Size() {
+		t.Fatalf("Expected the partial line to be cut off, size %d before, %d after", before.Size(), after.Size())
+	}
+	_ = w.Append(TypePoolUpdate, poolUpdate("c"))
+	_ = w.Close()
+
+	events := readAll(t, dir)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if update, _ := events[2].PoolUpdate(); update == nil || update.ID != "c" {
+		t.Errorf("Expected the event written after the restart last, got %v", update)
+	}
+}
+
+func TestOpen_FinishesInterruptedRotation(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{t: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	w, _ := open(Config{Dir: dir, BatchSize: 1}, clock.now)
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	_ = w.Close()
+
+	// A crash while compressing left a temporary file; the plain one is
+	// still complete
+	hour := hourOf(clock.t)
+	if err := os.WriteFile(rotatedPath(dir, hour)+tempSuffix, []byte("partial gzip"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	clock.t = clock.t.Add(2 * time.Hour)
+	if _, err := open(Config{Dir: dir, BatchSize: 1}, clock.now); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if got := logFiles(t, dir); len(got) != 1 || got[0] != filepath.Base(rotatedPath(dir, hour)) {
+		t.Fatalf("Expected only the rotated hour, got %v", got)
+	}
+	if events := readAll(t, dir); len(events) != 1 {
+		t.Errorf("Expected the event to survive, got %d", len(events))
+	}
+}
+
+func TestWriter_DeletesExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := rotatedPath(dir, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	kept := rotatedPath(dir, time.Date(2026, 2, 28, 13, 0, 0, 0, time.UTC))
+	for _, path := range []string{old, kept} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	clock := &testClock{t: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)}
+	w, _ := open(Config{Dir: dir, BatchSize: 1, Retention: 24 * time.Hour}, clock.now)
+	_ = w.Append(TypePoolUpdate, poolUpdate("a"))
+	clock.t = clock.t.Add(time.Hour)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Expected the file past the retention to be deleted")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Expected the file within the retention to be kept: %v", err)
+	}
+}